@@ -50,6 +50,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/compress"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/keys"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
 )
@@ -569,17 +570,11 @@ func (c *Changes) deleteFiles() error {
 func buildIndex(d *compress.Decompressor, idxPath, tmpDir string, count int) (*recsplit.Index, error) {
 	var rs *recsplit.RecSplit
 	var err error
-	if rs, err = recsplit.NewRecSplit(recsplit.RecSplitArgs{
-		KeyCount:   count,
-		Enums:      false,
-		BucketSize: 2000,
-		LeafSize:   8,
-		TmpDir:     tmpDir,
-		StartSeed: []uint64{0x106393c187cae21a, 0x6453cec3f7376937, 0x643e521ddbd2be98, 0x3740c6412f6572cb, 0x717d47562f1ce470, 0x4cd6eb4c63befb7c, 0x9bfd8c5e18c8da73,
-			0x082f20e10092a9a3, 0x2ada2ce68d21defc, 0xe33cb4f3e7c6466b, 0x3980be458c509c59, 0xc466fd9584828e8c, 0x45f0aabe1a61ede6, 0xf6e7b8b33ad9b98d,
-			0x4ef95e25f4b4983d, 0x81175195173b92d3, 0x4e50927d8dd15978, 0x1ea2099d1fafae7f, 0x425c8a06fbaaa815, 0xcd4216006c74052a},
-		IndexFile: idxPath,
-	}); err != nil {
+	args := recsplit.RecSplitArgs{KeyCount: count, TmpDir: tmpDir, IndexFile: idxPath}
+	if err = recsplit.SmallIndex.Apply(&args); err != nil {
+		return nil, err
+	}
+	if rs, err = recsplit.NewRecSplit(args); err != nil {
 		return nil, err
 	}
 	defer rs.Close()
@@ -729,12 +724,11 @@ func (c *Changes) produceChangeSets(blockFrom, blockTo uint64, historyType, bitm
 	if err = c.rewind(); err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("produceChangeSets rewind: %w", err)
 	}
-	var txKey = make([]byte, 8, 60)
+	var txKey = make([]byte, 0, 60)
 	for b, txNum, e = c.nextTx(); b && e == nil; b, txNum, e = c.nextTx() {
-		binary.BigEndian.PutUint64(txKey[:8], txNum)
 		for key, before, after, b, e = c.nextTriple(key[:0], before[:0], after[:0]); b && e == nil; key, before, after, b, e = c.nextTriple(key[:0], before[:0], after[:0]) {
 			totalRecords++
-			txKey = append(txKey[:8], key...)
+			txKey = keys.AppendTxNum(txKey[:0], txNum, key)
 			// In the inital files and most merged file, the txKey is added to the file, but it gets removed in the final merge
 			if err = comp.AddUncompressedWord(txKey); err != nil {
 				return nil, nil, nil, nil, fmt.Errorf("produceChangeSets AddWord key: %w", err)
@@ -1605,17 +1599,11 @@ func (a *Aggregator) reduceHistoryFiles(fType FileType, item *byEndBlockItem) er
 		return fmt.Errorf("reduceHistoryFiles create decompressor: %w", err)
 	}
 	var rs *recsplit.RecSplit
-	if rs, err = recsplit.NewRecSplit(recsplit.RecSplitArgs{
-		KeyCount:   count,
-		Enums:      false,
-		BucketSize: 2000,
-		LeafSize:   8,
-		TmpDir:     a.diffDir,
-		StartSeed: []uint64{0x106393c187cae21a, 0x6453cec3f7376937, 0x643e521ddbd2be98, 0x3740c6412f6572cb, 0x717d47562f1ce470, 0x4cd6eb4c63befb7c, 0x9bfd8c5e18c8da73,
-			0x082f20e10092a9a3, 0x2ada2ce68d21defc, 0xe33cb4f3e7c6466b, 0x3980be458c509c59, 0xc466fd9584828e8c, 0x45f0aabe1a61ede6, 0xf6e7b8b33ad9b98d,
-			0x4ef95e25f4b4983d, 0x81175195173b92d3, 0x4e50927d8dd15978, 0x1ea2099d1fafae7f, 0x425c8a06fbaaa815, 0xcd4216006c74052a},
-		IndexFile: idxPath,
-	}); err != nil {
+	args := recsplit.RecSplitArgs{KeyCount: count, TmpDir: a.diffDir, IndexFile: idxPath}
+	if err = recsplit.SmallIndex.Apply(&args); err != nil {
+		return fmt.Errorf("reduceHistoryFiles NewRecSplit: %w", err)
+	}
+	if rs, err = recsplit.NewRecSplit(args); err != nil {
 		return fmt.Errorf("reduceHistoryFiles NewRecSplit: %w", err)
 	}
 	g1 := d.MakeGetter()
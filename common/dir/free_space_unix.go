@@ -0,0 +1,16 @@
+//go:build !windows
+
+package dir
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// FreeSpace - amount of bytes available to unprivileged user on filesystem where `path` located
+func FreeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil //nolint:unconvert
+}
@@ -0,0 +1,18 @@
+package dir
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// FreeSpace - amount of bytes available to current user on disk where `path` located
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &freeBytesAvailable, &totalBytes, &totalFreeBytes); err != nil {
+		return 0, err
+	}
+	return freeBytesAvailable, nil
+}
@@ -86,6 +86,8 @@ const (
 	TxAccessListAddressGas    uint64 = 2400 // Per address specified in EIP 2930 access list
 	TxAccessListStorageKeyGas uint64 = 1900 // Per storage key specified in EIP 2930 access list
 
+	PerEmptyAccountCostEIP7702 uint64 = 25000 // Per authorization of EIP-7702 set-code transaction
+
 	// These have been changed during the course of the chain
 	CallGasFrontier              uint64 = 40  // Once per CALL operation & message call transaction.
 	CallGasEIP150                uint64 = 700 // Static portion of gas for CALL-derivates after EIP 150 (Tangerine)
@@ -122,6 +124,10 @@ const (
 
 	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
 
+	BlobGasPerBlob   uint64 = 1 << 17 // Blob gas consumed by each blob of EIP-4844 transaction
+	MinBlobGasPrice  uint64 = 1       // Minimum price of blob gas (MIN_BLOB_GASPRICE of EIP-4844)
+	MaxBlobsPerBlock uint64 = 6       // Maximum number of blobs in a block
+
 	// Precompiled contract gas prices
 
 	EcrecoverGas        uint64 = 3000 // Elliptic curve sender recovery gas price
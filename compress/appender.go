@@ -0,0 +1,149 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// Appender - appends words to existing file without rewriting it: words are encoded by patterns and positions
+// dictionaries of file (dictionaries are not changed). For incremental files, which have words of same shape as
+// existing ones (fixed length keys...). Words are written after last word of file, header is updated by Finish.
+// Decompressors opened before Finish don't see appended words: they must be re-opened.
+// Only FormatPatterns files without checksums and skip list are supported
+type Appender struct {
+	filePath string
+	f        *os.File
+	w        *bufio.Writer
+	enc      *wordEncoder
+	size     int64 // size of file before append, to roll back by Close
+
+	wordsCount, emptyWordsCount uint64
+}
+
+func NewAppender(filePath string) (*Appender, error) {
+	f, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	a := &Appender{filePath: filePath, f: f}
+	if err = a.readDictionaries(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("appending to %s: %w", filePath, err)
+	}
+	if a.size, err = f.Seek(0, 2); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var trailer [8]byte
+	if _, err = f.ReadAt(trailer[:], a.size-8); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if hasChecksums(trailer[:]) || hasSkipList(trailer[:]) {
+		f.Close()
+		return nil, fmt.Errorf("appending to %s: append is not supported for file with checksums or skip list", filePath)
+	}
+	a.w = bufio.NewWriterSize(f, etl.BufIOSize)
+	a.enc.setWriter(a.w)
+	return a, nil
+}
+
+func (a *Appender) readDictionaries() error {
+	var header [24]byte
+	if _, err := a.f.ReadAt(header[:], 0); err != nil {
+		return err
+	}
+	if isZstd(header[:]) {
+		return fmt.Errorf("append is not supported for FormatZstd")
+	}
+	a.wordsCount = binary.BigEndian.Uint64(header[:8])
+	a.emptyWordsCount = binary.BigEndian.Uint64(header[8:16])
+	dictSize := binary.BigEndian.Uint64(header[16:24])
+	var posDictSize [8]byte
+	if _, err := a.f.ReadAt(posDictSize[:], int64(24+dictSize)); err != nil {
+		return err
+	}
+	dict := make([]byte, 8+dictSize+8+binary.BigEndian.Uint64(posDictSize[:]))
+	if _, err := a.f.ReadAt(dict, 16); err != nil {
+		return err
+	}
+	var err error
+	a.enc, err = newWordEncoder(dict)
+	return err
+}
+
+// AddWord - word is compressed by patterns of file. Patterns are not used if their positions are not in
+// positions dictionary of file
+func (a *Appender) AddWord(word []byte) error {
+	if err := a.enc.encodeWord(word); err != nil {
+		return err
+	}
+	a.count(word)
+	return nil
+}
+
+func (a *Appender) AddUncompressedWord(word []byte) error {
+	if err := a.enc.encodeUncompressedWord(word); err != nil {
+		return err
+	}
+	a.count(word)
+	return nil
+}
+
+func (a *Appender) count(word []byte) {
+	a.wordsCount++
+	if len(word) == 0 {
+		a.emptyWordsCount++
+	}
+}
+
+func (a *Appender) Count() int { return int(a.wordsCount) }
+
+// Finish - writes appended words and updated header to disk
+func (a *Appender) Finish() error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[:8], a.wordsCount)
+	binary.BigEndian.PutUint64(header[8:], a.emptyWordsCount)
+	if _, err := a.f.WriteAt(header[:], 0); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// Close - if Finish was not called: rolls back appended words
+func (a *Appender) Close() {
+	if a.f == nil {
+		return
+	}
+	_ = a.f.Truncate(a.size)
+	a.f.Close()
+	a.f = nil
+}
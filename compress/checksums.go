@@ -0,0 +1,159 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+// ErrChecksumMismatch - data of file is corrupted (see CompressorCfg.Checksums)
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Checksums are written after words (and skip list): crc32c of each page of words (4 bytes per page), page size,
+// start of checksums (offset in file) and magic. Readers which don't know about checksums can't read such files
+var checksumsMagic = [8]byte{0xff, 'c', 'r', 'c', '3', '2', 'c', 's'}
+
+const (
+	checksumsPageSize    = 4096
+	checksumsTrailerSize = 8 + 8 + 8 // page size, start of checksums, magic
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type checksums struct {
+	pageSize uint64
+	sums     []byte
+}
+
+// writeChecksums - appends checksums of words of ready file
+func writeChecksums(filePath string) error {
+	d, err := NewDecompressor(filePath)
+	if err != nil {
+		return err
+	}
+	words := d.data[d.wordsStart:]
+	pages := (len(words) + checksumsPageSize - 1) / checksumsPageSize
+	trailer := make([]byte, 4*pages+checksumsTrailerSize)
+	for page := 0; page < pages; page++ {
+		to := (page + 1) * checksumsPageSize
+		if to > len(words) {
+			to = len(words)
+		}
+		binary.BigEndian.PutUint32(trailer[4*page:], crc32.Checksum(words[page*checksumsPageSize:to], crc32c))
+	}
+	binary.BigEndian.PutUint64(trailer[4*pages:], checksumsPageSize)
+	binary.BigEndian.PutUint64(trailer[4*pages+8:], uint64(d.size))
+	copy(trailer[4*pages+16:], checksumsMagic[:])
+	if err = d.Close(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(trailer); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func hasChecksums(data []byte) bool { return bytes.HasSuffix(data, checksumsMagic[:]) }
+
+// openChecksums - cuts checksums off d.data
+func (d *Decompressor) openChecksums() error {
+	trailer := d.data[len(d.data)-checksumsTrailerSize:]
+	pageSize, start := binary.BigEndian.Uint64(trailer[:8]), binary.BigEndian.Uint64(trailer[8:16])
+	if pageSize == 0 || start > uint64(len(d.data)-checksumsTrailerSize) {
+		return fmt.Errorf("invalid checksums: page size %d, start %d, file size %d", pageSize, start, d.size)
+	}
+	d.checksums = &checksums{pageSize: pageSize, sums: d.data[start : len(d.data)-checksumsTrailerSize]}
+	d.data = d.data[:start]
+	return nil
+}
+
+func (d *Decompressor) validateChecksums() error {
+	if d.checksums == nil || d.wordsStart > uint64(len(d.data)) {
+		return nil
+	}
+	words := uint64(len(d.data)) - d.wordsStart
+	if pages := (words + d.checksums.pageSize - 1) / d.checksums.pageSize; uint64(len(d.checksums.sums)) != 4*pages {
+		return fmt.Errorf("invalid checksums: %d bytes for %d pages", len(d.checksums.sums), pages)
+	}
+	return nil
+}
+
+// HasChecksums - file was built with CompressorCfg.Checksums
+func (d *Decompressor) HasChecksums() bool { return d.checksums != nil }
+
+// VerifyChecksums - reads all words of file. Nil if file has no checksums
+func (d *Decompressor) VerifyChecksums() error {
+	if d.checksums == nil {
+		return nil
+	}
+	words := d.data[d.wordsStart:]
+	for page := uint64(0); page*d.checksums.pageSize < uint64(len(words)); page++ {
+		if err := d.checksums.verify(words, page); err != nil {
+			return fmt.Errorf("%s: %w", d.compressedFile, err)
+		}
+	}
+	return nil
+}
+
+func (c *checksums) verify(words []byte, page uint64) error {
+	from, to := page*c.pageSize, (page+1)*c.pageSize
+	if to > uint64(len(words)) {
+		to = uint64(len(words))
+	}
+	if crc32.Checksum(words[from:to], crc32c) != binary.BigEndian.Uint32(c.sums[4*page:]) {
+		return fmt.Errorf("%w: page %d, offset %d", ErrChecksumMismatch, page, from)
+	}
+	return nil
+}
+
+// Verify - getter checks pages of words it reads (each page once while reading sequentially) and panics
+// with ErrChecksumMismatch if page is corrupted: to not pass corrupted data to merges and RPC responses
+func (g *Getter) Verify(verify bool) error {
+	if verify && g.checksums == nil {
+		return fmt.Errorf("file %s has no checksums", g.fName)
+	}
+	g.verify, g.verifiedPage = verify, 0
+	return nil
+}
+
+// verifyRead - checks pages of words between from (position before read) and current position of getter
+func (g *Getter) verifyRead(from uint64) {
+	to := g.dataP
+	if to > from {
+		to-- // last byte of read word
+	}
+	pageSize := g.checksums.pageSize
+	for page := from / pageSize; page <= to/pageSize && page*pageSize < uint64(len(g.data)); page++ {
+		if page+1 == g.verifiedPage {
+			continue
+		}
+		if err := g.checksums.verify(g.data, page); err != nil {
+			panic(fmt.Errorf("%s: %w", g.fName, err))
+		}
+		g.verifiedPage = page + 1
+	}
+}
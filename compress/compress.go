@@ -33,6 +33,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/flanglet/kanzi-go/transform"
 	"github.com/ledgerwatch/erigon-lib/common"
 	dir2 "github.com/ledgerwatch/erigon-lib/common/dir"
@@ -56,6 +57,7 @@ type Compressor struct {
 	outputFile, tmpOutFilePath string // File where to output the dictionary and compressed data
 	tmpDir                     string // temporary directory to use for ETL when building dictionary
 	workers                    int
+	cfg                        CompressorCfg
 
 	// Buffer for "superstring" - transformation of superstrings where each byte of a word, say b,
 	// is turned into 2 bytes, 0x01 and b, and two zero bytes 0x00 0x00 are inserted after each word
@@ -65,16 +67,127 @@ type Compressor struct {
 	superstrings     chan []byte
 	wg               *sync.WaitGroup
 	suffixCollectors []*etl.Collector
+	superstringLimit int // superstringLimit or less, see CompressorCfg.MaxRAM
 	wordsCount       uint64
+	dictionary       [][]byte // patterns given by SetDictionary, sampling is skipped
+	exactDictionary  []byte   // given by SetExactDictionary
 
 	ctx       context.Context
 	logPrefix string
 	Ratio     CompressionRatio
 	trace     bool
+	progress  func(CompressionProgress)
 	lvl       log.Lvl
 }
 
+// CompressorCfg - tuning of dictionary building: domains with different shape of data (code, storage, ...)
+// are compressed better with different settings
+type CompressorCfg struct {
+	MinPatternScore uint64 // minimum score (per superstring) required to consider including pattern into the dictionary
+	MinPatternLen   int    // patterns shorter than it are not considered
+	MaxPatternLen   int    // patterns longer than it are not considered
+	MaxDictPatterns int    // maximum number of patterns in the initial (not reduced) dictionary
+	SamplingFactor  uint64 // only every SamplingFactor-th compressed word is sampled for patterns, 1 - all words
+	Workers         int
+	Format          Format // FormatZstd ignores settings of patterns
+	// MaxRAM - budget of dictionary building, 0 - no budget: structures are sized by data volume.
+	// With budget superstrings are shorter and collectors of patterns spill to tmpDir earlier (ratio may be worse).
+	// Budget is soft: sizes are not reduced below minimal ones, reducing of dictionary is not budgeted
+	MaxRAM datasize.ByteSize
+	// Checksums - crc32c of each page of words is stored in file, to detect corruption: see Getter.Verify
+	Checksums bool
+	// SkipListStep - offsets of every SkipListStep-th word are stored in file, 0 - none: Decompressor.WordIndex
+	// is available without pass over file (see SeekWord)
+	SkipListStep int
+	// MaxSampledWordLen - longer words are not sampled for patterns (but are compressed by patterns of other words).
+	// MaxPatternRepeats - only so many occurrences of candidate pattern are examined to count its repeats, score of
+	// pattern with more occurrences is extrapolated. Both cap time of dictionary building for data with very long
+	// repeated values (contract code...), 0 - no cap (results don't depend on them then)
+	MaxSampledWordLen int
+	MaxPatternRepeats int
+}
+
+// DefaultCompressorCfg - settings used by NewCompressor
+var DefaultCompressorCfg = CompressorCfg{
+	MinPatternScore: MinPatternScore,
+	MinPatternLen:   minPatternLen,
+	MaxPatternLen:   maxPatternLen,
+	MaxDictPatterns: maxDictPatterns,
+	SamplingFactor:  1,
+	Workers:         1,
+}
+
+func (cfg CompressorCfg) validate() error {
+	if cfg.MinPatternLen < 1 || cfg.MaxPatternLen < cfg.MinPatternLen {
+		return fmt.Errorf("invalid pattern length range: [%d, %d]", cfg.MinPatternLen, cfg.MaxPatternLen)
+	}
+	if cfg.MaxDictPatterns < 1 {
+		return fmt.Errorf("invalid MaxDictPatterns: %d", cfg.MaxDictPatterns)
+	}
+	if cfg.SamplingFactor < 1 {
+		return fmt.Errorf("invalid SamplingFactor: %d", cfg.SamplingFactor)
+	}
+	if cfg.Workers < 1 {
+		return fmt.Errorf("invalid Workers: %d", cfg.Workers)
+	}
+	if cfg.MaxSampledWordLen < 0 || cfg.MaxPatternRepeats < 0 {
+		return fmt.Errorf("invalid caps: MaxSampledWordLen %d, MaxPatternRepeats %d", cfg.MaxSampledWordLen, cfg.MaxPatternRepeats)
+	}
+	if cfg.MaxRAM != 0 && cfg.MaxRAM < minMaxRAM {
+		return fmt.Errorf("MaxRAM %s is less than minimum %s", cfg.MaxRAM.HR(), minMaxRAM.HR())
+	}
+	return nil
+}
+
+const (
+	minMaxRAM              = 16 * datasize.MB
+	minSuperstringLimit    = 64 * 1024
+	minCollectorBufferSize = 1 * datasize.MB
+)
+
+// superstringLimit - by MaxRAM: half of budget is for superstrings. Superstring is held by AddWord,
+// 2 per worker are in channel and each worker allocates 8 bytes per byte of superstring (see processSuperstring)
+func (cfg CompressorCfg) superstringLimit() int {
+	if cfg.MaxRAM == 0 {
+		return superstringLimit
+	}
+	limit := int(cfg.MaxRAM.Bytes()/2) / (11*cfg.Workers + 1)
+	if limit > superstringLimit {
+		return superstringLimit
+	}
+	if limit < minSuperstringLimit {
+		return minSuperstringLimit
+	}
+	return limit
+}
+
+// collectorBufferSize - by MaxRAM: other half of budget is for collectors of patterns (one per worker and one
+// to aggregate them), buffer can take twice of its size because of growth of slices
+func (cfg CompressorCfg) collectorBufferSize() datasize.ByteSize {
+	if cfg.MaxRAM == 0 {
+		return etl.BufferOptimalSize / 2
+	}
+	size := cfg.MaxRAM / 2 / datasize.ByteSize(2*(cfg.Workers+1))
+	if size > etl.BufferOptimalSize/2 {
+		return etl.BufferOptimalSize / 2
+	}
+	if size < minCollectorBufferSize {
+		return minCollectorBufferSize
+	}
+	return size
+}
+
 func NewCompressor(ctx context.Context, logPrefix, outputFile, tmpDir string, minPatternScore uint64, workers int, lvl log.Lvl) (*Compressor, error) {
+	cfg := DefaultCompressorCfg
+	cfg.MinPatternScore, cfg.Workers = minPatternScore, workers
+	return NewCompressorWithCfg(ctx, logPrefix, outputFile, tmpDir, cfg, lvl)
+}
+
+func NewCompressorWithCfg(ctx context.Context, logPrefix, outputFile, tmpDir string, cfg CompressorCfg, lvl log.Lvl) (*Compressor, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	workers := cfg.Workers
 	dir2.MustExist(tmpDir)
 	dir, fileName := filepath.Split(outputFile)
 	tmpOutFilePath := filepath.Join(dir, fileName) + ".tmp"
@@ -96,9 +209,9 @@ func NewCompressor(ctx context.Context, logPrefix, outputFile, tmpDir string, mi
 	wg.Add(workers)
 	suffixCollectors := make([]*etl.Collector, workers)
 	for i := 0; i < workers; i++ {
-		collector := etl.NewCollector(compressLogPrefix, tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize/2))
+		collector := etl.NewCollector(compressLogPrefix, tmpDir, etl.NewSortableBuffer(cfg.collectorBufferSize()))
 		suffixCollectors[i] = collector
-		go processSuperstring(superstrings, collector, minPatternScore, wg)
+		go processSuperstring(ctx, superstrings, collector, cfg, wg)
 	}
 
 	return &Compressor{
@@ -108,9 +221,11 @@ func NewCompressor(ctx context.Context, logPrefix, outputFile, tmpDir string, mi
 		tmpDir:           tmpDir,
 		logPrefix:        logPrefix,
 		workers:          workers,
+		cfg:              cfg,
 		ctx:              ctx,
 		superstrings:     superstrings,
 		suffixCollectors: suffixCollectors,
+		superstringLimit: cfg.superstringLimit(),
 		lvl:              lvl,
 		wg:               wg,
 	}, nil
@@ -130,11 +245,73 @@ func (c *Compressor) SetTrace(trace bool) {
 
 func (c *Compressor) Count() int { return int(c.wordsCount) }
 
+// CompressionPhase - step of Compress
+type CompressionPhase uint8
+
+const (
+	PhaseSuperstrings CompressionPhase = iota // finishing of processing of sampled superstrings
+	PhaseDictionary                           // selection of patterns
+	PhaseReplacement                          // search of patterns in words
+	PhaseEncoding                             // writing of words to file
+)
+
+func (p CompressionPhase) String() string {
+	switch p {
+	case PhaseSuperstrings:
+		return "superstrings"
+	case PhaseDictionary:
+		return "dictionary"
+	case PhaseReplacement:
+		return "replacement"
+	case PhaseEncoding:
+		return "encoding"
+	default:
+		return fmt.Sprintf("unknown phase %d", p)
+	}
+}
+
+// CompressionProgress - Processed words of Total in Phase, both are 0 for phases which don't go over words
+type CompressionProgress struct {
+	Phase            CompressionPhase
+	Processed, Total uint64
+}
+
+// progressStep - how often (in words) progress is reported and ctx is checked
+const progressStep = 64 * 1024
+
+func reportProgress(f func(CompressionProgress), phase CompressionPhase, processed, total uint64) {
+	if f != nil {
+		f(CompressionProgress{Phase: phase, Processed: processed, Total: total})
+	}
+}
+
+// SetProgress - f is called by Compress at start of each phase and every progressStep words of phase
+// (from goroutine of Compress). Compress can be cancelled by context of Compressor
+func (c *Compressor) SetProgress(f func(CompressionProgress)) {
+	c.progress = f
+}
+
+// SetDictionary - compress words by given patterns (from previous file: Decompressor.Patterns) instead of
+// sampling patterns from words. Must be called before first AddWord. Skipping of sampling makes compression
+// of small incremental files much cheaper, ratio is good while data of file is similar to data of source of patterns.
+// Patterns which are not used by words of file are not written to file
+func (c *Compressor) SetDictionary(patterns [][]byte) {
+	c.dictionary = patterns
+}
+
 func (c *Compressor) AddWord(word []byte) error {
 	c.wordsCount++
+	if c.dictionary != nil || c.exactDictionary != nil || c.cfg.Format == FormatZstd || c.wordsCount%c.cfg.SamplingFactor != 0 ||
+		(c.cfg.MaxSampledWordLen > 0 && len(word) > c.cfg.MaxSampledWordLen) {
+		return c.uncompressedFile.Append(word)
+	}
 
-	if len(c.superstring)+2*len(word)+2 > superstringLimit {
-		c.superstrings <- c.superstring
+	if len(c.superstring)+2*len(word)+2 > c.superstringLimit {
+		select {
+		case c.superstrings <- c.superstring:
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
 		c.superstring = nil
 	}
 	for _, a := range word {
@@ -154,15 +331,37 @@ func (c *Compressor) Compress() error {
 	c.uncompressedFile.w.Flush()
 	logEvery := time.NewTicker(20 * time.Second)
 	defer logEvery.Stop()
+	reportProgress(c.progress, PhaseSuperstrings, 0, 0)
 	if len(c.superstring) > 0 {
 		c.superstrings <- c.superstring
 	}
 	close(c.superstrings)
 	c.wg.Wait()
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
 
-	db, err := DictionaryBuilderFromCollectors(c.ctx, compressLogPrefix, c.tmpDir, c.suffixCollectors)
-	if err != nil {
+	if c.cfg.Format == FormatZstd {
+		defer os.Remove(c.tmpOutFilePath)
+		if err := c.compressZstd(); err != nil {
+			return err
+		}
+		return c.finish()
+	}
+	if c.exactDictionary != nil {
+		defer os.Remove(c.tmpOutFilePath)
+		if err := c.compressExact(); err != nil {
+			return err
+		}
+		return c.finish()
+	}
 
+	var db *DictionaryBuilder
+	var err error
+	reportProgress(c.progress, PhaseDictionary, 0, 0)
+	if c.dictionary != nil {
+		db = DictionaryBuilderFromPatterns(c.dictionary, c.cfg)
+	} else if db, err = dictionaryBuilderFromCollectors(c.ctx, compressLogPrefix, c.tmpDir, c.suffixCollectors, c.cfg); err != nil {
 		return err
 	}
 	if c.trace {
@@ -173,10 +372,24 @@ func (c *Compressor) Compress() error {
 	}
 
 	defer os.Remove(c.tmpOutFilePath)
-	if err := reducedict(c.ctx, c.trace, c.logPrefix, c.tmpOutFilePath, c.uncompressedFile, c.workers, db, c.lvl); err != nil {
+	if err := reducedict(c.ctx, c.trace, c.logPrefix, c.tmpOutFilePath, c.uncompressedFile, c.workers, db, c.progress, c.lvl); err != nil {
 		return err
 	}
+	return c.finish()
+}
 
+// finish - adds skip list, checksums and renames ready file to output file
+func (c *Compressor) finish() (err error) {
+	if c.cfg.SkipListStep > 0 {
+		if err := writeSkipList(c.tmpOutFilePath, c.cfg.SkipListStep); err != nil {
+			return fmt.Errorf("skip list: %w", err)
+		}
+	}
+	if c.cfg.Checksums {
+		if err := writeChecksums(c.tmpOutFilePath); err != nil {
+			return fmt.Errorf("checksums: %w", err)
+		}
+	}
 	if err := os.Rename(c.tmpOutFilePath, c.outputFile); err != nil {
 		return fmt.Errorf("renaming: %w", err)
 	}
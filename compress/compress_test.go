@@ -17,6 +17,7 @@
 package compress
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"hash/crc32"
@@ -25,6 +26,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/stretchr/testify/require"
 )
@@ -166,3 +168,452 @@ func TestCompressDict1(t *testing.T) {
 		t.Errorf("result file hash changed, %d", cs)
 	}
 }
+
+func TestAddWordsFrom(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	c, err := NewCompressor(context.Background(), t.Name(), file, tmpDir, 1, 2, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var words [][]byte
+	var stream bytes.Buffer
+	for i := 0; i < 3000; i++ {
+		w := []byte(fmt.Sprintf("%d longlongword %d", i, i))
+		if i%10 == 0 {
+			w = nil
+		}
+		words = append(words, w)
+		require.NoError(t, WriteWord(&stream, w, i%3 != 0))
+	}
+	added, err := c.AddWordsFrom(&stream)
+	require.NoError(t, err)
+	require.Equal(t, len(words), added)
+	require.NoError(t, c.Compress())
+
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+	g := d.MakeGetter()
+	for i, expect := range words {
+		require.True(t, g.HasNext())
+		var w []byte
+		if i%3 != 0 {
+			w, _ = g.Next(nil)
+		} else {
+			w, _ = g.NextUncompressed()
+		}
+		require.Equal(t, string(expect), string(w), i)
+	}
+	require.False(t, g.HasNext())
+
+	// truncated stream
+	stream.Reset()
+	require.NoError(t, WriteWord(&stream, []byte("word"), true))
+	stream.Truncate(stream.Len() - 1)
+	added, err = c.AddWordsFrom(&stream)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Zero(t, added)
+}
+
+func TestSetDictionary(t *testing.T) {
+	d := prepareDict(t)
+	defer d.Close()
+	patterns := d.Patterns()
+	require.NotEmpty(t, patterns)
+
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	c, err := NewCompressor(context.Background(), t.Name(), file, tmpDir, 1, 2, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	c.SetDictionary(patterns)
+	var words []string
+	for i := 100; i < 200; i++ {
+		words = append(words, fmt.Sprintf("%d longlongword %d", i, i), "word")
+	}
+	for _, w := range words {
+		require.NoError(t, c.AddWord([]byte(w)))
+	}
+	require.NoError(t, c.Compress())
+
+	d2, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d2.Close()
+	g := d2.MakeGetter()
+	for _, expect := range words {
+		require.True(t, g.HasNext())
+		w, _ := g.Next(nil)
+		require.Equal(t, expect, string(w))
+	}
+	require.False(t, g.HasNext())
+
+	used := d2.Patterns()
+	require.NotEmpty(t, used)
+	for _, p := range used {
+		require.Contains(t, patterns, p)
+	}
+}
+
+func TestCompressorCfg(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	cfg := DefaultCompressorCfg
+	cfg.MinPatternScore, cfg.MinPatternLen, cfg.MaxPatternLen, cfg.SamplingFactor, cfg.Workers = 1, 6, 8, 2, 2
+	c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	var words []string
+	for i := 0; i < 200; i++ {
+		words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+	}
+	for _, w := range words {
+		require.NoError(t, c.AddWord([]byte(w)))
+	}
+	require.NoError(t, c.Compress())
+
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+	patterns := d.Patterns()
+	require.NotEmpty(t, patterns)
+	for _, p := range patterns {
+		require.GreaterOrEqual(t, len(p), cfg.MinPatternLen)
+		require.LessOrEqual(t, len(p), cfg.MaxPatternLen)
+	}
+	g := d.MakeGetter()
+	for _, expect := range words {
+		w, _ := g.Next(nil)
+		require.Equal(t, expect, string(w))
+	}
+
+	cfg.SamplingFactor = 0
+	_, err = NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+	require.Error(t, err)
+}
+
+func TestCompressorMaxRAM(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	cfg := DefaultCompressorCfg
+	cfg.MinPatternScore, cfg.MaxRAM = 1, minMaxRAM
+	c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Less(t, c.superstringLimit, superstringLimit)
+	require.Less(t, cfg.collectorBufferSize(), etl.BufferOptimalSize/2)
+	var words []string
+	for i := 0; i < 30_000; i++ {
+		words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+	}
+	for _, w := range words {
+		require.NoError(t, c.AddWord([]byte(w)))
+	}
+	require.NoError(t, c.Compress())
+
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+	require.NotEmpty(t, d.Patterns())
+	g := d.MakeGetter()
+	for _, expect := range words {
+		w, _ := g.Next(nil)
+		require.Equal(t, expect, string(w))
+	}
+
+	cfg.MaxRAM = minMaxRAM - 1
+	_, err = NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+	require.Error(t, err)
+}
+
+func TestAppender(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	c, err := NewCompressor(context.Background(), t.Name(), file, tmpDir, 1, 2, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	var words []string
+	for i := 100; i < 200; i++ {
+		words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+	}
+	for _, w := range words {
+		require.NoError(t, c.AddWord([]byte(w)))
+	}
+	require.NoError(t, c.AddWord(nil))
+	require.NoError(t, c.AddUncompressedWord([]byte("key 1")))
+	require.NoError(t, c.Compress())
+	st, err := os.Stat(file)
+	require.NoError(t, err)
+
+	a, err := NewAppender(file)
+	require.NoError(t, err)
+	defer a.Close()
+	var appended []string
+	var appendedSize int
+	for i := len(words) - 1; i >= 0; i-- {
+		w := words[i]
+		appended = append(appended, w)
+		appendedSize += len(w)
+		require.NoError(t, a.AddWord([]byte(w)))
+	}
+	require.NoError(t, a.AddWord(nil))
+	require.NoError(t, a.AddUncompressedWord([]byte("key 2")))
+	require.ErrorIs(t, a.AddWord(make([]byte, 1000)), ErrNotEncodable)
+	require.Equal(t, 2*len(words)+4, a.Count())
+	require.NoError(t, a.Finish())
+
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+	require.Equal(t, 2*len(words)+4, d.Count())
+	require.Equal(t, 2, d.EmptyWordsCount())
+	require.Less(t, d.Size()-st.Size(), int64(appendedSize)) // patterns are used
+	g := d.MakeGetter()
+	for _, part := range [][]string{words, appended} {
+		for _, expect := range part {
+			w, _ := g.Next(nil)
+			require.Equal(t, expect, string(w))
+		}
+		w, _ := g.Next(nil)
+		require.Empty(t, w)
+		w, _ = g.NextUncompressed()
+		require.Contains(t, []string{"key 1", "key 2"}, string(w))
+	}
+	require.False(t, g.HasNext())
+
+	// not finished append is rolled back
+	a, err = NewAppender(file)
+	require.NoError(t, err)
+	require.NoError(t, a.AddWord([]byte(words[0])))
+	a.Close()
+	st2, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Equal(t, d.Size(), st2.Size())
+}
+
+func TestCompressProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	words := 2*progressStep + 10
+	compress := func(ctx context.Context, progress func(CompressionProgress)) error {
+		c, err := NewCompressor(ctx, t.Name(), file, tmpDir, 1, 2, log.LvlDebug)
+		require.NoError(t, err)
+		defer c.Close()
+		c.SetProgress(progress)
+		for i := 0; i < words; i++ {
+			if err = c.AddWord([]byte(fmt.Sprintf("word %d", i))); err != nil {
+				return err
+			}
+		}
+		return c.Compress()
+	}
+
+	var phases []CompressionPhase
+	var reports []CompressionProgress
+	require.NoError(t, compress(context.Background(), func(p CompressionProgress) {
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+		reports = append(reports, p)
+	}))
+	require.Equal(t, []CompressionPhase{PhaseSuperstrings, PhaseDictionary, PhaseReplacement, PhaseEncoding}, phases)
+	require.Contains(t, reports, CompressionProgress{Phase: PhaseReplacement, Processed: 2 * progressStep, Total: uint64(words)})
+	require.Contains(t, reports, CompressionProgress{Phase: PhaseEncoding, Processed: progressStep, Total: uint64(words)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := compress(ctx, func(p CompressionProgress) {
+		if p.Phase == PhaseReplacement && p.Processed > 0 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTuneMinPatternScore(t *testing.T) {
+	tmpDir := t.TempDir()
+	var sample [][]byte
+	for i := 0; i < 2000; i++ {
+		sample = append(sample, []byte(fmt.Sprintf("%d longlongword %d", i%100, i)))
+	}
+	scores := []uint64{1, 64, 1 << 40}
+	best, results, err := TuneMinPatternScore(context.Background(), t.Name(), tmpDir, sample, scores, DefaultCompressorCfg, log.LvlDebug)
+	require.NoError(t, err)
+	require.Len(t, results, len(scores))
+	for i, res := range results {
+		require.Equal(t, scores[i], res.MinPatternScore)
+	}
+	require.Zero(t, results[2].Patterns) // score is too high
+	require.Greater(t, results[0].Ratio, results[2].Ratio)
+	require.Contains(t, scores[:2], best)
+	files, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	_, _, err = TuneMinPatternScore(context.Background(), t.Name(), tmpDir, nil, scores, DefaultCompressorCfg, log.LvlDebug)
+	require.Error(t, err)
+}
+
+func TestExactDictionary(t *testing.T) {
+	tmpDir := t.TempDir()
+	build := func(file string, workers int, dict []byte, words []string) {
+		cfg := DefaultCompressorCfg
+		cfg.MinPatternScore, cfg.Workers = 1, workers
+		c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+		require.NoError(t, err)
+		defer c.Close()
+		if dict != nil {
+			require.NoError(t, c.SetExactDictionary(dict))
+		}
+		for _, w := range words {
+			require.NoError(t, c.AddWord([]byte(w)))
+		}
+		require.NoError(t, c.AddUncompressedWord([]byte("key")))
+		require.NoError(t, c.Compress())
+	}
+	var words, words2 []string
+	for i := 100; i < 200; i++ {
+		words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+		words2 = append(words2, fmt.Sprintf("%d longlongword %d", 299-i, 299-i))
+	}
+	words, words2 = append(words, ""), append(words2, "")
+
+	source := filepath.Join(tmpDir, "source")
+	build(source, 2, nil, words)
+	d, err := NewDecompressor(source)
+	require.NoError(t, err)
+	dict := d.ExportDictionary()
+	d.Close()
+
+	build(filepath.Join(tmpDir, "a"), 1, dict, words2)
+	build(filepath.Join(tmpDir, "b"), 4, dict, words2)
+	a, err := os.ReadFile(filepath.Join(tmpDir, "a"))
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(tmpDir, "b"))
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	d, err = NewDecompressor(filepath.Join(tmpDir, "a"))
+	require.NoError(t, err)
+	defer d.Close()
+	require.Equal(t, dict, d.ExportDictionary())
+	require.Equal(t, len(words2)+1, d.Count())
+	require.Equal(t, 1, d.EmptyWordsCount())
+	g := d.MakeGetter()
+	for _, expect := range words2 {
+		w, _ := g.Next(nil)
+		require.Equal(t, expect, string(w))
+	}
+	w, _ := g.NextUncompressed()
+	require.Equal(t, "key", string(w))
+
+	c, err := NewCompressor(context.Background(), t.Name(), filepath.Join(tmpDir, "c"), tmpDir, 1, 1, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Error(t, c.SetExactDictionary(dict[:len(dict)-1]))
+	require.NoError(t, c.SetExactDictionary(dict))
+	require.NoError(t, c.AddWord(make([]byte, 1000)))
+	require.ErrorIs(t, c.Compress(), ErrNotEncodable)
+}
+
+func TestCompressorCaps(t *testing.T) {
+	tmpDir := t.TempDir()
+	code := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	var words [][]byte
+	for i := 0; i < 100; i++ {
+		words = append(words, []byte(fmt.Sprintf("%d longlongword %d", i, i)), append([]byte{byte(i)}, code...))
+	}
+	patterns := func(cfg CompressorCfg) [][]byte {
+		file := filepath.Join(tmpDir, "compressed")
+		c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+		require.NoError(t, err)
+		defer c.Close()
+		for _, w := range words {
+			require.NoError(t, c.AddWord(w))
+		}
+		require.NoError(t, c.Compress())
+		d, err := NewDecompressor(file)
+		require.NoError(t, err)
+		defer d.Close()
+		g := d.MakeGetter()
+		for _, expect := range words {
+			w, _ := g.Next(nil)
+			require.Equal(t, expect, w)
+		}
+		return d.Patterns()
+	}
+	cfg := DefaultCompressorCfg
+	cfg.MinPatternScore = 1
+	hasCode := func(patterns [][]byte) bool {
+		for _, p := range patterns {
+			if bytes.Contains(code, p) && !bytes.Contains(p, []byte("word")) {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, hasCode(patterns(cfg)))
+
+	cfg.MaxSampledWordLen = 64 // code is not sampled, other words are
+	capped := patterns(cfg)
+	require.NotEmpty(t, capped)
+	require.False(t, hasCode(capped))
+
+	cfg.MaxSampledWordLen, cfg.MaxPatternRepeats = 0, 2
+	require.True(t, hasCode(patterns(cfg)))
+
+	cfg.MaxPatternRepeats = -1
+	_, err := NewCompressorWithCfg(context.Background(), t.Name(), filepath.Join(tmpDir, "compressed"), tmpDir, cfg, log.LvlDebug)
+	require.Error(t, err)
+}
+
+func TestFormatZstd(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	cfg := DefaultCompressorCfg
+	cfg.Format = FormatZstd
+	c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, c.AddWord(nil))
+		require.NoError(t, c.AddWord([]byte(fmt.Sprintf("%d longlongword %d", i, i))))
+		require.NoError(t, c.AddUncompressedWord([]byte(fmt.Sprintf("key %d", i))))
+	}
+	require.NoError(t, c.Compress())
+
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+	require.Equal(t, FormatZstd, d.Format())
+	require.Equal(t, 3000, d.Count())
+	require.Equal(t, 1000, d.EmptyWordsCount())
+	require.Nil(t, d.Patterns())
+
+	g := d.MakeGetter()
+	var offsets []uint64
+	for i := 0; i < 1000; i++ {
+		w, _ := g.Next(nil)
+		require.Empty(t, w)
+		offsets = append(offsets, g.dataP)
+		expect := fmt.Sprintf("%d longlongword %d", i, i)
+		require.True(t, g.MatchPrefix([]byte(fmt.Sprintf("%d long", i))))
+		require.False(t, g.MatchPrefix([]byte("x")))
+		ok, _ := g.Match([]byte("other"))
+		require.False(t, ok)
+		w, _ = g.Next(nil)
+		require.Equal(t, expect, string(w))
+		w, _ = g.NextUncompressed()
+		require.Equal(t, fmt.Sprintf("key %d", i), string(w))
+	}
+	require.False(t, g.HasNext())
+
+	g.Reset(offsets[500])
+	ok, _ := g.Match([]byte("500 longlongword 500"))
+	require.True(t, ok)
+	g.Skip() // uncompressed word
+	w, _ := g.Next(nil)
+	require.Empty(t, w)
+	ok, _ = g.Match([]byte("501 longlongword 501"))
+	require.True(t, ok)
+}
@@ -20,8 +20,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/dbg"
 	"github.com/ledgerwatch/erigon-lib/mmap"
 )
@@ -55,11 +59,25 @@ type Decompressor struct {
 	posDict        *posTable
 	wordsStart     uint64 // Offset of whether the superstrings actually start
 	size           int64
+	zstd           *zstd.Decoder // for FormatZstd files
+	checksums      *checksums    // nil if file was built without CompressorCfg.Checksums
+	wordIndex      *WordIndex    // nil if file was built without CompressorCfg.SkipListStep
+	getters        getterPool
 
 	wordsCount, emptyWordsCount uint64
 }
 
 func NewDecompressor(compressedFile string) (*Decompressor, error) {
+	return newDecompressor(compressedFile, true)
+}
+
+// NewDecompressorNoMmap - file is read to memory by pread instead of mmap: for platforms and filesystems where
+// mmap is unavailable or pathological (some network mounts). Takes memory of size of file, file is not kept open
+func NewDecompressorNoMmap(compressedFile string) (*Decompressor, error) {
+	return newDecompressor(compressedFile, false)
+}
+
+func newDecompressor(compressedFile string, useMmap bool) (*Decompressor, error) {
 	d := &Decompressor{
 		compressedFile: compressedFile,
 	}
@@ -83,12 +101,38 @@ func NewDecompressor(compressedFile string) (*Decompressor, error) {
 	if d.size < 32 {
 		return nil, fmt.Errorf("compressed file is too short: %d", d.size)
 	}
-	if d.mmapHandle1, d.mmapHandle2, err = mmap.Mmap(d.f, int(d.size)); err != nil {
+	if useMmap {
+		if d.mmapHandle1, d.mmapHandle2, err = mmap.Mmap(d.f, int(d.size)); err != nil {
+			return nil, err
+		}
+		d.data = d.mmapHandle1[:d.size]
+	} else if err = d.readFile(); err != nil {
 		return nil, err
 	}
 
 	// read patterns from file
-	d.data = d.mmapHandle1[:d.size]
+	if hasChecksums(d.data) {
+		if err = d.openChecksums(); err != nil {
+			return nil, err
+		}
+	}
+	if hasSkipList(d.data) {
+		if err = d.openSkipList(); err != nil {
+			return nil, err
+		}
+	}
+	if isZstd(d.data) {
+		if err = d.openZstd(); err != nil {
+			return nil, err
+		}
+		if err = d.validateChecksums(); err != nil {
+			return nil, err
+		}
+		if err = d.validateSkipList(); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
 	d.wordsCount = binary.BigEndian.Uint64(d.data[:8])
 	d.emptyWordsCount = binary.BigEndian.Uint64(d.data[8:16])
 	dictSize := binary.BigEndian.Uint64(d.data[16:24])
@@ -168,6 +212,12 @@ func NewDecompressor(compressedFile string) (*Decompressor, error) {
 		buildPosTable(posDepths, poss, d.posDict, 0, 0, 0, posMaxDepth)
 	}
 	d.wordsStart = pos + 8 + dictSize
+	if err = d.validateChecksums(); err != nil {
+		return nil, err
+	}
+	if err = d.validateSkipList(); err != nil {
+		return nil, err
+	}
 	return d, nil
 }
 
@@ -264,29 +314,121 @@ func buildPosTable(depths []uint64, poss []uint64, table *posTable, code uint16,
 	return b0 + buildPosTable(depths[b0:], poss[b0:], table, (uint16(1)<<bits)|code, bits+1, depth+1, maxDepth-1)
 }
 
+// Patterns - dictionary of file, for Compressor.SetDictionary. Patterns with shorter codes (more frequently used) go first
+func (d *Decompressor) Patterns() [][]byte {
+	if d.zstd != nil {
+		return nil
+	}
+	dictSize := binary.BigEndian.Uint64(d.data[16:24])
+	data := d.data[24 : 24+dictSize]
+	type depthPattern struct {
+		depth   uint64
+		pattern []byte
+	}
+	var dict []depthPattern
+	for i := uint64(0); i < dictSize; {
+		depth, ns := binary.Uvarint(data[i:])
+		i += uint64(ns)
+		l, n := binary.Uvarint(data[i:])
+		i += uint64(n)
+		dict = append(dict, depthPattern{depth: depth, pattern: common.Copy(data[i : i+l])})
+		i += l
+	}
+	sort.SliceStable(dict, func(i, j int) bool { return dict[i].depth < dict[j].depth })
+	patterns := make([][]byte, len(dict))
+	for i := range dict {
+		patterns[i] = dict[i].pattern
+	}
+	return patterns
+}
+
 func (d *Decompressor) Size() int64 {
 	return d.size
 }
 
+// Format - of file
+func (d *Decompressor) Format() Format {
+	if d.zstd != nil {
+		return FormatZstd
+	}
+	return FormatPatterns
+}
+
 func (d *Decompressor) Close() error {
+	if d.zstd != nil {
+		d.zstd.Close()
+	}
 	if err := mmap.Munmap(d.mmapHandle1, d.mmapHandle2); err != nil {
 		return err
 	}
+	if d.f == nil { // see NewDecompressorNoMmap
+		return nil
+	}
 	if err := d.f.Close(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// readFile - instead of mmap
+func (d *Decompressor) readFile() error {
+	d.data = make([]byte, d.size)
+	if _, err := io.ReadFull(io.NewSectionReader(d.f, 0, d.size), d.data); err != nil {
+		return fmt.Errorf("reading %s: %w", d.compressedFile, err)
+	}
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
+
 func (d *Decompressor) FilePath() string { return d.compressedFile }
 
 //WithReadAhead - Expect read in sequential order. (Hence, pages in the given range can be aggressively read ahead, and may be freed soon after they are accessed.)
 func (d *Decompressor) WithReadAhead(f func() error) error {
+	if d.mmapHandle1 == nil {
+		return f()
+	}
 	_ = mmap.MadviseSequential(d.mmapHandle1)
 	defer mmap.MadviseRandom(d.mmapHandle1)
 	return f()
 }
 
+// EnableReadAhead - expect sequential reads of file (until DisableReadAhead): pages are read ahead aggressively
+func (d *Decompressor) EnableReadAhead() *Decompressor {
+	if d.mmapHandle1 != nil {
+		_ = mmap.MadviseSequential(d.mmapHandle1)
+	}
+	return d
+}
+
+// EnableWillNeed - file is hot: kernel starts to read it to page cache in background (until DisableReadAhead)
+func (d *Decompressor) EnableWillNeed() *Decompressor {
+	if d.mmapHandle1 != nil {
+		_ = mmap.MadviseWillNeed(d.mmapHandle1)
+	}
+	return d
+}
+
+// DisableReadAhead - file is accessed randomly (default after open): for cold files, pages are not read ahead
+func (d *Decompressor) DisableReadAhead() {
+	if d.mmapHandle1 != nil {
+		_ = mmap.MadviseRandom(d.mmapHandle1)
+	}
+}
+
+// Touch - reads byte of each page of file: blocks until whole file is in page cache, to warm file on
+// background worker. File can be evicted from page cache later
+func (d *Decompressor) Touch() {
+	pageSize := os.Getpagesize()
+	var sum byte
+	for i := 0; i < len(d.mmapHandle1); i += pageSize {
+		sum += d.mmapHandle1[i]
+	}
+	touchSink = sum
+}
+
+var touchSink byte // result of Touch, to not let compiler remove reads
+
 // Getter represent "reader" or "interator" that can move accross the data of the decompressor
 // The full state of the getter can be captured by saving dataP, and dataBit
 type Getter struct {
@@ -297,6 +439,12 @@ type Getter struct {
 	posDict     *posTable
 	fName       string
 	trace       bool
+	zstd        *zstd.Decoder // not nil for FormatZstd file
+	zbuf        []byte        // buffer of Match for FormatZstd
+
+	checksums    *checksums
+	verify       bool   // see Verify
+	verifiedPage uint64 // last verified page + 1, 0 - none
 }
 
 func (g *Getter) Trace(t bool) { g.trace = t }
@@ -369,9 +517,12 @@ func (d *Decompressor) EmptyWordsCount() int { return int(d.emptyWordsCount) }
 // Getter is not thread-safe, but there can be multiple getters used simultaneously and concurrently
 // for the same decompressor
 func (d *Decompressor) MakeGetter() *Getter {
-	return &Getter{patternDict: d.dict, posDict: d.posDict, data: d.data[d.wordsStart:], fName: d.compressedFile}
+	return &Getter{patternDict: d.dict, posDict: d.posDict, data: d.data[d.wordsStart:], fName: d.compressedFile, zstd: d.zstd, checksums: d.checksums}
 }
 
+// Reset - moves getter to word at offset (as returned by Next, Skip, Match, ...): words are not
+// grouped into blocks, nothing is decoded. To move to word by its number - see SeekWord and
+// CompressorCfg.SkipListStep
 func (g *Getter) Reset(offset uint64) {
 	g.dataP = offset
 	g.dataBit = 0
@@ -385,6 +536,12 @@ func (g *Getter) HasNext() bool {
 // and appends it to the given buf, returning the result of appending
 // After extracting next word, it moves to the beginning of the next one
 func (g *Getter) Next(buf []byte) ([]byte, uint64) {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		return g.zstdNext(buf)
+	}
 	savePos := g.dataP
 	wordLen := g.nextPos(true)
 	wordLen-- // because when create huffman tree we do ++ , because 0 is terminator
@@ -440,6 +597,13 @@ func (g *Getter) Next(buf []byte) ([]byte, uint64) {
 }
 
 func (g *Getter) NextUncompressed() ([]byte, uint64) {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		payload, _ := g.zstdWord()
+		return payload, g.dataP
+	}
 	wordLen := g.nextPos(true)
 	wordLen-- // because when create huffman tree we do ++ , because 0 is terminator
 	if wordLen == 0 {
@@ -461,6 +625,13 @@ func (g *Getter) NextUncompressed() ([]byte, uint64) {
 
 // Skip moves offset to the next word and returns the new offset.
 func (g *Getter) Skip() uint64 {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		g.zstdWord()
+		return g.dataP
+	}
 	l := g.nextPos(true)
 	l-- // because when create huffman tree we do ++ , because 0 is terminator
 	if l == 0 {
@@ -498,6 +669,13 @@ func (g *Getter) Skip() uint64 {
 }
 
 func (g *Getter) SkipUncompressed() uint64 {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		g.zstdWord()
+		return g.dataP
+	}
 	wordLen := g.nextPos(true)
 	wordLen-- // because when create huffman tree we do ++ , because 0 is terminator
 	if wordLen == 0 {
@@ -519,6 +697,12 @@ func (g *Getter) SkipUncompressed() uint64 {
 // Match returns true and next offset if the word at current offset fully matches the buf
 // returns false and current offset otherwise.
 func (g *Getter) Match(buf []byte) (bool, uint64) {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		return g.zstdMatch(buf, false)
+	}
 	savePos := g.dataP
 	wordLen := g.nextPos(true)
 	wordLen-- // because when create huffman tree we do ++ , because 0 is terminator
@@ -584,6 +768,13 @@ func (g *Getter) Match(buf []byte) (bool, uint64) {
 
 // MatchPrefix only checks if the word at the current offset has a buf prefix. Does not move offset to the next word.
 func (g *Getter) MatchPrefix(prefix []byte) bool {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		match, _ := g.zstdMatch(prefix, true)
+		return match
+	}
 	savePos := g.dataP
 	defer func() {
 		g.dataP, g.dataBit = savePos, 0
@@ -663,3 +854,90 @@ func (g *Getter) MatchPrefix(prefix []byte) bool {
 	}
 	return true
 }
+
+// WordLen - length of current word, getter doesn't move: for size queries without decompression of word
+func (g *Getter) WordLen() int {
+	if g.zstd != nil {
+		return g.zstdWordLen()
+	}
+	savePos := g.dataP
+	wordLen := g.nextPos(true /* clean */)
+	g.dataP, g.dataBit = savePos, 0
+	return int(wordLen) - 1 // because when create huffman tree we do ++ , because 0 is terminator
+}
+
+// ReadFirstN - appends to buf first n bytes of word (whole word if it's shorter) and moves to next word.
+// Rest of word is not copied: for comparisons of keys in merges without decompression of large values
+func (g *Getter) ReadFirstN(buf []byte, n int) ([]byte, uint64) {
+	if g.verify {
+		defer g.verifyRead(g.dataP)
+	}
+	if g.zstd != nil {
+		g.zbuf, _ = g.zstdNext(g.zbuf[:0])
+		if n > len(g.zbuf) {
+			n = len(g.zbuf)
+		}
+		return append(buf, g.zbuf[:n]...), g.dataP
+	}
+	savePos := g.dataP
+	wordLen := g.nextPos(true)
+	wordLen-- // because when create huffman tree we do ++ , because 0 is terminator
+	if wordLen == 0 {
+		if g.dataBit > 0 {
+			g.dataP++
+			g.dataBit = 0
+		}
+		return buf, g.dataP
+	}
+	if n > int(wordLen) {
+		n = int(wordLen)
+	}
+	start := len(buf)
+	if len(buf)+n > cap(buf) {
+		newBuf := make([]byte, len(buf)+n)
+		copy(newBuf, buf)
+		buf = newBuf
+	} else {
+		buf = buf[:len(buf)+n]
+	}
+	prefix := buf[start:]
+	// Patterns which start in prefix
+	var bufPos int
+	for pos := g.nextPos(false /* clean */); pos != 0; pos = g.nextPos(false) {
+		bufPos += int(pos) - 1
+		pattern := g.nextPattern()
+		if bufPos < n {
+			copy(prefix[bufPos:], pattern)
+		}
+	}
+	if g.dataBit > 0 {
+		g.dataP++
+		g.dataBit = 0
+	}
+	postLoopPos := g.dataP
+	g.dataP, g.dataBit = savePos, 0
+	g.nextPos(true /* clean */) // Reset the state of huffman reader
+	// Uncovered parts in prefix, others are skipped
+	var lastUncovered int
+	bufPos = 0
+	for pos := g.nextPos(false); pos != 0; pos = g.nextPos(false) {
+		bufPos += int(pos) - 1
+		if bufPos > lastUncovered {
+			dif := uint64(bufPos - lastUncovered)
+			if lastUncovered < n {
+				copy(prefix[lastUncovered:], g.data[postLoopPos:postLoopPos+dif])
+			}
+			postLoopPos += dif
+		}
+		lastUncovered = bufPos + len(g.nextPattern())
+	}
+	if int(wordLen) > lastUncovered {
+		dif := wordLen - uint64(lastUncovered)
+		if lastUncovered < n {
+			copy(prefix[lastUncovered:], g.data[postLoopPos:postLoopPos+dif])
+		}
+		postLoopPos += dif
+	}
+	g.dataP, g.dataBit = postLoopPos, 0
+	return buf, postLoopPos
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ledgerwatch/log/v3"
@@ -229,3 +230,310 @@ func TestDecompressTorrent(t *testing.T) {
 		require.NotZero(t, sz)
 	}
 }
+
+func TestParallelGetter(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "compressed")
+	c, err := NewCompressor(context.Background(), t.Name(), file, tmpDir, 1, 2, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	for i := 0; i < 5000; i++ {
+		w := loremStrings[i%len(loremStrings)]
+		require.NoError(t, c.AddWord([]byte(fmt.Sprintf("%s %d", w, i))))
+		require.NoError(t, c.AddUncompressedWord([]byte(fmt.Sprintf("%d", i))))
+	}
+	require.NoError(t, c.Compress())
+	d, err := NewDecompressor(file)
+	require.NoError(t, err)
+	defer d.Close()
+
+	g := d.MakeGetter()
+	pg := d.MakeParallelGetter(3)
+	defer pg.Close()
+	n := 0
+	for g.HasNext() {
+		require.True(t, pg.HasNext())
+		expect, expectOffset := g.Next(nil)
+		w, offset := pg.Next(nil)
+		require.Equal(t, expect, w, n)
+		require.Equal(t, expectOffset, offset, n)
+		n++
+	}
+	require.Equal(t, d.Count(), n)
+	require.False(t, pg.HasNext())
+
+	// consumer stops early
+	pg = d.MakeParallelGetter(2)
+	w, _ := pg.Next(nil)
+	require.Equal(t, fmt.Sprintf("%s %d", loremStrings[0], 0), string(w))
+	pg.Close()
+	pg.Close()
+	require.False(t, pg.HasNext())
+}
+
+func TestWordIndex(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	for _, step := range []int{1, 3, 1000} {
+		idx := d.BuildWordIndex(step)
+		require.Equal(t, uint64(len(loremStrings)), idx.Count())
+		g := d.MakeGetter()
+		for _, i := range []int{len(loremStrings) - 1, 0, 5, 4, len(loremStrings) / 2} {
+			require.NoError(t, g.SeekWord(idx, uint64(i)))
+			w, _ := g.Next(nil)
+			require.Equal(t, fmt.Sprintf("%s %d", loremStrings[i], i), string(w))
+		}
+		require.Error(t, g.SeekWord(idx, idx.Count()))
+	}
+}
+
+func TestDecompressorStats(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	s := d.Stats()
+	require.Equal(t, FormatPatterns, s.Format)
+	require.Equal(t, d.Size(), s.FileSize)
+	require.Equal(t, len(loremStrings), s.Words)
+	require.Equal(t, len(d.Patterns()), s.Patterns)
+	require.NotZero(t, s.Positions)
+	var wordsSize uint64
+	for k, w := range loremStrings {
+		wordsSize += uint64(len(fmt.Sprintf("%s %d", w, k)))
+	}
+	require.Equal(t, wordsSize, s.WordsSize)
+	require.InDelta(t, float64(wordsSize)/float64(len(loremStrings)), s.AvgWordLen, 0.001)
+	require.InDelta(t, float64(wordsSize)/float64(d.Size()), float64(s.Ratio), 0.001)
+}
+
+func TestChecksums(t *testing.T) {
+	for _, format := range []Format{FormatPatterns, FormatZstd} {
+		tmpDir := t.TempDir()
+		file := filepath.Join(tmpDir, "compressed")
+		cfg := DefaultCompressorCfg
+		cfg.MinPatternScore, cfg.Format, cfg.Checksums = 1, format, true
+		c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+		require.NoError(t, err)
+		defer c.Close()
+		var words []string
+		for i := 0; i < 3000; i++ {
+			words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+			require.NoError(t, c.AddWord([]byte(words[i])))
+		}
+		require.NoError(t, c.Compress())
+
+		d, err := NewDecompressor(file)
+		require.NoError(t, err)
+		require.True(t, d.HasChecksums())
+		require.NoError(t, d.VerifyChecksums())
+		g := d.MakeGetter()
+		require.NoError(t, g.Verify(true))
+		for _, expect := range words {
+			w, _ := g.Next(nil)
+			require.Equal(t, expect, string(w))
+		}
+		require.False(t, g.HasNext())
+		corrupted := d.wordsStart + 2*checksumsPageSize + 10
+		require.NoError(t, d.Close())
+
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		data[corrupted] ^= 0xff
+		require.NoError(t, os.WriteFile(file, data, 0600))
+		d, err = NewDecompressor(file)
+		require.NoError(t, err)
+		require.ErrorIs(t, d.VerifyChecksums(), ErrChecksumMismatch)
+		g = d.MakeGetter()
+		require.NoError(t, g.Verify(true))
+		w, _ := g.Next(nil) // first page is not corrupted
+		require.Equal(t, words[0], string(w))
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				require.ErrorIs(t, err, ErrChecksumMismatch)
+			}()
+			for g.HasNext() {
+				g.Skip()
+			}
+		}()
+		d.Close()
+	}
+
+	d := prepareLoremDict(t)
+	defer d.Close()
+	require.False(t, d.HasChecksums())
+	require.NoError(t, d.VerifyChecksums())
+	require.Error(t, d.MakeGetter().Verify(true))
+}
+
+func TestSkipList(t *testing.T) {
+	for _, format := range []Format{FormatPatterns, FormatZstd} {
+		for _, checksums := range []bool{false, true} {
+			tmpDir := t.TempDir()
+			file := filepath.Join(tmpDir, "compressed")
+			cfg := DefaultCompressorCfg
+			cfg.MinPatternScore, cfg.Format, cfg.Checksums, cfg.SkipListStep = 1, format, checksums, 16
+			c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+			require.NoError(t, err)
+			defer c.Close()
+			var words []string
+			for i := 0; i < 1000; i++ {
+				words = append(words, fmt.Sprintf("%d longlongword %d", i, i))
+				require.NoError(t, c.AddWord([]byte(words[i])))
+			}
+			require.NoError(t, c.Compress())
+
+			d, err := NewDecompressor(file)
+			require.NoError(t, err)
+			require.Equal(t, checksums, d.HasChecksums())
+			require.NoError(t, d.VerifyChecksums())
+			idx := d.WordIndex()
+			require.NotNil(t, idx)
+			require.Equal(t, uint64(len(words)), idx.Count())
+			require.Equal(t, d.BuildWordIndex(16).offsets, idx.offsets)
+			g := d.MakeGetter()
+			for _, i := range []int{len(words) - 1, 0, 17, 16, 15, len(words) / 2} {
+				require.NoError(t, g.SeekWord(idx, uint64(i)))
+				w, _ := g.Next(nil)
+				require.Equal(t, words[i], string(w))
+			}
+			g.Reset(0)
+			for _, expect := range words {
+				w, _ := g.Next(nil)
+				require.Equal(t, expect, string(w))
+			}
+			require.False(t, g.HasNext())
+			d.Close()
+		}
+	}
+
+	d := prepareLoremDict(t)
+	defer d.Close()
+	require.Nil(t, d.WordIndex())
+}
+
+func TestDecompressorNoMmap(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	d2, err := NewDecompressorNoMmap(d.FilePath())
+	require.NoError(t, err)
+	require.Equal(t, d.Count(), d2.Count())
+	require.Equal(t, d.Size(), d2.Size())
+	g, g2 := d.MakeGetter(), d2.MakeGetter()
+	for i := 0; g.HasNext(); i++ {
+		require.True(t, g2.HasNext())
+		w, _ := g.Next(nil)
+		w2, _ := g2.Next(nil)
+		require.Equal(t, w, w2)
+		require.Equal(t, fmt.Sprintf("%s %d", loremStrings[i], i), string(w2))
+	}
+	require.False(t, g2.HasNext())
+	require.NoError(t, d2.WithReadAhead(func() error { return nil }))
+	require.NoError(t, d2.Close())
+}
+
+func TestDumpWords(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	offsets, err := d.WordOffsets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, offsets, d.Count())
+	g := d.MakeGetter()
+	for i := len(offsets) - 1; i >= 0; i-- {
+		g.Reset(offsets[i])
+		w, _ := g.Next(nil)
+		require.Equal(t, fmt.Sprintf("%s %d", loremStrings[i], i), string(w))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, d.DumpWords(context.Background(), &out))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, d.Count())
+	require.Equal(t, fmt.Sprintf("1\t%d\t%x", offsets[1], fmt.Sprintf("%s %d", loremStrings[1], 1)), lines[1])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, d.DumpWords(ctx, &out), context.Canceled)
+	_, err = d.WordOffsets(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWillNeed(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	d.EnableWillNeed().Touch()
+	d.EnableReadAhead().DisableReadAhead()
+	w, _ := d.MakeGetter().Next(nil)
+	require.Equal(t, fmt.Sprintf("%s %d", loremStrings[0], 0), string(w))
+
+	d2, err := NewDecompressorNoMmap(d.FilePath())
+	require.NoError(t, err)
+	defer d2.Close()
+	d2.EnableWillNeed().Touch()
+	d2.DisableReadAhead()
+}
+
+func TestReadFirstN(t *testing.T) {
+	for _, format := range []Format{FormatPatterns, FormatZstd} {
+		tmpDir := t.TempDir()
+		file := filepath.Join(tmpDir, "compressed")
+		cfg := DefaultCompressorCfg
+		cfg.MinPatternScore, cfg.Format = 1, format
+		c, err := NewCompressorWithCfg(context.Background(), t.Name(), file, tmpDir, cfg, log.LvlDebug)
+		require.NoError(t, err)
+		defer c.Close()
+		var words []string
+		for i := 0; i < 300; i++ {
+			words = append(words, fmt.Sprintf("%d longlongword %d %s", i, i, strings.Repeat("value", i%7)), "")
+		}
+		for _, w := range words {
+			require.NoError(t, c.AddWord([]byte(w)))
+		}
+		require.NoError(t, c.Compress())
+		d, err := NewDecompressor(file)
+		require.NoError(t, err)
+		defer d.Close()
+
+		for _, n := range []int{0, 1, 3, 8, 16, 1000} {
+			g := d.MakeGetter()
+			for _, w := range words {
+				require.Equal(t, len(w), g.WordLen())
+				expect := w
+				if n < len(w) {
+					expect = w[:n]
+				}
+				prefix, _ := g.ReadFirstN([]byte("buf"), n)
+				require.Equal(t, "buf"+expect, string(prefix))
+			}
+			require.False(t, g.HasNext())
+		}
+	}
+}
+
+func TestGetterPool(t *testing.T) {
+	d := prepareLoremDict(t)
+	defer d.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				g := d.GetGetter()
+				w, _ := g.Next(nil)
+				if string(w) != fmt.Sprintf("%s %d", loremStrings[0], 0) {
+					panic(string(w))
+				}
+				d.PutGetter(g)
+			}
+		}()
+	}
+	wg.Wait()
+	stats := d.GetterPoolStats()
+	require.Equal(t, int64(800), stats.Gets)
+	require.Zero(t, stats.InUse)
+	require.LessOrEqual(t, stats.Allocs, stats.Gets)
+
+	g := d.GetGetter()
+	require.Equal(t, int64(1), d.GetterPoolStats().InUse)
+	d.PutGetter(g)
+}
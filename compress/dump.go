@@ -0,0 +1,74 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// WordOffsets - offset of each word (for Getter.Reset), one pass of Skip over file. For inspection tooling:
+// to find word by offset from index or to validate offsets stored elsewhere
+func (d *Decompressor) WordOffsets(ctx context.Context) ([]uint64, error) {
+	offsets := make([]uint64, 0, d.wordsCount)
+	g := d.MakeGetter()
+	for g.HasNext() {
+		if len(offsets)%progressStep == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		offsets = append(offsets, g.dataP)
+		g.Skip()
+	}
+	if uint64(len(offsets)) != d.wordsCount {
+		return offsets, fmt.Errorf("%s: header has %d words, file has %d", d.compressedFile, d.wordsCount, len(offsets))
+	}
+	return offsets, nil
+}
+
+// DumpWords - writes all words of file to w, line per word: number of word, offset and word in hex, separated by tab.
+// Returns error if number of words doesn't match header of file
+func (d *Decompressor) DumpWords(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriterSize(w, etl.BufIOSize)
+	g := d.MakeGetter()
+	var buf []byte
+	var i uint64
+	for ; g.HasNext(); i++ {
+		if i%progressStep == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		offset := g.dataP
+		buf, _ = g.Next(buf[:0])
+		if _, err := fmt.Fprintf(bw, "%d\t%d\t%x\n", i, offset, buf); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if i != d.wordsCount {
+		return fmt.Errorf("%s: header has %d words, file has %d", d.compressedFile, d.wordsCount, i)
+	}
+	return nil
+}
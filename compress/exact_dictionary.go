@@ -0,0 +1,111 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// ExportDictionary - patterns and positions dictionaries as they are stored in file, for Compressor.SetExactDictionary.
+// Nil for FormatZstd
+func (d *Decompressor) ExportDictionary() []byte {
+	if d.zstd != nil {
+		return nil
+	}
+	return common.Copy(d.data[16:d.wordsStart])
+}
+
+// SetExactDictionary - words are encoded by given dictionaries (see Decompressor.ExportDictionary), which are
+// written to file as is: sampling of patterns, reducing of dictionary and building of huffman codes are skipped.
+// Files built from same words with same dictionary are byte-identical, independently of settings of Compressor:
+// they can be verified by hash across nodes. Compress fails with ErrNotEncodable if length of word is not in
+// positions dictionary. Must be called before first AddWord
+func (c *Compressor) SetExactDictionary(dict []byte) error {
+	if c.cfg.Format != FormatPatterns {
+		return fmt.Errorf("exact dictionary is supported only for FormatPatterns")
+	}
+	if _, err := newWordEncoder(dict); err != nil {
+		return err
+	}
+	c.exactDictionary = common.Copy(dict)
+	return nil
+}
+
+func (c *Compressor) compressExact() error {
+	enc, err := newWordEncoder(c.exactDictionary)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(c.tmpOutFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, etl.BufIOSize)
+	var header [16]byte // words counts are written when known
+	if _, err = w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err = w.Write(c.exactDictionary); err != nil {
+		return err
+	}
+	enc.setWriter(w)
+	var wc, emptyWords uint64
+	reportProgress(c.progress, PhaseEncoding, 0, c.wordsCount)
+	if err = c.uncompressedFile.ForEach(func(v []byte, compressed bool) error {
+		if wc%progressStep == 0 && wc > 0 {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+			reportProgress(c.progress, PhaseEncoding, wc, c.wordsCount)
+		}
+		var err error
+		if compressed {
+			err = enc.encodeWord(v)
+		} else {
+			err = enc.encodeUncompressedWord(v)
+		}
+		if err != nil {
+			return fmt.Errorf("word %d: %w", wc, err)
+		}
+		wc++
+		if len(v) == 0 {
+			emptyWords++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(header[:8], wc)
+	binary.BigEndian.PutUint64(header[8:], emptyWords)
+	if _, err = f.WriteAt(header[:], 0); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
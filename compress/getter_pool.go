@@ -0,0 +1,58 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// getterPool - reusable getters of Decompressor: for servers with many goroutines, which would allocate getter per read
+type getterPool struct {
+	pool                sync.Pool
+	gets, allocs, inUse atomic.Int64
+}
+
+// GetterPoolStats - Gets - calls of GetGetter, Allocs - how many of them allocated new getter, InUse - not returned by PutGetter
+type GetterPoolStats struct {
+	Gets, Allocs, InUse int64
+}
+
+// GetGetter - getter from pool of d (new one if pool is empty), positioned at first word. Safe for concurrent use.
+// Getter must be returned by PutGetter when caller is done with it
+func (d *Decompressor) GetGetter() *Getter {
+	d.getters.gets.Inc()
+	d.getters.inUse.Inc()
+	if g, ok := d.getters.pool.Get().(*Getter); ok {
+		return g
+	}
+	d.getters.allocs.Inc()
+	return d.MakeGetter()
+}
+
+// PutGetter - returns getter of d to pool, getter must not be used after it
+func (d *Decompressor) PutGetter(g *Getter) {
+	g.Reset(0)
+	g.trace, g.verify, g.verifiedPage = false, false, 0
+	d.getters.inUse.Dec()
+	d.getters.pool.Put(g)
+}
+
+func (d *Decompressor) GetterPoolStats() GetterPoolStats {
+	return GetterPoolStats{Gets: d.getters.gets.Load(), Allocs: d.getters.allocs.Load(), InUse: d.getters.inUse.Load()}
+}
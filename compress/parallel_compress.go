@@ -239,7 +239,7 @@ func (cq *CompressionQueue) Pop() interface{} {
 }
 
 // reduceDict reduces the dictionary by trying the substitutions and counting frequency for each word
-func reducedict(ctx context.Context, trace bool, logPrefix, segmentFilePath string, datFile *DecompressedFile, workers int, dictBuilder *DictionaryBuilder, lvl log.Lvl) error {
+func reducedict(ctx context.Context, trace bool, logPrefix, segmentFilePath string, datFile *DecompressedFile, workers int, dictBuilder *DictionaryBuilder, progress func(CompressionProgress), lvl log.Lvl) error {
 	logEvery := time.NewTicker(20 * time.Second)
 	defer logEvery.Stop()
 
@@ -305,12 +305,16 @@ func reducedict(ctx context.Context, trace bool, logPrefix, segmentFilePath stri
 
 	var inCount, outCount, emptyWordsCount uint64 // Counters words sent to compression and returned for compression
 	var numBuf [binary.MaxVarintLen64]byte
+	reportProgress(progress, PhaseReplacement, 0, uint64(datFile.count))
 	if err = datFile.ForEach(func(v []byte, compression bool) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		if inCount%progressStep == 0 && inCount > 0 {
+			reportProgress(progress, PhaseReplacement, inCount, uint64(datFile.count))
+		}
 		if workers > 1 {
 			// take processed words in non-blocking way and push them to the queue
 		outer:
@@ -641,7 +645,14 @@ func reducedict(ctx context.Context, trace bool, logPrefix, segmentFilePath stri
 	r := bufio.NewReaderSize(intermediateFile, etl.BufIOSize)
 	var l uint64
 	var e error
+	reportProgress(progress, PhaseEncoding, 0, inCount)
 	for l, e = binary.ReadUvarint(r); e == nil; l, e = binary.ReadUvarint(r) {
+		if wc%progressStep == 0 && wc > 0 {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			reportProgress(progress, PhaseEncoding, uint64(wc), inCount)
+		}
 		posCode := pos2code[l+1]
 		if posCode != nil {
 			if e = hc.encode(posCode.code, posCode.codeBits); e != nil {
@@ -730,12 +741,16 @@ func reducedict(ctx context.Context, trace bool, logPrefix, segmentFilePath stri
 // into the collector, using lock to mutual exclusion. At the end (when the input channel is closed),
 // it notifies the waitgroup before exiting, so that the caller known when all work is done
 // No error channels for now
-func processSuperstring(superstringCh chan []byte, dictCollector *etl.Collector, minPatternScore uint64, completion *sync.WaitGroup) {
+func processSuperstring(ctx context.Context, superstringCh chan []byte, dictCollector *etl.Collector, cfg CompressorCfg, completion *sync.WaitGroup) {
 	defer completion.Done()
+	minPatternScore, minPatternLen, maxPatternLen, maxRepeats := cfg.MinPatternScore, cfg.MinPatternLen, cfg.MaxPatternLen, cfg.MaxPatternRepeats
 	dictVal := make([]byte, 8)
 	dictKey := make([]byte, maxPatternLen)
 	var lcp, sa, inv []int32
 	for superstring := range superstringCh {
+		if ctx.Err() != nil { // drain channel: Compress returns error of ctx
+			continue
+		}
 		if cap(sa) < len(superstring) {
 			sa = make([]int32, len(superstring))
 		} else {
@@ -857,16 +872,23 @@ func processSuperstring(superstringCh chan []byte, dictCollector *etl.Collector,
 				}
 
 				window := i - j + 2
-				copy(b, filtered[j:i+2])
-				slices.Sort(b[:window])
+				examined := window
+				if maxRepeats > 0 && examined > maxRepeats {
+					examined = maxRepeats
+				}
+				copy(b, filtered[j:j+examined])
+				slices.Sort(b[:examined])
 				repeats := 1
 				lastK := 0
-				for k := 1; k < window; k++ {
+				for k := 1; k < examined; k++ {
 					if b[k] >= b[lastK]+int32(l) {
 						repeats++
 						lastK = k
 					}
 				}
+				if examined < window { // extrapolation, see CompressorCfg.MaxPatternRepeats
+					repeats = repeats * window / examined
+				}
 
 				if (l < 8 || l > 64) && repeats < int(minPatternScore) {
 					prevSkipped = true
@@ -895,7 +917,11 @@ func processSuperstring(superstringCh chan []byte, dictCollector *etl.Collector,
 }
 
 func DictionaryBuilderFromCollectors(ctx context.Context, logPrefix, tmpDir string, collectors []*etl.Collector) (*DictionaryBuilder, error) {
-	dictCollector := etl.NewCollector(logPrefix, tmpDir, etl.NewSortableBuffer(etl.BufferOptimalSize/2))
+	return dictionaryBuilderFromCollectors(ctx, logPrefix, tmpDir, collectors, DefaultCompressorCfg)
+}
+
+func dictionaryBuilderFromCollectors(ctx context.Context, logPrefix, tmpDir string, collectors []*etl.Collector, cfg CompressorCfg) (*DictionaryBuilder, error) {
+	dictCollector := etl.NewCollector(logPrefix, tmpDir, etl.NewSortableBuffer(cfg.collectorBufferSize()))
 	defer dictCollector.Close()
 	dictAggregator := &DictAggregator{collector: dictCollector, dist: map[int]int{}}
 	for _, collector := range collectors {
@@ -907,7 +933,7 @@ func DictionaryBuilderFromCollectors(ctx context.Context, logPrefix, tmpDir stri
 	if err := dictAggregator.finish(); err != nil {
 		return nil, err
 	}
-	db := &DictionaryBuilder{limit: maxDictPatterns} // Only collect 1m words with highest scores
+	db := &DictionaryBuilder{limit: cfg.MaxDictPatterns} // Only collect words with highest scores
 	if err := dictCollector.Load(nil, "", db.loadFunc, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
 		return nil, err
 	}
@@ -917,6 +943,20 @@ func DictionaryBuilderFromCollectors(ctx context.Context, logPrefix, tmpDir stri
 	return db, nil
 }
 
+// DictionaryBuilderFromPatterns - dictionary of given patterns, first pattern has highest score.
+// Patterns with length out of range of cfg are skipped - they can't be produced by sampling
+func DictionaryBuilderFromPatterns(patterns [][]byte, cfg CompressorCfg) *DictionaryBuilder {
+	db := &DictionaryBuilder{limit: cfg.MaxDictPatterns}
+	for i, p := range patterns {
+		if len(p) < cfg.MinPatternLen || len(p) > cfg.MaxPatternLen {
+			continue
+		}
+		db.processWord(p, uint64(len(patterns)-i))
+	}
+	sort.Sort(db)
+	return db
+}
+
 func PersistDictrionary(fileName string, db *DictionaryBuilder) error {
 	df, err := os.Create(fileName)
 	if err != nil {
@@ -0,0 +1,133 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"sync"
+)
+
+// ParallelGetter - reads words of file in order, like Getter.Next, but decompresses them ahead of consumer by
+// pool of workers: for merge and building of indices which are bound by decompression.
+// Producer goroutine finds borders of words by Skip (which doesn't copy data), workers decompress batches of words.
+// Not thread-safe. Close must be called if consumer stops before end of file
+type ParallelGetter struct {
+	batches chan *wordsJob // in order of file, bounded: limits decompressed words waiting for consumer
+	quit    chan struct{}
+	wg      sync.WaitGroup
+	cur     *wordsJob
+	i       int
+	closed  bool
+}
+
+type wordsJob struct {
+	offset  uint64 // of first word
+	count   int
+	words   [][]byte
+	offsets []uint64 // offset of next word after each word
+	done    chan struct{}
+}
+
+const parallelGetterBatch = 256
+
+// MakeParallelGetter - workers decompress words concurrently, at most 2*workers batches are read ahead
+func (d *Decompressor) MakeParallelGetter(workers int) *ParallelGetter {
+	if workers < 1 {
+		workers = 1
+	}
+	pg := &ParallelGetter{
+		batches: make(chan *wordsJob, 2*workers),
+		quit:    make(chan struct{}),
+	}
+	jobs := make(chan *wordsJob, 2*workers)
+	pg.wg.Add(1 + workers)
+	go func() {
+		defer pg.wg.Done()
+		defer close(jobs)
+		defer close(pg.batches)
+		g := d.MakeGetter()
+		for g.HasNext() {
+			job := &wordsJob{offset: g.dataP, done: make(chan struct{})}
+			for ; job.count < parallelGetterBatch && g.HasNext(); job.count++ {
+				g.Skip()
+			}
+			select {
+			case jobs <- job:
+			case <-pg.quit:
+				return
+			}
+			select {
+			case pg.batches <- job:
+			case <-pg.quit:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer pg.wg.Done()
+			g := d.MakeGetter()
+			for job := range jobs {
+				g.Reset(job.offset)
+				job.words, job.offsets = make([][]byte, job.count), make([]uint64, job.count)
+				for i := 0; i < job.count; i++ {
+					job.words[i], job.offsets[i] = g.Next(nil)
+				}
+				close(job.done)
+			}
+		}()
+	}
+	return pg
+}
+
+func (pg *ParallelGetter) HasNext() bool {
+	if pg.cur != nil && pg.i < pg.cur.count {
+		return true
+	}
+	if pg.closed {
+		return false
+	}
+	job, ok := <-pg.batches
+	if !ok {
+		pg.cur = nil
+		return false
+	}
+	<-job.done
+	pg.cur, pg.i = job, 0
+	return true
+}
+
+// Next - appends next word to buf, returns it and offset of next word
+func (pg *ParallelGetter) Next(buf []byte) ([]byte, uint64) {
+	if !pg.HasNext() {
+		return buf, 0
+	}
+	w, offset := pg.cur.words[pg.i], pg.cur.offsets[pg.i]
+	pg.cur.words[pg.i] = nil
+	pg.i++
+	return append(buf, w...), offset
+}
+
+// Close - stops workers, can be called several times
+func (pg *ParallelGetter) Close() {
+	if pg.closed {
+		return
+	}
+	pg.closed = true
+	pg.cur = nil
+	close(pg.quit)
+	pg.wg.Wait()
+}
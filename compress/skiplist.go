@@ -0,0 +1,91 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Skip list is written after words (before checksums): offsets of every step-th word (8 bytes per offset), step,
+// count of words, start of skip list (offset in file) and magic. Readers which don't know about skip list can't read such files
+var skipListMagic = [8]byte{0xff, 's', 'k', 'i', 'p', 'l', 's', 't'}
+
+const skipListTrailerSize = 8 + 8 + 8 + 8 // step, count of words, start of skip list, magic
+
+// writeSkipList - appends word index of ready file
+func writeSkipList(filePath string, step int) error {
+	d, err := NewDecompressor(filePath)
+	if err != nil {
+		return err
+	}
+	idx := d.BuildWordIndex(step)
+	trailer := make([]byte, 8*len(idx.offsets)+skipListTrailerSize)
+	for i, offset := range idx.offsets {
+		binary.BigEndian.PutUint64(trailer[8*i:], offset)
+	}
+	n := 8 * len(idx.offsets)
+	binary.BigEndian.PutUint64(trailer[n:], idx.step)
+	binary.BigEndian.PutUint64(trailer[n+8:], idx.count)
+	binary.BigEndian.PutUint64(trailer[n+16:], uint64(d.size))
+	copy(trailer[n+24:], skipListMagic[:])
+	if err = d.Close(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(trailer); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func hasSkipList(data []byte) bool { return bytes.HasSuffix(data, skipListMagic[:]) }
+
+// openSkipList - cuts skip list off d.data
+func (d *Decompressor) openSkipList() error {
+	trailer := d.data[len(d.data)-skipListTrailerSize:]
+	step, count, start := binary.BigEndian.Uint64(trailer[:8]), binary.BigEndian.Uint64(trailer[8:16]), binary.BigEndian.Uint64(trailer[16:24])
+	if step == 0 || start > uint64(len(d.data)-skipListTrailerSize) || (uint64(len(d.data)-skipListTrailerSize)-start)/8 != (count+step-1)/step {
+		return fmt.Errorf("invalid skip list: step %d, words %d, start %d, file size %d", step, count, start, d.size)
+	}
+	offsets := d.data[start : len(d.data)-skipListTrailerSize]
+	d.wordIndex = &WordIndex{step: step, count: count, offsets: make([]uint64, len(offsets)/8)}
+	for i := range d.wordIndex.offsets {
+		d.wordIndex.offsets[i] = binary.BigEndian.Uint64(offsets[8*i:])
+	}
+	d.data = d.data[:start]
+	return nil
+}
+
+func (d *Decompressor) validateSkipList() error {
+	if d.wordIndex == nil || len(d.wordIndex.offsets) == 0 {
+		return nil
+	}
+	if words := uint64(len(d.data)) - d.wordsStart; d.wordIndex.offsets[len(d.wordIndex.offsets)-1] >= words {
+		return fmt.Errorf("invalid skip list: offset %d is out of words, size of words %d", d.wordIndex.offsets[len(d.wordIndex.offsets)-1], words)
+	}
+	return nil
+}
+
+// WordIndex - skip list stored in file (see CompressorCfg.SkipListStep), nil if file was built without it
+func (d *Decompressor) WordIndex() *WordIndex { return d.wordIndex }
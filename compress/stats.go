@@ -0,0 +1,84 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DecompressorStats - summary of compressed file, to find files which compress poorly and need other CompressorCfg
+type DecompressorStats struct {
+	Format     Format
+	FileSize   int64
+	Words      int
+	EmptyWords int
+	DictSize   uint64 // size of patterns dictionary in file, for FormatZstd - size of zstd dictionary
+	Patterns   int    // 0 for FormatZstd
+	Positions  int    // 0 for FormatZstd
+	WordsSize  uint64 // total length of uncompressed words
+	AvgWordLen float64
+	Ratio      CompressionRatio // WordsSize / FileSize
+}
+
+func (s DecompressorStats) String() string {
+	return fmt.Sprintf("format=%d, size=%d, words=%d, empty=%d, dict=%d, patterns=%d, positions=%d, avg_word=%.1f, ratio=%s",
+		s.Format, s.FileSize, s.Words, s.EmptyWords, s.DictSize, s.Patterns, s.Positions, s.AvgWordLen, s.Ratio)
+}
+
+// Stats - reads dictionaries and decompresses all words of file (to know uncompressed size): it's slow, not for hot path
+func (d *Decompressor) Stats() DecompressorStats {
+	s := DecompressorStats{Format: d.Format(), FileSize: d.size, Words: d.Count(), EmptyWords: d.EmptyWordsCount()}
+	if d.zstd != nil {
+		s.DictSize = binary.BigEndian.Uint64(d.data[24:32])
+	} else {
+		s.DictSize = binary.BigEndian.Uint64(d.data[16:24])
+		s.Patterns = countDictEntries(d.data[24:24+s.DictSize], true)
+		pos := 24 + s.DictSize
+		posDictSize := binary.BigEndian.Uint64(d.data[pos : pos+8])
+		s.Positions = countDictEntries(d.data[pos+8:pos+8+posDictSize], false)
+	}
+
+	g := d.MakeGetter()
+	var buf []byte
+	for g.HasNext() {
+		buf, _ = g.Next(buf[:0])
+		s.WordsSize += uint64(len(buf))
+	}
+	if s.Words > 0 {
+		s.AvgWordLen = float64(s.WordsSize) / float64(s.Words)
+	}
+	if s.FileSize > 0 {
+		s.Ratio = CompressionRatio(float64(s.WordsSize) / float64(s.FileSize))
+	}
+	return s
+}
+
+// countDictEntries - entries of dictionary are (depth, pattern) or (depth, position) pairs of uvarints,
+// pattern is followed by its bytes
+func countDictEntries(data []byte, withBytes bool) (n int) {
+	for i := uint64(0); i < uint64(len(data)); n++ {
+		_, ns := binary.Uvarint(data[i:])
+		i += uint64(ns)
+		l, ns := binary.Uvarint(data[i:])
+		i += uint64(ns)
+		if withBytes {
+			i += l
+		}
+	}
+	return n
+}
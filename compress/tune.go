@@ -0,0 +1,108 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+// TuneResult - compression of sample with MinPatternScore
+type TuneResult struct {
+	MinPatternScore uint64
+	Ratio           CompressionRatio
+	Patterns        int
+	CompressTime    time.Duration
+	DecompressTime  time.Duration // of all words of sample
+}
+
+// DefaultTuneScores - candidates of TuneMinPatternScore, around default MinPatternScore
+var DefaultTuneScores = []uint64{64, 256, 1024, 4096, 16384}
+
+// tuneRatioTolerance - higher score is preferred if its ratio is worse than the best one by less than tolerance:
+// it gives smaller dictionary, compression and decompression are faster
+const tuneRatioTolerance = 0.02
+
+// TuneMinPatternScore - compresses sample of words with each of scores (DefaultTuneScores if nil) and other settings
+// of cfg, picks highest score which has ratio close to the best one. For new domains with unknown shape of data:
+// sample must be small (compressed len(scores) times) and representative (words sampled across whole data)
+func TuneMinPatternScore(ctx context.Context, logPrefix, tmpDir string, sample [][]byte, scores []uint64, cfg CompressorCfg, lvl log.Lvl) (best uint64, results []TuneResult, err error) {
+	if len(sample) == 0 {
+		return 0, nil, fmt.Errorf("empty sample")
+	}
+	if scores == nil {
+		scores = DefaultTuneScores
+	}
+	cfg.Format = FormatPatterns
+	for i, score := range scores {
+		cfg.MinPatternScore = score
+		res, err := tuneScore(ctx, logPrefix, filepath.Join(tmpDir, fmt.Sprintf("tune-%d.seg", i)), tmpDir, sample, cfg, lvl)
+		if err != nil {
+			return 0, nil, fmt.Errorf("score %d: %w", score, err)
+		}
+		results = append(results, res)
+	}
+
+	var maxRatio CompressionRatio
+	for _, res := range results {
+		if res.Ratio > maxRatio {
+			maxRatio = res.Ratio
+		}
+	}
+	for _, res := range results {
+		if float64(res.Ratio) >= float64(maxRatio)*(1-tuneRatioTolerance) && res.MinPatternScore >= best {
+			best = res.MinPatternScore
+		}
+	}
+	return best, results, nil
+}
+
+func tuneScore(ctx context.Context, logPrefix, file, tmpDir string, sample [][]byte, cfg CompressorCfg, lvl log.Lvl) (TuneResult, error) {
+	res := TuneResult{MinPatternScore: cfg.MinPatternScore}
+	defer os.Remove(file)
+	start := time.Now()
+	c, err := NewCompressorWithCfg(ctx, logPrefix, file, tmpDir, cfg, lvl)
+	if err != nil {
+		return res, err
+	}
+	defer c.Close()
+	for _, w := range sample {
+		if err = c.AddWord(w); err != nil {
+			return res, err
+		}
+	}
+	if err = c.Compress(); err != nil {
+		return res, err
+	}
+	res.CompressTime = time.Since(start)
+
+	d, err := NewDecompressor(file)
+	if err != nil {
+		return res, err
+	}
+	defer d.Close()
+	start = time.Now()
+	stats := d.Stats()
+	res.DecompressTime = time.Since(start)
+	res.Ratio, res.Patterns = stats.Ratio, stats.Patterns
+	return res, nil
+}
@@ -0,0 +1,206 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/patricia"
+)
+
+// ErrNotEncodable - word can't be encoded by existing dictionaries: its length+1 is not in positions dictionary
+var ErrNotEncodable = errors.New("word can't be encoded by dictionaries of file")
+
+// wordEncoder - encodes words by patterns and positions dictionaries of existing file: without building of new
+// dictionaries, for Appender and Compressor.SetExactDictionary
+type wordEncoder struct {
+	w  *bufio.Writer
+	hc HuffmanCoder
+
+	code2pattern []*Pattern // Pattern.code is index in code2pattern, as in reducedict
+	patternCodes []uint64   // huffman codes of patterns, length of code is Pattern.depth
+	pos2code     map[uint64]*Position
+	mf2          *patricia.MatchFinder2
+
+	// buffers of optimiseCluster
+	output    []byte
+	uncovered []int
+	patterns  []int
+	cellRing  *Ring
+	posMap    map[uint64]uint64
+	matches   []uint64 // pairs (position, code) found by optimiseCluster
+}
+
+// newWordEncoder - dict is sections of file after words counts: size of patterns dictionary, patterns dictionary,
+// size of positions dictionary, positions dictionary (see Decompressor.ExportDictionary)
+func newWordEncoder(dict []byte) (*wordEncoder, error) {
+	e := &wordEncoder{cellRing: NewRing(), posMap: map[uint64]uint64{}, pos2code: map[uint64]*Position{}}
+	patterns, positions, err := splitDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+	var pt patricia.PatriciaTree
+	var depths []uint64
+	for i := 0; i < len(patterns); {
+		depth, ns := binary.Uvarint(patterns[i:])
+		l, n := binary.Uvarint(patterns[i+ns:])
+		if ns <= 0 || n <= 0 || uint64(len(patterns)-i-ns-n) < l {
+			return nil, fmt.Errorf("invalid patterns dictionary")
+		}
+		i += ns + n
+		p := &Pattern{code: uint64(len(e.code2pattern)), score: 64 - depth, word: patterns[i : i+int(l)], depth: int(depth)}
+		pt.Insert(p.word, p)
+		e.code2pattern = append(e.code2pattern, p)
+		depths = append(depths, depth)
+		i += int(l)
+	}
+	e.patternCodes = make([]uint64, len(depths))
+	huffmanCodes(depths, e.patternCodes, 0, 0)
+	e.mf2 = patricia.NewMatchFinder2(&pt)
+
+	var poss []*Position
+	depths = depths[:0]
+	for i := 0; i < len(positions); {
+		depth, ns := binary.Uvarint(positions[i:])
+		if ns <= 0 {
+			return nil, fmt.Errorf("invalid positions dictionary")
+		}
+		pos, n := binary.Uvarint(positions[i+ns:])
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid positions dictionary")
+		}
+		i += ns + n
+		p := &Position{pos: pos, codeBits: int(depth), depth: int(depth)}
+		poss = append(poss, p)
+		e.pos2code[pos] = p
+		depths = append(depths, depth)
+	}
+	codes := make([]uint64, len(depths))
+	huffmanCodes(depths, codes, 0, 0)
+	for i, p := range poss {
+		p.code = codes[i]
+	}
+	return e, nil
+}
+
+// splitDictionary - patterns and positions dictionaries
+func splitDictionary(dict []byte) (patterns, positions []byte, err error) {
+	if len(dict) < 16 {
+		return nil, nil, fmt.Errorf("dictionary is too short: %d", len(dict))
+	}
+	size := binary.BigEndian.Uint64(dict)
+	if size > uint64(len(dict)-16) {
+		return nil, nil, fmt.Errorf("invalid size of patterns dictionary: %d", size)
+	}
+	patterns, dict = dict[8:8+size], dict[8+size:]
+	if size = binary.BigEndian.Uint64(dict); size != uint64(len(dict)-8) {
+		return nil, nil, fmt.Errorf("invalid size of positions dictionary: %d", size)
+	}
+	return patterns, dict[8:], nil
+}
+
+// huffmanCodes - codes of entries of dictionary sorted by depth, assigned same way as tables of Decompressor are built
+func huffmanCodes(depths []uint64, codes []uint64, code uint64, depth uint64) int {
+	if len(depths) == 0 {
+		return 0
+	}
+	if depth == depths[0] {
+		codes[0] = code
+		return 1
+	}
+	b0 := huffmanCodes(depths, codes, code, depth+1)
+	return b0 + huffmanCodes(depths[b0:], codes[b0:], code|uint64(1)<<depth, depth+1)
+}
+
+// encodeWord - word is compressed by patterns. Patterns are not used if their positions are not in positions dictionary
+func (e *wordEncoder) encodeWord(word []byte) error {
+	if len(word) == 0 {
+		return e.encodeUncompressedWord(word)
+	}
+	if e.pos2code[uint64(len(word))+1] == nil || e.pos2code[0] == nil {
+		return fmt.Errorf("%w: length %d", ErrNotEncodable, len(word))
+	}
+	e.output, e.patterns, e.uncovered = optimiseCluster(false, word, e.mf2, e.output[:0], e.uncovered, e.patterns, e.cellRing, e.posMap)
+	pNum, n := binary.Uvarint(e.output)
+	data := e.output[n:]
+	e.matches = e.matches[:0]
+	var lastPos uint64
+	for i := uint64(0); i < pNum; i++ {
+		pos, ns := binary.Uvarint(data)
+		data = data[ns:]
+		code, nc := binary.Uvarint(data)
+		data = data[nc:]
+		if e.pos2code[pos-lastPos+1] == nil {
+			return e.encodeUncompressedWord(word)
+		}
+		lastPos = pos
+		e.matches = append(e.matches, pos, code)
+	}
+	lenCode := e.pos2code[uint64(len(word))+1]
+	if err := e.hc.encode(lenCode.code, lenCode.codeBits); err != nil {
+		return err
+	}
+	lastPos = 0
+	for i := 0; i < len(e.matches); i += 2 {
+		pos, code := e.matches[i], e.matches[i+1]
+		posCode := e.pos2code[pos-lastPos+1]
+		lastPos = pos
+		if err := e.hc.encode(posCode.code, posCode.codeBits); err != nil {
+			return err
+		}
+		if err := e.hc.encode(e.patternCodes[code], e.code2pattern[code].depth); err != nil {
+			return err
+		}
+	}
+	if err := e.hc.encode(e.pos2code[0].code, e.pos2code[0].codeBits); err != nil {
+		return err
+	}
+	if err := e.hc.flush(); err != nil {
+		return err
+	}
+	_, err := e.w.Write(data) // uncovered characters
+	return err
+}
+
+func (e *wordEncoder) encodeUncompressedWord(word []byte) error {
+	lenCode := e.pos2code[uint64(len(word))+1]
+	if lenCode == nil || (len(word) > 0 && e.pos2code[0] == nil) {
+		return fmt.Errorf("%w: length %d", ErrNotEncodable, len(word))
+	}
+	if err := e.hc.encode(lenCode.code, lenCode.codeBits); err != nil {
+		return err
+	}
+	if len(word) == 0 {
+		return e.hc.flush()
+	}
+	if err := e.hc.encode(e.pos2code[0].code, e.pos2code[0].codeBits); err != nil {
+		return err
+	}
+	if err := e.hc.flush(); err != nil {
+		return err
+	}
+	_, err := e.w.Write(word)
+	return err
+}
+
+// setWriter - destination of encoded words
+func (e *wordEncoder) setWriter(w *bufio.Writer) {
+	e.w, e.hc.w = w, w
+}
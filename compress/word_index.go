@@ -0,0 +1,60 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"fmt"
+)
+
+// WordIndex - offsets of every step-th word of file: random access to word by its number.
+// Memory is 8 bytes per step words, access skips at most step-1 words
+type WordIndex struct {
+	step    uint64
+	count   uint64
+	offsets []uint64
+}
+
+// BuildWordIndex - one pass of Skip over file. Index can be shared by getters of d
+func (d *Decompressor) BuildWordIndex(step int) *WordIndex {
+	if step < 1 {
+		step = 1
+	}
+	idx := &WordIndex{step: uint64(step), offsets: make([]uint64, 0, d.wordsCount/uint64(step)+1)}
+	g := d.MakeGetter()
+	for ; g.HasNext(); idx.count++ {
+		if idx.count%idx.step == 0 {
+			idx.offsets = append(idx.offsets, g.dataP)
+		}
+		g.Skip()
+	}
+	return idx
+}
+
+// Count - number of words in file
+func (idx *WordIndex) Count() uint64 { return idx.count }
+
+// SeekWord - moves getter to i-th (from 0) word of file, next call of Next returns it
+func (g *Getter) SeekWord(idx *WordIndex, i uint64) error {
+	if i >= idx.count {
+		return fmt.Errorf("word %d out of range, file %s has %d words", i, g.fName, idx.count)
+	}
+	g.Reset(idx.offsets[i/idx.step])
+	for j := i % idx.step; j > 0; j-- {
+		g.Skip()
+	}
+	return nil
+}
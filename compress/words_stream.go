@@ -0,0 +1,128 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// WriteWord - writes word in format of AddWordsFrom stream (same as format of intermediate .idt file):
+// uvarint prefix 2*len(word) for compressed word (2*len(word)+1 for uncompressed), then word
+func WriteWord(w io.Writer, word []byte, compressed bool) error {
+	var buf [binary.MaxVarintLen64]byte
+	l := 2 * uint64(len(word))
+	if !compressed {
+		l++
+	}
+	if _, err := w.Write(buf[:binary.PutUvarint(buf[:], l)]); err != nil {
+		return err
+	}
+	_, err := w.Write(word)
+	return err
+}
+
+// wordsBatch - words read from stream, buf holds their bytes
+type wordsBatch struct {
+	buf        []byte
+	ends       []int // end of each word in buf
+	compressed []bool
+}
+
+const wordsBatchSize = 1024
+
+// AddWordsFrom - adds all words of stream r (see WriteWord) till io.EOF, returns amount of added words.
+// Stream is read and decoded in background, in parallel with AddWord (which feeds pattern sampling workers):
+// producer of words (other process, network, decompressor of old files) doesn't wait for compressor and vice versa.
+// Dictionary can be built only from all words - Compress still makes second pass over intermediate file
+func (c *Compressor) AddWordsFrom(r io.Reader) (int, error) {
+	batches := make(chan *wordsBatch, 2)
+	done := make(chan struct{})
+	defer close(done)
+	var readErr error
+	go func() {
+		defer close(batches)
+		readErr = readWords(bufio.NewReaderSize(r, etl.BufIOSize), batches, done)
+	}()
+
+	added := 0
+	for batch := range batches {
+		start := 0
+		for i, end := range batch.ends {
+			word := batch.buf[start:end]
+			start = end
+			var err error
+			if batch.compressed[i] {
+				err = c.AddWord(word)
+			} else {
+				err = c.AddUncompressedWord(word)
+			}
+			if err != nil {
+				return added, err
+			}
+			added++
+		}
+	}
+	if readErr != nil {
+		return added, fmt.Errorf("read word %d: %w", added, readErr)
+	}
+	return added, nil
+}
+
+func readWords(r *bufio.Reader, batches chan<- *wordsBatch, done <-chan struct{}) error {
+	batch := &wordsBatch{}
+	send := func() bool {
+		select {
+		case batches <- batch:
+			batch = &wordsBatch{}
+			return true
+		case <-done:
+			return false
+		}
+	}
+	for {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		start := len(batch.buf)
+		batch.buf = append(batch.buf, make([]byte, l>>1)...)
+		if _, err = io.ReadFull(r, batch.buf[start:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		batch.ends = append(batch.ends, len(batch.buf))
+		batch.compressed = append(batch.compressed, l&1 == 0)
+		if len(batch.ends) == wordsBatchSize && !send() {
+			return nil
+		}
+	}
+	if len(batch.ends) > 0 {
+		send()
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+// Format - layout of compressed file, set by CompressorCfg.Format. Decompressor detects it by file header
+type Format uint8
+
+const (
+	// FormatPatterns - words are encoded by huffman codes of patterns sampled from words (default): the best ratio
+	FormatPatterns Format = iota
+	// FormatZstd - each word is zstd frame, compressed with dictionary trained on sample of words:
+	// much faster to build, ratio and speed of decompression are worse
+	FormatZstd
+)
+
+// zstdMagic - first bytes of FormatZstd file. FormatPatterns file starts from words count, which can't have highest byte 0xff
+var zstdMagic = [8]byte{0xff, 'z', 's', 't', 'd', 's', 'e', 'g'}
+
+const (
+	zstdDictID      = 1
+	zstdMaxDictSize = 112 * 1024 // recommended by zstd size of dictionary
+)
+
+// FormatZstd file: magic | words count | empty words count | dictionary size | dictionary | words.
+// Each word is uvarint prefix 2*len(payload) (2*len(payload)+1 for uncompressed word) and payload - zstd frame
+// of word or word itself. Empty compressed word has empty payload
+func (c *Compressor) compressZstd() error {
+	dict, err := c.zstdDictionary()
+	if err != nil {
+		return err
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderDictRaw(zstdDictID, dict), zstd.WithEncoderCRC(false),
+		zstd.WithEncoderConcurrency(1), zstd.WithZeroFrames(true))
+	if err != nil {
+		return err
+	}
+	defer enc.Close()
+
+	f, err := os.Create(c.tmpOutFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, etl.BufIOSize)
+	var emptyWords uint64
+	if err = c.uncompressedFile.ForEach(func(v []byte, compressed bool) error {
+		if len(v) == 0 {
+			emptyWords++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	var header [32]byte
+	copy(header[:8], zstdMagic[:])
+	binary.BigEndian.PutUint64(header[8:16], c.wordsCount)
+	binary.BigEndian.PutUint64(header[16:24], emptyWords)
+	binary.BigEndian.PutUint64(header[24:32], uint64(len(dict)))
+	if _, err = w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err = w.Write(dict); err != nil {
+		return err
+	}
+	var frame []byte
+	var wc uint64
+	reportProgress(c.progress, PhaseEncoding, 0, c.wordsCount)
+	if err = c.uncompressedFile.ForEach(func(v []byte, compressed bool) error {
+		if wc++; wc%progressStep == 0 {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+			reportProgress(c.progress, PhaseEncoding, wc, c.wordsCount)
+		}
+		if compressed && len(v) > 0 {
+			frame = enc.EncodeAll(v, frame[:0])
+			return WriteWord(w, frame, true)
+		}
+		return WriteWord(w, v, compressed)
+	}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// zstdDictionary - raw dictionary: compressed words sampled evenly across file
+func (c *Compressor) zstdDictionary() ([]byte, error) {
+	st, err := c.uncompressedFile.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	stride := uint64(1)
+	if st.Size() > zstdMaxDictSize && c.wordsCount > 0 {
+		stride = uint64(st.Size())/zstdMaxDictSize + 1
+	}
+	dict := make([]byte, 0, zstdMaxDictSize)
+	var i uint64
+	if err = c.uncompressedFile.ForEach(func(v []byte, compressed bool) error {
+		i++
+		if compressed && i%stride == 0 && len(dict)+len(v) <= zstdMaxDictSize {
+			dict = append(dict, v...)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(dict) < 8 { // zstd requires dictionary of at least 8 bytes
+		dict = append(dict, make([]byte, 8-len(dict))...)
+	}
+	return dict, nil
+}
+
+// openZstd - reads header of FormatZstd file
+func (d *Decompressor) openZstd() error {
+	if d.size < 32 {
+		return fmt.Errorf("compressed file is too short: %d", d.size)
+	}
+	d.wordsCount = binary.BigEndian.Uint64(d.data[8:16])
+	d.emptyWordsCount = binary.BigEndian.Uint64(d.data[16:24])
+	dictSize := binary.BigEndian.Uint64(d.data[24:32])
+	dict := d.data[32 : 32+dictSize]
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDictRaw(zstdDictID, dict), zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return err
+	}
+	d.zstd = dec
+	d.wordsStart = 32 + dictSize
+	return nil
+}
+
+func isZstd(data []byte) bool { return bytes.HasPrefix(data, zstdMagic[:]) }
+
+// zstdWord - payload of word at current position and whether it's compressed, moves to next word
+func (g *Getter) zstdWord() ([]byte, bool) {
+	l, n := binary.Uvarint(g.data[g.dataP:])
+	g.dataP += uint64(n)
+	payload := g.data[g.dataP : g.dataP+l>>1]
+	g.dataP += l >> 1
+	return payload, l&1 == 0
+}
+
+func (g *Getter) zstdNext(buf []byte) ([]byte, uint64) {
+	payload, compressed := g.zstdWord()
+	if !compressed || len(payload) == 0 {
+		return append(buf, payload...), g.dataP
+	}
+	res, err := g.zstd.DecodeAll(payload, buf)
+	if err != nil {
+		panic(fmt.Sprintf("zstd decode: %s, file: %s", err, g.fName))
+	}
+	return res, g.dataP
+}
+
+func (g *Getter) zstdMatch(buf []byte, prefix bool) (bool, uint64) {
+	savePos := g.dataP
+	g.zbuf, _ = g.zstdNext(g.zbuf[:0])
+	match := bytes.Equal(g.zbuf, buf)
+	if prefix {
+		match = bytes.HasPrefix(g.zbuf, buf)
+	}
+	if !match || prefix {
+		g.dataP = savePos
+	}
+	return match, g.dataP
+}
+
+// zstdWordLen - by header of frame, frames without content size are decompressed
+func (g *Getter) zstdWordLen() int {
+	savePos := g.dataP
+	defer func() { g.dataP = savePos }()
+	payload, compressed := g.zstdWord()
+	if !compressed || len(payload) == 0 {
+		return len(payload)
+	}
+	var h zstd.Header
+	if err := h.Decode(payload); err == nil && h.HasFCS {
+		return int(h.FrameContentSize)
+	}
+	g.dataP = savePos
+	g.zbuf, _ = g.zstdNext(g.zbuf[:0])
+	return len(g.zbuf)
+}
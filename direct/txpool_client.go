@@ -96,6 +96,62 @@ func (c *TxPoolOnAddC) Context() context.Context { return c.ctx }
 
 // -- end OnAdd
 
+// -- start OnEvents
+
+func (s *TxPoolClient) OnEvents(ctx context.Context, in *txpool_proto.OnEventsRequest, opts ...grpc.CallOption) (txpool_proto.Txpool_OnEventsClient, error) {
+	ch := make(chan *onEventsReply, 16384)
+	streamServer := &TxPoolOnEventsS{ch: ch, ctx: ctx}
+	go func() {
+		defer close(ch)
+		streamServer.Err(s.server.OnEvents(in, streamServer))
+	}()
+	return &TxPoolOnEventsC{ch: ch, ctx: ctx}, nil
+}
+
+type onEventsReply struct {
+	r   *txpool_proto.OnEventsReply
+	err error
+}
+
+type TxPoolOnEventsS struct {
+	ch  chan *onEventsReply
+	ctx context.Context
+	grpc.ServerStream
+}
+
+func (s *TxPoolOnEventsS) Send(m *txpool_proto.OnEventsReply) error {
+	s.ch <- &onEventsReply{r: m}
+	return nil
+}
+func (s *TxPoolOnEventsS) Context() context.Context { return s.ctx }
+func (s *TxPoolOnEventsS) Err(err error) {
+	if err == nil {
+		return
+	}
+	s.ch <- &onEventsReply{err: err}
+}
+
+type TxPoolOnEventsC struct {
+	ch  chan *onEventsReply
+	ctx context.Context
+	grpc.ClientStream
+}
+
+func (c *TxPoolOnEventsC) Recv() (*txpool_proto.OnEventsReply, error) {
+	m, ok := <-c.ch
+	if !ok || m == nil {
+		return nil, io.EOF
+	}
+	return m.r, m.err
+}
+func (c *TxPoolOnEventsC) Context() context.Context { return c.ctx }
+
+// -- end OnEvents
+
+func (s *TxPoolClient) ContentFrom(ctx context.Context, in *txpool_proto.ContentFromRequest, opts ...grpc.CallOption) (*txpool_proto.ContentFromReply, error) {
+	return s.server.ContentFrom(ctx, in)
+}
+
 func (s *TxPoolClient) Status(ctx context.Context, in *txpool_proto.StatusRequest, opts ...grpc.CallOption) (*txpool_proto.StatusReply, error) {
 	return s.server.Status(ctx, in)
 }
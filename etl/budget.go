@@ -0,0 +1,119 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// maxBudgetReportStep - collectors report size of their buffers to MemoryBudget when it changes by 1/16 of the limit,
+// but not more than this number of bytes
+const maxBudgetReportStep = int(datasize.MB)
+
+// MemoryBudget is a limit of RAM shared by buffers of several collectors, which collect concurrently (each collector
+// in its own goroutine). When total size of buffers exceeds the limit, the collector with the largest buffer flushes it
+// on its next Collect. Collector also flushes, when total is exceeded and its buffer reaches its fair share of the limit -
+// the limit is respected even if the largest collector doesn't collect anymore
+type MemoryBudget struct {
+	limit      int
+	reportStep int
+	lock       sync.Mutex
+	sizes      map[*Collector]int
+	total      int
+}
+
+func NewMemoryBudget(limit datasize.ByteSize) *MemoryBudget {
+	b := &MemoryBudget{limit: int(limit.Bytes()), sizes: map[*Collector]int{}}
+	b.reportStep = b.limit / 16
+	if b.reportStep > maxBudgetReportStep {
+		b.reportStep = maxBudgetReportStep
+	}
+	return b
+}
+
+// Used returns total size of buffers of collectors, as last reported by them
+func (b *MemoryBudget) Used() datasize.ByteSize {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return datasize.ByteSize(b.total)
+}
+
+// update records size of buffer of collector c, returns true if c has to flush its buffer (then size of c is recorded as 0)
+func (b *MemoryBudget) update(c *Collector, size int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.total += size - b.sizes[c]
+	b.sizes[c] = size
+	if b.total <= b.limit {
+		return false
+	}
+	flush := func() bool {
+		b.total -= size
+		b.sizes[c] = 0
+		return true
+	}
+	if size >= b.limit/len(b.sizes) {
+		return flush()
+	}
+	var largest *Collector
+	largestSize := size
+	for other, otherSize := range b.sizes {
+		if otherSize > largestSize {
+			largest, largestSize = other, otherSize
+		}
+	}
+	if largest == nil {
+		return flush()
+	}
+	atomic.StoreInt32(&largest.flushRequested, 1)
+	return false
+}
+
+func (b *MemoryBudget) remove(c *Collector) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.total -= b.sizes[c]
+	delete(b.sizes, c)
+}
+
+// SetMemoryBudget makes collector share budget with other collectors, must be called before Collect
+func (c *Collector) SetMemoryBudget(budget *MemoryBudget) { c.budget = budget }
+
+// overBudget reports size of buffer to the budget, returns true if buffer has to be flushed to respect the budget
+func (c *Collector) overBudget(size int) bool {
+	if c.budget == nil {
+		return false
+	}
+	if atomic.LoadInt32(&c.flushRequested) == 1 {
+		atomic.StoreInt32(&c.flushRequested, 0)
+		c.reportedSize = 0
+		c.budget.update(c, 0)
+		return true
+	}
+	if delta := size - c.reportedSize; delta < c.budget.reportStep && delta > -c.budget.reportStep {
+		return false
+	}
+	c.reportedSize = size
+	if c.budget.update(c, size) {
+		c.reportedSize = 0
+		return true
+	}
+	return false
+}
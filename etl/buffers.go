@@ -37,6 +37,9 @@ const (
 	// SortableOldestAppearedBuffer - buffer that keeps only the oldest entries.
 	// if first v1 was added under key K, then v2; only v1 will stay
 	SortableOldestAppearedBuffer
+	// SortableLatestAppearedBuffer - buffer that keeps only the latest entries.
+	// if first v1 was added under key K, then v2; only v2 will stay
+	SortableLatestAppearedBuffer
 
 	BufIOSize = 64 * 4096 // 64 pages | default is 1 page | increasing further doesn't show speedup on SSD
 )
@@ -51,6 +54,7 @@ type Buffer interface {
 	Write(io.Writer) error
 	Sort()
 	CheckFlushSize() bool
+	Size() int
 	SetComparator(cmp kv.CmpFunc)
 }
 
@@ -63,6 +67,7 @@ var (
 	_ Buffer = &sortableBuffer{}
 	_ Buffer = &appendSortableBuffer{}
 	_ Buffer = &oldestEntrySortableBuffer{}
+	_ Buffer = &latestEntrySortableBuffer{}
 )
 
 func NewSortableBuffer(bufferOptimalSize datasize.ByteSize) *sortableBuffer {
@@ -351,6 +356,28 @@ func (b *oldestEntrySortableBuffer) CheckFlushSize() bool {
 	return b.size >= b.optimalSize
 }
 
+func NewLatestEntryBuffer(bufferOptimalSize datasize.ByteSize) *latestEntrySortableBuffer {
+	return &latestEntrySortableBuffer{oldestEntrySortableBuffer{
+		entries:     make(map[string][]byte),
+		size:        0,
+		optimalSize: int(bufferOptimalSize.Bytes()),
+	}}
+}
+
+// latestEntrySortableBuffer is oldestEntrySortableBuffer which replaces value of existing entry
+type latestEntrySortableBuffer struct {
+	oldestEntrySortableBuffer
+}
+
+func (b *latestEntrySortableBuffer) Put(k, v []byte) {
+	if stored, ok := b.entries[string(k)]; ok {
+		b.size += len(v) - len(stored)
+	} else {
+		b.size += len(k)*2 + len(v)
+	}
+	b.entries[string(k)] = common.Copy(v)
+}
+
 func getBufferByType(tp int, size datasize.ByteSize) Buffer {
 	switch tp {
 	case SortableSliceBuffer:
@@ -359,6 +386,8 @@ func getBufferByType(tp int, size datasize.ByteSize) Buffer {
 		return NewAppendBuffer(size)
 	case SortableOldestAppearedBuffer:
 		return NewOldestEntryBuffer(size)
+	case SortableLatestAppearedBuffer:
+		return NewLatestEntryBuffer(size)
 	default:
 		panic("unknown buffer type " + strconv.Itoa(tp))
 	}
@@ -372,6 +401,8 @@ func getTypeByBuffer(b Buffer) int {
 		return SortableAppendBuffer
 	case *oldestEntrySortableBuffer:
 		return SortableOldestAppearedBuffer
+	case *latestEntrySortableBuffer:
+		return SortableLatestAppearedBuffer
 	default:
 		panic(fmt.Sprintf("unknown buffer type: %T ", b))
 	}
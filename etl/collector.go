@@ -18,10 +18,8 @@ package etl
 
 import (
 	"bytes"
-	"container/heap"
-	"errors"
+	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -49,6 +47,16 @@ type Collector struct {
 	logLvl          log.Lvl
 	bufType         int
 	logPrefix       string
+	flushes         []*flushTask // Background flushes of NewParallelCollector, in the order of flushes
+	mergeWorkers    int          // Number of goroutines merging files in Load, see NewParallelCollector
+	compression     Compression  // Compression of temp files
+	comparator      kv.CmpFunc   // Order of entries, see SetComparator
+	metrics         *collectorMetrics
+	manifest        string // File with list of runs for the resume of Load, see SetManifest
+	encoder         SpillEncoder
+	budget          *MemoryBudget
+	reportedSize    int   // Size of buffer last reported to budget
+	flushRequested  int32 // Set by budget (from goroutines of other collectors) when buffer has to be flushed
 }
 
 // NewCollectorFromFiles creates collector from existing files (left over from previous unsuccessful loading)
@@ -75,6 +83,23 @@ func NewCollectorFromFiles(logPrefix, tmpdir string) (*Collector, error) {
 	return &Collector{dataProviders: dataProviders, allFlushed: true, autoClean: false, logPrefix: logPrefix}, nil
 }
 
+// NewCollectorFromCheckpoint creates collector which continues collection on top of files returned by Collector.Checkpoint
+// (left over from interrupted process, which didn't Close the collector)
+func NewCollectorFromCheckpoint(logPrefix, tmpdir string, sortableBuffer Buffer, files []string) (*Collector, error) {
+	c := NewCollector(logPrefix, tmpdir, sortableBuffer)
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			for _, p := range c.dataProviders {
+				_ = p.(*fileDataProvider).file.Close() // not Dispose - files are still needed for next attempt
+			}
+			return nil, fmt.Errorf("collector from checkpoint - opening file %s: %w", name, err)
+		}
+		c.dataProviders = append(c.dataProviders, &fileDataProvider{file: file})
+	}
+	return c, nil
+}
+
 // NewCriticalCollector does not clean up temporary files if loading has failed
 func NewCriticalCollector(logPrefix, tmpdir string, sortableBuffer Buffer) *Collector {
 	c := NewCollector(logPrefix, tmpdir, sortableBuffer)
@@ -91,13 +116,18 @@ func NewCollector(logPrefix, tmpdir string, sortableBuffer Buffer) *Collector {
 		}
 		var provider dataProvider
 		var err error
+		if c.comparator != nil {
+			sortableBuffer.SetComparator(c.comparator)
+		}
 		sortableBuffer.Sort()
 		if canStoreInRam && len(c.dataProviders) == 0 {
 			provider = KeepInRAM(sortableBuffer)
 			c.allFlushed = true
 		} else {
 			doFsync := !c.autoClean /* is critical collector */
-			provider, err = FlushToDisk(sortableBuffer, tmpdir, doFsync, c.logLvl)
+			if provider, err = flushToDisk(sortableBuffer, tmpdir, doFsync, c.logLvl, c.compression, c.encoder); err == nil {
+				c.metrics.flushed(provider)
+			}
 		}
 		if err != nil {
 			return err
@@ -110,7 +140,7 @@ func NewCollector(logPrefix, tmpdir string, sortableBuffer Buffer) *Collector {
 
 	c.extractNextFunc = func(originalK, k []byte, v []byte) error {
 		sortableBuffer.Put(k, v)
-		if sortableBuffer.CheckFlushSize() {
+		if sortableBuffer.CheckFlushSize() || c.overBudget(sortableBuffer.Size()) {
 			if err := c.flushBuffer(originalK, false); err != nil {
 				return err
 			}
@@ -124,26 +154,115 @@ func (c *Collector) Collect(k, v []byte) error {
 	return c.extractNextFunc(k, k, v)
 }
 
+// Checkpoint flushes buffered entries to disk and fsyncs all files of collector, returns names of the files.
+// Collection can continue after Checkpoint, and after restart - by NewCollectorFromCheckpoint
+func (c *Collector) Checkpoint() ([]string, error) {
+	if c.allFlushed {
+		return nil, fmt.Errorf("checkpoint: collector is already loaded")
+	}
+	if err := c.flushBuffer(nil, false); err != nil {
+		return nil, err
+	}
+	if err := c.waitFlushes(); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(c.dataProviders))
+	for _, p := range c.dataProviders {
+		fp, ok := p.(*fileDataProvider)
+		if !ok {
+			return nil, fmt.Errorf("checkpoint: unexpected data provider %s", p)
+		}
+		if err := fp.file.Sync(); err != nil {
+			return nil, err
+		}
+		files = append(files, fp.file.Name())
+	}
+	return files, nil
+}
+
 func (c *Collector) LogLvl(v log.Lvl) { c.logLvl = v }
 
+// SetCompression sets compression of temp files flushed after the call, it is for collectors with small disk
+// for temp files. Files of any compression can be loaded
+func (c *Collector) SetCompression(compression Compression) { c.compression = compression }
+
+// SetComparator sets order of entries in which Load passes them to loadFunc, instead of order of keys. Entries
+// collected before the call are sorted by the comparator too, if they are not flushed yet. TransformArgs.Comparator
+// of Load overrides it, and must define the same order
+func (c *Collector) SetComparator(cmp kv.CmpFunc) { c.comparator = cmp }
+
 func (c *Collector) Load(db kv.RwTx, toBucket string, loadFunc LoadFunc, args TransformArgs) error {
+	return c.LoadContext(context.Background(), db, toBucket, loadFunc, args)
+}
+
+// LoadContext is Load which is aborted with ctx.Err() when ctx is done: ctx is checked before flush of buffer and
+// every 1024 entries. Temp files are removed as after any failed Load (not by critical collector)
+func (c *Collector) LoadContext(ctx context.Context, db kv.RwTx, toBucket string, loadFunc LoadFunc, args TransformArgs) error {
+	return c.load(ctx, db, toBucket, loadFunc, nil, args)
+}
+
+// load is LoadContext, finish is called after the last entry with the last table and next of loadFunc
+func (c *Collector) load(ctx context.Context, db kv.RwTx, toBucket string, loadFunc LoadFunc, finish loadFinishFunc, args TransformArgs) (err error) {
+	if args.Comparator == nil {
+		args.Comparator = c.comparator
+	}
 	defer func() {
-		if c.autoClean {
-			c.Close()
+		if !c.autoClean {
+			return
 		}
-	}()
-	if !c.allFlushed {
-		if e := c.flushBuffer(nil, true); e != nil {
-			return e
+		if err != nil && c.manifest != "" {
+			c.closeFiles() // runs and manifest are kept for NewCollectorFromManifest, Close doesn't remove them
+			c.manifest = ""
+			return
 		}
+		c.Close()
+	}()
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	if err := loadFilesIntoBucket(c.logPrefix, db, toBucket, c.bufType, c.dataProviders, loadFunc, args); err != nil {
+	providers, stats, stop, err := c.prepareLoad(args.Comparator)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defer c.metrics.loaded(stats.runs, time.Now())
+	if err := loadFilesIntoBucket(ctx, c.logPrefix, db, toBucket, c.bufType, providers, stats, loadFunc, finish, args); err != nil {
 		return err
 	}
 	return nil
 }
 
+// prepareLoad flushes the buffer and returns sorted runs to merge, stop has to be called after the merge
+func (c *Collector) prepareLoad(comparator kv.CmpFunc) (providers []dataProvider, stats loadStats, stop func(), err error) {
+	if !c.allFlushed {
+		if err = c.flushBuffer(nil, c.manifest == "" /* canStoreInRam */); err != nil {
+			return nil, stats, nil, err
+		}
+	}
+	if err = c.waitFlushes(); err != nil {
+		return nil, stats, nil, err
+	}
+	if c.manifest != "" {
+		if err = c.writeManifest(); err != nil {
+			return nil, stats, nil, err
+		}
+	}
+	stats = newLoadStats(c.dataProviders)
+	providers, stop = c.dataProviders, func() {}
+	if groups := c.mergeWorkers; groups > 1 && len(providers) >= 4 {
+		if groups > len(providers)/2 {
+			groups = len(providers) / 2
+		}
+		providers, stop = mergeConcurrently(providers, groups, comparator)
+	}
+	return providers, stats, stop, nil
+}
+
 func (c *Collector) Close() {
+	_ = c.waitFlushes()
+	if c.budget != nil {
+		c.budget.remove(c)
+	}
 	totalSize := uint64(0)
 	for _, p := range c.dataProviders {
 		totalSize += p.Dispose()
@@ -151,27 +270,19 @@ func (c *Collector) Close() {
 	if totalSize > 0 {
 		log.Log(c.logLvl, fmt.Sprintf("[%s] etl: temp files removed", c.logPrefix), "total size", common.ByteCount(totalSize))
 	}
+	if c.manifest != "" {
+		_ = os.Remove(c.manifest)
+	}
 }
 
-func loadFilesIntoBucket(logPrefix string, db kv.RwTx, bucket string, bufType int, providers []dataProvider, loadFunc LoadFunc, args TransformArgs) error {
+func loadFilesIntoBucket(ctx context.Context, logPrefix string, db kv.RwTx, bucket string, bufType int, providers []dataProvider, stats loadStats, loadFunc LoadFunc, finish loadFinishFunc, args TransformArgs) error {
 	var m runtime.MemStats
 
-	h := &Heap{comparator: args.Comparator}
-	heap.Init(h)
-	for i, provider := range providers {
-		if key, value, err := provider.Next(nil, nil); err == nil {
-			he := HeapElem{key, i, value}
-			heap.Push(h, he)
-		} else /* we must have at least one entry per file */ {
-			eee := fmt.Errorf("%s: error reading first readers: n=%d current=%d provider=%s err=%w",
-				logPrefix, len(providers), i, provider, err)
-			panic(eee)
-		}
-	}
+	it := newMergeIterator(logPrefix, providers, bufType, args.Comparator)
 	var c kv.RwCursor
 
 	currentTable := &currentTableReader{db, bucket}
-	haveSortingGuaranties := isIdentityLoadFunc(loadFunc) // user-defined loadFunc may change ordering
+	haveSortingGuaranties := isIdentityLoadFunc(loadFunc) && args.Comparator == nil // user-defined loadFunc or comparator may change ordering
 	var lastKey []byte
 	if bucket != "" { // passing empty bucket name is valid case for etl when DB modification is not expected
 		var err error
@@ -190,6 +301,13 @@ func loadFilesIntoBucket(logPrefix string, db kv.RwTx, bucket string, bufType in
 
 	logEvery := time.NewTicker(30 * time.Second)
 	defer logEvery.Stop()
+	start := time.Now()
+	progressEvery := args.LoadProgressEvery
+	if progressEvery <= 0 {
+		progressEvery = defaultLoadProgressEvery
+	}
+	lastProgress := start
+	var processed uint64 // Entries taken from providers
 
 	i := 0
 	var prevK []byte
@@ -222,6 +340,8 @@ func loadFilesIntoBucket(logPrefix string, db kv.RwTx, bucket string, bufType in
 				logArs = append(logArs, "current key", makeCurrentKeyStr(k))
 			}
 
+			logArs = append(logArs, stats.progress(processed, start).logArgs()...)
+
 			common.ReadMemStats(&m)
 			logArs = append(logArs, "alloc", common.ByteCount(m.Alloc), "sys", common.ByteCount(m.Sys))
 			log.Info(fmt.Sprintf("[%s] ETL [2/2] Loading", logPrefix), logArs...)
@@ -254,25 +374,43 @@ func loadFilesIntoBucket(logPrefix string, db kv.RwTx, bucket string, bufType in
 		}
 		return nil
 	}
+	var nextCheck uint64
 	// Main loading loop
-	for h.Len() > 0 {
+	for {
 		if err := common.Stopped(args.Quit); err != nil {
 			return err
 		}
-
-		element := (heap.Pop(h)).(HeapElem)
-		provider := providers[element.TimeIdx]
-		err := loadFunc(element.Key, element.Value, currentTable, loadNextFunc)
+		k, v, ok, err := it.next()
 		if err != nil {
 			return err
 		}
-		if element.Key, element.Value, err = provider.Next(element.Key[:0], element.Value[:0]); err == nil {
-			heap.Push(h, element)
-		} else if !errors.Is(err, io.EOF) {
-			return fmt.Errorf("%s: error while reading next element from disk: %w", logPrefix, err)
+		if !ok {
+			break
+		}
+		if err := loadFunc(k, v, currentTable, loadNextFunc); err != nil {
+			return err
+		}
+		processed = it.processed
+		if processed >= nextCheck {
+			nextCheck = processed + 1024
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if args.LoadProgress != nil && time.Since(lastProgress) >= progressEvery {
+				lastProgress = time.Now()
+				args.LoadProgress(stats.progress(processed, start))
+			}
 		}
 	}
 
+	if finish != nil {
+		if err := finish(currentTable, loadNextFunc); err != nil {
+			return err
+		}
+	}
+	if args.LoadProgress != nil {
+		args.LoadProgress(stats.progress(processed, start))
+	}
 	log.Trace(fmt.Sprintf("[%s] ETL Load done", logPrefix), "bucket", bucket, "records", i)
 
 	return nil
@@ -25,6 +25,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/log/v3"
 )
@@ -38,10 +39,36 @@ type fileDataProvider struct {
 	file       *os.File
 	reader     io.Reader
 	byteReader io.ByteReader // Different interface to the same object as reader
+	count      uint64        // Number of entries, 0 if unknown (file is not flushed by this process)
+	encoder    SpillEncoder  // Format of entries, nil - default
+	bufReader  *bufio.Reader
 }
 
+// Compression of temp files of collectors, see Collector.SetCompression
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	// SnappyCompression - Snappy framing format: temp files of typical keys and values become 2-4 times smaller,
+	// compression and decompression are faster than disk
+	SnappyCompression
+)
+
+// snappyMagic - stream identifier at the beginning of files in Snappy framing format
+const snappyMagic = "\xff\x06\x00\x00sNaPpY"
+
 // FlushToDisk - `doFsync` is true only for 'critical' collectors (which should not loose).
 func FlushToDisk(b Buffer, tmpdir string, doFsync bool, lvl log.Lvl) (dataProvider, error) {
+	return FlushToDiskCompressed(b, tmpdir, doFsync, lvl, NoCompression)
+}
+
+// FlushToDiskCompressed is FlushToDisk which compresses the file. Compression of file is detected when it is read
+func FlushToDiskCompressed(b Buffer, tmpdir string, doFsync bool, lvl log.Lvl, compression Compression) (dataProvider, error) {
+	return flushToDisk(b, tmpdir, doFsync, lvl, compression, nil)
+}
+
+// flushToDisk is FlushToDiskCompressed which writes entries by encoder, nil - in default format
+func flushToDisk(b Buffer, tmpdir string, doFsync bool, lvl log.Lvl, compression Compression, encoder SpillEncoder) (dataProvider, error) {
 	if b.Len() == 0 {
 		return nil, nil
 	}
@@ -61,8 +88,12 @@ func FlushToDisk(b Buffer, tmpdir string, doFsync bool, lvl log.Lvl) (dataProvid
 		defer bufferFile.Sync() //nolint:errcheck
 	}
 
+	var compressor *s2.Writer
 	w := bufio.NewWriterSize(bufferFile, BufIOSize)
-	defer w.Flush() //nolint:errcheck
+	if compression == SnappyCompression {
+		compressor = s2.NewWriter(bufferFile, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+		w = bufio.NewWriterSize(compressor, BufIOSize)
+	}
 
 	defer func() {
 		b.Reset() // run it after buf.flush and file.sync
@@ -76,11 +107,25 @@ func FlushToDisk(b Buffer, tmpdir string, doFsync bool, lvl log.Lvl) (dataProvid
 			"alloc", common.ByteCount(m.Alloc), "sys", common.ByteCount(m.Sys))
 	}()
 
-	if err = b.Write(w); err != nil {
+	count := uint64(b.Len())
+	if encoder == nil {
+		err = b.Write(w)
+	} else {
+		err = writeEntries(b, w, encoder)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("error writing entries to disk: %w", err)
 	}
+	if err = w.Flush(); err != nil {
+		return nil, fmt.Errorf("error writing entries to disk: %w", err)
+	}
+	if compressor != nil {
+		if err = compressor.Close(); err != nil {
+			return nil, fmt.Errorf("error writing entries to disk: %w", err)
+		}
+	}
 
-	return &fileDataProvider{file: bufferFile, reader: nil}, nil
+	return &fileDataProvider{file: bufferFile, reader: nil, count: count, encoder: encoder}, nil
 }
 
 func (p *fileDataProvider) Next(keyBuf, valBuf []byte) ([]byte, []byte, error) {
@@ -90,9 +135,15 @@ func (p *fileDataProvider) Next(keyBuf, valBuf []byte) ([]byte, []byte, error) {
 			return nil, nil, err
 		}
 		r := bufio.NewReaderSize(p.file, BufIOSize)
+		if magic, _ := r.Peek(len(snappyMagic)); string(magic) == snappyMagic {
+			r = bufio.NewReaderSize(s2.NewReader(r), BufIOSize)
+		}
 		p.reader = r
 		p.byteReader = r
-
+		p.bufReader = r
+	}
+	if p.encoder != nil {
+		return p.encoder.Decode(p.bufReader, keyBuf, valBuf)
 	}
 	return readElementFromDisk(p.reader, p.byteReader, keyBuf, valBuf)
 }
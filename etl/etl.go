@@ -74,7 +74,12 @@ type TransformArgs struct {
 	LogDetailsExtract AdditionalLogArguments
 	LogDetailsLoad    AdditionalLogArguments
 
+	// Comparator defines order of entries in Load instead of order of keys, buffer of Transform is sorted by it too
 	Comparator kv.CmpFunc
+
+	// LoadProgress is called by Collector.Load every LoadProgressEvery (30 seconds by default) and after the last entry
+	LoadProgress      func(LoadProgress)
+	LoadProgressEvery time.Duration
 }
 
 func Transform(
@@ -87,12 +92,35 @@ func Transform(
 	loadFunc LoadFunc,
 	args TransformArgs,
 ) error {
+	return transform(logPrefix, db, fromBucket, tmpdir, extractFunc, args, func(collector *Collector) error {
+		return collector.Load(db, toBucket, loadFunc, args)
+	})
+}
+
+// TransformWithReduce is Transform which passes all values of each key to reduceFunc, see Collector.LoadReduce
+func TransformWithReduce(
+	logPrefix string,
+	db kv.RwTx,
+	fromBucket string,
+	toBucket string,
+	tmpdir string,
+	extractFunc ExtractFunc,
+	reduceFunc ReduceFunc,
+	args TransformArgs,
+) error {
+	return transform(logPrefix, db, fromBucket, tmpdir, extractFunc, args, func(collector *Collector) error {
+		return collector.LoadReduce(db, toBucket, reduceFunc, args)
+	})
+}
+
+func transform(logPrefix string, db kv.RwTx, fromBucket string, tmpdir string, extractFunc ExtractFunc, args TransformArgs, load func(*Collector) error) error {
 	bufferSize := BufferOptimalSize
 	if args.BufferSize > 0 {
 		bufferSize = datasize.ByteSize(args.BufferSize)
 	}
 	buffer := getBufferByType(args.BufferType, bufferSize)
 	collector := NewCollector(logPrefix, tmpdir, buffer)
+	collector.SetComparator(args.Comparator)
 	defer collector.Close()
 
 	t := time.Now()
@@ -104,7 +132,7 @@ func Transform(
 	defer func(t time.Time) {
 		log.Trace(fmt.Sprintf("[%s] Load finished", logPrefix), "took", time.Since(t))
 	}(time.Now())
-	return collector.Load(db, toBucket, loadFunc, args)
+	return load(collector)
 }
 
 // extractBucketIntoFiles - [startkey, endkey)
@@ -17,14 +17,24 @@ package etl
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/stretchr/testify/assert"
@@ -146,6 +156,35 @@ func TestRAMDataProviders(t *testing.T) {
 	}
 }
 
+func TestCollectorCheckpoint(t *testing.T) {
+	tmpdir := t.TempDir()
+	collector := NewCollector(t.Name(), tmpdir, NewSortableBuffer(BufferOptimalSize))
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i)), nil))
+	}
+	files, err := collector.Checkpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	// collector is not closed - as after crash
+
+	resumed, err := NewCollectorFromCheckpoint(t.Name(), tmpdir, NewSortableBuffer(BufferOptimalSize), files)
+	assert.NoError(t, err)
+	defer resumed.Close()
+	for i := 10; i < 20; i++ {
+		assert.NoError(t, resumed.Collect([]byte(fmt.Sprintf("key %d", i)), nil))
+	}
+	var loaded int
+	err = resumed.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		loaded++
+		return nil
+	}, TransformArgs{})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, loaded)
+
+	_, err = NewCollectorFromCheckpoint(t.Name(), tmpdir, NewSortableBuffer(BufferOptimalSize), files)
+	assert.Error(t, err) // files are removed after successful Load
+}
+
 func TestTransformRAMOnly(t *testing.T) {
 	// test invariant when we only have one buffer and it fits into RAM (exactly 1 buffer)
 	_, tx := memdb.NewTestTx(t)
@@ -361,3 +400,390 @@ func compareBucketsDouble(t *testing.T, db kv.Tx, b1, b2 string) {
 	assert.NoError(t, err)
 	assert.Equal(t, b1Map, b2Map)
 }
+
+func TestParallelCollector(t *testing.T) {
+	for _, bufType := range []int{SortableSliceBuffer, SortableAppendBuffer, SortableOldestAppearedBuffer} {
+		tmpdir := t.TempDir()
+		load := func(c *Collector) (keys, values []string) {
+			for i := 0; i < 20000; i++ {
+				k := []byte(fmt.Sprintf("key %d", (i*7919)%5000)) // Every key 4 times
+				assert.NoError(t, c.Collect(k, []byte(fmt.Sprintf("%d,", i))))
+			}
+			assert.NoError(t, c.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+				keys = append(keys, string(k))
+				values = append(values, string(v))
+				return nil
+			}, TransformArgs{}))
+			return keys, values
+		}
+		// Small buffers - many files
+		expectedKeys, expectedValues := load(NewCollector(t.Name(), tmpdir, getBufferByType(bufType, 16*datasize.KB)))
+		for _, workers := range []int{1, 4} {
+			keys, values := load(NewParallelCollector(t.Name(), tmpdir, bufType, 16*datasize.KB, workers))
+			assert.Equal(t, expectedKeys, keys, "buffer type %d, workers %d", bufType, workers)
+			assert.Equal(t, expectedValues, values, "buffer type %d, workers %d", bufType, workers)
+		}
+		entries, err := os.ReadDir(tmpdir)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(entries), "files are removed after Load")
+	}
+}
+
+func TestCompressedFiles(t *testing.T) {
+	collect := func(compression Compression) (files []string, size int64, keys []string) {
+		tmpdir := t.TempDir()
+		collector := NewCollector(t.Name(), tmpdir, NewSortableBuffer(16*datasize.KB))
+		defer collector.Close()
+		collector.SetCompression(compression)
+		for i := 0; i < 10000; i++ {
+			assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i)), []byte(strings.Repeat("value", i%10))))
+		}
+		files, err := collector.Checkpoint()
+		assert.NoError(t, err)
+		for _, name := range files {
+			info, err := os.Stat(name)
+			assert.NoError(t, err)
+			size += info.Size()
+		}
+		// Loading by collector resumed from checkpoint - compression is detected
+		resumed, err := NewCollectorFromCheckpoint(t.Name(), tmpdir, NewSortableBuffer(16*datasize.KB), files)
+		assert.NoError(t, err)
+		defer resumed.Close()
+		assert.NoError(t, resumed.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+			keys = append(keys, fmt.Sprintf("%s=%s", k, v))
+			return nil
+		}, TransformArgs{}))
+		return files, size, keys
+	}
+	files, size, keys := collect(NoCompression)
+	compressedFiles, compressedSize, compressedKeys := collect(SnappyCompression)
+	assert.Equal(t, len(files), len(compressedFiles))
+	assert.Equal(t, 10000, len(keys))
+	assert.Equal(t, keys, compressedKeys)
+	assert.Less(t, 2*compressedSize, size)
+}
+
+func TestLoadProgress(t *testing.T) {
+	collector := NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(16*datasize.KB))
+	defer collector.Close()
+	for i := 0; i < 10000; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i)), nil))
+	}
+	var reports []LoadProgress
+	assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		return nil
+	}, TransformArgs{LoadProgress: func(p LoadProgress) { reports = append(reports, p) }, LoadProgressEvery: time.Nanosecond}))
+	assert.Less(t, 1, len(reports))
+	for i := 1; i < len(reports); i++ {
+		assert.Less(t, reports[i-1].Processed, reports[i].Processed)
+	}
+	last := reports[len(reports)-1]
+	assert.Equal(t, uint64(10000), last.Processed)
+	assert.Equal(t, uint64(10000), last.Total)
+	assert.Less(t, 1, last.Runs)
+	assert.Less(t, uint64(0), last.FlushedBytes)
+	assert.Equal(t, time.Duration(0), last.ETA)
+	assert.Less(t, time.Duration(0), reports[0].ETA)
+}
+
+func TestDedupBuffersAcrossRuns(t *testing.T) {
+	for _, tc := range []struct {
+		bufType int
+		want    []string // values of key loaded by Load
+	}{
+		{SortableLatestAppearedBuffer, []string{"2"}},
+		// only latest entry buffer merges runs, others load entries of each run
+		{SortableOldestAppearedBuffer, []string{"0", "1", "2"}},
+		{SortableAppendBuffer, []string{"0", "1", "2"}},
+	} {
+		collector := NewCollector(t.Name(), t.TempDir(), getBufferByType(tc.bufType, 16*datasize.KB))
+		// Each round is in its own runs
+		for round := 0; round < 3; round++ {
+			for i := 0; i < 10000; i++ {
+				assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %04d", i)), []byte(fmt.Sprintf("%d", round))))
+			}
+		}
+		assert.Less(t, 3, len(collector.dataProviders))
+		i := 0
+		assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+			assert.Equal(t, fmt.Sprintf("key %04d", i/len(tc.want)), string(k))
+			assert.Equal(t, tc.want[i%len(tc.want)], string(v))
+			i++
+			return nil
+		}, TransformArgs{}))
+		assert.Equal(t, 10000*len(tc.want), i)
+		collector.Close()
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	budget := NewMemoryBudget(256 * datasize.KB)
+	collectors := make([]*Collector, 4)
+	for i := range collectors {
+		collectors[i] = NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(datasize.MB))
+		collectors[i].SetMemoryBudget(budget)
+	}
+	var wg sync.WaitGroup
+	var maxUsed uint64
+	for i, c := range collectors {
+		wg.Add(1)
+		go func(i int, c *Collector) {
+			defer wg.Done()
+			for j := 0; j < 20000; j++ {
+				assert.NoError(t, c.Collect([]byte(fmt.Sprintf("key %d %d", i, j)), []byte("value")))
+				if used := uint64(budget.Used()); used > atomic.LoadUint64(&maxUsed) {
+					atomic.StoreUint64(&maxUsed, used)
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	// Limit is exceeded only until the largest collector flushes its buffer
+	assert.LessOrEqual(t, atomic.LoadUint64(&maxUsed), uint64(2*256*datasize.KB))
+	for i, c := range collectors {
+		assert.Less(t, 1, len(c.dataProviders))
+		j := 0
+		assert.NoError(t, c.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+			j++
+			return nil
+		}, TransformArgs{}))
+		assert.Equal(t, 20000, j, i)
+	}
+	assert.Equal(t, datasize.ByteSize(0), budget.Used())
+}
+
+func TestCollectorComparator(t *testing.T) {
+	// Keys are 4-byte prefix followed by 8-byte txNum, ordered by txNum first
+	byTxNum := func(k1, k2, _, _ []byte) int {
+		if c := bytes.Compare(k1[4:], k2[4:]); c != 0 {
+			return c
+		}
+		return bytes.Compare(k1[:4], k2[:4])
+	}
+	reverse := func(k1, k2, _, _ []byte) int { return bytes.Compare(k2, k1) }
+	for _, cmp := range []kv.CmpFunc{byTxNum, reverse} {
+		for _, collector := range []*Collector{
+			NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(16*datasize.KB)),
+			NewParallelCollector(t.Name(), t.TempDir(), SortableSliceBuffer, 16*datasize.KB, 4),
+		} {
+			collector.SetComparator(cmp)
+			for i := 0; i < 10000; i++ {
+				k := make([]byte, 12)
+				binary.BigEndian.PutUint32(k, uint32(i%100))
+				binary.BigEndian.PutUint64(k[4:], uint64(i*7919%10000))
+				assert.NoError(t, collector.Collect(k, nil))
+			}
+			var prev []byte
+			count := 0
+			assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+				if prev != nil {
+					assert.Less(t, cmp(prev, k, nil, nil), 0)
+				}
+				prev = common.Copy(k)
+				count++
+				return nil
+			}, TransformArgs{}))
+			assert.Equal(t, 10000, count)
+			collector.Close()
+		}
+	}
+}
+
+func TestLoadContext(t *testing.T) {
+	tmpdir := t.TempDir()
+	collector := NewCollector(t.Name(), tmpdir, NewSortableBuffer(16*datasize.KB))
+	for i := 0; i < 10000; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i)), nil))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	err := collector.LoadContext(ctx, nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		if count++; count == 5000 {
+			cancel()
+		}
+		return nil
+	}, TransformArgs{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, count, 5000+1024+1)
+	files, err := os.ReadDir(tmpdir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	collector = NewCollector(t.Name(), tmpdir, NewSortableBuffer(16*datasize.KB))
+	assert.NoError(t, collector.Collect([]byte("key"), nil))
+	assert.ErrorIs(t, collector.LoadContext(ctx, nil, "", IdentityLoadFunc, TransformArgs{}), context.Canceled)
+}
+
+func TestCollectorMetrics(t *testing.T) {
+	collector := NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(16*datasize.KB))
+	collector.SetMetricsLabel(t.Name())
+	for i := 0; i < 10000; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i)), nil))
+	}
+	var last LoadProgress
+	assert.NoError(t, collector.Load(nil, "", IdentityLoadFunc, TransformArgs{LoadProgress: func(p LoadProgress) { last = p }}))
+	assert.Equal(t, uint64(last.Runs), metrics.GetOrCreateCounter(fmt.Sprintf(`etl_flushes_total{name="%s"}`, t.Name())).Get())
+	assert.Equal(t, last.FlushedBytes, metrics.GetOrCreateCounter(fmt.Sprintf(`etl_spill_bytes_total{name="%s"}`, t.Name())).Get())
+	var out bytes.Buffer
+	metrics.WritePrometheus(&out, false)
+	assert.Contains(t, out.String(), fmt.Sprintf(`etl_load_seconds_count{name="%s"} 1`, t.Name()))
+	assert.Contains(t, out.String(), fmt.Sprintf(`etl_merge_fan_in_count{name="%s"} 1`, t.Name()))
+}
+
+func TestCollectorIterator(t *testing.T) {
+	for _, bufType := range []int{SortableSliceBuffer, SortableAppendBuffer} {
+		collectors := []*Collector{
+			NewCollector(t.Name(), t.TempDir(), getBufferByType(bufType, 16*datasize.KB)),
+			NewCollector(t.Name(), t.TempDir(), getBufferByType(bufType, 16*datasize.KB)),
+			NewParallelCollector(t.Name(), t.TempDir(), bufType, 16*datasize.KB, 4),
+		}
+		for _, collector := range collectors {
+			for i := 0; i < 20000; i++ {
+				assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %d", i*7919%5000)), []byte(fmt.Sprintf("%d", i))))
+			}
+		}
+		var loaded []string
+		assert.NoError(t, collectors[0].Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+			loaded = append(loaded, string(k)+"="+string(v))
+			return nil
+		}, TransformArgs{}))
+		for _, collector := range collectors[1:] {
+			it, err := collector.Iterator()
+			assert.NoError(t, err)
+			var iterated []string
+			for it.Next() {
+				iterated = append(iterated, string(it.Key())+"="+string(it.Value()))
+			}
+			assert.NoError(t, it.Err())
+			it.Close()
+			assert.Equal(t, loaded, iterated)
+		}
+	}
+}
+
+func TestCollectorManifest(t *testing.T) {
+	tmpdir := t.TempDir()
+	manifestFile := filepath.Join(t.TempDir(), "manifest")
+	c, err := NewCollectorFromManifest(t.Name(), manifestFile)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	collector := NewCollector(t.Name(), tmpdir, NewAppendBuffer(16*datasize.KB))
+	collector.SetManifest(manifestFile)
+	for i := 0; i < 10000; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key %05d", i%5000)), []byte{byte(i / 5000)}))
+	}
+	errCrash := errors.New("crash")
+	count := 0
+	assert.ErrorIs(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		if count++; count == 3000 {
+			return errCrash
+		}
+		return nil
+	}, TransformArgs{}), errCrash)
+	collector.Close()
+
+	collector, err = NewCollectorFromManifest(t.Name(), manifestFile)
+	assert.NoError(t, err)
+	var keys []string
+	values := map[string][]byte{} // values of key may be in several runs
+	assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		if len(keys) == 0 || keys[len(keys)-1] != string(k) {
+			keys = append(keys, string(k))
+		}
+		values[string(k)] = append(values[string(k)], v...)
+		return nil
+	}, TransformArgs{}))
+	assert.Equal(t, 5000, len(keys))
+	for i, k := range keys {
+		assert.Equal(t, fmt.Sprintf("key %05d", i), k)
+		assert.Equal(t, []byte{0, 1}, values[k])
+	}
+	_, err = os.Stat(manifestFile)
+	assert.True(t, os.IsNotExist(err))
+	files, err := os.ReadDir(tmpdir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+
+	// Runs which fit in RAM are flushed too
+	collector = NewCollector(t.Name(), tmpdir, NewSortableBuffer(16*datasize.KB))
+	collector.SetManifest(manifestFile)
+	assert.NoError(t, collector.Collect([]byte("key"), []byte("value")))
+	assert.Error(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error { return errCrash }, TransformArgs{}))
+	collector, err = NewCollectorFromManifest(t.Name(), manifestFile)
+	assert.NoError(t, err)
+	assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+		assert.Equal(t, "key", string(k))
+		assert.Equal(t, "value", string(v))
+		return nil
+	}, TransformArgs{}))
+}
+
+func TestTransformWithReduce(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	sourceBucket := kv.ChaindataTables[0]
+	destBucket := kv.ChaindataTables[1]
+	generateTestData(t, tx, sourceBucket, 100)
+	// Index of the last digit of key: 10 values of each digit, in the order of keys
+	err := TransformWithReduce(
+		"logPrefix",
+		tx,
+		sourceBucket,
+		destBucket,
+		t.TempDir(),
+		func(k, v []byte, next ExtractNextFunc) error {
+			return next(k, k[len(k)-1:], k[:10])
+		},
+		func(k []byte, values [][]byte, _ CurrentTableReader, next LoadNextFunc) error {
+			return next(k, k, bytes.Join(values, []byte(",")))
+		},
+		TransformArgs{BufferSize: 1},
+	)
+	assert.NoError(t, err)
+	for d := 0; d < 10; d++ {
+		v, err := tx.GetOne(destBucket, []byte{byte('0' + d)})
+		assert.NoError(t, err)
+		var want []string
+		for i := d; i < 100; i += 10 {
+			want = append(want, fmt.Sprintf("%10d", i))
+		}
+		assert.Equal(t, strings.Join(want, ","), string(v))
+	}
+}
+
+func TestSpillEncoders(t *testing.T) {
+	var sizes []uint64
+	for _, encoder := range []SpillEncoder{nil, VarintSpillEncoder{}, FixedKeySpillEncoder{KeySize: 8}} {
+		collector := NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(16*datasize.KB))
+		if encoder != nil {
+			collector.SetSpillEncoder(encoder)
+		}
+		for i := 0; i < 10000; i++ {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, uint64(i*7919%10000))
+			assert.NoError(t, collector.Collect(k, []byte(fmt.Sprintf("%d", i*7919%100))))
+		}
+		count := 0
+		var last LoadProgress
+		assert.NoError(t, collector.Load(nil, "", func(k, v []byte, _ CurrentTableReader, _ LoadNextFunc) error {
+			assert.Equal(t, uint64(count), binary.BigEndian.Uint64(k))
+			assert.Equal(t, fmt.Sprintf("%d", count%100), string(v))
+			count++
+			return nil
+		}, TransformArgs{LoadProgress: func(p LoadProgress) { last = p }}))
+		assert.Equal(t, 10000, count)
+		sizes = append(sizes, last.FlushedBytes)
+	}
+	assert.Equal(t, sizes[0], sizes[1])
+	assert.Equal(t, sizes[0]-10000, sizes[2])
+
+	collector := NewCollector(t.Name(), t.TempDir(), NewSortableBuffer(16*datasize.KB))
+	defer collector.Close()
+	collector.SetSpillEncoder(FixedKeySpillEncoder{KeySize: 8})
+	var err error
+	for i := 0; i < 10000 && err == nil; i++ {
+		err = collector.Collect([]byte("short"), nil)
+	}
+	assert.Error(t, err)
+}
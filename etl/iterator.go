@@ -0,0 +1,159 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// mergeIterator - k-way merge of sorted runs. SortableLatestAppearedBuffer has one entry per key in each run, entries of
+// the same key in different runs are merged here - as if it was one buffer. Other buffers pass entries of all runs
+type mergeIterator struct {
+	logPrefix  string
+	h          *Heap
+	providers  []dataProvider
+	dedup      bool     // Only the latest value of key is returned
+	element    HeapElem // Element returned by the last next, its provider is advanced by the next call
+	pending    bool
+	dedupKey   []byte
+	dedupValue []byte
+	processed  uint64 // Entries taken from providers
+}
+
+func newMergeIterator(logPrefix string, providers []dataProvider, bufType int, comparator kv.CmpFunc) *mergeIterator {
+	h := &Heap{comparator: comparator}
+	heap.Init(h)
+	for i, provider := range providers {
+		if key, value, err := provider.Next(nil, nil); err == nil {
+			he := HeapElem{key, i, value}
+			heap.Push(h, he)
+		} else /* we must have at least one entry per file */ {
+			eee := fmt.Errorf("%s: error reading first readers: n=%d current=%d provider=%s err=%w",
+				logPrefix, len(providers), i, provider, err)
+			panic(eee)
+		}
+	}
+	return &mergeIterator{
+		logPrefix: logPrefix,
+		h:         h,
+		providers: providers,
+		dedup:     bufType == SortableLatestAppearedBuffer,
+	}
+}
+
+func (it *mergeIterator) advance(element HeapElem) (err error) {
+	provider := it.providers[element.TimeIdx]
+	if element.Key, element.Value, err = provider.Next(element.Key[:0], element.Value[:0]); err == nil {
+		heap.Push(it.h, element)
+	} else if !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: error while reading next element from disk: %w", it.logPrefix, err)
+	}
+	return nil
+}
+
+// next returns the next entry, which is valid until the next call, ok is false at the end of runs
+func (it *mergeIterator) next() (k, v []byte, ok bool, err error) {
+	if it.pending {
+		it.pending = false
+		if err = it.advance(it.element); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if it.h.Len() == 0 {
+		return nil, nil, false, nil
+	}
+	element := (heap.Pop(it.h)).(HeapElem)
+	it.processed++
+	if !it.dedup {
+		it.element, it.pending = element, true
+		return element.Key, element.Value, true, nil
+	}
+	it.dedupKey = append(it.dedupKey[:0], element.Key...)
+	it.dedupValue = append(it.dedupValue[:0], element.Value...)
+	for {
+		if err = it.advance(element); err != nil {
+			return nil, nil, false, err
+		}
+		if it.h.Len() == 0 || !bytes.Equal(it.h.elems[0].Key, it.dedupKey) {
+			break
+		}
+		element = (heap.Pop(it.h)).(HeapElem)
+		it.processed++
+		it.dedupValue = append(it.dedupValue[:0], element.Value...)
+	}
+	return it.dedupKey, it.dedupValue, true, nil
+}
+
+// Iterator iterates entries of collector in the order of Load, without loading them into a table
+type Iterator struct {
+	c          *Collector
+	it         *mergeIterator
+	stop       func()
+	runs       int
+	start      time.Time
+	key, value []byte
+	err        error
+}
+
+// Iterator flushes the buffer and returns iterator of merged sorted runs of collector - the same entries, which Load
+// passes to loadFunc. Close of the iterator closes the collector, as Load does (not critical collector)
+func (c *Collector) Iterator() (*Iterator, error) {
+	providers, stats, stop, err := c.prepareLoad(c.comparator)
+	if err != nil {
+		if c.autoClean {
+			c.Close()
+		}
+		return nil, err
+	}
+	return &Iterator{c: c, it: newMergeIterator(c.logPrefix, providers, c.bufType, c.comparator), stop: stop, runs: stats.runs, start: time.Now()}, nil
+}
+
+// Next moves to the next entry, returns false at the end or on error (see Err)
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	var ok bool
+	it.key, it.value, ok, it.err = it.it.next()
+	return ok
+}
+
+// Key of the current entry, valid until the next call of Next
+func (it *Iterator) Key() []byte { return it.key }
+
+// Value of the current entry, valid until the next call of Next
+func (it *Iterator) Value() []byte { return it.value }
+
+func (it *Iterator) Err() error { return it.err }
+
+func (it *Iterator) Close() {
+	if it.stop != nil {
+		it.stop()
+		it.stop = nil
+		it.c.metrics.loaded(it.runs, it.start)
+		if it.c.autoClean {
+			it.c.Close()
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+const manifestVersion = 1
+
+// manifest - runs of collector written before Load, see Collector.SetManifest
+type manifest struct {
+	Version int      `json:"version"`
+	BufType int      `json:"bufType"`
+	Files   []string `json:"files"`
+}
+
+// SetManifest makes Load resumable after crash: before the merge all runs are flushed to temp files, which are fsynced
+// and listed in manifestFile. If Load fails, the files and the manifest are kept for NewCollectorFromManifest, they are
+// removed by successful Load or by Close. Must be called before Load
+func (c *Collector) SetManifest(manifestFile string) { c.manifest = manifestFile }
+
+// NewCollectorFromManifest creates collector from runs listed in manifestFile by Collector.SetManifest, ready for Load.
+// Returns nil if there is no manifest - collection has to be done from the beginning
+func NewCollectorFromManifest(logPrefix, manifestFile string) (*Collector, error) {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("collector from manifest - reading %s: %w", manifestFile, err)
+	}
+	var m manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("collector from manifest - parsing %s: %w", manifestFile, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("collector from manifest %s: unsupported version %d", manifestFile, m.Version)
+	}
+	if m.BufType < SortableSliceBuffer || m.BufType > SortableLatestAppearedBuffer {
+		return nil, fmt.Errorf("collector from manifest %s: unknown buffer type %d", manifestFile, m.BufType)
+	}
+	c := &Collector{allFlushed: true, autoClean: true, bufType: m.BufType, logPrefix: logPrefix, logLvl: log.LvlInfo, manifest: manifestFile}
+	for _, name := range m.Files {
+		file, err := os.Open(name)
+		if err != nil {
+			c.closeFiles()
+			return nil, fmt.Errorf("collector from manifest - opening file %s: %w", name, err)
+		}
+		c.dataProviders = append(c.dataProviders, &fileDataProvider{file: file})
+	}
+	return c, nil
+}
+
+// writeManifest fsyncs runs of collector and lists them in the manifest, all runs must be in files
+func (c *Collector) writeManifest() error {
+	if c.encoder != nil {
+		return fmt.Errorf("manifest: files of collector with spill encoder can't be loaded from manifest")
+	}
+	m := manifest{Version: manifestVersion, BufType: c.bufType}
+	for _, p := range c.dataProviders {
+		fp, ok := p.(*fileDataProvider)
+		if !ok {
+			return fmt.Errorf("manifest: unexpected data provider %s", p)
+		}
+		if err := fp.file.Sync(); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, fp.file.Name())
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpFile := c.manifest + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("create manifest %s: %w", c.manifest, err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		return fmt.Errorf("write manifest %s: %w", c.manifest, err)
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, c.manifest)
+}
+
+// closeFiles closes files of runs without removing them - they are still needed for next attempt
+func (c *Collector) closeFiles() {
+	for _, p := range c.dataProviders {
+		if fp, ok := p.(*fileDataProvider); ok {
+			_ = fp.file.Close()
+		}
+	}
+	c.dataProviders = nil
+}
@@ -0,0 +1,63 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// collectorMetrics - metrics of collectors with the same label, see Collector.SetMetricsLabel
+type collectorMetrics struct {
+	flushes      *metrics.Counter   // Buffers flushed to temp files
+	spillBytes   *metrics.Counter   // Size of temp files
+	loadDuration *metrics.Summary   // Duration of Load, in seconds
+	mergeFanIn   *metrics.Histogram // Number of runs merged by Load
+}
+
+// SetMetricsLabel makes collector export its metrics with label name=label: etl_flushes_total, etl_spill_bytes_total,
+// etl_load_seconds and etl_merge_fan_in. Collectors with the same label (e.g. the same stage) add up to the same metrics
+func (c *Collector) SetMetricsLabel(label string) {
+	c.metrics = &collectorMetrics{
+		flushes:      metrics.GetOrCreateCounter(fmt.Sprintf(`etl_flushes_total{name="%s"}`, label)),
+		spillBytes:   metrics.GetOrCreateCounter(fmt.Sprintf(`etl_spill_bytes_total{name="%s"}`, label)),
+		loadDuration: metrics.GetOrCreateSummary(fmt.Sprintf(`etl_load_seconds{name="%s"}`, label)),
+		mergeFanIn:   metrics.GetOrCreateHistogram(fmt.Sprintf(`etl_merge_fan_in{name="%s"}`, label)),
+	}
+}
+
+func (m *collectorMetrics) flushed(provider dataProvider) {
+	if m == nil {
+		return
+	}
+	m.flushes.Inc()
+	if p, ok := provider.(*fileDataProvider); ok {
+		if info, err := p.file.Stat(); err == nil {
+			m.spillBytes.Add(int(info.Size()))
+		}
+	}
+}
+
+func (m *collectorMetrics) loaded(runs int, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.mergeFanIn.Update(float64(runs))
+	m.loadDuration.UpdateDuration(start)
+}
@@ -0,0 +1,221 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// flushTask - buffer sorted and flushed to disk in background goroutine
+type flushTask struct {
+	provider dataProvider
+	err      error
+	done     chan struct{}
+}
+
+// NewParallelCollector creates collector which sorts and flushes filled buffers in background goroutines, while the
+// next buffer is collected: up to workers buffers are sorted at the same time. Load merges flushed files in up to
+// workers goroutines. Takes up to workers+1 buffers of bufferSize of RAM
+func NewParallelCollector(logPrefix, tmpdir string, bufType int, bufferSize datasize.ByteSize, workers int) *Collector {
+	if workers < 1 {
+		workers = 1
+	}
+	c := &Collector{autoClean: true, bufType: bufType, logPrefix: logPrefix, logLvl: log.LvlInfo, mergeWorkers: workers}
+	buf := getBufferByType(bufType, bufferSize)
+	buffers := 1
+	free := make(chan Buffer, workers+1)
+
+	c.flushBuffer = func(_ []byte, canStoreInRam bool) error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		if canStoreInRam && len(c.dataProviders) == 0 && len(c.flushes) == 0 {
+			if c.comparator != nil {
+				buf.SetComparator(c.comparator)
+			}
+			buf.Sort()
+			c.dataProviders = append(c.dataProviders, KeepInRAM(buf))
+			c.allFlushed = true
+			return nil
+		}
+		task := &flushTask{done: make(chan struct{})}
+		c.flushes = append(c.flushes, task)
+		doFsync, lvl, compression, comparator, metrics, encoder := !c.autoClean, c.logLvl, c.compression, c.comparator, c.metrics, c.encoder
+		go func(b Buffer) {
+			defer close(task.done)
+			if comparator != nil {
+				b.SetComparator(comparator)
+			}
+			b.Sort()
+			if task.provider, task.err = flushToDisk(b, tmpdir, doFsync, lvl, compression, encoder); task.err == nil {
+				metrics.flushed(task.provider)
+			}
+			free <- b
+		}(buf)
+		if buffers <= workers {
+			buf = getBufferByType(bufType, bufferSize)
+			buffers++
+		} else {
+			buf = <-free
+		}
+		return nil
+	}
+
+	c.extractNextFunc = func(_, k, v []byte) error {
+		buf.Put(k, v)
+		if buf.CheckFlushSize() || c.overBudget(buf.Size()) {
+			if err := c.flushBuffer(nil, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c
+}
+
+// waitFlushes waits for background flushes and adds their files to data providers, in the order of flushes
+func (c *Collector) waitFlushes() error {
+	var err error
+	for _, task := range c.flushes {
+		<-task.done
+		if task.err != nil {
+			if err == nil {
+				err = task.err
+			}
+			continue
+		}
+		if task.provider != nil {
+			c.dataProviders = append(c.dataProviders, task.provider)
+		}
+	}
+	c.flushes = nil
+	return err
+}
+
+const mergeBatchSize = 1024
+
+// mergedBatch - entries merged by mergeGroup, keys and values are parts of data
+type mergedBatch struct {
+	data []byte
+	ends []int // End of key and end of value of each entry in data
+	err  error
+}
+
+// mergedDataProvider - sorted run merged from a group of providers in background goroutine
+type mergedDataProvider struct {
+	batches <-chan *mergedBatch
+	batch   *mergedBatch
+	i       int
+	pos     int
+}
+
+func (p *mergedDataProvider) Next(keyBuf, valBuf []byte) ([]byte, []byte, error) {
+	for p.batch == nil || p.i == len(p.batch.ends) {
+		if p.batch != nil && p.batch.err != nil {
+			return nil, nil, p.batch.err
+		}
+		batch, ok := <-p.batches
+		if !ok {
+			return nil, nil, io.EOF
+		}
+		p.batch, p.i, p.pos = batch, 0, 0
+	}
+	keyEnd, valEnd := p.batch.ends[p.i], p.batch.ends[p.i+1]
+	keyBuf = append(keyBuf, p.batch.data[p.pos:keyEnd]...)
+	valBuf = append(valBuf, p.batch.data[keyEnd:valEnd]...)
+	p.i += 2
+	p.pos = valEnd
+	return keyBuf, valBuf, nil
+}
+
+// Dispose does nothing: files of merged providers are disposed by collector
+func (p *mergedDataProvider) Dispose() uint64 { return 0 }
+
+// mergeConcurrently splits providers into contiguous groups, and merges every group in its own goroutine. Groups are
+// contiguous, so that entries with equal keys keep the order of flushes. stop must be called after loading
+func mergeConcurrently(providers []dataProvider, groups int, comparator kv.CmpFunc) (merged []dataProvider, stop func()) {
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	merged = make([]dataProvider, groups)
+	for g := 0; g < groups; g++ {
+		batches := make(chan *mergedBatch, 4)
+		merged[g] = &mergedDataProvider{batches: batches}
+		wg.Add(1)
+		go func(group []dataProvider) {
+			defer wg.Done()
+			mergeGroup(group, comparator, batches, quit)
+		}(providers[g*len(providers)/groups : (g+1)*len(providers)/groups])
+	}
+	return merged, func() {
+		close(quit)
+		wg.Wait()
+	}
+}
+
+func mergeGroup(providers []dataProvider, comparator kv.CmpFunc, out chan<- *mergedBatch, quit <-chan struct{}) {
+	defer close(out)
+	send := func(batch *mergedBatch) bool {
+		select {
+		case out <- batch:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+	h := &Heap{comparator: comparator}
+	for i, provider := range providers {
+		key, value, err := provider.Next(nil, nil)
+		if err == nil {
+			heap.Push(h, HeapElem{key, i, value})
+		} else if !errors.Is(err, io.EOF) {
+			send(&mergedBatch{err: err})
+			return
+		}
+	}
+	batch := &mergedBatch{}
+	for h.Len() > 0 {
+		element := (heap.Pop(h)).(HeapElem)
+		batch.data = append(batch.data, element.Key...)
+		batch.ends = append(batch.ends, len(batch.data))
+		batch.data = append(batch.data, element.Value...)
+		batch.ends = append(batch.ends, len(batch.data))
+		var err error
+		if element.Key, element.Value, err = providers[element.TimeIdx].Next(element.Key[:0], element.Value[:0]); err == nil {
+			heap.Push(h, element)
+		} else if !errors.Is(err, io.EOF) {
+			batch.err = err
+			send(batch)
+			return
+		}
+		if len(batch.ends) == 2*mergeBatchSize {
+			if !send(batch) {
+				return
+			}
+			batch = &mergedBatch{}
+		}
+	}
+	if len(batch.ends) > 0 {
+		send(batch)
+	}
+}
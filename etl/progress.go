@@ -16,9 +16,76 @@
 
 package etl
 
+import (
+	"fmt"
+	"time"
+)
+
 func ProgressFromKey(k []byte) int {
 	if len(k) < 1 {
 		return 0
 	}
 	return int(float64(k[0]>>4) * 3.3)
 }
+
+// LoadProgress - state of Collector.Load, reported to TransformArgs.LoadProgress
+type LoadProgress struct {
+	Processed    uint64        // Entries loaded so far
+	Total        uint64        // Entries in all runs, 0 if unknown (collector is created from files of other process)
+	Runs         int           // Number of sorted runs (flushed buffers) which are merged
+	FlushedBytes uint64        // Size of temp files of runs
+	Elapsed      time.Duration // Time since the beginning of Load
+	ETA          time.Duration // Estimated time until the end of Load, 0 if unknown
+}
+
+const defaultLoadProgressEvery = 30 * time.Second
+
+// loadStats - what is known about runs before Load
+type loadStats struct {
+	total        uint64
+	runs         int
+	flushedBytes uint64
+}
+
+func newLoadStats(providers []dataProvider) loadStats {
+	stats := loadStats{runs: len(providers)}
+	known := true
+	for _, p := range providers {
+		switch p := p.(type) {
+		case *fileDataProvider:
+			if info, err := p.file.Stat(); err == nil {
+				stats.flushedBytes += uint64(info.Size())
+			}
+			stats.total += p.count
+			known = known && p.count > 0
+		case *memoryDataProvider:
+			stats.total += uint64(p.buffer.Len())
+		default:
+			known = false
+		}
+	}
+	if !known {
+		stats.total = 0
+	}
+	return stats
+}
+
+func (s loadStats) progress(processed uint64, start time.Time) LoadProgress {
+	p := LoadProgress{Processed: processed, Total: s.total, Runs: s.runs, FlushedBytes: s.flushedBytes, Elapsed: time.Since(start)}
+	if processed > 0 && s.total > processed {
+		p.ETA = time.Duration(float64(p.Elapsed) * float64(s.total-processed) / float64(processed))
+	}
+	return p
+}
+
+// logArgs returns arguments for log of Load
+func (p LoadProgress) logArgs() []interface{} {
+	args := []interface{}{"processed", p.Processed, "runs", p.Runs}
+	if p.Total > 0 {
+		args = append(args, "progress", fmt.Sprintf("%.2f%%", 100*float64(p.Processed)/float64(p.Total)))
+		if p.ETA > 0 {
+			args = append(args, "eta", p.ETA.Round(time.Second))
+		}
+	}
+	return args
+}
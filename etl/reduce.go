@@ -0,0 +1,64 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// ReduceFunc is called by Collector.LoadReduce with key and all its values, in the order of collection.
+// Key and values are valid only during the call
+type ReduceFunc func(k []byte, values [][]byte, table CurrentTableReader, next LoadNextFunc) error
+
+type loadFinishFunc func(table CurrentTableReader, next LoadNextFunc) error
+
+// LoadReduce is Load which groups values of each key during the merge and passes them to reduceFunc, instead of
+// passing entries one by one. Buffer of collector has to keep all values (SortableSliceBuffer), buffers with
+// deduplication pass one value of key per run (SortableLatestAppearedBuffer - one value)
+func (c *Collector) LoadReduce(db kv.RwTx, toBucket string, reduceFunc ReduceFunc, args TransformArgs) error {
+	var key, data []byte
+	var ends []int // End of each value in data
+	var values [][]byte
+	reduce := func(table CurrentTableReader, next LoadNextFunc) error {
+		if len(ends) == 0 {
+			return nil
+		}
+		values = values[:0]
+		start := 0
+		for _, end := range ends {
+			values = append(values, data[start:end])
+			start = end
+		}
+		data, ends = data[:0], ends[:0]
+		return reduceFunc(key, values, table, next)
+	}
+	loadFunc := func(k, v []byte, table CurrentTableReader, next LoadNextFunc) error {
+		if len(ends) > 0 && !bytes.Equal(k, key) {
+			if err := reduce(table, next); err != nil {
+				return err
+			}
+		}
+		key = append(key[:0], k...)
+		data = append(data, v...)
+		ends = append(ends, len(data))
+		return nil
+	}
+	return c.load(context.Background(), db, toBucket, loadFunc, reduce, args)
+}
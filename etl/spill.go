@@ -0,0 +1,120 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SpillEncoder defines format of entries in temp files of collector, see Collector.SetSpillEncoder
+type SpillEncoder interface {
+	// Encode writes entry to w
+	Encode(w io.Writer, k, v []byte) error
+	// Decode reads entry written by Encode from r and appends key and value to keyBuf and valBuf,
+	// returns io.EOF at the end of file
+	Decode(r *bufio.Reader, keyBuf, valBuf []byte) ([]byte, []byte, error)
+}
+
+// VarintSpillEncoder - default format: varint of length before key and before value
+type VarintSpillEncoder struct{}
+
+func (VarintSpillEncoder) Encode(w io.Writer, k, v []byte) error {
+	if err := writeVarintBytes(w, k); err != nil {
+		return err
+	}
+	return writeVarintBytes(w, v)
+}
+
+func (VarintSpillEncoder) Decode(r *bufio.Reader, keyBuf, valBuf []byte) ([]byte, []byte, error) {
+	return readElementFromDisk(r, r, keyBuf, valBuf)
+}
+
+// FixedKeySpillEncoder - format for keys of the same size: key without length, varint of length before value
+type FixedKeySpillEncoder struct {
+	KeySize int
+}
+
+func (e FixedKeySpillEncoder) Encode(w io.Writer, k, v []byte) error {
+	if len(k) != e.KeySize {
+		return fmt.Errorf("key %x of size %d, expected %d", k, len(k), e.KeySize)
+	}
+	if _, err := w.Write(k); err != nil {
+		return err
+	}
+	return writeVarintBytes(w, v)
+}
+
+func (e FixedKeySpillEncoder) Decode(r *bufio.Reader, keyBuf, valBuf []byte) ([]byte, []byte, error) {
+	var err error
+	if keyBuf, err = readAppend(r, keyBuf, e.KeySize); err != nil {
+		return nil, nil, err // io.EOF if there are no more entries
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if valBuf, err = readAppend(r, valBuf, int(n)); err != nil {
+		return nil, nil, err
+	}
+	return keyBuf, valBuf, nil
+}
+
+func writeVarintBytes(w io.Writer, b []byte) error {
+	var numBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(numBuf[:], uint64(len(b)))
+	if _, err := w.Write(numBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readAppend appends n bytes from r to buf
+func readAppend(r io.Reader, buf []byte, n int) ([]byte, error) {
+	l := len(buf)
+	if l+n > cap(buf) {
+		newBuf := make([]byte, l+n)
+		copy(newBuf, buf)
+		buf = newBuf
+	} else {
+		buf = buf[:l+n]
+	}
+	if _, err := io.ReadFull(r, buf[l:]); err != nil {
+		return buf[:l], err
+	}
+	return buf, nil
+}
+
+// writeEntries writes entries of buffer by encoder
+func writeEntries(b Buffer, w io.Writer, encoder SpillEncoder) error {
+	var k, v []byte
+	for i := 0; i < b.Len(); i++ {
+		k, v = b.Get(i, k[:0], v[:0])
+		if err := encoder.Encode(w, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSpillEncoder sets format of entries in temp files, instead of default VarintSpillEncoder. Must be called before
+// Collect. Format is not detected when files are read: they can't be loaded by NewCollectorFromFiles,
+// NewCollectorFromCheckpoint or NewCollectorFromManifest
+func (c *Collector) SetSpillEncoder(encoder SpillEncoder) { c.encoder = encoder }
@@ -89,6 +89,22 @@ func NewServer(rateLimit uint32, creds credentials.TransportCredentials) *grpc.S
 	return grpcServer
 }
 
+// BearerToken - per-RPC credentials of client: sends "authorization: Bearer <token>" in metadata of every call.
+// Use it by grpc.WithPerRPCCredentials. insecure=true allows to send token without TLS - only for local connections
+func BearerToken(token string, insecure bool) credentials.PerRPCCredentials {
+	return bearerToken{token: token, insecure: insecure}
+}
+
+type bearerToken struct {
+	token    string
+	insecure bool
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+func (t bearerToken) RequireTransportSecurity() bool { return !t.insecure }
+
 func Connect(creds credentials.TransportCredentials, dialAddress string) (*grpc.ClientConn, error) {
 	var dialOpts []grpc.DialOption
 
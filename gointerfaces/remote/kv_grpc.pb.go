@@ -33,6 +33,15 @@ type KVClient interface {
 	// Then only client can initiate messages from server
 	Tx(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error)
 	StateChanges(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error)
+	// Range - returns all pairs of table in range [fromPrefix, toPrefix) by batches.
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	Range(ctx context.Context, in *RangeReq, opts ...grpc.CallOption) (KV_RangeClient, error)
+	// TableStats - size statistics of table (entries count, pages count, bytes).
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	TableStats(ctx context.Context, in *TableStatsReq, opts ...grpc.CallOption) (*TableStatsReply, error)
+	// GetMany - values of many keys of table by 1 round-trip.
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	GetMany(ctx context.Context, in *GetManyReq, opts ...grpc.CallOption) (*GetManyReply, error)
 }
 
 type kVClient struct {
@@ -115,6 +124,56 @@ func (x *kVStateChangesClient) Recv() (*StateChangeBatch, error) {
 	return m, nil
 }
 
+func (c *kVClient) Range(ctx context.Context, in *RangeReq, opts ...grpc.CallOption) (KV_RangeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KV_ServiceDesc.Streams[2], "/remote.KV/Range", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KV_RangeClient interface {
+	Recv() (*Pairs, error)
+	grpc.ClientStream
+}
+
+type kVRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVRangeClient) Recv() (*Pairs, error) {
+	m := new(Pairs)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVClient) TableStats(ctx context.Context, in *TableStatsReq, opts ...grpc.CallOption) (*TableStatsReply, error) {
+	out := new(TableStatsReply)
+	err := c.cc.Invoke(ctx, "/remote.KV/TableStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) GetMany(ctx context.Context, in *GetManyReq, opts ...grpc.CallOption) (*GetManyReply, error) {
+	out := new(GetManyReply)
+	err := c.cc.Invoke(ctx, "/remote.KV/GetMany", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KVServer is the server API for KV service.
 // All implementations must embed UnimplementedKVServer
 // for forward compatibility
@@ -128,6 +187,15 @@ type KVServer interface {
 	// Then only client can initiate messages from server
 	Tx(KV_TxServer) error
 	StateChanges(*StateChangeRequest, KV_StateChangesServer) error
+	// Range - returns all pairs of table in range [fromPrefix, toPrefix) by batches.
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	Range(*RangeReq, KV_RangeServer) error
+	// TableStats - size statistics of table (entries count, pages count, bytes).
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	TableStats(context.Context, *TableStatsReq) (*TableStatsReply, error)
+	// GetMany - values of many keys of table by 1 round-trip.
+	// If txID != 0 - reads from snapshot of Tx with this txID (if it's still open on server), otherwise opens new read transaction
+	GetMany(context.Context, *GetManyReq) (*GetManyReply, error)
 	mustEmbedUnimplementedKVServer()
 }
 
@@ -144,6 +212,15 @@ func (UnimplementedKVServer) Tx(KV_TxServer) error {
 func (UnimplementedKVServer) StateChanges(*StateChangeRequest, KV_StateChangesServer) error {
 	return status.Errorf(codes.Unimplemented, "method StateChanges not implemented")
 }
+func (UnimplementedKVServer) Range(*RangeReq, KV_RangeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Range not implemented")
+}
+func (UnimplementedKVServer) TableStats(context.Context, *TableStatsReq) (*TableStatsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TableStats not implemented")
+}
+func (UnimplementedKVServer) GetMany(context.Context, *GetManyReq) (*GetManyReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMany not implemented")
+}
 func (UnimplementedKVServer) mustEmbedUnimplementedKVServer() {}
 
 // UnsafeKVServer may be embedded to opt out of forward compatibility for this service.
@@ -222,6 +299,63 @@ func (x *kVStateChangesServer) Send(m *StateChangeBatch) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _KV_Range_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RangeReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVServer).Range(m, &kVRangeServer{stream})
+}
+
+type KV_RangeServer interface {
+	Send(*Pairs) error
+	grpc.ServerStream
+}
+
+type kVRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVRangeServer) Send(m *Pairs) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KV_TableStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableStatsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).TableStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/TableStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).TableStats(ctx, req.(*TableStatsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_GetMany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).GetMany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/GetMany",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).GetMany(ctx, req.(*GetManyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // KV_ServiceDesc is the grpc.ServiceDesc for KV service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -233,6 +367,14 @@ var KV_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Version",
 			Handler:    _KV_Version_Handler,
 		},
+		{
+			MethodName: "TableStats",
+			Handler:    _KV_TableStats_Handler,
+		},
+		{
+			MethodName: "GetMany",
+			Handler:    _KV_GetMany_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -246,6 +388,11 @@ var KV_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _KV_StateChanges_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Range",
+			Handler:       _KV_Range_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "remote/kv.proto",
 }
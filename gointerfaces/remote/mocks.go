@@ -22,9 +22,18 @@ var _ KVClient = &KVClientMock{}
 //
 // 		// make and configure a mocked KVClient
 // 		mockedKVClient := &KVClientMock{
+// 			GetManyFunc: func(ctx context.Context, in *GetManyReq, opts ...grpc.CallOption) (*GetManyReply, error) {
+// 				panic("mock out the GetMany method")
+// 			},
+// 			RangeFunc: func(ctx context.Context, in *RangeReq, opts ...grpc.CallOption) (KV_RangeClient, error) {
+// 				panic("mock out the Range method")
+// 			},
 // 			StateChangesFunc: func(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error) {
 // 				panic("mock out the StateChanges method")
 // 			},
+// 			TableStatsFunc: func(ctx context.Context, in *TableStatsReq, opts ...grpc.CallOption) (*TableStatsReply, error) {
+// 				panic("mock out the TableStats method")
+// 			},
 // 			TxFunc: func(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error) {
 // 				panic("mock out the Tx method")
 // 			},
@@ -38,9 +47,18 @@ var _ KVClient = &KVClientMock{}
 //
 // 	}
 type KVClientMock struct {
+	// GetManyFunc mocks the GetMany method.
+	GetManyFunc func(ctx context.Context, in *GetManyReq, opts ...grpc.CallOption) (*GetManyReply, error)
+
+	// RangeFunc mocks the Range method.
+	RangeFunc func(ctx context.Context, in *RangeReq, opts ...grpc.CallOption) (KV_RangeClient, error)
+
 	// StateChangesFunc mocks the StateChanges method.
 	StateChangesFunc func(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error)
 
+	// TableStatsFunc mocks the TableStats method.
+	TableStatsFunc func(ctx context.Context, in *TableStatsReq, opts ...grpc.CallOption) (*TableStatsReply, error)
+
 	// TxFunc mocks the Tx method.
 	TxFunc func(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error)
 
@@ -49,6 +67,24 @@ type KVClientMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// GetMany holds details about calls to the GetMany method.
+		GetMany []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *GetManyReq
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
+		// Range holds details about calls to the Range method.
+		Range []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *RangeReq
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 		// StateChanges holds details about calls to the StateChanges method.
 		StateChanges []struct {
 			// Ctx is the ctx argument value.
@@ -58,6 +94,15 @@ type KVClientMock struct {
 			// Opts is the opts argument value.
 			Opts []grpc.CallOption
 		}
+		// TableStats holds details about calls to the TableStats method.
+		TableStats []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *TableStatsReq
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 		// Tx holds details about calls to the Tx method.
 		Tx []struct {
 			// Ctx is the ctx argument value.
@@ -75,11 +120,100 @@ type KVClientMock struct {
 			Opts []grpc.CallOption
 		}
 	}
+	lockGetMany      sync.RWMutex
+	lockRange        sync.RWMutex
 	lockStateChanges sync.RWMutex
+	lockTableStats   sync.RWMutex
 	lockTx           sync.RWMutex
 	lockVersion      sync.RWMutex
 }
 
+// GetMany calls GetManyFunc.
+func (mock *KVClientMock) GetMany(ctx context.Context, in *GetManyReq, opts ...grpc.CallOption) (*GetManyReply, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *GetManyReq
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockGetMany.Lock()
+	mock.calls.GetMany = append(mock.calls.GetMany, callInfo)
+	mock.lockGetMany.Unlock()
+	if mock.GetManyFunc == nil {
+		var (
+			getManyReplyOut *GetManyReply
+			errOut          error
+		)
+		return getManyReplyOut, errOut
+	}
+	return mock.GetManyFunc(ctx, in, opts...)
+}
+
+// GetManyCalls gets all the calls that were made to GetMany.
+// Check the length with:
+//     len(mockedKVClient.GetManyCalls())
+func (mock *KVClientMock) GetManyCalls() []struct {
+	Ctx  context.Context
+	In   *GetManyReq
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *GetManyReq
+		Opts []grpc.CallOption
+	}
+	mock.lockGetMany.RLock()
+	calls = mock.calls.GetMany
+	mock.lockGetMany.RUnlock()
+	return calls
+}
+
+// Range calls RangeFunc.
+func (mock *KVClientMock) Range(ctx context.Context, in *RangeReq, opts ...grpc.CallOption) (KV_RangeClient, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *RangeReq
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockRange.Lock()
+	mock.calls.Range = append(mock.calls.Range, callInfo)
+	mock.lockRange.Unlock()
+	if mock.RangeFunc == nil {
+		var (
+			kV_RangeClientOut KV_RangeClient
+			errOut            error
+		)
+		return kV_RangeClientOut, errOut
+	}
+	return mock.RangeFunc(ctx, in, opts...)
+}
+
+// RangeCalls gets all the calls that were made to Range.
+// Check the length with:
+//     len(mockedKVClient.RangeCalls())
+func (mock *KVClientMock) RangeCalls() []struct {
+	Ctx  context.Context
+	In   *RangeReq
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *RangeReq
+		Opts []grpc.CallOption
+	}
+	mock.lockRange.RLock()
+	calls = mock.calls.Range
+	mock.lockRange.RUnlock()
+	return calls
+}
+
 // StateChanges calls StateChangesFunc.
 func (mock *KVClientMock) StateChanges(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error) {
 	callInfo := struct {
@@ -123,6 +257,49 @@ func (mock *KVClientMock) StateChangesCalls() []struct {
 	return calls
 }
 
+// TableStats calls TableStatsFunc.
+func (mock *KVClientMock) TableStats(ctx context.Context, in *TableStatsReq, opts ...grpc.CallOption) (*TableStatsReply, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *TableStatsReq
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockTableStats.Lock()
+	mock.calls.TableStats = append(mock.calls.TableStats, callInfo)
+	mock.lockTableStats.Unlock()
+	if mock.TableStatsFunc == nil {
+		var (
+			tableStatsReplyOut *TableStatsReply
+			errOut             error
+		)
+		return tableStatsReplyOut, errOut
+	}
+	return mock.TableStatsFunc(ctx, in, opts...)
+}
+
+// TableStatsCalls gets all the calls that were made to TableStats.
+// Check the length with:
+//     len(mockedKVClient.TableStatsCalls())
+func (mock *KVClientMock) TableStatsCalls() []struct {
+	Ctx  context.Context
+	In   *TableStatsReq
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *TableStatsReq
+		Opts []grpc.CallOption
+	}
+	mock.lockTableStats.RLock()
+	calls = mock.calls.TableStats
+	mock.lockTableStats.RUnlock()
+	return calls
+}
+
 // Tx calls TxFunc.
 func (mock *KVClientMock) Tx(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error) {
 	callInfo := struct {
@@ -0,0 +1,68 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remote
+
+import (
+	"fmt"
+)
+
+// CompressKeys - replaces Keys by suffixes after common prefix with previous key. prev - key before Keys[0], can be nil
+func (x *Pairs) CompressKeys(prev []byte) {
+	x.PrefixLens = make([]uint32, len(x.Keys))
+	for i, k := range x.Keys {
+		n := commonPrefixLen(prev, k)
+		x.PrefixLens[i] = uint32(n)
+		x.Keys[i] = k[n:]
+		prev = k
+	}
+}
+
+// DecompressKeys - opposite of CompressKeys. Does nothing if keys are not compressed (for example by old server)
+func (x *Pairs) DecompressKeys(prev []byte) error {
+	if len(x.PrefixLens) == 0 {
+		return nil
+	}
+	if len(x.PrefixLens) != len(x.Keys) {
+		return fmt.Errorf("compressed pairs: %d prefixes for %d keys", len(x.PrefixLens), len(x.Keys))
+	}
+	for i, suffix := range x.Keys {
+		n := int(x.PrefixLens[i])
+		if n > len(prev) {
+			return fmt.Errorf("compressed pairs: prefix %d is longer than previous key %x", n, prev)
+		}
+		k := make([]byte, n+len(suffix))
+		copy(k, prev[:n])
+		copy(k[n:], suffix)
+		x.Keys[i] = k
+		prev = k
+	}
+	x.PrefixLens = nil
+	return nil
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
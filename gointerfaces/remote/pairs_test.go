@@ -0,0 +1,26 @@
+package remote_test
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairsCompression(t *testing.T) {
+	keys := [][]byte{[]byte("account1"), []byte("account1storage1"), []byte("account1storage2"), []byte("account2"), {}, []byte("b")}
+	pairs := &remote.Pairs{Keys: append([][]byte{}, keys...)}
+	pairs.CompressKeys([]byte("acc"))
+	require.Equal(t, []uint32{3, 8, 15, 7, 0, 0}, pairs.PrefixLens)
+	require.Equal(t, []byte("ount1"), pairs.Keys[0])
+	require.Equal(t, []byte("2"), pairs.Keys[2])
+
+	require.NoError(t, pairs.DecompressKeys([]byte("acc")))
+	require.Equal(t, keys, pairs.Keys)
+	require.Nil(t, pairs.PrefixLens)
+	require.NoError(t, pairs.DecompressKeys(nil)) // not compressed - nothing to do
+	require.Equal(t, keys, pairs.Keys)
+
+	pairs.CompressKeys([]byte("acc"))
+	require.Error(t, pairs.DecompressKeys(nil), "wrong previous key")
+}
@@ -80,6 +80,64 @@ func (ImportResult) EnumDescriptor() ([]byte, []int) {
 	return file_txpool_txpool_proto_rawDescGZIP(), []int{0}
 }
 
+type OnEventsReply_EventType int32
+
+const (
+	OnEventsReply_PENDING  OnEventsReply_EventType = 0 // Transaction entered pending sub-pool
+	OnEventsReply_BASE_FEE OnEventsReply_EventType = 1 // Transaction entered baseFee sub-pool
+	OnEventsReply_QUEUED   OnEventsReply_EventType = 2 // Transaction entered queued sub-pool
+	OnEventsReply_REPLACED OnEventsReply_EventType = 3 // Transaction was replaced by transaction with the same nonce - replacedBy
+	OnEventsReply_MINED    OnEventsReply_EventType = 4 // Transaction was included into block
+	OnEventsReply_DROPPED  OnEventsReply_EventType = 5 // Transaction was discarded by pool - reason
+)
+
+// Enum value maps for OnEventsReply_EventType.
+var (
+	OnEventsReply_EventType_name = map[int32]string{
+		0: "PENDING",
+		1: "BASE_FEE",
+		2: "QUEUED",
+		3: "REPLACED",
+		4: "MINED",
+		5: "DROPPED",
+	}
+	OnEventsReply_EventType_value = map[string]int32{
+		"PENDING":  0,
+		"BASE_FEE": 1,
+		"QUEUED":   2,
+		"REPLACED": 3,
+		"MINED":    4,
+		"DROPPED":  5,
+	}
+)
+
+func (x OnEventsReply_EventType) Enum() *OnEventsReply_EventType {
+	p := new(OnEventsReply_EventType)
+	*p = x
+	return p
+}
+
+func (x OnEventsReply_EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OnEventsReply_EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_txpool_txpool_proto_enumTypes[1].Descriptor()
+}
+
+func (OnEventsReply_EventType) Type() protoreflect.EnumType {
+	return &file_txpool_txpool_proto_enumTypes[1]
+}
+
+func (x OnEventsReply_EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OnEventsReply_EventType.Descriptor instead.
+func (OnEventsReply_EventType) EnumDescriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{8, 0}
+}
+
 type AllReply_TxnType int32
 
 const (
@@ -113,11 +171,11 @@ func (x AllReply_TxnType) String() string {
 }
 
 func (AllReply_TxnType) Descriptor() protoreflect.EnumDescriptor {
-	return file_txpool_txpool_proto_enumTypes[1].Descriptor()
+	return file_txpool_txpool_proto_enumTypes[2].Descriptor()
 }
 
 func (AllReply_TxnType) Type() protoreflect.EnumType {
-	return &file_txpool_txpool_proto_enumTypes[1]
+	return &file_txpool_txpool_proto_enumTypes[2]
 }
 
 func (x AllReply_TxnType) Number() protoreflect.EnumNumber {
@@ -126,7 +184,7 @@ func (x AllReply_TxnType) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use AllReply_TxnType.Descriptor instead.
 func (AllReply_TxnType) EnumDescriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{8, 0}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{10, 0}
 }
 
 type TxHashes struct {
@@ -457,6 +515,91 @@ func (x *OnAddReply) GetRplTxs() [][]byte {
 	return nil
 }
 
+type OnEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *OnEventsRequest) Reset() {
+	*x = OnEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OnEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OnEventsRequest) ProtoMessage() {}
+
+func (x *OnEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OnEventsRequest.ProtoReflect.Descriptor instead.
+func (*OnEventsRequest) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{7}
+}
+
+type OnEventsReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Events []*OnEventsReply_Event `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+}
+
+func (x *OnEventsReply) Reset() {
+	*x = OnEventsReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OnEventsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OnEventsReply) ProtoMessage() {}
+
+func (x *OnEventsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OnEventsReply.ProtoReflect.Descriptor instead.
+func (*OnEventsReply) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *OnEventsReply) GetEvents() []*OnEventsReply_Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
 type AllRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -466,7 +609,7 @@ type AllRequest struct {
 func (x *AllRequest) Reset() {
 	*x = AllRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[7]
+		mi := &file_txpool_txpool_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -479,7 +622,7 @@ func (x *AllRequest) String() string {
 func (*AllRequest) ProtoMessage() {}
 
 func (x *AllRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[7]
+	mi := &file_txpool_txpool_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -492,7 +635,7 @@ func (x *AllRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AllRequest.ProtoReflect.Descriptor instead.
 func (*AllRequest) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{7}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{9}
 }
 
 type AllReply struct {
@@ -506,7 +649,7 @@ type AllReply struct {
 func (x *AllReply) Reset() {
 	*x = AllReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[8]
+		mi := &file_txpool_txpool_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -519,7 +662,7 @@ func (x *AllReply) String() string {
 func (*AllReply) ProtoMessage() {}
 
 func (x *AllReply) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[8]
+	mi := &file_txpool_txpool_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -532,7 +675,7 @@ func (x *AllReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AllReply.ProtoReflect.Descriptor instead.
 func (*AllReply) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{8}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *AllReply) GetTxs() []*AllReply_Tx {
@@ -553,7 +696,7 @@ type PendingReply struct {
 func (x *PendingReply) Reset() {
 	*x = PendingReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[9]
+		mi := &file_txpool_txpool_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -566,7 +709,7 @@ func (x *PendingReply) String() string {
 func (*PendingReply) ProtoMessage() {}
 
 func (x *PendingReply) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[9]
+	mi := &file_txpool_txpool_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -579,7 +722,7 @@ func (x *PendingReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PendingReply.ProtoReflect.Descriptor instead.
 func (*PendingReply) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{9}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *PendingReply) GetTxs() []*PendingReply_Tx {
@@ -589,6 +732,100 @@ func (x *PendingReply) GetTxs() []*PendingReply_Tx {
 	return nil
 }
 
+type ContentFromRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sender *types.H160 `protobuf:"bytes,1,opt,name=sender,proto3" json:"sender,omitempty"`
+}
+
+func (x *ContentFromRequest) Reset() {
+	*x = ContentFromRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ContentFromRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContentFromRequest) ProtoMessage() {}
+
+func (x *ContentFromRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContentFromRequest.ProtoReflect.Descriptor instead.
+func (*ContentFromRequest) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ContentFromRequest) GetSender() *types.H160 {
+	if x != nil {
+		return x.Sender
+	}
+	return nil
+}
+
+type ContentFromReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Txs []*ContentFromReply_Tx `protobuf:"bytes,1,rep,name=txs,proto3" json:"txs,omitempty"` // ordered by nonce
+}
+
+func (x *ContentFromReply) Reset() {
+	*x = ContentFromReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ContentFromReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContentFromReply) ProtoMessage() {}
+
+func (x *ContentFromReply) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContentFromReply.ProtoReflect.Descriptor instead.
+func (*ContentFromReply) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ContentFromReply) GetTxs() []*ContentFromReply_Tx {
+	if x != nil {
+		return x.Txs
+	}
+	return nil
+}
+
 type StatusRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -598,7 +835,7 @@ type StatusRequest struct {
 func (x *StatusRequest) Reset() {
 	*x = StatusRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[10]
+		mi := &file_txpool_txpool_proto_msgTypes[14]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -611,7 +848,7 @@ func (x *StatusRequest) String() string {
 func (*StatusRequest) ProtoMessage() {}
 
 func (x *StatusRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[10]
+	mi := &file_txpool_txpool_proto_msgTypes[14]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -624,7 +861,7 @@ func (x *StatusRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatusRequest.ProtoReflect.Descriptor instead.
 func (*StatusRequest) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{10}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{14}
 }
 
 type StatusReply struct {
@@ -640,7 +877,7 @@ type StatusReply struct {
 func (x *StatusReply) Reset() {
 	*x = StatusReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[11]
+		mi := &file_txpool_txpool_proto_msgTypes[15]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -653,7 +890,7 @@ func (x *StatusReply) String() string {
 func (*StatusReply) ProtoMessage() {}
 
 func (x *StatusReply) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[11]
+	mi := &file_txpool_txpool_proto_msgTypes[15]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -666,7 +903,7 @@ func (x *StatusReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatusReply.ProtoReflect.Descriptor instead.
 func (*StatusReply) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{11}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *StatusReply) GetPendingCount() uint32 {
@@ -701,7 +938,7 @@ type NonceRequest struct {
 func (x *NonceRequest) Reset() {
 	*x = NonceRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[12]
+		mi := &file_txpool_txpool_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -714,7 +951,7 @@ func (x *NonceRequest) String() string {
 func (*NonceRequest) ProtoMessage() {}
 
 func (x *NonceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[12]
+	mi := &file_txpool_txpool_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -727,7 +964,7 @@ func (x *NonceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use NonceRequest.ProtoReflect.Descriptor instead.
 func (*NonceRequest) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{12}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *NonceRequest) GetAddress() *types.H160 {
@@ -749,7 +986,7 @@ type NonceReply struct {
 func (x *NonceReply) Reset() {
 	*x = NonceReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[13]
+		mi := &file_txpool_txpool_proto_msgTypes[17]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -762,7 +999,7 @@ func (x *NonceReply) String() string {
 func (*NonceReply) ProtoMessage() {}
 
 func (x *NonceReply) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[13]
+	mi := &file_txpool_txpool_proto_msgTypes[17]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -775,7 +1012,7 @@ func (x *NonceReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use NonceReply.ProtoReflect.Descriptor instead.
 func (*NonceReply) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{13}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *NonceReply) GetFound() bool {
@@ -792,6 +1029,101 @@ func (x *NonceReply) GetNonce() uint64 {
 	return 0
 }
 
+type OnEventsReply_Event struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type       OnEventsReply_EventType `protobuf:"varint,1,opt,name=type,proto3,enum=txpool.OnEventsReply_EventType" json:"type,omitempty"`
+	Hash       *types.H256             `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	Sender     *types.H160             `protobuf:"bytes,3,opt,name=sender,proto3" json:"sender,omitempty"`
+	Nonce      uint64                  `protobuf:"varint,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	ReplacedBy *types.H256             `protobuf:"bytes,5,opt,name=replacedBy,proto3" json:"replacedBy,omitempty"`
+	Reason     uint32                  `protobuf:"varint,6,opt,name=reason,proto3" json:"reason,omitempty"` // discard reason code of DROPPED event
+	ReasonText string                  `protobuf:"bytes,7,opt,name=reasonText,proto3" json:"reasonText,omitempty"`
+}
+
+func (x *OnEventsReply_Event) Reset() {
+	*x = OnEventsReply_Event{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OnEventsReply_Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OnEventsReply_Event) ProtoMessage() {}
+
+func (x *OnEventsReply_Event) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OnEventsReply_Event.ProtoReflect.Descriptor instead.
+func (*OnEventsReply_Event) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{8, 0}
+}
+
+func (x *OnEventsReply_Event) GetType() OnEventsReply_EventType {
+	if x != nil {
+		return x.Type
+	}
+	return OnEventsReply_PENDING
+}
+
+func (x *OnEventsReply_Event) GetHash() *types.H256 {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *OnEventsReply_Event) GetSender() *types.H160 {
+	if x != nil {
+		return x.Sender
+	}
+	return nil
+}
+
+func (x *OnEventsReply_Event) GetNonce() uint64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *OnEventsReply_Event) GetReplacedBy() *types.H256 {
+	if x != nil {
+		return x.ReplacedBy
+	}
+	return nil
+}
+
+func (x *OnEventsReply_Event) GetReason() uint32 {
+	if x != nil {
+		return x.Reason
+	}
+	return 0
+}
+
+func (x *OnEventsReply_Event) GetReasonText() string {
+	if x != nil {
+		return x.ReasonText
+	}
+	return ""
+}
+
 type AllReply_Tx struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -805,7 +1137,7 @@ type AllReply_Tx struct {
 func (x *AllReply_Tx) Reset() {
 	*x = AllReply_Tx{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[14]
+		mi := &file_txpool_txpool_proto_msgTypes[19]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -818,7 +1150,7 @@ func (x *AllReply_Tx) String() string {
 func (*AllReply_Tx) ProtoMessage() {}
 
 func (x *AllReply_Tx) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[14]
+	mi := &file_txpool_txpool_proto_msgTypes[19]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -831,7 +1163,7 @@ func (x *AllReply_Tx) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AllReply_Tx.ProtoReflect.Descriptor instead.
 func (*AllReply_Tx) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{8, 0}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{10, 0}
 }
 
 func (x *AllReply_Tx) GetTxnType() AllReply_TxnType {
@@ -868,7 +1200,7 @@ type PendingReply_Tx struct {
 func (x *PendingReply_Tx) Reset() {
 	*x = PendingReply_Tx{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_txpool_txpool_proto_msgTypes[15]
+		mi := &file_txpool_txpool_proto_msgTypes[20]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -881,7 +1213,7 @@ func (x *PendingReply_Tx) String() string {
 func (*PendingReply_Tx) ProtoMessage() {}
 
 func (x *PendingReply_Tx) ProtoReflect() protoreflect.Message {
-	mi := &file_txpool_txpool_proto_msgTypes[15]
+	mi := &file_txpool_txpool_proto_msgTypes[20]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -894,7 +1226,7 @@ func (x *PendingReply_Tx) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PendingReply_Tx.ProtoReflect.Descriptor instead.
 func (*PendingReply_Tx) Descriptor() ([]byte, []int) {
-	return file_txpool_txpool_proto_rawDescGZIP(), []int{9, 0}
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{11, 0}
 }
 
 func (x *PendingReply_Tx) GetSender() *types.H160 {
@@ -918,6 +1250,117 @@ func (x *PendingReply_Tx) GetIsLocal() bool {
 	return false
 }
 
+type ContentFromReply_Tx struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TxnType    AllReply_TxnType `protobuf:"varint,1,opt,name=txnType,proto3,enum=txpool.AllReply_TxnType" json:"txnType,omitempty"`
+	Hash       *types.H256      `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	Nonce      uint64           `protobuf:"varint,3,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Tip        *types.H256      `protobuf:"bytes,4,opt,name=tip,proto3" json:"tip,omitempty"`
+	FeeCap     uint64           `protobuf:"varint,5,opt,name=feeCap,proto3" json:"feeCap,omitempty"`
+	Gas        uint64           `protobuf:"varint,6,opt,name=gas,proto3" json:"gas,omitempty"`
+	Value      *types.H256      `protobuf:"bytes,7,opt,name=value,proto3" json:"value,omitempty"`
+	BlobFeeCap uint64           `protobuf:"varint,8,opt,name=blobFeeCap,proto3" json:"blobFeeCap,omitempty"`
+	RlpTx      []byte           `protobuf:"bytes,9,opt,name=rlpTx,proto3" json:"rlpTx,omitempty"`
+}
+
+func (x *ContentFromReply_Tx) Reset() {
+	*x = ContentFromReply_Tx{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_txpool_txpool_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ContentFromReply_Tx) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContentFromReply_Tx) ProtoMessage() {}
+
+func (x *ContentFromReply_Tx) ProtoReflect() protoreflect.Message {
+	mi := &file_txpool_txpool_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContentFromReply_Tx.ProtoReflect.Descriptor instead.
+func (*ContentFromReply_Tx) Descriptor() ([]byte, []int) {
+	return file_txpool_txpool_proto_rawDescGZIP(), []int{13, 0}
+}
+
+func (x *ContentFromReply_Tx) GetTxnType() AllReply_TxnType {
+	if x != nil {
+		return x.TxnType
+	}
+	return AllReply_PENDING
+}
+
+func (x *ContentFromReply_Tx) GetHash() *types.H256 {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *ContentFromReply_Tx) GetNonce() uint64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *ContentFromReply_Tx) GetTip() *types.H256 {
+	if x != nil {
+		return x.Tip
+	}
+	return nil
+}
+
+func (x *ContentFromReply_Tx) GetFeeCap() uint64 {
+	if x != nil {
+		return x.FeeCap
+	}
+	return 0
+}
+
+func (x *ContentFromReply_Tx) GetGas() uint64 {
+	if x != nil {
+		return x.Gas
+	}
+	return 0
+}
+
+func (x *ContentFromReply_Tx) GetValue() *types.H256 {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *ContentFromReply_Tx) GetBlobFeeCap() uint64 {
+	if x != nil {
+		return x.BlobFeeCap
+	}
+	return 0
+}
+
+func (x *ContentFromReply_Tx) GetRlpTx() []byte {
+	if x != nil {
+		return x.RlpTx
+	}
+	return nil
+}
+
 var File_txpool_txpool_proto protoreflect.FileDescriptor
 
 var file_txpool_txpool_proto_rawDesc = []byte{
@@ -946,86 +1389,147 @@ var file_txpool_txpool_proto_rawDesc = []byte{
 	0x54, 0x78, 0x73, 0x22, 0x0e, 0x0a, 0x0c, 0x4f, 0x6e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75,
 	0x65, 0x73, 0x74, 0x22, 0x24, 0x0a, 0x0a, 0x4f, 0x6e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x70, 0x6c,
 	0x79, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x70, 0x6c, 0x54, 0x78, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
-	0x0c, 0x52, 0x06, 0x72, 0x70, 0x6c, 0x54, 0x78, 0x73, 0x22, 0x0c, 0x0a, 0x0a, 0x41, 0x6c, 0x6c,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xd8, 0x01, 0x0a, 0x08, 0x41, 0x6c, 0x6c, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x12, 0x25, 0x0a, 0x03, 0x74, 0x78, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
-	0x0b, 0x32, 0x13, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c, 0x6c, 0x52, 0x65,
-	0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x52, 0x03, 0x74, 0x78, 0x73, 0x1a, 0x73, 0x0a, 0x02, 0x54,
-	0x78, 0x12, 0x32, 0x0a, 0x07, 0x74, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x0e, 0x32, 0x18, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c, 0x6c, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x07, 0x74, 0x78,
-	0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x31,
-	0x36, 0x30, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6c,
-	0x70, 0x54, 0x78, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x72, 0x6c, 0x70, 0x54, 0x78,
-	0x22, 0x30, 0x0a, 0x07, 0x54, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x50,
-	0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x51, 0x55, 0x45, 0x55,
-	0x45, 0x44, 0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x42, 0x41, 0x53, 0x45, 0x5f, 0x46, 0x45, 0x45,
-	0x10, 0x02, 0x22, 0x94, 0x01, 0x0a, 0x0c, 0x50, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65,
-	0x70, 0x6c, 0x79, 0x12, 0x29, 0x0a, 0x03, 0x74, 0x78, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
-	0x32, 0x17, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x50, 0x65, 0x6e, 0x64, 0x69, 0x6e,
-	0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x52, 0x03, 0x74, 0x78, 0x73, 0x1a, 0x59,
-	0x0a, 0x02, 0x54, 0x78, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x31, 0x36,
-	0x30, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6c, 0x70,
-	0x54, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x72, 0x6c, 0x70, 0x54, 0x78, 0x12,
-	0x18, 0x0a, 0x07, 0x69, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x07, 0x69, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x22, 0x0f, 0x0a, 0x0d, 0x53, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x77, 0x0a, 0x0b, 0x53, 0x74,
-	0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x22, 0x0a, 0x0c, 0x70, 0x65, 0x6e,
-	0x64, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
-	0x0c, 0x70, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x20, 0x0a,
-	0x0b, 0x71, 0x75, 0x65, 0x75, 0x65, 0x64, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x0d, 0x52, 0x0b, 0x71, 0x75, 0x65, 0x75, 0x65, 0x64, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12,
-	0x22, 0x0a, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x46, 0x65, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x46, 0x65, 0x65, 0x43, 0x6f,
-	0x75, 0x6e, 0x74, 0x22, 0x35, 0x0a, 0x0c, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x31, 0x36,
-	0x30, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x22, 0x38, 0x0a, 0x0a, 0x4e, 0x6f,
-	0x6e, 0x63, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6f, 0x75, 0x6e,
-	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x14,
-	0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x6e,
-	0x6f, 0x6e, 0x63, 0x65, 0x2a, 0x6c, 0x0a, 0x0c, 0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x55, 0x43, 0x43, 0x45, 0x53, 0x53, 0x10,
-	0x00, 0x12, 0x12, 0x0a, 0x0e, 0x41, 0x4c, 0x52, 0x45, 0x41, 0x44, 0x59, 0x5f, 0x45, 0x58, 0x49,
-	0x53, 0x54, 0x53, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b, 0x46, 0x45, 0x45, 0x5f, 0x54, 0x4f, 0x4f,
-	0x5f, 0x4c, 0x4f, 0x57, 0x10, 0x02, 0x12, 0x09, 0x0a, 0x05, 0x53, 0x54, 0x41, 0x4c, 0x45, 0x10,
-	0x03, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x10, 0x04, 0x12, 0x12,
-	0x0a, 0x0e, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52,
-	0x10, 0x05, 0x32, 0xec, 0x03, 0x0a, 0x06, 0x54, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x12, 0x36, 0x0a,
-	0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
-	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79,
-	0x1a, 0x13, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
-	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x31, 0x0a, 0x0b, 0x46, 0x69, 0x6e, 0x64, 0x55, 0x6e, 0x6b,
-	0x6e, 0x6f, 0x77, 0x6e, 0x12, 0x10, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54, 0x78,
-	0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x1a, 0x10, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e,
-	0x54, 0x78, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x12, 0x2b, 0x0a, 0x03, 0x41, 0x64, 0x64, 0x12,
-	0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x64, 0x64,
-	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x46, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63,
-	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1b, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54,
-	0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x19, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54, 0x72, 0x61, 0x6e,
-	0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x2b, 0x0a,
-	0x03, 0x41, 0x6c, 0x6c, 0x12, 0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c,
-	0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f,
-	0x6c, 0x2e, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x37, 0x0a, 0x07, 0x50, 0x65,
-	0x6e, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x14, 0x2e,
-	0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x50, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65,
-	0x70, 0x6c, 0x79, 0x12, 0x33, 0x0a, 0x05, 0x4f, 0x6e, 0x41, 0x64, 0x64, 0x12, 0x14, 0x2e, 0x74,
-	0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x41, 0x64,
-	0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x30, 0x01, 0x12, 0x34, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74,
-	0x75, 0x73, 0x12, 0x15, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x53, 0x74, 0x61, 0x74,
-	0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x74, 0x78, 0x70, 0x6f,
-	0x6f, 0x6c, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x31,
-	0x0a, 0x05, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x14, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c,
-	0x2e, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e,
-	0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x70, 0x6c,
-	0x79, 0x42, 0x11, 0x5a, 0x0f, 0x2e, 0x2f, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x3b, 0x74, 0x78,
-	0x70, 0x6f, 0x6f, 0x6c, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x0c, 0x52, 0x06, 0x72, 0x70, 0x6c, 0x54, 0x78, 0x73, 0x22, 0x11, 0x0a, 0x0f, 0x4f, 0x6e, 0x45,
+	0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x9e, 0x03, 0x0a,
+	0x0d, 0x4f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x33,
+	0x0a, 0x06, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b,
+	0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x06, 0x65, 0x76, 0x65,
+	0x6e, 0x74, 0x73, 0x1a, 0xfd, 0x01, 0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x33, 0x0a,
+	0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1f, 0x2e, 0x74, 0x78,
+	0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x32, 0x35, 0x36, 0x52, 0x04, 0x68,
+	0x61, 0x73, 0x68, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x31, 0x36, 0x30,
+	0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x2b,
+	0x0a, 0x0a, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x64, 0x42, 0x79, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x32, 0x35, 0x36, 0x52,
+	0x0a, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x64, 0x42, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x72,
+	0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x72, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x12, 0x1e, 0x0a, 0x0a, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x54, 0x65, 0x78,
+	0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x54,
+	0x65, 0x78, 0x74, 0x22, 0x58, 0x0a, 0x09, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65,
+	0x12, 0x0b, 0x0a, 0x07, 0x50, 0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0c, 0x0a,
+	0x08, 0x42, 0x41, 0x53, 0x45, 0x5f, 0x46, 0x45, 0x45, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x51,
+	0x55, 0x45, 0x55, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x50, 0x4c, 0x41,
+	0x43, 0x45, 0x44, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x4d, 0x49, 0x4e, 0x45, 0x44, 0x10, 0x04,
+	0x12, 0x0b, 0x0a, 0x07, 0x44, 0x52, 0x4f, 0x50, 0x50, 0x45, 0x44, 0x10, 0x05, 0x22, 0x0c, 0x0a,
+	0x0a, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xd8, 0x01, 0x0a, 0x08,
+	0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x25, 0x0a, 0x03, 0x74, 0x78, 0x73, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41,
+	0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x52, 0x03, 0x74, 0x78, 0x73, 0x1a,
+	0x73, 0x0a, 0x02, 0x54, 0x78, 0x12, 0x32, 0x0a, 0x07, 0x74, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e,
+	0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65,
+	0x52, 0x07, 0x74, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e,
+	0x64, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65,
+	0x73, 0x2e, 0x48, 0x31, 0x36, 0x30, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x14,
+	0x0a, 0x05, 0x72, 0x6c, 0x70, 0x54, 0x78, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x72,
+	0x6c, 0x70, 0x54, 0x78, 0x22, 0x30, 0x0a, 0x07, 0x54, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12,
+	0x0b, 0x0a, 0x07, 0x50, 0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06,
+	0x51, 0x55, 0x45, 0x55, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x42, 0x41, 0x53, 0x45,
+	0x5f, 0x46, 0x45, 0x45, 0x10, 0x02, 0x22, 0x94, 0x01, 0x0a, 0x0c, 0x50, 0x65, 0x6e, 0x64, 0x69,
+	0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x29, 0x0a, 0x03, 0x74, 0x78, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x50, 0x65,
+	0x6e, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x52, 0x03, 0x74,
+	0x78, 0x73, 0x1a, 0x59, 0x0a, 0x02, 0x54, 0x78, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64,
+	0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73,
+	0x2e, 0x48, 0x31, 0x36, 0x30, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x12, 0x14, 0x0a,
+	0x05, 0x72, 0x6c, 0x70, 0x54, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x72, 0x6c,
+	0x70, 0x54, 0x78, 0x12, 0x18, 0x0a, 0x07, 0x69, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x69, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x22, 0x39, 0x0a,
+	0x12, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f, 0x6d, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x23, 0x0a, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x31, 0x36, 0x30,
+	0x52, 0x06, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x22, 0xd5, 0x02, 0x0a, 0x10, 0x43, 0x6f, 0x6e,
+	0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x2d, 0x0a,
+	0x03, 0x74, 0x78, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x74, 0x78, 0x70,
+	0x6f, 0x6f, 0x6c, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f, 0x6d, 0x52,
+	0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x52, 0x03, 0x74, 0x78, 0x73, 0x1a, 0x91, 0x02, 0x0a,
+	0x02, 0x54, 0x78, 0x12, 0x32, 0x0a, 0x07, 0x74, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c,
+	0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x54, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x07,
+	0x74, 0x78, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48, 0x32,
+	0x35, 0x36, 0x52, 0x04, 0x68, 0x61, 0x73, 0x68, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x1d,
+	0x0a, 0x03, 0x74, 0x69, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79,
+	0x70, 0x65, 0x73, 0x2e, 0x48, 0x32, 0x35, 0x36, 0x52, 0x03, 0x74, 0x69, 0x70, 0x12, 0x16, 0x0a,
+	0x06, 0x66, 0x65, 0x65, 0x43, 0x61, 0x70, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x66,
+	0x65, 0x65, 0x43, 0x61, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x67, 0x61, 0x73, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x03, 0x67, 0x61, 0x73, 0x12, 0x21, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x48,
+	0x32, 0x35, 0x36, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x62, 0x6c,
+	0x6f, 0x62, 0x46, 0x65, 0x65, 0x43, 0x61, 0x70, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a,
+	0x62, 0x6c, 0x6f, 0x62, 0x46, 0x65, 0x65, 0x43, 0x61, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x6c,
+	0x70, 0x54, 0x78, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x72, 0x6c, 0x70, 0x54, 0x78,
+	0x22, 0x0f, 0x0a, 0x0d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x22, 0x77, 0x0a, 0x0b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x12, 0x22, 0x0a, 0x0c, 0x70, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x43, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x70, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x71, 0x75, 0x65, 0x75, 0x65, 0x64, 0x43, 0x6f,
+	0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x71, 0x75, 0x65, 0x75, 0x65,
+	0x64, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x22, 0x0a, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x46, 0x65,
+	0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x62, 0x61,
+	0x73, 0x65, 0x46, 0x65, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x35, 0x0a, 0x0c, 0x4e, 0x6f,
+	0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x74, 0x79,
+	0x70, 0x65, 0x73, 0x2e, 0x48, 0x31, 0x36, 0x30, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x22, 0x38, 0x0a, 0x0a, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12,
+	0x14, 0x0a, 0x05, 0x66, 0x6f, 0x75, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05,
+	0x66, 0x6f, 0x75, 0x6e, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x2a, 0x6c, 0x0a, 0x0c, 0x49,
+	0x6d, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x0b, 0x0a, 0x07, 0x53,
+	0x55, 0x43, 0x43, 0x45, 0x53, 0x53, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x41, 0x4c, 0x52, 0x45,
+	0x41, 0x44, 0x59, 0x5f, 0x45, 0x58, 0x49, 0x53, 0x54, 0x53, 0x10, 0x01, 0x12, 0x0f, 0x0a, 0x0b,
+	0x46, 0x45, 0x45, 0x5f, 0x54, 0x4f, 0x4f, 0x5f, 0x4c, 0x4f, 0x57, 0x10, 0x02, 0x12, 0x09, 0x0a,
+	0x05, 0x53, 0x54, 0x41, 0x4c, 0x45, 0x10, 0x03, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41,
+	0x4c, 0x49, 0x44, 0x10, 0x04, 0x12, 0x12, 0x0a, 0x0e, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41,
+	0x4c, 0x5f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x05, 0x32, 0xef, 0x04, 0x0a, 0x06, 0x54, 0x78,
+	0x70, 0x6f, 0x6f, 0x6c, 0x12, 0x36, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12,
+	0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x13, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x31, 0x0a, 0x0b,
+	0x46, 0x69, 0x6e, 0x64, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x12, 0x10, 0x2e, 0x74, 0x78,
+	0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54, 0x78, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x1a, 0x10, 0x2e,
+	0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54, 0x78, 0x48, 0x61, 0x73, 0x68, 0x65, 0x73, 0x12,
+	0x2b, 0x0a, 0x03, 0x41, 0x64, 0x64, 0x12, 0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e,
+	0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x74, 0x78, 0x70,
+	0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x46, 0x0a, 0x0c,
+	0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1b, 0x2e, 0x74,
+	0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x74, 0x78, 0x70, 0x6f,
+	0x6f, 0x6c, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52,
+	0x65, 0x70, 0x6c, 0x79, 0x12, 0x2b, 0x0a, 0x03, 0x41, 0x6c, 0x6c, 0x12, 0x12, 0x2e, 0x74, 0x78,
+	0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x10, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x12, 0x37, 0x0a, 0x07, 0x50, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x16, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x1a, 0x14, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x50, 0x65,
+	0x6e, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x33, 0x0a, 0x05, 0x4f, 0x6e,
+	0x41, 0x64, 0x64, 0x12, 0x14, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x41,
+	0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f,
+	0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x30, 0x01, 0x12,
+	0x3c, 0x0a, 0x08, 0x4f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x17, 0x2e, 0x74, 0x78,
+	0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4f, 0x6e,
+	0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x30, 0x01, 0x12, 0x43, 0x0a,
+	0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f, 0x6d, 0x12, 0x1a, 0x2e, 0x74,
+	0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f,
+	0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x46, 0x72, 0x6f, 0x6d, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x12, 0x34, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x15, 0x2e, 0x74,
+	0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x31, 0x0a, 0x05, 0x4e, 0x6f, 0x6e, 0x63,
+	0x65, 0x12, 0x14, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x4e, 0x6f, 0x6e, 0x63, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c,
+	0x2e, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x42, 0x11, 0x5a, 0x0f, 0x2e,
+	0x2f, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x3b, 0x74, 0x78, 0x70, 0x6f, 0x6f, 0x6c, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1040,65 +1544,87 @@ func file_txpool_txpool_proto_rawDescGZIP() []byte {
 	return file_txpool_txpool_proto_rawDescData
 }
 
-var file_txpool_txpool_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_txpool_txpool_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_txpool_txpool_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_txpool_txpool_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
 var file_txpool_txpool_proto_goTypes = []interface{}{
-	(ImportResult)(0),           // 0: txpool.ImportResult
-	(AllReply_TxnType)(0),       // 1: txpool.AllReply.TxnType
-	(*TxHashes)(nil),            // 2: txpool.TxHashes
-	(*AddRequest)(nil),          // 3: txpool.AddRequest
-	(*AddReply)(nil),            // 4: txpool.AddReply
-	(*TransactionsRequest)(nil), // 5: txpool.TransactionsRequest
-	(*TransactionsReply)(nil),   // 6: txpool.TransactionsReply
-	(*OnAddRequest)(nil),        // 7: txpool.OnAddRequest
-	(*OnAddReply)(nil),          // 8: txpool.OnAddReply
-	(*AllRequest)(nil),          // 9: txpool.AllRequest
-	(*AllReply)(nil),            // 10: txpool.AllReply
-	(*PendingReply)(nil),        // 11: txpool.PendingReply
-	(*StatusRequest)(nil),       // 12: txpool.StatusRequest
-	(*StatusReply)(nil),         // 13: txpool.StatusReply
-	(*NonceRequest)(nil),        // 14: txpool.NonceRequest
-	(*NonceReply)(nil),          // 15: txpool.NonceReply
-	(*AllReply_Tx)(nil),         // 16: txpool.AllReply.Tx
-	(*PendingReply_Tx)(nil),     // 17: txpool.PendingReply.Tx
-	(*types.H256)(nil),          // 18: types.H256
-	(*types.H160)(nil),          // 19: types.H160
-	(*emptypb.Empty)(nil),       // 20: google.protobuf.Empty
-	(*types.VersionReply)(nil),  // 21: types.VersionReply
+	(ImportResult)(0),            // 0: txpool.ImportResult
+	(OnEventsReply_EventType)(0), // 1: txpool.OnEventsReply.EventType
+	(AllReply_TxnType)(0),        // 2: txpool.AllReply.TxnType
+	(*TxHashes)(nil),             // 3: txpool.TxHashes
+	(*AddRequest)(nil),           // 4: txpool.AddRequest
+	(*AddReply)(nil),             // 5: txpool.AddReply
+	(*TransactionsRequest)(nil),  // 6: txpool.TransactionsRequest
+	(*TransactionsReply)(nil),    // 7: txpool.TransactionsReply
+	(*OnAddRequest)(nil),         // 8: txpool.OnAddRequest
+	(*OnAddReply)(nil),           // 9: txpool.OnAddReply
+	(*OnEventsRequest)(nil),      // 10: txpool.OnEventsRequest
+	(*OnEventsReply)(nil),        // 11: txpool.OnEventsReply
+	(*AllRequest)(nil),           // 12: txpool.AllRequest
+	(*AllReply)(nil),             // 13: txpool.AllReply
+	(*PendingReply)(nil),         // 14: txpool.PendingReply
+	(*ContentFromRequest)(nil),   // 15: txpool.ContentFromRequest
+	(*ContentFromReply)(nil),     // 16: txpool.ContentFromReply
+	(*StatusRequest)(nil),        // 17: txpool.StatusRequest
+	(*StatusReply)(nil),          // 18: txpool.StatusReply
+	(*NonceRequest)(nil),         // 19: txpool.NonceRequest
+	(*NonceReply)(nil),           // 20: txpool.NonceReply
+	(*OnEventsReply_Event)(nil),  // 21: txpool.OnEventsReply.Event
+	(*AllReply_Tx)(nil),          // 22: txpool.AllReply.Tx
+	(*PendingReply_Tx)(nil),      // 23: txpool.PendingReply.Tx
+	(*ContentFromReply_Tx)(nil),  // 24: txpool.ContentFromReply.Tx
+	(*types.H256)(nil),           // 25: types.H256
+	(*types.H160)(nil),           // 26: types.H160
+	(*emptypb.Empty)(nil),        // 27: google.protobuf.Empty
+	(*types.VersionReply)(nil),   // 28: types.VersionReply
 }
 var file_txpool_txpool_proto_depIdxs = []int32{
-	18, // 0: txpool.TxHashes.hashes:type_name -> types.H256
+	25, // 0: txpool.TxHashes.hashes:type_name -> types.H256
 	0,  // 1: txpool.AddReply.imported:type_name -> txpool.ImportResult
-	18, // 2: txpool.TransactionsRequest.hashes:type_name -> types.H256
-	16, // 3: txpool.AllReply.txs:type_name -> txpool.AllReply.Tx
-	17, // 4: txpool.PendingReply.txs:type_name -> txpool.PendingReply.Tx
-	19, // 5: txpool.NonceRequest.address:type_name -> types.H160
-	1,  // 6: txpool.AllReply.Tx.txnType:type_name -> txpool.AllReply.TxnType
-	19, // 7: txpool.AllReply.Tx.sender:type_name -> types.H160
-	19, // 8: txpool.PendingReply.Tx.sender:type_name -> types.H160
-	20, // 9: txpool.Txpool.Version:input_type -> google.protobuf.Empty
-	2,  // 10: txpool.Txpool.FindUnknown:input_type -> txpool.TxHashes
-	3,  // 11: txpool.Txpool.Add:input_type -> txpool.AddRequest
-	5,  // 12: txpool.Txpool.Transactions:input_type -> txpool.TransactionsRequest
-	9,  // 13: txpool.Txpool.All:input_type -> txpool.AllRequest
-	20, // 14: txpool.Txpool.Pending:input_type -> google.protobuf.Empty
-	7,  // 15: txpool.Txpool.OnAdd:input_type -> txpool.OnAddRequest
-	12, // 16: txpool.Txpool.Status:input_type -> txpool.StatusRequest
-	14, // 17: txpool.Txpool.Nonce:input_type -> txpool.NonceRequest
-	21, // 18: txpool.Txpool.Version:output_type -> types.VersionReply
-	2,  // 19: txpool.Txpool.FindUnknown:output_type -> txpool.TxHashes
-	4,  // 20: txpool.Txpool.Add:output_type -> txpool.AddReply
-	6,  // 21: txpool.Txpool.Transactions:output_type -> txpool.TransactionsReply
-	10, // 22: txpool.Txpool.All:output_type -> txpool.AllReply
-	11, // 23: txpool.Txpool.Pending:output_type -> txpool.PendingReply
-	8,  // 24: txpool.Txpool.OnAdd:output_type -> txpool.OnAddReply
-	13, // 25: txpool.Txpool.Status:output_type -> txpool.StatusReply
-	15, // 26: txpool.Txpool.Nonce:output_type -> txpool.NonceReply
-	18, // [18:27] is the sub-list for method output_type
-	9,  // [9:18] is the sub-list for method input_type
-	9,  // [9:9] is the sub-list for extension type_name
-	9,  // [9:9] is the sub-list for extension extendee
-	0,  // [0:9] is the sub-list for field type_name
+	25, // 2: txpool.TransactionsRequest.hashes:type_name -> types.H256
+	21, // 3: txpool.OnEventsReply.events:type_name -> txpool.OnEventsReply.Event
+	22, // 4: txpool.AllReply.txs:type_name -> txpool.AllReply.Tx
+	23, // 5: txpool.PendingReply.txs:type_name -> txpool.PendingReply.Tx
+	26, // 6: txpool.ContentFromRequest.sender:type_name -> types.H160
+	24, // 7: txpool.ContentFromReply.txs:type_name -> txpool.ContentFromReply.Tx
+	26, // 8: txpool.NonceRequest.address:type_name -> types.H160
+	1,  // 9: txpool.OnEventsReply.Event.type:type_name -> txpool.OnEventsReply.EventType
+	25, // 10: txpool.OnEventsReply.Event.hash:type_name -> types.H256
+	26, // 11: txpool.OnEventsReply.Event.sender:type_name -> types.H160
+	25, // 12: txpool.OnEventsReply.Event.replacedBy:type_name -> types.H256
+	2,  // 13: txpool.AllReply.Tx.txnType:type_name -> txpool.AllReply.TxnType
+	26, // 14: txpool.AllReply.Tx.sender:type_name -> types.H160
+	26, // 15: txpool.PendingReply.Tx.sender:type_name -> types.H160
+	2,  // 16: txpool.ContentFromReply.Tx.txnType:type_name -> txpool.AllReply.TxnType
+	25, // 17: txpool.ContentFromReply.Tx.hash:type_name -> types.H256
+	25, // 18: txpool.ContentFromReply.Tx.tip:type_name -> types.H256
+	25, // 19: txpool.ContentFromReply.Tx.value:type_name -> types.H256
+	27, // 20: txpool.Txpool.Version:input_type -> google.protobuf.Empty
+	3,  // 21: txpool.Txpool.FindUnknown:input_type -> txpool.TxHashes
+	4,  // 22: txpool.Txpool.Add:input_type -> txpool.AddRequest
+	6,  // 23: txpool.Txpool.Transactions:input_type -> txpool.TransactionsRequest
+	12, // 24: txpool.Txpool.All:input_type -> txpool.AllRequest
+	27, // 25: txpool.Txpool.Pending:input_type -> google.protobuf.Empty
+	8,  // 26: txpool.Txpool.OnAdd:input_type -> txpool.OnAddRequest
+	10, // 27: txpool.Txpool.OnEvents:input_type -> txpool.OnEventsRequest
+	15, // 28: txpool.Txpool.ContentFrom:input_type -> txpool.ContentFromRequest
+	17, // 29: txpool.Txpool.Status:input_type -> txpool.StatusRequest
+	19, // 30: txpool.Txpool.Nonce:input_type -> txpool.NonceRequest
+	28, // 31: txpool.Txpool.Version:output_type -> types.VersionReply
+	3,  // 32: txpool.Txpool.FindUnknown:output_type -> txpool.TxHashes
+	5,  // 33: txpool.Txpool.Add:output_type -> txpool.AddReply
+	7,  // 34: txpool.Txpool.Transactions:output_type -> txpool.TransactionsReply
+	13, // 35: txpool.Txpool.All:output_type -> txpool.AllReply
+	14, // 36: txpool.Txpool.Pending:output_type -> txpool.PendingReply
+	9,  // 37: txpool.Txpool.OnAdd:output_type -> txpool.OnAddReply
+	11, // 38: txpool.Txpool.OnEvents:output_type -> txpool.OnEventsReply
+	16, // 39: txpool.Txpool.ContentFrom:output_type -> txpool.ContentFromReply
+	18, // 40: txpool.Txpool.Status:output_type -> txpool.StatusReply
+	20, // 41: txpool.Txpool.Nonce:output_type -> txpool.NonceReply
+	31, // [31:42] is the sub-list for method output_type
+	20, // [20:31] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
 }
 
 func init() { file_txpool_txpool_proto_init() }
@@ -1192,7 +1718,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AllRequest); i {
+			switch v := v.(*OnEventsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1204,7 +1730,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AllReply); i {
+			switch v := v.(*OnEventsReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1216,7 +1742,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PendingReply); i {
+			switch v := v.(*AllRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1228,7 +1754,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatusRequest); i {
+			switch v := v.(*AllReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1240,7 +1766,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatusReply); i {
+			switch v := v.(*PendingReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1252,7 +1778,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*NonceRequest); i {
+			switch v := v.(*ContentFromRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1264,7 +1790,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*NonceReply); i {
+			switch v := v.(*ContentFromReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1276,7 +1802,7 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AllReply_Tx); i {
+			switch v := v.(*StatusRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -1288,6 +1814,66 @@ func file_txpool_txpool_proto_init() {
 			}
 		}
 		file_txpool_txpool_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_txpool_txpool_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NonceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_txpool_txpool_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NonceReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_txpool_txpool_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OnEventsReply_Event); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_txpool_txpool_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AllReply_Tx); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_txpool_txpool_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*PendingReply_Tx); i {
 			case 0:
 				return &v.state
@@ -1299,14 +1885,26 @@ func file_txpool_txpool_proto_init() {
 				return nil
 			}
 		}
+		file_txpool_txpool_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ContentFromReply_Tx); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_txpool_txpool_proto_rawDesc,
-			NumEnums:      2,
-			NumMessages:   16,
+			NumEnums:      3,
+			NumMessages:   22,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
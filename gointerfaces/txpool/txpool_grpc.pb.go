@@ -39,6 +39,10 @@ type TxpoolClient interface {
 	Pending(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*PendingReply, error)
 	// subscribe to new transactions add event
 	OnAdd(ctx context.Context, in *OnAddRequest, opts ...grpc.CallOption) (Txpool_OnAddClient, error)
+	// subscribe to events of transactions: entering sub-pools, replacement, inclusion into block, discarding
+	OnEvents(ctx context.Context, in *OnEventsRequest, opts ...grpc.CallOption) (Txpool_OnEventsClient, error)
+	// returns transactions of sender (pending, baseFee and queued) with nonces and fees
+	ContentFrom(ctx context.Context, in *ContentFromRequest, opts ...grpc.CallOption) (*ContentFromReply, error)
 	// returns high level status
 	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error)
 	// returns nonce for given account
@@ -139,6 +143,47 @@ func (x *txpoolOnAddClient) Recv() (*OnAddReply, error) {
 	return m, nil
 }
 
+func (c *txpoolClient) OnEvents(ctx context.Context, in *OnEventsRequest, opts ...grpc.CallOption) (Txpool_OnEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Txpool_ServiceDesc.Streams[1], "/txpool.Txpool/OnEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &txpoolOnEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Txpool_OnEventsClient interface {
+	Recv() (*OnEventsReply, error)
+	grpc.ClientStream
+}
+
+type txpoolOnEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *txpoolOnEventsClient) Recv() (*OnEventsReply, error) {
+	m := new(OnEventsReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *txpoolClient) ContentFrom(ctx context.Context, in *ContentFromRequest, opts ...grpc.CallOption) (*ContentFromReply, error) {
+	out := new(ContentFromReply)
+	err := c.cc.Invoke(ctx, "/txpool.Txpool/ContentFrom", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *txpoolClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error) {
 	out := new(StatusReply)
 	err := c.cc.Invoke(ctx, "/txpool.Txpool/Status", in, out, opts...)
@@ -176,6 +221,10 @@ type TxpoolServer interface {
 	Pending(context.Context, *emptypb.Empty) (*PendingReply, error)
 	// subscribe to new transactions add event
 	OnAdd(*OnAddRequest, Txpool_OnAddServer) error
+	// subscribe to events of transactions: entering sub-pools, replacement, inclusion into block, discarding
+	OnEvents(*OnEventsRequest, Txpool_OnEventsServer) error
+	// returns transactions of sender (pending, baseFee and queued) with nonces and fees
+	ContentFrom(context.Context, *ContentFromRequest) (*ContentFromReply, error)
 	// returns high level status
 	Status(context.Context, *StatusRequest) (*StatusReply, error)
 	// returns nonce for given account
@@ -208,6 +257,12 @@ func (UnimplementedTxpoolServer) Pending(context.Context, *emptypb.Empty) (*Pend
 func (UnimplementedTxpoolServer) OnAdd(*OnAddRequest, Txpool_OnAddServer) error {
 	return status.Errorf(codes.Unimplemented, "method OnAdd not implemented")
 }
+func (UnimplementedTxpoolServer) OnEvents(*OnEventsRequest, Txpool_OnEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method OnEvents not implemented")
+}
+func (UnimplementedTxpoolServer) ContentFrom(context.Context, *ContentFromRequest) (*ContentFromReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ContentFrom not implemented")
+}
 func (UnimplementedTxpoolServer) Status(context.Context, *StatusRequest) (*StatusReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
 }
@@ -356,6 +411,45 @@ func (x *txpoolOnAddServer) Send(m *OnAddReply) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Txpool_OnEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(OnEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TxpoolServer).OnEvents(m, &txpoolOnEventsServer{stream})
+}
+
+type Txpool_OnEventsServer interface {
+	Send(*OnEventsReply) error
+	grpc.ServerStream
+}
+
+type txpoolOnEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *txpoolOnEventsServer) Send(m *OnEventsReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Txpool_ContentFrom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentFromRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TxpoolServer).ContentFrom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/txpool.Txpool/ContentFrom",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TxpoolServer).ContentFrom(ctx, req.(*ContentFromRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Txpool_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StatusRequest)
 	if err := dec(in); err != nil {
@@ -423,6 +517,10 @@ var Txpool_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Pending",
 			Handler:    _Txpool_Pending_Handler,
 		},
+		{
+			MethodName: "ContentFrom",
+			Handler:    _Txpool_ContentFrom_Handler,
+		},
 		{
 			MethodName: "Status",
 			Handler:    _Txpool_Status_Handler,
@@ -438,6 +536,11 @@ var Txpool_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Txpool_OnAdd_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "OnEvents",
+			Handler:       _Txpool_OnEvents_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "txpool/txpool.proto",
 }
@@ -0,0 +1,281 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package btreedb - pure-Go (no cgo) implementation of kv.RwDB: in-memory B-trees,
+// optionally persisted to disk (snapshot file + write-ahead log).
+// Designed for tests and light tools on platforms where MDBX is not available - not for big databases:
+// all data is kept in memory.
+package btreedb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+	"go.uber.org/atomic"
+)
+
+const degree = 32
+
+type TableCfgFunc func(defaultBuckets kv.TableCfg) kv.TableCfg
+
+func WithChaindataTables(defaultBuckets kv.TableCfg) kv.TableCfg {
+	return defaultBuckets
+}
+
+type BtreeOpts struct {
+	bucketsCfg TableCfgFunc
+	path       string
+	inMem      bool
+	readOnly   bool
+	noSync     bool
+	label      kv.Label
+	log        log.Logger
+}
+
+func NewBtreeDB(log log.Logger) BtreeOpts {
+	return BtreeOpts{bucketsCfg: WithChaindataTables, log: log}
+}
+
+func (opts BtreeOpts) Label(label kv.Label) BtreeOpts {
+	opts.label = label
+	return opts
+}
+
+// Path - directory of snapshot and write-ahead log files
+func (opts BtreeOpts) Path(path string) BtreeOpts {
+	opts.path = path
+	return opts
+}
+
+// InMem - nothing is persisted
+func (opts BtreeOpts) InMem() BtreeOpts {
+	opts.inMem = true
+	return opts
+}
+
+func (opts BtreeOpts) Readonly() BtreeOpts {
+	opts.readOnly = true
+	return opts
+}
+
+// NoSync - don't fsync write-ahead log on commit: last commits can be lost on power-off (but not on process crash)
+func (opts BtreeOpts) NoSync() BtreeOpts {
+	opts.noSync = true
+	return opts
+}
+
+func (opts BtreeOpts) WithTablessCfg(f TableCfgFunc) BtreeOpts {
+	opts.bucketsCfg = f
+	return opts
+}
+
+func (opts BtreeOpts) Open() (kv.RwDB, error) {
+	if !opts.inMem && opts.path == "" {
+		return nil, fmt.Errorf("btreedb: path is not set")
+	}
+	db := &BtreeKV{
+		opts:    opts,
+		log:     opts.log,
+		buckets: kv.TableCfg{},
+		state:   &state{tables: map[string]*table{}},
+	}
+	customBuckets := opts.bucketsCfg(kv.ChaindataTablesCfg)
+	for name, cfg := range customBuckets { // copy map to avoid changing global variable
+		db.buckets[name] = cfg
+	}
+
+	if !opts.inMem {
+		if !opts.readOnly {
+			if err := os.MkdirAll(opts.path, 0744); err != nil {
+				return nil, err
+			}
+		}
+		if err := db.load(); err != nil {
+			return nil, fmt.Errorf("btreedb: %s, %w", opts.path, err)
+		}
+	}
+
+	if !opts.readOnly {
+		if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+			for name, cfg := range db.buckets {
+				if cfg.IsDeprecated {
+					continue
+				}
+				if err := tx.CreateBucket(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (opts BtreeOpts) MustOpen() kv.RwDB {
+	db, err := opts.Open()
+	if err != nil {
+		panic(fmt.Errorf("fail to open btreedb: %w", err))
+	}
+	return db
+}
+
+// pair - key-value of table. Immutable: update of value creates new pair
+type pair struct {
+	k, v []byte
+}
+
+func lessPlain(a, b *pair) bool { return bytes.Compare(a.k, b.k) < 0 }
+func lessDup(a, b *pair) bool {
+	if c := bytes.Compare(a.k, b.k); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(a.v, b.v) < 0
+}
+
+// table - DupSort table has many pairs with same key (sorted by value), other tables - 1 pair per key
+type table struct {
+	flags kv.TableFlags
+	tree  *btree.BTreeG[*pair]
+}
+
+func newTable(flags kv.TableFlags) *table {
+	if flags&kv.DupSort != 0 {
+		return &table{flags: flags, tree: btree.NewG(degree, lessDup)}
+	}
+	return &table{flags: flags, tree: btree.NewG(degree, lessPlain)}
+}
+
+func (t *table) clone() *table { return &table{flags: t.flags, tree: t.tree.Clone()} }
+
+// state - committed version of db. Immutable: write transaction works on lazy (copy-on-write) clones of trees
+type state struct {
+	tables map[string]*table
+	txID   uint64
+}
+
+type BtreeKV struct {
+	opts    BtreeOpts
+	log     log.Logger
+	buckets kv.TableCfg
+
+	lock      sync.RWMutex // protects `state`
+	state     *state
+	writeLock sync.Mutex // only 1 write transaction at a time
+	wal       *os.File
+
+	wg     sync.WaitGroup // open transactions
+	closed atomic.Bool
+}
+
+var _ kv.RwDB = (*BtreeKV)(nil)
+
+func (db *BtreeKV) AllBuckets() kv.TableCfg { return db.buckets }
+
+// PageSize - there are no pages, but some callers use it to estimate sizes
+func (db *BtreeKV) PageSize() uint64 { return 4096 }
+
+func (db *BtreeKV) current() *state {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.state
+}
+
+func (db *BtreeKV) BeginRo(_ context.Context) (kv.Tx, error) {
+	if db.closed.Load() {
+		return nil, fmt.Errorf("db closed")
+	}
+	db.wg.Add(1)
+	s := db.current()
+	return &BtreeTx{db: db, tables: s.tables, txID: s.txID, readOnly: true}, nil
+}
+
+func (db *BtreeKV) BeginRw(_ context.Context) (kv.RwTx, error) {
+	if db.closed.Load() {
+		return nil, fmt.Errorf("db closed")
+	}
+	if db.opts.readOnly {
+		return nil, fmt.Errorf("btreedb: db is opened as read-only")
+	}
+	db.writeLock.Lock()
+	db.wg.Add(1)
+	s := db.current()
+	tables := make(map[string]*table, len(s.tables))
+	for name, t := range s.tables {
+		tables[name] = t
+	}
+	return &BtreeTx{db: db, tables: tables, owned: map[string]struct{}{}, txID: s.txID + 1}, nil
+}
+
+func (db *BtreeKV) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *BtreeKV) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close - waits for all transactions, writes snapshot file and truncates write-ahead log
+// All transactions must be closed before closing the database.
+func (db *BtreeKV) Close() {
+	if !db.closed.CAS(false, true) {
+		return
+	}
+	db.wg.Wait()
+	if db.opts.inMem || db.opts.readOnly {
+		return
+	}
+	if err := db.writeSnapshot(); err != nil {
+		db.log.Warn("[btreedb] can't write snapshot, data is kept in log", "path", db.opts.path, "err", err)
+	}
+	if db.wal != nil {
+		_ = db.wal.Close()
+		db.wal = nil
+	}
+}
+
+func (db *BtreeKV) commit(tx *BtreeTx) error {
+	if !db.opts.inMem && len(tx.ops) > 0 {
+		if err := db.appendLog(tx.txID, tx.ops); err != nil {
+			return err
+		}
+	}
+	db.lock.Lock()
+	db.state = &state{tables: tx.tables, txID: tx.txID}
+	db.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,346 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package btreedb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+const testTable, testDupTable = "Table", "DupTable"
+
+func testTables(defaultBuckets kv.TableCfg) kv.TableCfg {
+	return kv.TableCfg{
+		testTable:    kv.TableCfgItem{},
+		testDupTable: kv.TableCfgItem{Flags: kv.DupSort},
+		kv.Sequence:  kv.TableCfgItem{},
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	db := NewBtreeDB(log.New()).InMem().WithTablessCfg(testTables).MustOpen()
+	defer db.Close()
+
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	require.NoError(t, tx.Put(testTable, []byte("b"), []byte("2")))
+	require.NoError(t, tx.Put(testTable, []byte("a"), []byte("1")))
+	require.NoError(t, tx.Put(testTable, []byte("c"), []byte("3")))
+	require.NoError(t, tx.Put(testTable, []byte("a"), []byte("11")))
+
+	v, err := tx.GetOne(testTable, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "11", string(v))
+	v, err = tx.GetOne(testTable, []byte("x"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	c, err := tx.RwCursor(testTable)
+	require.NoError(t, err)
+	defer c.Close()
+	k, _, err := c.Seek([]byte("aa"))
+	require.NoError(t, err)
+	require.Equal(t, "b", string(k))
+	require.NoError(t, c.DeleteCurrent())
+	k, _, err = c.Current()
+	require.NoError(t, err)
+	require.Equal(t, "c", string(k))
+	k, _, err = c.Prev()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(k))
+	k, _, err = c.Last()
+	require.NoError(t, err)
+	require.Equal(t, "c", string(k))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	require.Nil(t, k)
+
+	require.Error(t, tx.Append(testTable, []byte("b"), []byte("2")))
+	require.NoError(t, tx.Append(testTable, []byte("d"), []byte("4")))
+	cnt, err := c.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cnt)
+
+	id, err := tx.IncrementSequence(testTable, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), id)
+	id, err = tx.ReadSequence(testTable)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), id)
+}
+
+func TestDupSort(t *testing.T) {
+	db := NewBtreeDB(log.New()).InMem().WithTablessCfg(testTables).MustOpen()
+	defer db.Close()
+
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	c, err := tx.RwCursorDupSort(testDupTable)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Put([]byte("key1"), []byte("value1.1")))
+	require.NoError(t, c.Put([]byte("key3"), []byte("value3.1")))
+	require.NoError(t, c.Put([]byte("key1"), []byte("value1.3")))
+	require.NoError(t, c.Put([]byte("key3"), []byte("value3.3")))
+	require.NoError(t, c.Put([]byte("key1"), []byte("value1.2")))
+
+	v, err := c.SeekBothRange([]byte("key2"), []byte("value1.2"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = c.SeekBothRange([]byte("key3"), []byte("value3.2"))
+	require.NoError(t, err)
+	require.Equal(t, "value3.3", string(v))
+
+	k, v, err := c.First()
+	require.NoError(t, err)
+	require.Equal(t, "key1", string(k))
+	require.Equal(t, "value1.1", string(v))
+	k, v, err = c.NextDup()
+	require.NoError(t, err)
+	require.Equal(t, "key1", string(k))
+	require.Equal(t, "value1.2", string(v))
+	v, err = c.LastDup()
+	require.NoError(t, err)
+	require.Equal(t, "value1.3", string(v))
+	k, _, err = c.NextDup()
+	require.NoError(t, err)
+	require.Nil(t, k)
+	cnt, err := c.CountDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cnt)
+	k, v, err = c.NextNoDup()
+	require.NoError(t, err)
+	require.Equal(t, "key3", string(k))
+	require.Equal(t, "value3.1", string(v))
+	k, v, err = c.(*BtreeDupSortCursor).PrevNoDup()
+	require.NoError(t, err)
+	require.Equal(t, "key1", string(k))
+	require.Equal(t, "value1.3", string(v))
+
+	require.Error(t, c.PutNoDupData([]byte("key1"), []byte("value1.2")))
+	require.Error(t, c.AppendDup([]byte("key3"), []byte("value3.2")))
+	require.NoError(t, c.AppendDup([]byte("key3"), []byte("value3.4")))
+
+	require.NoError(t, c.Delete([]byte("key3"), []byte("value3.3")))
+	_, v, err = c.SeekBothExact([]byte("key3"), []byte("value3.3"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	_, _, err = c.SeekExact([]byte("key1"))
+	require.NoError(t, err)
+	require.NoError(t, c.DeleteCurrentDuplicates())
+	k, _, err = c.First()
+	require.NoError(t, err)
+	require.Equal(t, "key3", string(k))
+}
+
+func TestAutoDupSortKeysConversion(t *testing.T) {
+	db := NewBtreeDB(log.New()).InMem().MustOpen()
+	defer db.Close()
+
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	cfg := db.AllBuckets()[kv.PlainState]
+	addr := make([]byte, 20)
+	addr[0] = 1
+	storageKey := append(append([]byte{}, addr...), make([]byte, cfg.DupFromLen-len(addr))...)
+	storageKey[len(storageKey)-1] = 2
+	storageKey2 := append([]byte{}, storageKey...)
+	storageKey2[len(storageKey2)-1] = 3
+
+	require.NoError(t, tx.Put(kv.PlainState, addr, []byte("account")))
+	require.NoError(t, tx.Put(kv.PlainState, storageKey2, []byte("v2")))
+	require.NoError(t, tx.Put(kv.PlainState, storageKey, []byte("v1")))
+	require.NoError(t, tx.Put(kv.PlainState, storageKey, []byte("v11")))
+
+	v, err := tx.GetOne(kv.PlainState, storageKey)
+	require.NoError(t, err)
+	require.Equal(t, "v11", string(v))
+
+	var keys, vals []string
+	require.NoError(t, tx.ForEach(kv.PlainState, nil, func(k, v []byte) error {
+		keys, vals = append(keys, string(k)), append(vals, string(v))
+		return nil
+	}))
+	require.Equal(t, []string{string(addr), string(storageKey), string(storageKey2)}, keys)
+	require.Equal(t, []string{"account", "v11", "v2"}, vals)
+
+	require.NoError(t, tx.Delete(kv.PlainState, storageKey, nil))
+	v, err = tx.GetOne(kv.PlainState, storageKey)
+	require.NoError(t, err)
+	require.Nil(t, v)
+}
+
+func TestIsolation(t *testing.T) {
+	db := NewBtreeDB(log.New()).InMem().WithTablessCfg(testTables).MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(testTable, []byte("a"), []byte("1"))
+	}))
+
+	roTx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer roTx.Rollback()
+
+	rwTx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rwTx.Put(testTable, []byte("a"), []byte("2")))
+	require.NoError(t, rwTx.Put(testTable, []byte("b"), []byte("2")))
+	require.NoError(t, rwTx.Commit())
+
+	v, err := roTx.GetOne(testTable, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	has, err := roTx.Has(testTable, []byte("b"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	rwTx, err = db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rwTx.Put(testTable, []byte("c"), []byte("3")))
+	rwTx.Rollback()
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(testTable, []byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, "2", string(v))
+		has, err := tx.Has(testTable, []byte("c"))
+		require.NoError(t, err)
+		require.False(t, has)
+		return nil
+	}))
+}
+
+func TestPersistence(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+	open := func() kv.RwDB {
+		return NewBtreeDB(log.New()).Path(path).WithTablessCfg(testTables).MustOpen()
+	}
+
+	db := open()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put(testTable, []byte("a"), []byte("1")))
+		require.NoError(t, tx.Put(testDupTable, []byte("k"), []byte("1")))
+		return tx.Put(testDupTable, []byte("k"), []byte("2"))
+	}))
+	db.Close()
+
+	// after Close data is in snapshot, new commits - in log only
+	db = open()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Delete(testDupTable, []byte("k"), []byte("1")))
+		return tx.Put(testTable, []byte("b"), []byte("2"))
+	}))
+	// emulate crash: tail of log is torn, db is not closed
+	bt := db.(*BtreeKV)
+	_, err := bt.wal.Write([]byte{0, 0, 0, 100, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, bt.wal.Close())
+
+	db = open()
+	defer db.Close()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(testTable, []byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, "1", string(v))
+		v, err = tx.GetOne(testTable, []byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, "2", string(v))
+		c, err := tx.CursorDupSort(testDupTable)
+		require.NoError(t, err)
+		defer c.Close()
+		cnt := 0
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			require.NoError(t, err)
+			require.Equal(t, "2", string(v))
+			cnt++
+		}
+		require.Equal(t, 1, cnt)
+		return nil
+	}))
+	st, err := os.Stat(filepath.Join(path, logFile))
+	require.NoError(t, err)
+	require.Greater(t, st.Size(), int64(0))
+}
+
+func TestCorruptedLog(t *testing.T) {
+	path := t.TempDir()
+	ctx := context.Background()
+	db := NewBtreeDB(log.New()).Path(path).WithTablessCfg(testTables).MustOpen()
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			return tx.Put(testTable, []byte(k), []byte("1"))
+		}))
+	}
+	// emulate crash: db is not closed, first record of log is damaged
+	require.NoError(t, db.(*BtreeKV).wal.Close())
+	logPath := filepath.Join(path, logFile)
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	data[5] ^= 0xff
+	require.NoError(t, os.WriteFile(logPath, data, 0644))
+
+	_, err = NewBtreeDB(log.New()).Path(path).WithTablessCfg(testTables).Open()
+	require.Error(t, err)
+	st, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), st.Size()) // valid records are not truncated
+}
+
+func TestDeleteRange(t *testing.T) {
+	db := NewBtreeDB(log.New()).InMem().WithTablessCfg(testTables).MustOpen()
+	defer db.Close()
+
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for _, k := range []string{"a", "b1", "b2", "c"} {
+		require.NoError(t, tx.Put(testTable, []byte(k), []byte("v")))
+		require.NoError(t, tx.Put(testDupTable, []byte(k), []byte("1")))
+		require.NoError(t, tx.Put(testDupTable, []byte(k), []byte("2")))
+	}
+	keys := func(table string) (res []string) {
+		require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+			res = append(res, string(k)+string(v))
+			return nil
+		}))
+		return res
+	}
+
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(testTable, []byte("b"), []byte("c")))
+	require.Equal(t, []string{"av", "cv"}, keys(testTable))
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(testDupTable, []byte("b"), nil))
+	require.Equal(t, []string{"a1", "a2"}, keys(testDupTable))
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(testTable, nil, nil))
+	require.Empty(t, keys(testTable))
+}
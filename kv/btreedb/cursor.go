@@ -0,0 +1,863 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package btreedb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+var (
+	errNotFound  = errors.New("not found")
+	errKeyExists = errors.New("key/data pair already exists")
+)
+
+// BtreeCursor - same semantic as MdbxCursor (including AutoDupSortKeysConversion of tables),
+// low-level methods (first/next/set/getBothRange/...) emulate mdbx cursor operations on top of B-tree.
+type BtreeCursor struct {
+	tx         *BtreeTx
+	bucketName string
+	bucketCfg  kv.TableCfgItem
+	dup        bool
+
+	cur     *pair // current position
+	deleted bool  // `cur` was deleted: position is between cur's neighbours
+}
+
+var _ kv.RwCursor = (*BtreeCursor)(nil)
+var _ kv.RwCursorDupSort = (*BtreeDupSortCursor)(nil)
+
+func (c *BtreeCursor) table() (*table, error) { return c.tx.table(c.bucketName) }
+
+func (c *BtreeCursor) less(a, b *pair) bool {
+	if c.dup {
+		return lessDup(a, b)
+	}
+	return lessPlain(a, b)
+}
+
+// seekGE - first pair >= p (or > p if !inclusive)
+func (c *BtreeCursor) seekGE(p *pair, inclusive bool) (*pair, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	var res *pair
+	t.tree.AscendGreaterOrEqual(p, func(i *pair) bool {
+		if !inclusive && !c.less(p, i) {
+			return true
+		}
+		res = i
+		return false
+	})
+	return res, nil
+}
+
+// seekLT - last pair < p
+func (c *BtreeCursor) seekLT(p *pair) (*pair, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	var res *pair
+	t.tree.DescendLessOrEqual(p, func(i *pair) bool {
+		if !c.less(i, p) {
+			return true
+		}
+		res = i
+		return false
+	})
+	return res, nil
+}
+
+// position - moves cursor to p. nil means not found: position doesn't change
+func (c *BtreeCursor) position(p *pair, err error) ([]byte, []byte, error) {
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == nil {
+		return nil, nil, errNotFound
+	}
+	c.cur, c.deleted = p, false
+	return p.k, p.v, nil
+}
+
+func afterKey(k []byte) []byte { return append(common.Copy(k), 0) } // smallest key > k
+
+func (c *BtreeCursor) first() ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, nil, err
+	}
+	p, _ := t.tree.Min()
+	return c.position(p, nil)
+}
+
+func (c *BtreeCursor) last() ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, nil, err
+	}
+	p, _ := t.tree.Max()
+	return c.position(p, nil)
+}
+
+func (c *BtreeCursor) next() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return c.first()
+	}
+	return c.position(c.seekGE(c.cur, c.deleted))
+}
+
+func (c *BtreeCursor) prev() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return c.last()
+	}
+	return c.position(c.seekLT(c.cur))
+}
+
+func (c *BtreeCursor) getCurrent() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return nil, nil, errNotFound
+	}
+	if c.deleted {
+		return c.next()
+	}
+	return c.cur.k, c.cur.v, nil
+}
+
+func (c *BtreeCursor) nextDup() ([]byte, []byte, error) {
+	if c.cur == nil || !c.dup {
+		return nil, nil, errNotFound
+	}
+	p, err := c.seekGE(c.cur, c.deleted)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, c.cur.k) {
+		return nil, nil, errNotFound
+	}
+	return c.position(p, nil)
+}
+
+func (c *BtreeCursor) nextNoDup() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return c.first()
+	}
+	if !c.dup {
+		return c.next()
+	}
+	return c.position(c.seekGE(&pair{k: afterKey(c.cur.k)}, true))
+}
+
+func (c *BtreeCursor) prevDup() ([]byte, []byte, error) {
+	if c.cur == nil || !c.dup {
+		return nil, nil, errNotFound
+	}
+	p, err := c.seekLT(c.cur)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, c.cur.k) {
+		return nil, nil, errNotFound
+	}
+	return c.position(p, nil)
+}
+
+func (c *BtreeCursor) prevNoDup() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return c.last()
+	}
+	return c.position(c.seekLT(&pair{k: c.cur.k}))
+}
+
+func (c *BtreeCursor) firstDup() ([]byte, error) {
+	if c.cur == nil {
+		return nil, errNotFound
+	}
+	p, err := c.seekGE(&pair{k: c.cur.k}, true)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, c.cur.k) {
+		return nil, errNotFound
+	}
+	_, v, err := c.position(p, nil)
+	return v, err
+}
+
+func (c *BtreeCursor) lastDup() ([]byte, error) {
+	if c.cur == nil {
+		return nil, errNotFound
+	}
+	if !c.dup {
+		_, v, err := c.getCurrent()
+		return v, err
+	}
+	p, err := c.seekLT(&pair{k: afterKey(c.cur.k)})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, c.cur.k) {
+		return nil, errNotFound
+	}
+	_, v, err := c.position(p, nil)
+	return v, err
+}
+
+func (c *BtreeCursor) set(k []byte) ([]byte, []byte, error) {
+	p, err := c.seekGE(&pair{k: k}, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, k) {
+		return nil, nil, errNotFound
+	}
+	return c.position(p, nil)
+}
+
+func (c *BtreeCursor) setRange(k []byte) ([]byte, []byte, error) {
+	return c.position(c.seekGE(&pair{k: k}, true))
+}
+
+func (c *BtreeCursor) getBoth(k, v []byte) ([]byte, error) {
+	if !c.dup {
+		_, val, err := c.set(k)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(val, v) {
+			return nil, errNotFound
+		}
+		return val, nil
+	}
+	p, err := c.seekGE(&pair{k: k, v: v}, true)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, k) || !bytes.Equal(p.v, v) {
+		return nil, errNotFound
+	}
+	_, val, err := c.position(p, nil)
+	return val, err
+}
+
+func (c *BtreeCursor) getBothRange(k, v []byte) ([]byte, error) {
+	if !c.dup {
+		_, val, err := c.set(k)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Compare(val, v) < 0 {
+			return nil, errNotFound
+		}
+		return val, nil
+	}
+	p, err := c.seekGE(&pair{k: k, v: v}, true)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !bytes.Equal(p.k, k) {
+		return nil, errNotFound
+	}
+	_, val, err := c.position(p, nil)
+	return val, err
+}
+
+func (c *BtreeCursor) countDups() (uint64, error) {
+	if c.cur == nil {
+		return 0, errNotFound
+	}
+	if !c.dup {
+		return 1, nil
+	}
+	t, err := c.table()
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	t.tree.AscendGreaterOrEqual(&pair{k: c.cur.k}, func(i *pair) bool {
+		if !bytes.Equal(i.k, c.cur.k) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n, nil
+}
+
+func (c *BtreeCursor) put(k, v []byte) error {
+	p := &pair{k: common.Copy(k), v: common.Copy(v)}
+	if p.v == nil {
+		p.v = []byte{}
+	}
+	if err := c.tx.insert(c.bucketName, p); err != nil {
+		return err
+	}
+	c.cur, c.deleted = p, false
+	return nil
+}
+
+func (c *BtreeCursor) putNoOverwrite(k, v []byte) error {
+	p, err := c.seekGE(&pair{k: k}, true)
+	if err != nil {
+		return err
+	}
+	if p != nil && bytes.Equal(p.k, k) {
+		c.cur, c.deleted = p, false
+		return errKeyExists
+	}
+	return c.put(k, v)
+}
+
+func (c *BtreeCursor) putNoDupData(k, v []byte) error {
+	if !c.dup {
+		return c.putNoOverwrite(k, v)
+	}
+	if _, err := c.getBoth(k, v); err == nil {
+		return errKeyExists
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	return c.put(k, v)
+}
+
+// putCurrent - replaces value of current pair
+func (c *BtreeCursor) putCurrent(k, v []byte) error {
+	if c.cur == nil || c.deleted || !bytes.Equal(c.cur.k, k) {
+		return fmt.Errorf("putCurrent: cursor is not positioned on key %x", k)
+	}
+	if c.dup {
+		if err := c.tx.remove(c.bucketName, c.cur); err != nil {
+			return err
+		}
+	}
+	return c.put(k, v)
+}
+
+func (c *BtreeCursor) lastPair() (*pair, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	p, _ := t.tree.Max()
+	return p, nil
+}
+
+func (c *BtreeCursor) append(k, v []byte) error {
+	last, err := c.lastPair()
+	if err != nil {
+		return err
+	}
+	if last != nil && bytes.Compare(last.k, k) >= 0 {
+		return fmt.Errorf("append: key %x is not greater than last key %x", k, last.k)
+	}
+	return c.put(k, v)
+}
+
+func (c *BtreeCursor) appendDup(k, v []byte) error {
+	if !c.dup {
+		return c.append(k, v)
+	}
+	last, err := c.lastPair()
+	if err != nil {
+		return err
+	}
+	if last != nil && !lessDup(last, &pair{k: k, v: v}) {
+		return fmt.Errorf("appendDup: pair %x,%x is not greater than last pair %x,%x", k, v, last.k, last.v)
+	}
+	return c.put(k, v)
+}
+
+func (c *BtreeCursor) delCurrent() error {
+	if c.cur == nil || c.deleted {
+		return errNotFound
+	}
+	if err := c.tx.remove(c.bucketName, c.cur); err != nil {
+		return err
+	}
+	c.deleted = true
+	return nil
+}
+
+// delNoDupData - deletes all values of current key
+func (c *BtreeCursor) delNoDupData() error {
+	if c.cur == nil {
+		return errNotFound
+	}
+	k := c.cur.k
+	for {
+		p, err := c.seekGE(&pair{k: k}, true)
+		if err != nil {
+			return err
+		}
+		if p == nil || !bytes.Equal(p.k, k) {
+			break
+		}
+		if err := c.tx.remove(c.bucketName, p); err != nil {
+			return err
+		}
+	}
+	c.cur, c.deleted = &pair{k: k}, true
+	return nil
+}
+
+func (c *BtreeCursor) Count() (uint64, error) {
+	t, err := c.table()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(t.tree.Len()), nil
+}
+
+func (c *BtreeCursor) First() ([]byte, []byte, error) {
+	return c.Seek(nil)
+}
+
+// autoDupSortKey - joins key and first part of value back, see kv.TableCfgItem.AutoDupSortKeysConversion
+func (c *BtreeCursor) autoDupSortKey(k, v []byte) ([]byte, []byte) {
+	b := c.bucketCfg
+	if b.AutoDupSortKeysConversion && len(k) == b.DupToLen {
+		keyPart := b.DupFromLen - b.DupToLen
+		k2 := make([]byte, 0, len(k)+keyPart)
+		k = append(append(k2, k...), v[:keyPart]...)
+		v = v[keyPart:]
+	}
+	return k, v
+}
+
+func (c *BtreeCursor) Last() ([]byte, []byte, error) {
+	k, v, err := c.last()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("failed BtreeKV cursor.Last(): %w, bucket: %s", err, c.bucketName)
+	}
+	k, v = c.autoDupSortKey(k, v)
+	return k, v, nil
+}
+
+func (c *BtreeCursor) Seek(seek []byte) (k, v []byte, err error) {
+	if c.bucketCfg.AutoDupSortKeysConversion {
+		return c.seekDupSort(seek)
+	}
+
+	if len(seek) == 0 {
+		k, v, err = c.first()
+	} else {
+		k, v, err = c.setRange(seek)
+	}
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("failed BtreeKV cursor.Seek(): %w, bucket: %s,  key: %x", err, c.bucketName, seek)
+	}
+	return k, v, nil
+}
+
+func (c *BtreeCursor) seekDupSort(seek []byte) (k, v []byte, err error) {
+	to := c.bucketCfg.DupToLen
+	if len(seek) == 0 {
+		k, v, err = c.first()
+		if err != nil {
+			if errors.Is(err, errNotFound) {
+				return nil, nil, nil
+			}
+			return []byte{}, nil, err
+		}
+		k, v = c.autoDupSortKey(k, v)
+		return k, v, nil
+	}
+
+	var seek1, seek2 []byte
+	if len(seek) > to {
+		seek1, seek2 = seek[:to], seek[to:]
+	} else {
+		seek1 = seek
+	}
+	k, v, err = c.setRange(seek1)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, err
+	}
+
+	if seek2 != nil && bytes.Equal(seek1, k) {
+		v, err = c.getBothRange(seek1, seek2)
+		if err != nil && errors.Is(err, errNotFound) {
+			k, v, err = c.next()
+			if err != nil {
+				if errors.Is(err, errNotFound) {
+					return nil, nil, nil
+				}
+				return []byte{}, nil, err
+			}
+		} else if err != nil {
+			return []byte{}, nil, err
+		}
+	}
+	k, v = c.autoDupSortKey(k, v)
+	return k, v, nil
+}
+
+func (c *BtreeCursor) Next() (k, v []byte, err error) {
+	k, v, err = c.next()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("failed BtreeKV cursor.Next(): %w", err)
+	}
+	k, v = c.autoDupSortKey(k, v)
+	return k, v, nil
+}
+
+func (c *BtreeCursor) Prev() (k, v []byte, err error) {
+	k, v, err = c.prev()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("failed BtreeKV cursor.Prev(): %w", err)
+	}
+	k, v = c.autoDupSortKey(k, v)
+	return k, v, nil
+}
+
+// Current - return key/data at current cursor position
+func (c *BtreeCursor) Current() ([]byte, []byte, error) {
+	k, v, err := c.getCurrent()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, err
+	}
+	k, v = c.autoDupSortKey(k, v)
+	return k, v, nil
+}
+
+func (c *BtreeCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	b := c.bucketCfg
+	if b.AutoDupSortKeysConversion && len(key) == b.DupFromLen {
+		from, to := b.DupFromLen, b.DupToLen
+		v, err := c.getBothRange(key[:to], key[to:])
+		if err != nil {
+			if errors.Is(err, errNotFound) {
+				return nil, nil, nil
+			}
+			return []byte{}, nil, err
+		}
+		if !bytes.Equal(key[to:], v[:from-to]) {
+			return nil, nil, nil
+		}
+		return key[:to], v[from-to:], nil
+	}
+
+	k, v, err := c.set(key)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *BtreeCursor) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return fmt.Errorf("btreedb doesn't support empty keys. bucket: %s", c.bucketName)
+	}
+	if c.bucketCfg.AutoDupSortKeysConversion {
+		return c.putDupSort(key, value)
+	}
+	if err := c.put(key, value); err != nil {
+		return fmt.Errorf("table: %s, err: %w", c.bucketName, err)
+	}
+	return nil
+}
+
+func (c *BtreeCursor) putDupSort(key []byte, value []byte) error {
+	b := c.bucketCfg
+	from, to := b.DupFromLen, b.DupToLen
+	if len(key) != from && len(key) >= to {
+		return fmt.Errorf("put dupsort bucket: %s, can have keys of len==%d and len<%d. key: %x,%d", c.bucketName, from, to, key, len(key))
+	}
+
+	if len(key) != from {
+		err := c.putNoOverwrite(key, value)
+		if err != nil {
+			if errors.Is(err, errKeyExists) {
+				return c.putCurrent(key, value)
+			}
+			return fmt.Errorf("putNoOverwrite, bucket: %s, key: %x, val: %x, err: %w", c.bucketName, key, value, err)
+		}
+		return nil
+	}
+
+	value = append(common.Copy(key[to:]), value...)
+	key = key[:to]
+	v, err := c.getBothRange(key, value[:from-to])
+	if err != nil { // if key not found, or found another one - then just insert
+		if errors.Is(err, errNotFound) {
+			return c.put(key, value)
+		}
+		return err
+	}
+
+	if bytes.Equal(v[:from-to], value[:from-to]) {
+		if err = c.delCurrent(); err != nil {
+			return err
+		}
+	}
+	return c.put(key, value)
+}
+
+// Append - key must be greater than all keys of table
+func (c *BtreeCursor) Append(k []byte, v []byte) error {
+	if len(k) == 0 {
+		return fmt.Errorf("btreedb doesn't support empty keys. bucket: %s", c.bucketName)
+	}
+	b := c.bucketCfg
+	if b.AutoDupSortKeysConversion {
+		from, to := b.DupFromLen, b.DupToLen
+		if len(k) != from && len(k) >= to {
+			return fmt.Errorf("append dupsort bucket: %s, can have keys of len==%d and len<%d. key: %x,%d", c.bucketName, from, to, k, len(k))
+		}
+		if len(k) == from {
+			v = append(common.Copy(k[to:]), v...)
+			k = k[:to]
+		}
+	}
+
+	if c.dup {
+		if err := c.appendDup(k, v); err != nil {
+			return fmt.Errorf("bucket: %s, %w", c.bucketName, err)
+		}
+		return nil
+	}
+	if err := c.append(k, v); err != nil {
+		return fmt.Errorf("bucket: %s, %w", c.bucketName, err)
+	}
+	return nil
+}
+
+func (c *BtreeCursor) Delete(k, v []byte) error {
+	if c.bucketCfg.AutoDupSortKeysConversion {
+		return c.deleteDupSort(k)
+	}
+
+	if c.dup {
+		if _, err := c.getBoth(k, v); err != nil {
+			if errors.Is(err, errNotFound) {
+				return nil
+			}
+			return err
+		}
+		return c.delCurrent()
+	}
+
+	if _, _, err := c.set(k); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil
+		}
+		return err
+	}
+	return c.delCurrent()
+}
+
+// DeleteCurrent This function deletes the key/data pair to which the cursor refers.
+// This does not invalidate the cursor, so operations such as Next
+// can still be used on it.
+// Both Next and Current will return the same record after
+// this operation.
+func (c *BtreeCursor) DeleteCurrent() error {
+	return c.delCurrent()
+}
+
+func (c *BtreeCursor) deleteDupSort(key []byte) error {
+	b := c.bucketCfg
+	from, to := b.DupFromLen, b.DupToLen
+	if len(key) != from && len(key) >= to {
+		return fmt.Errorf("delete from dupsort bucket: %s, can have keys of len==%d and len<%d. key: %x,%d", c.bucketName, from, to, key, len(key))
+	}
+
+	if len(key) == from {
+		v, err := c.getBothRange(key[:to], key[to:])
+		if err != nil { // if key not found, or found another one - then nothing to delete
+			if errors.Is(err, errNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !bytes.Equal(v[:from-to], key[to:]) {
+			return nil
+		}
+		return c.delCurrent()
+	}
+
+	if _, _, err := c.set(key); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil
+		}
+		return err
+	}
+	return c.delCurrent()
+}
+
+func (c *BtreeCursor) Close() {
+	c.cur = nil
+}
+
+type BtreeDupSortCursor struct {
+	*BtreeCursor
+}
+
+func (c *BtreeDupSortCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	v, err := c.getBoth(key, value)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("in SeekBothExact: %w", err)
+	}
+	return key, v, nil
+}
+
+func (c *BtreeDupSortCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	v, err := c.getBothRange(key, value)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("in SeekBothRange: %w", err)
+	}
+	return v, nil
+}
+
+func (c *BtreeDupSortCursor) FirstDup() ([]byte, error) {
+	v, err := c.firstDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("in FirstDup: %w", err)
+	}
+	return v, nil
+}
+
+// NextDup - iterate only over duplicates of current key
+func (c *BtreeDupSortCursor) NextDup() ([]byte, []byte, error) {
+	k, v, err := c.nextDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("in NextDup: %w", err)
+	}
+	return k, v, nil
+}
+
+// NextNoDup - iterate with skipping all duplicates
+func (c *BtreeDupSortCursor) NextNoDup() ([]byte, []byte, error) {
+	k, v, err := c.nextNoDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("in NextNoDup: %w", err)
+	}
+	return k, v, nil
+}
+
+func (c *BtreeDupSortCursor) PrevDup() ([]byte, []byte, error) {
+	k, v, err := c.prevDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("in PrevDup: %w", err)
+	}
+	return k, v, nil
+}
+
+func (c *BtreeDupSortCursor) PrevNoDup() ([]byte, []byte, error) {
+	k, v, err := c.prevNoDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil, nil
+		}
+		return []byte{}, nil, fmt.Errorf("in PrevNoDup: %w", err)
+	}
+	return k, v, nil
+}
+
+func (c *BtreeDupSortCursor) LastDup() ([]byte, error) {
+	v, err := c.lastDup()
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("in LastDup: %w", err)
+	}
+	return v, nil
+}
+
+func (c *BtreeDupSortCursor) Append(k []byte, v []byte) error {
+	if err := c.appendDup(k, v); err != nil {
+		return fmt.Errorf("in Append: bucket=%s, %w", c.bucketName, err)
+	}
+	return nil
+}
+
+func (c *BtreeDupSortCursor) AppendDup(k []byte, v []byte) error {
+	if err := c.appendDup(k, v); err != nil {
+		return fmt.Errorf("in AppendDup: bucket=%s, %w", c.bucketName, err)
+	}
+	return nil
+}
+
+func (c *BtreeDupSortCursor) PutNoDupData(key, value []byte) error {
+	if err := c.putNoDupData(key, value); err != nil {
+		return fmt.Errorf("in PutNoDupData: %w", err)
+	}
+	return nil
+}
+
+// DeleteCurrentDuplicates - delete all of the data items for the current key.
+func (c *BtreeDupSortCursor) DeleteCurrentDuplicates() error {
+	if err := c.delNoDupData(); err != nil {
+		return fmt.Errorf("in DeleteCurrentDuplicates: %w", err)
+	}
+	return nil
+}
+
+// CountDuplicates returns the number of duplicates for the current key
+func (c *BtreeDupSortCursor) CountDuplicates() (uint64, error) {
+	res, err := c.countDups()
+	if err != nil {
+		return 0, fmt.Errorf("in CountDuplicates: %w", err)
+	}
+	return res, nil
+}
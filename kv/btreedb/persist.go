@@ -0,0 +1,405 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package btreedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// On-disk format:
+//   - snapshot file: magic, txID, tables (name, flags, pairs), crc32 of all previous bytes
+//   - write-ahead log: records of committed transactions: [len][txID, ops][crc32]
+//
+// Commit appends record to log (and fsyncs it), Close writes new snapshot and truncates log.
+// On open: snapshot is loaded and log is replayed on top of it - torn record at the end of log
+// (crash during commit) is ignored.
+
+const (
+	snapshotFile = "btree.dat"
+	logFile      = "btree.log"
+	magic        = uint32(0xb7eedb01)
+)
+
+const (
+	opPut byte = iota
+	opDelete
+	opClear
+	opCreate
+	opDrop
+)
+
+// op - one change of write transaction
+type op struct {
+	typ   byte
+	table string
+	k, v  []byte
+	flags kv.TableFlags
+}
+
+func appendUvarint(w []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(w, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendUint64(w []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(w, b[:]...)
+}
+
+func appendUint32(w []byte, v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return append(w, b[:]...)
+}
+
+func putBytes(w []byte, b []byte) []byte {
+	w = appendUvarint(w, uint64(len(b)))
+	return append(w, b...)
+}
+
+func encodeOps(txID uint64, ops []op) []byte {
+	buf := appendUint64(nil, txID)
+	for _, o := range ops {
+		buf = append(buf, o.typ)
+		buf = putBytes(buf, []byte(o.table))
+		switch o.typ {
+		case opPut, opDelete:
+			buf = putBytes(buf, o.k)
+			buf = putBytes(buf, o.v)
+		case opCreate:
+			buf = appendUvarint(buf, uint64(o.flags))
+		}
+	}
+	return buf
+}
+
+// decoder - reader of length-prefixed fields, remembers first error
+type decoder struct {
+	r   io.ByteReader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	for i := range b {
+		if b[i], d.err = d.r.ReadByte(); d.err != nil {
+			return nil
+		}
+	}
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+func (d *decoder) uint64() uint64 {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<8 | uint64(d.byte())
+	}
+	return v
+}
+
+type byteReader struct {
+	b []byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	if len(r.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b, nil
+}
+
+func decodeOps(payload []byte) (txID uint64, ops []op, err error) {
+	r := &byteReader{b: payload}
+	d := &decoder{r: r}
+	txID = d.uint64()
+	for d.err == nil && len(r.b) > 0 {
+		o := op{typ: d.byte(), table: string(d.bytes())}
+		switch o.typ {
+		case opPut, opDelete:
+			o.k, o.v = d.bytes(), d.bytes()
+		case opCreate:
+			o.flags = kv.TableFlags(d.uvarint())
+		case opClear, opDrop:
+		default:
+			return 0, nil, fmt.Errorf("unknown log op: %d", o.typ)
+		}
+		ops = append(ops, o)
+	}
+	return txID, ops, d.err
+}
+
+// apply - replays ops on top of state (which is owned by caller)
+func (s *state) apply(ops []op) error {
+	for _, o := range ops {
+		switch o.typ {
+		case opCreate:
+			if _, ok := s.tables[o.table]; !ok {
+				s.tables[o.table] = newTable(o.flags)
+			}
+			continue
+		case opDrop:
+			delete(s.tables, o.table)
+			continue
+		}
+		t, ok := s.tables[o.table]
+		if !ok {
+			return fmt.Errorf("log refers to table: %s, which doesn't exist", o.table)
+		}
+		switch o.typ {
+		case opPut:
+			t.tree.ReplaceOrInsert(&pair{k: o.k, v: o.v})
+		case opDelete:
+			t.tree.Delete(&pair{k: o.k, v: o.v})
+		case opClear:
+			s.tables[o.table] = newTable(t.flags)
+		}
+	}
+	return nil
+}
+
+func (db *BtreeKV) load() error {
+	s, err := readSnapshot(filepath.Join(db.opts.path, snapshotFile))
+	if err != nil {
+		return err
+	}
+	if err := db.replayLog(s); err != nil {
+		return err
+	}
+	db.state = s
+	return nil
+}
+
+func readSnapshot(path string) (*state, error) {
+	s := &state{tables: map[string]*table{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("snapshot file is too short: %d", len(data))
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("snapshot file is corrupted: checksum mismatch")
+	}
+	if binary.BigEndian.Uint32(body) != magic {
+		return nil, fmt.Errorf("not a btreedb snapshot file")
+	}
+	r := &byteReader{b: body[4:]}
+	d := &decoder{r: r}
+	s.txID = d.uint64()
+	for tablesAmount := d.uvarint(); tablesAmount > 0 && d.err == nil; tablesAmount-- {
+		name := string(d.bytes())
+		t := newTable(kv.TableFlags(d.uvarint()))
+		for pairsAmount := d.uvarint(); pairsAmount > 0 && d.err == nil; pairsAmount-- {
+			t.tree.ReplaceOrInsert(&pair{k: d.bytes(), v: d.bytes()})
+		}
+		s.tables[name] = t
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("snapshot file is corrupted: %w", d.err)
+	}
+	return s, nil
+}
+
+// replayLog - applies committed transactions newer than snapshot. Opens log for appending
+func (db *BtreeKV) replayLog(s *state) error {
+	path := filepath.Join(db.opts.path, logFile)
+	flags := os.O_RDWR | os.O_CREATE
+	if db.opts.readOnly {
+		flags = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		if db.opts.readOnly && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r := bufio.NewReader(f)
+	var valid int64 // end of last valid record
+	var header [4]byte
+	for {
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[:])+4)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			break
+		}
+		payload, sum := payload[:len(payload)-4], binary.BigEndian.Uint32(payload[len(payload)-4:])
+		if crc32.ChecksumIEEE(payload) != sum {
+			// only the last record can be torn by crash, records after bad one are not dropped
+			if end := valid + int64(len(header)+len(payload)+4); end < st.Size() {
+				_ = f.Close()
+				return fmt.Errorf("log %s is corrupted: checksum mismatch of record at offset %d, %d bytes after it", path, valid, st.Size()-end)
+			}
+			err = fmt.Errorf("checksum mismatch")
+			break
+		}
+		txID, ops, err := decodeOps(payload)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("log %s is corrupted: record at offset %d: %w", path, valid, err)
+		}
+		if txID > s.txID {
+			if err := s.apply(ops); err != nil {
+				_ = f.Close()
+				return err
+			}
+			s.txID = txID
+		}
+		valid += int64(len(header) + len(payload) + 4)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		db.log.Warn("[btreedb] ignoring torn tail of log", "path", path, "offset", valid, "err", err)
+	}
+
+	if db.opts.readOnly {
+		return f.Close()
+	}
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	db.wal = f
+	return nil
+}
+
+func (db *BtreeKV) appendLog(txID uint64, ops []op) error {
+	if db.wal == nil {
+		return fmt.Errorf("btreedb: log is not open")
+	}
+	payload := encodeOps(txID, ops)
+	rec := make([]byte, 0, len(payload)+8)
+	rec = appendUint32(rec, uint32(len(payload)))
+	rec = append(rec, payload...)
+	rec = appendUint32(rec, crc32.ChecksumIEEE(payload))
+	if _, err := db.wal.Write(rec); err != nil {
+		return fmt.Errorf("btreedb: write log: %w", err)
+	}
+	if db.opts.noSync {
+		return nil
+	}
+	if err := db.wal.Sync(); err != nil {
+		return fmt.Errorf("btreedb: sync log: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshot - writes all tables to new snapshot file (atomically replacing old one) and truncates log
+func (db *BtreeKV) writeSnapshot() error {
+	s := db.current()
+	buf := appendUint32(nil, magic)
+	buf = appendUint64(buf, s.txID)
+
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = appendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		t := s.tables[name]
+		buf = putBytes(buf, []byte(name))
+		buf = appendUvarint(buf, uint64(t.flags))
+		buf = appendUvarint(buf, uint64(t.tree.Len()))
+		t.tree.Ascend(func(p *pair) bool {
+			buf = putBytes(buf, p.k)
+			buf = putBytes(buf, p.v)
+			return true
+		})
+	}
+	buf = appendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	path := filepath.Join(db.opts.path, snapshotFile)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if db.wal != nil {
+		if err := db.wal.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := db.wal.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,485 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package btreedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// BtreeTx - read transaction sees snapshot of db at moment of begin.
+// Write transaction modifies copy-on-write clones of trees, Commit publishes them atomically.
+type BtreeTx struct {
+	db       *BtreeKV
+	tables   map[string]*table
+	owned    map[string]struct{} // tables cloned by this write transaction - can be modified in-place
+	ops      []op                // changes to persist on commit
+	txID     uint64
+	readOnly bool
+	done     bool
+
+	statelessCursors map[string]kv.RwCursor
+	hooks            kv.TxHooks
+}
+
+var _ kv.RwTx = (*BtreeTx)(nil)
+var _ kv.TableDropper = (*BtreeTx)(nil)
+var _ kv.Ranger = (*BtreeTx)(nil)
+var _ kv.TableStatsReader = (*BtreeTx)(nil)
+var _ kv.ManyGetter = (*BtreeTx)(nil)
+var _ kv.RangeDeleter = (*BtreeTx)(nil)
+var _ kv.CommitHooks = (*BtreeTx)(nil)
+
+func (tx *BtreeTx) ViewID() uint64 { return tx.txID }
+
+func (tx *BtreeTx) PreCommit(f func() error) { tx.hooks.PreCommit(f) }
+func (tx *BtreeTx) PostCommit(f func())      { tx.hooks.PostCommit(f) }
+
+func (tx *BtreeTx) Commit() error {
+	if tx.done {
+		return nil
+	}
+	if err := tx.hooks.RunPreCommit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.commit(); err != nil {
+		return err
+	}
+	tx.hooks.RunPostCommit()
+	return nil
+}
+
+func (tx *BtreeTx) commit() error {
+	tx.done = true
+	defer tx.db.wg.Done()
+	if tx.readOnly {
+		return nil
+	}
+	defer tx.db.writeLock.Unlock()
+	return tx.db.commit(tx)
+}
+
+func (tx *BtreeTx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.hooks.Reset()
+	tx.done = true
+	tx.db.wg.Done()
+	if !tx.readOnly {
+		tx.db.writeLock.Unlock()
+	}
+}
+
+func (tx *BtreeTx) CollectMetrics() {}
+
+func (tx *BtreeTx) table(name string) (*table, error) {
+	t, ok := tx.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table: %s, doesn't exist", name)
+	}
+	return t, nil
+}
+
+// writable - table which can be modified in-place by this transaction
+func (tx *BtreeTx) writable(name string) (*table, error) {
+	if tx.readOnly {
+		return nil, fmt.Errorf("table: %s, write in read-only transaction", name)
+	}
+	t, err := tx.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tx.owned[name]; !ok {
+		t = t.clone()
+		tx.tables[name] = t
+		tx.owned[name] = struct{}{}
+	}
+	return t, nil
+}
+
+func (tx *BtreeTx) insert(name string, p *pair) error {
+	t, err := tx.writable(name)
+	if err != nil {
+		return err
+	}
+	t.tree.ReplaceOrInsert(p)
+	tx.ops = append(tx.ops, op{typ: opPut, table: name, k: p.k, v: p.v})
+	return nil
+}
+
+func (tx *BtreeTx) remove(name string, p *pair) error {
+	t, err := tx.writable(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.tree.Delete(p); ok {
+		tx.ops = append(tx.ops, op{typ: opDelete, table: name, k: p.k, v: p.v})
+	}
+	return nil
+}
+
+func (tx *BtreeTx) CreateBucket(name string) error {
+	if _, ok := tx.tables[name]; ok {
+		return nil
+	}
+	if tx.readOnly {
+		return fmt.Errorf("create table: %s, in read-only transaction", name)
+	}
+	flags := tx.db.buckets[name].Flags
+	if flags&^kv.DupSort != 0 {
+		return fmt.Errorf("some not supported flag provided for bucket")
+	}
+	tx.tables[name] = newTable(flags)
+	tx.owned[name] = struct{}{}
+	tx.ops = append(tx.ops, op{typ: opCreate, table: name, flags: flags})
+	return nil
+}
+
+// ForceDropBucket - drops table even if it's not deprecated, see kv.TableDropper
+func (tx *BtreeTx) ForceDropBucket(name string) error {
+	if tx.readOnly {
+		return fmt.Errorf("drop table: %s, in read-only transaction", name)
+	}
+	if _, ok := tx.tables[name]; !ok {
+		return nil
+	}
+	delete(tx.tables, name)
+	delete(tx.owned, name)
+	delete(tx.statelessCursors, name)
+	tx.ops = append(tx.ops, op{typ: opDrop, table: name})
+	return nil
+}
+
+func (tx *BtreeTx) DropBucket(name string) error {
+	if cfg, ok := tx.db.buckets[name]; !(ok && cfg.IsDeprecated) {
+		return fmt.Errorf("%w, bucket: %s", kv.ErrAttemptToDeleteNonDeprecatedBucket, name)
+	}
+	return tx.ForceDropBucket(name)
+}
+
+func (tx *BtreeTx) ExistsBucket(name string) (bool, error) {
+	_, ok := tx.tables[name]
+	return ok, nil
+}
+
+func (tx *BtreeTx) ClearBucket(name string) error {
+	t, ok := tx.tables[name]
+	if !ok {
+		return nil
+	}
+	if tx.readOnly {
+		return fmt.Errorf("clear table: %s, in read-only transaction", name)
+	}
+	tx.tables[name] = newTable(t.flags)
+	tx.owned[name] = struct{}{}
+	tx.ops = append(tx.ops, op{typ: opClear, table: name})
+	return nil
+}
+
+// DeleteRange - see kv.RwTx. Whole table is cleared by replacing its tree
+func (tx *BtreeTx) DeleteRange(name string, fromKey, toKey []byte) error {
+	if fromKey == nil && toKey == nil {
+		return tx.ClearBucket(name)
+	}
+	if _, ok := tx.tables[name]; !ok {
+		return nil
+	}
+	c, err := tx.stdCursor(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	delAllValues := c.dup && !c.bucketCfg.AutoDupSortKeysConversion
+	for k, _, err := c.Seek(fromKey); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return fmt.Errorf("DeleteRange %s: %w", name, err)
+		}
+		if toKey != nil && bytes.Compare(k, toKey) >= 0 {
+			break
+		}
+		if delAllValues {
+			err = c.delNoDupData()
+		} else {
+			err = c.delCurrent()
+		}
+		if err != nil {
+			return fmt.Errorf("DeleteRange %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (tx *BtreeTx) ListBuckets() ([]string, error) {
+	res := make([]string, 0, len(tx.tables))
+	for name := range tx.tables {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (tx *BtreeTx) statelessCursor(name string) (kv.RwCursor, error) {
+	if tx.statelessCursors == nil {
+		tx.statelessCursors = map[string]kv.RwCursor{}
+	}
+	c, ok := tx.statelessCursors[name]
+	if !ok {
+		var err error
+		if c, err = tx.RwCursor(name); err != nil {
+			return nil, err
+		}
+		tx.statelessCursors[name] = c
+	}
+	return c, nil
+}
+
+func (tx *BtreeTx) Put(name string, k, v []byte) error {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return err
+	}
+	return c.Put(k, v)
+}
+
+func (tx *BtreeTx) Delete(name string, k, v []byte) error {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return err
+	}
+	return c.Delete(k, v)
+}
+
+func (tx *BtreeTx) GetOne(name string, k []byte) ([]byte, error) {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.SeekExact(k)
+	return v, err
+}
+
+func (tx *BtreeTx) GetMany(name string, keys [][]byte) ([][]byte, error) {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([][]byte, len(keys))
+	for i := range keys {
+		if _, vals[i], err = c.SeekExact(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *BtreeTx) Range(name string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	c, err := tx.Cursor(name)
+	if err != nil {
+		return nil, err
+	}
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
+
+func (tx *BtreeTx) Has(name string, k []byte) (bool, error) {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return false, err
+	}
+	key, _, err := c.Seek(k)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(k, key), nil
+}
+
+func (tx *BtreeTx) Append(name string, k, v []byte) error {
+	c, err := tx.statelessCursor(name)
+	if err != nil {
+		return err
+	}
+	return c.Append(k, v)
+}
+
+func (tx *BtreeTx) AppendDup(name string, k, v []byte) error {
+	c, err := tx.RwCursorDupSort(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.AppendDup(k, v)
+}
+
+func (tx *BtreeTx) IncrementSequence(name string, amount uint64) (uint64, error) {
+	current, err := tx.ReadSequence(name)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	if err := tx.Put(kv.Sequence, []byte(name), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (tx *BtreeTx) ReadSequence(name string) (uint64, error) {
+	v, err := tx.GetOne(kv.Sequence, []byte(name))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (tx *BtreeTx) ForEach(name string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *BtreeTx) ForPrefix(name string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *BtreeTx) ForAmount(name string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	c, err := tx.Cursor(name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+// TableStats - there are no pages: Bytes is size of keys and values
+func (tx *BtreeTx) TableStats(name string) (kv.TableStats, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return kv.TableStats{}, err
+	}
+	st := kv.TableStats{Entries: uint64(t.tree.Len())}
+	t.tree.Ascend(func(p *pair) bool {
+		st.Bytes += uint64(len(p.k) + len(p.v))
+		return true
+	})
+	return st, nil
+}
+
+func (tx *BtreeTx) BucketSize(name string) (uint64, error) {
+	st, err := tx.TableStats(name)
+	if err != nil {
+		return 0, err
+	}
+	return st.Bytes, nil
+}
+
+func (tx *BtreeTx) DBSize() (uint64, error) {
+	var size uint64
+	for name := range tx.tables {
+		sz, err := tx.BucketSize(name)
+		if err != nil {
+			return 0, err
+		}
+		size += sz
+	}
+	return size, nil
+}
+
+func (tx *BtreeTx) RwCursor(name string) (kv.RwCursor, error) {
+	b := tx.db.buckets[name]
+	if b.AutoDupSortKeysConversion {
+		return tx.stdCursor(name)
+	}
+	if t, ok := tx.tables[name]; ok && t.flags&kv.DupSort != 0 {
+		return tx.RwCursorDupSort(name)
+	}
+	return tx.stdCursor(name)
+}
+
+func (tx *BtreeTx) Cursor(name string) (kv.Cursor, error) {
+	return tx.RwCursor(name)
+}
+
+func (tx *BtreeTx) stdCursor(name string) (*BtreeCursor, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return nil, err
+	}
+	return &BtreeCursor{tx: tx, bucketName: name, bucketCfg: tx.db.buckets[name], dup: t.flags&kv.DupSort != 0}, nil
+}
+
+func (tx *BtreeTx) RwCursorDupSort(name string) (kv.RwCursorDupSort, error) {
+	c, err := tx.stdCursor(name)
+	if err != nil {
+		return nil, err
+	}
+	return &BtreeDupSortCursor{BtreeCursor: c}, nil
+}
+
+func (tx *BtreeTx) CursorDupSort(name string) (kv.CursorDupSort, error) {
+	return tx.RwCursorDupSort(name)
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type ExportFormat string
+
+const (
+	ExportCSV   ExportFormat = "csv"   // header "table,key,value", then 1 line per pair
+	ExportJSONL ExportFormat = "jsonl" // 1 json object per line: {"table":"...","key":"...","value":"..."}
+)
+
+// ExportEncoding - how keys/values are written
+type ExportEncoding string
+
+const (
+	EncodingHex    ExportEncoding = "hex"
+	EncodingBase64 ExportEncoding = "base64"
+	EncodingString ExportEncoding = "string" // as is - for human-readable data. Invalid UTF-8 is replaced in JSONL
+)
+
+type ExportOpts struct {
+	Format        ExportFormat
+	KeyEncoding   ExportEncoding
+	ValueEncoding ExportEncoding
+	Prefix        []byte // export only keys with this prefix
+	Limit         uint64 // max amount of pairs per table, 0 - unlimited
+}
+
+var DefaultExportOpts = ExportOpts{Format: ExportCSV, KeyEncoding: EncodingHex, ValueEncoding: EncodingHex}
+
+// Exporter - writes tables to CSV/JSONL stream. All tables are read in 1 read transaction - export is consistent.
+type Exporter struct {
+	db   RoDB
+	opts ExportOpts
+}
+
+func NewExporter(db RoDB, opts ExportOpts) *Exporter {
+	if opts.Format == "" {
+		opts.Format = DefaultExportOpts.Format
+	}
+	if opts.KeyEncoding == "" {
+		opts.KeyEncoding = DefaultExportOpts.KeyEncoding
+	}
+	if opts.ValueEncoding == "" {
+		opts.ValueEncoding = DefaultExportOpts.ValueEncoding
+	}
+	return &Exporter{db: db, opts: opts}
+}
+
+func encode(enc ExportEncoding, b []byte) (string, error) {
+	switch enc {
+	case EncodingHex:
+		return hex.EncodeToString(b), nil
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case EncodingString:
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("unknown export encoding: %s", enc)
+	}
+}
+
+type exportRow struct {
+	Table string `json:"table"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Export - writes tables (in given order) to w. Returns amount of exported pairs
+func (e *Exporter) Export(ctx context.Context, w io.Writer, tables ...string) (exported uint64, err error) {
+	if _, err := encode(e.opts.KeyEncoding, nil); err != nil {
+		return 0, err
+	}
+	if _, err := encode(e.opts.ValueEncoding, nil); err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriterSize(w, 1024*1024)
+	defer func() {
+		if flushErr := bw.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	var write func(row exportRow) error
+	switch e.opts.Format {
+	case ExportCSV:
+		cw := csv.NewWriter(bw)
+		if err := cw.Write([]string{"table", "key", "value"}); err != nil {
+			return 0, err
+		}
+		write = func(row exportRow) error { return cw.Write([]string{row.Table, row.Key, row.Value}) }
+		defer func() { // before flush of bw
+			cw.Flush()
+			if err == nil {
+				err = cw.Error()
+			}
+		}()
+	case ExportJSONL:
+		je := json.NewEncoder(bw)
+		write = func(row exportRow) error { return je.Encode(row) }
+	default:
+		return 0, fmt.Errorf("unknown export format: %s", e.opts.Format)
+	}
+
+	err = e.db.View(ctx, func(tx Tx) error {
+		for _, table := range tables {
+			var n uint64
+			if err := tx.ForPrefix(table, e.opts.Prefix, func(k, v []byte) error {
+				if e.opts.Limit > 0 && n >= e.opts.Limit {
+					return errLimitReached
+				}
+				if n%10_000 == 0 {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					default:
+					}
+				}
+				key, _ := encode(e.opts.KeyEncoding, k)
+				val, _ := encode(e.opts.ValueEncoding, v)
+				if err := write(exportRow{Table: table, Key: key, Value: val}); err != nil {
+					return err
+				}
+				n++
+				return nil
+			}); err != nil && !errors.Is(err, errLimitReached) {
+				return fmt.Errorf("export table %s: %w", table, err)
+			}
+			exported += n
+		}
+		return nil
+	})
+	return exported, err
+}
+
+var errLimitReached = errors.New("limit reached")
@@ -0,0 +1,107 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Follower - read-only view of db which is written by other process (sidecar: analytics, indexers, ...).
+// For MDBX - open db by MdbxOpts.Follower. Read tx sees snapshot of db at moment of begin: Refresh moves
+// follower to latest committed state. Holds 1 read tx (and slot of roTxsLimiter) until Close.
+// Tx is not thread-safe: View calls from different goroutines run one by one, Refresh waits for running View
+type Follower struct {
+	mu sync.Mutex
+	tx *RenewableTx
+}
+
+func NewFollower(ctx context.Context, db RoDB) (*Follower, error) {
+	tx, err := NewRenewableTx(ctx, db, 0) // only explicit Refresh
+	if err != nil {
+		return nil, err
+	}
+	return &Follower{tx: tx}, nil
+}
+
+// View - fn reads current view of follower. tx and data read from it are valid only inside fn.
+// fn must not call methods of follower
+func (f *Follower) View(fn func(tx Tx) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fn(f.tx)
+}
+
+// ViewID - id of last write tx visible by follower
+func (f *Follower) ViewID() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tx.ViewID()
+}
+
+// Refresh - moves follower to latest committed state, changed is false if nothing was committed since previous view.
+// After error View fails until successful Refresh
+func (f *Follower) Refresh() (changed bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev := f.tx.ViewID() // 0 if previous Refresh failed
+	if f.tx.tx == nil {
+		err = f.tx.begin()
+	} else {
+		err = f.tx.Renew()
+	}
+	if err != nil {
+		return false, err
+	}
+	return f.tx.ViewID() != prev, nil
+}
+
+// Poll - calls Refresh every period and onChange with new view if db changed. Blocks until ctx is done
+// (returns ctx.Err()) or until error of Refresh or onChange. period must be positive
+func (f *Follower) Poll(ctx context.Context, period time.Duration, onChange func(tx Tx) error) error {
+	if period <= 0 {
+		return fmt.Errorf("follower poll: non-positive period %s", period)
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		changed, err := f.Refresh()
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := f.View(onChange); err != nil {
+			return err
+		}
+	}
+}
+
+// Close - closes read tx, follower can't be used after
+func (f *Follower) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tx.Rollback()
+}
@@ -1,11 +1,13 @@
 package kv
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"time"
 
 	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"go.uber.org/atomic"
 )
 
@@ -61,6 +63,20 @@ func BigChunks(db RoDB, table string, from []byte, walker func(tx Tx, k, v []byt
 	return nil
 }
 
+// NextSubtree does []byte++. Returns false if overflow.
+// Useful to get upper bound of prefix: all keys with prefix are in [prefix, NextSubtree(prefix))
+func NextSubtree(in []byte) ([]byte, bool) {
+	r := make([]byte, len(in))
+	copy(r, in)
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i] != 255 {
+			r[i]++
+			return r[:i+1], true
+		}
+	}
+	return nil, false
+}
+
 var (
 	bytesTrue  = []byte{1}
 	bytesFalse = []byte{0}
@@ -133,3 +149,111 @@ func ReadAhead(ctx context.Context, db RoDB, progress *atomic.Bool, table string
 		})
 	}()
 }
+
+// BatchSeeker - cursors which can do many SeekBothRange calls in one call (for example remote cursors - in one
+// network round-trip)
+type BatchSeeker interface {
+	SeekBothRangeMulti(keys, values [][]byte) ([][]byte, error)
+}
+
+// SeekBothRangeMulti - does c.SeekBothRange(keys[i], values[i]) for each i, res[i] is nil if nothing found.
+// Cursor stays positioned by last seek.
+func SeekBothRangeMulti(c CursorDupSort, keys, values [][]byte) ([][]byte, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("SeekBothRangeMulti: len(keys)=%d != len(values)=%d", len(keys), len(values))
+	}
+	if bc, ok := c.(BatchSeeker); ok {
+		return bc.SeekBothRangeMulti(keys, values)
+	}
+	res := make([][]byte, len(keys))
+	for i := range keys {
+		v, err := c.SeekBothRange(keys[i], values[i])
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// AppendDupBatch - does c.AppendDup(keys[i], values[i]) for each i. Pairs must be sorted
+func AppendDupBatch(c RwCursorDupSort, keys, values [][]byte) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("AppendDupBatch: len(keys)=%d != len(values)=%d", len(keys), len(values))
+	}
+	for i := range keys {
+		if err := c.AppendDup(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Range - see Ranger, for transactions which don't implement it - stream over cursor
+func Range(tx Tx, table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	if r, ok := tx.(Ranger); ok {
+		return r.Range(table, fromPrefix, toPrefix)
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
+
+// ReadTableStats - see TableStatsReader, ErrNotSupported for transactions which don't implement it
+func ReadTableStats(tx Tx, table string) (TableStats, error) {
+	if r, ok := tx.(TableStatsReader); ok {
+		return r.TableStats(table)
+	}
+	return TableStats{}, fmt.Errorf("table %s: %w", table, ErrNotSupported)
+}
+
+// GetMany - see ManyGetter, for transactions which don't implement it - GetOne of each key
+func GetMany(tx Tx, table string, keys [][]byte) ([][]byte, error) {
+	if g, ok := tx.(ManyGetter); ok {
+		return g.GetMany(table, keys)
+	}
+	vals := make([][]byte, len(keys))
+	for i, k := range keys {
+		v, err := tx.GetOne(table, k)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// DeleteRange - see RangeDeleter, for transactions which don't implement it - keys of range are collected, then
+// deleted one by one
+func DeleteRange(tx RwTx, table string, fromKey, toKey []byte) error {
+	if d, ok := tx.(RangeDeleter); ok {
+		return d.DeleteRange(table, fromKey, toKey)
+	}
+	if fromKey == nil && toKey == nil {
+		return tx.ClearBucket(table)
+	}
+	it, err := Range(tx, table, fromKey, toKey)
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	for it.HasNext() {
+		k, _, err := it.Next()
+		if err != nil {
+			iter.Close(it)
+			return err
+		}
+		if len(keys) == 0 || !bytes.Equal(keys[len(keys)-1], k) { // DupSort: 1 key per all values
+			keys = append(keys, common.Copy(k))
+		}
+	}
+	iter.Close(it)
+	for _, k := range keys {
+		if err := tx.Delete(table, k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
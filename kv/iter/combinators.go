@@ -0,0 +1,326 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package iter
+
+import (
+	"bytes"
+
+	"golang.org/x/exp/constraints"
+)
+
+// UnionKV - merge of 2 sorted streams. If both have same key - pair of x is returned, pair of y is skipped
+func UnionKV(x, y KV) KV {
+	m := &unionKV{x: x, y: y}
+	m.advanceX()
+	m.advanceY()
+	return m
+}
+
+type unionKV struct {
+	x, y           KV
+	xHas, yHas     bool
+	xK, xV, yK, yV []byte
+	err            error
+}
+
+func (m *unionKV) advanceX() {
+	if m.err != nil {
+		return
+	}
+	m.xHas = m.x.HasNext()
+	if m.xHas {
+		m.xK, m.xV, m.err = m.x.Next()
+	}
+}
+
+func (m *unionKV) advanceY() {
+	if m.err != nil {
+		return
+	}
+	m.yHas = m.y.HasNext()
+	if m.yHas {
+		m.yK, m.yV, m.err = m.y.Next()
+	}
+}
+
+func (m *unionKV) HasNext() bool { return m.err != nil || m.xHas || m.yHas }
+
+func (m *unionKV) Next() ([]byte, []byte, error) {
+	if m.err != nil {
+		err := m.err
+		m.err, m.xHas, m.yHas = nil, false, false
+		return nil, nil, err
+	}
+	if m.xHas && m.yHas {
+		switch cmp := bytes.Compare(m.xK, m.yK); {
+		case cmp < 0:
+			k, v := m.xK, m.xV
+			m.advanceX()
+			return k, v, nil
+		case cmp == 0:
+			k, v := m.xK, m.xV
+			m.advanceX()
+			m.advanceY()
+			return k, v, nil
+		default:
+			k, v := m.yK, m.yV
+			m.advanceY()
+			return k, v, nil
+		}
+	}
+	if m.xHas {
+		k, v := m.xK, m.xV
+		m.advanceX()
+		return k, v, nil
+	}
+	k, v := m.yK, m.yV
+	m.advanceY()
+	return k, v, nil
+}
+
+// Union - merge of 2 sorted streams without duplicates
+func Union[T constraints.Ordered](x, y Uno[T]) Uno[T] {
+	m := &union[T]{x: x, y: y}
+	m.advanceX()
+	m.advanceY()
+	return m
+}
+
+type union[T constraints.Ordered] struct {
+	x, y       Uno[T]
+	xHas, yHas bool
+	xV, yV     T
+	err        error
+}
+
+func (m *union[T]) advanceX() {
+	if m.err != nil {
+		return
+	}
+	m.xHas = m.x.HasNext()
+	if m.xHas {
+		m.xV, m.err = m.x.Next()
+	}
+}
+
+func (m *union[T]) advanceY() {
+	if m.err != nil {
+		return
+	}
+	m.yHas = m.y.HasNext()
+	if m.yHas {
+		m.yV, m.err = m.y.Next()
+	}
+}
+
+func (m *union[T]) HasNext() bool { return m.err != nil || m.xHas || m.yHas }
+
+func (m *union[T]) Next() (res T, err error) {
+	if m.err != nil {
+		err = m.err
+		m.err, m.xHas, m.yHas = nil, false, false
+		return res, err
+	}
+	if m.xHas && m.yHas {
+		switch {
+		case m.xV < m.yV:
+			res = m.xV
+			m.advanceX()
+		case m.xV == m.yV:
+			res = m.xV
+			m.advanceX()
+			m.advanceY()
+		default:
+			res = m.yV
+			m.advanceY()
+		}
+		return res, nil
+	}
+	if m.xHas {
+		res = m.xV
+		m.advanceX()
+		return res, nil
+	}
+	res = m.yV
+	m.advanceY()
+	return res, nil
+}
+
+// Intersect - items which are in both sorted streams
+func Intersect[T constraints.Ordered](x, y Uno[T]) Uno[T] {
+	m := &intersect[T]{x: x, y: y}
+	m.advance()
+	return m
+}
+
+type intersect[T constraints.Ordered] struct {
+	x, y  Uno[T]
+	has   bool
+	nextV T
+	err   error
+}
+
+// advance - finds next common item
+func (m *intersect[T]) advance() {
+	m.has = false
+	if !m.x.HasNext() || !m.y.HasNext() {
+		return
+	}
+	xV, err := m.x.Next()
+	if err != nil {
+		m.err = err
+		return
+	}
+	yV, err := m.y.Next()
+	if err != nil {
+		m.err = err
+		return
+	}
+	for xV != yV {
+		if xV < yV {
+			if !m.x.HasNext() {
+				return
+			}
+			if xV, err = m.x.Next(); err != nil {
+				m.err = err
+				return
+			}
+			continue
+		}
+		if !m.y.HasNext() {
+			return
+		}
+		if yV, err = m.y.Next(); err != nil {
+			m.err = err
+			return
+		}
+	}
+	m.has, m.nextV = true, xV
+}
+
+func (m *intersect[T]) HasNext() bool { return m.err != nil || m.has }
+
+func (m *intersect[T]) Next() (res T, err error) {
+	if m.err != nil {
+		err = m.err
+		m.err = nil
+		return res, err
+	}
+	res = m.nextV
+	m.advance()
+	return res, nil
+}
+
+// TransformKV - applies f to each pair of stream
+func TransformKV(it KV, f func(k, v []byte) ([]byte, []byte, error)) KV {
+	return &transformKV{it: it, f: f}
+}
+
+type transformKV struct {
+	it KV
+	f  func(k, v []byte) ([]byte, []byte, error)
+}
+
+func (m *transformKV) HasNext() bool { return m.it.HasNext() }
+func (m *transformKV) Next() ([]byte, []byte, error) {
+	k, v, err := m.it.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.f(k, v)
+}
+func (m *transformKV) Close() { Close(m.it) }
+
+// NextPageUno - returns 1 page of items and token of next page. Empty nextPageToken - it was last page
+type NextPageUno[T any] func(pageToken string) (arr []T, nextPageToken string, err error)
+
+// NextPageDuo - returns 1 page of pairs and token of next page. Empty nextPageToken - it was last page
+type NextPageDuo[K, V any] func(pageToken string) (keys []K, values []V, nextPageToken string, err error)
+
+// Paginate - stream of items of all pages, pages are requested when previous page is read
+func Paginate[T any](f NextPageUno[T]) Uno[T] { return &paginated[T]{nextPage: f} }
+
+type paginated[T any] struct {
+	arr           []T
+	i             int
+	err           error
+	nextPage      NextPageUno[T]
+	nextPageToken string
+	initialized   bool
+}
+
+// fill - requests pages until non-empty one or the last one
+func (it *paginated[T]) fill() {
+	for it.i >= len(it.arr) && (!it.initialized || it.nextPageToken != "") && it.err == nil {
+		it.initialized = true
+		it.i = 0
+		it.arr, it.nextPageToken, it.err = it.nextPage(it.nextPageToken)
+	}
+}
+
+func (it *paginated[T]) HasNext() bool {
+	it.fill()
+	return it.err != nil || it.i < len(it.arr)
+}
+
+func (it *paginated[T]) Next() (v T, err error) {
+	it.fill()
+	if it.err != nil {
+		err, it.err, it.nextPageToken, it.arr = it.err, nil, "", nil
+		return v, err
+	}
+	v = it.arr[it.i]
+	it.i++
+	return v, nil
+}
+
+// PaginateDuo - stream of pairs of all pages, pages are requested when previous page is read
+func PaginateDuo[K, V any](f NextPageDuo[K, V]) Duo[K, V] { return &paginatedDuo[K, V]{nextPage: f} }
+
+type paginatedDuo[K, V any] struct {
+	keys          []K
+	values        []V
+	i             int
+	err           error
+	nextPage      NextPageDuo[K, V]
+	nextPageToken string
+	initialized   bool
+}
+
+func (it *paginatedDuo[K, V]) fill() {
+	for it.i >= len(it.keys) && (!it.initialized || it.nextPageToken != "") && it.err == nil {
+		it.initialized = true
+		it.i = 0
+		it.keys, it.values, it.nextPageToken, it.err = it.nextPage(it.nextPageToken)
+	}
+}
+
+func (it *paginatedDuo[K, V]) HasNext() bool {
+	it.fill()
+	return it.err != nil || it.i < len(it.keys)
+}
+
+func (it *paginatedDuo[K, V]) Next() (k K, v V, err error) {
+	it.fill()
+	if it.err != nil {
+		err, it.err, it.nextPageToken, it.keys, it.values = it.err, nil, "", nil, nil
+		return k, v, err
+	}
+	k, v = it.keys[it.i], it.values[it.i]
+	it.i++
+	return k, v, nil
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package iter - streams of data which don't depend on db backend: they are returned by kv.Tx.Range
+// of mdbx, memdb and remote db and can be combined without writing cursor loops.
+//
+// Usage:
+//
+//	for s.HasNext() {
+//		k, v, err := s.Next()
+//		if err != nil {
+//			return err
+//		}
+//	}
+//
+// HasNext returns true if Next will return item or error. After error stream is finished.
+// Streams of keys are sorted in order of db (bytes.Compare) if not said otherwise.
+package iter
+
+import (
+	"bytes"
+)
+
+// Duo - stream of pairs
+type Duo[K, V any] interface {
+	Next() (K, V, error)
+	HasNext() bool
+}
+
+// Uno - stream of single values
+type Uno[V any] interface {
+	Next() (V, error)
+	HasNext() bool
+}
+
+type (
+	KV  = Duo[[]byte, []byte] // key, value
+	K   = Uno[[]byte]         // key
+	U64 = Uno[uint64]
+)
+
+// Closer - streams which hold resources (cursor, network stream) implement it.
+// Stream releases them itself when it's finished and when transaction ends.
+type Closer interface {
+	Close()
+}
+
+// Close - closes stream if it's Closer
+func Close(it any) {
+	if c, ok := it.(Closer); ok {
+		c.Close()
+	}
+}
+
+// Cursor - subset of kv.Cursor used by CursorKV
+type Cursor interface {
+	Seek(seek []byte) ([]byte, []byte, error)
+	Next() ([]byte, []byte, error)
+	Close()
+}
+
+// CursorKV - pairs of cursor in [fromPrefix, toPrefix). empty toPrefix means - till the end of table.
+// Stream owns cursor: closes it when finished.
+func CursorKV(c Cursor, fromPrefix, toPrefix []byte) (*CursorStream, error) {
+	s := &CursorStream{c: c, toPrefix: toPrefix}
+	k, v, err := c.Seek(fromPrefix)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	s.advance(k, v)
+	return s, nil
+}
+
+type CursorStream struct {
+	c              Cursor
+	toPrefix       []byte
+	nextK, nextV   []byte
+	err            error
+	closed, hasErr bool
+}
+
+func (s *CursorStream) advance(k, v []byte) {
+	if k == nil || (len(s.toPrefix) > 0 && bytes.Compare(k, s.toPrefix) >= 0) {
+		s.Close()
+		return
+	}
+	s.nextK, s.nextV = k, v
+}
+
+func (s *CursorStream) HasNext() bool { return s.hasErr || s.nextK != nil }
+
+func (s *CursorStream) Next() ([]byte, []byte, error) {
+	if s.hasErr {
+		s.hasErr = false
+		return nil, nil, s.err
+	}
+	k, v := s.nextK, s.nextV
+	if k == nil {
+		return nil, nil, nil
+	}
+	nk, nv, err := s.c.Next()
+	if err != nil {
+		s.err, s.hasErr = err, true
+		s.Close()
+		return k, v, nil
+	}
+	s.advance(nk, nv)
+	return k, v, nil
+}
+
+func (s *CursorStream) Close() {
+	s.nextK, s.nextV = nil, nil
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.c.Close()
+}
+
+// ArrayDuo - stream of pairs keys[i], values[i]
+func ArrayDuo[K, V any](keys []K, values []V) Duo[K, V] {
+	return &arrayDuo[K, V]{keys: keys, values: values}
+}
+
+type arrayDuo[K, V any] struct {
+	keys   []K
+	values []V
+	i      int
+}
+
+func (it *arrayDuo[K, V]) HasNext() bool { return it.i < len(it.keys) }
+func (it *arrayDuo[K, V]) Next() (K, V, error) {
+	k, v := it.keys[it.i], it.values[it.i]
+	it.i++
+	return k, v, nil
+}
+
+// Array - stream of items of arr
+func Array[V any](arr []V) Uno[V] { return &array[V]{arr: arr} }
+
+type array[V any] struct {
+	arr []V
+	i   int
+}
+
+func (it *array[V]) HasNext() bool { return it.i < len(it.arr) }
+func (it *array[V]) Next() (V, error) {
+	v := it.arr[it.i]
+	it.i++
+	return v, nil
+}
+
+// ToArray - reads stream till the end
+func ToArray[V any](it Uno[V]) (res []V, err error) {
+	for it.HasNext() {
+		v, err := it.Next()
+		if err != nil {
+			return res, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// ToArrayDuo - reads stream till the end
+func ToArrayDuo[K, V any](it Duo[K, V]) (keys []K, values []V, err error) {
+	for it.HasNext() {
+		k, v, err := it.Next()
+		if err != nil {
+			return keys, values, err
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values, nil
+}
+
+// ToArrayKV - reads stream till the end
+func ToArrayKV(it KV) (keys, values [][]byte, err error) { return ToArrayDuo[[]byte, []byte](it) }
@@ -0,0 +1,151 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package iter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bs(strs ...string) (res [][]byte) {
+	for _, s := range strs {
+		res = append(res, []byte(s))
+	}
+	return res
+}
+
+func TestUnionKV(t *testing.T) {
+	x := ArrayDuo(bs("a", "c", "e"), bs("x1", "x2", "x3"))
+	y := ArrayDuo(bs("b", "c", "f"), bs("y1", "y2", "y3"))
+	keys, values, err := ToArrayKV(UnionKV(x, y))
+	require.NoError(t, err)
+	require.Equal(t, bs("a", "b", "c", "e", "f"), keys)
+	require.Equal(t, bs("x1", "y1", "x2", "x3", "y3"), values)
+
+	keys, _, err = ToArrayKV(UnionKV(ArrayDuo[[]byte, []byte](nil, nil), ArrayDuo(bs("a"), bs("1"))))
+	require.NoError(t, err)
+	require.Equal(t, bs("a"), keys)
+}
+
+func TestUnionIntersect(t *testing.T) {
+	res, err := ToArray(Union[uint64](Array([]uint64{1, 3, 5}), Array([]uint64{2, 3, 6, 7})))
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3, 5, 6, 7}, res)
+
+	res, err = ToArray(Intersect[uint64](Array([]uint64{1, 3, 5, 7, 9}), Array([]uint64{2, 3, 7, 8, 9})))
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 7, 9}, res)
+
+	res, err = ToArray(Intersect[uint64](Array([]uint64{1, 3}), Array([]uint64{2, 4})))
+	require.NoError(t, err)
+	require.Nil(t, res)
+}
+
+func TestTransformKV(t *testing.T) {
+	it := TransformKV(ArrayDuo(bs("a", "b"), bs("1", "2")), func(k, v []byte) ([]byte, []byte, error) {
+		return append([]byte("_"), k...), v, nil
+	})
+	keys, values, err := ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, bs("_a", "_b"), keys)
+	require.Equal(t, bs("1", "2"), values)
+
+	errTest := errors.New("test")
+	it = TransformKV(ArrayDuo(bs("a", "b"), bs("1", "2")), func(k, v []byte) ([]byte, []byte, error) { return nil, nil, errTest })
+	_, _, err = ToArrayKV(it)
+	require.ErrorIs(t, err, errTest)
+}
+
+func TestPaginate(t *testing.T) {
+	pages := [][]uint64{{1, 2}, {}, {3}, {4, 5}}
+	it := Paginate[uint64](func(pageToken string) ([]uint64, string, error) {
+		i := 0
+		if pageToken != "" {
+			i, _ = strconv.Atoi(pageToken)
+		}
+		next := ""
+		if i+1 < len(pages) {
+			next = fmt.Sprintf("%d", i+1)
+		}
+		return pages[i], next, nil
+	})
+	res, err := ToArray(it)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, res)
+
+	errTest := errors.New("test")
+	calls := 0
+	it2 := PaginateDuo[string, int](func(pageToken string) ([]string, []int, string, error) {
+		calls++
+		if pageToken == "" {
+			return []string{"a"}, []int{1}, "2", nil
+		}
+		return nil, nil, "", errTest
+	})
+	keys, _, err := ToArrayDuo(it2)
+	require.ErrorIs(t, err, errTest)
+	require.Equal(t, []string{"a"}, keys)
+	require.False(t, it2.HasNext())
+	require.Equal(t, 2, calls)
+}
+
+type testCursor struct {
+	keys   [][]byte
+	i      int
+	err    error
+	closed bool
+}
+
+func (c *testCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	for c.i = 0; c.i < len(c.keys); c.i++ {
+		if string(c.keys[c.i]) >= string(seek) {
+			return c.keys[c.i], c.keys[c.i], nil
+		}
+	}
+	return nil, nil, nil
+}
+func (c *testCursor) Next() ([]byte, []byte, error) {
+	c.i++
+	if c.i >= len(c.keys) {
+		return nil, nil, c.err
+	}
+	return c.keys[c.i], c.keys[c.i], nil
+}
+func (c *testCursor) Close() { c.closed = true }
+
+func TestCursorKV(t *testing.T) {
+	c := &testCursor{keys: bs("a", "b", "c", "d")}
+	it, err := CursorKV(c, []byte("b"), []byte("d"))
+	require.NoError(t, err)
+	keys, _, err := ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, bs("b", "c"), keys)
+	require.True(t, c.closed)
+
+	c = &testCursor{keys: bs("a", "b"), err: errors.New("test")}
+	it, err = CursorKV(c, nil, nil)
+	require.NoError(t, err)
+	keys, _, err = ToArrayKV(it)
+	require.Error(t, err)
+	require.Equal(t, bs("a", "b"), keys)
+	require.False(t, it.HasNext())
+	require.True(t, c.closed)
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package keys - building and parsing of composite keys of tables.
+// Append* functions append to dst (like strconv.Append*): pass dst[:0] of reused buffer to avoid allocations.
+// Numbers are big-endian - then keys are sorted by them.
+package keys
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common/length"
+)
+
+const (
+	StoragePrefixLen = length.Addr + length.Incarnation               // address + incarnation
+	PlainStorageLen  = length.Addr + length.Incarnation + length.Hash // address + incarnation + location
+	TxNumIndexLen    = 8 + 4                                          // txNum + index
+)
+
+func AppendUint64(dst []byte, v uint64) []byte {
+	return append(dst, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func AppendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// AppendStoragePrefix - address+incarnation: prefix of all storage keys of contract
+func AppendStoragePrefix(dst, addr []byte, incarnation uint64) []byte {
+	return AppendUint64(append(dst, addr...), incarnation)
+}
+
+// AppendPlainStorage - address+incarnation+location: key of PlainState storage
+func AppendPlainStorage(dst, addr []byte, incarnation uint64, location []byte) []byte {
+	return append(AppendStoragePrefix(dst, addr, incarnation), location...)
+}
+
+// ParsePlainStorage - opposite of AppendPlainStorage. Returned slices point into k
+func ParsePlainStorage(k []byte) (addr []byte, incarnation uint64, location []byte, err error) {
+	if len(k) != PlainStorageLen {
+		return nil, 0, nil, fmt.Errorf("storage key must be %d bytes, got %d: %x", PlainStorageLen, len(k), k)
+	}
+	return k[:length.Addr], binary.BigEndian.Uint64(k[length.Addr:]), k[StoragePrefixLen:], nil
+}
+
+// AppendTxNum - txNum+suffix: txNum-ordered keys of history/changesets
+func AppendTxNum(dst []byte, txNum uint64, suffix []byte) []byte {
+	return append(AppendUint64(dst, txNum), suffix...)
+}
+
+// ParseTxNum - opposite of AppendTxNum. Returned suffix points into k
+func ParseTxNum(k []byte) (txNum uint64, suffix []byte, err error) {
+	if len(k) < 8 {
+		return 0, nil, fmt.Errorf("key with txNum must be at least 8 bytes, got %d: %x", len(k), k)
+	}
+	return binary.BigEndian.Uint64(k), k[8:], nil
+}
+
+// AppendTxNumIndex - txNum+index (for example index of log in transaction)
+func AppendTxNumIndex(dst []byte, txNum uint64, index uint32) []byte {
+	return AppendUint32(AppendUint64(dst, txNum), index)
+}
+
+// ParseTxNumIndex - opposite of AppendTxNumIndex
+func ParseTxNumIndex(k []byte) (txNum uint64, index uint32, err error) {
+	if len(k) != TxNumIndexLen {
+		return 0, 0, fmt.Errorf("txNum+index key must be %d bytes, got %d: %x", TxNumIndexLen, len(k), k)
+	}
+	return binary.BigEndian.Uint64(k), binary.BigEndian.Uint32(k[8:]), nil
+}
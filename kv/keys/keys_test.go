@@ -0,0 +1,62 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package keys
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlainStorage(t *testing.T) {
+	addr, loc := bytes.Repeat([]byte{0xaa}, 20), bytes.Repeat([]byte{0xbb}, 32)
+	buf := make([]byte, 0, PlainStorageLen)
+	k := AppendPlainStorage(buf, addr, 2, loc)
+	require.Equal(t, PlainStorageLen, len(k))
+	require.Equal(t, AppendStoragePrefix(nil, addr, 2), k[:StoragePrefixLen])
+
+	gotAddr, inc, gotLoc, err := ParsePlainStorage(k)
+	require.NoError(t, err)
+	require.Equal(t, addr, gotAddr)
+	require.Equal(t, uint64(2), inc)
+	require.Equal(t, loc, gotLoc)
+	_, _, _, err = ParsePlainStorage(k[:StoragePrefixLen])
+	require.Error(t, err)
+
+	require.Zero(t, testing.AllocsPerRun(10, func() { _ = AppendPlainStorage(buf[:0], addr, 2, loc) }))
+}
+
+func TestTxNum(t *testing.T) {
+	k := AppendTxNum(nil, 0x0102, []byte("key"))
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 1, 2, 'k', 'e', 'y'}, k)
+	txNum, suffix, err := ParseTxNum(k)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0x0102), txNum)
+	require.Equal(t, []byte("key"), suffix)
+
+	// sorted by txNum, then by index
+	a, b, c := AppendTxNumIndex(nil, 1, 2), AppendTxNumIndex(nil, 1, 3), AppendTxNumIndex(nil, 2, 0)
+	require.Equal(t, -1, bytes.Compare(a, b))
+	require.Equal(t, -1, bytes.Compare(b, c))
+	txNum, index, err := ParseTxNumIndex(b)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), txNum)
+	require.Equal(t, uint32(3), index)
+	_, _, err = ParseTxNumIndex(k)
+	require.Error(t, err)
+}
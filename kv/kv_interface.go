@@ -21,6 +21,7 @@ import (
 	"errors"
 
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 )
 
 const ReadersLimit = 32000 // MDBX_READERS_LIMIT=32767
@@ -28,6 +29,7 @@ const ReadersLimit = 32000 // MDBX_READERS_LIMIT=32767
 var (
 	ErrAttemptToDeleteNonDeprecatedBucket = errors.New("only buckets from dbutils.ChaindataDeprecatedTables can be deleted")
 	ErrUnknownBucket                      = errors.New("unknown bucket. add it to dbutils.ChaindataTables")
+	ErrTableMissing                       = errors.New("table doesn't exist in db") // declared, but not created: db is read-only or table is deprecated
 
 	DbSize    = metrics.NewCounter(`db_size`)    //nolint
 	TxLimit   = metrics.NewCounter(`tx_limit`)   //nolint
@@ -253,6 +255,44 @@ type Tx interface {
 	DBSize() (uint64, error)
 }
 
+// ManyGetter - (optional interface of Tx) values of keys, in same order as keys. nil value - key not found.
+// Same as GetOne in loop, but backends may do it faster: sorted probe, 1 network round-trip. Use GetMany
+type ManyGetter interface {
+	GetMany(table string, keys [][]byte) ([][]byte, error)
+}
+
+// Ranger - (optional interface of Tx) stream of pairs with keys in [fromPrefix, toPrefix), empty toPrefix - till
+// the end of table. Stream is valid until end of transaction. Remote db streams pairs from server by pages.
+// Use Range: it falls back to cursor for other transactions
+type Ranger interface {
+	Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error)
+}
+
+// Copier - (optional interface of RoDB) makes consistent copy of db (backup) without stopping writers.
+// Copy has state of db at moment of CopyTo call.
+type Copier interface {
+	CopyTo(ctx context.Context, path string, compacting bool, opts CopyOpts) error
+}
+
+type CopyOpts struct {
+	Progress  func(copied, total uint64) // amount of copied key-value pairs. Called from time to time and at the end
+	RateLimit uint64                     // bytes (of keys+values) per second. 0 - unlimited
+}
+
+// TableStatsReader - (optional interface of Tx) size statistics of table. Use ReadTableStats
+type TableStatsReader interface {
+	TableStats(table string) (TableStats, error)
+}
+
+// TableStats - size statistics of table, see mdbx_dbi_stat
+type TableStats struct {
+	Entries       uint64 // amount of key-value pairs (including duplicates)
+	LeafPages     uint64
+	BranchPages   uint64
+	OverflowPages uint64 // pages of big values
+	Bytes         uint64 // (LeafPages + BranchPages + OverflowPages) * PageSize
+}
+
 type RwTx interface {
 	Tx
 	StatelessWriteTx
@@ -266,6 +306,12 @@ type RwTx interface {
 	CollectMetrics()
 }
 
+// RangeDeleter - (optional interface of RwTx) deletes keys in [fromKey, toKey) with all their values (for DupSort
+// tables). toKey == nil - till end of table. Used by prune and to clear storage of contract. Use DeleteRange
+type RangeDeleter interface {
+	DeleteRange(table string, fromKey, toKey []byte) error
+}
+
 // BucketMigrator used for buckets migration, don't use it in usual app code
 type BucketMigrator interface {
 	DropBucket(string) error
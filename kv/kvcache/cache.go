@@ -18,19 +18,19 @@ package kvcache
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
 	"fmt"
-	"hash"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/c2h5oh/datasize"
 	"github.com/google/btree"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/keys"
 	"go.uber.org/atomic"
 	"golang.org/x/crypto/sha3"
 )
@@ -39,6 +39,8 @@ type Cache interface {
 	// View - returns CacheView consistent with givent kv.Tx
 	View(ctx context.Context, tx kv.Tx) (CacheView, error)
 	OnNewBlock(sc *remote.StateChangeBatch)
+	// WarmUp - pre-populates cache by keys changed in given batches (for example: of last N blocks) - to avoid cold reads after restart
+	WarmUp(ctx context.Context, tx kv.Tx, batches []*remote.StateChangeBatch) (int, error)
 	Len() int
 }
 type CacheView interface {
@@ -89,13 +91,15 @@ type Coherent struct {
 	keys, evict                  *metrics.Counter
 	codeHits, codeMiss, codeKeys *metrics.Counter
 	codeEvictLen                 *metrics.Counter
+	evictions, codeEvictions     *metrics.Counter
+	sizeBytes, codeSizeBytes     *metrics.Counter
 	latestStateView              *CoherentRoot
 	roots                        map[ViewID]*CoherentRoot
-	stateEvict, codeEvict        *ThreadSafeEvictionList
+	stateEvict, codeEvict        evictor
+	stateSize, codeSize          int // bytes used by elements of latest view
 	lock                         sync.RWMutex
 	cfg                          CoherentConfig
 	latestViewID                 ViewID
-	hasher                       hash.Hash
 }
 
 type CoherentRoot struct {
@@ -128,32 +132,42 @@ var _ CacheView = (*CoherentView)(nil) // compile-time interface check
 const DEGREE = 32
 
 type CoherentConfig struct {
-	KeepViews     uint64        // keep in memory up to this amount of views, evict older
-	NewBlockWait  time.Duration // how long wait
-	MetricsLabel  string
-	WithStorage   bool
-	KeysLimit     int
-	CodeKeysLimit int
+	KeepViews      uint64        // keep in memory up to this amount of views, evict older
+	NewBlockWait   time.Duration // how long wait
+	MetricsLabel   string
+	WithStorage    bool
+	KeysLimit      int
+	CodeKeysLimit  int
+	CacheSize      datasize.ByteSize // memory budget of state cache. 0 - limited only by KeysLimit
+	CodeCacheSize  datasize.ByteSize // memory budget of code cache. 0 - limited only by CodeKeysLimit
+	EvictionPolicy EvictionPolicy    // LRU by default
 }
 
 var DefaultCoherentConfig = CoherentConfig{
-	KeepViews:     5,
-	NewBlockWait:  50 * time.Millisecond,
-	KeysLimit:     1_000_000,
-	CodeKeysLimit: 10_000,
-	MetricsLabel:  "default",
-	WithStorage:   true,
+	KeepViews:      5,
+	NewBlockWait:   50 * time.Millisecond,
+	KeysLimit:      1_000_000,
+	CodeKeysLimit:  10_000,
+	CacheSize:      2 * datasize.GB,
+	CodeCacheSize:  1 * datasize.GB,
+	EvictionPolicy: LRU,
+	MetricsLabel:   "default",
+	WithStorage:    true,
 }
 
 func New(cfg CoherentConfig) *Coherent {
 	if cfg.KeepViews == 0 {
 		panic("empty config passed")
 	}
-	return &Coherent{
+	stateEvict, err := newEvictor(cfg.EvictionPolicy)
+	if err != nil {
+		panic(err)
+	}
+	codeEvict, _ := newEvictor(cfg.EvictionPolicy)
+	c := &Coherent{
 		roots:        map[ViewID]*CoherentRoot{},
-		stateEvict:   &ThreadSafeEvictionList{l: NewList()},
-		codeEvict:    &ThreadSafeEvictionList{l: NewList()},
-		hasher:       sha3.NewLegacyKeccak256(),
+		stateEvict:   stateEvict,
+		codeEvict:    codeEvict,
 		cfg:          cfg,
 		miss:         metrics.GetOrCreateCounter(fmt.Sprintf(`cache_total{result="miss",name="%s"}`, cfg.MetricsLabel)),
 		hits:         metrics.GetOrCreateCounter(fmt.Sprintf(`cache_total{result="hit",name="%s"}`, cfg.MetricsLabel)),
@@ -164,7 +178,23 @@ func New(cfg CoherentConfig) *Coherent {
 		codeHits:     metrics.GetOrCreateCounter(fmt.Sprintf(`cache_code_total{result="hit",name="%s"}`, cfg.MetricsLabel)),
 		codeKeys:     metrics.GetOrCreateCounter(fmt.Sprintf(`cache_code_keys_total{name="%s"}`, cfg.MetricsLabel)),
 		codeEvictLen: metrics.GetOrCreateCounter(fmt.Sprintf(`cache_code_list_total{name="%s"}`, cfg.MetricsLabel)),
+
+		evictions:     metrics.GetOrCreateCounter(fmt.Sprintf(`cache_evictions_total{name="%s"}`, cfg.MetricsLabel)),
+		codeEvictions: metrics.GetOrCreateCounter(fmt.Sprintf(`cache_code_evictions_total{name="%s"}`, cfg.MetricsLabel)),
+		sizeBytes:     metrics.GetOrCreateCounter(fmt.Sprintf(`cache_size_bytes{name="%s"}`, cfg.MetricsLabel)),
+		codeSizeBytes: metrics.GetOrCreateCounter(fmt.Sprintf(`cache_code_size_bytes{name="%s"}`, cfg.MetricsLabel)),
+	}
+	metrics.GetOrCreateGauge(fmt.Sprintf(`cache_hit_ratio{name="%s"}`, cfg.MetricsLabel), func() float64 { return hitRatio(c.hits, c.miss) })
+	metrics.GetOrCreateGauge(fmt.Sprintf(`cache_code_hit_ratio{name="%s"}`, cfg.MetricsLabel), func() float64 { return hitRatio(c.codeHits, c.codeMiss) })
+	return c
+}
+
+func hitRatio(hits, miss *metrics.Counter) float64 {
+	total := hits.Get() + miss.Get()
+	if total == 0 {
+		return 0
 	}
+	return float64(hits.Get()) / float64(total)
 }
 
 // selectOrCreateRoot - used for usual getting root
@@ -200,17 +230,20 @@ func (c *Coherent) advanceRoot(viewID ViewID) (r *CoherentRoot) {
 	} else {
 		c.stateEvict.Init()
 		c.codeEvict.Init()
+		c.stateSize, c.codeSize = 0, 0
 		if r.cache == nil {
 			//log.Info("advance: new", "to", viewID)
 			r.cache = btree.NewG[*Element](DEGREE, Less)
 			r.codeCache = btree.NewG[*Element](DEGREE, Less)
 		} else {
 			r.cache.Ascend(func(i *Element) bool {
-				c.stateEvict.PushFront(i)
+				c.stateEvict.Add(i)
+				c.stateSize += elementSize(i)
 				return true
 			})
 			r.codeCache.Ascend(func(i *Element) bool {
-				c.codeEvict.PushFront(i)
+				c.codeEvict.Add(i)
+				c.codeSize += elementSize(i)
 				return true
 			})
 		}
@@ -225,64 +258,177 @@ func (c *Coherent) advanceRoot(viewID ViewID) (r *CoherentRoot) {
 	c.codeKeys.Set(uint64(c.latestStateView.codeCache.Len()))
 	c.evict.Set(uint64(c.stateEvict.Len()))
 	c.codeEvictLen.Set(uint64(c.codeEvict.Len()))
+	c.sizeBytes.Set(uint64(c.stateSize))
+	c.codeSizeBytes.Set(uint64(c.codeSize))
 	return r
 }
 
 func (c *Coherent) OnNewBlock(stateChanges *remote.StateChangeBatch) {
+	stateBatch, codeBatch := mergeStateChanges(stateChanges, c.cfg.WithStorage)
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	id := ViewID(stateChanges.DatabaseViewID)
 	r := c.advanceRoot(id)
+	for _, it := range stateBatch {
+		c.add(it.K, it.V, r, id)
+	}
+	for _, it := range codeBatch {
+		c.addCode(it.K, it.V, r, id)
+	}
+
+	switched := r.readyChanClosed.CAS(false, true)
+	if switched {
+		close(r.ready) //broadcast
+	}
+	//log.Info("on new block handled", "viewID", stateChanges.DatabaseViewID)
+}
+
+// mergeStateChanges - changes of all blocks of the batch merged by key (the last change wins) and sorted by key: batch is
+// applied under one lock, in order of btree. Code hashes are computed here - before lock is taken
+func mergeStateChanges(stateChanges *remote.StateChangeBatch, withStorage bool) (stateBatch, codeBatch []*Element) {
+	hasher := sha3.NewLegacyKeccak256()
+	stateIdx, codeIdx := map[string]int{}, map[string]int{}
+	put := func(batch []*Element, idx map[string]int, k, v []byte) []*Element {
+		if i, ok := idx[string(k)]; ok {
+			batch[i].V = v
+			return batch
+		}
+		idx[string(k)] = len(batch)
+		return append(batch, &Element{K: k, V: v})
+	}
+	putCode := func(code []byte) {
+		hasher.Reset()
+		hasher.Write(code)
+		codeBatch = put(codeBatch, codeIdx, hasher.Sum(nil), code)
+	}
 	for _, sc := range stateChanges.ChangeBatch {
-		for i := range sc.Changes {
-			switch sc.Changes[i].Action {
+		for _, change := range sc.Changes {
+			addr := gointerfaces.ConvertH160toAddress(change.Address)
+			switch change.Action {
 			case remote.Action_UPSERT:
-				addr := gointerfaces.ConvertH160toAddress(sc.Changes[i].Address)
-				v := sc.Changes[i].Data
-				//fmt.Printf("set: %x,%x\n", addr, v)
-				c.add(addr[:], v, r, id)
+				//fmt.Printf("set: %x,%x\n", addr, change.Data)
+				stateBatch = put(stateBatch, stateIdx, addr[:], change.Data)
 			case remote.Action_UPSERT_CODE:
-				addr := gointerfaces.ConvertH160toAddress(sc.Changes[i].Address)
-				v := sc.Changes[i].Data
-				c.add(addr[:], v, r, id)
-				c.hasher.Reset()
-				c.hasher.Write(sc.Changes[i].Code)
-				k := make([]byte, 32)
-				c.hasher.Sum(k)
-				c.addCode(k, sc.Changes[i].Code, r, id)
+				stateBatch = put(stateBatch, stateIdx, addr[:], change.Data)
+				putCode(change.Code)
 			case remote.Action_REMOVE:
-				addr := gointerfaces.ConvertH160toAddress(sc.Changes[i].Address)
-				c.add(addr[:], nil, r, id)
+				stateBatch = put(stateBatch, stateIdx, addr[:], nil)
 			case remote.Action_STORAGE:
 				//skip, will check later
 			case remote.Action_CODE:
-				c.hasher.Reset()
-				c.hasher.Write(sc.Changes[i].Code)
-				k := make([]byte, 32)
-				c.hasher.Sum(k)
-				c.addCode(k, sc.Changes[i].Code, r, id)
+				putCode(change.Code)
 			default:
 				panic("not implemented yet")
 			}
-			if c.cfg.WithStorage && len(sc.Changes[i].StorageChanges) > 0 {
-				addr := gointerfaces.ConvertH160toAddress(sc.Changes[i].Address)
-				for _, change := range sc.Changes[i].StorageChanges {
-					loc := gointerfaces.ConvertH256ToHash(change.Location)
-					k := make([]byte, 20+8+32)
-					copy(k, addr[:])
-					binary.BigEndian.PutUint64(k[20:], sc.Changes[i].Incarnation)
-					copy(k[20+8:], loc[:])
-					c.add(k, change.Data, r, id)
+			if withStorage && len(change.StorageChanges) > 0 {
+				for _, storageChange := range change.StorageChanges {
+					loc := gointerfaces.ConvertH256ToHash(storageChange.Location)
+					k := keys.AppendPlainStorage(make([]byte, 0, keys.PlainStorageLen), addr[:], change.Incarnation, loc[:])
+					stateBatch = put(stateBatch, stateIdx, k, storageChange.Data)
+				}
+			}
+		}
+	}
+	sort.Slice(stateBatch, func(i, j int) bool { return Less(stateBatch[i], stateBatch[j]) })
+	sort.Slice(codeBatch, func(i, j int) bool { return Less(codeBatch[i], codeBatch[j]) })
+	return stateBatch, codeBatch
+}
+
+// WarmUp - reads from tx values of keys (accounts, storage, code) changed by batches and adds them to view of tx.
+// Values of batches are not used: batches may be not contiguous or older than tx, but values read from tx are always coherent with it.
+// View of tx becomes latest (if cache doesn't have newer one). Returns amount of added keys.
+func (c *Coherent) WarmUp(ctx context.Context, tx kv.Tx, batches []*remote.StateChangeBatch) (int, error) {
+	hasher := sha3.NewLegacyKeccak256()
+	seen := map[string]struct{}{}
+	var stateKeys, codeKeys [][]byte
+	addKey := func(keys [][]byte, k []byte) [][]byte {
+		if _, ok := seen[string(k)]; ok {
+			return keys
+		}
+		seen[string(k)] = struct{}{}
+		return append(keys, k)
+	}
+	for _, batch := range batches {
+		for _, sc := range batch.ChangeBatch {
+			for _, change := range sc.Changes {
+				addr := gointerfaces.ConvertH160toAddress(change.Address)
+				switch change.Action {
+				case remote.Action_UPSERT, remote.Action_UPSERT_CODE, remote.Action_REMOVE:
+					stateKeys = addKey(stateKeys, common.Copy(addr[:]))
+				}
+				if len(change.Code) > 0 {
+					hasher.Reset()
+					hasher.Write(change.Code)
+					codeKeys = addKey(codeKeys, hasher.Sum(nil))
+				}
+				if !c.cfg.WithStorage {
+					continue
+				}
+				for _, storageChange := range change.StorageChanges {
+					loc := gointerfaces.ConvertH256ToHash(storageChange.Location)
+					k := keys.AppendPlainStorage(make([]byte, 0, keys.PlainStorageLen), addr[:], change.Incarnation, loc[:])
+					stateKeys = addKey(stateKeys, k)
 				}
 			}
 		}
 	}
 
-	switched := r.readyChanClosed.CAS(false, true)
-	if switched {
+	// read without lock - cache stays available during warm-up
+	stateVals := make([][]byte, len(stateKeys))
+	for i, k := range stateKeys {
+		if i%1_000 == 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			default:
+			}
+		}
+		v, err := tx.GetOne(kv.PlainState, k)
+		if err != nil {
+			return 0, err
+		}
+		stateVals[i] = common.Copy(v)
+	}
+	codeVals := make([][]byte, len(codeKeys))
+	for i, k := range codeKeys {
+		v, err := tx.GetOne(kv.Code, k)
+		if err != nil {
+			return 0, err
+		}
+		codeVals[i] = common.Copy(v)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := ViewID(tx.ViewID())
+	if id < c.latestViewID { // cache already has newer data
+		return 0, nil
+	}
+	r := c.latestStateView
+	if id > c.latestViewID || r == nil {
+		r = c.advanceRoot(id)
+	}
+	var added int
+	for i, k := range stateKeys {
+		if _, ok := r.cache.Get(&Element{K: k}); ok {
+			continue
+		}
+		c.add(k, stateVals[i], r, id)
+		added++
+	}
+	for i, k := range codeKeys {
+		if _, ok := r.codeCache.Get(&Element{K: k}); ok {
+			continue
+		}
+		c.addCode(k, codeVals[i], r, id)
+		added++
+	}
+	c.keys.Set(uint64(r.cache.Len()))
+	c.codeKeys.Set(uint64(r.codeCache.Len()))
+	if r.readyChanClosed.CAS(false, true) {
 		close(r.ready) //broadcast
 	}
-	//log.Info("on new block handled", "viewID", stateChanges.DatabaseViewID)
+	return added, nil
 }
 
 type ViewID uint64
@@ -325,7 +471,11 @@ func (c *Coherent) getFromCache(k []byte, id ViewID, code bool) (*Element, *Cohe
 		it, _ = r.cache.Get(&Element{K: k})
 	}
 	if it != nil && isLatest {
-		c.stateEvict.MoveToFront(it)
+		if code {
+			c.codeEvict.Touch(it)
+		} else {
+			c.stateEvict.Touch(it)
+		}
 	}
 
 	return it, r, nil
@@ -379,19 +529,25 @@ func (c *Coherent) GetCode(k []byte, tx kv.Tx, id ViewID) ([]byte, error) {
 	v = c.addCode(common.Copy(k), common.Copy(v), r, id).V
 	return v, nil
 }
-func (c *Coherent) removeOldest(r *CoherentRoot) {
-	e := c.stateEvict.Oldest()
-	if e != nil {
-		c.stateEvict.Remove(e)
-		r.cache.Delete(e)
+func (c *Coherent) removeOldest(r *CoherentRoot) bool {
+	e := c.stateEvict.Evict()
+	if e == nil {
+		return false
 	}
+	r.cache.Delete(e)
+	c.stateSize -= elementSize(e)
+	c.evictions.Inc()
+	return true
 }
-func (c *Coherent) removeOldestCode(r *CoherentRoot) {
-	e := c.codeEvict.Oldest()
-	if e != nil {
-		c.codeEvict.Remove(e)
-		r.codeCache.Delete(e)
+func (c *Coherent) removeOldestCode(r *CoherentRoot) bool {
+	e := c.codeEvict.Evict()
+	if e == nil {
+		return false
 	}
+	r.codeCache.Delete(e)
+	c.codeSize -= elementSize(e)
+	c.codeEvictions.Inc()
+	return true
 }
 func (c *Coherent) add(k, v []byte, r *CoherentRoot, id ViewID) *Element {
 	it := &Element{K: k, V: v}
@@ -400,14 +556,17 @@ func (c *Coherent) add(k, v []byte, r *CoherentRoot, id ViewID) *Element {
 		//fmt.Printf("add to non-last viewID: %d<%d\n", c.latestViewID, id)
 		return it
 	}
-	if replaced != nil {
+	if replaced != nil && replaced.list != nil { // tracked by evictor
 		c.stateEvict.Remove(replaced)
+		c.stateSize -= elementSize(replaced)
 	}
-	c.stateEvict.PushFront(it)
-	evict := c.stateEvict.Len() > c.cfg.KeysLimit
+	c.stateEvict.Add(it)
+	c.stateSize += elementSize(it)
 	// Verify size not exceeded
-	if evict {
-		c.removeOldest(r)
+	for c.stateEvict.Len() > c.cfg.KeysLimit || (c.cfg.CacheSize > 0 && c.stateSize > int(c.cfg.CacheSize)) {
+		if !c.removeOldest(r) {
+			break
+		}
 	}
 	return it
 }
@@ -418,14 +577,17 @@ func (c *Coherent) addCode(k, v []byte, r *CoherentRoot, id ViewID) *Element {
 		//fmt.Printf("add to non-last viewID: %d<%d\n", c.latestViewID, id)
 		return it
 	}
-	if replaced != nil {
+	if replaced != nil && replaced.list != nil { // tracked by evictor
 		c.codeEvict.Remove(replaced)
+		c.codeSize -= elementSize(replaced)
 	}
-	c.codeEvict.PushFront(it)
-	evict := c.codeEvict.Len() > c.cfg.CodeKeysLimit
+	c.codeEvict.Add(it)
+	c.codeSize += elementSize(it)
 	// Verify size not exceeded
-	if evict {
-		c.removeOldestCode(r)
+	for c.codeEvict.Len() > c.cfg.CodeKeysLimit || (c.cfg.CodeCacheSize > 0 && c.codeSize > int(c.cfg.CodeCacheSize)) {
+		if !c.removeOldestCode(r) {
+			break
+		}
 	}
 	return it
 }
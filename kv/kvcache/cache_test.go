@@ -17,6 +17,7 @@ package kvcache
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"sync"
 	"testing"
@@ -27,6 +28,7 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
 )
 
 func TestEvictionInUnexpectedOrder(t *testing.T) {
@@ -361,3 +363,116 @@ func TestCode(t *testing.T) {
 		return nil
 	})
 }
+
+func TestWarmUp(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	cfg := DefaultCoherentConfig
+	cfg.MetricsLabel = "warmup_test" // own counters of hits/misses
+	c := New(cfg)
+	db := memdb.NewTestDB(t)
+	k1, k2 := [20]byte{1}, [20]byte{2}
+	code := []byte{0x60, 0x01}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(code)
+	codeHash := h.Sum(nil)
+	storageKey := make([]byte, 20+8+32)
+	copy(storageKey, k2[:])
+	binary.BigEndian.PutUint64(storageKey[20:], 1)
+	storageKey[20+8] = 3
+
+	batches := []*remote.StateChangeBatch{{
+		DatabaseViewID: 1,
+		ChangeBatch: []*remote.StateChange{{
+			Direction: remote.Direction_FORWARD,
+			Changes: []*remote.AccountChange{
+				{Action: remote.Action_UPSERT, Address: gointerfaces.ConvertAddressToH160(k1), Data: []byte{1}},
+				{Action: remote.Action_CODE, Address: gointerfaces.ConvertAddressToH160(k2), Code: code, Incarnation: 1,
+					StorageChanges: []*remote.StorageChange{{Location: gointerfaces.ConvertHashToH256([32]byte{3}), Data: []byte{1}}}},
+			},
+		}},
+	}}
+
+	var id uint64
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		_ = tx.Put(kv.PlainState, k1[:], []byte{2}) // newer than batch
+		_ = tx.Put(kv.PlainState, storageKey, []byte{3})
+		_ = tx.Put(kv.Code, codeHash, code)
+		id = tx.ViewID()
+		added, err := c.WarmUp(ctx, tx, batches)
+		require.NoError(err)
+		require.Equal(3, added)
+		return nil
+	}))
+	require.Equal(id, uint64(c.latestViewID))
+	require.Equal(2, c.Len())
+
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		cacheView, err := c.View(ctx, tx)
+		require.NoError(err)
+		view := cacheView.(*CoherentView)
+		require.Equal(ViewID(id), view.viewID)
+		v, err := cacheView.Get(k1[:])
+		require.NoError(err)
+		require.Equal([]byte{2}, v) // value from db, not from batch
+		v, err = cacheView.Get(storageKey)
+		require.NoError(err)
+		require.Equal([]byte{3}, v)
+		v, err = cacheView.GetCode(codeHash)
+		require.NoError(err)
+		require.Equal(code, v)
+		require.Equal(uint64(0), c.miss.Get())
+		require.Equal(uint64(0), c.codeMiss.Get())
+
+		// already warm
+		added, err := c.WarmUp(ctx, tx, batches)
+		require.NoError(err)
+		require.Equal(0, added)
+		return nil
+	}))
+}
+
+func TestOnNewBlockMergedChanges(t *testing.T) {
+	require := require.New(t)
+	c := New(DefaultCoherentConfig)
+	k1, k2, k3 := [20]byte{1}, [20]byte{2}, [20]byte{3}
+	code := []byte{0x60, 0x00}
+	h := sha3.NewLegacyKeccak256()
+	h.Write(code)
+	codeHash := h.Sum(nil)
+	batch := &remote.StateChangeBatch{
+		DatabaseViewID: 1,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 1, Changes: []*remote.AccountChange{
+				{Action: remote.Action_UPSERT, Address: gointerfaces.ConvertAddressToH160(k3), Data: []byte{3}},
+				{Action: remote.Action_UPSERT, Address: gointerfaces.ConvertAddressToH160(k1), Data: []byte{1}},
+			}},
+			{BlockHeight: 2, Changes: []*remote.AccountChange{
+				{Action: remote.Action_UPSERT_CODE, Address: gointerfaces.ConvertAddressToH160(k2), Data: []byte{2}, Code: code},
+				{Action: remote.Action_REMOVE, Address: gointerfaces.ConvertAddressToH160(k1)},
+				{Action: remote.Action_UPSERT, Address: gointerfaces.ConvertAddressToH160(k3), Data: []byte{4}},
+			}},
+		},
+	}
+
+	stateBatch, codeBatch := mergeStateChanges(batch, false)
+	require.Equal(3, len(stateBatch))
+	for i, k := range [][20]byte{k1, k2, k3} {
+		require.Equal(k[:], stateBatch[i].K)
+	}
+	require.Nil(stateBatch[0].V) // the last change wins
+	require.Equal([]byte{2}, stateBatch[1].V)
+	require.Equal([]byte{4}, stateBatch[2].V)
+	require.Equal(1, len(codeBatch))
+	require.Equal(codeHash, codeBatch[0].K)
+
+	c.OnNewBlock(batch)
+	r := c.roots[1]
+	require.Equal(3, r.cache.Len())
+	require.Equal(3, c.stateEvict.Len())
+	it, ok := r.cache.Get(&Element{K: k3[:]})
+	require.True(ok)
+	require.Equal([]byte{4}, it.V)
+	it, ok = r.codeCache.Get(&Element{K: codeHash})
+	require.True(ok)
+	require.Equal(code, it.V)
+}
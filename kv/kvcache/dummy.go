@@ -33,6 +33,9 @@ func (c *DummyCache) View(_ context.Context, tx kv.Tx) (CacheView, error) {
 	return &DummyView{cache: c, tx: tx}, nil
 }
 func (c *DummyCache) OnNewBlock(sc *remote.StateChangeBatch) {}
+func (c *DummyCache) WarmUp(_ context.Context, _ kv.Tx, _ []*remote.StateChangeBatch) (int, error) {
+	return 0, nil
+}
 func (c *DummyCache) Evict() int                             { return 0 }
 func (c *DummyCache) Len() int                               { return 0 }
 func (c *DummyCache) Get(k []byte, tx kv.Tx, id ViewID) ([]byte, error) {
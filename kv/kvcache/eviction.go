@@ -0,0 +1,279 @@
+/*
+Copyright 2022 Erigon contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kvcache
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// EvictionPolicy - how to choose elements of latest view to drop when cache exceeds its budget
+type EvictionPolicy string
+
+const (
+	LRU  EvictionPolicy = "lru" // least recently used
+	TwoQ EvictionPolicy = "2q"  // new keys go to FIFO queue, keys hit again - to LRU queue: one-time reads (scans) don't wash out hot keys
+	ARC  EvictionPolicy = "arc" // adaptive replacement cache: self-tuning balance between recency and frequency
+)
+
+// evictor - tracks elements of latest view. Must be thread-safe: Touch is called under read-lock of Coherent.
+type evictor interface {
+	Init()
+	Add(e *Element)    // new element in latest view
+	Touch(e *Element)  // element was read from cache
+	Remove(e *Element) // element was replaced in cache. Does nothing for untracked element
+	Evict() *Element   // stops tracking and returns victim. nil if nothing to evict
+	Len() int
+}
+
+func newEvictor(p EvictionPolicy) (evictor, error) {
+	switch p {
+	case LRU, "":
+		return &ThreadSafeEvictionList{l: NewList()}, nil
+	case TwoQ:
+		return newTwoQueue(), nil
+	case ARC:
+		return newArc(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache eviction policy: %s", p)
+	}
+}
+
+const elementOverhead = int(unsafe.Sizeof(Element{})) + 16 // + btree node pointers
+
+// elementSize - approximate amount of memory used by element
+func elementSize(e *Element) int { return len(e.K) + len(e.V) + elementOverhead }
+
+func (l *ThreadSafeEvictionList) Add(e *Element)   { l.PushFront(e) }
+func (l *ThreadSafeEvictionList) Touch(e *Element) { l.MoveToFront(e) }
+func (l *ThreadSafeEvictionList) Evict() *Element {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e := l.l.Back()
+	if e != nil {
+		l.l.Remove(e)
+	}
+	return e
+}
+
+// ghosts - keys of recently evicted elements (without values), limited by amount
+type ghosts struct {
+	l    *List
+	keys map[string]*Element
+}
+
+func newGhosts() ghosts { return ghosts{l: NewList(), keys: map[string]*Element{}} }
+
+func (g *ghosts) init() {
+	g.l.Init()
+	g.keys = map[string]*Element{}
+}
+
+func (g *ghosts) add(k []byte, limit int) {
+	ghost := &Element{K: k}
+	g.l.PushFront(ghost)
+	g.keys[string(k)] = ghost
+	for g.l.Len() > limit {
+		oldest := g.l.Back()
+		g.l.Remove(oldest)
+		delete(g.keys, string(oldest.K))
+	}
+}
+
+// take - returns true if key was recently evicted and forgets it
+func (g *ghosts) take(k []byte) bool {
+	ghost, ok := g.keys[string(k)]
+	if !ok {
+		return false
+	}
+	g.l.Remove(ghost)
+	delete(g.keys, string(k))
+	return true
+}
+
+// twoQueue - 2Q: https://www.vldb.org/conf/1994/P439.PDF
+// Unlike "full" 2Q, hit in A1in does promote: values are read by different RPC calls, not correlated.
+type twoQueue struct {
+	in   *List // A1in - FIFO of keys seen once
+	main *List // Am - LRU of keys seen more than once (or seen again soon after eviction)
+	out  ghosts
+	lock sync.Mutex
+}
+
+func newTwoQueue() *twoQueue { return &twoQueue{in: NewList(), main: NewList(), out: newGhosts()} }
+
+func (q *twoQueue) Init() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.in.Init()
+	q.main.Init()
+	q.out.init()
+}
+
+func (q *twoQueue) Add(e *Element) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.out.take(e.K) {
+		q.main.PushFront(e)
+		return
+	}
+	q.in.PushFront(e)
+}
+
+func (q *twoQueue) Touch(e *Element) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if e.list == q.in {
+		q.in.Remove(e)
+		q.main.PushFront(e)
+		return
+	}
+	q.main.MoveToFront(e)
+}
+
+func (q *twoQueue) Remove(e *Element) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.in.Remove(e)
+	q.main.Remove(e)
+}
+
+func (q *twoQueue) Evict() *Element {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	resident := q.in.Len() + q.main.Len()
+	if q.in.Len() > resident/4 || q.main.Len() == 0 { // Kin = 25% of resident
+		e := q.in.Back()
+		if e == nil {
+			return nil
+		}
+		q.in.Remove(e)
+		q.out.add(e.K, resident/2) // Kout = 50% of resident
+		return e
+	}
+	e := q.main.Back()
+	q.main.Remove(e)
+	return e
+}
+
+func (q *twoQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.in.Len() + q.main.Len()
+}
+
+// arc - https://www.usenix.org/legacy/events/fast03/tech/full_papers/megiddo/megiddo.pdf
+// Capacity is not fixed (cache has budget in bytes), so amount of resident elements is used as capacity.
+type arc struct {
+	t1, t2 *List // recency and frequency lists
+	b1, b2 ghosts
+	p      int // target size of t1
+	lock   sync.Mutex
+}
+
+func newArc() *arc { return &arc{t1: NewList(), t2: NewList(), b1: newGhosts(), b2: newGhosts()} }
+
+func (a *arc) Init() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.t1.Init()
+	a.t2.Init()
+	a.b1.init()
+	a.b2.init()
+	a.p = 0
+}
+
+func (a *arc) Add(e *Element) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	resident := a.t1.Len() + a.t2.Len()
+	switch {
+	case a.b1.take(e.K): // recency list was too short
+		delta := 1
+		if a.b2.l.Len() > a.b1.l.Len() {
+			delta = a.b2.l.Len() / (a.b1.l.Len() + 1)
+		}
+		a.p = min(a.p+delta, resident)
+		a.t2.PushFront(e)
+	case a.b2.take(e.K): // frequency list was too short
+		delta := 1
+		if a.b1.l.Len() > a.b2.l.Len() {
+			delta = a.b1.l.Len() / (a.b2.l.Len() + 1)
+		}
+		a.p = max(a.p-delta, 0)
+		a.t2.PushFront(e)
+	default:
+		a.t1.PushFront(e)
+	}
+}
+
+func (a *arc) Touch(e *Element) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if e.list == a.t1 {
+		a.t1.Remove(e)
+		a.t2.PushFront(e)
+		return
+	}
+	a.t2.MoveToFront(e)
+}
+
+func (a *arc) Remove(e *Element) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.t1.Remove(e)
+	a.t2.Remove(e)
+}
+
+func (a *arc) Evict() *Element {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	resident := a.t1.Len() + a.t2.Len()
+	if a.t1.Len() > 0 && (a.t1.Len() > a.p || a.t2.Len() == 0) {
+		e := a.t1.Back()
+		a.t1.Remove(e)
+		a.b1.add(e.K, resident)
+		return e
+	}
+	e := a.t2.Back()
+	if e == nil {
+		return nil
+	}
+	a.t2.Remove(e)
+	a.b2.add(e.K, resident)
+	return e
+}
+
+func (a *arc) Len() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.t1.Len() + a.t2.Len()
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
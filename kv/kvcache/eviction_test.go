@@ -0,0 +1,146 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvcache
+
+import (
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSizeLimit(t *testing.T) {
+	require := require.New(t)
+	for _, p := range []EvictionPolicy{LRU, TwoQ, ARC} {
+		cfg := DefaultCoherentConfig
+		cfg.EvictionPolicy = p
+		cfg.CacheSize = datasize.ByteSize(3 * (100 + 1 + elementOverhead))
+		cfg.NewBlockWait = 0
+		c := New(cfg)
+		c.advanceRoot(1)
+		r := c.roots[1]
+		for i := byte(0); i < 10; i++ {
+			c.add([]byte{i}, make([]byte, 100), r, 1)
+			require.LessOrEqual(c.stateSize, int(cfg.CacheSize), p)
+		}
+		require.Equal(3, c.stateEvict.Len(), p)
+		require.Equal(3, r.cache.Len(), p)
+
+		// replace must not double-count
+		c.add([]byte{9}, make([]byte, 100), r, 1)
+		require.Equal(3*(100+1+elementOverhead), c.stateSize, p)
+
+		// element bigger than budget doesn't stay in cache
+		c.add([]byte{100}, make([]byte, 10_000), r, 1)
+		require.Equal(0, c.stateSize, p)
+		require.Equal(0, r.cache.Len(), p)
+	}
+}
+
+func TestUnknownEvictionPolicy(t *testing.T) {
+	cfg := DefaultCoherentConfig
+	cfg.EvictionPolicy = "fifo"
+	require.Panics(t, func() { New(cfg) })
+}
+
+// scan resistance: hot keys survive one-time read of many keys
+func TestEvictionScanResistance(t *testing.T) {
+	require := require.New(t)
+	for _, p := range []EvictionPolicy{TwoQ, ARC} {
+		cfg := DefaultCoherentConfig
+		cfg.EvictionPolicy = p
+		cfg.KeysLimit = 8
+		cfg.NewBlockWait = 0
+		c := New(cfg)
+		c.advanceRoot(1)
+		r := c.roots[1]
+		hot := []*Element{c.add([]byte{0, 1}, []byte{1}, r, 1), c.add([]byte{0, 2}, []byte{1}, r, 1)}
+		for i := 0; i < 3; i++ {
+			for _, e := range hot {
+				c.stateEvict.Touch(e)
+			}
+		}
+		for i := byte(0); i < 100; i++ {
+			c.add([]byte{1, i}, []byte{1}, r, 1)
+		}
+		for _, e := range hot {
+			_, ok := r.cache.Get(e)
+			require.True(ok, p)
+		}
+		require.Equal(8, c.stateEvict.Len(), p)
+	}
+
+	// LRU doesn't have such property
+	cfg := DefaultCoherentConfig
+	cfg.KeysLimit = 8
+	c := New(cfg)
+	c.advanceRoot(1)
+	r := c.roots[1]
+	hot := c.add([]byte{0, 1}, []byte{1}, r, 1)
+	c.stateEvict.Touch(hot)
+	for i := byte(0); i < 100; i++ {
+		c.add([]byte{1, i}, []byte{1}, r, 1)
+	}
+	_, ok := r.cache.Get(hot)
+	require.False(ok)
+}
+
+func TestTwoQueueGhosts(t *testing.T) {
+	require := require.New(t)
+	q := newTwoQueue()
+	for i := byte(0); i < 8; i++ {
+		q.Add(&Element{K: []byte{i}})
+	}
+	victim := q.Evict()
+	require.Equal([]byte{0}, victim.K)
+	require.Equal(7, q.Len())
+
+	// evicted recently - goes to main queue
+	again := &Element{K: []byte{0}}
+	q.Add(again)
+	require.Equal(q.main, again.list)
+
+	q.Remove(again)
+	require.Nil(again.list)
+	require.Equal(7, q.Len())
+
+	q.Init()
+	require.Equal(0, q.Len())
+	require.Nil(q.Evict())
+}
+
+func TestArcAdaptation(t *testing.T) {
+	require := require.New(t)
+	a := newArc()
+	for i := byte(0); i < 4; i++ {
+		a.Add(&Element{K: []byte{i}})
+	}
+	e := a.Evict()
+	require.Equal([]byte{0}, e.K)
+	require.Equal(0, a.p)
+
+	// hit in recency-ghosts: grow target of t1, element goes to frequency list
+	again := &Element{K: []byte{0}}
+	a.Add(again)
+	require.Equal(a.t2, again.list)
+	require.Equal(1, a.p)
+
+	other := a.t1.Back()
+	a.Touch(other)
+	require.Equal(a.t2, other.list)
+	require.Equal(4, a.Len())
+}
@@ -0,0 +1,237 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvcrypt - kv.RwDB wrapper which encrypts values (and optionally keys) of some tables by AES-GCM.
+//
+// Values of usual tables are encrypted with random nonce. Values of DupSort tables and keys - deterministically
+// (nonce is HMAC of plaintext): it's required for exact-match lookups, but leaks equality of encrypted items.
+// Values are authenticated with table name and key as stored in db: value can't be moved under another key.
+//
+// Limitations of encrypted tables:
+//   - order of encrypted keys is lost: Seek/ForPrefix/ForEach by non-empty prefix return kv.ErrNotSupported,
+//     iteration by First/Next visits all keys in random order, Append works as Put
+//   - order of DupSort values is lost: SeekBothRange returns kv.ErrNotSupported, AppendDup works as Put
+//   - keys can't be encrypted in DupSort tables
+package kvcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// KeyProvider - source of encryption keys. Keys are requested once - when db is wrapped.
+type KeyProvider interface {
+	// TableKey - AES-128/192/256 key of table. nil - table is not encrypted
+	TableKey(table string) ([]byte, error)
+}
+
+// StaticKeys - KeyProvider with keys known in advance, table name -> key
+type StaticKeys map[string][]byte
+
+func (s StaticKeys) TableKey(table string) ([]byte, error) { return s[table], nil }
+
+const nonceSize = 12
+
+var randReader = rand.Reader // source of random nonces
+
+// tableCipher - encryption of 1 table
+type tableCipher struct {
+	name        string
+	aead        cipher.AEAD
+	nonceKey    []byte // key of HMAC for deterministic nonce
+	encryptKeys bool
+	dupSort     bool
+}
+
+func newTableCipher(name string, key []byte, cfg kv.TableCfgItem, encryptKeys bool) (*tableCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("kvcrypt: table %s: %w", name, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("kvcrypt: table %s: %w", name, err)
+	}
+	dupSort := cfg.Flags&kv.DupSort != 0 || cfg.AutoDupSortKeysConversion
+	if encryptKeys && dupSort {
+		return nil, fmt.Errorf("kvcrypt: table %s: keys of DupSort table can't be encrypted", name)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("kvcrypt nonce"))
+	return &tableCipher{name: name, aead: aead, nonceKey: mac.Sum(nil), encryptKeys: encryptKeys, dupSort: dupSort}, nil
+}
+
+// seal - ad is additional data. Deterministic nonce depends on ad too: same nonce is never used with different ad
+func (t *tableCipher) seal(plain, ad []byte, deterministic bool) ([]byte, error) {
+	out := make([]byte, nonceSize, nonceSize+len(plain)+t.aead.Overhead())
+	if deterministic {
+		mac := hmac.New(sha256.New, t.nonceKey)
+		var adLen [binary.MaxVarintLen64]byte
+		mac.Write(adLen[:binary.PutUvarint(adLen[:], uint64(len(ad)))])
+		mac.Write(ad)
+		mac.Write(plain)
+		copy(out, mac.Sum(nil))
+	} else if _, err := io.ReadFull(randReader, out); err != nil {
+		return nil, fmt.Errorf("kvcrypt: table %s: can't read random nonce: %w", t.name, err)
+	}
+	return t.aead.Seal(out, out, plain, ad), nil
+}
+
+func (t *tableCipher) open(sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < nonceSize+t.aead.Overhead() {
+		return nil, fmt.Errorf("kvcrypt: table %s: encrypted item is too short: %d", t.name, len(sealed))
+	}
+	plain, err := t.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("kvcrypt: table %s: %w", t.name, err)
+	}
+	if plain == nil {
+		plain = []byte{}
+	}
+	return plain, nil
+}
+
+func (t *tableCipher) key(k []byte) []byte {
+	if !t.encryptKeys || k == nil {
+		return k
+	}
+	sealed, _ := t.seal(k, []byte(t.name), true) // deterministic nonce: no error
+	return sealed
+}
+
+// valueAD - additional data of value: table name and key as stored in db (encrypted if keys are encrypted).
+// Name is the same for all values of table - so concatenation is unambiguous
+func (t *tableCipher) valueAD(storedK []byte) []byte {
+	return append([]byte(t.name), storedK...)
+}
+
+// value - storedK is key as stored in db, see key
+func (t *tableCipher) value(storedK, v []byte) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return t.seal(v, t.valueAD(storedK), t.dupSort)
+}
+
+func (t *tableCipher) openValue(storedK, v []byte) ([]byte, error) {
+	return t.open(v, t.valueAD(storedK))
+}
+
+// decrypt - k,v read from underlying db
+func (t *tableCipher) decrypt(k, v []byte) ([]byte, []byte, error) {
+	if k == nil {
+		return nil, nil, nil
+	}
+	var err error
+	if v != nil {
+		if v, err = t.openValue(k, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	if t.encryptKeys {
+		if k, err = t.open(k, []byte(t.name)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return k, v, nil
+}
+
+// EncryptedDB - see package docs
+type EncryptedDB struct {
+	kv.RwDB
+	tables map[string]*tableCipher
+}
+
+var _ kv.RwDB = (*EncryptedDB)(nil)
+
+// New - wraps db. Tables listed in encryptKeysOf have encrypted keys, other tables (with key in provider) - only values.
+// Encryption of table can't be enabled/disabled after data was written to it.
+func New(db kv.RwDB, keys KeyProvider, encryptKeysOf ...string) (*EncryptedDB, error) {
+	encryptKeys := make(map[string]bool, len(encryptKeysOf))
+	for _, name := range encryptKeysOf {
+		encryptKeys[name] = true
+	}
+	edb := &EncryptedDB{RwDB: db, tables: map[string]*tableCipher{}}
+	for name, cfg := range db.AllBuckets() {
+		key, err := keys.TableKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("kvcrypt: key of table %s: %w", name, err)
+		}
+		if key == nil {
+			if encryptKeys[name] {
+				return nil, fmt.Errorf("kvcrypt: table %s: no encryption key", name)
+			}
+			continue
+		}
+		t, err := newTableCipher(name, key, cfg, encryptKeys[name])
+		if err != nil {
+			return nil, err
+		}
+		edb.tables[name] = t
+	}
+	for name := range encryptKeys {
+		if _, ok := edb.tables[name]; !ok {
+			return nil, fmt.Errorf("kvcrypt: table %s: not found", name)
+		}
+	}
+	return edb, nil
+}
+
+func (db *EncryptedDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedTx{Tx: tx, db: db}, nil
+}
+
+func (db *EncryptedDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedRwTx{encryptedTx: &encryptedTx{Tx: tx, db: db}, rw: tx}, nil
+}
+
+func (db *EncryptedDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *EncryptedDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,187 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvcrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedDB(t *testing.T) {
+	ctx := context.Background()
+	raw := memdb.NewTestPoolDB(t)
+	keys := StaticKeys{
+		kv.PoolTransaction: bytes.Repeat([]byte{1}, 32),
+		kv.PoolInfo:        bytes.Repeat([]byte{2}, 16),
+	}
+	db, err := New(raw, keys, kv.PoolInfo)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put(kv.PoolTransaction, []byte("tx1"), []byte("rlp1")))
+		require.NoError(t, tx.Put(kv.PoolTransaction, []byte("tx2"), []byte("rlp2")))
+		require.NoError(t, tx.Put(kv.PoolInfo, []byte("secret"), []byte("value")))
+		return tx.Put(kv.RecentLocalTransaction, []byte("plain"), []byte("plain"))
+	}))
+
+	// raw db doesn't contain plaintext of encrypted tables
+	require.NoError(t, raw.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.PoolTransaction, []byte("tx1"))
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		require.NotContains(t, string(v), "rlp1")
+		has, err := tx.Has(kv.PoolInfo, []byte("secret"))
+		require.NoError(t, err)
+		require.False(t, has)
+		v, err = tx.GetOne(kv.RecentLocalTransaction, []byte("plain"))
+		require.NoError(t, err)
+		require.Equal(t, "plain", string(v))
+		return nil
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.PoolTransaction, []byte("tx2"))
+		require.NoError(t, err)
+		require.Equal(t, "rlp2", string(v))
+		v, err = tx.GetOne(kv.PoolInfo, []byte("secret"))
+		require.NoError(t, err)
+		require.Equal(t, "value", string(v))
+		vals, err := tx.(kv.ManyGetter).GetMany(kv.PoolTransaction, [][]byte{[]byte("tx1"), []byte("none")})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("rlp1"), nil}, vals)
+
+		var seen []string
+		require.NoError(t, tx.ForEach(kv.PoolTransaction, nil, func(k, v []byte) error {
+			seen = append(seen, string(k)+"="+string(v))
+			return nil
+		}))
+		require.Equal(t, []string{"tx1=rlp1", "tx2=rlp2"}, seen)
+		it, err := tx.(kv.Ranger).Range(kv.PoolTransaction, []byte("tx2"), nil)
+		require.NoError(t, err)
+		keys, values, err := iter.ToArrayKV(it)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("tx2")}, keys)
+		require.Equal(t, [][]byte{[]byte("rlp2")}, values)
+		_, err = tx.(kv.Ranger).Range(kv.PoolInfo, []byte("sec"), nil)
+		require.True(t, errors.Is(err, kv.ErrNotSupported))
+
+		c, err := tx.Cursor(kv.PoolInfo)
+		require.NoError(t, err)
+		defer c.Close()
+		k, v, err := c.First()
+		require.NoError(t, err)
+		require.Equal(t, "secret", string(k))
+		require.Equal(t, "value", string(v))
+		_, _, err = c.Seek([]byte("sec"))
+		require.True(t, errors.Is(err, kv.ErrNotSupported))
+		return nil
+	}))
+
+	// value moved under another key doesn't authenticate
+	require.NoError(t, raw.Update(ctx, func(tx kv.RwTx) error {
+		v, err := tx.GetOne(kv.PoolTransaction, []byte("tx1"))
+		require.NoError(t, err)
+		return tx.Put(kv.PoolTransaction, []byte("tx3"), v)
+	}))
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.PoolTransaction, []byte("tx3"))
+		require.Error(t, err)
+		return nil
+	}))
+
+	// wrong key can't decrypt
+	wrong, err := New(raw, StaticKeys{kv.PoolTransaction: bytes.Repeat([]byte{3}, 32)})
+	require.NoError(t, err)
+	require.NoError(t, wrong.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.PoolTransaction, []byte("tx1"))
+		require.Error(t, err)
+		return nil
+	}))
+}
+
+func TestEncryptedDupSort(t *testing.T) {
+	ctx := context.Background()
+	raw := memdb.NewTestDB(t)
+	db, err := New(raw, StaticKeys{kv.PlainState: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	_, err = New(raw, StaticKeys{kv.PlainState: bytes.Repeat([]byte{1}, 32)}, kv.PlainState)
+	require.Error(t, err)
+
+	addr := bytes.Repeat([]byte{0xaa}, 20)
+	storageKey := append(append(append([]byte{}, addr...), 0, 0, 0, 0, 0, 0, 0, 1), bytes.Repeat([]byte{0xbb}, 32)...)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put(kv.PlainState, addr, []byte("account")))
+		require.NoError(t, tx.Put(kv.PlainState, storageKey, []byte("v1")))
+		require.NoError(t, tx.Put(kv.PlainState, storageKey, []byte("v2")))
+
+		v, err := tx.GetOne(kv.PlainState, storageKey)
+		require.NoError(t, err)
+		require.Equal(t, "v2", string(v))
+
+		c, err := tx.RwCursorDupSort(kv.PlainState)
+		require.NoError(t, err)
+		defer c.Close()
+		k, v, err := c.First()
+		require.NoError(t, err)
+		require.Equal(t, addr, k)
+		require.Equal(t, "account", string(v))
+		k, v, err = c.Next()
+		require.NoError(t, err)
+		require.Equal(t, storageKey, k)
+		require.Equal(t, "v2", string(v))
+		k, _, err = c.Next()
+		require.NoError(t, err)
+		require.Nil(t, k)
+
+		require.NoError(t, tx.Delete(kv.PlainState, storageKey, nil))
+		v, err = tx.GetOne(kv.PlainState, storageKey)
+		require.NoError(t, err)
+		require.Nil(t, v)
+		return nil
+	}))
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+func TestRandomNonceError(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(memdb.NewTestPoolDB(t), StaticKeys{kv.PoolTransaction: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	defer func(r io.Reader) { randReader = r }(randReader)
+	randReader = failingReader{}
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.Error(t, tx.Put(kv.PoolTransaction, []byte("tx1"), []byte("rlp1")))
+		c, err := tx.RwCursor(kv.PoolTransaction)
+		require.NoError(t, err)
+		defer c.Close()
+		require.Error(t, c.Put([]byte("tx1"), []byte("rlp1")))
+		return nil
+	}))
+}
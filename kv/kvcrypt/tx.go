@@ -0,0 +1,511 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvcrypt
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// encryptedTx - methods which don't touch keys/values of tables (ViewID, Commit, BucketSize, ...) are not wrapped
+type encryptedTx struct {
+	kv.Tx
+	db *EncryptedDB
+}
+
+var _ kv.Tx = (*encryptedTx)(nil)
+var _ kv.RwTx = (*encryptedRwTx)(nil)
+
+func (tx *encryptedTx) Has(table string, key []byte) (bool, error) {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.Tx.Has(table, key)
+	}
+	return tx.Tx.Has(table, t.key(key))
+}
+
+func (tx *encryptedTx) GetOne(table string, key []byte) ([]byte, error) {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.Tx.GetOne(table, key)
+	}
+	storedK := t.key(key)
+	v, err := tx.Tx.GetOne(table, storedK)
+	if err != nil || v == nil {
+		return v, err
+	}
+	return t.openValue(storedK, v)
+}
+
+func (tx *encryptedTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return kv.GetMany(tx.Tx, table, keys)
+	}
+	encKeys := keys
+	if t.encryptKeys {
+		encKeys = make([][]byte, len(keys))
+		for i := range keys {
+			encKeys[i] = t.key(keys[i])
+		}
+	}
+	vals, err := kv.GetMany(tx.Tx, table, encKeys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range vals {
+		if vals[i] == nil {
+			continue
+		}
+		if vals[i], err = t.openValue(encKeys[i], vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *encryptedTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.Tx.ForEach(table, fromPrefix, walker)
+	}
+	if t.encryptKeys && len(fromPrefix) > 0 {
+		return fmt.Errorf("kvcrypt: ForEach from key in table with encrypted keys %s: %w", table, kv.ErrNotSupported)
+	}
+	return tx.Tx.ForEach(table, fromPrefix, func(k, v []byte) error {
+		k, v, err := t.decrypt(k, v)
+		if err != nil {
+			return err
+		}
+		return walker(k, v)
+	})
+}
+
+func (tx *encryptedTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.Tx.ForPrefix(table, prefix, walker)
+	}
+	if t.encryptKeys && len(prefix) > 0 {
+		return fmt.Errorf("kvcrypt: ForPrefix in table with encrypted keys %s: %w", table, kv.ErrNotSupported)
+	}
+	return tx.Tx.ForPrefix(table, prefix, func(k, v []byte) error {
+		k, v, err := t.decrypt(k, v)
+		if err != nil {
+			return err
+		}
+		return walker(k, v)
+	})
+}
+
+func (tx *encryptedTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.Tx.ForAmount(table, prefix, amount, walker)
+	}
+	if t.encryptKeys && len(prefix) > 0 {
+		return fmt.Errorf("kvcrypt: ForAmount from key in table with encrypted keys %s: %w", table, kv.ErrNotSupported)
+	}
+	return tx.Tx.ForAmount(table, prefix, amount, func(k, v []byte) error {
+		k, v, err := t.decrypt(k, v)
+		if err != nil {
+			return err
+		}
+		return walker(k, v)
+	})
+}
+
+// Range - order of encrypted keys is random: range of keys is not supported, only whole table
+func (tx *encryptedTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return kv.Range(tx.Tx, table, fromPrefix, toPrefix)
+	}
+	if t.encryptKeys && (len(fromPrefix) > 0 || len(toPrefix) > 0) {
+		return nil, fmt.Errorf("kvcrypt: Range in table with encrypted keys %s: %w", table, kv.ErrNotSupported)
+	}
+	s, err := kv.Range(tx.Tx, table, fromPrefix, toPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return iter.TransformKV(s, t.decrypt), nil
+}
+
+// TableStats - sizes of encrypted pairs
+func (tx *encryptedTx) TableStats(table string) (kv.TableStats, error) {
+	return kv.ReadTableStats(tx.Tx, table)
+}
+
+func (tx *encryptedTx) Cursor(table string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return c, nil
+	}
+	if dc, ok := c.(kv.CursorDupSort); ok {
+		return &encryptedDupSortCursor{encryptedCursor: &encryptedCursor{c: c, t: t}, dc: dc}, nil
+	}
+	return &encryptedCursor{c: c, t: t}, nil
+}
+
+func (tx *encryptedTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	c, err := tx.Tx.CursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return c, nil
+	}
+	return &encryptedDupSortCursor{encryptedCursor: &encryptedCursor{c: c, t: t}, dc: c}, nil
+}
+
+type encryptedRwTx struct {
+	*encryptedTx
+	rw    kv.RwTx
+	hooks kv.WrapperHooks
+}
+
+func (tx *encryptedRwTx) Commit() error { return tx.hooks.Commit(tx.rw.Commit, tx.rw.Rollback) }
+
+func (tx *encryptedRwTx) Rollback() {
+	tx.hooks.Reset()
+	tx.rw.Rollback()
+}
+
+func (tx *encryptedRwTx) Put(table string, k, v []byte) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.rw.Put(table, k, v)
+	}
+	storedK := t.key(k)
+	sealed, err := t.value(storedK, v)
+	if err != nil {
+		return err
+	}
+	return tx.rw.Put(table, storedK, sealed)
+}
+
+func (tx *encryptedRwTx) Delete(table string, k, v []byte) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.rw.Delete(table, k, v)
+	}
+	if !t.dupSort {
+		v = nil // value is ignored by non-DupSort tables
+	}
+	storedK := t.key(k)
+	sealed, err := t.value(storedK, v)
+	if err != nil {
+		return err
+	}
+	return tx.rw.Delete(table, storedK, sealed)
+}
+
+// Append - order of encrypted keys is lost: works as Put
+func (tx *encryptedRwTx) Append(table string, k, v []byte) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.rw.Append(table, k, v)
+	}
+	if t.encryptKeys {
+		storedK := t.key(k)
+		sealed, err := t.value(storedK, v)
+		if err != nil {
+			return err
+		}
+		return tx.rw.Put(table, storedK, sealed)
+	}
+	sealed, err := t.value(k, v)
+	if err != nil {
+		return err
+	}
+	return tx.rw.Append(table, k, sealed)
+}
+
+// AppendDup - order of encrypted values is lost: works as Put
+func (tx *encryptedRwTx) AppendDup(table string, k, v []byte) error {
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return tx.rw.AppendDup(table, k, v)
+	}
+	sealed, err := t.value(k, v)
+	if err != nil {
+		return err
+	}
+	return tx.rw.Put(table, k, sealed)
+}
+
+func (tx *encryptedRwTx) IncrementSequence(table string, amount uint64) (uint64, error) {
+	return tx.rw.IncrementSequence(table, amount)
+}
+
+func (tx *encryptedRwTx) DropBucket(table string) error   { return tx.rw.DropBucket(table) }
+func (tx *encryptedRwTx) CreateBucket(table string) error { return tx.rw.CreateBucket(table) }
+func (tx *encryptedRwTx) ExistsBucket(table string) (bool, error) {
+	return tx.rw.ExistsBucket(table)
+}
+func (tx *encryptedRwTx) ClearBucket(table string) error { return tx.rw.ClearBucket(table) }
+
+// PreCommit, PostCommit - hooks of underlying tx, see kv.CommitHooks. Hooks must write through this tx to be encrypted
+func (tx *encryptedRwTx) PreCommit(f func() error) { tx.hooks.Of(tx.rw).PreCommit(f) }
+func (tx *encryptedRwTx) PostCommit(f func())      { tx.hooks.Of(tx.rw).PostCommit(f) }
+
+// DeleteRange - order of encrypted keys is random: range of keys is not supported, only whole table
+func (tx *encryptedRwTx) DeleteRange(table string, fromKey, toKey []byte) error {
+	if t, ok := tx.db.tables[table]; ok && t.encryptKeys && (len(fromKey) > 0 || len(toKey) > 0) {
+		return fmt.Errorf("kvcrypt: DeleteRange in table with encrypted keys %s: %w", table, kv.ErrNotSupported)
+	}
+	return kv.DeleteRange(tx.rw, table, fromKey, toKey)
+}
+func (tx *encryptedRwTx) ListBuckets() ([]string, error) { return tx.rw.ListBuckets() }
+func (tx *encryptedRwTx) CollectMetrics()                { tx.rw.CollectMetrics() }
+func (tx *encryptedRwTx) RwCursor(table string) (kv.RwCursor, error) {
+	c, err := tx.rw.RwCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return c, nil
+	}
+	if dc, ok := c.(kv.RwCursorDupSort); ok {
+		return &encryptedDupSortCursor{encryptedCursor: &encryptedCursor{c: c, t: t}, dc: dc}, nil
+	}
+	return &encryptedCursor{c: c, t: t}, nil
+}
+
+func (tx *encryptedRwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	c, err := tx.rw.RwCursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := tx.db.tables[table]
+	if !ok {
+		return c, nil
+	}
+	return &encryptedDupSortCursor{encryptedCursor: &encryptedCursor{c: c, t: t}, dc: c}, nil
+}
+
+// encryptedCursor - wraps any kind of cursor: write methods fail if underlying cursor is read-only
+type encryptedCursor struct {
+	c kv.Cursor
+	t *tableCipher
+}
+
+var _ kv.RwCursor = (*encryptedCursor)(nil)
+var _ kv.RwCursorDupSort = (*encryptedDupSortCursor)(nil)
+
+func (c *encryptedCursor) decrypt(k, v []byte, err error) ([]byte, []byte, error) {
+	if err != nil {
+		return k, v, err
+	}
+	k, v, err = c.t.decrypt(k, v)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *encryptedCursor) rw() (kv.RwCursor, error) {
+	rw, ok := c.c.(kv.RwCursor)
+	if !ok {
+		return nil, fmt.Errorf("kvcrypt: table %s: cursor is read-only", c.t.name)
+	}
+	return rw, nil
+}
+
+func (c *encryptedCursor) First() ([]byte, []byte, error) { return c.decrypt(c.c.First()) }
+func (c *encryptedCursor) Next() ([]byte, []byte, error)  { return c.decrypt(c.c.Next()) }
+func (c *encryptedCursor) Prev() ([]byte, []byte, error)  { return c.decrypt(c.c.Prev()) }
+func (c *encryptedCursor) Last() ([]byte, []byte, error)  { return c.decrypt(c.c.Last()) }
+func (c *encryptedCursor) Current() ([]byte, []byte, error) {
+	return c.decrypt(c.c.Current())
+}
+func (c *encryptedCursor) Count() (uint64, error) { return c.c.Count() }
+func (c *encryptedCursor) Close()                 { c.c.Close() }
+
+func (c *encryptedCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if c.t.encryptKeys && len(seek) > 0 {
+		return []byte{}, nil, fmt.Errorf("kvcrypt: Seek in table with encrypted keys %s: %w", c.t.name, kv.ErrNotSupported)
+	}
+	return c.decrypt(c.c.Seek(seek))
+}
+
+func (c *encryptedCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	return c.decrypt(c.c.SeekExact(c.t.key(key)))
+}
+
+func (c *encryptedCursor) Put(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	storedK := c.t.key(k)
+	sealed, err := c.t.value(storedK, v)
+	if err != nil {
+		return err
+	}
+	return rw.Put(storedK, sealed)
+}
+
+// Append - order of encrypted keys is lost: works as Put
+func (c *encryptedCursor) Append(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	if c.t.encryptKeys {
+		storedK := c.t.key(k)
+		sealed, err := c.t.value(storedK, v)
+		if err != nil {
+			return err
+		}
+		return rw.Put(storedK, sealed)
+	}
+	sealed, err := c.t.value(k, v)
+	if err != nil {
+		return err
+	}
+	return rw.Append(k, sealed)
+}
+
+func (c *encryptedCursor) Delete(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	if !c.t.dupSort {
+		v = nil
+	}
+	storedK := c.t.key(k)
+	sealed, err := c.t.value(storedK, v)
+	if err != nil {
+		return err
+	}
+	return rw.Delete(storedK, sealed)
+}
+
+func (c *encryptedCursor) DeleteCurrent() error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	return rw.DeleteCurrent()
+}
+
+type encryptedDupSortCursor struct {
+	*encryptedCursor
+	dc kv.CursorDupSort
+}
+
+func (c *encryptedDupSortCursor) rwDup() (kv.RwCursorDupSort, error) {
+	rw, ok := c.dc.(kv.RwCursorDupSort)
+	if !ok {
+		return nil, fmt.Errorf("kvcrypt: table %s: cursor is read-only", c.t.name)
+	}
+	return rw, nil
+}
+
+func (c *encryptedDupSortCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	sealed, err := c.t.value(key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	k, v, err := c.dc.SeekBothExact(key, sealed)
+	if err != nil || k == nil {
+		return k, v, err
+	}
+	return c.decrypt(k, v, nil)
+}
+
+// SeekBothRange - order of encrypted values is lost
+func (c *encryptedDupSortCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	return nil, fmt.Errorf("kvcrypt: SeekBothRange in table with encrypted values %s: %w", c.t.name, kv.ErrNotSupported)
+}
+
+func (c *encryptedDupSortCursor) openValue(v []byte, err error) ([]byte, error) {
+	if err != nil || v == nil {
+		return v, err
+	}
+	k, _, err := c.dc.Current() // keys of DupSort tables are not encrypted
+	if err != nil {
+		return nil, err
+	}
+	return c.t.openValue(k, v)
+}
+
+func (c *encryptedDupSortCursor) FirstDup() ([]byte, error) { return c.openValue(c.dc.FirstDup()) }
+func (c *encryptedDupSortCursor) LastDup() ([]byte, error)  { return c.openValue(c.dc.LastDup()) }
+func (c *encryptedDupSortCursor) NextDup() ([]byte, []byte, error) {
+	return c.decrypt(c.dc.NextDup())
+}
+func (c *encryptedDupSortCursor) NextNoDup() ([]byte, []byte, error) {
+	return c.decrypt(c.dc.NextNoDup())
+}
+func (c *encryptedDupSortCursor) CountDuplicates() (uint64, error) { return c.dc.CountDuplicates() }
+
+func (c *encryptedDupSortCursor) PutNoDupData(key, value []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	sealed, err := c.t.value(key, value)
+	if err != nil {
+		return err
+	}
+	return rw.PutNoDupData(key, sealed)
+}
+
+func (c *encryptedDupSortCursor) DeleteCurrentDuplicates() error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	return rw.DeleteCurrentDuplicates()
+}
+
+// AppendDup - order of encrypted values is lost: works as Put
+func (c *encryptedDupSortCursor) AppendDup(key, value []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	sealed, err := c.t.value(key, value)
+	if err != nil {
+		return err
+	}
+	return rw.Put(key, sealed)
+}
+
+// Append - order of encrypted values is lost: works as Put
+func (c *encryptedDupSortCursor) Append(key, value []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	sealed, err := c.t.value(key, value)
+	if err != nil {
+		return err
+	}
+	return rw.Put(key, sealed)
+}
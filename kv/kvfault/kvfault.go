@@ -0,0 +1,159 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvfault - kv.RwDB decorator for tests: failures are scripted in advance and happen deterministically
+// (error on Nth commit, error when read lands on given key, slow reads). Allows to test error paths of code
+// which works with kv.RwDB - real db doesn't fail on demand.
+package kvfault
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// ErrInjected - default error of scripted failures
+var ErrInjected = errors.New("kvfault: injected failure")
+
+// FaultyDB - see package docs. Has no faults after creation
+type FaultyDB struct {
+	kv.RwDB
+
+	lock      sync.Mutex
+	commits   int                         // amount of commits (successful or not) since creation
+	commitErr map[int]error               // number of commit -> error
+	keyErr    map[string]map[string]error // table -> key -> error
+	readDelay time.Duration
+}
+
+var _ kv.RwDB = (*FaultyDB)(nil)
+
+func New(db kv.RwDB) *FaultyDB {
+	return &FaultyDB{RwDB: db, commitErr: map[int]error{}, keyErr: map[string]map[string]error{}}
+}
+
+func orDefault(err error) error {
+	if err == nil {
+		return ErrInjected
+	}
+	return err
+}
+
+// FailCommit - n-th commit from now (1 - next one) returns err (nil - ErrInjected), transaction is rolled back
+func (db *FaultyDB) FailCommit(n int, err error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.commitErr[db.commits+n] = orDefault(err)
+}
+
+// FailKey - reads of key in table (GetOne, Has, GetMany, iteration, cursor positioned on it) return err (nil - ErrInjected)
+func (db *FaultyDB) FailKey(table string, key []byte, err error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.keyErr[table] == nil {
+		db.keyErr[table] = map[string]error{}
+	}
+	db.keyErr[table][string(key)] = orDefault(err)
+}
+
+// SlowReads - each read operation sleeps d before return. 0 - disable
+func (db *FaultyDB) SlowReads(d time.Duration) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.readDelay = d
+}
+
+// Reset - removes all scripted faults
+func (db *FaultyDB) Reset() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.commitErr = map[int]error{}
+	db.keyErr = map[string]map[string]error{}
+	db.readDelay = 0
+}
+
+// Commits - amount of commits (successful or not) since creation
+func (db *FaultyDB) Commits() int {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.commits
+}
+
+func (db *FaultyDB) nextCommit() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.commits++
+	err, ok := db.commitErr[db.commits]
+	if ok {
+		delete(db.commitErr, db.commits)
+	}
+	return err
+}
+
+// read - called after each read operation which returned key k (nil - no key): sleeps and returns scripted error
+func (db *FaultyDB) read(table string, k []byte) error {
+	db.lock.Lock()
+	delay := db.readDelay
+	var err error
+	if k != nil {
+		err = db.keyErr[table][string(k)]
+	}
+	db.lock.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return err
+}
+
+func (db *FaultyDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyTx{Tx: tx, db: db}, nil
+}
+
+func (db *FaultyDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyRwTx{RwTx: tx, ro: &faultyTx{Tx: tx, db: db}}, nil
+}
+
+func (db *FaultyDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *FaultyDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
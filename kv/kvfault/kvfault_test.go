@@ -0,0 +1,125 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvfault
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailCommit(t *testing.T) {
+	ctx := context.Background()
+	db := New(memdb.NewTestDB(t))
+	put := func(k string) error {
+		return db.Update(ctx, func(tx kv.RwTx) error {
+			return tx.Put(kv.HeaderNumber, []byte(k), []byte("v"))
+		})
+	}
+	myErr := errors.New("disk full")
+	db.FailCommit(2, myErr)
+
+	require.NoError(t, put("k1"))
+	require.ErrorIs(t, put("k2"), myErr)
+	require.NoError(t, put("k3"))
+	require.Equal(t, 3, db.Commits())
+
+	// failed commit was rolled back
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for k, exists := range map[string]bool{"k1": true, "k2": false, "k3": true} {
+			has, err := tx.Has(kv.HeaderNumber, []byte(k))
+			require.NoError(t, err)
+			require.Equal(t, exists, has, k)
+		}
+		return nil
+	}))
+}
+
+func TestFailKey(t *testing.T) {
+	ctx := context.Background()
+	db := New(memdb.NewTestDB(t))
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"a", "b", "c"} {
+			if err := tx.Put(kv.HeaderNumber, []byte(k), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	db.FailKey(kv.HeaderNumber, []byte("b"), nil)
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.HeaderNumber, []byte("a"))
+		require.NoError(t, err)
+		_, err = tx.GetOne(kv.HeaderNumber, []byte("b"))
+		require.ErrorIs(t, err, ErrInjected)
+		// same key in other table is fine
+		_, err = tx.GetOne(kv.Headers, []byte("b"))
+		require.NoError(t, err)
+
+		var seen []string
+		err = tx.ForEach(kv.HeaderNumber, nil, func(k, v []byte) error {
+			seen = append(seen, string(k))
+			return nil
+		})
+		require.ErrorIs(t, err, ErrInjected)
+		require.Equal(t, []string{"a"}, seen)
+
+		c, err := tx.Cursor(kv.HeaderNumber)
+		require.NoError(t, err)
+		defer c.Close()
+		k, _, err := c.First()
+		require.NoError(t, err)
+		require.Equal(t, "a", string(k))
+		_, _, err = c.Next()
+		require.ErrorIs(t, err, ErrInjected)
+		k, _, err = c.Next()
+		require.NoError(t, err)
+		require.Equal(t, "c", string(k))
+
+		it, err := tx.(kv.Ranger).Range(kv.HeaderNumber, nil, nil)
+		require.NoError(t, err)
+		_, _, err = it.Next()
+		require.NoError(t, err)
+		_, _, err = it.Next()
+		require.ErrorIs(t, err, ErrInjected)
+		return nil
+	}))
+
+	db.Reset()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.HeaderNumber, []byte("b"))
+		return err
+	}))
+}
+
+func TestSlowReads(t *testing.T) {
+	ctx := context.Background()
+	db := New(memdb.NewTestDB(t))
+	db.SlowReads(20 * time.Millisecond)
+	start := time.Now()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.HeaderNumber, []byte("a"))
+		return err
+	}))
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
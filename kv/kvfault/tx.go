@@ -0,0 +1,366 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvfault
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// faultyTx - methods without table (ViewID, DBSize, ...) never fail
+type faultyTx struct {
+	kv.Tx
+	db *FaultyDB
+}
+
+var _ kv.Tx = (*faultyTx)(nil)
+var _ kv.RwTx = (*faultyRwTx)(nil)
+
+func (tx *faultyTx) Has(table string, key []byte) (bool, error) {
+	has, err := tx.Tx.Has(table, key)
+	if err != nil {
+		return false, err
+	}
+	if err = tx.db.read(table, key); err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+func (tx *faultyTx) GetOne(table string, key []byte) ([]byte, error) {
+	v, err := tx.Tx.GetOne(table, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.db.read(table, key); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (tx *faultyTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	vals, err := kv.GetMany(tx.Tx, table, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err = tx.db.read(table, k); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *faultyTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForEach(table, fromPrefix, tx.walker(table, walker))
+}
+
+func (tx *faultyTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForPrefix(table, prefix, tx.walker(table, walker))
+}
+
+func (tx *faultyTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.Tx.ForAmount(table, prefix, amount, tx.walker(table, walker))
+}
+
+func (tx *faultyTx) walker(table string, walker func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, v []byte) error {
+		if err := tx.db.read(table, k); err != nil {
+			return err
+		}
+		return walker(k, v)
+	}
+}
+
+func (tx *faultyTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	s, err := kv.Range(tx.Tx, table, fromPrefix, toPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyStream{KV: s, db: tx.db, table: table}, nil
+}
+
+func (tx *faultyTx) TableStats(table string) (kv.TableStats, error) {
+	return kv.ReadTableStats(tx.Tx, table)
+}
+
+func (tx *faultyTx) Cursor(table string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(tx.db, table, c), nil
+}
+
+func (tx *faultyTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	c, err := tx.Tx.CursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyDupSortCursor{faultyCursor: &faultyCursor{c: c, db: tx.db, table: table}, dc: c}, nil
+}
+
+// wrapCursor - keeps DupSort cursor type-assertable to kv.CursorDupSort
+func wrapCursor(db *FaultyDB, table string, c kv.Cursor) kv.RwCursor {
+	fc := &faultyCursor{c: c, db: db, table: table}
+	if dc, ok := c.(kv.CursorDupSort); ok {
+		return &faultyDupSortCursor{faultyCursor: fc, dc: dc}
+	}
+	return fc
+}
+
+// faultyRwTx - writes go to underlying transaction as is, reads - through faultyTx
+type faultyRwTx struct {
+	kv.RwTx
+	ro    *faultyTx
+	hooks kv.WrapperHooks
+}
+
+// PreCommit, PostCommit - hooks of underlying tx, see kv.CommitHooks. Not called if commit is scripted to fail
+func (tx *faultyRwTx) PreCommit(f func() error) { tx.hooks.Of(tx.RwTx).PreCommit(f) }
+func (tx *faultyRwTx) PostCommit(f func())      { tx.hooks.Of(tx.RwTx).PostCommit(f) }
+
+// Commit - if this commit is scripted to fail: transaction is rolled back and error returned
+func (tx *faultyRwTx) Commit() error {
+	if err := tx.ro.db.nextCommit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.hooks.Commit(tx.RwTx.Commit, tx.RwTx.Rollback)
+}
+
+func (tx *faultyRwTx) Rollback() {
+	tx.hooks.Reset()
+	tx.RwTx.Rollback()
+}
+
+func (tx *faultyRwTx) Has(table string, key []byte) (bool, error) { return tx.ro.Has(table, key) }
+func (tx *faultyRwTx) GetOne(table string, key []byte) ([]byte, error) {
+	return tx.ro.GetOne(table, key)
+}
+func (tx *faultyRwTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	return tx.ro.GetMany(table, keys)
+}
+func (tx *faultyRwTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.ro.ForEach(table, fromPrefix, walker)
+}
+func (tx *faultyRwTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.ro.ForPrefix(table, prefix, walker)
+}
+func (tx *faultyRwTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.ro.ForAmount(table, prefix, amount, walker)
+}
+func (tx *faultyRwTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	return tx.ro.Range(table, fromPrefix, toPrefix)
+}
+func (tx *faultyRwTx) TableStats(table string) (kv.TableStats, error) {
+	return tx.ro.TableStats(table)
+}
+func (tx *faultyRwTx) Cursor(table string) (kv.Cursor, error) { return tx.ro.Cursor(table) }
+func (tx *faultyRwTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	return tx.ro.CursorDupSort(table)
+}
+
+func (tx *faultyRwTx) RwCursor(table string) (kv.RwCursor, error) {
+	c, err := tx.RwTx.RwCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCursor(tx.ro.db, table, c), nil
+}
+
+func (tx *faultyRwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	c, err := tx.RwTx.RwCursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyDupSortCursor{faultyCursor: &faultyCursor{c: c, db: tx.ro.db, table: table}, dc: c}, nil
+}
+
+// faultyStream - Next fails on scripted key, stream stays usable after error
+type faultyStream struct {
+	iter.KV
+	db    *FaultyDB
+	table string
+}
+
+func (s *faultyStream) Next() ([]byte, []byte, error) {
+	k, v, err := s.KV.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = s.db.read(s.table, k); err != nil {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (s *faultyStream) Close() { iter.Close(s.KV) }
+
+// faultyCursor - wraps any kind of cursor: write methods fail if underlying cursor is read-only.
+// Positioning methods fail if cursor landed on scripted key
+type faultyCursor struct {
+	c     kv.Cursor
+	db    *FaultyDB
+	table string
+}
+
+var _ kv.RwCursor = (*faultyCursor)(nil)
+var _ kv.RwCursorDupSort = (*faultyDupSortCursor)(nil)
+
+func (c *faultyCursor) check(k, v []byte, err error) ([]byte, []byte, error) {
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.db.read(c.table, k); err != nil {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *faultyCursor) rw() (kv.RwCursor, error) {
+	rw, ok := c.c.(kv.RwCursor)
+	if !ok {
+		return nil, fmt.Errorf("kvfault: table %s: cursor is read-only", c.table)
+	}
+	return rw, nil
+}
+
+func (c *faultyCursor) First() ([]byte, []byte, error)           { return c.check(c.c.First()) }
+func (c *faultyCursor) Seek(seek []byte) ([]byte, []byte, error) { return c.check(c.c.Seek(seek)) }
+func (c *faultyCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	return c.check(c.c.SeekExact(key))
+}
+func (c *faultyCursor) Next() ([]byte, []byte, error)    { return c.check(c.c.Next()) }
+func (c *faultyCursor) Prev() ([]byte, []byte, error)    { return c.check(c.c.Prev()) }
+func (c *faultyCursor) Last() ([]byte, []byte, error)    { return c.check(c.c.Last()) }
+func (c *faultyCursor) Current() ([]byte, []byte, error) { return c.check(c.c.Current()) }
+func (c *faultyCursor) Count() (uint64, error)           { return c.c.Count() }
+func (c *faultyCursor) Close()                           { c.c.Close() }
+
+func (c *faultyCursor) Put(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	return rw.Put(k, v)
+}
+
+func (c *faultyCursor) Append(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	return rw.Append(k, v)
+}
+
+func (c *faultyCursor) Delete(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	return rw.Delete(k, v)
+}
+
+func (c *faultyCursor) DeleteCurrent() error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	return rw.DeleteCurrent()
+}
+
+type faultyDupSortCursor struct {
+	*faultyCursor
+	dc kv.CursorDupSort
+}
+
+func (c *faultyDupSortCursor) rwDup() (kv.RwCursorDupSort, error) {
+	rw, ok := c.dc.(kv.RwCursorDupSort)
+	if !ok {
+		return nil, fmt.Errorf("kvfault: table %s: cursor is read-only", c.table)
+	}
+	return rw, nil
+}
+
+func (c *faultyDupSortCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	return c.check(c.dc.SeekBothExact(key, value))
+}
+
+// SeekBothRange - doesn't return key: checks sought key
+func (c *faultyDupSortCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	v, err := c.dc.SeekBothRange(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.db.read(c.table, key); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *faultyDupSortCursor) FirstDup() ([]byte, error) {
+	v, err := c.dc.FirstDup()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.db.read(c.table, nil); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *faultyDupSortCursor) LastDup() ([]byte, error) {
+	v, err := c.dc.LastDup()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.db.read(c.table, nil); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *faultyDupSortCursor) NextDup() ([]byte, []byte, error)   { return c.check(c.dc.NextDup()) }
+func (c *faultyDupSortCursor) NextNoDup() ([]byte, []byte, error) { return c.check(c.dc.NextNoDup()) }
+func (c *faultyDupSortCursor) CountDuplicates() (uint64, error)   { return c.dc.CountDuplicates() }
+
+func (c *faultyDupSortCursor) PutNoDupData(k, v []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	return rw.PutNoDupData(k, v)
+}
+
+func (c *faultyDupSortCursor) DeleteCurrentDuplicates() error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	return rw.DeleteCurrentDuplicates()
+}
+
+func (c *faultyDupSortCursor) AppendDup(k, v []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	return rw.AppendDup(k, v)
+}
@@ -0,0 +1,354 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvnotify
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// NotifyingDB - read transactions are not wrapped
+type NotifyingDB struct {
+	kv.RwDB
+	n *Notifier
+}
+
+var _ kv.RwDB = (*NotifyingDB)(nil)
+
+func New(db kv.RwDB, n *Notifier) *NotifyingDB { return &NotifyingDB{RwDB: db, n: n} }
+
+func (db *NotifyingDB) Notifier() *Notifier { return db.n }
+
+func (db *NotifyingDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyRwTx{RwTx: tx, n: db.n, watched: map[string]bool{}, changes: map[string]*tableChanges{}}, nil
+}
+
+func (db *NotifyingDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type tableChanges struct {
+	keys    [][]byte
+	seen    map[string]struct{}
+	cleared bool
+}
+
+type notifyRwTx struct {
+	kv.RwTx
+	n       *Notifier
+	watched map[string]bool // cache of Notifier.Watched - subscriptions are checked once per tx
+	order   []string        // tables in order of first change
+	changes map[string]*tableChanges
+	hooks   kv.WrapperHooks
+}
+
+var _ kv.RwTx = (*notifyRwTx)(nil)
+var _ kv.Ranger = (*notifyRwTx)(nil)
+var _ kv.TableStatsReader = (*notifyRwTx)(nil)
+var _ kv.ManyGetter = (*notifyRwTx)(nil)
+var _ kv.RangeDeleter = (*notifyRwTx)(nil)
+
+func (tx *notifyRwTx) isWatched(table string) bool {
+	watched, ok := tx.watched[table]
+	if !ok {
+		watched = tx.n.Watched(table)
+		tx.watched[table] = watched
+	}
+	return watched
+}
+
+func (tx *notifyRwTx) table(table string) *tableChanges {
+	if !tx.isWatched(table) {
+		return nil
+	}
+	tc, ok := tx.changes[table]
+	if !ok {
+		tc = &tableChanges{seen: map[string]struct{}{}}
+		tx.changes[table] = tc
+		tx.order = append(tx.order, table)
+	}
+	return tc
+}
+
+func (tx *notifyRwTx) changed(table string, k []byte) {
+	tc := tx.table(table)
+	if tc == nil || tc.cleared {
+		return
+	}
+	if _, ok := tc.seen[string(k)]; ok {
+		return
+	}
+	tc.seen[string(k)] = struct{}{}
+	tc.keys = append(tc.keys, common.Copy(k))
+}
+
+func (tx *notifyRwTx) cleared(table string) {
+	if tc := tx.table(table); tc != nil {
+		tc.cleared, tc.keys, tc.seen = true, nil, nil
+	}
+}
+
+// PreCommit, PostCommit - hooks of underlying tx, see kv.CommitHooks. Changes made by pre-commit hooks
+// through this tx are published too. Post-commit hooks are called before publishing
+// Range - reads are not tracked, see kv.Ranger
+func (tx *notifyRwTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	return kv.Range(tx.RwTx, table, fromPrefix, toPrefix)
+}
+
+func (tx *notifyRwTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	return kv.GetMany(tx.RwTx, table, keys)
+}
+
+func (tx *notifyRwTx) TableStats(table string) (kv.TableStats, error) {
+	return kv.ReadTableStats(tx.RwTx, table)
+}
+
+func (tx *notifyRwTx) PreCommit(f func() error) { tx.hooks.Of(tx.RwTx).PreCommit(f) }
+func (tx *notifyRwTx) PostCommit(f func())      { tx.hooks.Of(tx.RwTx).PostCommit(f) }
+
+func (tx *notifyRwTx) Rollback() {
+	tx.hooks.Reset()
+	tx.RwTx.Rollback()
+}
+
+// Commit - publishes changes only if commit succeeded
+func (tx *notifyRwTx) Commit() error {
+	viewID := tx.RwTx.ViewID()
+	if err := tx.hooks.Commit(tx.RwTx.Commit, tx.RwTx.Rollback); err != nil {
+		return err
+	}
+	if len(tx.order) == 0 {
+		return nil
+	}
+	notification := &Notification{ViewID: viewID, Changes: make([]TableChange, 0, len(tx.order))}
+	for _, table := range tx.order {
+		tc := tx.changes[table]
+		notification.Changes = append(notification.Changes, TableChange{Table: table, Keys: tc.keys, Cleared: tc.cleared})
+	}
+	tx.order, tx.changes = nil, map[string]*tableChanges{}
+	tx.n.Publish(notification)
+	return nil
+}
+
+func (tx *notifyRwTx) Put(table string, k, v []byte) error {
+	if err := tx.RwTx.Put(table, k, v); err != nil {
+		return err
+	}
+	tx.changed(table, k)
+	return nil
+}
+
+func (tx *notifyRwTx) Delete(table string, k, v []byte) error {
+	if err := tx.RwTx.Delete(table, k, v); err != nil {
+		return err
+	}
+	tx.changed(table, k)
+	return nil
+}
+
+func (tx *notifyRwTx) Append(table string, k, v []byte) error {
+	if err := tx.RwTx.Append(table, k, v); err != nil {
+		return err
+	}
+	tx.changed(table, k)
+	return nil
+}
+
+func (tx *notifyRwTx) AppendDup(table string, k, v []byte) error {
+	if err := tx.RwTx.AppendDup(table, k, v); err != nil {
+		return err
+	}
+	tx.changed(table, k)
+	return nil
+}
+
+func (tx *notifyRwTx) ClearBucket(table string) error {
+	if err := tx.RwTx.ClearBucket(table); err != nil {
+		return err
+	}
+	tx.cleared(table)
+	return nil
+}
+
+// DeleteRange - deleted keys of watched table are collected before delete. Whole table - reported as cleared
+func (tx *notifyRwTx) DeleteRange(table string, fromKey, toKey []byte) error {
+	if fromKey == nil && toKey == nil {
+		if err := kv.DeleteRange(tx.RwTx, table, nil, nil); err != nil {
+			return err
+		}
+		tx.cleared(table)
+		return nil
+	}
+	var keys [][]byte
+	if tx.isWatched(table) {
+		it, err := kv.Range(tx.RwTx, table, fromKey, toKey)
+		if err != nil {
+			return err
+		}
+		for it.HasNext() {
+			k, _, err := it.Next()
+			if err != nil {
+				iter.Close(it)
+				return err
+			}
+			if len(keys) == 0 || !bytes.Equal(keys[len(keys)-1], k) { // DupSort: 1 key per all values
+				keys = append(keys, common.Copy(k))
+			}
+		}
+		iter.Close(it)
+	}
+	if err := kv.DeleteRange(tx.RwTx, table, fromKey, toKey); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		tx.changed(table, k)
+	}
+	return nil
+}
+
+func (tx *notifyRwTx) DropBucket(table string) error {
+	if err := tx.RwTx.DropBucket(table); err != nil {
+		return err
+	}
+	tx.cleared(table)
+	return nil
+}
+
+func (tx *notifyRwTx) RwCursor(table string) (kv.RwCursor, error) {
+	c, err := tx.RwTx.RwCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	nc := &notifyCursor{RwCursor: c, tx: tx, table: table}
+	if dc, ok := c.(kv.RwCursorDupSort); ok { // keep DupSort cursor type-assertable to kv.RwCursorDupSort
+		return &notifyDupSortCursor{RwCursorDupSort: dc, c: nc}, nil
+	}
+	return nc, nil
+}
+
+func (tx *notifyRwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	c, err := tx.RwTx.RwCursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyDupSortCursor{RwCursorDupSort: c, c: &notifyCursor{RwCursor: c, tx: tx, table: table}}, nil
+}
+
+type notifyCursor struct {
+	kv.RwCursor
+	tx    *notifyRwTx
+	table string
+}
+
+var _ kv.RwCursor = (*notifyCursor)(nil)
+var _ kv.RwCursorDupSort = (*notifyDupSortCursor)(nil)
+
+func (c *notifyCursor) Put(k, v []byte) error {
+	if err := c.RwCursor.Put(k, v); err != nil {
+		return err
+	}
+	c.tx.changed(c.table, k)
+	return nil
+}
+
+func (c *notifyCursor) Append(k, v []byte) error {
+	if err := c.RwCursor.Append(k, v); err != nil {
+		return err
+	}
+	c.tx.changed(c.table, k)
+	return nil
+}
+
+func (c *notifyCursor) Delete(k, v []byte) error {
+	if err := c.RwCursor.Delete(k, v); err != nil {
+		return err
+	}
+	c.tx.changed(c.table, k)
+	return nil
+}
+
+func (c *notifyCursor) DeleteCurrent() error {
+	k, _, err := c.RwCursor.Current()
+	if err != nil {
+		return err
+	}
+	k = common.Copy(k) // key may be invalid after delete
+	if err := c.RwCursor.DeleteCurrent(); err != nil {
+		return err
+	}
+	if k != nil {
+		c.tx.changed(c.table, k)
+	}
+	return nil
+}
+
+type notifyDupSortCursor struct {
+	kv.RwCursorDupSort
+	c *notifyCursor
+}
+
+func (c *notifyDupSortCursor) Put(k, v []byte) error    { return c.c.Put(k, v) }
+func (c *notifyDupSortCursor) Append(k, v []byte) error { return c.c.Append(k, v) }
+func (c *notifyDupSortCursor) Delete(k, v []byte) error { return c.c.Delete(k, v) }
+func (c *notifyDupSortCursor) DeleteCurrent() error     { return c.c.DeleteCurrent() }
+
+func (c *notifyDupSortCursor) AppendDup(k, v []byte) error {
+	if err := c.RwCursorDupSort.AppendDup(k, v); err != nil {
+		return err
+	}
+	c.c.tx.changed(c.c.table, k)
+	return nil
+}
+
+func (c *notifyDupSortCursor) PutNoDupData(k, v []byte) error {
+	if err := c.RwCursorDupSort.PutNoDupData(k, v); err != nil {
+		return err
+	}
+	c.c.tx.changed(c.c.table, k)
+	return nil
+}
+
+func (c *notifyDupSortCursor) DeleteCurrentDuplicates() error {
+	k, _, err := c.RwCursorDupSort.Current()
+	if err != nil {
+		return err
+	}
+	k = common.Copy(k)
+	if err := c.RwCursorDupSort.DeleteCurrentDuplicates(); err != nil {
+		return err
+	}
+	if k != nil {
+		c.c.tx.changed(c.c.table, k)
+	}
+	return nil
+}
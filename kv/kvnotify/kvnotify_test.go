@@ -0,0 +1,97 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvnotify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyingDB(t *testing.T) {
+	ctx := context.Background()
+	n := NewNotifier()
+	db := New(memdb.NewTestDB(t), n)
+
+	all, unsubscribeAll := n.Subscribe(4, Filter{Table: kv.HeaderNumber})
+	defer unsubscribeAll()
+	prefixed, unsubscribePrefixed := n.Subscribe(4, Filter{Table: kv.HeaderNumber, Prefix: []byte("a")})
+	defer unsubscribePrefixed()
+	require.True(t, n.Watched(kv.HeaderNumber))
+	require.False(t, n.Watched(kv.Headers))
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HeaderNumber, []byte("a1"), []byte("v")); err != nil {
+			return err
+		}
+		if err := tx.Put(kv.HeaderNumber, []byte("b1"), []byte("v")); err != nil {
+			return err
+		}
+		if err := tx.Put(kv.HeaderNumber, []byte("a1"), []byte("v2")); err != nil {
+			return err
+		}
+		return tx.Put(kv.Headers, []byte("a1"), []byte("v")) // not watched
+	}))
+	got := <-all
+	require.Equal(t, 1, len(got.Changes))
+	require.Equal(t, [][]byte{[]byte("a1"), []byte("b1")}, got.Changes[0].Keys)
+	got = <-prefixed
+	require.Equal(t, [][]byte{[]byte("a1")}, got.Changes[0].Keys)
+
+	// rollback: nothing published
+	require.Error(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HeaderNumber, []byte("a2"), []byte("v")); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	}))
+	// change of not-matching prefix: nothing for prefixed subscriber
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		c, err := tx.RwCursor(kv.HeaderNumber)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		if _, _, err := c.SeekExact([]byte("b1")); err != nil {
+			return err
+		}
+		return c.DeleteCurrent()
+	}))
+	got = <-all
+	require.Equal(t, [][]byte{[]byte("b1")}, got.Changes[0].Keys)
+	require.Empty(t, prefixed)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.ClearBucket(kv.HeaderNumber) }))
+	got = <-prefixed
+	require.True(t, got.Changes[0].Cleared)
+	require.Empty(t, got.Changes[0].Keys)
+	<-all
+
+	// remote representation
+	require.Equal(t, got, FromRemote(ToRemote(got)))
+
+	unsubscribeAll()
+	unsubscribePrefixed()
+	require.Zero(t, n.Len())
+	require.False(t, n.Watched(kv.HeaderNumber))
+	_, ok := <-all
+	require.False(t, ok)
+}
@@ -0,0 +1,208 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvnotify - subscription to commits changing some tables (or key prefixes of tables).
+// NotifyingDB wraps kv.RwDB: records changed keys of watched tables in write transaction and
+// publishes them after successful commit. Remote subscribers - see remotedbserver.KvServer.WithNotifier.
+package kvnotify
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+)
+
+type Filter struct {
+	Table  string
+	Prefix []byte // empty - all keys
+}
+
+// TableChange - keys changed by 1 commit, in order of first change
+type TableChange struct {
+	Table   string
+	Keys    [][]byte
+	Cleared bool // table was cleared or dropped - Keys are not listed
+}
+
+type Notification struct {
+	ViewID  uint64 // ViewID of write transaction
+	Changes []TableChange
+}
+
+type subscription struct {
+	filters []Filter
+	ch      chan *Notification
+}
+
+// Notifier - pub/sub of commit notifications. Slow subscriber loses old notifications (same as remotedbserver.StateChangePubSub)
+type Notifier struct {
+	lock    sync.RWMutex
+	id      uint
+	subs    map[uint]*subscription
+	watched map[string]int // table -> amount of subscriptions with this table
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{subs: map[uint]*subscription{}, watched: map[string]int{}}
+}
+
+// Subscribe - ch receives only changes matching filters. unsubscribe closes ch
+func (n *Notifier) Subscribe(buffer int, filters ...Filter) (ch <-chan *Notification, unsubscribe func()) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.id++
+	id := n.id
+	sub := &subscription{filters: filters, ch: make(chan *Notification, buffer)}
+	n.subs[id] = sub
+	for _, table := range tablesOf(filters) {
+		n.watched[table]++
+	}
+	return sub.ch, func() { n.unsubscribe(id) }
+}
+
+func (n *Notifier) unsubscribe(id uint) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	sub, ok := n.subs[id]
+	if !ok { // double-unsubscribe support
+		return
+	}
+	for _, table := range tablesOf(sub.filters) {
+		if n.watched[table]--; n.watched[table] <= 0 {
+			delete(n.watched, table)
+		}
+	}
+	close(sub.ch)
+	delete(n.subs, id)
+}
+
+func tablesOf(filters []Filter) []string {
+	seen := map[string]struct{}{}
+	var res []string
+	for _, f := range filters {
+		if _, ok := seen[f.Table]; !ok {
+			seen[f.Table] = struct{}{}
+			res = append(res, f.Table)
+		}
+	}
+	return res
+}
+
+// Watched - true if table has subscribers: changes of other tables are not recorded
+func (n *Notifier) Watched(table string) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.watched[table] > 0
+}
+
+func (n *Notifier) Len() int {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return len(n.subs)
+}
+
+// Publish - sends to each subscriber part of changes matching its filters. Never blocks
+func (n *Notifier) Publish(notification *Notification) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	for _, sub := range n.subs {
+		filtered := filter(notification, sub.filters)
+		if filtered == nil {
+			continue
+		}
+		select {
+		case sub.ch <- filtered:
+		default: //if channel is full (slow consumer), drop old messages
+			for i := 0; i < cap(sub.ch)/2; i++ {
+				select {
+				case <-sub.ch:
+				default:
+				}
+			}
+			select {
+			case sub.ch <- filtered:
+			default: // unbuffered channel without reader
+			}
+		}
+	}
+}
+
+// filter - nil if nothing matches
+func filter(notification *Notification, filters []Filter) *Notification {
+	var res *Notification
+	for _, change := range notification.Changes {
+		var prefixes [][]byte
+		watched, all := false, false
+		for _, f := range filters {
+			if f.Table == change.Table {
+				watched, all = true, all || len(f.Prefix) == 0
+				prefixes = append(prefixes, f.Prefix)
+			}
+		}
+		if !watched {
+			continue
+		}
+		matched := TableChange{Table: change.Table, Cleared: change.Cleared}
+		if all {
+			matched.Keys = change.Keys
+		} else {
+			for _, k := range change.Keys {
+				for _, prefix := range prefixes {
+					if bytes.HasPrefix(k, prefix) {
+						matched.Keys = append(matched.Keys, k)
+						break
+					}
+				}
+			}
+		}
+		if len(matched.Keys) == 0 && !matched.Cleared {
+			continue
+		}
+		if res == nil {
+			res = &Notification{ViewID: notification.ViewID}
+		}
+		res.Changes = append(res.Changes, matched)
+	}
+	return res
+}
+
+// FiltersFromRemote - filters of StateChangeRequest.Tables
+func FiltersFromRemote(req []*remote.TableFilter) []Filter {
+	res := make([]Filter, len(req))
+	for i, f := range req {
+		res[i] = Filter{Table: f.Table, Prefix: f.Prefix}
+	}
+	return res
+}
+
+// ToRemote - notification as message of StateChanges stream
+func ToRemote(notification *Notification) *remote.StateChangeBatch {
+	batch := &remote.StateChangeBatch{DatabaseViewID: notification.ViewID, TableChanges: make([]*remote.TableChange, len(notification.Changes))}
+	for i, c := range notification.Changes {
+		batch.TableChanges[i] = &remote.TableChange{Table: c.Table, Keys: c.Keys, Cleared: c.Cleared}
+	}
+	return batch
+}
+
+// FromRemote - opposite of ToRemote
+func FromRemote(batch *remote.StateChangeBatch) *Notification {
+	notification := &Notification{ViewID: batch.DatabaseViewID, Changes: make([]TableChange, len(batch.TableChanges))}
+	for i, c := range batch.TableChanges {
+		notification.Changes[i] = TableChange{Table: c.Table, Keys: c.Keys, Cleared: c.Cleared}
+	}
+	return notification
+}
@@ -0,0 +1,145 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvrouter - RouterDB presents several databases (for example MDBX environments on different disks)
+// as 1 kv.RwDB: each table lives in 1 of them.
+//
+// There is no 2-phase commit in MDBX - RouterDB gives best-effort ordering only:
+//   - transactions of underlying databases are opened lazily - on first access to their table
+//   - only 1 write transaction of RouterDB at a time: writers open shards in different orders and
+//     would deadlock on write locks of shards. Don't open write transactions of shards directly (by DB)
+//     while write transaction of RouterDB is open in same goroutine
+//   - Commit commits shards in order of New arguments, default db - last. Then progress stored
+//     in default db (for example stages progress) never points to data which was not committed to shards.
+//     If commit of some shard failed - PartialCommitError tells how many shards were committed.
+//   - read transactions see snapshots of different moments in different shards
+package kvrouter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"golang.org/x/sync/semaphore"
+)
+
+// Shard - db and tables which live there
+type Shard struct {
+	DB     kv.RwDB
+	Tables []string
+}
+
+// RouterDB - see package docs
+type RouterDB struct {
+	dbs   []kv.RwDB      // shards in order of New, default db - last
+	route map[string]int // table -> index in dbs, not listed tables - in default db
+
+	rwLock *semaphore.Weighted // 1 write transaction at a time, see package docs
+}
+
+var _ kv.RwDB = (*RouterDB)(nil)
+
+// New - tables not listed in shards live in defaultDB
+func New(defaultDB kv.RwDB, shards ...Shard) (*RouterDB, error) {
+	db := &RouterDB{route: map[string]int{}, rwLock: semaphore.NewWeighted(1)}
+	for i, shard := range shards {
+		for _, table := range shard.Tables {
+			if prev, ok := db.route[table]; ok {
+				return nil, fmt.Errorf("kvrouter: table %s is in shards %d and %d", table, prev, i)
+			}
+			db.route[table] = i
+		}
+		db.dbs = append(db.dbs, shard.DB)
+	}
+	db.dbs = append(db.dbs, defaultDB)
+	return db, nil
+}
+
+func (db *RouterDB) shard(table string) int {
+	if i, ok := db.route[table]; ok {
+		return i
+	}
+	return len(db.dbs) - 1
+}
+
+// DB - underlying db of table
+func (db *RouterDB) DB(table string) kv.RwDB { return db.dbs[db.shard(table)] }
+
+func (db *RouterDB) Close() {
+	for _, d := range db.dbs {
+		d.Close()
+	}
+}
+
+// AllBuckets - tables of each db which are routed to it
+func (db *RouterDB) AllBuckets() kv.TableCfg {
+	res := kv.TableCfg{}
+	for i, d := range db.dbs {
+		for name, cfg := range d.AllBuckets() {
+			if db.shard(name) == i {
+				res[name] = cfg
+			}
+		}
+	}
+	return res
+}
+
+// PageSize - of default db
+func (db *RouterDB) PageSize() uint64 { return db.dbs[len(db.dbs)-1].PageSize() }
+
+func (db *RouterDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	return &routerTx{db: db, ctx: ctx, txs: make([]kv.Tx, len(db.dbs))}, nil
+}
+
+// BeginRw - waits for commit or rollback of current write transaction
+func (db *RouterDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	if err := db.rwLock.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &routerTx{db: db, ctx: ctx, rw: true, rwLocked: true, txs: make([]kv.Tx, len(db.dbs))}, nil
+}
+
+func (db *RouterDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *RouterDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PartialCommitError - Commit failed after `Committed` shards were committed
+type PartialCommitError struct {
+	Committed int
+	Err       error
+}
+
+func (e *PartialCommitError) Error() string {
+	return fmt.Sprintf("kvrouter: commit failed after %d committed shards: %s", e.Committed, e.Err)
+}
+func (e *PartialCommitError) Unwrap() error { return e.Err }
@@ -0,0 +1,188 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestRouterDB(t *testing.T) {
+	ctx := context.Background()
+	chain, pool := memdb.NewTestDB(t), memdb.NewTestPoolDB(t)
+	db, err := New(chain, Shard{DB: pool, Tables: []string{kv.PoolTransaction}})
+	require.NoError(t, err)
+	_, err = New(chain, Shard{DB: pool, Tables: []string{kv.PoolTransaction}}, Shard{DB: pool, Tables: []string{kv.PoolTransaction}})
+	require.Error(t, err)
+
+	require.Equal(t, pool, db.DB(kv.PoolTransaction))
+	require.Equal(t, chain, db.DB(kv.Headers))
+	_, ok := db.AllBuckets()[kv.PoolTransaction]
+	require.True(t, ok)
+	_, ok = db.AllBuckets()[kv.Headers]
+	require.True(t, ok)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.PoolTransaction, []byte("k"), []byte("pool")); err != nil {
+			return err
+		}
+		return tx.Put(kv.Headers, []byte("k"), []byte("chain"))
+	}))
+	// each table is in its db
+	require.NoError(t, pool.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.PoolTransaction, []byte("k"))
+		require.Equal(t, "pool", string(v))
+		return err
+	}))
+	require.NoError(t, chain.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.Headers, []byte("k"))
+		require.Equal(t, "chain", string(v))
+		v, _ = tx.GetOne(kv.PoolTransaction, []byte("k"))
+		require.Nil(t, v)
+		return err
+	}))
+
+	// rollback of all dbs
+	rollback := errors.New("rollback")
+	require.ErrorIs(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.PoolTransaction, []byte("k2"), []byte("pool")); err != nil {
+			return err
+		}
+		if err := tx.Put(kv.Headers, []byte("k2"), []byte("chain")); err != nil {
+			return err
+		}
+		return rollback
+	}), rollback)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for _, table := range []string{kv.PoolTransaction, kv.Headers} {
+			has, err := tx.Has(table, []byte("k2"))
+			require.NoError(t, err)
+			require.False(t, has)
+		}
+		require.Error(t, tx.(kv.RwTx).Put(kv.Headers, []byte("k3"), nil)) // read-only
+		return nil
+	}))
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		tables, err := tx.ListBuckets()
+		require.NoError(t, err)
+		require.Contains(t, tables, kv.PoolTransaction)
+		require.Contains(t, tables, kv.Headers)
+		return nil
+	}))
+}
+
+func TestRouterDBWritersOrder(t *testing.T) {
+	ctx := context.Background()
+	chain, pool := memdb.NewTestDB(t), memdb.NewTestPoolDB(t)
+	db, err := New(chain, Shard{DB: pool, Tables: []string{kv.PoolTransaction}})
+	require.NoError(t, err)
+
+	// writers touch shards in different orders
+	write := func(tables ...string) func() error {
+		return func() error {
+			for i := 0; i < 100; i++ {
+				if err := db.Update(ctx, func(tx kv.RwTx) error {
+					for _, table := range tables {
+						if err := tx.Put(table, []byte(fmt.Sprintf("%d", i)), []byte(table)); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	var g errgroup.Group
+	g.Go(write(kv.PoolTransaction, kv.Headers))
+	g.Go(write(kv.Headers, kv.PoolTransaction))
+	require.NoError(t, g.Wait())
+
+	// waiting writer respects ctx
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = db.BeginRw(cancelled)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRouterDBConcurrentBeginRw(t *testing.T) {
+	ctx := context.Background()
+	chain, pool := memdb.NewTestDB(t), memdb.NewTestPoolDB(t)
+	db, err := New(chain, Shard{DB: pool, Tables: []string{kv.PoolTransaction}})
+	require.NoError(t, err)
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.Put(kv.PoolTransaction, []byte("k"), []byte("pool")))
+
+	// second writer touches shards in other order, waits for commit of first one
+	began := make(chan struct{})
+	var g errgroup.Group
+	g.Go(func() error {
+		tx2, err := db.BeginRw(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx2.Rollback()
+		close(began)
+		for _, table := range []string{kv.Headers, kv.PoolTransaction} {
+			v, err := tx2.GetOne(table, []byte("k"))
+			if err != nil {
+				return err
+			}
+			if string(v) == "" {
+				return fmt.Errorf("writes of first transaction are not visible in %s", table)
+			}
+			if err = tx2.Put(table, []byte("k2"), v); err != nil {
+				return err
+			}
+		}
+		return tx2.Commit()
+	})
+	select {
+	case <-began:
+		t.Fatal("second write transaction began before commit of first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, tx.Put(kv.Headers, []byte("k"), []byte("chain")))
+	require.NoError(t, tx.Commit())
+	require.NoError(t, g.Wait())
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for table, expect := range map[string]string{kv.PoolTransaction: "pool", kv.Headers: "chain"} {
+			v, err := tx.GetOne(table, []byte("k2"))
+			require.NoError(t, err)
+			require.Equal(t, expect, string(v))
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,392 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvrouter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// routerTx - transactions of underlying dbs are opened on first access to their tables
+type routerTx struct {
+	db  *RouterDB
+	ctx context.Context
+	rw  bool
+	txs []kv.Tx // by index of db, nil - not opened yet
+
+	rwLocked bool // holds RouterDB.rwLock
+
+	hooks kv.TxHooks
+}
+
+var _ kv.RwTx = (*routerTx)(nil)
+var _ kv.Ranger = (*routerTx)(nil)
+var _ kv.TableStatsReader = (*routerTx)(nil)
+var _ kv.ManyGetter = (*routerTx)(nil)
+var _ kv.RangeDeleter = (*routerTx)(nil)
+var _ kv.CommitHooks = (*routerTx)(nil)
+
+// PreCommit - hooks are called before commit of first shard
+func (tx *routerTx) PreCommit(f func() error) { tx.hooks.PreCommit(f) }
+
+// PostCommit - hooks are called after commit of all shards, not called on PartialCommitError
+func (tx *routerTx) PostCommit(f func()) { tx.hooks.PostCommit(f) }
+
+func (tx *routerTx) begin(i int) (kv.Tx, error) {
+	if tx.txs[i] != nil {
+		return tx.txs[i], nil
+	}
+	var t kv.Tx
+	var err error
+	if tx.rw {
+		t, err = tx.db.dbs[i].BeginRw(tx.ctx)
+	} else {
+		t, err = tx.db.dbs[i].BeginRo(tx.ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tx.txs[i] = t
+	return t, nil
+}
+
+// unlock - releases RouterDB.rwLock, once
+func (tx *routerTx) unlock() {
+	if tx.rwLocked {
+		tx.rwLocked = false
+		tx.db.rwLock.Release(1)
+	}
+}
+
+func (tx *routerTx) tx(table string) (kv.Tx, error) { return tx.begin(tx.db.shard(table)) }
+
+func (tx *routerTx) rwTx(table string) (kv.RwTx, error) {
+	if !tx.rw {
+		return nil, fmt.Errorf("kvrouter: table %s: read-only transaction", table)
+	}
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.(kv.RwTx), nil
+}
+
+// all - opens transactions of all dbs
+func (tx *routerTx) all() ([]kv.Tx, error) {
+	for i := range tx.txs {
+		if _, err := tx.begin(i); err != nil {
+			return nil, err
+		}
+	}
+	return tx.txs, nil
+}
+
+// Commit - in order of shards, default db - last. See package docs
+func (tx *routerTx) Commit() error {
+	if err := tx.hooks.RunPreCommit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	committed := 0
+	for i, t := range tx.txs {
+		if t == nil {
+			continue
+		}
+		tx.txs[i] = nil
+		if err := t.Commit(); err != nil {
+			tx.Rollback()
+			if committed > 0 {
+				return &PartialCommitError{Committed: committed, Err: err}
+			}
+			return err
+		}
+		committed++
+	}
+	tx.unlock()
+	tx.hooks.RunPostCommit()
+	return nil
+}
+
+func (tx *routerTx) Rollback() {
+	tx.hooks.Reset()
+	for i, t := range tx.txs {
+		if t != nil {
+			t.Rollback()
+			tx.txs[i] = nil
+		}
+	}
+	tx.unlock()
+}
+
+// ViewID - of default db
+func (tx *routerTx) ViewID() uint64 {
+	t, err := tx.begin(len(tx.txs) - 1)
+	if err != nil {
+		return 0
+	}
+	return t.ViewID()
+}
+
+func (tx *routerTx) Has(table string, key []byte) (bool, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return false, err
+	}
+	return t.Has(table, key)
+}
+
+func (tx *routerTx) GetOne(table string, key []byte) ([]byte, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.GetOne(table, key)
+}
+
+func (tx *routerTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return kv.GetMany(t, table, keys)
+}
+
+func (tx *routerTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return kv.Range(t, table, fromPrefix, toPrefix)
+}
+
+func (tx *routerTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	t, err := tx.tx(table)
+	if err != nil {
+		return err
+	}
+	return t.ForEach(table, fromPrefix, walker)
+}
+
+func (tx *routerTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	t, err := tx.tx(table)
+	if err != nil {
+		return err
+	}
+	return t.ForPrefix(table, prefix, walker)
+}
+
+func (tx *routerTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	t, err := tx.tx(table)
+	if err != nil {
+		return err
+	}
+	return t.ForAmount(table, prefix, amount, walker)
+}
+
+func (tx *routerTx) ReadSequence(table string) (uint64, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return 0, err
+	}
+	return t.ReadSequence(table)
+}
+
+func (tx *routerTx) BucketSize(table string) (uint64, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return 0, err
+	}
+	return t.BucketSize(table)
+}
+
+func (tx *routerTx) TableStats(table string) (kv.TableStats, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return kv.TableStats{}, err
+	}
+	return kv.ReadTableStats(t, table)
+}
+
+// DBSize - sum of sizes of all dbs
+func (tx *routerTx) DBSize() (uint64, error) {
+	txs, err := tx.all()
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, t := range txs {
+		sz, err := t.DBSize()
+		if err != nil {
+			return 0, err
+		}
+		total += sz
+	}
+	return total, nil
+}
+
+func (tx *routerTx) Cursor(table string) (kv.Cursor, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.Cursor(table)
+}
+
+func (tx *routerTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	t, err := tx.tx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.CursorDupSort(table)
+}
+
+func (tx *routerTx) Put(table string, k, v []byte) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.Put(table, k, v)
+}
+
+func (tx *routerTx) Delete(table string, k, v []byte) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.Delete(table, k, v)
+}
+
+func (tx *routerTx) Append(table string, k, v []byte) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.Append(table, k, v)
+}
+
+func (tx *routerTx) AppendDup(table string, k, v []byte) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.AppendDup(table, k, v)
+}
+
+func (tx *routerTx) IncrementSequence(table string, amount uint64) (uint64, error) {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return 0, err
+	}
+	return t.IncrementSequence(table, amount)
+}
+
+func (tx *routerTx) RwCursor(table string) (kv.RwCursor, error) {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.RwCursor(table)
+}
+
+func (tx *routerTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return nil, err
+	}
+	return t.RwCursorDupSort(table)
+}
+
+func (tx *routerTx) CreateBucket(table string) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.CreateBucket(table)
+}
+
+func (tx *routerTx) DropBucket(table string) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.DropBucket(table)
+}
+
+func (tx *routerTx) ClearBucket(table string) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return t.ClearBucket(table)
+}
+
+func (tx *routerTx) DeleteRange(table string, fromKey, toKey []byte) error {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return err
+	}
+	return kv.DeleteRange(t, table, fromKey, toKey)
+}
+
+func (tx *routerTx) ExistsBucket(table string) (bool, error) {
+	t, err := tx.rwTx(table)
+	if err != nil {
+		return false, err
+	}
+	return t.ExistsBucket(table)
+}
+
+// ListBuckets - tables of each db which are routed to it, sorted
+func (tx *routerTx) ListBuckets() ([]string, error) {
+	if !tx.rw {
+		return nil, fmt.Errorf("kvrouter: ListBuckets: read-only transaction")
+	}
+	txs, err := tx.all()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for i, t := range txs {
+		tables, err := t.(kv.RwTx).ListBuckets()
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			if tx.db.shard(table) == i {
+				res = append(res, table)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// CollectMetrics - of opened transactions only
+func (tx *routerTx) CollectMetrics() {
+	if !tx.rw {
+		return
+	}
+	for _, t := range tx.txs {
+		if t != nil {
+			t.(kv.RwTx).CollectMetrics()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvtrace - kv.RwDB decorator which records operations (table, key/value sizes, latency) for debugging:
+// to find hot paths or to reproduce corruption scenario (with WithData - keys and values are recorded too).
+// Recording can be enabled/disabled at runtime - disabled decorator costs 1 atomic load per operation.
+package kvtrace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"go.uber.org/atomic"
+)
+
+// Record - one operation
+type Record struct {
+	Time    time.Time
+	TxID    uint64 // sequence number of transaction in TracedDB (not ViewID)
+	Op      string // name of method: GetOne, Put, Cursor.Seek, ...
+	Table   string
+	KeyLen  int
+	ValLen  int
+	Latency time.Duration
+	Err     error
+
+	Key, Val []byte // only if TracedDB.WithData(true)
+}
+
+func (r Record) String() string {
+	s := fmt.Sprintf("%s tx=%d %s %s k=%d v=%d %s", r.Time.Format("15:04:05.000000"), r.TxID, r.Op, r.Table, r.KeyLen, r.ValLen, r.Latency)
+	if r.Key != nil || r.Val != nil {
+		s += fmt.Sprintf(" key=%x val=%x", r.Key, r.Val)
+	}
+	if r.Err != nil {
+		s += fmt.Sprintf(" err=%s", r.Err)
+	}
+	return s
+}
+
+// Recorder - destination of records. Must be thread-safe
+type Recorder interface {
+	Record(r Record)
+}
+
+// RingBuffer - keeps last N records in memory
+type RingBuffer struct {
+	lock    sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+func NewRingBuffer(size int) *RingBuffer { return &RingBuffer{records: make([]Record, size)} }
+
+func (b *RingBuffer) Record(r Record) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.records) == 0 {
+		return
+	}
+	b.records[b.next] = r
+	b.next++
+	if b.next == len(b.records) {
+		b.next, b.full = 0, true
+	}
+}
+
+// Records - copy of recorded records, oldest first
+func (b *RingBuffer) Records() []Record {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.full {
+		return append([]Record{}, b.records[:b.next]...)
+	}
+	return append(append([]Record{}, b.records[b.next:]...), b.records[:b.next]...)
+}
+
+func (b *RingBuffer) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.next, b.full = 0, false
+}
+
+// WriterRecorder - writes records to w (file) line by line. Write errors are ignored
+type WriterRecorder struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewWriterRecorder(w io.Writer) *WriterRecorder { return &WriterRecorder{w: w} }
+
+func (w *WriterRecorder) Record(r Record) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, _ = fmt.Fprintln(w.w, r.String())
+}
+
+// TracedDB - see package docs. Disabled after creation
+type TracedDB struct {
+	kv.RwDB
+	enabled  atomic.Bool
+	withData atomic.Bool
+	lock     sync.RWMutex
+	recorder Recorder
+	txID     atomic.Uint64
+}
+
+var _ kv.RwDB = (*TracedDB)(nil)
+
+func New(db kv.RwDB, recorder Recorder) *TracedDB {
+	return &TracedDB{RwDB: db, recorder: recorder}
+}
+
+func (db *TracedDB) Enable()              { db.enabled.Store(true) }
+func (db *TracedDB) Disable()             { db.enabled.Store(false) }
+func (db *TracedDB) Enabled() bool        { return db.enabled.Load() }
+func (db *TracedDB) WithData(enable bool) { db.withData.Store(enable) }
+
+func (db *TracedDB) SetRecorder(r Recorder) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.recorder = r
+}
+
+// start - returns zero time if tracing is disabled
+func (db *TracedDB) start() time.Time {
+	if !db.enabled.Load() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (db *TracedDB) record(start time.Time, txID uint64, op, table string, k, v []byte, err error) {
+	if start.IsZero() {
+		return
+	}
+	r := Record{Op: op, Table: table, KeyLen: len(k), ValLen: len(v)}
+	if db.withData.Load() {
+		r.Key, r.Val = common.Copy(k), common.Copy(v)
+	}
+	db.emit(start, txID, r, err)
+}
+
+func (db *TracedDB) emit(start time.Time, txID uint64, r Record, err error) {
+	r.Time, r.TxID, r.Latency, r.Err = start, txID, time.Since(start), err
+	db.lock.RLock()
+	recorder := db.recorder
+	db.lock.RUnlock()
+	if recorder != nil {
+		recorder.Record(r)
+	}
+}
+
+func (db *TracedDB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	start := db.start()
+	tx, err := db.RwDB.BeginRo(ctx)
+	id := db.txID.Inc()
+	db.record(start, id, "BeginRo", "", nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, db: db, id: id}, nil
+}
+
+func (db *TracedDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	start := db.start()
+	tx, err := db.RwDB.BeginRw(ctx)
+	id := db.txID.Inc()
+	db.record(start, id, "BeginRw", "", nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedRwTx{tracedTx: &tracedTx{Tx: tx, db: db, id: id}, rw: tx}, nil
+}
+
+func (db *TracedDB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *TracedDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvtrace
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func ops(records []Record) []string {
+	res := make([]string, len(records))
+	for i, r := range records {
+		res[i] = r.Op
+	}
+	return res
+}
+
+func TestTracedDB(t *testing.T) {
+	ctx := context.Background()
+	ring := NewRingBuffer(4)
+	db := New(memdb.NewTestDB(t), ring)
+
+	// disabled: nothing recorded
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte("k1"), []byte("v1"))
+	}))
+	require.Empty(t, ring.Records())
+
+	db.Enable()
+	db.WithData(true)
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HeaderNumber, []byte("k2"), []byte("value2")); err != nil {
+			return err
+		}
+		_, err := tx.GetOne(kv.HeaderNumber, []byte("k1"))
+		return err
+	}))
+	records := ring.Records()
+	require.Equal(t, []string{"BeginRw", "Put", "GetOne", "Commit"}, ops(records))
+	require.Equal(t, kv.HeaderNumber, records[1].Table)
+	require.Equal(t, 2, records[1].KeyLen)
+	require.Equal(t, 6, records[1].ValLen)
+	require.Equal(t, "value2", string(records[1].Val))
+	require.Equal(t, "v1", string(records[2].Val))
+	require.Equal(t, records[0].TxID, records[3].TxID)
+
+	// ring buffer keeps only last records
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c, err := tx.Cursor(kv.HeaderNumber)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.Equal(t, []string{"Cursor.First", "Cursor.Next", "Cursor.Next", "Rollback"}, ops(ring.Records()))
+
+	var buf bytes.Buffer
+	db.SetRecorder(NewWriterRecorder(&buf))
+	db.WithData(false)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.Has(kv.HeaderNumber, []byte("k1"))
+		return err
+	}))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 3, len(lines))
+	require.Contains(t, lines[1], "Has "+kv.HeaderNumber+" k=2 v=0")
+
+	db.Disable()
+	buf.Reset()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error { return nil }))
+	require.Zero(t, buf.Len())
+}
@@ -0,0 +1,500 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvtrace
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// tracedTx - methods without table (ViewID, DBSize, ...) are not traced
+type tracedTx struct {
+	kv.Tx
+	db   *TracedDB
+	id   uint64
+	done bool
+}
+
+var _ kv.Tx = (*tracedTx)(nil)
+var _ kv.RwTx = (*tracedRwTx)(nil)
+var _ kv.Ranger = (*tracedTx)(nil)
+var _ kv.TableStatsReader = (*tracedTx)(nil)
+var _ kv.ManyGetter = (*tracedTx)(nil)
+var _ kv.RangeDeleter = (*tracedRwTx)(nil)
+
+func (tx *tracedTx) record(start time.Time, op, table string, k, v []byte, err error) {
+	tx.db.record(start, tx.id, op, table, k, v, err)
+}
+
+func (tx *tracedTx) Commit() error {
+	start := tx.db.start()
+	err := tx.Tx.Commit()
+	if !tx.done {
+		tx.done = true
+		tx.record(start, "Commit", "", nil, nil, err)
+	}
+	return err
+}
+
+func (tx *tracedTx) Rollback() {
+	start := tx.db.start()
+	tx.Tx.Rollback()
+	if !tx.done {
+		tx.done = true
+		tx.record(start, "Rollback", "", nil, nil, nil)
+	}
+}
+
+func (tx *tracedTx) Has(table string, key []byte) (bool, error) {
+	start := tx.db.start()
+	has, err := tx.Tx.Has(table, key)
+	tx.record(start, "Has", table, key, nil, err)
+	return has, err
+}
+
+func (tx *tracedTx) GetOne(table string, key []byte) ([]byte, error) {
+	start := tx.db.start()
+	v, err := tx.Tx.GetOne(table, key)
+	tx.record(start, "GetOne", table, key, v, err)
+	return v, err
+}
+
+// GetMany - recorded as 1 operation: KeyLen and ValLen are sums
+func (tx *tracedTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	start := tx.db.start()
+	vals, err := kv.GetMany(tx.Tx, table, keys)
+	if !start.IsZero() {
+		var kLen, vLen int
+		for i := range keys {
+			kLen += len(keys[i])
+		}
+		for i := range vals {
+			vLen += len(vals[i])
+		}
+		r := Record{Op: "GetMany", Table: table, KeyLen: kLen, ValLen: vLen}
+		tx.db.emit(start, tx.id, r, err)
+	}
+	return vals, err
+}
+
+func (tx *tracedTx) ReadSequence(table string) (uint64, error) {
+	start := tx.db.start()
+	v, err := tx.Tx.ReadSequence(table)
+	tx.record(start, "ReadSequence", table, nil, nil, err)
+	return v, err
+}
+
+func (tx *tracedTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.walk("ForEach", table, fromPrefix, func(w func(k, v []byte) error) error {
+		return tx.Tx.ForEach(table, fromPrefix, w)
+	}, walker)
+}
+
+func (tx *tracedTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.walk("ForPrefix", table, prefix, func(w func(k, v []byte) error) error {
+		return tx.Tx.ForPrefix(table, prefix, w)
+	}, walker)
+}
+
+func (tx *tracedTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.walk("ForAmount", table, prefix, func(w func(k, v []byte) error) error {
+		return tx.Tx.ForAmount(table, prefix, amount, w)
+	}, walker)
+}
+
+// walk - iteration is recorded as 1 operation: KeyLen and ValLen are sums (time of walker is included in Latency)
+func (tx *tracedTx) walk(op, table string, prefix []byte, iterate func(func(k, v []byte) error) error, walker func(k, v []byte) error) error {
+	start := tx.db.start()
+	if start.IsZero() {
+		return iterate(walker)
+	}
+	r := Record{Op: op, Table: table}
+	err := iterate(func(k, v []byte) error {
+		r.KeyLen += len(k)
+		r.ValLen += len(v)
+		return walker(k, v)
+	})
+	if tx.db.withData.Load() {
+		r.Key = append([]byte{}, prefix...)
+	}
+	tx.db.emit(start, tx.id, r, err)
+	return err
+}
+
+// Range - only opening of stream is recorded, Key is fromPrefix
+func (tx *tracedTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	start := tx.db.start()
+	s, err := kv.Range(tx.Tx, table, fromPrefix, toPrefix)
+	tx.record(start, "Range", table, fromPrefix, nil, err)
+	return s, err
+}
+
+// TableStats - not recorded
+func (tx *tracedTx) TableStats(table string) (kv.TableStats, error) {
+	return kv.ReadTableStats(tx.Tx, table)
+}
+
+func (tx *tracedTx) Cursor(table string) (kv.Cursor, error) {
+	start := tx.db.start()
+	c, err := tx.Tx.Cursor(table)
+	tx.record(start, "Cursor", table, nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return tx.wrapCursor(table, c), nil
+}
+
+func (tx *tracedTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	start := tx.db.start()
+	c, err := tx.Tx.CursorDupSort(table)
+	tx.record(start, "CursorDupSort", table, nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedDupSortCursor{tracedCursor: &tracedCursor{c: c, tx: tx, table: table}, dc: c}, nil
+}
+
+// wrapCursor - keeps DupSort cursor type-assertable to kv.CursorDupSort
+func (tx *tracedTx) wrapCursor(table string, c kv.Cursor) kv.RwCursor {
+	tc := &tracedCursor{c: c, tx: tx, table: table}
+	if dc, ok := c.(kv.CursorDupSort); ok {
+		return &tracedDupSortCursor{tracedCursor: tc, dc: dc}
+	}
+	return tc
+}
+
+type tracedRwTx struct {
+	*tracedTx
+	rw    kv.RwTx
+	hooks kv.WrapperHooks
+}
+
+// PreCommit, PostCommit - hooks of underlying tx, see kv.CommitHooks
+func (tx *tracedRwTx) PreCommit(f func() error) { tx.hooks.Of(tx.rw).PreCommit(f) }
+func (tx *tracedRwTx) PostCommit(f func())      { tx.hooks.Of(tx.rw).PostCommit(f) }
+
+func (tx *tracedRwTx) Commit() error {
+	return tx.hooks.Commit(tx.tracedTx.Commit, tx.tracedTx.Rollback)
+}
+
+func (tx *tracedRwTx) Rollback() {
+	tx.hooks.Reset()
+	tx.tracedTx.Rollback()
+}
+
+func (tx *tracedRwTx) Put(table string, k, v []byte) error {
+	start := tx.db.start()
+	err := tx.rw.Put(table, k, v)
+	tx.record(start, "Put", table, k, v, err)
+	return err
+}
+
+func (tx *tracedRwTx) Delete(table string, k, v []byte) error {
+	start := tx.db.start()
+	err := tx.rw.Delete(table, k, v)
+	tx.record(start, "Delete", table, k, v, err)
+	return err
+}
+
+func (tx *tracedRwTx) Append(table string, k, v []byte) error {
+	start := tx.db.start()
+	err := tx.rw.Append(table, k, v)
+	tx.record(start, "Append", table, k, v, err)
+	return err
+}
+
+func (tx *tracedRwTx) AppendDup(table string, k, v []byte) error {
+	start := tx.db.start()
+	err := tx.rw.AppendDup(table, k, v)
+	tx.record(start, "AppendDup", table, k, v, err)
+	return err
+}
+
+func (tx *tracedRwTx) IncrementSequence(table string, amount uint64) (uint64, error) {
+	start := tx.db.start()
+	v, err := tx.rw.IncrementSequence(table, amount)
+	tx.record(start, "IncrementSequence", table, nil, nil, err)
+	return v, err
+}
+
+func (tx *tracedRwTx) DropBucket(table string) error {
+	start := tx.db.start()
+	err := tx.rw.DropBucket(table)
+	tx.record(start, "DropBucket", table, nil, nil, err)
+	return err
+}
+
+func (tx *tracedRwTx) CreateBucket(table string) error {
+	start := tx.db.start()
+	err := tx.rw.CreateBucket(table)
+	tx.record(start, "CreateBucket", table, nil, nil, err)
+	return err
+}
+
+func (tx *tracedRwTx) ClearBucket(table string) error {
+	start := tx.db.start()
+	err := tx.rw.ClearBucket(table)
+	tx.record(start, "ClearBucket", table, nil, nil, err)
+	return err
+}
+
+// DeleteRange - Key is fromKey, Val is toKey
+func (tx *tracedRwTx) DeleteRange(table string, fromKey, toKey []byte) error {
+	start := tx.db.start()
+	err := kv.DeleteRange(tx.rw, table, fromKey, toKey)
+	tx.record(start, "DeleteRange", table, fromKey, toKey, err)
+	return err
+}
+
+func (tx *tracedRwTx) ExistsBucket(table string) (bool, error) { return tx.rw.ExistsBucket(table) }
+func (tx *tracedRwTx) ListBuckets() ([]string, error)          { return tx.rw.ListBuckets() }
+func (tx *tracedRwTx) CollectMetrics()                         { tx.rw.CollectMetrics() }
+
+func (tx *tracedRwTx) RwCursor(table string) (kv.RwCursor, error) {
+	start := tx.db.start()
+	c, err := tx.rw.RwCursor(table)
+	tx.record(start, "RwCursor", table, nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return tx.wrapCursor(table, c), nil
+}
+
+func (tx *tracedRwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	start := tx.db.start()
+	c, err := tx.rw.RwCursorDupSort(table)
+	tx.record(start, "RwCursorDupSort", table, nil, nil, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedDupSortCursor{tracedCursor: &tracedCursor{c: c, tx: tx.tracedTx, table: table}, dc: c}, nil
+}
+
+// tracedCursor - wraps any kind of cursor: write methods fail if underlying cursor is read-only
+type tracedCursor struct {
+	c     kv.Cursor
+	tx    *tracedTx
+	table string
+}
+
+var _ kv.RwCursor = (*tracedCursor)(nil)
+var _ kv.RwCursorDupSort = (*tracedDupSortCursor)(nil)
+
+func (c *tracedCursor) trace(op string, start time.Time, k, v []byte, err error) ([]byte, []byte, error) {
+	c.tx.record(start, op, c.table, k, v, err)
+	return k, v, err
+}
+
+func (c *tracedCursor) rw() (kv.RwCursor, error) {
+	rw, ok := c.c.(kv.RwCursor)
+	if !ok {
+		return nil, fmt.Errorf("kvtrace: table %s: cursor is read-only", c.table)
+	}
+	return rw, nil
+}
+
+func (c *tracedCursor) First() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.First()
+	return c.trace("Cursor.First", start, k, v, err)
+}
+
+func (c *tracedCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.Seek(seek)
+	return c.trace("Cursor.Seek", start, k, v, err)
+}
+
+func (c *tracedCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.SeekExact(key)
+	c.tx.record(start, "Cursor.SeekExact", c.table, key, v, err)
+	return k, v, err
+}
+
+func (c *tracedCursor) Next() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.Next()
+	return c.trace("Cursor.Next", start, k, v, err)
+}
+
+func (c *tracedCursor) Prev() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.Prev()
+	return c.trace("Cursor.Prev", start, k, v, err)
+}
+
+func (c *tracedCursor) Last() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.Last()
+	return c.trace("Cursor.Last", start, k, v, err)
+}
+
+func (c *tracedCursor) Current() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.c.Current()
+	return c.trace("Cursor.Current", start, k, v, err)
+}
+
+func (c *tracedCursor) Count() (uint64, error) {
+	start := c.tx.db.start()
+	cnt, err := c.c.Count()
+	c.tx.record(start, "Cursor.Count", c.table, nil, nil, err)
+	return cnt, err
+}
+
+func (c *tracedCursor) Close() { c.c.Close() }
+
+func (c *tracedCursor) Put(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.Put(k, v)
+	_, _, err = c.trace("Cursor.Put", start, k, v, err)
+	return err
+}
+
+func (c *tracedCursor) Append(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.Append(k, v)
+	_, _, err = c.trace("Cursor.Append", start, k, v, err)
+	return err
+}
+
+func (c *tracedCursor) Delete(k, v []byte) error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.Delete(k, v)
+	_, _, err = c.trace("Cursor.Delete", start, k, v, err)
+	return err
+}
+
+func (c *tracedCursor) DeleteCurrent() error {
+	rw, err := c.rw()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.DeleteCurrent()
+	_, _, err = c.trace("Cursor.DeleteCurrent", start, nil, nil, err)
+	return err
+}
+
+type tracedDupSortCursor struct {
+	*tracedCursor
+	dc kv.CursorDupSort
+}
+
+func (c *tracedDupSortCursor) rwDup() (kv.RwCursorDupSort, error) {
+	rw, ok := c.dc.(kv.RwCursorDupSort)
+	if !ok {
+		return nil, fmt.Errorf("kvtrace: table %s: cursor is read-only", c.table)
+	}
+	return rw, nil
+}
+
+func (c *tracedDupSortCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.dc.SeekBothExact(key, value)
+	c.tx.record(start, "Cursor.SeekBothExact", c.table, key, value, err)
+	return k, v, err
+}
+
+func (c *tracedDupSortCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	start := c.tx.db.start()
+	v, err := c.dc.SeekBothRange(key, value)
+	c.tx.record(start, "Cursor.SeekBothRange", c.table, key, v, err)
+	return v, err
+}
+
+func (c *tracedDupSortCursor) FirstDup() ([]byte, error) {
+	start := c.tx.db.start()
+	v, err := c.dc.FirstDup()
+	c.tx.record(start, "Cursor.FirstDup", c.table, nil, v, err)
+	return v, err
+}
+
+func (c *tracedDupSortCursor) NextDup() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.dc.NextDup()
+	return c.trace("Cursor.NextDup", start, k, v, err)
+}
+
+func (c *tracedDupSortCursor) NextNoDup() ([]byte, []byte, error) {
+	start := c.tx.db.start()
+	k, v, err := c.dc.NextNoDup()
+	return c.trace("Cursor.NextNoDup", start, k, v, err)
+}
+
+func (c *tracedDupSortCursor) LastDup() ([]byte, error) {
+	start := c.tx.db.start()
+	v, err := c.dc.LastDup()
+	c.tx.record(start, "Cursor.LastDup", c.table, nil, v, err)
+	return v, err
+}
+
+func (c *tracedDupSortCursor) CountDuplicates() (uint64, error) {
+	start := c.tx.db.start()
+	cnt, err := c.dc.CountDuplicates()
+	c.tx.record(start, "Cursor.CountDuplicates", c.table, nil, nil, err)
+	return cnt, err
+}
+
+func (c *tracedDupSortCursor) PutNoDupData(k, v []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.PutNoDupData(k, v)
+	_, _, err = c.trace("Cursor.PutNoDupData", start, k, v, err)
+	return err
+}
+
+func (c *tracedDupSortCursor) DeleteCurrentDuplicates() error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.DeleteCurrentDuplicates()
+	_, _, err = c.trace("Cursor.DeleteCurrentDuplicates", start, nil, nil, err)
+	return err
+}
+
+func (c *tracedDupSortCursor) AppendDup(k, v []byte) error {
+	rw, err := c.rwDup()
+	if err != nil {
+		return err
+	}
+	start := c.tx.db.start()
+	err = rw.AppendDup(k, v)
+	_, _, err = c.trace("Cursor.AppendDup", start, k, v, err)
+	return err
+}
@@ -0,0 +1,212 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+var _ kv.Copier = (*MdbxKV)(nil)
+
+const (
+	copyCommitEvery   = 256 * datasize.MB // size of keys+values in 1 write transaction of destination
+	copyProgressEvery = 100_000           // pairs
+	copyThrottleEvery = 1 * datasize.MB
+)
+
+// CopyTo - hot backup: copies snapshot of read transaction to new db at `path` (directory must not exist or be empty).
+// Writers are not blocked, but old read transaction pins pages - db may grow while copy is in progress.
+//
+// Only compacting copy is supported: mdbx-go doesn't bind mdbx_env_copy, so pairs are re-inserted in sorted order
+// (by MDBX_APPEND) into new db. Result has no free pages and may be smaller than original.
+func (db *MdbxKV) CopyTo(ctx context.Context, path string, compacting bool, opts kv.CopyOpts) (err error) {
+	if !compacting {
+		return fmt.Errorf("%w: non-compacting copy of mdbx", kv.ErrNotSupported)
+	}
+	if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+		return fmt.Errorf("copy destination is not empty: %s", path)
+	}
+	srcTx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcTx.Rollback()
+	src := srcTx.(*MdbxTx)
+
+	// tables which exist in snapshot, with flags they have on disk
+	cfg := kv.TableCfg{}
+	var tables []string
+	var total uint64
+	for name, item := range db.buckets {
+		if item.IsDeprecated || item.DBI == NonExistingDBI {
+			continue
+		}
+		st, err := src.TableStats(name)
+		if err != nil {
+			return err
+		}
+		cfg[name] = item
+		tables = append(tables, name)
+		total += st.Entries
+	}
+	sort.Strings(tables)
+
+	dst, err := NewMDBX(db.log).Path(path).PageSize(db.opts.pageSize).MapSize(db.opts.mapSize).GrowthStep(db.opts.growthStep).
+		WithTablessCfg(func(kv.TableCfg) kv.TableCfg { return cfg }).Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dst.Close()
+		if err != nil {
+			_ = os.Remove(filepath.Join(path, "mdbx.dat"))
+			_ = os.Remove(filepath.Join(path, "mdbx.lck"))
+		}
+	}()
+	c := &dbCopy{src: src, dst: dst.(*MdbxKV), opts: opts, total: total, started: time.Now()}
+	defer c.rollback()
+	for _, name := range tables {
+		if err = c.copyTable(ctx, name); err != nil {
+			return fmt.Errorf("copy table %s: %w", name, err)
+		}
+	}
+	if err = c.commit(); err != nil {
+		return err
+	}
+	if opts.Progress != nil {
+		opts.Progress(c.copied, total)
+	}
+	db.log.Info("[db] copy done", "to", path, "pairs", c.copied, "took", time.Since(c.started))
+	return nil
+}
+
+type dbCopy struct {
+	src     *MdbxTx
+	dst     *MdbxKV
+	dstTx   *MdbxTx
+	opts    kv.CopyOpts
+	started time.Time
+
+	copied, total  uint64
+	bytes, txBytes uint64
+	throttledBytes uint64
+}
+
+func (c *dbCopy) begin() error {
+	if c.dstTx != nil {
+		return nil
+	}
+	tx, err := c.dst.BeginRw(context.Background())
+	if err != nil {
+		return err
+	}
+	c.dstTx = tx.(*MdbxTx)
+	return nil
+}
+
+func (c *dbCopy) commit() error {
+	if c.dstTx == nil {
+		return nil
+	}
+	err := c.dstTx.Commit()
+	c.dstTx, c.txBytes = nil, 0
+	return err
+}
+
+func (c *dbCopy) rollback() {
+	if c.dstTx != nil {
+		c.dstTx.Rollback()
+		c.dstTx = nil
+	}
+}
+
+// throttle - sleeps if copy is faster than RateLimit
+func (c *dbCopy) throttle(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if c.opts.RateLimit == 0 {
+		return nil
+	}
+	expected := time.Duration(float64(c.bytes) / float64(c.opts.RateLimit) * float64(time.Second))
+	if wait := expected - time.Since(c.started); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return nil
+}
+
+func (c *dbCopy) copyTable(ctx context.Context, name string) error {
+	srcDbi := mdbx.DBI(c.src.db.buckets[name].DBI)
+	flags := uint(mdbx.Append)
+	if c.src.db.buckets[name].Flags&kv.DupSort != 0 {
+		flags = mdbx.AppendDup
+	}
+	cur, err := c.src.tx.OpenCursor(srcDbi)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	for k, v, err := cur.Get(nil, nil, mdbx.First); ; k, v, err = cur.Get(nil, nil, mdbx.Next) {
+		if err != nil {
+			if mdbx.IsNotFound(err) {
+				break
+			}
+			return err
+		}
+		if err := c.begin(); err != nil {
+			return err
+		}
+		dstDbi := mdbx.DBI(c.dst.buckets[name].DBI)
+		if err := c.dstTx.tx.Put(dstDbi, k, v, flags); err != nil {
+			return err
+		}
+		size := uint64(len(k) + len(v))
+		c.copied++
+		c.bytes += size
+		c.txBytes += size
+		if c.txBytes > uint64(copyCommitEvery) {
+			if err := c.commit(); err != nil {
+				return err
+			}
+		}
+		if c.bytes-c.throttledBytes > uint64(copyThrottleEvery) {
+			c.throttledBytes = c.bytes
+			if err := c.throttle(ctx); err != nil {
+				return err
+			}
+		}
+		if c.opts.Progress != nil && c.copied%copyProgressEvery == 0 {
+			c.opts.Progress(c.copied, c.total)
+		}
+	}
+	return nil
+}
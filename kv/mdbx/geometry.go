@@ -0,0 +1,91 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common/dir"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	defaultGrowthStep = 2 * datasize.GB
+	maxGrowthStep     = 2 * datasize.GB
+	minGrowthStep     = 64 * datasize.MB
+)
+
+// Geometry - current sizes of db file, see mdbx_env_set_geometry
+type Geometry struct {
+	Lower           datasize.ByteSize
+	Current         datasize.ByteSize
+	Upper           datasize.ByteSize
+	GrowthStep      datasize.ByteSize
+	ShrinkThreshold datasize.ByteSize
+	PageSize        uint64
+}
+
+// autoGrowthStep - big growth step means less re-mappings of db file,
+// but on small disks 2Gb step may fail while db still fits. Use 1/256 of free space: from 64Mb to 2Gb.
+// Used if enabled by MdbxOpts.AutoGrowthStep
+func autoGrowthStep(path string, logger log.Logger) datasize.ByteSize {
+	free, err := dir.FreeSpace(existingParent(path))
+	if err != nil {
+		logger.Warn("[db] can't detect free disk space, use default growth step", "path", path, "err", err)
+		return defaultGrowthStep
+	}
+	step := datasize.ByteSize(free / 256)
+	if step > maxGrowthStep {
+		return maxGrowthStep
+	}
+	if step < minGrowthStep {
+		return minGrowthStep
+	}
+	return step
+}
+
+// existingParent - db dir may not exist yet, then free space detected for nearest existing parent
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func (db *MdbxKV) Geometry() (Geometry, error) {
+	info, err := db.env.Info(nil)
+	if err != nil {
+		return Geometry{}, err
+	}
+	return Geometry{
+		Lower:           datasize.ByteSize(info.Geo.Lower),
+		Current:         datasize.ByteSize(info.Geo.Current),
+		Upper:           datasize.ByteSize(info.Geo.Upper),
+		GrowthStep:      datasize.ByteSize(info.Geo.Grow),
+		ShrinkThreshold: datasize.ByteSize(info.Geo.Shrink),
+		PageSize:        uint64(info.PageSize),
+	}, nil
+}
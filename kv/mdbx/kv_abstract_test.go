@@ -22,17 +22,24 @@ import (
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
 	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -507,3 +514,586 @@ func testMultiCursor(t *testing.T, db kv.RwDB, bucket1, bucket2 string) {
 //		})
 //	}
 //}
+
+func TestRemoteRange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	logger := log.New()
+	writeDB := mdbx.NewMDBX(logger).InMem().RoTxsLimiter(semaphore.NewWeighted(2)).MustOpen() // 2 read txs of client at once
+	defer writeDB.Close()
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	go func() {
+		remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(ctx, writeDB))
+		if err := grpcServer.Serve(conn); err != nil {
+			logger.Error("private RPC server fail", "err", err)
+		}
+	}()
+	defer grpcServer.Stop()
+
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"a1", "a2", "b1", "b2", "b3", "c1"} {
+			if err := tx.Put(kv.HashedAccounts, []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	cc, err := grpc.Dial("", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	require.NoError(t, err)
+	db, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).RangePageSize(2).Open()
+	require.NoError(t, err)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// changes after tx begin are not visible by Range of this tx
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HashedAccounts, []byte("b4"), []byte("vb4"))
+	}))
+
+	var keys []string
+	require.NoError(t, tx.ForEach(kv.HashedAccounts, []byte("a2"), func(k, v []byte) error {
+		require.Equal(t, "v"+string(k), string(v))
+		keys = append(keys, string(k))
+		return nil
+	}))
+	require.Equal(t, []string{"a2", "b1", "b2", "b3", "c1"}, keys)
+
+	keys = keys[:0]
+	require.NoError(t, tx.ForPrefix(kv.HashedAccounts, []byte("b"), func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}))
+	require.Equal(t, []string{"b1", "b2", "b3"}, keys)
+
+	keys = keys[:0]
+	require.NoError(t, tx.ForAmount(kv.HashedAccounts, []byte("a"), 3, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}))
+	require.Equal(t, []string{"a1", "a2", "b1"}, keys)
+
+	stopErr := fmt.Errorf("stop")
+	keys = keys[:0]
+	require.ErrorIs(t, tx.ForEach(kv.HashedAccounts, nil, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		if len(keys) == 3 {
+			return stopErr
+		}
+		return nil
+	}), stopErr)
+	require.Equal(t, []string{"a1", "a2", "b1"}, keys)
+
+	// stream of pages
+	it, err := tx.(kv.Ranger).Range(kv.HashedAccounts, []byte("a2"), []byte("c"))
+	require.NoError(t, err)
+	streamKeys, values, err := iter.ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a2"), []byte("b1"), []byte("b2"), []byte("b3")}, streamKeys)
+	require.Equal(t, []byte("vb3"), values[3])
+
+	// reads of the same tx while stream is consumed
+	it, err = tx.(kv.Ranger).Range(kv.HashedAccounts, nil, nil)
+	require.NoError(t, err)
+	keys = keys[:0]
+	for it.HasNext() {
+		k, _, err := it.Next()
+		require.NoError(t, err)
+		v, err := tx.GetOne(kv.HashedAccounts, k)
+		require.NoError(t, err)
+		require.Equal(t, "v"+string(k), string(v))
+		keys = append(keys, string(k))
+	}
+	require.Equal(t, []string{"a1", "a2", "b1", "b2", "b3", "c1"}, keys)
+
+	// dups of one key are split by pages
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		for _, v := range []string{"1", "2", "3", "4", "5"} {
+			if err := tx.Put(kv.AccountChangeSet, []byte("k"), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return tx.Put(kv.AccountChangeSet, []byte("l"), []byte("6"))
+	}))
+	dupTx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer dupTx.Rollback()
+	it, err = dupTx.(kv.Ranger).Range(kv.AccountChangeSet, nil, nil)
+	require.NoError(t, err)
+	dupKeys, dupValues, err := iter.ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, 6, len(dupKeys))
+	require.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4"), []byte("5"), []byte("6")}, dupValues)
+	require.Equal(t, []byte("l"), dupKeys[5])
+
+	// not finished stream is closed by Rollback
+	it, err = tx.(kv.Ranger).Range(kv.HashedAccounts, nil, nil)
+	require.NoError(t, err)
+	require.True(t, it.HasNext())
+}
+
+func TestRemoteCursorBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	logger := log.New()
+	writeDB := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer writeDB.Close()
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	go func() {
+		remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(ctx, writeDB))
+		if err := grpcServer.Serve(conn); err != nil {
+			logger.Error("private RPC server fail", "err", err)
+		}
+	}()
+	defer grpcServer.Stop()
+
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"a1", "a2", "b1", "b2", "b3", "c1"} {
+			if err := tx.Put(kv.HashedAccounts, []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+			if err := tx.Put(kv.AccountChangeSet, []byte(k[:1]), []byte(k[1:])); err != nil { // DupSort: a->1,2 b->1,2,3 c->1
+				return err
+			}
+		}
+		return nil
+	}))
+
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	cc, err := grpc.Dial("", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	require.NoError(t, err)
+	db, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).WithBucketsConfig(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{kv.HashedAccounts: {}, kv.AccountChangeSet: {Flags: kv.DupSort}}
+	}).CursorBatch(3).Open()
+	require.NoError(t, err)
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c, err := tx.Cursor(kv.HashedAccounts)
+		require.NoError(t, err)
+		defer c.Close()
+		var keys []string
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			require.NoError(t, err)
+			require.Equal(t, "v"+string(k), string(v))
+			keys = append(keys, string(k))
+		}
+		require.Equal(t, []string{"a1", "a2", "b1", "b2", "b3", "c1"}, keys)
+
+		// ops relative to current position after batched Next
+		k, _, err := c.Seek([]byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, "a1", string(k))
+		k, _, err = c.Next()
+		require.NoError(t, err)
+		require.Equal(t, "a2", string(k))
+		k, _, err = c.Current()
+		require.NoError(t, err)
+		require.Equal(t, "a2", string(k))
+		k, _, err = c.Next()
+		require.NoError(t, err)
+		require.Equal(t, "b1", string(k))
+		k, _, err = c.Prev()
+		require.NoError(t, err)
+		require.Equal(t, "a2", string(k))
+
+		dc, err := tx.CursorDupSort(kv.AccountChangeSet)
+		require.NoError(t, err)
+		defer dc.Close()
+		_, _, err = dc.Seek([]byte("b"))
+		require.NoError(t, err)
+		k, v, err := dc.Next()
+		require.NoError(t, err)
+		require.Equal(t, "b2", string(k)+string(v))
+		k, v, err = dc.NextNoDup()
+		require.NoError(t, err)
+		require.Equal(t, "c1", string(k)+string(v))
+		return nil
+	}))
+}
+
+func TestDupSortBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			kv.PlainState: kv.TableCfgItem{Flags: kv.DupSort},
+		}
+	})
+	keys := [][]byte{[]byte("k1"), []byte("k1"), []byte("k1"), []byte("k3")}
+	values := [][]byte{[]byte("v1"), []byte("v3"), []byte("v5"), []byte("v1")}
+	for _, db := range writeDBs {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			c, err := tx.RwCursorDupSort(kv.PlainState)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			return kv.AppendDupBatch(c, keys, values)
+		}))
+	}
+
+	for _, db := range readDBs {
+		require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+			c, err := tx.CursorDupSort(kv.PlainState)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			res, err := kv.SeekBothRangeMulti(c,
+				[][]byte{[]byte("k1"), []byte("k1"), []byte("k2"), []byte("k3"), []byte("k3")},
+				[][]byte{[]byte("v0"), []byte("v4"), []byte("v1"), []byte("v1"), []byte("v2")},
+			)
+			if err != nil {
+				return err
+			}
+			require.Equal(t, [][]byte{[]byte("v1"), []byte("v5"), nil, []byte("v1"), nil}, res)
+
+			_, err = kv.SeekBothRangeMulti(c, keys, values[:1])
+			require.Error(t, err)
+			return nil
+		}))
+	}
+
+	// not sorted input
+	require.Error(t, writeDBs[0].Update(ctx, func(tx kv.RwTx) error {
+		c, err := tx.RwCursorDupSort(kv.PlainState)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return kv.AppendDupBatch(c, [][]byte{[]byte("k3"), []byte("k3")}, [][]byte{[]byte("v5"), []byte("v4")})
+	}))
+}
+
+func TestTableStats(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			kv.HashedAccounts: kv.TableCfgItem{},
+		}
+	})
+	require.NoError(t, writeDBs[1].Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 100; i++ {
+			if err := tx.Put(kv.HashedAccounts, []byte(fmt.Sprintf("key%03d", i)), make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return tx.Put(kv.HashedAccounts, []byte("big"), make([]byte, 64*1024))
+	}))
+
+	var local kv.TableStats
+	require.NoError(t, readDBs[1].View(ctx, func(tx kv.Tx) (err error) {
+		local, err = tx.(kv.TableStatsReader).TableStats(kv.HashedAccounts)
+		return err
+	}))
+	require.Equal(t, uint64(101), local.Entries)
+	require.NotZero(t, local.LeafPages)
+	require.NotZero(t, local.OverflowPages)
+	require.Greater(t, local.Bytes, uint64(64*1024))
+
+	require.NoError(t, readDBs[2].View(ctx, func(tx kv.Tx) error {
+		st, err := tx.(kv.TableStatsReader).TableStats(kv.HashedAccounts)
+		require.NoError(t, err)
+		require.Equal(t, local, st)
+		_, err = tx.(kv.TableStatsReader).TableStats("NotExistingTable")
+		require.Error(t, err)
+		return nil
+	}))
+}
+
+func TestGetMany(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			kv.HashedAccounts: kv.TableCfgItem{},
+		}
+	})
+	require.NoError(t, writeDBs[1].Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HashedAccounts, []byte("a"), []byte{1}); err != nil {
+			return err
+		}
+		if err := tx.Put(kv.HashedAccounts, []byte("c"), []byte{3}); err != nil {
+			return err
+		}
+		return tx.Put(kv.HashedAccounts, []byte("empty"), []byte{})
+	}))
+
+	keys := [][]byte{[]byte("c"), []byte("b"), []byte("a"), []byte("empty"), []byte("c")}
+	for _, db := range readDBs[1:] {
+		require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+			vals, err := tx.(kv.ManyGetter).GetMany(kv.HashedAccounts, keys)
+			require.NoError(t, err)
+			require.Equal(t, len(keys), len(vals))
+			require.Equal(t, []byte{3}, vals[0])
+			require.Nil(t, vals[1])
+			require.Equal(t, []byte{1}, vals[2])
+			require.Equal(t, []byte{3}, vals[4])
+			for i, k := range keys { // same as GetOne (including empty values)
+				v, err := tx.GetOne(kv.HashedAccounts, k)
+				require.NoError(t, err)
+				require.Equal(t, v, vals[i])
+			}
+
+			vals, err = tx.(kv.ManyGetter).GetMany(kv.HashedAccounts, nil)
+			require.NoError(t, err)
+			require.Empty(t, vals)
+			return nil
+		}))
+	}
+}
+
+func TestRange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			kv.HashedAccounts: kv.TableCfgItem{},
+			kv.HashedStorage:  kv.TableCfgItem{},
+		}
+	})
+	for _, db := range writeDBs {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			for _, k := range []string{"a", "b", "c", "d"} {
+				if err := tx.Put(kv.HashedAccounts, []byte(k), []byte("acc"+k)); err != nil {
+					return err
+				}
+			}
+			for _, k := range []string{"b", "e"} {
+				if err := tx.Put(kv.HashedStorage, []byte(k), []byte("st"+k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+
+	for _, db := range readDBs[1:] {
+		require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+			it, err := tx.(kv.Ranger).Range(kv.HashedAccounts, []byte("b"), []byte("d"))
+			require.NoError(t, err)
+			keys, values, err := iter.ToArrayKV(it)
+			require.NoError(t, err)
+			require.Equal(t, [][]byte{[]byte("b"), []byte("c")}, keys)
+			require.Equal(t, [][]byte{[]byte("accb"), []byte("accc")}, values)
+
+			it, err = tx.(kv.Ranger).Range(kv.HashedAccounts, []byte("x"), nil)
+			require.NoError(t, err)
+			require.False(t, it.HasNext())
+
+			accs, err := tx.(kv.Ranger).Range(kv.HashedAccounts, nil, nil)
+			require.NoError(t, err)
+			storage, err := tx.(kv.Ranger).Range(kv.HashedStorage, nil, nil)
+			require.NoError(t, err)
+			keys, values, err = iter.ToArrayKV(iter.UnionKV(storage, accs))
+			require.NoError(t, err)
+			require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}, keys)
+			require.Equal(t, []byte("stb"), values[1])
+			return nil
+		}))
+	}
+}
+
+func TestRemoteAuth(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	logger := log.New()
+	writeDB := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer writeDB.Close()
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HashedAccounts, []byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		return tx.Put(kv.HashedStorage, []byte("s"), []byte("2"))
+	}))
+
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	auth := remotedbserver.NewAuth().
+		WithToken("full", remotedbserver.ACL{Name: "full"}).
+		WithToken("accounts", remotedbserver.ACL{Name: "accounts", Tables: []string{kv.HashedAccounts}})
+	go func() {
+		remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(ctx, writeDB).WithAuth(auth))
+		if err := grpcServer.Serve(conn); err != nil {
+			logger.Error("private RPC server fail", "err", err)
+		}
+	}()
+	defer grpcServer.Stop()
+
+	open := func(token string) kv.RoDB {
+		opts := []grpc.DialOption{grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() })}
+		if token != "" {
+			opts = append(opts, grpc.WithPerRPCCredentials(grpcutil.BearerToken(token, true)))
+		}
+		cc, err := grpc.Dial("", opts...)
+		require.NoError(t, err)
+		v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+		db, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).Open()
+		require.NoError(t, err)
+		t.Cleanup(db.Close)
+		return db
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		_, err := open(token).BeginRo(ctx)
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	require.NoError(t, open("full").View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.HashedStorage, []byte("s"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("2"), v)
+		return nil
+	}))
+
+	db := open("accounts")
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.HashedAccounts, []byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), v)
+		vals, err := tx.(kv.ManyGetter).GetMany(kv.HashedAccounts, [][]byte{[]byte("a")})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("1")}, vals)
+
+		_, err = tx.(kv.ManyGetter).GetMany(kv.HashedStorage, [][]byte{[]byte("s")})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = tx.(kv.TableStatsReader).TableStats(kv.HashedStorage)
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		return nil
+	}))
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		_, err := tx.GetOne(kv.HashedStorage, []byte("s"))
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		return nil
+	}))
+}
+
+// droppingStream - first message received after drop is set is lost with the stream: like connection loss
+type droppingStream struct {
+	grpc.ServerStream
+	drop    *atomic.Bool
+	dropped bool
+}
+
+func (s *droppingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.drop.CAS(true, false) {
+		s.dropped = true
+		return status.Error(codes.Unavailable, "connection dropped")
+	}
+	return nil
+}
+
+func TestRemoteReconnect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	ctx := context.Background()
+	logger := log.New()
+	writeDB := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer writeDB.Close()
+	drop := atomic.NewBool(false)
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ds := &droppingStream{ServerStream: ss, drop: drop}
+		err := handler(srv, ds)
+		if ds.dropped {
+			return status.Error(codes.Unavailable, "connection dropped")
+		}
+		return err
+	}))
+	go func() {
+		remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(ctx, writeDB))
+		if err := grpcServer.Serve(conn); err != nil {
+			logger.Error("private RPC server fail", "err", err)
+		}
+	}()
+	defer grpcServer.Stop()
+
+	require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"a1", "a2", "a3", "b1"} {
+			if err := tx.Put(kv.HashedAccounts, []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	cc, err := grpc.Dial("", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	require.NoError(t, err)
+	cfg := func(defaultBuckets kv.TableCfg) kv.TableCfg { return kv.TableCfg{kv.HashedAccounts: {}} }
+
+	// disabled by default
+	db, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).WithBucketsConfig(cfg).Open()
+	require.NoError(t, err)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c, err := tx.Cursor(kv.HashedAccounts)
+		require.NoError(t, err)
+		_, _, err = c.First()
+		require.NoError(t, err)
+		drop.Store(true)
+		_, _, err = c.Next()
+		require.Equal(t, codes.Unavailable, status.Code(err))
+		return nil
+	}))
+
+	db, err = remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).WithBucketsConfig(cfg).Reconnect(3, 10*time.Millisecond).Open()
+	require.NoError(t, err)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c, err := tx.Cursor(kv.HashedAccounts)
+		require.NoError(t, err)
+		defer c.Close()
+		k, _, err := c.First()
+		require.NoError(t, err)
+		require.Equal(t, "a1", string(k))
+		k, _, err = c.Next()
+		require.NoError(t, err)
+		require.Equal(t, "a2", string(k))
+
+		// same view: position restored
+		drop.Store(true)
+		k, v, err := c.Next()
+		require.NoError(t, err)
+		require.Equal(t, "a3", string(k))
+		require.Equal(t, "va3", string(v))
+		require.False(t, remotedb.ViewChanged(tx))
+
+		// newer view: record under cursor was deleted - position lost
+		require.NoError(t, writeDB.Update(ctx, func(tx kv.RwTx) error { return tx.Delete(kv.HashedAccounts, []byte("a3"), nil) }))
+		drop.Store(true)
+		_, _, err = c.Next()
+		require.ErrorIs(t, err, remotedb.ErrCursorPositionLost)
+		require.True(t, remotedb.ViewChanged(tx))
+		k, _, err = c.Seek([]byte("a3"))
+		require.NoError(t, err)
+		require.Equal(t, "b1", string(k))
+
+		has, err := tx.Has(kv.HashedAccounts, []byte("a3"))
+		require.NoError(t, err)
+		require.False(t, has)
+		return nil
+	}))
+}
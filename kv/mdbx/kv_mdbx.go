@@ -37,6 +37,7 @@ import (
 	"golang.org/x/sync/semaphore"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 )
 
 const NonExistingDBI kv.DBI = 999_999_999
@@ -48,18 +49,32 @@ func WithChaindataTables(defaultBuckets kv.TableCfg) kv.TableCfg {
 }
 
 type MdbxOpts struct {
-	bucketsCfg    TableCfgFunc
-	path          string
-	inMem         bool
-	label         kv.Label // marker to distinct db instances - one process may open many databases. for example to collect metrics of only 1 database
-	verbosity     kv.DBVerbosityLvl
-	mapSize       datasize.ByteSize
-	flags         uint
-	log           log.Logger
-	syncPeriod    time.Duration
-	augumentLimit uint64
-	pageSize      uint64
-	roTxsLimiter  *semaphore.Weighted
+	bucketsCfg      TableCfgFunc
+	path            string
+	inMem           bool
+	label           kv.Label // marker to distinct db instances - one process may open many databases. for example to collect metrics of only 1 database
+	verbosity       kv.DBVerbosityLvl
+	mapSize         datasize.ByteSize
+	initialMapSize  datasize.ByteSize
+	growthStep      datasize.ByteSize
+	autoGrowth      bool // growthStep is detected by free disk space, see autoGrowthStep
+	shrinkThreshold datasize.ByteSize
+	shrinkSet       bool // shrinkThreshold was set, otherwise default of mdbx is used
+	flags           uint
+	log             log.Logger
+	syncPeriod      time.Duration
+	syncBytes       datasize.ByteSize
+	syncMode        SyncMode
+	augumentLimit   uint64
+	pageSize        uint64
+	roTxsLimiter    *semaphore.Weighted
+
+	readAhead      ReadAheadPolicy
+	warmupTables   []string
+	migrator       *kv.Migrator
+	txMetrics      kv.TxMetrics
+	stuckReaderAge time.Duration
+	verifyTables   bool
 }
 
 func testKVPath() string {
@@ -133,11 +148,31 @@ func (opts MdbxOpts) Readonly() MdbxOpts {
 	return opts
 }
 
+// Follower - read-only open of db which is written by other process: geometry and sync mode of writer are used.
+// See NewFollower - to keep view up to date
+func (opts MdbxOpts) Follower() MdbxOpts {
+	opts.flags = opts.flags | mdbx.Readonly | mdbx.Accede
+	return opts
+}
+
+// SyncPeriod - in no-sync modes: fsync not later than this period after commit
 func (opts MdbxOpts) SyncPeriod(period time.Duration) MdbxOpts {
 	opts.syncPeriod = period
 	return opts
 }
 
+// SyncBytes - in no-sync modes: fsync when this amount of data is committed without fsync
+func (opts MdbxOpts) SyncBytes(sz datasize.ByteSize) MdbxOpts {
+	opts.syncBytes = sz
+	return opts
+}
+
+// SyncMode - see SyncMode docs. Db can be forced to flush at any time by MdbxKV.Sync
+func (opts MdbxOpts) SyncMode(m SyncMode) MdbxOpts {
+	opts.syncMode = m
+	return opts
+}
+
 func (opts MdbxOpts) DBVerbosity(v kv.DBVerbosityLvl) MdbxOpts {
 	opts.verbosity = v
 	return opts
@@ -148,11 +183,75 @@ func (opts MdbxOpts) MapSize(sz datasize.ByteSize) MdbxOpts {
 	return opts
 }
 
+// InitialMapSize - size of new db file. If not set - default of mdbx
+func (opts MdbxOpts) InitialMapSize(sz datasize.ByteSize) MdbxOpts {
+	opts.initialMapSize = sz
+	return opts
+}
+
+// GrowthStep - db file will grow by this step. If not set - 2Gb
+func (opts MdbxOpts) GrowthStep(sz datasize.ByteSize) MdbxOpts {
+	opts.growthStep = sz
+	return opts
+}
+
+// AutoGrowthStep - growth step is detected by free disk space (if GrowthStep is not set)
+func (opts MdbxOpts) AutoGrowthStep() MdbxOpts {
+	opts.autoGrowth = true
+	return opts
+}
+
+// ShrinkThreshold - db file will be shrunk if has this amount of free space at the end. If not set - default of mdbx, 0 - never shrink
+func (opts MdbxOpts) ShrinkThreshold(sz datasize.ByteSize) MdbxOpts {
+	opts.shrinkThreshold, opts.shrinkSet = sz, true
+	return opts
+}
+
+// WriteMap - writes go directly to mmap'ed file: faster commits, but with SyncUtterlyNoSync db may be corrupted even by process crash
 func (opts MdbxOpts) WriteMap() MdbxOpts {
 	opts.flags |= mdbx.WriteMap
 	return opts
 }
 
+// ReadAhead - db-wide hint about access pattern: ReadAheadRandom for point-lookups (RPC),
+// ReadAheadWillNeed for scans (ETL) - also warms-up all tables after open
+func (opts MdbxOpts) ReadAhead(p ReadAheadPolicy) MdbxOpts {
+	opts.readAhead = p
+	return opts
+}
+
+// WarmUpTables - pages of these tables will be loaded to page cache in background after open.
+// MDBX tables share one mmap, so madvise hints can't be set per-table - use ReadAhead for whole db.
+func (opts MdbxOpts) WarmUpTables(tables ...string) MdbxOpts {
+	opts.warmupTables = append(append([]string{}, opts.warmupTables...), tables...) // copy - opts passed by value
+	return opts
+}
+
+// Migrations - not applied migrations will be applied on Open (in read-write mode only)
+func (opts MdbxOpts) Migrations(m *kv.Migrator) MdbxOpts {
+	opts.migrator = m
+	return opts
+}
+
+// TxMetrics - receiver of transactions metrics, for example kv.NewTxMetrics(label). Default - nil: metrics are not collected
+func (opts MdbxOpts) TxMetrics(m kv.TxMetrics) MdbxOpts {
+	opts.txMetrics = m
+	return opts
+}
+
+// StuckReaderDetector - logs read transactions open for longer than threshold, with stack of their creation (see kv.ReaderWatchdog). 0 - disabled
+func (opts MdbxOpts) StuckReaderDetector(threshold time.Duration) MdbxOpts {
+	opts.stuckReaderAge = threshold
+	return opts
+}
+
+// VerifyTables - Open fails with *kv.TablesDiffError if existing tables have other flags than in tables config,
+// or if read-only db has no some tables. Without it difference is logged and available by MdbxKV.TablesDiff
+func (opts MdbxOpts) VerifyTables() MdbxOpts {
+	opts.verifyTables = true
+	return opts
+}
+
 func (opts MdbxOpts) WithTablessCfg(f TableCfgFunc) MdbxOpts {
 	opts.bucketsCfg = f
 	return opts
@@ -163,6 +262,8 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 	if opts.inMem {
 		opts.path = testKVPath()
 	}
+	opts.flags = applyReadAhead(opts.flags, opts.readAhead)
+	opts.flags = applySyncMode(opts.flags, opts.syncMode)
 
 	env, err := mdbx.NewEnv()
 	if err != nil {
@@ -189,12 +290,26 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 		}
 	}
 	if opts.flags&mdbx.Accede == 0 {
+		initialMapSize := -1
+		if opts.initialMapSize > 0 {
+			initialMapSize = int(opts.initialMapSize)
+		}
 		if opts.inMem {
-			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.MB), 0, 4*1024); err != nil {
+			if err = env.SetGeometry(-1, initialMapSize, int(opts.mapSize), int(2*datasize.MB), 0, 4*1024); err != nil {
 				return nil, err
 			}
 		} else {
-			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.GB), -1, int(opts.pageSize)); err != nil {
+			if opts.growthStep == 0 {
+				opts.growthStep = defaultGrowthStep
+				if opts.autoGrowth {
+					opts.growthStep = autoGrowthStep(opts.path, opts.log)
+				}
+			}
+			shrinkThreshold := -1
+			if opts.shrinkSet {
+				shrinkThreshold = int(opts.shrinkThreshold)
+			}
+			if err = env.SetGeometry(-1, initialMapSize, int(opts.mapSize), int(opts.growthStep), shrinkThreshold, int(opts.pageSize)); err != nil {
 				return nil, err
 			}
 		}
@@ -254,16 +369,28 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 			return nil, err
 		}
 	}
+	if opts.syncBytes != 0 {
+		if err = env.SetOption(mdbx.OptSyncBytes, uint64(opts.syncBytes)); err != nil {
+			env.Close()
+			return nil, err
+		}
+	}
 
 	if opts.roTxsLimiter == nil {
 		opts.roTxsLimiter = semaphore.NewWeighted(int64(runtime.GOMAXPROCS(-1)))
 	}
+	var watchdog *kv.ReaderWatchdog
+	if opts.stuckReaderAge > 0 {
+		watchdog = kv.NewReaderWatchdog(opts.txMetrics, opts.stuckReaderAge, opts.log)
+		opts.txMetrics = watchdog
+	}
 	db := &MdbxKV{
 		opts:         opts,
 		env:          env,
 		log:          opts.log,
 		wg:           &sync.WaitGroup{},
 		buckets:      kv.TableCfg{},
+		tablesCfg:    kv.TableCfg{},
 		txSize:       dirtyPagesLimit * opts.pageSize,
 		roTxsLimiter: opts.roTxsLimiter,
 	}
@@ -271,12 +398,20 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 	customBuckets := opts.bucketsCfg(kv.ChaindataTablesCfg)
 	for name, cfg := range customBuckets { // copy map to avoid changing global variable
 		db.buckets[name] = cfg
+		db.tablesCfg[name] = cfg
 	}
 
 	buckets := bucketSlice(db.buckets)
 	if err := db.openDBIs(buckets); err != nil {
 		return nil, err
 	}
+	if !db.tablesDiff.Empty() {
+		if opts.verifyTables {
+			db.Close()
+			return nil, &kv.TablesDiffError{Diff: db.tablesDiff}
+		}
+		db.log.Warn("[db] tables config doesn't match db", "label", opts.label.String(), "diff", db.tablesDiff.String())
+	}
 
 	// Configure buckets and open deprecated buckets
 	if err := env.View(func(tx *mdbx.Txn) error {
@@ -312,9 +447,75 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 		}
 
 	}
+	if opts.migrator != nil && opts.flags&mdbx.Readonly == 0 {
+		applied, err := opts.migrator.Apply(context.Background(), db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		for _, name := range applied {
+			db.log.Info("[db] migration applied", "label", opts.label.String(), "name", name)
+		}
+	}
+	if err := db.checkTableVersions(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.startWarmup(db.warmupTables())
+	if watchdog != nil {
+		db.startReaderWatchdog(watchdog)
+	}
 	return db, nil
 }
 
+// checkTableVersions - see kv.CheckTableVersions. Db is checked if it has TableVersions table or config has versioned
+// tables. In read-write mode versions of empty tables are written
+func (db *MdbxKV) checkTableVersions() error {
+	versioned := false
+	for _, item := range db.tablesCfg {
+		versioned = versioned || item.Version > 0
+	}
+	exists := false
+	if err := db.env.View(func(tx *mdbx.Txn) error {
+		_, err := tx.OpenDBI(kv.TableVersions, mdbx.DBAccede, nil, nil)
+		if mdbx.IsNotFound(err) {
+			return nil
+		}
+		exists = err == nil
+		return err
+	}); err != nil {
+		return err
+	}
+	readonly := db.opts.flags&mdbx.Readonly != 0
+	if !exists && (!versioned || readonly) {
+		return nil
+	}
+	if readonly {
+		return db.View(context.Background(), func(tx kv.Tx) error {
+			if err := tx.(*MdbxTx).CreateBucket(kv.TableVersions); err != nil { // opens existing table
+				return err
+			}
+			_, err := kv.CheckTableVersions(tx, db.tablesCfg)
+			return err
+		})
+	}
+	return db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.CreateBucket(kv.TableVersions); err != nil {
+			return err
+		}
+		unset, err := kv.CheckTableVersions(tx, db.tablesCfg)
+		if err != nil {
+			return err
+		}
+		for _, name := range unset {
+			if err := kv.PutTableVersion(tx, name, db.tablesCfg[name].Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (opts MdbxOpts) MustOpen() kv.RwDB {
 	db, err := opts.Open()
 	if err != nil {
@@ -328,14 +529,27 @@ type MdbxKV struct {
 	log          log.Logger
 	wg           *sync.WaitGroup
 	buckets      kv.TableCfg
+	tablesCfg    kv.TableCfg // as configured by user. `buckets` has flags of existing tables as they are in db
+	tablesDiff   kv.TablesDiff
 	opts         MdbxOpts
 	txSize       uint64
 	roTxsLimiter *semaphore.Weighted // does limit amount of concurrent Ro transactions - in most casess runtime.NumCPU() is good value for this channel capacity - this channel can be shared with other components (like Decompressor)
 	closed       atomic.Bool
+	txCounters   txCounters
+
+	warmupCancel context.CancelFunc
+	warmupWg     sync.WaitGroup
+
+	watchdog       *kv.ReaderWatchdog
+	watchdogCancel context.CancelFunc
+	watchdogWg     sync.WaitGroup
 }
 
 func (db *MdbxKV) PageSize() uint64 { return db.opts.pageSize }
 
+// TablesDiff - difference between tables config and db found on Open
+func (db *MdbxKV) TablesDiff() kv.TablesDiff { return db.tablesDiff }
+
 // openDBIs - first trying to open existing DBI's in RO transaction
 // otherwise re-try by RW transaction
 // it allow open DB from another process - even if main process holding long RW transaction
@@ -346,7 +560,7 @@ func (db *MdbxKV) openDBIs(buckets []string) error {
 				if db.buckets[name].IsDeprecated {
 					continue
 				}
-				if err := tx.(kv.BucketMigrator).CreateBucket(name); err != nil {
+				if err := tx.(*MdbxTx).openTable(name); err != nil {
 					return err
 				}
 			}
@@ -360,7 +574,7 @@ func (db *MdbxKV) openDBIs(buckets []string) error {
 				if db.buckets[name].IsDeprecated {
 					continue
 				}
-				if err := tx.(kv.BucketMigrator).CreateBucket(name); err != nil {
+				if err := tx.(*MdbxTx).openTable(name); err != nil {
 					return err
 				}
 			}
@@ -378,6 +592,14 @@ func (db *MdbxKV) Close() {
 	if db.closed.Load() {
 		return
 	}
+	if db.warmupCancel != nil {
+		db.warmupCancel()
+	}
+	db.warmupWg.Wait()
+	if db.watchdogCancel != nil {
+		db.watchdogCancel()
+	}
+	db.watchdogWg.Wait()
 	db.closed.Store(true)
 	db.wg.Wait()
 	db.env.Close()
@@ -396,8 +618,11 @@ func (db *MdbxKV) BeginRo(ctx context.Context) (txn kv.Tx, err error) {
 	}
 
 	// will return nil err if context is cancelled (may appear to acquire the semaphore)
-	if semErr := db.roTxsLimiter.Acquire(ctx, 1); semErr != nil {
-		return nil, semErr
+	if !db.roTxsLimiter.TryAcquire(1) {
+		db.txCounters.roWaits.Inc()
+		if semErr := db.roTxsLimiter.Acquire(ctx, 1); semErr != nil {
+			return nil, semErr
+		}
 	}
 
 	// if context cancelled as we acquire the sempahore, it may succeed without blocking
@@ -421,11 +646,17 @@ func (db *MdbxKV) BeginRo(ctx context.Context) (txn kv.Tx, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("%w, label: %s, trace: %s", err, db.opts.label.String(), stack2.Trace().String())
 	}
+	db.txCounters.ro.Inc()
 	tx.RawRead = true
+	var roEnd func()
+	if db.opts.txMetrics != nil {
+		roEnd = db.opts.txMetrics.ReadTxBegin()
+	}
 	return &MdbxTx{
 		db:       db,
 		tx:       tx,
 		readOnly: true,
+		roEnd:    roEnd,
 	}, nil
 }
 
@@ -446,9 +677,11 @@ func (db *MdbxKV) BeginRw(_ context.Context) (txn kv.RwTx, err error) {
 		return nil, fmt.Errorf("%w, lable: %s, trace: %s", err, db.opts.label.String(), stack2.Trace().String())
 	}
 	tx.RawRead = true
+	db.txCounters.rw.Inc()
 	return &MdbxTx{
-		db: db,
-		tx: tx,
+		db:    db,
+		tx:    tx,
+		begin: time.Now(),
 	}, nil
 }
 
@@ -459,8 +692,16 @@ type MdbxTx struct {
 	statelessCursors map[string]kv.Cursor
 	readOnly         bool
 	cursorID         uint64
+	begin            time.Time // of write transaction
+	roEnd            func()    // reports end of read transaction to kv.TxMetrics
+	hooks            kv.TxHooks
 }
 
+var _ kv.CommitHooks = (*MdbxTx)(nil)
+
+func (tx *MdbxTx) PreCommit(f func() error) { tx.hooks.PreCommit(f) }
+func (tx *MdbxTx) PostCommit(f func())      { tx.hooks.PostCommit(f) }
+
 type MdbxCursor struct {
 	tx         *MdbxTx
 	c          *mdbx.Cursor
@@ -470,6 +711,27 @@ type MdbxCursor struct {
 	id         uint64
 }
 
+// ReaderWatchdog - nil if MdbxOpts.StuckReaderDetector is not set
+func (db *MdbxKV) ReaderWatchdog() *kv.ReaderWatchdog { return db.watchdog }
+
+func (db *MdbxKV) startReaderWatchdog(w *kv.ReaderWatchdog) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db.watchdog, db.watchdogCancel = w, cancel
+	db.watchdogWg.Add(1)
+	go func() {
+		defer db.watchdogWg.Done()
+		w.Run(ctx, db.opts.stuckReaderAge/2)
+	}()
+}
+
+// Sync - flushes all committed data to disk. Useful in no-sync modes: for example before backup or shutdown
+func (db *MdbxKV) Sync() error {
+	if err := db.env.Sync(true, false); err != nil {
+		return fmt.Errorf("mdbx sync: %w, label: %s", err, db.opts.label.String())
+	}
+	return nil
+}
+
 func (db *MdbxKV) Env() *mdbx.Env {
 	return db.env
 }
@@ -677,6 +939,35 @@ func (db *MdbxKV) Update(ctx context.Context, f func(tx kv.RwTx) error) (err err
 	return nil
 }
 
+// openTable - CreateBucket on open of db: records difference with tables config to db.tablesDiff,
+// doesn't fail on tables missing in read-only db
+func (tx *MdbxTx) openTable(name string) error {
+	declared := tx.db.tablesCfg[name].Flags
+	dbi, err := tx.tx.OpenDBI(name, mdbx.DBAccede, nil, nil)
+	switch {
+	case err == nil:
+		flags, err := tx.tx.Flags(dbi)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", name, err)
+		}
+		if actual := kv.TableFlags(flags); actual != declared {
+			tx.db.tablesDiff.FlagsMismatch = append(tx.db.tablesDiff.FlagsMismatch, kv.TableFlagsMismatch{Table: name, Declared: declared, Actual: actual})
+		}
+	case mdbx.IsNotFound(err):
+		if tx.db.opts.flags&mdbx.Readonly != 0 {
+			tx.db.tablesDiff.Missing = append(tx.db.tablesDiff.Missing, name)
+			cnfCopy := tx.db.buckets[name]
+			cnfCopy.DBI = NonExistingDBI
+			tx.db.buckets[name] = cnfCopy
+			return nil
+		}
+		tx.db.tablesDiff.Created = append(tx.db.tablesDiff.Created, name)
+	default:
+		return fmt.Errorf("table %s: %w", name, err)
+	}
+	return tx.CreateBucket(name)
+}
+
 func (tx *MdbxTx) CreateBucket(name string) error {
 	cnfCopy := tx.db.buckets[name]
 	dbi, err := tx.tx.OpenDBI(name, mdbx.DBAccede, nil, nil)
@@ -704,13 +995,12 @@ func (tx *MdbxTx) CreateBucket(name string) error {
 		nativeFlags |= mdbx.Create
 	}
 
-	if flags&kv.DupSort != 0 {
-		nativeFlags |= mdbx.DupSort
-		flags ^= kv.DupSort
-	}
-	if flags != 0 {
+	// kv.TableFlags have values of mdbx flags
+	const supportedFlags = kv.ReverseKey | kv.DupSort | kv.IntegerKey | kv.DupFixed | kv.IntegerDup | kv.ReverseDup
+	if flags&^supportedFlags != 0 {
 		return fmt.Errorf("some not supported flag provided for bucket")
 	}
+	nativeFlags |= uint(flags)
 
 	dbi, err = tx.tx.OpenDBI(name, nativeFlags, nil, nil)
 
@@ -747,6 +1037,17 @@ func (tx *MdbxTx) dropEvenIfBucketIsNotDeprecated(name string) error {
 	return nil
 }
 
+// ForceDropBucket - drops table even if it's not deprecated, next CreateBucket will use flags from tables config
+func (tx *MdbxTx) ForceDropBucket(bucket string) error {
+	if err := tx.dropEvenIfBucketIsNotDeprecated(bucket); err != nil {
+		return err
+	}
+	cnfCopy := tx.db.buckets[bucket]
+	cnfCopy.Flags = tx.db.tablesCfg[bucket].Flags
+	tx.db.buckets[bucket] = cnfCopy
+	return nil
+}
+
 func (tx *MdbxTx) ClearBucket(bucket string) error {
 	dbi := tx.db.buckets[bucket].DBI
 	if dbi == NonExistingDBI {
@@ -755,6 +1056,41 @@ func (tx *MdbxTx) ClearBucket(bucket string) error {
 	return tx.tx.Drop(mdbx.DBI(dbi), false)
 }
 
+// DeleteRange - deletes keys in [fromKey, toKey) with all their values, toKey == nil - till end of table.
+// Whole table is cleared natively, else - by 1 cursor walk: MDBX moves cursor to next record on delete
+func (tx *MdbxTx) DeleteRange(table string, fromKey, toKey []byte) error {
+	if fromKey == nil && toKey == nil {
+		return tx.ClearBucket(table)
+	}
+	if tx.db.buckets[table].DBI == NonExistingDBI {
+		return nil
+	}
+	rc, err := tx.stdCursor(table)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	c := rc.(*MdbxCursor)
+	delAllValues := c.bucketCfg.Flags&kv.DupSort != 0 && !c.bucketCfg.AutoDupSortKeysConversion
+	for k, _, err := c.Seek(fromKey); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return fmt.Errorf("DeleteRange %s: %w", table, err)
+		}
+		if toKey != nil && bytes.Compare(k, toKey) >= 0 {
+			break
+		}
+		if delAllValues {
+			err = c.delNoDupData()
+		} else {
+			err = c.delCurrent()
+		}
+		if err != nil {
+			return fmt.Errorf("DeleteRange %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 func (tx *MdbxTx) DropBucket(bucket string) error {
 	if cfg, ok := tx.db.buckets[bucket]; !(ok && cfg.IsDeprecated) {
 		return fmt.Errorf("%w, bucket: %s", kv.ErrAttemptToDeleteNonDeprecatedBucket, bucket)
@@ -774,6 +1110,16 @@ func (tx *MdbxTx) Commit() error {
 	if tx.tx == nil {
 		return nil
 	}
+	if err := tx.hooks.RunPreCommit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	committed := false
+	defer func() { // after release of tx resources
+		if committed {
+			tx.hooks.RunPostCommit()
+		}
+	}()
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
@@ -782,6 +1128,7 @@ func (tx *MdbxTx) Commit() error {
 		} else {
 			runtime.UnlockOSThread()
 		}
+		tx.reportEnd()
 	}()
 	tx.closeCursors()
 
@@ -795,10 +1142,26 @@ func (tx *MdbxTx) Commit() error {
 	//}
 	tx.CollectMetrics()
 
+	var dirty uint64
+	if !tx.readOnly && tx.db.opts.txMetrics != nil {
+		if txInfo, err := tx.tx.Info(true); err == nil {
+			dirty = txInfo.SpaceDirty
+		}
+	}
 	latency, err := tx.tx.Commit()
 	if err != nil {
+		if !tx.readOnly {
+			tx.db.txCounters.commitErrors.Inc()
+		}
 		return err
 	}
+	committed = true
+	if !tx.readOnly {
+		tx.db.txCounters.committed.Inc()
+		if tx.db.opts.txMetrics != nil {
+			tx.db.opts.txMetrics.Committed(latency.Whole, dirty)
+		}
+	}
 
 	if tx.db.opts.label == kv.ChainDB {
 		kv.DbCommitPreparation.Update(latency.Preparation.Seconds())
@@ -829,6 +1192,7 @@ func (tx *MdbxTx) Rollback() {
 	if tx.tx == nil {
 		return
 	}
+	tx.hooks.Reset()
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
@@ -837,12 +1201,26 @@ func (tx *MdbxTx) Rollback() {
 		} else {
 			runtime.UnlockOSThread()
 		}
+		tx.reportEnd()
 	}()
 	tx.closeCursors()
 	//tx.printDebugInfo()
 	tx.tx.Abort()
 }
 
+func (tx *MdbxTx) reportEnd() {
+	if tx.readOnly {
+		if tx.roEnd != nil {
+			tx.roEnd()
+			tx.roEnd = nil
+		}
+		return
+	}
+	if tx.db.opts.txMetrics != nil {
+		tx.db.opts.txMetrics.WriteTxEnd(time.Since(tx.begin))
+	}
+}
+
 func (tx *MdbxTx) SpaceDirty() (uint64, uint64, error) {
 	txInfo, err := tx.tx.Info(true)
 	if err != nil {
@@ -927,6 +1305,34 @@ func (tx *MdbxTx) GetOne(bucket string, k []byte) ([]byte, error) {
 	return v, err
 }
 
+// GetMany - probes keys in sorted order: neighbour keys share pages of b-tree
+func (tx *MdbxTx) GetMany(bucket string, keys [][]byte) ([][]byte, error) {
+	c, err := tx.statelessCursor(bucket)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(keys[order[i]], keys[order[j]]) < 0 })
+	vals := make([][]byte, len(keys))
+	for _, i := range order {
+		if _, vals[i], err = c.SeekExact(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *MdbxTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
+
 func (tx *MdbxTx) Has(bucket string, key []byte) (bool, error) {
 	c, err := tx.statelessCursor(bucket)
 	if err != nil {
@@ -1018,6 +1424,27 @@ func (tx *MdbxTx) BucketStat(name string) (*mdbx.Stat, error) {
 	return st, nil
 }
 
+func (tx *MdbxTx) TableStats(name string) (kv.TableStats, error) {
+	switch name {
+	case "freelist", "gc", "free_list", "root":
+	default:
+		if cfg, ok := tx.db.buckets[name]; !ok || cfg.DBI == NonExistingDBI {
+			return kv.TableStats{}, fmt.Errorf("table: %s, not found", name)
+		}
+	}
+	st, err := tx.BucketStat(name)
+	if err != nil {
+		return kv.TableStats{}, err
+	}
+	return kv.TableStats{
+		Entries:       st.Entries,
+		LeafPages:     st.LeafPages,
+		BranchPages:   st.BranchPages,
+		OverflowPages: st.OverflowPages,
+		Bytes:         (st.LeafPages + st.BranchPages + st.OverflowPages) * uint64(st.PSize),
+	}, nil
+}
+
 func (tx *MdbxTx) DBSize() (uint64, error) {
 	info, err := tx.db.env.Info(tx.tx)
 	if err != nil {
@@ -1045,6 +1472,9 @@ func (tx *MdbxTx) Cursor(bucket string) (kv.Cursor, error) {
 
 func (tx *MdbxTx) stdCursor(bucket string) (kv.RwCursor, error) {
 	b := tx.db.buckets[bucket]
+	if b.DBI == NonExistingDBI {
+		return nil, fmt.Errorf("table %s: %w", bucket, kv.ErrTableMissing)
+	}
 	c := &MdbxCursor{bucketName: bucket, tx: tx, bucketCfg: b, dbi: mdbx.DBI(tx.db.buckets[bucket].DBI), id: tx.cursorID}
 	tx.cursorID++
 
@@ -17,12 +17,24 @@
 package mdbx
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/stretchr/testify/require"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestSeekBothRange(t *testing.T) {
@@ -174,3 +186,831 @@ func TestIncrementSequence(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, chaV, uint64(0xc))
 }
+
+func TestReadAhead(t *testing.T) {
+	logger := log.New()
+	table := "Table"
+	tablesCfg := func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}}
+	}
+
+	path := t.TempDir()
+	db := NewMDBX(logger).Path(path).WithTablessCfg(tablesCfg).ReadAhead(ReadAheadRandom).MustOpen()
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := byte(0); i < 100; i++ {
+			if err := tx.Put(table, []byte{i}, []byte{i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	db.Close()
+
+	db = NewMDBX(logger).Path(path).WithTablessCfg(tablesCfg).WarmUpTables(table).MustOpen()
+	defer db.Close()
+	require.Equal(t, []string{table}, db.(*MdbxKV).warmupTables())
+	require.NoError(t, db.(*MdbxKV).WarmUp(context.Background(), table))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, db.(*MdbxKV).WarmUp(ctx, table), context.Canceled)
+}
+
+func TestGeometry(t *testing.T) {
+	logger := log.New()
+	db := NewMDBX(logger).Path(t.TempDir()).MapSize(128 * datasize.MB).GrowthStep(8 * datasize.MB).ShrinkThreshold(0).MustOpen()
+	defer db.Close()
+
+	geo, err := db.(*MdbxKV).Geometry()
+	require.NoError(t, err)
+	require.Equal(t, 128*datasize.MB, geo.Upper)
+	require.Equal(t, 8*datasize.MB, geo.GrowthStep)
+	require.Equal(t, uint64(4096), geo.PageSize)
+	require.LessOrEqual(t, geo.Current, geo.Upper)
+
+	step := autoGrowthStep(filepath.Join(t.TempDir(), "not", "existing"), logger)
+	require.LessOrEqual(t, step, maxGrowthStep)
+	require.GreaterOrEqual(t, step, minGrowthStep)
+
+	// growth step is 2Gb if not set, auto-detection is opt-in
+	db = NewMDBX(logger).Path(t.TempDir()).MapSize(16 * datasize.GB).InitialMapSize(32 * datasize.MB).MustOpen()
+	defer db.Close()
+	geo, err = db.(*MdbxKV).Geometry()
+	require.NoError(t, err)
+	require.Equal(t, defaultGrowthStep, geo.GrowthStep)
+	require.GreaterOrEqual(t, geo.Current, 32*datasize.MB)
+}
+
+func TestMigrations(t *testing.T) {
+	path := t.TempDir()
+	logger := log.New()
+	ctx := context.Background()
+	db := NewMDBX(logger).Path(path).WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			"Old":   kv.TableCfgItem{},
+			"Table": kv.TableCfgItem{},
+		}
+	}).MustOpen()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"a", "b"} {
+			if err := tx.Put("Old", []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+			if err := tx.Put("Table", []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		// erigon's migration of same name doesn't mark migration of Migrator as applied
+		if err := tx.CreateBucket(kv.Migrations); err != nil {
+			return err
+		}
+		return tx.Put(kv.Migrations, []byte("table_upper"), []byte{1})
+	}))
+	db.Close()
+
+	upper := func(k, v []byte) ([]byte, error) { return bytes.ToUpper(v), nil }
+	migrator := kv.NewMigrator(
+		kv.RenameTable("rename_old", "Old", "New"),
+		kv.ChangeTableFlags("table_dupsort", "Table"),
+		kv.ReencodeValues("table_upper", "Table", upper),
+	)
+	cfg := func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			"Old":   kv.TableCfgItem{IsDeprecated: true},
+			"New":   kv.TableCfgItem{},
+			"Table": kv.TableCfgItem{Flags: kv.DupSort},
+		}
+	}
+	db = NewMDBX(logger).Path(path).WithTablessCfg(cfg).Migrations(migrator).MustOpen()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		exists, err := tx.ExistsBucket("Old")
+		require.NoError(t, err)
+		require.False(t, exists)
+		v, err := tx.GetOne("New", []byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, "vb", string(v))
+
+		pending, err := migrator.Pending(tx)
+		require.NoError(t, err)
+		require.Empty(t, pending)
+
+		require.NoError(t, tx.Put("Table", []byte("a"), []byte("VA2"))) // table is DupSort now
+		c, err := tx.CursorDupSort("Table")
+		require.NoError(t, err)
+		defer c.Close()
+		_, _, err = c.SeekExact([]byte("a"))
+		require.NoError(t, err)
+		cnt, err := c.CountDuplicates()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), cnt)
+		_, v, err = c.NextNoDup()
+		require.NoError(t, err)
+		require.Equal(t, "VB", string(v))
+		return nil
+	}))
+	db.Close()
+
+	// already applied migrations are not executed again
+	failing := kv.NewMigrator(kv.Migration{Name: "table_upper", Up: func(ctx context.Context, tx kv.RwTx) error {
+		return fmt.Errorf("must not be called")
+	}})
+	db = NewMDBX(logger).Path(path).WithTablessCfg(cfg).Migrations(failing).MustOpen()
+	db.Close()
+
+	// versioned config: new (empty) table gets version of config, not empty table needs migration
+	cfgV2 := func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			"Old":   kv.TableCfgItem{IsDeprecated: true},
+			"New":   kv.TableCfgItem{},
+			"Table": kv.TableCfgItem{Flags: kv.DupSort, Version: 2},
+			"Empty": kv.TableCfgItem{Version: 2},
+		}
+	}
+	_, err := NewMDBX(logger).Path(path).WithTablessCfg(cfgV2).Open()
+	require.ErrorContains(t, err, "migration is not applied")
+	lower := kv.ReencodeValues("table_lower", "Table", func(k, v []byte) ([]byte, error) { return bytes.ToLower(v), nil })
+	db = NewMDBX(logger).Path(path).WithTablessCfg(cfgV2).Migrations(kv.NewMigrator(lower.ToVersion("Table", 2))).MustOpen()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for _, table := range []string{"Table", "Empty"} {
+			version, err := kv.TableVersion(tx, table)
+			require.NoError(t, err)
+			require.Equal(t, uint32(2), version)
+		}
+		v, err := tx.GetOne("Table", []byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, "vb", string(v))
+		return nil
+	}))
+	db.Close()
+
+	// db written by newer version of app
+	_, err = NewMDBX(logger).Path(path).WithTablessCfg(cfg).Readonly().Open()
+	require.ErrorContains(t, err, "is newer than supported")
+}
+
+func TestRenewableTx(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.New()).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{"Table": kv.TableCfgItem{}}
+	}).MustOpen()
+	defer db.Close()
+	put := func(k, v string) {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Table", []byte(k), []byte(v)) }))
+	}
+	put("a", "1")
+
+	tx, err := kv.NewRenewableTx(ctx, db, time.Millisecond)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	v, err := tx.GetOne("Table", []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+
+	// open cursor doesn't allow renew
+	c, err := tx.Cursor("Table")
+	require.NoError(t, err)
+	put("a", "2")
+	time.Sleep(2 * time.Millisecond)
+	v, err = tx.GetOne("Table", []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+	require.Error(t, tx.Renew())
+	require.Greater(t, tx.Age(), time.Millisecond)
+	viewID := tx.ViewID()
+	c.Close()
+	c.Close() // double close is fine
+
+	// next call after close of cursor - renews
+	v, err = tx.GetOne("Table", []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), v)
+	require.Greater(t, tx.ViewID(), viewID)
+
+	// values returned before renew stay valid: pages of old tx are re-used by writers
+	many, err := tx.GetMany("Table", [][]byte{[]byte("a")})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		put("a", fmt.Sprintf("%d", 3+i))
+		time.Sleep(2 * time.Millisecond)
+		require.NoError(t, tx.Renew())
+	}
+	require.Equal(t, []byte("2"), v)
+	require.Equal(t, [][]byte{[]byte("2")}, many)
+
+	tx.Rollback()
+	require.Zero(t, tx.Age())
+	_, err = tx.GetOne("Table", []byte("a"))
+	require.Error(t, err)
+}
+
+func TestCopyTo(t *testing.T) {
+	ctx := context.Background()
+	cfg := func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			"Plain": kv.TableCfgItem{},
+			"Dup":   kv.TableCfgItem{Flags: kv.DupSort},
+			"Fixed": kv.TableCfgItem{Flags: kv.DupSort | kv.DupFixed | kv.ReverseDup},
+			"Rev":   kv.TableCfgItem{Flags: kv.ReverseKey},
+		}
+	}
+	db := NewMDBX(log.New()).Path(t.TempDir()).WithTablessCfg(cfg).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 1000; i++ {
+			if err := tx.Put("Plain", []byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+				return err
+			}
+			if err := tx.Put("Dup", []byte(fmt.Sprintf("%02d", i%10)), []byte(fmt.Sprintf("%04d", i))); err != nil {
+				return err
+			}
+			if err := tx.Put("Fixed", []byte(fmt.Sprintf("%02d", i%10)), []byte(fmt.Sprintf("%04d", i))); err != nil {
+				return err
+			}
+			if err := tx.Put("Rev", []byte(fmt.Sprintf("%04d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	path := filepath.Join(t.TempDir(), "copy")
+	var copied, total uint64
+	require.NoError(t, db.(kv.Copier).CopyTo(ctx, path, true, kv.CopyOpts{
+		Progress: func(c, tot uint64) { copied, total = c, tot },
+	}))
+	require.Equal(t, uint64(4000), total)
+	require.Equal(t, total, copied)
+
+	// copy is usual db with same tables
+	cp := NewMDBX(log.New()).Path(path).WithTablessCfg(cfg).Readonly().MustOpen()
+	defer cp.Close()
+	require.NoError(t, cp.View(ctx, func(tx kv.Tx) error {
+		for _, table := range []string{"Plain", "Dup", "Fixed", "Rev"} {
+			require.Equal(t, cfg(nil)[table].Flags, cp.(*MdbxKV).buckets[table].Flags)
+			var expected, got [][]byte
+			if err := db.View(ctx, func(srcTx kv.Tx) error {
+				return srcTx.ForEach(table, nil, func(k, v []byte) error {
+					expected = append(expected, append(common.Copy(k), v...))
+					return nil
+				})
+			}); err != nil {
+				return err
+			}
+			if err := tx.ForEach(table, nil, func(k, v []byte) error {
+				got = append(got, append(common.Copy(k), v...))
+				return nil
+			}); err != nil {
+				return err
+			}
+			require.Equal(t, 1000, len(got))
+			require.Equal(t, expected, got)
+		}
+		return nil
+	}))
+
+	require.Error(t, db.(kv.Copier).CopyTo(ctx, path, true, kv.CopyOpts{})) // not empty
+	require.ErrorIs(t, db.(kv.Copier).CopyTo(ctx, t.TempDir(), false, kv.CopyOpts{}), kv.ErrNotSupported)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	path2 := filepath.Join(t.TempDir(), "canceled")
+	require.ErrorIs(t, db.(kv.Copier).CopyTo(canceled, path2, true, kv.CopyOpts{RateLimit: 1}), context.Canceled)
+}
+
+func TestSyncMode(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir()
+	db := NewMDBX(log.New()).Path(path).SyncMode(SyncSafeNoSync).SyncPeriod(time.Second).SyncBytes(datasize.MB).MustOpen()
+	flags, err := db.(*MdbxKV).Env().Flags()
+	require.NoError(t, err)
+	require.NotZero(t, flags&mdbx.SafeNoSync)
+	syncBytes, err := db.(*MdbxKV).Env().GetOption(mdbx.OptSyncBytes)
+	require.NoError(t, err)
+	require.Equal(t, uint64(datasize.MB), syncBytes)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte("k"), []byte("v"))
+	}))
+	require.NoError(t, db.(*MdbxKV).Sync())
+	db.Close()
+
+	db = NewMDBX(log.New()).Path(path).MustOpen()
+	defer db.Close()
+	flags, err = db.(*MdbxKV).Env().Flags()
+	require.NoError(t, err)
+	require.Zero(t, flags&mdbx.SafeNoSync)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne(kv.HeaderNumber, []byte("k"))
+		require.Equal(t, []byte("v"), v)
+		return err
+	}))
+}
+
+type testTxMetrics struct {
+	roOpen, roClosed, rwEnded, commits int
+	commitBytes                        uint64
+}
+
+func (m *testTxMetrics) ReadTxBegin() func() {
+	m.roOpen++
+	return func() { m.roClosed++ }
+}
+func (m *testTxMetrics) WriteTxEnd(time.Duration) { m.rwEnded++ }
+func (m *testTxMetrics) Committed(_ time.Duration, bytes uint64) {
+	m.commits++
+	m.commitBytes += bytes
+}
+
+func TestTxMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := &testTxMetrics{}
+	db := NewMDBX(log.New()).InMem().TxMetrics(m).MustOpen()
+	defer db.Close()
+	*m = testTxMetrics{} // forget transactions of Open
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte("k"), make([]byte, 1024))
+	}))
+	require.Equal(t, 1, m.commits)
+	require.Equal(t, 1, m.rwEnded)
+	require.NotZero(t, m.commitBytes)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, m.roOpen)
+	require.Zero(t, m.roClosed)
+	require.NoError(t, tx.Commit())
+	tx.Rollback() // no-op after commit
+	require.Equal(t, 1, m.roClosed)
+
+	rwTx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	rwTx.Rollback()
+	require.Equal(t, 2, m.rwEnded)
+	require.Equal(t, 1, m.commits)
+
+	// metrics are opt-in
+	noMetrics := NewMDBX(log.New()).InMem().MustOpen()
+	defer noMetrics.Close()
+	require.Nil(t, noMetrics.(*MdbxKV).opts.txMetrics)
+	require.NoError(t, noMetrics.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte("k"), []byte("v"))
+	}))
+
+	// default metrics: 1 instance per label
+	txMetrics := kv.NewTxMetrics(kv.DownloaderDB)
+	require.Equal(t, txMetrics, kv.NewTxMetrics(kv.DownloaderDB))
+	end := txMetrics.ReadTxBegin()
+	time.Sleep(time.Millisecond)
+	type readers interface {
+		ReadTxsOpen() int
+		OldestReadTxAge() time.Duration
+	}
+	require.Equal(t, 1, txMetrics.(readers).ReadTxsOpen())
+	require.GreaterOrEqual(t, txMetrics.(readers).OldestReadTxAge(), time.Millisecond)
+	end()
+	require.Zero(t, txMetrics.(readers).ReadTxsOpen())
+	require.Zero(t, txMetrics.(readers).OldestReadTxAge())
+}
+
+func TestStuckReaderDetector(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.New()).InMem().StuckReaderDetector(10 * time.Millisecond).MustOpen()
+	defer db.Close()
+	watchdog := db.(*MdbxKV).ReaderWatchdog()
+	require.NotNil(t, watchdog)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	require.Empty(t, watchdog.Stuck())
+	time.Sleep(20 * time.Millisecond)
+	stuck := watchdog.Stuck()
+	require.Equal(t, 1, len(stuck))
+	require.Contains(t, stuck[0].Stack, "kv_mdbx_test.go")
+	tx.Rollback()
+	require.Empty(t, watchdog.Stuck())
+
+	// each stuck tx is reported once
+	m := &testTxMetrics{}
+	w := kv.NewReaderWatchdog(m, time.Millisecond, log.New())
+	end := w.ReadTxBegin()
+	time.Sleep(2 * time.Millisecond)
+	require.Equal(t, 1, w.Check())
+	require.Zero(t, w.Check())
+	end()
+	require.Equal(t, 1, m.roClosed)
+
+	noWatchdog := NewMDBX(log.New()).InMem().MustOpen()
+	defer noWatchdog.Close()
+	require.Nil(t, noWatchdog.(*MdbxKV).ReaderWatchdog())
+
+	// threshold/2 is 0: period of checks is clamped
+	tinyThreshold := NewMDBX(log.New()).InMem().StuckReaderDetector(time.Nanosecond).MustOpen()
+	time.Sleep(2 * time.Millisecond)
+	tinyThreshold.Close()
+}
+
+func TestTTLJanitor(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.New()).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{
+			"Peers": kv.TableCfgItem{TTL: time.Hour},
+			"Plain": kv.TableCfgItem{},
+		}
+	}).MustOpen()
+	defer db.Close()
+
+	now := time.Now()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 25; i++ {
+			k := kv.TTLKey(now.Add(-2*time.Hour), []byte(fmt.Sprintf("old%02d", i)))
+			if err := tx.Put("Peers", k, []byte("v")); err != nil {
+				return err
+			}
+		}
+		if err := tx.Put("Peers", kv.TTLKey(now, []byte("fresh")), []byte("v")); err != nil {
+			return err
+		}
+		return tx.Put("Plain", []byte("k"), []byte("v"))
+	}))
+
+	j := kv.NewTTLJanitor(db, 10)
+	require.Equal(t, []string{"Peers"}, j.Tables())
+	deleted, err := j.Prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 25, deleted)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		var keys []string
+		if err := tx.ForEach("Peers", nil, func(k, v []byte) error {
+			_, key, err := kv.ParseTTLKey(k)
+			keys = append(keys, string(key))
+			return err
+		}); err != nil {
+			return err
+		}
+		require.Equal(t, []string{"fresh"}, keys)
+		has, err := tx.Has("Plain", []byte("k"))
+		require.True(t, has)
+		return err
+	}))
+
+	deleted, err = j.Prune(ctx)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestExporter(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.New()).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{"A": kv.TableCfgItem{}, "B": kv.TableCfgItem{Flags: kv.DupSort}}
+	}).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put("A", []byte{1}, []byte("x,y")))
+		require.NoError(t, tx.Put("A", []byte{2}, []byte("z")))
+		require.NoError(t, tx.Put("B", []byte{1}, []byte{0xff}))
+		return tx.Put("B", []byte{1}, []byte{0xfe})
+	}))
+
+	var buf bytes.Buffer
+	n, err := kv.NewExporter(db, kv.ExportOpts{ValueEncoding: kv.EncodingString}).Export(ctx, &buf, "A")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+	require.Equal(t, "table,key,value\nA,01,\"x,y\"\nA,02,z\n", buf.String())
+
+	buf.Reset()
+	n, err = kv.NewExporter(db, kv.ExportOpts{Format: kv.ExportJSONL, Limit: 1}).Export(ctx, &buf, "A", "B")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+	require.Equal(t, `{"table":"A","key":"01","value":"782c79"}`+"\n"+`{"table":"B","key":"01","value":"fe"}`+"\n", buf.String())
+
+	_, err = kv.NewExporter(db, kv.ExportOpts{Format: "xml"}).Export(ctx, &buf, "A")
+	require.Error(t, err)
+}
+
+func TestTablesDiff(t *testing.T) {
+	path := t.TempDir()
+	logger := log.New()
+	cfg := func(tables kv.TableCfg) TableCfgFunc {
+		return func(defaultBuckets kv.TableCfg) kv.TableCfg { return tables }
+	}
+	db := NewMDBX(logger).Path(path).WithTablessCfg(cfg(kv.TableCfg{"A": {}, "B": {Flags: kv.DupSort}})).MustOpen()
+	require.Equal(t, []string{"A", "B"}, db.(*MdbxKV).TablesDiff().Created)
+	require.True(t, db.(*MdbxKV).TablesDiff().Empty())
+	db.Close()
+
+	// new table is created, changed flags are reported - and flags of db are used
+	changed := cfg(kv.TableCfg{"A": {Flags: kv.DupSort}, "B": {Flags: kv.DupSort}, "C": {}})
+	db = NewMDBX(logger).Path(path).WithTablessCfg(changed).MustOpen()
+	diff := db.(*MdbxKV).TablesDiff()
+	require.Equal(t, []string{"C"}, diff.Created)
+	require.Equal(t, []kv.TableFlagsMismatch{{Table: "A", Declared: kv.DupSort, Actual: kv.Default}}, diff.FlagsMismatch)
+	require.Equal(t, "created=[C]; A: declared flags=DupSort, in db=Default", diff.String())
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.Put("A", []byte("k"), []byte("v1")); err != nil {
+			return err
+		}
+		return tx.Put("A", []byte("k"), []byte("v2"))
+	}))
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		v, err := tx.GetOne("A", []byte("k"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v2"), v)
+		return nil
+	}))
+	db.Close()
+
+	_, err := NewMDBX(logger).Path(path).WithTablessCfg(changed).VerifyTables().Open()
+	var diffErr *kv.TablesDiffError
+	require.ErrorAs(t, err, &diffErr)
+	require.Equal(t, "A", diffErr.Diff.FlagsMismatch[0].Table)
+
+	// read-only db can't create tables: they are reported and access to them fails with clear error
+	db = NewMDBX(logger).Path(path).Follower().WithTablessCfg(cfg(kv.TableCfg{"B": {Flags: kv.DupSort}, "D": {}})).MustOpen()
+	defer db.Close()
+	require.Equal(t, []string{"D"}, db.(*MdbxKV).TablesDiff().Missing)
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		_, err := tx.GetOne("D", []byte("k"))
+		require.ErrorIs(t, err, kv.ErrTableMissing)
+		_, err = tx.GetOne("B", []byte("k"))
+		require.NoError(t, err)
+		return nil
+	}))
+}
+
+func TestDeleteRange(t *testing.T) {
+	logger := log.New()
+	table, dupTable := "Table", "DupTable"
+	db := NewMDBX(logger).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}, dupTable: kv.TableCfgItem{Flags: kv.DupSort}}
+	}).MustOpen()
+	defer db.Close()
+
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for _, k := range []string{"a", "b1", "b2", "c", "d"} {
+		require.NoError(t, tx.Put(table, []byte(k), []byte("v"+k)))
+		require.NoError(t, tx.Put(dupTable, []byte(k), []byte("1")))
+		require.NoError(t, tx.Put(dupTable, []byte(k), []byte("2")))
+	}
+	keys := func(table string) (res []string) {
+		require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+			res = append(res, string(k)+string(v))
+			return nil
+		}))
+		return res
+	}
+
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(table, []byte("b"), []byte("c")))
+	require.Equal(t, []string{"ava", "cvc", "dvd"}, keys(table))
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(dupTable, []byte("b"), []byte("c")))
+	require.Equal(t, []string{"a1", "a2", "c1", "c2", "d1", "d2"}, keys(dupTable))
+
+	// till end of table
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(dupTable, []byte("c"), nil))
+	require.Equal(t, []string{"a1", "a2"}, keys(dupTable))
+	// empty range
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(table, []byte("x"), nil))
+	require.Equal(t, []string{"ava", "cvc", "dvd"}, keys(table))
+	// whole table
+	require.NoError(t, tx.(kv.RangeDeleter).DeleteRange(table, nil, nil))
+	require.Empty(t, keys(table))
+}
+
+func TestTelemetry(t *testing.T) {
+	logger := log.New()
+	table := "Table"
+	db := NewMDBX(logger).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}}
+	}).MustOpen().(*MdbxKV)
+	defer db.Close()
+	ctx := context.Background()
+
+	before, err := db.Telemetry(table, "NotExisting")
+	require.NoError(t, err)
+	require.Contains(t, before.Tables, table)
+	require.NotContains(t, before.Tables, "NotExisting")
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, tx.Put(table, []byte(fmt.Sprintf("key%05d", i)), bytes.Repeat([]byte{1}, 100)))
+	}
+	txt, err := tx.(*MdbxTx).TxTelemetry()
+	require.NoError(t, err)
+	require.Greater(t, txt.Dirty, uint64(0))
+	require.NoError(t, tx.Commit())
+
+	after, err := db.Telemetry(table)
+	require.NoError(t, err)
+	diff := after.Sub(before)
+	require.Greater(t, diff.PageOps.Written(), uint64(0))
+	require.Greater(t, diff.Tables[table].Pages, int64(0))
+	require.Equal(t, int64(1000), diff.Tables[table].Entries)
+	require.Equal(t, uint64(1), diff.Txs.Rw)
+	require.Equal(t, uint64(1), diff.Txs.Committed)
+	require.Equal(t, uint64(1), diff.Txs.Ro) // read tx of `before` snapshot
+}
+
+func TestCommitHooks(t *testing.T) {
+	logger := log.New()
+	table := "Table"
+	db := NewMDBX(logger).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}}
+	}).MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	has := func(k string) bool {
+		var ok bool
+		require.NoError(t, db.View(ctx, func(tx kv.Tx) (err error) {
+			ok, err = tx.Has(table, []byte(k))
+			return err
+		}))
+		return ok
+	}
+
+	var calls []string
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		hooks := tx.(kv.CommitHooks)
+		hooks.PostCommit(func() { calls = append(calls, "post1") })
+		hooks.PostCommit(func() { panic("boom") })
+		hooks.PostCommit(func() { calls = append(calls, "post3") })
+		hooks.PreCommit(func() error {
+			calls = append(calls, "pre")
+			return tx.Put(table, []byte("journal"), []byte("1")) // atomically with tx
+		})
+		return tx.Put(table, []byte("a"), []byte("1"))
+	}))
+	require.Equal(t, []string{"pre", "post1", "post3"}, calls)
+	require.True(t, has("journal"))
+
+	// error of pre-commit hook aborts commit
+	calls = nil
+	myErr := fmt.Errorf("cache flush failed")
+	err := db.Update(ctx, func(tx kv.RwTx) error {
+		tx.(kv.CommitHooks).PreCommit(func() error { return myErr })
+		tx.(kv.CommitHooks).PostCommit(func() { calls = append(calls, "post") })
+		return tx.Put(table, []byte("b"), []byte("1"))
+	})
+	require.ErrorIs(t, err, myErr)
+	require.False(t, has("b"))
+	require.Empty(t, calls)
+
+	// panic of pre-commit hook aborts commit too
+	err = db.Update(ctx, func(tx kv.RwTx) error {
+		tx.(kv.CommitHooks).PreCommit(func() error { panic("boom") })
+		return tx.Put(table, []byte("c"), []byte("1"))
+	})
+	require.ErrorIs(t, err, kv.ErrHookPanic)
+	require.False(t, has("c"))
+
+	// rollback drops hooks
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	tx.(kv.CommitHooks).PostCommit(func() { calls = append(calls, "post") })
+	tx.Rollback()
+	require.NoError(t, tx.Commit())
+	require.Empty(t, calls)
+}
+
+func TestParallelScan(t *testing.T) {
+	logger := log.New()
+	table := "Table"
+	db := NewMDBX(logger).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}}
+	}).MustOpen().(*MdbxKV)
+	defer db.Close()
+	ctx := context.Background()
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		ranges, err := tx.(*MdbxTx).SplitTable(table, 4)
+		require.NoError(t, err)
+		require.Nil(t, ranges)
+		return nil
+	}))
+
+	const total = 10_000
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		k := make([]byte, 8)
+		for i := uint64(0); i < total; i++ {
+			binary.BigEndian.PutUint64(k, i*0x9E3779B97F4A7C15) // spread keys like hashes
+			if err := tx.Put(table, k, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var ranges []KeyRange
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) (err error) {
+		ranges, err = tx.(*MdbxTx).SplitTable(table, 4)
+		return err
+	}))
+	require.Len(t, ranges, 4)
+	require.Nil(t, ranges[len(ranges)-1].To)
+	for i := 1; i < len(ranges); i++ {
+		require.Equal(t, ranges[i-1].To, ranges[i].From)
+	}
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	require.NoError(t, ParallelScan(ctx, db, table, 4, func(tx kv.Tx, r KeyRange) error {
+		it, err := kv.Range(tx, table, r.From, r.To)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for it.HasNext() {
+			if _, _, err := it.Next(); err != nil {
+				return err
+			}
+			n++
+		}
+		mu.Lock()
+		counts[string(r.From)] = n
+		mu.Unlock()
+		return nil
+	}))
+	sum := 0
+	for _, n := range counts {
+		require.Greater(t, n, total/8) // approximately equal
+		sum += n
+	}
+	require.Equal(t, total, sum)
+
+	errStop := fmt.Errorf("stop")
+	require.ErrorIs(t, ParallelScan(ctx, db, table, 4, func(tx kv.Tx, r KeyRange) error { return errStop }), errStop)
+}
+
+// TestFollowerWriter - writer process of TestFollower: MDBX doesn't allow to open same env twice in one process
+func TestFollowerWriter(t *testing.T) {
+	path := os.Getenv("FOLLOWER_TEST_PATH")
+	if path == "" {
+		t.Skip("runs as child process of TestFollower")
+	}
+	db := NewMDBX(log.New()).Path(path).MapSize(64 * datasize.MB).WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{"Table": kv.TableCfgItem{}}
+	}).MustOpen()
+	defer db.Close()
+	k := os.Getenv("FOLLOWER_TEST_KEY")
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error { return tx.Put("Table", []byte(k), []byte(k)) }))
+}
+
+func TestFollower(t *testing.T) {
+	logger := log.New()
+	table := "Table"
+	path := t.TempDir()
+	write := func(k string) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFollowerWriter$")
+		cmd.Env = append(os.Environ(), "FOLLOWER_TEST_PATH="+path, "FOLLOWER_TEST_KEY="+k)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write("k1")
+	ctx := context.Background()
+
+	db := NewMDBX(logger).Path(path).Follower().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return kv.TableCfg{table: kv.TableCfgItem{}}
+	}).MustOpen()
+	defer db.Close()
+	f, err := kv.NewFollower(ctx, db)
+	require.NoError(t, err)
+	defer f.Close()
+
+	changed, err := f.Refresh()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	write("k2")
+	require.NoError(t, f.View(func(tx kv.Tx) error {
+		v, err := tx.GetOne(table, []byte("k2"))
+		require.NoError(t, err)
+		require.Nil(t, v) // old view
+		return nil
+	}))
+
+	pollCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	errSeen := fmt.Errorf("seen")
+	err = f.Poll(pollCtx, time.Millisecond, func(tx kv.Tx) error {
+		v, err := tx.GetOne(table, []byte("k2"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("k2"), v)
+		return errSeen
+	})
+	require.ErrorIs(t, err, errSeen)
+	require.Error(t, f.Poll(pollCtx, 0, func(tx kv.Tx) error { return nil })) // doesn't panic
+
+	// concurrent View calls share tx of follower
+	var g errgroup.Group
+	for i := 0; i < 4; i++ {
+		g.Go(func() error {
+			return f.View(func(tx kv.Tx) error {
+				return tx.ForEach(table, nil, func(k, v []byte) error { return nil })
+			})
+		})
+	}
+	require.NoError(t, g.Wait())
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"golang.org/x/sync/errgroup"
+)
+
+// KeyRange - keys [From, To) of table, nil To - till the end of table. Fits kv.Tx.Range
+type KeyRange struct {
+	From, To []byte
+}
+
+// SplitTable - splits keys of table into at most n ranges of approximately equal size.
+// MDBX doesn't count keys below position, so borders are interpolated between first and last key:
+// ranges are equal for uniformly distributed keys (hashes, addresses) - which is the case of big tables.
+// Number of ranges is limited by number of leaf pages of table: range smaller than page isn't worth own tx.
+// Empty table has no ranges
+func (tx *MdbxTx) SplitTable(table string, n int) ([]KeyRange, error) {
+	st, err := tx.BucketStat(table)
+	if err != nil {
+		return nil, err
+	}
+	if st.Entries == 0 {
+		return nil, nil
+	}
+	if n < 1 {
+		n = 1
+	}
+	if uint64(n) > st.LeafPages {
+		n = int(st.LeafPages)
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	first, _, err := c.First()
+	if err != nil {
+		return nil, err
+	}
+	first = common.Copy(first)
+	last, _, err := c.Last()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := commonPrefixLen(first, last)
+	lo, hi := prefix64(first[prefix:]), prefix64(last[prefix:])
+	step := (hi - lo) / uint64(n)
+	probe := make([]byte, prefix+8)
+	copy(probe, first[:prefix])
+
+	ranges := make([]KeyRange, 0, n)
+	from := first
+	for i := 1; i < n && step > 0; i++ {
+		binary.BigEndian.PutUint64(probe[prefix:], lo+step*uint64(i))
+		k, _, err := c.Seek(probe)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil || bytes.Compare(k, from) <= 0 {
+			continue
+		}
+		k = common.Copy(k)
+		ranges = append(ranges, KeyRange{From: from, To: k})
+		from = k
+	}
+	return append(ranges, KeyRange{From: from}), nil
+}
+
+func commonPrefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// prefix64 - first 8 bytes of key as number, shorter key is padded by zeroes
+func prefix64(k []byte) uint64 {
+	var buf [8]byte
+	copy(buf[:], k)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// ParallelScan - calls f for each range of SplitTable(table, n) in own goroutine and read tx, for full scans
+// of big tables (ETL) on many cores. First error cancels ctx of not started txs and is returned.
+// MDBX can't open several read txs on same view: if db is written during scan - ranges may see different views.
+// Number of concurrently open txs is limited by roTxsLimiter of db
+func ParallelScan(ctx context.Context, db *MdbxKV, table string, n int, f func(tx kv.Tx, r KeyRange) error) error {
+	var ranges []KeyRange
+	if err := db.View(ctx, func(tx kv.Tx) (err error) {
+		ranges, err = tx.(*MdbxTx).SplitTable(table, n)
+		return err
+	}); err != nil {
+		return err
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for _, r := range ranges {
+		r := r
+		g.Go(func() error {
+			return db.View(ctx, func(tx kv.Tx) error { return f(tx, r) })
+		})
+	}
+	return g.Wait()
+}
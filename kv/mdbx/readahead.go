@@ -0,0 +1,135 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// ReadAheadPolicy - hint to OS about expected access pattern of db pages.
+//
+// MDBX maps all tables into one memory region (tables pages are interleaved), so
+// policy can be applied only to whole environment. Use MdbxOpts.WarmUpTables to pre-load pages of some tables.
+type ReadAheadPolicy uint8
+
+const (
+	ReadAheadDefault  ReadAheadPolicy = iota // keep flags as-is (by default mdbx.NoReadahead is set)
+	ReadAheadRandom                          // MADV_RANDOM: point-lookups (RPC), disables kernel readahead
+	ReadAheadWillNeed                        // MADV_WILLNEED: readahead enabled + warm-up of pages after db open
+)
+
+func (p ReadAheadPolicy) String() string {
+	switch p {
+	case ReadAheadDefault:
+		return "default"
+	case ReadAheadRandom:
+		return "random"
+	case ReadAheadWillNeed:
+		return "willneed"
+	default:
+		return "unknown"
+	}
+}
+
+// applyReadAhead - translates env-wide policy to mdbx flags
+func applyReadAhead(flags uint, p ReadAheadPolicy) uint {
+	switch p {
+	case ReadAheadRandom:
+		return flags | mdbx.NoReadahead
+	case ReadAheadWillNeed:
+		return flags &^ mdbx.NoReadahead
+	default:
+		return flags
+	}
+}
+
+// warmupTables - returns list of tables which pages must be pre-loaded after db open
+func (db *MdbxKV) warmupTables() []string {
+	if db.opts.readAhead == ReadAheadWillNeed {
+		return bucketSlice(db.buckets)
+	}
+	return db.opts.warmupTables
+}
+
+// WarmUp - touches all pages of table, to load them into OS page cache. Restarts read transaction every minute
+// to not prevent db from growing.
+func (db *MdbxKV) WarmUp(ctx context.Context, table string) error {
+	if cfg, ok := db.buckets[table]; !ok || cfg.IsDeprecated || cfg.DBI == NonExistingDBI {
+		return nil
+	}
+	var from []byte
+	renewEvery := time.NewTicker(time.Minute)
+	defer renewEvery.Stop()
+	for {
+		var done bool
+		if err := db.View(ctx, func(tx kv.Tx) error {
+			c, err := tx.Cursor(table)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			k, _, err := c.Seek(from)
+			for ; k != nil && err == nil; k, _, err = c.Next() {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-renewEvery.C:
+					from = append(from[:0], k...)
+					return nil
+				default:
+				}
+			}
+			if err != nil {
+				return err
+			}
+			done = true
+			return nil
+		}); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func (db *MdbxKV) startWarmup(tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	db.warmupCancel = cancel
+	db.warmupWg.Add(1)
+	go func() {
+		defer db.warmupWg.Done()
+		defer cancel()
+		start := time.Now()
+		for _, name := range tables {
+			if err := db.WarmUp(ctx, name); err != nil {
+				if ctx.Err() == nil {
+					db.log.Warn("[db] warm-up failed", "label", db.opts.label.String(), "table", name, "err", err)
+				}
+				return
+			}
+		}
+		db.log.Debug("[db] warm-up done", "label", db.opts.label.String(), "tables", len(tables), "took", time.Since(start))
+	}()
+}
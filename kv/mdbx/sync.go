@@ -0,0 +1,68 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// SyncMode - durability vs write throughput. Modes without fsync on each commit
+// are usually combined with SyncPeriod/SyncBytes - then at most period/bytes of commits can be lost.
+type SyncMode uint8
+
+const (
+	SyncDefault       SyncMode = iota // keep flags as-is (Durable, or no-sync modes of InMem)
+	SyncDurable                       // fsync on each commit: no data loss
+	SyncNoMetaSync                    // meta-page is not fsync'ed: last commit can be lost after OS crash, db is not corrupted
+	SyncSafeNoSync                    // no fsync on commit: last commits can be lost after OS crash, db is not corrupted
+	SyncUtterlyNoSync                 // no fsync at all: db can be corrupted after OS crash (or even process crash if WriteMap)
+)
+
+const syncFlags = mdbx.NoMetaSync | mdbx.SafeNoSync | mdbx.UtterlyNoSync
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncDefault:
+		return "default"
+	case SyncDurable:
+		return "durable"
+	case SyncNoMetaSync:
+		return "nometasync"
+	case SyncSafeNoSync:
+		return "safenosync"
+	case SyncUtterlyNoSync:
+		return "utterlynosync"
+	default:
+		return "unknown"
+	}
+}
+
+// applySyncMode - replaces sync-related mdbx flags
+func applySyncMode(flags uint, m SyncMode) uint {
+	switch m {
+	case SyncDurable:
+		return flags&^syncFlags | mdbx.Durable
+	case SyncNoMetaSync:
+		return flags&^syncFlags | mdbx.NoMetaSync
+	case SyncSafeNoSync:
+		return flags&^syncFlags | mdbx.SafeNoSync
+	case SyncUtterlyNoSync:
+		return flags&^syncFlags | mdbx.UtterlyNoSync
+	default:
+		return flags
+	}
+}
@@ -0,0 +1,195 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/torquem-ch/mdbx-go/mdbx"
+	"go.uber.org/atomic"
+)
+
+// PageOps - counters of page operations of all transactions since environment was opened by first process
+type PageOps struct {
+	Newly   uint64 // new pages added
+	Cow     uint64 // pages copied for update
+	Clone   uint64 // parent's dirty pages cloned for nested transactions
+	Split   uint64
+	Merge   uint64
+	Spill   uint64 // dirty pages spilled to disk before commit
+	Unspill uint64 // spilled pages loaded back
+	Wops    uint64 // explicit write operations (not pages) to disk
+}
+
+func (p PageOps) Sub(prev PageOps) PageOps {
+	return PageOps{
+		Newly: p.Newly - prev.Newly, Cow: p.Cow - prev.Cow, Clone: p.Clone - prev.Clone,
+		Split: p.Split - prev.Split, Merge: p.Merge - prev.Merge,
+		Spill: p.Spill - prev.Spill, Unspill: p.Unspill - prev.Unspill, Wops: p.Wops - prev.Wops,
+	}
+}
+
+// Written - pages written by write transactions: write amplification is Written * page size / bytes of user data
+func (p PageOps) Written() uint64 { return p.Newly + p.Cow + p.Clone + p.Spill }
+
+// TablePages - b-tree of table
+type TablePages struct {
+	Depth    uint
+	Branch   uint64
+	Leaf     uint64
+	Overflow uint64
+	Entries  uint64
+}
+
+func (t TablePages) Pages() uint64 { return t.Branch + t.Leaf + t.Overflow }
+
+// TxCounters - transactions of this MdbxKV since Open
+type TxCounters struct {
+	Ro           uint64
+	Rw           uint64
+	Committed    uint64 // write transactions
+	CommitErrors uint64
+	RoWaits      uint64 // BeginRo had to wait for free slot of read transactions limiter (see MdbxOpts.RoTxsLimiter) and re-try
+}
+
+func (c TxCounters) Sub(prev TxCounters) TxCounters {
+	return TxCounters{Ro: c.Ro - prev.Ro, Rw: c.Rw - prev.Rw, Committed: c.Committed - prev.Committed,
+		CommitErrors: c.CommitErrors - prev.CommitErrors, RoWaits: c.RoWaits - prev.RoWaits}
+}
+
+type txCounters struct {
+	ro, rw, committed, commitErrors, roWaits atomic.Uint64
+}
+
+func (c *txCounters) load() TxCounters {
+	return TxCounters{Ro: c.ro.Load(), Rw: c.rw.Load(), Committed: c.committed.Load(), CommitErrors: c.commitErrors.Load(), RoWaits: c.roWaits.Load()}
+}
+
+// Telemetry - snapshot of MDBX internals. Difference of 2 snapshots (see Sub) attributes page ops
+// and growth of tables to work done between them (stage, prune, ...)
+type Telemetry struct {
+	PageSize uint64
+	FileSize uint64
+	LastTxID uint64
+	Readers  uint
+	PageOps  PageOps
+	GC       TablePages            // free-list. Its Entries are transactions which freed pages, not pages
+	Tables   map[string]TablePages // only requested tables
+	Txs      TxCounters
+}
+
+// Telemetry - snapshot of db and of given tables (which don't exist in db are skipped). Opens read transaction
+func (db *MdbxKV) Telemetry(tables ...string) (*Telemetry, error) {
+	tx, err := db.BeginRo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return tx.(*MdbxTx).Telemetry(tables...)
+}
+
+// Telemetry - snapshot as seen by this transaction
+func (tx *MdbxTx) Telemetry(tables ...string) (*Telemetry, error) {
+	info, err := tx.db.env.Info(tx.tx)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+	t := &Telemetry{
+		PageSize: tx.db.opts.pageSize,
+		FileSize: info.Geo.Current,
+		LastTxID: uint64(info.LastTxnID),
+		Readers:  info.NumReaders,
+		PageOps:  PageOps(info.PageOps),
+		Tables:   make(map[string]TablePages, len(tables)),
+		Txs:      tx.db.txCounters.load(),
+	}
+	gc, err := tx.BucketStat("gc")
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+	t.GC = tablePages(gc)
+	for _, name := range tables {
+		if cfg, ok := tx.db.buckets[name]; !ok || cfg.DBI == NonExistingDBI {
+			continue
+		}
+		st, err := tx.BucketStat(name)
+		if err != nil {
+			return nil, fmt.Errorf("telemetry: %w", err)
+		}
+		t.Tables[name] = tablePages(st)
+	}
+	return t, nil
+}
+
+func tablePages(st *mdbx.Stat) TablePages {
+	return TablePages{Depth: st.Depth, Branch: st.BranchPages, Leaf: st.LeafPages, Overflow: st.OverflowPages, Entries: st.Entries}
+}
+
+// TelemetryDiff - work done between 2 snapshots
+type TelemetryDiff struct {
+	PageOps  PageOps
+	FileSize int64
+	GCPages  int64
+	Tables   map[string]TableDiff
+	Txs      TxCounters
+}
+
+// TableDiff - growth (negative - shrink) of table
+type TableDiff struct {
+	Pages   int64
+	Entries int64
+}
+
+// Sub - difference with older snapshot. Tables which are not in both snapshots are skipped
+func (t *Telemetry) Sub(prev *Telemetry) TelemetryDiff {
+	d := TelemetryDiff{
+		PageOps:  t.PageOps.Sub(prev.PageOps),
+		FileSize: int64(t.FileSize) - int64(prev.FileSize),
+		GCPages:  int64(t.GC.Pages()) - int64(prev.GC.Pages()),
+		Tables:   make(map[string]TableDiff, len(t.Tables)),
+		Txs:      t.Txs.Sub(prev.Txs),
+	}
+	for name, cur := range t.Tables {
+		old, ok := prev.Tables[name]
+		if !ok {
+			continue
+		}
+		d.Tables[name] = TableDiff{Pages: int64(cur.Pages()) - int64(old.Pages()), Entries: int64(cur.Entries) - int64(old.Entries)}
+	}
+	return d
+}
+
+// TxTelemetry - space usage of transaction (bytes)
+type TxTelemetry struct {
+	Dirty    uint64 // write tx: dirty pages generated by this transaction
+	Retired  uint64 // write tx: pages retired by copy-on-write. Read tx: pages retired by writers after its snapshot
+	Leftover uint64 // write tx: space left until MDBX_TXN_FULL
+	Spill    uint64 // write tx: dirty pages spilled to disk
+	Unspill  uint64
+	ReadLag  uint64 // read tx: amount of transactions committed after its snapshot
+}
+
+// TxTelemetry - of this transaction. Scans readers table: not for hot path
+func (tx *MdbxTx) TxTelemetry() (TxTelemetry, error) {
+	info, err := tx.tx.Info(true)
+	if err != nil {
+		return TxTelemetry{}, fmt.Errorf("telemetry: %w", err)
+	}
+	return TxTelemetry{Dirty: info.SpaceDirty, Retired: info.SpaceRetired, Leftover: info.SpaceLeftover,
+		Spill: info.Spill, Unspill: info.Unspill, ReadLag: info.ReadLag}, nil
+}
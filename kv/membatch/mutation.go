@@ -0,0 +1,287 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package membatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// item - pending change. deleted==true means "tombstone": key will be removed from underlying tx on Flush
+type item struct {
+	table   string
+	key     []byte
+	val     []byte
+	deleted bool
+}
+
+func itemLess(a, b *item) bool {
+	if a.table != b.table {
+		return strings.Compare(a.table, b.table) < 0
+	}
+	return bytes.Compare(a.key, b.key) < 0
+}
+
+const itemOverhead = int(unsafe.Sizeof(item{})) + 16 // + btree node pointers
+
+// Mutation - buffers Puts/Deletes in memory (sorted by table and key) on top of RwTx.
+// Reads (including cursors) see merged view: pending changes + underlying tx.
+// Flush - does write all changes to underlying tx in one pass (in sorted order).
+// Designed for non-DupSort tables. Not thread-safe.
+//
+// Common pattern:
+//
+//	batch := membatch.NewMutation(tx)
+//	defer batch.Rollback()
+//	... some calculations on `batch`
+//	if err := batch.Flush(ctx); err != nil {
+//		return err
+//	}
+type Mutation struct {
+	puts   *btree.BTreeG[*item]
+	tx     kv.RwTx
+	search *item
+	size   int
+}
+
+var _ kv.StatelessRwTx = (*Mutation)(nil)
+
+func NewMutation(tx kv.RwTx) *Mutation {
+	return &Mutation{
+		puts:   btree.NewG[*item](32, itemLess),
+		tx:     tx,
+		search: &item{},
+	}
+}
+
+func (m *Mutation) getMem(table string, key []byte) (*item, bool) {
+	m.search.table, m.search.key = table, key
+	return m.puts.Get(m.search)
+}
+
+func (m *Mutation) set(table string, key, val []byte, deleted bool) {
+	it := &item{table: table, key: common.Copy(key), val: common.Copy(val), deleted: deleted}
+	if prev, ok := m.puts.ReplaceOrInsert(it); ok {
+		m.size -= len(prev.key) + len(prev.val) + itemOverhead
+	}
+	m.size += len(it.key) + len(it.val) + itemOverhead
+}
+
+func (m *Mutation) Put(table string, k, v []byte) error {
+	if len(k) == 0 {
+		return fmt.Errorf("empty keys are not supported. table: %s", table)
+	}
+	m.set(table, k, v, false)
+	return nil
+}
+
+// Append - same as Put: data is sorted in memory anyway
+func (m *Mutation) Append(table string, k, v []byte) error { return m.Put(table, k, v) }
+func (m *Mutation) AppendDup(table string, k, v []byte) error {
+	return fmt.Errorf("%w: AppendDup, table: %s", kv.ErrNotSupported, table)
+}
+
+func (m *Mutation) Delete(table string, k, v []byte) error {
+	m.set(table, k, nil, true)
+	return nil
+}
+
+func (m *Mutation) GetOne(table string, key []byte) ([]byte, error) {
+	if it, ok := m.getMem(table, key); ok {
+		if it.deleted {
+			return nil, nil
+		}
+		return it.val, nil
+	}
+	return m.tx.GetOne(table, key)
+}
+
+func (m *Mutation) Has(table string, key []byte) (bool, error) {
+	if it, ok := m.getMem(table, key); ok {
+		return !it.deleted, nil
+	}
+	return m.tx.Has(table, key)
+}
+
+func (m *Mutation) IncrementSequence(table string, amount uint64) (uint64, error) {
+	current, err := m.ReadSequence(table)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	if err := m.Put(kv.Sequence, []byte(table), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (m *Mutation) ReadSequence(table string) (uint64, error) {
+	v, err := m.GetOne(kv.Sequence, []byte(table))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func (m *Mutation) BucketSize(table string) (uint64, error) { return m.tx.BucketSize(table) }
+
+func (m *Mutation) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mutation) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mutation) ForAmount(table string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	c, err := m.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+// BatchSize - approximate amount of memory used by pending changes
+func (m *Mutation) BatchSize() int { return m.size }
+
+// Len - amount of pending changes (including deletes)
+func (m *Mutation) Len() int { return m.puts.Len() }
+
+// Flush - writes all pending changes into underlying tx and resets the buffer.
+// Doesn't commit underlying tx.
+func (m *Mutation) Flush(ctx context.Context) error {
+	var (
+		c     kv.RwCursor
+		table string
+		err   error
+		i     int
+	)
+	m.puts.Ascend(func(it *item) bool {
+		if c == nil || it.table != table {
+			if c != nil {
+				c.Close()
+			}
+			table = it.table
+			if c, err = m.tx.RwCursor(table); err != nil {
+				return false
+			}
+		}
+		if it.deleted {
+			err = c.Delete(it.key, nil)
+		} else {
+			err = c.Put(it.key, it.val)
+		}
+		if err != nil {
+			err = fmt.Errorf("flush: table: %s, key: %x, %w", it.table, it.key, err)
+			return false
+		}
+		i++
+		if i%10_000 == 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return false
+			default:
+			}
+		}
+		return true
+	})
+	if c != nil {
+		c.Close()
+	}
+	if err != nil {
+		return err
+	}
+	m.puts.Clear(false)
+	m.size = 0
+	return nil
+}
+
+// Commit - flushes changes into underlying tx, doesn't commit underlying tx
+func (m *Mutation) Commit() error { return m.Flush(context.Background()) }
+
+// Rollback - discards pending changes, doesn't rollback underlying tx
+func (m *Mutation) Rollback() {
+	m.puts.Clear(false)
+	m.size = 0
+}
+
+// Cursor - returns cursor over merged view: pending changes + underlying tx
+func (m *Mutation) Cursor(table string) (kv.Cursor, error) {
+	c, err := m.tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor{m: m, table: table, c: c}, nil
+}
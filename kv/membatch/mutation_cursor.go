@@ -0,0 +1,213 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package membatch
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// cursor - merges pending changes of Mutation with underlying cursor.
+// If key exists in both - pending change wins. Tombstones hide underlying keys.
+type cursor struct {
+	m     *Mutation
+	table string
+	c     kv.Cursor
+
+	// position of underlying cursor: in forward direction - smallest key >= current, in backward - biggest key <= current
+	dbK, dbV []byte
+	k, v     []byte // current
+	backward bool
+}
+
+// memGE - first pending change of table with key >= from (or > from if !inclusive). from=nil means first
+func (c *cursor) memGE(from []byte, inclusive bool) (res *item) {
+	pivot := &item{table: c.table, key: from}
+	c.m.puts.AscendGreaterOrEqual(pivot, func(it *item) bool {
+		if it.table != c.table {
+			return false
+		}
+		if !inclusive && bytes.Equal(it.key, from) {
+			return true
+		}
+		res = it
+		return false
+	})
+	return res
+}
+
+// memLE - last pending change of table with key <= from (or < from if !inclusive). from=nil means last
+func (c *cursor) memLE(from []byte, inclusive bool) (res *item) {
+	pivot := &item{table: c.table, key: from}
+	if from == nil {
+		pivot.table = c.table + "\x00" // greater than any key of table
+	}
+	c.m.puts.DescendLessOrEqual(pivot, func(it *item) bool {
+		if it.table != c.table {
+			return from == nil && it.table > c.table
+		}
+		if !inclusive && bytes.Equal(it.key, from) {
+			return true
+		}
+		res = it
+		return false
+	})
+	return res
+}
+
+func (c *cursor) forward(from []byte, inclusive bool) ([]byte, []byte, error) {
+	var err error
+	for {
+		mi := c.memGE(from, inclusive)
+		if mi != nil && (c.dbK == nil || bytes.Compare(mi.key, c.dbK) <= 0) {
+			if c.dbK != nil && bytes.Equal(mi.key, c.dbK) {
+				if c.dbK, c.dbV, err = c.c.Next(); err != nil {
+					return []byte{}, nil, err
+				}
+			}
+			if mi.deleted {
+				from, inclusive = mi.key, false
+				continue
+			}
+			c.k, c.v = mi.key, mi.val
+			return c.k, c.v, nil
+		}
+		c.k, c.v = c.dbK, c.dbV
+		return c.k, c.v, nil
+	}
+}
+
+func (c *cursor) backwardFrom(from []byte, inclusive bool) ([]byte, []byte, error) {
+	var err error
+	for {
+		mi := c.memLE(from, inclusive)
+		if mi != nil && (c.dbK == nil || bytes.Compare(mi.key, c.dbK) >= 0) {
+			if c.dbK != nil && bytes.Equal(mi.key, c.dbK) {
+				if c.dbK, c.dbV, err = c.c.Prev(); err != nil {
+					return []byte{}, nil, err
+				}
+			}
+			if mi.deleted {
+				from, inclusive = mi.key, false
+				continue
+			}
+			c.k, c.v = mi.key, mi.val
+			return c.k, c.v, nil
+		}
+		c.k, c.v = c.dbK, c.dbV
+		return c.k, c.v, nil
+	}
+}
+
+func (c *cursor) First() ([]byte, []byte, error) {
+	var err error
+	c.backward = false
+	if c.dbK, c.dbV, err = c.c.First(); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.forward(nil, true)
+}
+
+func (c *cursor) Seek(seek []byte) ([]byte, []byte, error) {
+	var err error
+	c.backward = false
+	if c.dbK, c.dbV, err = c.c.Seek(seek); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.forward(seek, true)
+}
+
+func (c *cursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.Seek(key)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !bytes.Equal(k, key) {
+		return nil, nil, nil
+	}
+	return k, v, nil
+}
+
+func (c *cursor) Next() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	var err error
+	if c.backward { // change of direction: re-position underlying cursor
+		c.backward = false
+		if c.dbK, c.dbV, err = c.c.Seek(c.k); err != nil {
+			return []byte{}, nil, err
+		}
+	}
+	if c.dbK != nil && bytes.Equal(c.dbK, c.k) {
+		if c.dbK, c.dbV, err = c.c.Next(); err != nil {
+			return []byte{}, nil, err
+		}
+	}
+	return c.forward(c.k, false)
+}
+
+func (c *cursor) Prev() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	var err error
+	if !c.backward { // change of direction: re-position underlying cursor
+		c.backward = true
+		if c.dbK, c.dbV, err = c.c.Seek(c.k); err != nil {
+			return []byte{}, nil, err
+		}
+		if c.dbK == nil {
+			c.dbK, c.dbV, err = c.c.Last()
+		} else {
+			c.dbK, c.dbV, err = c.c.Prev()
+		}
+		if err != nil {
+			return []byte{}, nil, err
+		}
+	} else if c.dbK != nil && bytes.Equal(c.dbK, c.k) {
+		if c.dbK, c.dbV, err = c.c.Prev(); err != nil {
+			return []byte{}, nil, err
+		}
+	}
+	return c.backwardFrom(c.k, false)
+}
+
+func (c *cursor) Last() ([]byte, []byte, error) {
+	var err error
+	c.backward = true
+	if c.dbK, c.dbV, err = c.c.Last(); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.backwardFrom(nil, true)
+}
+
+func (c *cursor) Current() ([]byte, []byte, error) { return c.k, c.v, nil }
+
+// Count - amount of keys in merged view is unknown without full scan
+func (c *cursor) Count() (uint64, error) {
+	return 0, fmt.Errorf("%w: Count of membatch cursor, table: %s", kv.ErrNotSupported, c.table)
+}
+
+func (c *cursor) Close() {
+	if c.c != nil {
+		c.c.Close()
+		c.c = nil
+	}
+}
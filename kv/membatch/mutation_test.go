@@ -0,0 +1,132 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package membatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func initializeDB(t *testing.T, tx kv.RwTx) {
+	t.Helper()
+	require.NoError(t, tx.Put(kv.HashedAccounts, []byte("AAAA"), []byte("value")))
+	require.NoError(t, tx.Put(kv.HashedAccounts, []byte("CAAA"), []byte("value1")))
+	require.NoError(t, tx.Put(kv.HashedAccounts, []byte("CBAA"), []byte("value2")))
+	require.NoError(t, tx.Put(kv.HashedAccounts, []byte("CCAA"), []byte("value3")))
+}
+
+func collect(t *testing.T, c kv.Cursor) (res []string) {
+	t.Helper()
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		require.NoError(t, err)
+		res = append(res, string(k)+"="+string(v))
+	}
+	return res
+}
+
+func TestMutationReadYourWrites(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	initializeDB(t, tx)
+
+	batch := NewMutation(tx)
+	defer batch.Rollback()
+	require.NoError(t, batch.Put(kv.HashedAccounts, []byte("BAAA"), []byte("value4")))
+	require.NoError(t, batch.Put(kv.HashedAccounts, []byte("CAAA"), []byte("value5")))
+	require.NoError(t, batch.Delete(kv.HashedAccounts, []byte("CBAA"), nil))
+	require.NoError(t, batch.Put(kv.HashedStorage, []byte("ZZZZ"), []byte("other table")))
+
+	v, err := batch.GetOne(kv.HashedAccounts, []byte("CAAA"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value5"), v)
+	v, err = batch.GetOne(kv.HashedAccounts, []byte("CBAA"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	has, err := batch.Has(kv.HashedAccounts, []byte("CBAA"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	c, err := batch.Cursor(kv.HashedAccounts)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, []string{"AAAA=value", "BAAA=value4", "CAAA=value5", "CCAA=value3"}, collect(t, c))
+
+	k, v, err := c.Last()
+	require.NoError(t, err)
+	require.Equal(t, "CCAA", string(k))
+	require.Equal(t, "value3", string(v))
+	k, _, err = c.Prev()
+	require.NoError(t, err)
+	require.Equal(t, "CAAA", string(k))
+	k, _, err = c.Prev()
+	require.NoError(t, err)
+	require.Equal(t, "BAAA", string(k))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	require.Equal(t, "CAAA", string(k))
+
+	k, _, err = c.Seek([]byte("CB"))
+	require.NoError(t, err)
+	require.Equal(t, "CCAA", string(k))
+	k, _, err = c.SeekExact([]byte("CBAA"))
+	require.NoError(t, err)
+	require.Nil(t, k)
+
+	// underlying tx is not changed before flush
+	v, err = tx.GetOne(kv.HashedAccounts, []byte("BAAA"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	require.Equal(t, 4, batch.Len())
+	require.NoError(t, batch.Flush(context.Background()))
+	require.Equal(t, 0, batch.Len())
+	require.Equal(t, 0, batch.BatchSize())
+
+	txC, err := tx.Cursor(kv.HashedAccounts)
+	require.NoError(t, err)
+	defer txC.Close()
+	require.Equal(t, []string{"AAAA=value", "BAAA=value4", "CAAA=value5", "CCAA=value3"}, collect(t, txC))
+	v, err = tx.GetOne(kv.HashedStorage, []byte("ZZZZ"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("other table"), v)
+}
+
+func TestMutationSequence(t *testing.T) {
+	_, tx := memdb.NewTestTx(t)
+	_, err := tx.IncrementSequence(kv.HashedAccounts, 10)
+	require.NoError(t, err)
+
+	batch := NewMutation(tx)
+	defer batch.Rollback()
+	current, err := batch.IncrementSequence(kv.HashedAccounts, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), current)
+	current, err = batch.ReadSequence(kv.HashedAccounts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), current)
+
+	current, err = tx.ReadSequence(kv.HashedAccounts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), current)
+	require.NoError(t, batch.Commit())
+	current, err = tx.ReadSequence(kv.HashedAccounts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), current)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/ledgerwatch/log/v3"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 )
 
@@ -28,6 +29,7 @@ type MemoryMutation struct {
 	memTx          kv.RwTx
 	memDb          kv.RwDB
 	deletedEntries map[string]map[string]struct{}
+	deletedDups    map[string]map[string]map[string]struct{} // DupSort tables: table => key => deleted values
 	clearedTables  map[string]struct{}
 	db             kv.Tx
 }
@@ -55,6 +57,7 @@ func NewMemoryBatch(tx kv.Tx) *MemoryMutation {
 		memDb:          tmpDB,
 		memTx:          memTx,
 		deletedEntries: make(map[string]map[string]struct{}),
+		deletedDups:    make(map[string]map[string]map[string]struct{}),
 		clearedTables:  make(map[string]struct{}),
 	}
 }
@@ -77,6 +80,11 @@ func (m *MemoryMutation) isEntryDeleted(table string, key []byte) bool {
 	return ok
 }
 
+func (m *MemoryMutation) isDupDeleted(table string, key, value []byte) bool {
+	_, ok := m.deletedDups[table][string(key)][string(value)]
+	return ok
+}
+
 // getMem Retrieve database entry from memory (hashed storage will be left out for now because it is the only non auto-DupSorted table)
 func (m *MemoryMutation) getMem(table string, key []byte) ([]byte, bool) {
 	val, err := m.memTx.GetOne(table, key)
@@ -133,6 +141,16 @@ func (m *MemoryMutation) ForAmount(bucket string, prefix []byte, amount uint32,
 
 // Can only be called from the worker thread
 func (m *MemoryMutation) GetOne(table string, key []byte) ([]byte, error) {
+	if m.db != nil && isTablePurelyDupsort(table) {
+		// first value of key can be in memory or in db
+		c, err := m.makeCursor(table)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		_, v, err := c.SeekExact(key)
+		return v, err
+	}
 	if value, ok := m.getMem(table, key); ok {
 		if value == nil {
 			return nil, nil
@@ -207,6 +225,17 @@ func (m *MemoryMutation) ForPrefix(bucket string, prefix []byte, walker func(k,
 }
 
 func (m *MemoryMutation) Delete(table string, k, v []byte) error {
+	if v != nil && isTablePurelyDupsort(table) {
+		// like in MDBX - delete only 1 value of key
+		if _, ok := m.deletedDups[table]; !ok {
+			m.deletedDups[table] = make(map[string]map[string]struct{})
+		}
+		if _, ok := m.deletedDups[table][string(k)]; !ok {
+			m.deletedDups[table][string(k)] = make(map[string]struct{})
+		}
+		m.deletedDups[table][string(k)][string(v)] = struct{}{}
+		return m.memTx.Delete(table, k, v)
+	}
 	if _, ok := m.deletedEntries[table]; !ok {
 		m.deletedEntries[table] = make(map[string]struct{})
 	}
@@ -237,6 +266,14 @@ func (m *MemoryMutation) BucketSize(bucket string) (uint64, error) {
 	return 0, nil
 }
 
+func (m *MemoryMutation) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	c, err := m.makeCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
+
 func (m *MemoryMutation) DropBucket(bucket string) error {
 	panic("Not implemented")
 }
@@ -281,6 +318,15 @@ func (m *MemoryMutation) Flush(tx kv.RwTx) error {
 			}
 		}
 	}
+	for bucket, keys := range m.deletedDups {
+		for key, values := range keys {
+			for value := range values {
+				if err := tx.Delete(bucket, []byte(key), []byte(value)); err != nil {
+					return err
+				}
+			}
+		}
+	}
 	// Iterate over each bucket and apply changes accordingly.
 	for _, bucket := range buckets {
 		if isTablePurelyDupsort(bucket) {
@@ -336,6 +382,7 @@ func (m *MemoryMutation) makeCursor(bucket string) (kv.RwCursorDupSort, error) {
 	c := &memoryMutationCursor{}
 	// We can filter duplicates in dup sorted table
 	c.table = bucket
+	c.dupSort = isTablePurelyDupsort(bucket)
 
 	var err error
 	// Initialize db cursors
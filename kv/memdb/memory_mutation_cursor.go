@@ -52,6 +52,7 @@ type memoryMutationCursor struct {
 	// we keep the mining mutation so that we can insert new elements in db
 	mutation *MemoryMutation
 	table    string
+	dupSort  bool // DupSort table without AutoDupSortKeysConversion: entries are compared by key and value
 }
 
 // First move cursor to first position and return key and value accordingly.
@@ -63,7 +64,7 @@ func (m *memoryMutationCursor) First() ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	if dbKey != nil && m.mutation.isEntryDeleted(m.table, dbKey) {
+	if dbKey != nil && m.isDeleted(dbKey, dbValue) {
 		if dbKey, dbValue, err = m.getNextOnDb(Normal); err != nil {
 			return nil, nil, err
 		}
@@ -94,7 +95,7 @@ func (m *memoryMutationCursor) getNextOnDb(t NextType) (key []byte, value []byte
 		return
 	}
 
-	for key != nil && value != nil && m.mutation.isEntryDeleted(m.table, m.convertAutoDupsort(key, value)) {
+	for key != nil && value != nil && m.isDeleted(key, value) {
 		switch t {
 		case Normal:
 			key, value, err = m.cursor.Next()
@@ -119,6 +120,14 @@ func (m *memoryMutationCursor) getNextOnDb(t NextType) (key []byte, value []byte
 	return
 }
 
+// isDeleted - entry of db is deleted by mutation
+func (m *memoryMutationCursor) isDeleted(key, value []byte) bool {
+	if m.mutation.isEntryDeleted(m.table, m.convertAutoDupsort(key, value)) {
+		return true
+	}
+	return m.dupSort && m.mutation.isDupDeleted(m.table, key, value)
+}
+
 func (m *memoryMutationCursor) convertAutoDupsort(key []byte, value []byte) []byte {
 	config, ok := kv.ChaindataTablesCfg[m.table]
 	// If we do not have the configuration we assume it is not dupsorted
@@ -146,12 +155,16 @@ func (m *memoryMutationCursor) skipIntersection(memKey, memValue, dbKey, dbValue
 	}
 	// Check for duplicates
 	if bytes.Equal(memKey, dbKey) {
-		if !dup {
+		if !dup && !m.dupSort {
 			if newDbKey, newDbValue, err = m.getNextOnDb(Normal); err != nil {
 				return
 			}
 		} else if bytes.Equal(memValue, dbValue) {
-			if newDbKey, newDbValue, err = m.getNextOnDb(Dup); err != nil {
+			next := Dup
+			if !dup {
+				next = Normal
+			}
+			if newDbKey, newDbValue, err = m.getNextOnDb(next); err != nil {
 				return
 			}
 		} else if dupsortOffset != 0 && len(memValue) >= dupsortOffset && len(dbValue) >= dupsortOffset && bytes.Equal(memValue[:dupsortOffset], dbValue[:dupsortOffset]) {
@@ -214,6 +227,9 @@ func (m *memoryMutationCursor) Next() ([]byte, []byte, error) {
 
 // NextDup returns the next element of the mutation.
 func (m *memoryMutationCursor) NextDup() ([]byte, []byte, error) {
+	if m.dupSort {
+		return m.nextDupSorted()
+	}
 	if m.isPrevFromDb {
 		k, v, err := m.getNextOnDb(Dup)
 
@@ -236,7 +252,7 @@ func (m *memoryMutationCursor) Seek(seek []byte) ([]byte, []byte, error) {
 	}
 
 	// If the entry is marked as DB find one that is not
-	if dbKey != nil && m.mutation.isEntryDeleted(m.table, dbKey) {
+	if dbKey != nil && m.isDeleted(dbKey, dbValue) {
 		dbKey, dbValue, err = m.getNextOnDb(Normal)
 		if err != nil {
 			return nil, nil, err
@@ -250,6 +266,14 @@ func (m *memoryMutationCursor) Seek(seek []byte) ([]byte, []byte, error) {
 
 // Seek move pointer to a key at a certain position.
 func (m *memoryMutationCursor) SeekExact(seek []byte) ([]byte, []byte, error) {
+	if m.dupSort {
+		// first value of key can be in memory or in db
+		k, v, err := m.Seek(seek)
+		if err != nil || !bytes.Equal(k, seek) {
+			return nil, nil, err
+		}
+		return k, v, nil
+	}
 	memKey, memValue, _ := m.memCursor.SeekExact(seek)
 	var err error
 	if memKey != nil {
@@ -291,7 +315,14 @@ func (m *memoryMutationCursor) AppendDup(k []byte, v []byte) error {
 }
 
 func (m *memoryMutationCursor) PutNoDupData(key, value []byte) error {
-	panic("DeleteCurrentDuplicates Not implemented")
+	k, _, err := m.SeekBothExact(key, value)
+	if err != nil {
+		return err
+	}
+	if k != nil {
+		return fmt.Errorf("PutNoDupData: table %s already has key %x with value %x", m.table, key, value)
+	}
+	return m.mutation.Put(m.table, common.Copy(key), common.Copy(value))
 }
 
 func (m *memoryMutationCursor) Delete(k, v []byte) error {
@@ -299,7 +330,13 @@ func (m *memoryMutationCursor) Delete(k, v []byte) error {
 }
 
 func (m *memoryMutationCursor) DeleteCurrent() error {
-	panic("DeleteCurrent Not implemented")
+	if m.currentPair.key == nil {
+		return nil
+	}
+	if m.dupSort {
+		return m.mutation.Delete(m.table, common.Copy(m.currentPair.key), common.Copy(m.currentPair.value))
+	}
+	return m.mutation.Delete(m.table, common.Copy(m.currentPair.key), nil)
 }
 
 func (m *memoryMutationCursor) DeleteCurrentDuplicates() error {
@@ -324,6 +361,9 @@ func (m *memoryMutationCursor) DeleteCurrentDuplicates() error {
 
 // Seek move pointer to a key at a certain position.
 func (m *memoryMutationCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	if m.dupSort && value != nil {
+		return m.seekBothRangeSorted(key, value)
+	}
 	if value == nil {
 		_, v, err := m.SeekExact(key)
 		return v, err
@@ -360,7 +400,7 @@ func (m *memoryMutationCursor) Last() ([]byte, []byte, error) {
 	m.currentMemEntry = cursorentry{memKey, memValue}
 
 	// Basic checks
-	if dbKey != nil && m.mutation.isEntryDeleted(m.table, dbKey) {
+	if dbKey != nil && m.isDeleted(dbKey, dbValue) {
 		m.currentDbEntry = cursorentry{}
 		m.isPrevFromDb = false
 		return memKey, memValue, nil
@@ -412,15 +452,41 @@ func (m *memoryMutationCursor) Close() {
 	}
 }
 
+// Count - amount of entries in table after mutation
 func (m *memoryMutationCursor) Count() (uint64, error) {
-	panic("Not implemented")
+	c, err := m.mutation.makeCursor(m.table)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	var count uint64
+	for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
 }
 
 func (m *memoryMutationCursor) FirstDup() ([]byte, error) {
-	panic("Not implemented")
+	if m.currentPair.key == nil {
+		return nil, nil
+	}
+	_, v, err := m.SeekExact(common.Copy(m.currentPair.key))
+	return v, err
 }
 
 func (m *memoryMutationCursor) NextNoDup() ([]byte, []byte, error) {
+	if m.dupSort {
+		current := common.Copy(m.currentPair.key)
+		for {
+			k, v, err := m.Next()
+			if err != nil || k == nil || !bytes.Equal(k, current) {
+				return k, v, err
+			}
+		}
+	}
 	if m.isPrevFromDb {
 		k, v, err := m.getNextOnDb(NoDup)
 		if err != nil {
@@ -434,14 +500,111 @@ func (m *memoryMutationCursor) NextNoDup() ([]byte, []byte, error) {
 	return m.goForward(memK, memV, m.currentDbEntry.key, m.currentDbEntry.value, false)
 }
 
+// LastDup - NextDup stays at last value of key when there are no more values
 func (m *memoryMutationCursor) LastDup() ([]byte, error) {
-	panic("Not implemented")
+	if m.currentPair.key == nil {
+		return nil, nil
+	}
+	last := m.currentPair.value
+	for {
+		k, v, err := m.NextDup()
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			return common.Copy(last), nil
+		}
+		last = v
+	}
 }
 
+// CountDuplicates - cursor stays at current position
 func (m *memoryMutationCursor) CountDuplicates() (uint64, error) {
-	panic("Not implemented")
+	if m.currentPair.key == nil {
+		return 0, nil
+	}
+	key, value := common.Copy(m.currentPair.key), common.Copy(m.currentPair.value)
+	v, err := m.FirstDup()
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for v != nil {
+		count++
+		if _, v, err = m.NextDup(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err = m.SeekBothRange(key, value); err != nil {
+		return 0, err
+	}
+	return count, nil
 }
 
 func (m *memoryMutationCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
-	panic("SeekBothExact Not implemented")
+	v, err := m.SeekBothRange(key, value)
+	if err != nil || v == nil || !bytes.Equal(v, value) {
+		return nil, nil, err
+	}
+	return key, v, nil
+}
+
+// nextDupSorted - merged Next, but stays at last value of key if next entry has another key (like MDBX)
+func (m *memoryMutationCursor) nextDupSorted() ([]byte, []byte, error) {
+	if m.currentPair.key == nil {
+		return nil, nil, nil
+	}
+	key, value := common.Copy(m.currentPair.key), common.Copy(m.currentPair.value)
+	k, v, err := m.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if k != nil && bytes.Equal(k, key) {
+		return k, v, nil
+	}
+	if _, err = m.seekBothRangeSorted(key, value); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, nil
+}
+
+// seekBothRangeSorted - positions both cursors at first entry >= (key, value)
+func (m *memoryMutationCursor) seekBothRangeSorted(key, value []byte) ([]byte, error) {
+	memKey, memValue, err := seekBothRangeOrNext(m.memDupCursor, key, value)
+	if err != nil {
+		return nil, err
+	}
+	dbKey, dbValue, err := seekBothRangeOrNext(m.dupCursor, key, value)
+	if err != nil {
+		return nil, err
+	}
+	if dbKey != nil && m.isDeleted(dbKey, dbValue) {
+		if dbKey, dbValue, err = m.getNextOnDb(Normal); err != nil {
+			return nil, err
+		}
+	}
+	k, v, err := m.goForward(memKey, memValue, dbKey, dbValue, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return v, nil
+}
+
+// seekBothRangeOrNext - if key has no values >= value, moves to first value of next key
+func seekBothRangeOrNext(c kv.CursorDupSort, key, value []byte) ([]byte, []byte, error) {
+	v, err := c.SeekBothRange(key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v != nil {
+		return key, v, nil
+	}
+	k, v, err := c.Seek(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if k != nil && bytes.Equal(k, key) {
+		return c.NextNoDup()
+	}
+	return k, v, nil
 }
@@ -15,9 +15,11 @@ package memdb
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"github.com/stretchr/testify/require"
 )
 
@@ -125,3 +127,175 @@ func TestFlush(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, value, []byte("value5"))
 }
+
+func initializeDupSortDB(t *testing.T, rwTx kv.RwTx) {
+	for _, pair := range [][2]string{{"k1", "a"}, {"k1", "c"}, {"k1", "e"}, {"k2", "b"}} {
+		require.NoError(t, rwTx.Put(kv.AccountChangeSet, []byte(pair[0]), []byte(pair[1])))
+	}
+}
+
+func TestDupSortMining(t *testing.T) {
+	_, rwTx := NewTestTx(t)
+	initializeDupSortDB(t, rwTx)
+
+	batch := NewMemoryBatch(rwTx)
+	defer batch.Rollback()
+	require.NoError(t, batch.Put(kv.AccountChangeSet, []byte("k1"), []byte("b")))
+	require.NoError(t, batch.Put(kv.AccountChangeSet, []byte("k1"), []byte("d")))
+	require.NoError(t, batch.Put(kv.AccountChangeSet, []byte("k3"), []byte("x")))
+	require.NoError(t, batch.Delete(kv.AccountChangeSet, []byte("k1"), []byte("c")))
+
+	c, err := batch.RwCursorDupSort(kv.AccountChangeSet)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var all []string
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		require.NoError(t, err)
+		all = append(all, string(k)+":"+string(v))
+	}
+	require.Equal(t, []string{"k1:a", "k1:b", "k1:d", "k1:e", "k2:b", "k3:x"}, all)
+
+	k, v, err := c.First()
+	require.NoError(t, err)
+	require.Equal(t, "k1:a", string(k)+":"+string(v))
+	for _, expect := range []string{"b", "d", "e"} {
+		_, v, err = c.NextDup()
+		require.NoError(t, err)
+		require.Equal(t, expect, string(v))
+	}
+	k, v, err = c.NextDup()
+	require.NoError(t, err)
+	require.Nil(t, k)
+	require.Nil(t, v)
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	require.Equal(t, "k2:b", string(k)+":"+string(v))
+
+	v, err = c.SeekBothRange([]byte("k1"), []byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, "d", string(v))
+	cnt, err := c.CountDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), cnt)
+	k, v, err = c.Current()
+	require.NoError(t, err)
+	require.Equal(t, "k1:d", string(k)+":"+string(v))
+
+	v, err = c.FirstDup()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(v))
+	v, err = c.LastDup()
+	require.NoError(t, err)
+	require.Equal(t, "e", string(v))
+	k, v, err = c.NextNoDup()
+	require.NoError(t, err)
+	require.Equal(t, "k2:b", string(k)+":"+string(v))
+
+	k, _, err = c.SeekBothExact([]byte("k1"), []byte("c"))
+	require.NoError(t, err)
+	require.Nil(t, k)
+	k, v, err = c.SeekBothExact([]byte("k1"), []byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "k1:b", string(k)+":"+string(v))
+	require.Error(t, c.PutNoDupData([]byte("k1"), []byte("e")))
+
+	cnt, err = c.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), cnt)
+	v, err = batch.GetOne(kv.AccountChangeSet, []byte("k1"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(v))
+
+	require.NoError(t, batch.Flush(rwTx))
+	dbC, err := rwTx.CursorDupSort(kv.AccountChangeSet)
+	require.NoError(t, err)
+	defer dbC.Close()
+	cnt, err = dbC.Count()
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), cnt)
+	v, err = dbC.SeekBothRange([]byte("k1"), []byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, "d", string(v))
+}
+
+func TestRangeMining(t *testing.T) {
+	_, rwTx := NewTestTx(t)
+	initializeDB(rwTx)
+
+	batch := NewMemoryBatch(rwTx)
+	defer batch.Rollback()
+	require.NoError(t, batch.Put(kv.HashedAccounts, []byte("BAAA"), []byte("value4")))
+	require.NoError(t, batch.Delete(kv.HashedAccounts, []byte("CAAA"), nil))
+
+	it, err := batch.Range(kv.HashedAccounts, []byte("B"), []byte("CC"))
+	require.NoError(t, err)
+	keys, values, err := iter.ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("BAAA"), []byte("CBAA")}, keys)
+	require.Equal(t, [][]byte{[]byte("value4"), []byte("value2")}, values)
+}
+
+func TestDeleteRangeMining(t *testing.T) {
+	_, rwTx := NewTestTx(t)
+	initializeDB(rwTx)
+
+	batch := NewMemoryBatch(rwTx)
+	defer batch.Rollback()
+	require.NoError(t, batch.Put(kv.HashedAccounts, []byte("BAAA"), []byte("value4")))
+	require.NoError(t, kv.DeleteRange(batch, kv.HashedAccounts, []byte("B"), []byte("CC")))
+
+	it, err := batch.Range(kv.HashedAccounts, nil, nil)
+	require.NoError(t, err)
+	keys, _, err := iter.ToArrayKV(it)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("AAAA"), []byte("CCAA")}, keys)
+
+	require.NoError(t, batch.Flush(rwTx))
+	has, err := rwTx.Has(kv.HashedAccounts, []byte("CBAA"))
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestTableStatsMining(t *testing.T) {
+	rwTx, err := New().BeginRw(context.Background())
+	require.NoError(t, err)
+
+	initializeDB(rwTx)
+
+	batch := NewMemoryBatch(rwTx)
+	// changes of mutation are not in pages of db, stats of db don't count them
+	_, err = kv.ReadTableStats(batch, kv.HashedAccounts)
+	require.ErrorIs(t, err, kv.ErrNotSupported)
+}
+
+func TestHooksMining(t *testing.T) {
+	rwTx, err := New().BeginRw(context.Background())
+	require.NoError(t, err)
+
+	initializeDB(rwTx)
+
+	// MemoryMutation doesn't support hooks: wrapper runs them around its Commit
+	batch := NewMemoryBatch(rwTx)
+	var hooks kv.WrapperHooks
+	var calls []string
+	hooks.Of(batch).PreCommit(func() error {
+		calls = append(calls, "pre")
+		return batch.Put(kv.HashedAccounts, []byte("AAAA"), []byte("value9"))
+	})
+	hooks.Of(batch).PostCommit(func() { calls = append(calls, "post") })
+	require.NoError(t, hooks.Commit(batch.Commit, batch.Rollback))
+	require.Equal(t, []string{"pre", "post"}, calls)
+	v, err := batch.GetOne(kv.HashedAccounts, []byte("AAAA"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value9"), v)
+	batch.Rollback()
+
+	// error of pre-commit hook rolls back
+	batch = NewMemoryBatch(rwTx)
+	calls = nil
+	hooks.Of(batch).PreCommit(func() error { return errors.New("boom") })
+	hooks.Of(batch).PostCommit(func() { calls = append(calls, "post") })
+	require.Error(t, hooks.Commit(batch.Commit, batch.Rollback))
+	require.Empty(t, calls)
+}
@@ -0,0 +1,333 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// Migration - named change of db schema (tables layout or values encoding).
+// Each migration is applied once: names of applied migrations are stored in AppliedMigrations table.
+// Migration and mark "applied" are committed by same RwTx.
+type Migration struct {
+	Name string
+	Up   func(ctx context.Context, tx RwTx) error
+
+	// Table, Version - optional: migration converts data of Table to Version of its config, version of table in db
+	// is updated by same RwTx
+	Table   string
+	Version uint32
+}
+
+// ToVersion - migration which also sets version of table in db, see TableCfgItem.Version
+func (m Migration) ToVersion(table string, version uint32) Migration {
+	m.Table, m.Version = table, version
+	return m
+}
+
+// Migrator - ordered list of migrations. Order matters: new migrations must be appended to the end.
+// Table config of db must be already new one (for example: ChangeTableFlags migration re-creates table with flags from config).
+type Migrator struct {
+	migrations []Migration
+}
+
+func NewMigrator(migrations ...Migration) *Migrator {
+	m := &Migrator{}
+	for _, mig := range migrations {
+		m.Register(mig)
+	}
+	return m
+}
+
+// Register - panics on duplicated name because it's programming error
+func (m *Migrator) Register(mig Migration) {
+	for i := range m.migrations {
+		if m.migrations[i].Name == mig.Name {
+			panic(fmt.Sprintf("migration %s registered twice", mig.Name))
+		}
+	}
+	m.migrations = append(m.migrations, mig)
+}
+
+// Pending - list of migrations which are not applied yet
+func (m *Migrator) Pending(tx Tx) ([]Migration, error) {
+	var res []Migration
+	for _, mig := range m.migrations {
+		applied, err := tx.Has(AppliedMigrations, []byte(mig.Name))
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			res = append(res, mig)
+		}
+	}
+	return res, nil
+}
+
+// Apply - runs not applied migrations, each in own RwTx. Returns names of applied migrations
+func (m *Migrator) Apply(ctx context.Context, db RwDB) (applied []string, err error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	if err := db.Update(ctx, func(tx RwTx) error {
+		if err := tx.CreateBucket(AppliedMigrations); err != nil {
+			return err
+		}
+		return tx.CreateBucket(TableVersions)
+	}); err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	if err := db.View(ctx, func(tx Tx) (err error) {
+		pending, err = m.Pending(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	for _, mig := range pending {
+		if err := db.Update(ctx, func(tx RwTx) error {
+			if err := mig.Up(ctx, tx); err != nil {
+				return err
+			}
+			if mig.Table != "" {
+				if err := PutTableVersion(tx, mig.Table, mig.Version); err != nil {
+					return err
+				}
+			}
+			var appliedAt [8]byte
+			binary.BigEndian.PutUint64(appliedAt[:], uint64(time.Now().Unix()))
+			return tx.Put(AppliedMigrations, []byte(mig.Name), appliedAt[:])
+		}); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", mig.Name, err)
+		}
+		applied = append(applied, mig.Name)
+	}
+	return applied, nil
+}
+
+// TableVersion - version of data of table in db, 0 if it's not set
+func TableVersion(tx Getter, table string) (uint32, error) {
+	v, err := tx.GetOne(TableVersions, []byte(table))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 4 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint32(v), nil
+}
+
+func PutTableVersion(tx Putter, table string, version uint32) error {
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], version)
+	return tx.Put(TableVersions, []byte(table), v[:])
+}
+
+// CheckTableVersions - compares versions of data of tables in db with TableCfgItem.Version (TableVersions table
+// must exist):
+//   - newer version in db is error: db was written by newer version of app
+//   - older version of not empty table is error: migration which converts its data wasn't applied
+//   - older version of empty table is fine: such tables are returned in unset, to write their version
+func CheckTableVersions(tx Tx, cfg TableCfg) (unset []string, err error) {
+	for name, item := range cfg {
+		if item.IsDeprecated {
+			continue
+		}
+		version, err := TableVersion(tx, name)
+		if err != nil {
+			return nil, err
+		}
+		if version == item.Version {
+			continue
+		}
+		if version > item.Version {
+			return nil, fmt.Errorf("table %s: version in db %d is newer than supported %d", name, version, item.Version)
+		}
+		empty, err := isEmpty(tx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			return nil, fmt.Errorf("table %s: version in db %d is older than %d, migration is not applied", name, version, item.Version)
+		}
+		unset = append(unset, name)
+	}
+	return unset, nil
+}
+
+func isEmpty(tx Tx, table string) (bool, error) {
+	c, err := tx.Cursor(table)
+	if errors.Is(err, ErrTableMissing) { // not created in read-only db
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	k, _, err := c.First()
+	return k == nil, err
+}
+
+// TableDropper - (optional interface of RwTx) drops table even if it's not deprecated.
+// Next CreateBucket creates table with flags from tables config of db.
+type TableDropper interface {
+	ForceDropBucket(name string) error
+}
+
+func dropOrClear(tx RwTx, table string) error {
+	if d, ok := tx.(TableDropper); ok {
+		return d.ForceDropBucket(table)
+	}
+	return tx.ClearBucket(table)
+}
+
+// RenameTable - moves all data from table `from` to table `to`, then drops `from`.
+// Usually `from` is marked as deprecated in tables config. Does nothing if `from` doesn't exist.
+func RenameTable(name, from, to string) Migration {
+	return Migration{Name: name, Up: func(ctx context.Context, tx RwTx) error {
+		exists, err := tx.ExistsBucket(from)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return nil
+		}
+		if err := copyTable(ctx, tx, from, to); err != nil {
+			return err
+		}
+		return dropOrClear(tx, from)
+	}}
+}
+
+// ChangeTableFlags - re-creates table with flags from current tables config (for example: to enable DupSort) and keeps data.
+// When DupSort is turned off - only last value of each key is kept.
+// Requires TableDropper (MDBX does implement it).
+func ChangeTableFlags(name, table string) Migration {
+	return Migration{Name: name, Up: func(ctx context.Context, tx RwTx) error {
+		if _, ok := tx.(TableDropper); !ok {
+			return fmt.Errorf("%w: ChangeTableFlags, table: %s", ErrNotSupported, table)
+		}
+		return rewriteTable(ctx, tx, table, nil, true)
+	}}
+}
+
+// ReencodeValues - replaces value of each pair of table by f(k, v). Works for DupSort tables too.
+func ReencodeValues(name, table string, f func(k, v []byte) ([]byte, error)) Migration {
+	return Migration{Name: name, Up: func(ctx context.Context, tx RwTx) error {
+		return rewriteTable(ctx, tx, table, f, false)
+	}}
+}
+
+// rewriteTable - moves all data to temporary table, empties (or re-creates) table and moves data back.
+// Temporary table is plain: each duplicate is stored under own key [len(k) u32][k][dupIdx u64] to preserve order of duplicates.
+func rewriteTable(ctx context.Context, tx RwTx, table string, f func(k, v []byte) ([]byte, error), recreate bool) error {
+	tmp := table + "_migration_tmp"
+	if err := tx.CreateBucket(tmp); err != nil {
+		return err
+	}
+	if err := tx.ClearBucket(tmp); err != nil { // left by previous failed attempt
+		return err
+	}
+	var prevK, tmpK []byte
+	var dupIdx uint64
+	if err := forEachCtx(ctx, tx, table, func(k, v []byte) error {
+		if prevK != nil && bytes.Equal(prevK, k) {
+			dupIdx++
+		} else {
+			prevK, dupIdx = common.Copy(k), 0
+		}
+		tmpK = common.EnsureEnoughSize(tmpK, 4+len(k)+8)
+		binary.BigEndian.PutUint32(tmpK, uint32(len(k)))
+		copy(tmpK[4:], k)
+		binary.BigEndian.PutUint64(tmpK[4+len(k):], dupIdx)
+		if f != nil {
+			var err error
+			if v, err = f(k, v); err != nil {
+				return err
+			}
+		}
+		return tx.Put(tmp, tmpK, v)
+	}); err != nil {
+		return err
+	}
+
+	if recreate {
+		if err := tx.(TableDropper).ForceDropBucket(table); err != nil {
+			return err
+		}
+		if err := tx.CreateBucket(table); err != nil {
+			return err
+		}
+	} else if err := tx.ClearBucket(table); err != nil {
+		return err
+	}
+
+	c, err := tx.RwCursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := forEachCtx(ctx, tx, tmp, func(k, v []byte) error {
+		klen := binary.BigEndian.Uint32(k)
+		return c.Put(k[4:4+klen], v)
+	}); err != nil {
+		return err
+	}
+	return dropOrClear(tx, tmp)
+}
+
+func copyTable(ctx context.Context, tx RwTx, from, to string) error {
+	c, err := tx.RwCursor(to)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return forEachCtx(ctx, tx, from, c.Put)
+}
+
+func forEachCtx(ctx context.Context, tx Tx, table string, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	i := 0
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		i++
+		if i%100_000 == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ReaderWatchdog - TxMetrics decorator which remembers stack of creation of each read transaction
+// and logs transactions open for longer than threshold. Leaked read transaction doesn't allow db to re-use
+// pages freed after its begin - db file grows. Capturing of stack is not free - enable it for diagnostic.
+type ReaderWatchdog struct {
+	TxMetrics
+	threshold time.Duration
+	logger    log.Logger
+
+	lock    sync.Mutex
+	id      uint64
+	readers map[uint64]*watchedReader
+}
+
+type watchedReader struct {
+	begin    time.Time
+	stack    stack.CallStack
+	reported bool
+}
+
+// StuckReader - read transaction open for longer than threshold
+type StuckReader struct {
+	Age   time.Duration
+	Stack string // where transaction was opened
+}
+
+// NewReaderWatchdog - inner can be nil
+func NewReaderWatchdog(inner TxMetrics, threshold time.Duration, logger log.Logger) *ReaderWatchdog {
+	return &ReaderWatchdog{TxMetrics: inner, threshold: threshold, logger: logger, readers: map[uint64]*watchedReader{}}
+}
+
+func (w *ReaderWatchdog) ReadTxBegin() (end func()) {
+	r := &watchedReader{begin: time.Now(), stack: stack.Trace().TrimRuntime()}
+	w.lock.Lock()
+	w.id++
+	id := w.id
+	w.readers[id] = r
+	w.lock.Unlock()
+
+	var innerEnd func()
+	if w.TxMetrics != nil {
+		innerEnd = w.TxMetrics.ReadTxBegin()
+	}
+	return func() {
+		w.lock.Lock()
+		delete(w.readers, id)
+		reported := r.reported
+		w.lock.Unlock()
+		if reported {
+			w.logger.Info("[db] stuck read transaction closed", "age", time.Since(r.begin))
+		}
+		if innerEnd != nil {
+			innerEnd()
+		}
+	}
+}
+
+func (w *ReaderWatchdog) WriteTxEnd(duration time.Duration) {
+	if w.TxMetrics != nil {
+		w.TxMetrics.WriteTxEnd(duration)
+	}
+}
+
+func (w *ReaderWatchdog) Committed(duration time.Duration, bytes uint64) {
+	if w.TxMetrics != nil {
+		w.TxMetrics.Committed(duration, bytes)
+	}
+}
+
+// Stuck - read transactions open for longer than threshold, oldest first
+func (w *ReaderWatchdog) Stuck() []StuckReader {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var res []StuckReader
+	for _, r := range w.readers {
+		if age := time.Since(r.begin); age > w.threshold {
+			res = append(res, StuckReader{Age: age, Stack: r.stack.String()})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Age > res[j].Age })
+	return res
+}
+
+// Check - logs stuck read transactions (each only once), returns amount of newly found
+func (w *ReaderWatchdog) Check() (found int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, r := range w.readers {
+		if r.reported {
+			continue
+		}
+		if age := time.Since(r.begin); age > w.threshold {
+			r.reported = true
+			found++
+			w.logger.Warn("[db] stuck read transaction", "age", age, "opened_at", r.stack.String())
+		}
+	}
+	return found
+}
+
+// minWatchdogPeriod - Run doesn't check more often: also time.NewTicker panics on non-positive period
+const minWatchdogPeriod = time.Millisecond
+
+// Run - calls Check every `every` (at least minWatchdogPeriod) until ctx is done
+func (w *ReaderWatchdog) Run(ctx context.Context, every time.Duration) {
+	if every < minWatchdogPeriod {
+		every = minWatchdogPeriod
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
@@ -4,24 +4,34 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/log/v3"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // generate the messages and services
 type remoteOpts struct {
-	bucketsCfg  mdbx.TableCfgFunc
-	DialAddress string
-	version     gointerfaces.Version
-	remoteKV    remote.KVClient
-	log         log.Logger
+	bucketsCfg    mdbx.TableCfgFunc
+	DialAddress   string
+	version       gointerfaces.Version
+	remoteKV      remote.KVClient
+	log           log.Logger
+	rangePageSize int
+	cursorBatch   int
+
+	reconnectAttempts int
+	reconnectBackoff  time.Duration
 }
 
 type RemoteKV struct {
@@ -29,6 +39,8 @@ type RemoteKV struct {
 	log      log.Logger
 	buckets  kv.TableCfg
 	opts     remoteOpts
+
+	rangeUnsupported atomic.Bool // server is older than Range method
 }
 
 type remoteTx struct {
@@ -38,8 +50,10 @@ type remoteTx struct {
 	db                 *RemoteKV
 	cursors            []*remoteCursor
 	statelessCursors   map[string]kv.Cursor
+	rangeStreams       []*rangeStream
 	streamingRequested bool
 	id                 uint64
+	viewChanged        bool // reconnected to newer view, see ViewChanged
 }
 
 type remoteCursor struct {
@@ -49,6 +63,17 @@ type remoteCursor struct {
 	bucketName string
 	bucketCfg  kv.TableCfgItem
 	id         uint32
+
+	// read-ahead of Next (see remoteOpts.CursorBatch): pairs received from server, but not returned yet.
+	// Server's cursor is at last pair of batch - it's moved back to (k, v) before ops relative to current position
+	batch    *remote.Pairs
+	batchPos int
+	batchEOF bool
+
+	// k, v - last position returned to user: restored after batch and after reconnect (see remoteOpts.Reconnect)
+	k, v  []byte
+	moved bool // cursor was positioned at least once
+	lost  bool // position was not restored after reconnect - ops relative to it fail until absolute positioning
 }
 
 type remoteCursorDupSort struct {
@@ -64,6 +89,25 @@ func (opts remoteOpts) WithBucketsConfig(f mdbx.TableCfgFunc) remoteOpts {
 	return opts
 }
 
+// RangePageSize - amount of pairs server will send in 1 message of ForEach/ForPrefix/ForAmount streaming. 0 - server's default
+func (opts remoteOpts) RangePageSize(n int) remoteOpts {
+	opts.rangePageSize = n
+	return opts
+}
+
+// CursorBatch - Cursor.Next receives up to n pairs from server by 1 round-trip. 0 - disabled
+func (opts remoteOpts) CursorBatch(n int) remoteOpts {
+	opts.cursorBatch = n
+	return opts
+}
+
+// Reconnect - if connection to server was lost: tx re-opens Tx stream up to `attempts` times (with `backoff` pause between
+// attempts) and restores positions of cursors. 0 - disabled: tx fails after connection loss
+func (opts remoteOpts) Reconnect(attempts int, backoff time.Duration) remoteOpts {
+	opts.reconnectAttempts, opts.reconnectBackoff = attempts, backoff
+	return opts
+}
+
 func (opts remoteOpts) Open() (*RemoteKV, error) {
 	db := &RemoteKV{
 		opts:     opts,
@@ -164,6 +208,9 @@ func (tx *remoteTx) ReadSequence(bucket string) (uint64, error) {
 }
 func (tx *remoteTx) Append(bucket string, k, v []byte) error    { panic("no write methods") }
 func (tx *remoteTx) AppendDup(bucket string, k, v []byte) error { panic("no write methods") }
+func (tx *remoteTx) DeleteRange(bucket string, fromKey, toKey []byte) error {
+	return fmt.Errorf("%w: DeleteRange of remote db, table: %s", kv.ErrNotSupported, bucket)
+}
 
 func (tx *remoteTx) Commit() error {
 	panic("remote db is read-only")
@@ -171,6 +218,10 @@ func (tx *remoteTx) Commit() error {
 
 func (tx *remoteTx) Rollback() {
 	// don't close opened cursors - just close stream, server will cleanup everything well
+	for _, s := range tx.rangeStreams {
+		s.Close()
+	}
+	tx.rangeStreams = nil
 	tx.closeGrpcStream()
 }
 func (tx *remoteTx) DBSize() (uint64, error) { panic("not implemented") }
@@ -193,67 +244,239 @@ func (tx *remoteTx) statelessCursor(bucket string) (kv.Cursor, error) {
 
 func (tx *remoteTx) BucketSize(name string) (uint64, error) { panic("not implemented") }
 
-// TODO: this must be optimized - and implemented as single command on server, with server-side buffered streaming
-func (tx *remoteTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
-	c, err := tx.Cursor(bucket)
+func (tx *remoteTx) TableStats(name string) (kv.TableStats, error) {
+	var reply *remote.TableStatsReply
+	err := tx.withReconnect(func() (err error) {
+		reply, err = tx.db.remoteKV.TableStats(tx.ctx, &remote.TableStatsReq{TxID: tx.id, Table: name})
+		return err
+	})
 	if err != nil {
+		return kv.TableStats{}, err
+	}
+	return kv.TableStats{
+		Entries:       reply.Entries,
+		LeafPages:     reply.LeafPages,
+		BranchPages:   reply.BranchPages,
+		OverflowPages: reply.OverflowPages,
+		Bytes:         reply.Bytes,
+	}, nil
+}
+
+// GetMany - 1 round-trip for all keys
+func (tx *remoteTx) GetMany(bucket string, keys [][]byte) ([][]byte, error) {
+	var reply *remote.GetManyReply
+	err := tx.withReconnect(func() (err error) {
+		reply, err = tx.db.remoteKV.GetMany(tx.ctx, &remote.GetManyReq{TxID: tx.id, Table: bucket, Keys: keys})
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	defer c.Close()
+	if len(reply.Values) != len(keys) || len(reply.Found) != len(keys) {
+		return nil, fmt.Errorf("GetMany: unexpected amount of values: %d, expected: %d", len(reply.Values), len(keys))
+	}
+	vals := make([][]byte, len(keys))
+	for i := range vals {
+		if !reply.Found[i] {
+			continue
+		}
+		if reply.Values[i] == nil {
+			vals[i] = []byte{}
+		} else {
+			vals[i] = reply.Values[i]
+		}
+	}
+	return vals, nil
+}
 
-	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
-		if err != nil {
+func (tx *remoteTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.forRange(bucket, fromPrefix, nil, -1, walker)
+}
+
+func (tx *remoteTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+	toPrefix, ok := kv.NextSubtree(prefix)
+	if !ok {
+		toPrefix = nil
+	}
+	return tx.forRange(bucket, prefix, toPrefix, -1, walker)
+}
+
+func (tx *remoteTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	return tx.forRange(bucket, fromPrefix, nil, int64(amount), walker)
+}
+
+// forRange - uses server-side streaming of pairs in [fromPrefix, toPrefix) from snapshot of this tx.
+// Falls back to cursor if server doesn't support Range or tx was renewed on server-side.
+func (tx *remoteTx) forRange(bucket string, fromPrefix, toPrefix []byte, limit int64, walker func(k, v []byte) error) error {
+	if !tx.db.rangeUnsupported.Load() {
+		handled, err := tx.rangeStream(bucket, fromPrefix, toPrefix, limit, walker)
+		if handled {
 			return err
 		}
-		if err := walker(k, v); err != nil {
-			return err
+	}
+	return tx.cursorRange(bucket, fromPrefix, toPrefix, limit, walker)
+}
+
+// rangeStream - returns handled=false if nothing was passed to walker and caller can retry by other method
+func (tx *remoteTx) rangeStream(bucket string, fromPrefix, toPrefix []byte, limit int64, walker func(k, v []byte) error) (handled bool, err error) {
+	ctx, cancel := context.WithCancel(tx.ctx)
+	defer cancel() // stop server-side streaming if walker returned error
+	stream, err := tx.db.remoteKV.Range(ctx, &remote.RangeReq{TxID: tx.id, Table: bucket, FromPrefix: fromPrefix, ToPrefix: toPrefix, Limit: limit, PageSize: int32(tx.db.opts.rangePageSize), PrefixCompression: true})
+	if err != nil {
+		return false, err
+	}
+	for {
+		page, err := stream.Recv()
+		if err != nil {
+			if grpcutil.IsEndOfStream(err) {
+				return true, nil
+			}
+			if !handled {
+				switch status.Code(err) {
+				case codes.Unimplemented:
+					tx.db.rangeUnsupported.Store(true)
+					return false, err
+				case codes.NotFound:
+					return false, err
+				}
+			}
+			return true, err
+		}
+		handled = true
+		if err := page.DecompressKeys(nil); err != nil {
+			return true, err
+		}
+		for i := range page.Keys {
+			if err := walker(page.Keys[i], page.Values[i]); err != nil {
+				return true, err
+			}
 		}
 	}
-	return nil
 }
 
-// TODO: this must be optimized - and implemented as single command on server, with server-side buffered streaming
-func (tx *remoteTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+func (tx *remoteTx) cursorRange(bucket string, fromPrefix, toPrefix []byte, limit int64, walker func(k, v []byte) error) error {
 	c, err := tx.Cursor(bucket)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+	for k, v, err := c.Seek(fromPrefix); k != nil && limit != 0; k, v, err = c.Next() {
 		if err != nil {
 			return err
 		}
-		if !bytes.HasPrefix(k, prefix) {
+		if toPrefix != nil && bytes.Compare(k, toPrefix) >= 0 {
 			break
 		}
 		if err := walker(k, v); err != nil {
 			return err
 		}
+		if limit > 0 {
+			limit--
+		}
 	}
 	return nil
 }
 
-func (tx *remoteTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
-	if amount == 0 {
-		return nil
+// Range - reads pages of server-side Range from snapshot of this tx, next page is requested when previous is read.
+// Falls back to cursor same way as forRange.
+func (tx *remoteTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	if !tx.db.rangeUnsupported.Load() {
+		s, handled, err := tx.rangePages(table, fromPrefix, toPrefix)
+		if handled {
+			return s, err
+		}
 	}
-	c, err := tx.Cursor(bucket)
+	c, err := tx.Cursor(table)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer c.Close()
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
 
-	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+// rangePages - returns handled=false if server can't serve Range and caller can retry by other method
+func (tx *remoteTx) rangePages(table string, fromPrefix, toPrefix []byte) (s *rangeStream, handled bool, err error) {
+	ctx, cancel := context.WithCancel(tx.ctx)
+	stream, err := tx.db.remoteKV.Range(ctx, &remote.RangeReq{TxID: tx.id, Table: table, FromPrefix: fromPrefix, ToPrefix: toPrefix, PageSize: int32(tx.db.opts.rangePageSize), PrefixCompression: true})
+	if err != nil {
+		cancel()
+		return nil, false, err
+	}
+	s = &rangeStream{stream: stream, cancel: cancel}
+	s.recv()
+	if s.err != nil {
+		switch status.Code(s.err) {
+		case codes.Unimplemented:
+			tx.db.rangeUnsupported.Store(true)
+			return nil, false, s.err
+		case codes.NotFound:
+			return nil, false, s.err
+		}
+		return nil, true, s.err
+	}
+	tx.rangeStreams = append(tx.rangeStreams, s)
+	return s, true, nil
+}
+
+// rangeStream - iter.KV over pages of server-side Range
+type rangeStream struct {
+	stream remote.KV_RangeClient
+	cancel context.CancelFunc
+	page   *remote.Pairs
+	i      int
+	err    error
+}
+
+// recv - reads pages until non-empty one or end of stream
+func (s *rangeStream) recv() {
+	s.page, s.i = nil, 0
+	for {
+		page, err := s.stream.Recv()
 		if err != nil {
-			return err
+			if !grpcutil.IsEndOfStream(err) {
+				s.err = err
+			}
+			s.Close()
+			return
 		}
-		if err := walker(k, v); err != nil {
-			return err
+		if err := page.DecompressKeys(nil); err != nil {
+			s.err = err
+			s.Close()
+			return
+		}
+		if len(page.Keys) > 0 {
+			s.page = page
+			return
 		}
-		amount--
 	}
-	return nil
+}
+
+func (s *rangeStream) HasNext() bool { return s.err != nil || s.page != nil }
+
+func (s *rangeStream) Next() ([]byte, []byte, error) {
+	if s.err != nil {
+		err := s.err
+		s.err = nil
+		return nil, nil, err
+	}
+	if s.page == nil {
+		return nil, nil, nil
+	}
+	k, v := s.page.Keys[s.i], s.page.Values[s.i]
+	s.i++
+	if s.i == len(s.page.Keys) {
+		s.recv()
+	}
+	return k, v, nil
+}
+
+// Close - stops server-side streaming
+func (s *rangeStream) Close() {
+	s.page = nil
+	s.cancel()
 }
 
 func (tx *remoteTx) GetOne(bucket string, key []byte) (val []byte, err error) {
@@ -287,17 +510,23 @@ func (c *remoteCursor) Prev() ([]byte, []byte, error) {
 
 func (tx *remoteTx) Cursor(bucket string) (kv.Cursor, error) {
 	b := tx.db.buckets[bucket]
-	c := &remoteCursor{tx: tx, ctx: tx.ctx, bucketName: bucket, bucketCfg: b, stream: tx.stream}
-	tx.cursors = append(tx.cursors, c)
-	if err := c.stream.Send(&remote.Cursor{Op: remote.Op_OPEN, BucketName: c.bucketName}); err != nil {
+	c := &remoteCursor{tx: tx, ctx: tx.ctx, bucketName: bucket, bucketCfg: b}
+	if err := tx.withReconnect(c.open); err != nil {
 		return nil, err
 	}
-	msg, err := c.stream.Recv()
+	tx.cursors = append(tx.cursors, c) // after open: reconnect must not re-open cursor which is not opened yet
+	return c, nil
+}
+
+// open - opens cursor on current stream of tx
+func (c *remoteCursor) open() error {
+	c.stream = c.tx.stream
+	msg, err := c.send(&remote.Cursor{Op: remote.Op_OPEN, BucketName: c.bucketName})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	c.id = msg.CursorID
-	return c, nil
+	return nil
 }
 
 func (c *remoteCursor) Put(key []byte, value []byte) error            { panic("not supported") }
@@ -308,10 +537,8 @@ func (c *remoteCursor) DeleteCurrent() error                          { panic("n
 func (c *remoteCursor) Count() (uint64, error)                        { panic("not supported") }
 
 func (c *remoteCursor) first() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_FIRST}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_FIRST})
 	if err != nil {
 		return []byte{}, nil, err
 	}
@@ -319,140 +546,170 @@ func (c *remoteCursor) first() ([]byte, []byte, error) {
 }
 
 func (c *remoteCursor) next() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT}); err != nil {
-		return []byte{}, nil, err
+	if c.batch != nil {
+		k, v := c.nextFromBatch()
+		return k, v, nil
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT, Batch: uint32(c.tx.db.opts.cursorBatch)})
 	if err != nil {
 		return []byte{}, nil, err
 	}
+	if pair.Batch != nil && (len(pair.Batch.Keys) > 0 || pair.BatchEOF) { // old server replies without batch
+		if err := pair.Batch.DecompressKeys(pair.K); err != nil {
+			return []byte{}, nil, err
+		}
+		c.batch, c.batchPos, c.batchEOF = pair.Batch, 0, pair.BatchEOF
+		c.k, c.v = pair.K, pair.V
+	}
 	return pair.K, pair.V, nil
 }
+
+// nextFromBatch - returns next pair of batch, also stores it in c.k, c.v
+func (c *remoteCursor) nextFromBatch() ([]byte, []byte) {
+	if c.batchPos == len(c.batch.Keys) { // batchEOF: server's cursor is at end of table too
+		c.batch, c.k, c.v = nil, nil, nil
+		return nil, nil
+	}
+	c.k, c.v = c.batch.Keys[c.batchPos], c.batch.Values[c.batchPos]
+	c.batchPos++
+	if c.batchPos == len(c.batch.Keys) && !c.batchEOF { // server's cursor is at this pair
+		c.batch = nil
+	}
+	return c.k, c.v
+}
+
+// restorePosition - must be called before ops relative to current position of cursor
+func (c *remoteCursor) restorePosition() error {
+	if c.batch == nil {
+		return nil
+	}
+	c.batch = nil
+	_, err := c.roundTrip(c.seekPositionReq())
+	return err
+}
+
+// seekPositionReq - request which moves server's cursor to (c.k, c.v)
+func (c *remoteCursor) seekPositionReq() *remote.Cursor {
+	if c.bucketCfg.Flags&kv.DupSort != 0 && !c.bucketCfg.AutoDupSortKeysConversion {
+		return &remote.Cursor{Op: remote.Op_SEEK_BOTH_EXACT, K: c.k, V: c.v}
+	}
+	return &remote.Cursor{Op: remote.Op_SEEK_EXACT, K: c.k}
+}
 func (c *remoteCursor) nextDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) nextNoDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT_NO_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT_NO_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prev() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prevDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prevNoDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV_NO_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV_NO_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) last() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_LAST}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_LAST})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) setRange(k []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK, K: k}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK, K: k})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) seekExact(k []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_EXACT, K: k}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_EXACT, K: k})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) getBothRange(k, v []byte) ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_BOTH, K: k, V: v}); err != nil {
-		return nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_BOTH, K: k, V: v})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) seekBothExact(k, v []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_BOTH_EXACT, K: k, V: v}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.batch = nil
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_BOTH_EXACT, K: k, V: v})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) firstDup() ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_FIRST_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_FIRST_DUP})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) lastDup() ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_LAST_DUP}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_LAST_DUP})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) getCurrent() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_CURRENT}); err != nil {
+	if err := c.restorePosition(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_CURRENT})
 	if err != nil {
 		return []byte{}, nil, err
 	}
@@ -542,6 +799,51 @@ func (c *remoteCursorDupSort) SeekBothRange(key, value []byte) ([]byte, error) {
 	return c.getBothRange(key, value)
 }
 
+// SeekBothRangeMulti - sends all requests without waiting for responses: one network round-trip instead of len(keys).
+// Server handles cursor ops in-order, so responses come in same order as requests.
+func (c *remoteCursorDupSort) SeekBothRangeMulti(keys, values [][]byte) ([][]byte, error) {
+	var res [][]byte
+	err := c.tx.withReconnect(func() (err error) {
+		res, err = c.seekBothRangeMulti(keys, values)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		c.k, c.v, c.moved = keys[len(keys)-1], res[len(res)-1], true
+	}
+	return res, nil
+}
+
+func (c *remoteCursorDupSort) seekBothRangeMulti(keys, values [][]byte) ([][]byte, error) {
+	c.batch = nil
+	st := c.stream
+	sendErr := make(chan error, 1)
+	go func() { // sending in separated goroutine - to not deadlock on grpc flow-control when responses are big
+		for i := range keys {
+			if err := st.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_BOTH, K: keys[i], V: values[i]}); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- nil
+	}()
+	res := make([][]byte, len(keys))
+	for i := range keys {
+		pair, err := st.Recv()
+		if err != nil {
+			<-sendErr
+			return nil, err
+		}
+		res[i] = pair.V
+	}
+	if err := <-sendErr; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (c *remoteCursorDupSort) DeleteExact(k1, k2 []byte) error      { panic("not supported") }
 func (c *remoteCursorDupSort) AppendDup(k []byte, v []byte) error   { panic("not supported") }
 func (c *remoteCursorDupSort) PutNoDupData(key, value []byte) error { panic("not supported") }
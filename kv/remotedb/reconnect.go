@@ -0,0 +1,195 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCursorPositionLost - after reconnect to newer view record under cursor doesn't exist anymore.
+// Ops relative to current position (Next, Prev, Current, ...) fail until cursor is positioned again (First, Seek, ...)
+var ErrCursorPositionLost = errors.New("remotedb: cursor position lost after reconnect")
+
+// ViewChanged - true if tx is remote and it was reconnected (see remoteOpts.Reconnect) to newer view than it was opened:
+// data read before and after reconnect may be inconsistent
+func ViewChanged(tx kv.Tx) bool {
+	rtx, ok := tx.(*remoteTx)
+	return ok && rtx.viewChanged
+}
+
+// relativeOps - depend on current position of cursor
+var relativeOps = map[remote.Op]bool{
+	remote.Op_NEXT: true, remote.Op_NEXT_DUP: true, remote.Op_NEXT_NO_DUP: true,
+	remote.Op_PREV: true, remote.Op_PREV_DUP: true, remote.Op_PREV_NO_DUP: true,
+	remote.Op_CURRENT: true, remote.Op_FIRST_DUP: true, remote.Op_LAST_DUP: true,
+}
+
+func (tx *remoteTx) canReconnect(err error) bool {
+	return tx.db.opts.reconnectAttempts > 0 && status.Code(err) == codes.Unavailable && tx.ctx.Err() == nil
+}
+
+// withReconnect - calls f once more after reconnect if connection was lost
+func (tx *remoteTx) withReconnect(f func() error) error {
+	err := f()
+	if err == nil || !tx.canReconnect(err) {
+		return err
+	}
+	if err = tx.reconnect(err); err != nil {
+		return err
+	}
+	return f()
+}
+
+func (tx *remoteTx) reconnect(cause error) error {
+	opts := tx.db.opts
+	var err error
+	for attempt := 1; attempt <= opts.reconnectAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-tx.ctx.Done():
+				return tx.ctx.Err()
+			case <-time.After(opts.reconnectBackoff):
+			}
+		}
+		if err = tx.reopen(); err == nil {
+			tx.db.log.Warn("[remotedb] tx reconnected", "cause", cause, "attempt", attempt, "view_changed", tx.viewChanged)
+			return nil
+		}
+		if !tx.canReconnect(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("remotedb: reconnect failed after %d attempts: %w", opts.reconnectAttempts, err)
+}
+
+// reopen - opens new Tx stream and restores open cursors on it. MDBX can't open read transaction at old view:
+// if view is newer - tx is flagged, cursors are restored only if record under them still exists
+func (tx *remoteTx) reopen() error {
+	if tx.streamCancelFn != nil {
+		tx.streamCancelFn() // old stream is broken
+	}
+	streamCtx, streamCancelFn := context.WithCancel(tx.ctx)
+	stream, err := tx.db.remoteKV.Tx(streamCtx)
+	if err != nil {
+		streamCancelFn()
+		return err
+	}
+	msg, err := stream.Recv()
+	if err != nil {
+		streamCancelFn()
+		return err
+	}
+	tx.stream, tx.streamCancelFn, tx.streamingRequested = stream, streamCancelFn, false
+	if msg.TxID != tx.id {
+		tx.viewChanged = true
+	}
+	tx.id = msg.TxID
+
+	for _, c := range tx.cursors {
+		if c.stream == nil { // closed
+			continue
+		}
+		if err := c.reopen(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *remoteCursor) reopen() error {
+	c.batch = nil
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.k == nil {
+		c.lost = c.moved // was at end of table
+		return nil
+	}
+	req := c.seekPositionReq()
+	req.Cursor = c.id
+	pair, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	c.lost = !bytes.Equal(pair.K, c.k) || (req.Op == remote.Op_SEEK_BOTH_EXACT && !bytes.Equal(pair.V, c.v))
+	return nil
+}
+
+// roundTrip - sends request of cursor and receives reply. If connection was lost - reconnects tx and retries once
+func (c *remoteCursor) roundTrip(req *remote.Cursor) (*remote.Pair, error) {
+	for retried := false; ; retried = true {
+		if c.lost && relativeOps[req.Op] {
+			return nil, ErrCursorPositionLost
+		}
+		req.Cursor = c.id
+		pair, err := c.send(req)
+		if err == nil {
+			c.track(req, pair)
+			return pair, nil
+		}
+		if retried || !c.tx.canReconnect(err) {
+			return nil, err
+		}
+		if err = c.tx.reconnect(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *remoteCursor) send(req *remote.Cursor) (*remote.Pair, error) {
+	if err := c.stream.Send(req); err != nil {
+		if errors.Is(err, io.EOF) { // stream is aborted - its status is returned by Recv
+			if _, recvErr := c.stream.Recv(); recvErr != nil {
+				err = recvErr
+			}
+		}
+		return nil, err
+	}
+	return c.stream.Recv()
+}
+
+// track - remembers position of cursor after op
+func (c *remoteCursor) track(req *remote.Cursor, pair *remote.Pair) {
+	switch req.Op {
+	case remote.Op_OPEN, remote.Op_CLOSE:
+		return
+	case remote.Op_SEEK_BOTH:
+		if pair.V == nil {
+			c.k, c.v = nil, nil
+		} else {
+			c.k, c.v = req.K, pair.V
+		}
+	case remote.Op_FIRST_DUP, remote.Op_LAST_DUP:
+		c.v = pair.V
+	default:
+		c.k, c.v = pair.K, pair.V
+	}
+	c.moved = true
+	if !relativeOps[req.Op] {
+		c.lost = false
+	}
+}
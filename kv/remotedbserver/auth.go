@@ -0,0 +1,143 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuthMetadataKey - client sends token in gRPC metadata: "authorization: Bearer <token>"
+const AuthMetadataKey = "authorization"
+
+var authRejected = metrics.NewCounter(`kv_server_auth_rejected`) //nolint
+
+// Auth - authentication of KvServer clients and tables they can read.
+// Client is identified by:
+//   - token in gRPC metadata - see AuthMetadataKey
+//   - or CommonName of verified client certificate - server must use mTLS (grpcutil.TLS with CA cert)
+//
+// KV service has no methods which write to db - clients can't change state, ACL limits only which tables they read.
+// Version method is available without authentication - clients use it for handshake.
+type Auth struct {
+	tokens map[[sha256.Size]byte]*ACL // by hash of token: lookup time doesn't depend on matched bytes of token
+	certs  map[string]*ACL            // by CommonName of client certificate
+}
+
+// ACL - what client can read
+type ACL struct {
+	Name   string   // of client - for logs and errors
+	Tables []string // allowlist of readable tables, empty - all tables
+	tables map[string]struct{}
+}
+
+func NewAuth() *Auth {
+	return &Auth{tokens: map[[sha256.Size]byte]*ACL{}, certs: map[string]*ACL{}}
+}
+
+func (acl ACL) init() *ACL {
+	if len(acl.Tables) > 0 {
+		acl.tables = make(map[string]struct{}, len(acl.Tables))
+		for _, t := range acl.Tables {
+			acl.tables[t] = struct{}{}
+		}
+	}
+	return &acl
+}
+
+// WithToken - client with this token has given access
+func (a *Auth) WithToken(token string, acl ACL) *Auth {
+	a.tokens[sha256.Sum256([]byte(token))] = acl.init()
+	return a
+}
+
+// WithCert - client with certificate of this CommonName has given access
+func (a *Auth) WithCert(commonName string, acl ACL) *Auth {
+	a.certs[commonName] = acl.init()
+	return a
+}
+
+// CanRead - nil ACL (server without Auth) can read everything
+func (acl *ACL) CanRead(table string) bool {
+	if acl == nil || acl.tables == nil {
+		return true
+	}
+	_, ok := acl.tables[table]
+	return ok
+}
+
+// CanReadAll - client has no allowlist
+func (acl *ACL) CanReadAll() bool { return acl == nil || acl.tables == nil }
+
+// authenticate - token is checked first, then client certificate
+func (a *Auth) authenticate(ctx context.Context) (*ACL, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, h := range md.Get(AuthMetadataKey) {
+			token := strings.TrimPrefix(h, "Bearer ")
+			if acl, ok := a.tokens[sha256.Sum256([]byte(token))]; ok {
+				return acl, nil
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			for _, chain := range tlsInfo.State.VerifiedChains {
+				if len(chain) == 0 {
+					continue
+				}
+				if acl, ok := a.certs[chain[0].Subject.CommonName]; ok {
+					return acl, nil
+				}
+			}
+		}
+	}
+	authRejected.Inc()
+	return nil, status.Error(codes.Unauthenticated, "kv server: unknown token or client certificate")
+}
+
+// authenticate - nil ACL if server has no Auth
+func (s *KvServer) authenticate(ctx context.Context) (*ACL, error) {
+	if s.auth == nil {
+		return nil, nil
+	}
+	return s.auth.authenticate(ctx)
+}
+
+// authorizeRead - authenticates client and checks that it can read table
+func (s *KvServer) authorizeRead(ctx context.Context, table string) error {
+	acl, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	return acl.checkRead(table)
+}
+
+func (acl *ACL) checkRead(table string) error {
+	if acl.CanRead(table) {
+		return nil
+	}
+	authRejected.Inc()
+	return status.Errorf(codes.PermissionDenied, "kv server: client %s can't read table %s", acl.Name, table)
+}
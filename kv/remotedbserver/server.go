@@ -17,16 +17,24 @@
 package remotedbserver
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sync"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvnotify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -41,7 +49,36 @@ const MaxTxTTL = 60 * time.Second
 // 5.0 - BlockTransaction table now has canonical ids (txs of non-canonical blocks moving to NonCanonicalTransaction table)
 // 5.1.0 - Added blockGasLimit to the StateChangeBatch
 // 6.0.0 - Blocks now have system-txs - in the begin/end of block
-var KvServiceAPIVersion = &types.VersionReply{Major: 6, Minor: 0, Patch: 0}
+// 6.1.0 - Added Range streaming method
+// 6.2.0 - Added TableStats method
+// 6.3.0 - Added GetMany method
+// 6.4.0 - Added table changes subscription to StateChanges stream
+// 6.5.0 - Added prefix compression of keys to Range stream and batching of NEXT to Tx stream
+var KvServiceAPIVersion = &types.VersionReply{Major: 6, Minor: 5, Patch: 0}
+
+// DefaultRangePageSize - amount of pairs in 1 message of Range stream
+const DefaultRangePageSize = 1024
+
+// MaxCursorBatch - max amount of pairs in 1 reply to NEXT of Tx stream
+const MaxCursorBatch = 1024
+
+// Limits - protection against clients which keep read transactions (and db pages pinned by them) forever.
+// Violation of limit closes Tx stream (or rejects request) with informative gRPC status. 0 - unlimited.
+type Limits struct {
+	MaxTxsPerClient int           // open Tx streams per client address
+	MaxCursorsPerTx int           // open cursors per Tx stream
+	TxIdleTimeout   time.Duration // Tx stream without requests for this time - released
+	TxMaxLifetime   time.Duration // Tx stream is released after this time - even if client is active
+}
+
+// DefaultLimits - no limits, callers opt-in by KvServer.WithLimits
+var DefaultLimits = Limits{}
+
+var (
+	txReleasedIdle     = metrics.NewCounter(`kv_server_tx_released{reason="idle"}`)     //nolint
+	txReleasedLifetime = metrics.NewCounter(`kv_server_tx_released{reason="lifetime"}`) //nolint
+	txRejected         = metrics.NewCounter(`kv_server_tx_rejected`)                    //nolint
+)
 
 type KvServer struct {
 	remote.UnimplementedKVServer // must be embedded to have forward compatible implementations.
@@ -49,10 +86,129 @@ type KvServer struct {
 	kv                 kv.RoDB
 	stateChangeStreams *StateChangePubSub
 	ctx                context.Context
+	limits             Limits
+	notifier           *kvnotify.Notifier // source of table changes, nil - table changes subscription is not supported
+	auth               *Auth              // nil - all clients can read all tables
+
+	// open transactions of Tx streams - by ViewID. Range method can read from them.
+	// txs with same ViewID see same snapshot - then any of them can be used.
+	txsMapLock sync.RWMutex
+	txs        map[uint64][]*threadSafeTx
+
+	clientsLock sync.Mutex
+	clients     map[string]int // amount of open Tx streams by client address
+}
+
+// threadSafeTx - Tx stream and Range method may use same tx from different goroutines
+type threadSafeTx struct {
+	kv.Tx        // nil after rollback
+	conn  string // connection of Tx stream: only requests of the same connection can read the tx
+	sync.Mutex
 }
 
 func NewKvServer(ctx context.Context, kv kv.RoDB) *KvServer {
-	return &KvServer{kv: kv, stateChangeStreams: newStateChangeStreams(), ctx: ctx}
+	return &KvServer{kv: kv, stateChangeStreams: newStateChangeStreams(), ctx: ctx, limits: DefaultLimits, txs: map[uint64][]*threadSafeTx{}, clients: map[string]int{}}
+}
+
+func (s *KvServer) WithLimits(limits Limits) *KvServer {
+	s.limits = limits
+	return s
+}
+
+// WithNotifier - enables StateChangeRequest.Tables: notifier must be the one of kvnotify.NotifyingDB which is written by node
+func (s *KvServer) WithNotifier(n *kvnotify.Notifier) *KvServer {
+	s.notifier = n
+	return s
+}
+
+// WithAuth - only authenticated clients can use server, they read only tables of their ACL
+func (s *KvServer) WithAuth(a *Auth) *KvServer {
+	s.auth = a
+	return s
+}
+
+// clientAddr - host of client, without port: limits are per host, not per connection
+func clientAddr(ctx context.Context) string {
+	addr := clientConn(ctx)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// clientConn - address of client with port: txs are found by connection, not by host - other processes of the
+// same host can't read them
+func clientConn(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// acquireClientTx - counts Tx streams of client, returns release func
+func (s *KvServer) acquireClientTx(client string) (release func(), err error) {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	if s.limits.MaxTxsPerClient > 0 && s.clients[client] >= s.limits.MaxTxsPerClient {
+		txRejected.Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "client %s has too many open transactions: %d, limit is %d - rollback unused", client, s.clients[client], s.limits.MaxTxsPerClient)
+	}
+	s.clients[client]++
+	return func() {
+		s.clientsLock.Lock()
+		defer s.clientsLock.Unlock()
+		if s.clients[client]--; s.clients[client] <= 0 {
+			delete(s.clients, client)
+		}
+	}, nil
+}
+
+func (s *KvServer) addTx(viewID uint64, tx *threadSafeTx) {
+	s.txsMapLock.Lock()
+	defer s.txsMapLock.Unlock()
+	s.txs[viewID] = append(s.txs[viewID], tx)
+}
+
+func (s *KvServer) removeTx(viewID uint64, tx *threadSafeTx) {
+	s.txsMapLock.Lock()
+	defer s.txsMapLock.Unlock()
+	list := s.txs[viewID]
+	for i := range list {
+		if list[i] == tx {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(s.txs, viewID)
+		return
+	}
+	s.txs[viewID] = list
+}
+
+// getTx - tx of client connection: clients may have txs of the same viewID
+func (s *KvServer) getTx(viewID uint64, conn string) (*threadSafeTx, bool) {
+	s.txsMapLock.RLock()
+	defer s.txsMapLock.RUnlock()
+	for _, txn := range s.txs[viewID] {
+		if txn.conn == conn {
+			return txn, true
+		}
+	}
+	return nil, false
+}
+
+// lockTx - tx of client connection with given viewID, locked. Tx stream renews and rolls back tx while it's not
+// locked - so it's checked after lock. Caller must unlock
+func (s *KvServer) lockTx(viewID uint64, conn string) (*threadSafeTx, error) {
+	if txn, ok := s.getTx(viewID, conn); ok {
+		txn.Lock()
+		if txn.Tx != nil && txn.Tx.ViewID() == viewID {
+			return txn, nil
+		}
+		txn.Unlock()
+	}
+	return nil, status.Errorf(codes.NotFound, "tx %d not found (or was renewed)", viewID)
 }
 
 // Version returns the service-side interface version number
@@ -74,16 +230,35 @@ func (s *KvServer) Version(context.Context, *emptypb.Empty) (*types.VersionReply
 }
 
 func (s *KvServer) Tx(stream remote.KV_TxServer) error {
+	acl, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	client := clientAddr(stream.Context())
+	releaseClient, err := s.acquireClientTx(client)
+	if err != nil {
+		return err
+	}
+	defer releaseClient()
+
 	tx, errBegin := s.kv.BeginRo(stream.Context())
 	if errBegin != nil {
 		return fmt.Errorf("server-side error: %w", errBegin)
 	}
-	rollback := func() {
-		tx.Rollback()
-	}
-	defer rollback()
+	txn := &threadSafeTx{Tx: tx, conn: clientConn(stream.Context())}
+	viewID := tx.ViewID()
+	s.addTx(viewID, txn)
+	defer func() {
+		s.removeTx(viewID, txn)
+		txn.Lock()
+		defer txn.Unlock()
+		if txn.Tx != nil {
+			txn.Rollback()
+			txn.Tx = nil
+		}
+	}()
 
-	if err := stream.Send(&remote.Pair{TxID: tx.ViewID()}); err != nil {
+	if err := stream.Send(&remote.Pair{TxID: viewID}); err != nil {
 		return fmt.Errorf("server-side error: %w", err)
 	}
 
@@ -98,60 +273,65 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 	txTicker := time.NewTicker(MaxTxTTL)
 	defer txTicker.Stop()
 
-	// send all items to client, if k==nil - still send it to client and break loop
-	for {
-		in, recvErr := stream.Recv()
-		if recvErr != nil {
-			if errors.Is(recvErr, io.EOF) { // termination
-				return nil
+	renew := func() error {
+		for _, c := range cursors { // save positions of cursor, will restore after Tx reopening
+			k, v, err := c.c.Current()
+			if err != nil {
+				return err
 			}
-			return fmt.Errorf("server-side error: %w", recvErr)
+			c.k = bytesCopy(k)
+			c.v = bytesCopy(v)
 		}
 
-		//TODO: protect against client - which doesn't send any requests
-		select {
-		default:
-		case <-txTicker.C:
-			for _, c := range cursors { // save positions of cursor, will restore after Tx reopening
-				k, v, err := c.c.Current()
-				if err != nil {
-					return err
-				}
-				c.k = bytesCopy(k)
-				c.v = bytesCopy(v)
-			}
+		s.removeTx(viewID, txn)
+		txn.Rollback()
+		txn.Tx = nil
+		tx, errBegin := s.kv.BeginRo(stream.Context())
+		if errBegin != nil {
+			return fmt.Errorf("server-side error, BeginRo: %w", errBegin)
+		}
+		txn.Tx = tx
+		viewID = tx.ViewID()
+		s.addTx(viewID, txn)
 
-			tx.Rollback()
-			tx, errBegin = s.kv.BeginRo(stream.Context())
-			if errBegin != nil {
-				return fmt.Errorf("server-side error, BeginRo: %w", errBegin)
+		for _, c := range cursors { // restore all cursors position
+			var err error
+			c.c, err = tx.Cursor(c.bucket)
+			if err != nil {
+				return err
 			}
-
-			for _, c := range cursors { // restore all cursors position
-				var err error
-				c.c, err = tx.Cursor(c.bucket)
+			switch casted := c.c.(type) {
+			case kv.CursorDupSort:
+				v, err := casted.SeekBothRange(c.k, c.v)
 				if err != nil {
-					return err
+					return fmt.Errorf("server-side error: %w", err)
 				}
-				switch casted := c.c.(type) {
-				case kv.CursorDupSort:
-					v, err := casted.SeekBothRange(c.k, c.v)
+				if v == nil { // it may happen that key where we stopped disappeared after transaction reopen, then just move to next key
+					_, _, err = casted.Next()
 					if err != nil {
 						return fmt.Errorf("server-side error: %w", err)
 					}
-					if v == nil { // it may happen that key where we stopped disappeared after transaction reopen, then just move to next key
-						_, _, err = casted.Next()
-						if err != nil {
-							return fmt.Errorf("server-side error: %w", err)
-						}
-					}
-				case kv.Cursor:
-					if _, _, err := c.c.Seek(c.k); err != nil {
-						return fmt.Errorf("server-side error: %w", err)
-					}
+				}
+			case kv.Cursor:
+				if _, _, err := c.c.Seek(c.k); err != nil {
+					return fmt.Errorf("server-side error: %w", err)
 				}
 			}
 		}
+		return nil
+	}
+
+	handle := func(in *remote.Cursor) error {
+		txn.Lock()
+		defer txn.Unlock()
+
+		select {
+		default:
+		case <-txTicker.C:
+			if err := renew(); err != nil {
+				return err
+			}
+		}
 
 		var c kv.Cursor
 		if in.BucketName == "" {
@@ -163,9 +343,15 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 		}
 		switch in.Op {
 		case remote.Op_OPEN:
+			if s.limits.MaxCursorsPerTx > 0 && len(cursors) >= s.limits.MaxCursorsPerTx {
+				return status.Errorf(codes.ResourceExhausted, "too many open cursors in tx %d: %d, limit is %d - close unused", viewID, len(cursors), s.limits.MaxCursorsPerTx)
+			}
+			if err := acl.checkRead(in.BucketName); err != nil {
+				return err
+			}
 			CursorID++
 			var err error
-			c, err = tx.Cursor(in.BucketName)
+			c, err = txn.Cursor(in.BucketName)
 			if err != nil {
 				return err
 			}
@@ -176,7 +362,7 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 			if err := stream.Send(&remote.Pair{CursorID: CursorID}); err != nil {
 				return fmt.Errorf("server-side error: %w", err)
 			}
-			continue
+			return nil
 		case remote.Op_CLOSE:
 			cInfo, ok := cursors[in.Cursor]
 			if !ok {
@@ -187,13 +373,76 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 			if err := stream.Send(&remote.Pair{}); err != nil {
 				return fmt.Errorf("server-side error: %w", err)
 			}
-			continue
+			return nil
 		default:
 		}
 
 		if err := handleOp(c, stream, in); err != nil {
 			return fmt.Errorf("server-side error: %w", err)
 		}
+		return nil
+	}
+
+	// Recv is blocking - read requests in background, to release tx of client which doesn't send any requests
+	type recvResult struct {
+		in  *remote.Cursor
+		err error
+	}
+	requests := make(chan recvResult)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			select {
+			case requests <- recvResult{in: in, err: err}:
+			case <-stream.Context().Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var idle *time.Timer
+	var idleC, lifetimeC <-chan time.Time
+	if s.limits.TxIdleTimeout > 0 {
+		idle = time.NewTimer(s.limits.TxIdleTimeout)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+	if s.limits.TxMaxLifetime > 0 {
+		lifetime := time.NewTimer(s.limits.TxMaxLifetime)
+		defer lifetime.Stop()
+		lifetimeC = lifetime.C
+	}
+
+	// send all items to client, if k==nil - still send it to client and break loop
+	for {
+		var req recvResult
+		select {
+		case req = <-requests:
+		case <-idleC:
+			txReleasedIdle.Inc()
+			return status.Errorf(codes.DeadlineExceeded, "tx %d of client %s released by server: no requests for %s", viewID, client, s.limits.TxIdleTimeout)
+		case <-lifetimeC:
+			txReleasedLifetime.Inc()
+			return status.Errorf(codes.DeadlineExceeded, "tx %d of client %s released by server: open for more than %s", viewID, client, s.limits.TxMaxLifetime)
+		}
+		if req.err != nil {
+			if errors.Is(req.err, io.EOF) { // termination
+				return nil
+			}
+			return fmt.Errorf("server-side error: %w", req.err)
+		}
+		if err := handle(req.in); err != nil {
+			return err
+		}
+		if idle != nil {
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(s.limits.TxIdleTimeout)
+		}
 	}
 }
 
@@ -244,13 +493,41 @@ func handleOp(c kv.Cursor, stream remote.KV_TxServer, in *remote.Cursor) error {
 		return err
 	}
 
-	if err := stream.Send(&remote.Pair{K: k, V: v}); err != nil {
+	reply := &remote.Pair{K: k, V: v}
+	if in.Op == remote.Op_NEXT && in.Batch > 1 && k != nil {
+		reply.K, reply.V = bytesCopy(k), bytesCopy(v) // k, v are invalid after next move of cursor
+		if reply.Batch, reply.BatchEOF, err = nextBatch(c, int(in.Batch)-1); err != nil {
+			return err
+		}
+		reply.Batch.CompressKeys(reply.K)
+	}
+	if err := stream.Send(reply); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// nextBatch - up to n next pairs, eof=true if cursor reached end of table
+func nextBatch(c kv.Cursor, n int) (batch *remote.Pairs, eof bool, err error) {
+	if n > MaxCursorBatch {
+		n = MaxCursorBatch
+	}
+	batch = &remote.Pairs{Keys: make([][]byte, 0, n), Values: make([][]byte, 0, n)}
+	for i := 0; i < n; i++ {
+		k, v, err := c.Next()
+		if err != nil {
+			return nil, false, err
+		}
+		if k == nil {
+			return batch, true, nil
+		}
+		batch.Keys = append(batch.Keys, bytesCopy(k))
+		batch.Values = append(batch.Values, bytesCopy(v))
+	}
+	return batch, false, nil
+}
+
 func bytesCopy(b []byte) []byte {
 	if b == nil {
 		return nil
@@ -260,7 +537,203 @@ func bytesCopy(b []byte) []byte {
 	return copiedBytes
 }
 
+// Range - streams pairs of table in range [req.FromPrefix, req.ToPrefix) by pages of req.PageSize
+func (s *KvServer) Range(req *remote.RangeReq, stream remote.KV_RangeServer) error {
+	if err := s.authorizeRead(stream.Context(), req.Table); err != nil {
+		return err
+	}
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = DefaultRangePageSize
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	var roTx kv.Tx
+	if req.TxID == 0 {
+		var err error
+		if roTx, err = s.kv.BeginRo(stream.Context()); err != nil {
+			return fmt.Errorf("server-side error: %w", err)
+		}
+		defer roTx.Rollback()
+	}
+	conn := clientConn(stream.Context())
+
+	// tx of client is locked only while page is read, not while it's sent: client may read the same tx while it
+	// consumes the stream. Next page is read from position after the last pair of previous page
+	var lastK, lastV []byte
+	var sameKey int // amount of sent pairs with lastK
+	readPage := func(tx kv.Tx) (page *remote.Pairs, eof bool, err error) {
+		c, err := tx.Cursor(req.Table)
+		if err != nil {
+			return nil, false, err
+		}
+		defer c.Close()
+		var k, v []byte
+		if lastK == nil {
+			k, v, err = c.Seek(req.FromPrefix)
+		} else {
+			k, v, err = seekAfter(c, lastK, lastV, sameKey)
+		}
+		page = &remote.Pairs{}
+		for ; limit != 0; k, v, err = c.Next() {
+			if err != nil {
+				return nil, false, err
+			}
+			if k == nil || (len(req.ToPrefix) > 0 && bytes.Compare(k, req.ToPrefix) >= 0) {
+				return page, true, nil
+			}
+			if len(page.Keys) >= pageSize {
+				return page, false, nil
+			}
+			if bytes.Equal(k, lastK) {
+				sameKey++
+			} else {
+				lastK, sameKey = bytesCopy(k), 1
+			}
+			lastV = bytesCopy(v)
+			page.Keys = append(page.Keys, lastK)
+			page.Values = append(page.Values, lastV)
+			if limit > 0 {
+				limit--
+			}
+		}
+		return page, true, nil
+	}
+
+	for {
+		var page *remote.Pairs
+		var eof bool
+		var err error
+		if roTx != nil {
+			page, eof, err = readPage(roTx)
+		} else {
+			txn, lockErr := s.lockTx(req.TxID, conn)
+			if lockErr != nil {
+				return lockErr
+			}
+			page, eof, err = readPage(txn.Tx)
+			txn.Unlock()
+		}
+		if err != nil {
+			return fmt.Errorf("server-side error: %w", err)
+		}
+		if len(page.Keys) > 0 {
+			if req.PrefixCompression {
+				page.CompressKeys(nil)
+			}
+			if err := stream.Send(page); err != nil {
+				return err
+			}
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// seekAfter - positions cursor at the pair next after (k, v), sameKey - amount of pairs with key k before it (including)
+func seekAfter(c kv.Cursor, k, v []byte, sameKey int) ([]byte, []byte, error) {
+	if dc, ok := c.(kv.CursorDupSort); ok {
+		if _, _, err := dc.SeekBothExact(k, v); err != nil {
+			return nil, nil, err
+		}
+		return c.Next()
+	}
+	ck, cv, err := c.Seek(k)
+	for i := 0; i < sameKey && ck != nil && err == nil; i++ {
+		ck, cv, err = c.Next()
+	}
+	return ck, cv, err
+}
+
+// TableStats - size statistics of req.Table
+func (s *KvServer) TableStats(ctx context.Context, req *remote.TableStatsReq) (*remote.TableStatsReply, error) {
+	if err := s.authorizeRead(ctx, req.Table); err != nil {
+		return nil, err
+	}
+	var st kv.TableStats
+	if req.TxID == 0 {
+		if err := s.kv.View(ctx, func(tx kv.Tx) (err error) {
+			st, err = kv.ReadTableStats(tx, req.Table)
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("server-side error: %w", err)
+		}
+	} else {
+		txn, err := s.lockTx(req.TxID, clientConn(ctx))
+		if err != nil {
+			return nil, err
+		}
+		st, err = kv.ReadTableStats(txn.Tx, req.Table)
+		txn.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("server-side error: %w", err)
+		}
+	}
+	return &remote.TableStatsReply{
+		Entries:       st.Entries,
+		LeafPages:     st.LeafPages,
+		BranchPages:   st.BranchPages,
+		OverflowPages: st.OverflowPages,
+		Bytes:         st.Bytes,
+	}, nil
+}
+
+// GetMany - values of req.Keys. Values are copied: reply is marshaled after end of read transaction
+func (s *KvServer) GetMany(ctx context.Context, req *remote.GetManyReq) (*remote.GetManyReply, error) {
+	if err := s.authorizeRead(ctx, req.Table); err != nil {
+		return nil, err
+	}
+	reply := &remote.GetManyReply{Values: make([][]byte, len(req.Keys)), Found: make([]bool, len(req.Keys))}
+	get := func(tx kv.Tx) error {
+		vals, err := kv.GetMany(tx, req.Table, req.Keys)
+		if err != nil {
+			return err
+		}
+		for i, v := range vals {
+			reply.Values[i], reply.Found[i] = common.Copy(v), v != nil
+		}
+		return nil
+	}
+	if req.TxID == 0 {
+		if err := s.kv.View(ctx, get); err != nil {
+			return nil, fmt.Errorf("server-side error: %w", err)
+		}
+		return reply, nil
+	}
+	txn, err := s.lockTx(req.TxID, clientConn(ctx))
+	if err != nil {
+		return nil, err
+	}
+	err = get(txn.Tx)
+	txn.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("server-side error: %w", err)
+	}
+	return reply, nil
+}
+
+// StateChanges - block changes have accounts, storage and transactions: only clients without tables allowlist can subscribe to them
 func (s *KvServer) StateChanges(req *remote.StateChangeRequest, server remote.KV_StateChangesServer) error {
+	acl, err := s.authenticate(server.Context())
+	if err != nil {
+		return err
+	}
+	if len(req.Tables) > 0 {
+		for _, f := range req.Tables {
+			if err := acl.checkRead(f.Table); err != nil {
+				return err
+			}
+		}
+		return s.tableChanges(req, server)
+	}
+	if !acl.CanReadAll() {
+		authRejected.Inc()
+		return status.Errorf(codes.PermissionDenied, "kv server: client %s can't subscribe to block state changes", acl.Name)
+	}
 	ch, remove := s.stateChangeStreams.Sub()
 	defer remove()
 	for {
@@ -277,6 +750,30 @@ func (s *KvServer) StateChanges(req *remote.StateChangeRequest, server remote.KV
 	}
 }
 
+// tableChanges - subscriber of tables receives only batches with TableChanges
+func (s *KvServer) tableChanges(req *remote.StateChangeRequest, server remote.KV_StateChangesServer) error {
+	if s.notifier == nil {
+		return status.Error(codes.Unimplemented, "table changes subscription is not enabled on server")
+	}
+	ch, unsubscribe := s.notifier.Subscribe(8, kvnotify.FiltersFromRemote(req.Tables)...)
+	defer unsubscribe()
+	for {
+		select {
+		case n, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := server.Send(kvnotify.ToRemote(n)); err != nil {
+				return err
+			}
+		case <-s.ctx.Done():
+			return nil
+		case <-server.Context().Done():
+			return nil
+		}
+	}
+}
+
 func (s *KvServer) SendStateChanges(ctx context.Context, sc *remote.StateChangeBatch) {
 	s.stateChangeStreams.Pub(sc)
 }
@@ -0,0 +1,149 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type rangeStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	pages []*remote.Pairs
+}
+
+func (s *rangeStream) Context() context.Context { return s.ctx }
+func (s *rangeStream) Send(p *remote.Pairs) error {
+	s.pages = append(s.pages, p)
+	return nil
+}
+
+func (s *rangeStream) pairs() (keys, values []string) {
+	for _, p := range s.pages {
+		for i := range p.Keys {
+			keys, values = append(keys, string(p.Keys[i])), append(values, string(p.Values[i]))
+		}
+	}
+	return keys, values
+}
+
+func clientCtx(port int) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}})
+}
+
+func testDB(t *testing.T) kv.RwDB {
+	db := memdb.NewTestDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, k := range []string{"a1", "a2", "b1", "b2", "b3", "c1"} {
+			if err := tx.Put(kv.HashedAccounts, []byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		for _, v := range []string{"1", "2", "3", "4", "5"} {
+			if err := tx.Put(kv.AccountChangeSet, []byte("k"), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return tx.Put(kv.AccountChangeSet, []byte("l"), []byte("6"))
+	}))
+	return db
+}
+
+func TestRangePages(t *testing.T) {
+	db := testDB(t)
+	s := NewKvServer(context.Background(), db)
+
+	stream := &rangeStream{ctx: clientCtx(1)}
+	require.NoError(t, s.Range(&remote.RangeReq{Table: kv.HashedAccounts, FromPrefix: []byte("a2"), ToPrefix: []byte("c"), PageSize: 2}, stream))
+	require.Equal(t, 2, len(stream.pages))
+	keys, values := stream.pairs()
+	require.Equal(t, []string{"a2", "b1", "b2", "b3"}, keys)
+	require.Equal(t, []string{"va2", "vb1", "vb2", "vb3"}, values)
+
+	stream = &rangeStream{ctx: clientCtx(1)}
+	require.NoError(t, s.Range(&remote.RangeReq{Table: kv.HashedAccounts, Limit: 3, PageSize: 2}, stream))
+	keys, _ = stream.pairs()
+	require.Equal(t, []string{"a1", "a2", "b1"}, keys)
+
+	// dups of one key are split by pages
+	stream = &rangeStream{ctx: clientCtx(1)}
+	require.NoError(t, s.Range(&remote.RangeReq{Table: kv.AccountChangeSet, PageSize: 2}, stream))
+	require.Equal(t, 3, len(stream.pages))
+	keys, values = stream.pairs()
+	require.Equal(t, []string{"k", "k", "k", "k", "k", "l"}, keys)
+	require.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, values)
+}
+
+func TestTxOfOtherConnection(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	s := NewKvServer(ctx, db)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	txn := &threadSafeTx{Tx: tx, conn: clientConn(clientCtx(1))}
+	s.addTx(tx.ViewID(), txn)
+	defer s.removeTx(tx.ViewID(), txn)
+
+	stream := &rangeStream{ctx: clientCtx(1)}
+	require.NoError(t, s.Range(&remote.RangeReq{TxID: tx.ViewID(), Table: kv.HashedAccounts}, stream))
+	keys, _ := stream.pairs()
+	require.Equal(t, 6, len(keys))
+	reply, err := s.GetMany(clientCtx(1), &remote.GetManyReq{TxID: tx.ViewID(), Table: kv.HashedAccounts, Keys: [][]byte{[]byte("a1"), []byte("x")}})
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, false}, reply.Found)
+
+	// other process of the same host can't read tx
+	err = s.Range(&remote.RangeReq{TxID: tx.ViewID(), Table: kv.HashedAccounts}, &rangeStream{ctx: clientCtx(2)})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = s.GetMany(clientCtx(2), &remote.GetManyReq{TxID: tx.ViewID(), Table: kv.HashedAccounts, Keys: [][]byte{[]byte("a1")}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// tx rolled back by Tx stream
+	txn.Lock()
+	txn.Tx = nil
+	txn.Unlock()
+	err = s.Range(&remote.RangeReq{TxID: tx.ViewID(), Table: kv.HashedAccounts}, &rangeStream{ctx: clientCtx(1)})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestMaxTxsPerClient(t *testing.T) {
+	s := NewKvServer(context.Background(), memdb.NewTestDB(t)).WithLimits(Limits{MaxTxsPerClient: 1})
+	client := clientAddr(clientCtx(1))
+	require.Equal(t, "127.0.0.1", client)
+
+	release, err := s.acquireClientTx(client)
+	require.NoError(t, err)
+	_, err = s.acquireClientTx(clientAddr(clientCtx(2))) // limit is per host
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	release()
+	release, err = s.acquireClientTx(client)
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,330 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+	"go.uber.org/atomic"
+)
+
+var (
+	RenewableTxRenews = metrics.NewCounter(`db_renewable_tx_renews`)              //nolint
+	RenewableTxAge    = metrics.GetOrCreateSummary(`db_renewable_tx_age_seconds`) //nolint
+
+	_ = metrics.NewGauge(`db_renewable_tx_oldest_seconds`, func() float64 { return openRenewableTxs.oldest().Seconds() })
+)
+
+// renewableTxs - set of open RenewableTx, for metrics
+type renewableTxs struct {
+	lock sync.Mutex
+	txs  map[*RenewableTx]struct{}
+}
+
+var openRenewableTxs = &renewableTxs{txs: map[*RenewableTx]struct{}{}}
+
+func (r *renewableTxs) add(tx *RenewableTx) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.txs[tx] = struct{}{}
+}
+
+func (r *renewableTxs) remove(tx *RenewableTx) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.txs, tx)
+}
+
+func (r *renewableTxs) oldest() (age time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for tx := range r.txs {
+		if a := tx.Age(); a > age {
+			age = a
+		}
+	}
+	return age
+}
+
+// RenewableTx - long-living read transaction which re-opens underlying transaction when it becomes older than maxAge.
+// Old read transaction pins pages which can't be re-used by writers - and db file grows.
+//
+// Renew happens only at "safe points": at the beginning of method call and only if no cursors are open.
+// It means:
+//   - GetOne/GetMany return copies of values - they stay valid after renew. Other data (ViewID,
+//     k/v passed to walkers, Range streams) is valid only until next call
+//   - sequence of calls may see different snapshots of db
+//   - long iteration by cursor never renews - use ForEach/ForAmount by chunks or close cursor from time to time
+//
+// Not thread-safe (same as Tx).
+type RenewableTx struct {
+	ctx      context.Context
+	db       RoDB
+	tx       Tx
+	maxAge   time.Duration
+	openedAt atomic.Int64 // unix nano
+	cursors  int
+}
+
+var _ Tx = (*RenewableTx)(nil)
+var _ Ranger = (*RenewableTx)(nil)
+var _ TableStatsReader = (*RenewableTx)(nil)
+var _ ManyGetter = (*RenewableTx)(nil)
+
+func NewRenewableTx(ctx context.Context, db RoDB, maxAge time.Duration) (*RenewableTx, error) {
+	tx := &RenewableTx{ctx: ctx, db: db, maxAge: maxAge}
+	if err := tx.begin(); err != nil {
+		return nil, err
+	}
+	openRenewableTxs.add(tx)
+	return tx, nil
+}
+
+func (tx *RenewableTx) begin() error {
+	t, err := tx.db.BeginRo(tx.ctx)
+	if err != nil {
+		return err
+	}
+	tx.tx = t
+	tx.openedAt.Store(time.Now().UnixNano())
+	return nil
+}
+
+func (tx *RenewableTx) end() {
+	if tx.tx == nil {
+		return
+	}
+	RenewableTxAge.UpdateDuration(time.Unix(0, tx.openedAt.Load()))
+	tx.tx.Rollback()
+	tx.tx = nil
+	tx.openedAt.Store(0)
+}
+
+// Age - how long current underlying transaction is open
+func (tx *RenewableTx) Age() time.Duration {
+	openedAt := tx.openedAt.Load()
+	if openedAt == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, openedAt))
+}
+
+// Renew - re-opens underlying transaction. Fails if some cursors are still open
+func (tx *RenewableTx) Renew() error {
+	if tx.cursors > 0 {
+		return fmt.Errorf("can't renew read transaction: %d cursors are open", tx.cursors)
+	}
+	if tx.tx == nil {
+		return fmt.Errorf("can't renew read transaction: it's closed")
+	}
+	tx.end()
+	RenewableTxRenews.Inc()
+	return tx.begin()
+}
+
+// safePoint - renews old transaction if it's safe. Called at the beginning of each method
+func (tx *RenewableTx) safePoint() (Tx, error) {
+	if tx.tx == nil {
+		return nil, fmt.Errorf("read transaction is closed")
+	}
+	if tx.cursors == 0 && tx.maxAge > 0 && tx.Age() > tx.maxAge {
+		if err := tx.Renew(); err != nil {
+			return nil, err
+		}
+	}
+	return tx.tx, nil
+}
+
+func (tx *RenewableTx) Commit() error {
+	tx.Rollback()
+	return nil
+}
+
+func (tx *RenewableTx) Rollback() {
+	tx.end()
+	openRenewableTxs.remove(tx)
+}
+
+func (tx *RenewableTx) ViewID() uint64 {
+	t, err := tx.safePoint()
+	if err != nil {
+		return 0
+	}
+	return t.ViewID()
+}
+
+func (tx *RenewableTx) Has(table string, key []byte) (bool, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return false, err
+	}
+	return t.Has(table, key)
+}
+
+func (tx *RenewableTx) GetOne(table string, key []byte) ([]byte, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return nil, err
+	}
+	v, err := t.GetOne(table, key)
+	if err != nil {
+		return nil, err
+	}
+	return common.Copy(v), nil
+}
+
+func (tx *RenewableTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return nil, err
+	}
+	values, err := GetMany(t, table, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = common.Copy(values[i])
+	}
+	return values, nil
+}
+
+// Range - stream is of transaction which was current at moment of call, reading it after renew is an error of caller
+func (tx *RenewableTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return nil, err
+	}
+	return Range(t, table, fromPrefix, toPrefix)
+}
+
+func (tx *RenewableTx) ReadSequence(table string) (uint64, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return 0, err
+	}
+	return t.ReadSequence(table)
+}
+
+func (tx *RenewableTx) BucketSize(table string) (uint64, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return 0, err
+	}
+	return t.BucketSize(table)
+}
+
+func (tx *RenewableTx) DBSize() (uint64, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return 0, err
+	}
+	return t.DBSize()
+}
+
+func (tx *RenewableTx) TableStats(table string) (TableStats, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return TableStats{}, err
+	}
+	return ReadTableStats(t, table)
+}
+
+func (tx *RenewableTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	t, err := tx.safePoint()
+	if err != nil {
+		return err
+	}
+	return t.ForEach(table, fromPrefix, walker)
+}
+
+func (tx *RenewableTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	t, err := tx.safePoint()
+	if err != nil {
+		return err
+	}
+	return t.ForPrefix(table, prefix, walker)
+}
+
+func (tx *RenewableTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	t, err := tx.safePoint()
+	if err != nil {
+		return err
+	}
+	return t.ForAmount(table, prefix, amount, walker)
+}
+
+// Cursor - transaction is not renewed until cursor is closed
+func (tx *RenewableTx) Cursor(table string) (Cursor, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return nil, err
+	}
+	c, err := t.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	tx.cursors++
+	return &renewableCursor{Cursor: c, tx: tx}, nil
+}
+
+// CursorDupSort - transaction is not renewed until cursor is closed
+func (tx *RenewableTx) CursorDupSort(table string) (CursorDupSort, error) {
+	t, err := tx.safePoint()
+	if err != nil {
+		return nil, err
+	}
+	c, err := t.CursorDupSort(table)
+	if err != nil {
+		return nil, err
+	}
+	tx.cursors++
+	return &renewableCursorDupSort{CursorDupSort: c, tx: tx}, nil
+}
+
+type renewableCursor struct {
+	Cursor
+	tx *RenewableTx
+}
+
+func (c *renewableCursor) Close() {
+	if c.tx == nil {
+		return
+	}
+	c.Cursor.Close()
+	c.tx.cursors--
+	c.tx = nil
+}
+
+type renewableCursorDupSort struct {
+	CursorDupSort
+	tx *RenewableTx
+}
+
+func (c *renewableCursorDupSort) Close() {
+	if c.tx == nil {
+		return
+	}
+	c.CursorDupSort.Close()
+	c.tx.cursors--
+	c.tx = nil
+}
@@ -19,6 +19,7 @@ package kv
 import (
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 )
@@ -307,6 +308,12 @@ const (
 	// in case of bug-report developer can ask content of this bucket
 	Migrations = "Migration"
 
+	// table_name -> version_u32: TableCfgItem.Version of data in the table, see CheckTableVersions
+	TableVersions = "TableVersion"
+
+	// migration_name -> applied_at_unix_u64: migrations of Migrator (names don't collide with Migrations of erigon)
+	AppliedMigrations = "AppliedMigration"
+
 	Sequence = "Sequence" // tbl_name -> seq_u64
 
 	Epoch        = "DevEpoch"        // block_num_u64+block_hash->transition_proof
@@ -432,6 +439,8 @@ var ChaindataTables = []string{
 	HeadHeaderKey,
 	LastForkchoice,
 	Migrations,
+	TableVersions,
+	AppliedMigrations,
 	LogTopicIndex,
 	LogAddressIndex,
 	CallTraceSet,
@@ -509,12 +518,14 @@ const (
 	RecentLocalTransaction = "RecentLocalTransaction" // sequence_u64 -> tx_hash
 	PoolTransaction        = "PoolTransaction"        // txHash -> sender_id_u64+tx_rlp
 	PoolInfo               = "PoolInfo"               // option_key -> option_value
+	PoolLocalJournal       = "PoolLocalJournal"       // txHash -> included_block_u64+sender_addr+tx_rlp : local txs to re-inject after restart and reorg
 )
 
 var TxPoolTables = []string{
 	RecentLocalTransaction,
 	PoolTransaction,
 	PoolInfo,
+	PoolLocalJournal,
 }
 var SentryTables = []string{}
 var DownloaderTables = []string{
@@ -541,6 +552,7 @@ const (
 	ReverseKey TableFlags = 0x02
 	DupSort    TableFlags = 0x04
 	IntegerKey TableFlags = 0x08
+	DupFixed   TableFlags = 0x10
 	IntegerDup TableFlags = 0x20
 	ReverseDup TableFlags = 0x40
 )
@@ -560,6 +572,12 @@ type TableCfgItem struct {
 	// Works only if AutoDupSortKeysConversion enabled
 	DupFromLen int
 	DupToLen   int
+	// TTL - entries expire after this duration and are deleted by TTLJanitor.
+	// Keys of such table must start with insertion time, see TTLKey
+	TTL time.Duration
+	// Version - of keys/values encoding. Bump it together with migration which converts data of previous
+	// version (see Migration.ToVersion): db with data of other version can't be opened
+	Version uint32
 }
 
 var ChaindataTablesCfg = TableCfg{
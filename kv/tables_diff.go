@@ -0,0 +1,80 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TablesDiff - difference between TableCfg of code and tables of db, found on open of db
+type TablesDiff struct {
+	Created       []string             // declared, didn't exist in db - created
+	Missing       []string             // declared, don't exist in read-only db - access to them returns ErrTableMissing
+	FlagsMismatch []TableFlagsMismatch // exist in db with other flags than declared - flags of db are used
+}
+
+type TableFlagsMismatch struct {
+	Table            string
+	Declared, Actual TableFlags
+}
+
+// Empty - TableCfg matches db (tables created on open are not a difference)
+func (d TablesDiff) Empty() bool { return len(d.Missing) == 0 && len(d.FlagsMismatch) == 0 }
+
+func (d TablesDiff) String() string {
+	var parts []string
+	if len(d.Created) > 0 {
+		parts = append(parts, fmt.Sprintf("created=%v", d.Created))
+	}
+	if len(d.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing=%v", d.Missing))
+	}
+	for _, m := range d.FlagsMismatch {
+		parts = append(parts, fmt.Sprintf("%s: declared flags=%s, in db=%s", m.Table, m.Declared, m.Actual))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// TablesDiffError - returned by open of db which requires exact match of TableCfg
+type TablesDiffError struct {
+	Diff TablesDiff
+}
+
+func (e *TablesDiffError) Error() string {
+	return fmt.Sprintf("tables config doesn't match db: %s", e.Diff)
+}
+
+func (f TableFlags) String() string {
+	if f == Default {
+		return "Default"
+	}
+	var names []string
+	for _, flag := range []struct {
+		f    TableFlags
+		name string
+	}{{ReverseKey, "ReverseKey"}, {DupSort, "DupSort"}, {IntegerKey, "IntegerKey"}, {IntegerDup, "IntegerDup"}, {ReverseDup, "ReverseDup"}} {
+		if f&flag.f != 0 {
+			names = append(names, flag.name)
+			f ^= flag.f
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint(f)))
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,154 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// TTLKey - key of table with TTL: 8 bytes big-endian unix seconds of insertion, then k.
+// Entries are sorted by insertion time - janitor deletes them from the beginning of table.
+func TTLKey(insertedAt time.Time, k []byte) []byte {
+	res := make([]byte, 8+len(k))
+	binary.BigEndian.PutUint64(res, uint64(insertedAt.Unix()))
+	copy(res[8:], k)
+	return res
+}
+
+// ParseTTLKey - opposite of TTLKey
+func ParseTTLKey(ttlKey []byte) (insertedAt time.Time, k []byte, err error) {
+	if len(ttlKey) < 8 {
+		return time.Time{}, nil, fmt.Errorf("key of TTL table is too short: %x", ttlKey)
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(ttlKey)), 0), ttlKey[8:], nil
+}
+
+// TTLJanitor - deletes expired entries of tables with TableCfgItem.TTL.
+// Deletes in small batches (1 write transaction per batch) - to not block other writers for long.
+type TTLJanitor struct {
+	db        RwDB
+	batchSize int
+}
+
+// NewTTLJanitor - batchSize is amount of deleted entries per write transaction, 0 - default
+func NewTTLJanitor(db RwDB, batchSize int) *TTLJanitor {
+	if batchSize <= 0 {
+		batchSize = 1_000
+	}
+	return &TTLJanitor{db: db, batchSize: batchSize}
+}
+
+// Tables - names of tables with TTL, sorted
+func (j *TTLJanitor) Tables() []string {
+	var res []string
+	for name, cfg := range j.db.AllBuckets() {
+		if cfg.TTL > 0 && !cfg.IsDeprecated {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Prune - deletes all expired entries of all TTL tables
+func (j *TTLJanitor) Prune(ctx context.Context) (deleted int, err error) {
+	buckets := j.db.AllBuckets()
+	for _, table := range j.Tables() {
+		expiredBefore := time.Now().Add(-buckets[table].TTL)
+		for {
+			n, err := j.pruneBatch(ctx, table, expiredBefore)
+			deleted += n
+			if err != nil {
+				return deleted, fmt.Errorf("prune TTL table %s: %w", table, err)
+			}
+			if n < j.batchSize {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return deleted, ctx.Err()
+			default:
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (j *TTLJanitor) pruneBatch(ctx context.Context, table string, expiredBefore time.Time) (deleted int, err error) {
+	if err := j.db.Update(ctx, func(tx RwTx) error {
+		c, err := tx.RwCursor(table)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for deleted < j.batchSize {
+			k, _, err := c.First()
+			if err != nil {
+				return err
+			}
+			if k == nil {
+				return nil
+			}
+			insertedAt, _, err := ParseTTLKey(k)
+			if err != nil {
+				return err
+			}
+			if !insertedAt.Before(expiredBefore) {
+				return nil
+			}
+			if err := c.DeleteCurrent(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	metrics.GetOrCreateCounter(fmt.Sprintf(`db_ttl_expired_total{table="%s"}`, table)).Add(deleted)
+	return deleted, nil
+}
+
+// Run - calls Prune every `every` until ctx is done. Errors are logged, next attempt - at next tick
+func (j *TTLJanitor) Run(ctx context.Context, every time.Duration, logger log.Logger) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deleted, err := j.Prune(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("[ttl] prune failed", "err", err)
+			}
+			continue
+		}
+		if deleted > 0 {
+			logger.Debug("[ttl] pruned expired entries", "deleted", deleted)
+		}
+	}
+}
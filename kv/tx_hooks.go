@@ -0,0 +1,125 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-stack/stack"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// ErrHookPanic - pre-commit hook panicked, Commit was aborted
+var ErrHookPanic = errors.New("commit hook panic")
+
+// CommitHooks - optional interface of RwTx: callbacks around Commit.
+// Hooks are called at most once, Rollback (or failed Commit) drops them without calling
+type CommitHooks interface {
+	// PreCommit - f is called by Commit before data is committed, in order of registration. f can write to tx
+	// (to flush cache or append journal entry atomically with other changes) and can register more hooks.
+	// Error or panic of f aborts Commit: tx is rolled back, Commit returns error
+	PreCommit(f func() error)
+	// PostCommit - f is called after durable Commit, in order of registration.
+	// Panic of f is recovered and logged: it doesn't affect other hooks and result of Commit
+	PostCommit(f func())
+}
+
+// TxHooks - implementation of CommitHooks for RwTx implementations. Zero value is ready to use
+type TxHooks struct {
+	pre  []func() error
+	post []func()
+}
+
+func (h *TxHooks) PreCommit(f func() error) { h.pre = append(h.pre, f) }
+func (h *TxHooks) PostCommit(f func())      { h.post = append(h.post, f) }
+
+// RunPreCommit - stops on first error, panic of hook is returned as ErrHookPanic.
+// Implementation must call it before any step of commit and roll back tx on error
+func (h *TxHooks) RunPreCommit() error {
+	for i := 0; len(h.pre) > 0; i++ {
+		f := h.pre[0]
+		h.pre = h.pre[1:]
+		if err := runPreCommit(f); err != nil {
+			h.Reset()
+			return fmt.Errorf("pre-commit hook %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func runPreCommit(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v, trace: %s", ErrHookPanic, r, stack.Trace().TrimRuntime().String())
+		}
+	}()
+	return f()
+}
+
+// RunPostCommit - implementation must call it after successful commit, when tx resources are released
+func (h *TxHooks) RunPostCommit() {
+	post := h.post
+	h.Reset()
+	for i, f := range post {
+		runPostCommit(i, f)
+	}
+}
+
+func runPostCommit(i int, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("[db] post-commit hook panic", "hook", i, "err", r, "trace", stack.Trace().TrimRuntime().String())
+		}
+	}()
+	f()
+}
+
+// Reset - drops hooks, for Rollback
+func (h *TxHooks) Reset() { h.pre, h.post = nil, nil }
+
+// WrapperHooks - commit hooks of wrapper of RwTx. Hooks are forwarded to underlying tx if it supports them,
+// otherwise (for example MemoryMutation) wrapper keeps them and runs around Commit of underlying tx.
+// Wrapper must commit by Commit and drop hooks by Reset on Rollback. Zero value is ready to use
+type WrapperHooks struct {
+	own TxHooks
+}
+
+// Of - hooks to register callbacks of wrapper of tx
+func (h *WrapperHooks) Of(tx Tx) CommitHooks {
+	if th, ok := tx.(CommitHooks); ok {
+		return th
+	}
+	return &h.own
+}
+
+// Commit - runs pre-commit hooks kept by wrapper, commit, then post-commit hooks kept by wrapper.
+// Error of pre-commit hook rolls back tx by rollback
+func (h *WrapperHooks) Commit(commit func() error, rollback func()) error {
+	if err := h.own.RunPreCommit(); err != nil {
+		rollback()
+		return err
+	}
+	if err := commit(); err != nil {
+		h.own.Reset()
+		return err
+	}
+	h.own.RunPostCommit()
+	return nil
+}
+
+func (h *WrapperHooks) Reset() { h.own.Reset() }
@@ -0,0 +1,116 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// TxMetrics - receiver of transactions metrics of db. Backends call it on begin/end of transactions.
+type TxMetrics interface {
+	// ReadTxBegin - returned func must be called once on end (commit or rollback) of read transaction
+	ReadTxBegin() (end func())
+	WriteTxEnd(duration time.Duration) // from begin to commit/rollback of write transaction
+	Committed(duration time.Duration, bytes uint64)
+}
+
+// NewTxMetrics - TxMetrics reporting to default VictoriaMetrics registry, 1 instance per db label:
+//
+//	db_ro_txs_open{db="chaindata"}               - open read transactions
+//	db_ro_tx_oldest_age_seconds{db="chaindata"}  - age of oldest open read transaction: alert on stuck readers
+//	db_ro_tx_age_seconds{db="chaindata"}         - histogram of read transactions age at close
+//	db_rw_tx_seconds{db="chaindata"}             - histogram of write transactions duration
+//	db_commit_duration_seconds{db="chaindata"}   - histogram of commits duration
+//	db_commit_bytes{db="chaindata"}              - histogram of dirty bytes written by commits
+func NewTxMetrics(label Label) TxMetrics {
+	txMetricsLock.Lock()
+	defer txMetricsLock.Unlock()
+	if m, ok := txMetricsByLabel[label]; ok {
+		return m
+	}
+	m := &txMetrics{readers: map[uint64]time.Time{}}
+	db := label.String()
+	m.roAge = metrics.GetOrCreateHistogram(fmt.Sprintf(`db_ro_tx_age_seconds{db="%s"}`, db))
+	m.rwDuration = metrics.GetOrCreateHistogram(fmt.Sprintf(`db_rw_tx_seconds{db="%s"}`, db))
+	m.commitDuration = metrics.GetOrCreateHistogram(fmt.Sprintf(`db_commit_duration_seconds{db="%s"}`, db))
+	m.commitBytes = metrics.GetOrCreateHistogram(fmt.Sprintf(`db_commit_bytes{db="%s"}`, db))
+	metrics.GetOrCreateGauge(fmt.Sprintf(`db_ro_txs_open{db="%s"}`, db), func() float64 { return float64(m.ReadTxsOpen()) })
+	metrics.GetOrCreateGauge(fmt.Sprintf(`db_ro_tx_oldest_age_seconds{db="%s"}`, db), func() float64 { return m.OldestReadTxAge().Seconds() })
+	txMetricsByLabel[label] = m
+	return m
+}
+
+var (
+	txMetricsLock    sync.Mutex
+	txMetricsByLabel = map[Label]*txMetrics{}
+)
+
+type txMetrics struct {
+	lock     sync.Mutex
+	readerID uint64
+	readers  map[uint64]time.Time // open read transactions -> begin time
+
+	roAge, rwDuration, commitDuration, commitBytes *metrics.Histogram
+}
+
+func (m *txMetrics) ReadTxBegin() (end func()) {
+	begin := time.Now()
+	m.lock.Lock()
+	m.readerID++
+	id := m.readerID
+	m.readers[id] = begin
+	m.lock.Unlock()
+	return func() {
+		m.lock.Lock()
+		delete(m.readers, id)
+		m.lock.Unlock()
+		m.roAge.UpdateDuration(begin)
+	}
+}
+
+func (m *txMetrics) WriteTxEnd(duration time.Duration) { m.rwDuration.Update(duration.Seconds()) }
+
+func (m *txMetrics) Committed(duration time.Duration, bytes uint64) {
+	m.commitDuration.Update(duration.Seconds())
+	m.commitBytes.Update(float64(bytes))
+}
+
+func (m *txMetrics) ReadTxsOpen() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.readers)
+}
+
+// OldestReadTxAge - 0 if there are no open read transactions
+func (m *txMetrics) OldestReadTxAge() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var oldest time.Time
+	for _, begin := range m.readers {
+		if oldest.IsZero() || begin.Before(oldest) {
+			oldest = begin
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
@@ -48,6 +48,16 @@ func Mmap(f *os.File, size int) ([]byte, *[MaxMapSize]byte, error) {
 	return mmapHandle1, mmapHandle2, nil
 }
 
+// MmapRw maps file for reading and writing, changes are written to the file
+func MmapRw(f *os.File, size int) ([]byte, *[MaxMapSize]byte, error) {
+	mmapHandle1, err := unix.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	mmapHandle2 := (*[MaxMapSize]byte)(unsafe.Pointer(&mmapHandle1[0]))
+	return mmapHandle1, mmapHandle2, nil
+}
+
 func MadviseSequential(mmapHandle1 []byte) error {
 	err := unix.Madvise(mmapHandle1, syscall.MADV_SEQUENTIAL)
 	if err != nil && !errors.Is(err, syscall.ENOSYS) {
@@ -66,6 +76,15 @@ func MadviseRandom(mmapHandle1 []byte) error {
 	return nil
 }
 
+func MadviseWillNeed(mmapHandle1 []byte) error {
+	err := unix.Madvise(mmapHandle1, syscall.MADV_WILLNEED)
+	if err != nil && !errors.Is(err, syscall.ENOSYS) {
+		// Ignore not implemented error in kernel because it still works.
+		return fmt.Errorf("madvise: %w", err)
+	}
+	return nil
+}
+
 // munmap unmaps a DB's data file from memory.
 func Munmap(mmapHandle1 []byte, _ *[MaxMapSize]byte) error {
 	// Ignore the unmap if we have no mapped data.
@@ -50,6 +50,25 @@ func Mmap(f *os.File, size int) ([]byte, *[MaxMapSize]byte, error) {
 	return mmapHandle2[:size], mmapHandle2, nil
 }
 
+// MmapRw maps file for reading and writing, changes are written to the file
+func MmapRw(f *os.File, size int) ([]byte, *[MaxMapSize]byte, error) {
+	sizelo := uint32(size >> 32)
+	sizehi := uint32(size) & 0xffffffff
+	h, errno := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READWRITE, sizelo, sizehi, nil)
+	if h == 0 {
+		return nil, nil, os.NewSyscallError("CreateFileMapping", errno)
+	}
+	addr, errno := windows.MapViewOfFile(h, windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if addr == 0 {
+		return nil, nil, os.NewSyscallError("MapViewOfFile", errno)
+	}
+	if err := windows.CloseHandle(windows.Handle(h)); err != nil {
+		return nil, nil, os.NewSyscallError("CloseHandle", err)
+	}
+	mmapHandle2 := ((*[MaxMapSize]byte)(unsafe.Pointer(addr)))
+	return mmapHandle2[:size], mmapHandle2, nil
+}
+
 func MadviseSequential(mmapHandle1 []byte) error {
 	return nil
 }
@@ -58,6 +77,10 @@ func MadviseRandom(mmapHandle1 []byte) error {
 	return nil
 }
 
+func MadviseWillNeed(mmapHandle1 []byte) error {
+	return nil
+}
+
 func Munmap(_ []byte, mmapHandle2 *[MaxMapSize]byte) error {
 	if mmapHandle2 == nil {
 		return nil
@@ -0,0 +1,374 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// bucket - keys of one initial bucket and the result of recursive split of it.
+// Buckets are independent from each other, the results are concatenated in the order of bucket index
+type bucket struct {
+	idx     uint64
+	keys    []uint64   // 64-bit fingerprints of keys, sorted
+	offsets []uint64   // Index offsets of keys
+	hashes  []uint64   // Bucket hashes of keys for 128-bit fingerprints, nil for 64-bit
+	gr      GolombRice // Golomb-Rice code of the hash function salts of this bucket
+	index   []byte     // Index records, in the order assigned by the perfect hash function
+	filter  []byte     // Existence filter bytes of keys, in the order of index records
+	err     error
+	done    chan struct{} // Closed when the bucket is processed by worker
+}
+
+// bucketBuilder - scratch space for recursive split of buckets. Single-threaded Build uses one builder,
+// parallel Build uses one builder per worker
+type bucketBuilder struct {
+	leafSize           uint16
+	primaryAggrBound   uint16
+	secondaryAggrBound uint16
+	startSeed          []uint64
+	golombRice         []uint32
+	buffer             []uint64
+	offsetBuffer       []uint64
+	hashBuffer         []uint64
+	count              []uint16
+	bytesPerRec        int
+	existence          bool // Whether to fill bucket.filter
+	numBuf             [8]byte
+	trace              bool
+	out                *bucket // Bucket being processed
+}
+
+func (rs *RecSplit) newBucketBuilder(golombRice []uint32) *bucketBuilder {
+	return &bucketBuilder{
+		leafSize:           rs.leafSize,
+		primaryAggrBound:   rs.primaryAggrBound,
+		secondaryAggrBound: rs.secondaryAggrBound,
+		startSeed:          rs.startSeed,
+		golombRice:         golombRice,
+		count:              make([]uint16, rs.secondaryAggrBound),
+		bytesPerRec:        rs.bytesPerRec,
+		existence:          rs.existence,
+		trace:              rs.trace,
+	}
+}
+
+// golombParam returns the optimal Golomb parameter to use for encoding
+// salt for the part of the hash function separating m elements. It is based on
+// calculations with assumptions that we draw hash functions at random
+func (bb *bucketBuilder) golombParam(m uint16) int {
+	s := uint16(len(bb.golombRice))
+	for m >= s {
+		bb.golombRice = append(bb.golombRice, 0)
+		// For the case where bucket is larger than planned
+		if s == 0 {
+			bb.golombRice[0] = (bijMemo[0] << 27) | bijMemo[0]
+		} else if s <= bb.leafSize {
+			bb.golombRice[s] = (bijMemo[s] << 27) | (uint32(1) << 16) | bijMemo[s]
+		} else {
+			computeGolombRice(s, bb.golombRice, bb.leafSize, bb.primaryAggrBound, bb.secondaryAggrBound)
+		}
+		s++
+	}
+	return int(bb.golombRice[m] >> 27)
+}
+
+// filterByte - byte of existence filter for the key with given 64-bit fingerprint
+func filterByte(fingerprint uint64) byte {
+	return byte(fingerprint >> 56)
+}
+
+func (bb *bucketBuilder) writeRecord(offset, key uint64) {
+	binary.BigEndian.PutUint64(bb.numBuf[:], offset)
+	bb.out.index = append(bb.out.index, bb.numBuf[8-bb.bytesPerRec:]...)
+	if bb.existence {
+		bb.out.filter = append(bb.out.filter, filterByte(key))
+	}
+}
+
+// build fills b.gr and b.index
+func (bb *bucketBuilder) build(b *bucket) error {
+	bb.out = b
+	defer func() { bb.out = nil }()
+	b.gr = GolombRice{data: b.gr.data[:0]}
+	b.index = b.index[:0]
+	b.filter = b.filter[:0]
+	// Sets of size 0 and 1 are not further processed, just write them to index
+	if len(b.keys) <= 1 {
+		for i, offset := range b.offsets {
+			bb.writeRecord(offset, b.keys[i])
+		}
+		return nil
+	}
+	for i, key := range b.keys[1:] {
+		if key == b.keys[i] && (b.hashes == nil || b.hashes[i+1] == b.hashes[i]) {
+			return fmt.Errorf("%w: %x", ErrCollision, key)
+		}
+	}
+	for len(bb.buffer) < len(b.keys) {
+		bb.buffer = append(bb.buffer, 0)
+		bb.offsetBuffer = append(bb.offsetBuffer, 0)
+		bb.hashBuffer = append(bb.hashBuffer, 0)
+	}
+	unary := bb.recsplit(0 /* level */, b.keys, b.hashes, b.offsets, nil /* unary */)
+	b.gr.appendUnaryAll(unary)
+	return nil
+}
+
+// keyHash - position of i-th key for the salt, hashes is nil for 64-bit fingerprints
+func keyHash(bucket, hashes []uint64, i uint16, salt uint64) uint64 {
+	if hashes == nil {
+		return remix(bucket[i] + salt)
+	}
+	return remix128(bucket[i], hashes[i], salt)
+}
+
+func subslice(s []uint64, from, to uint16) []uint64 {
+	if s == nil {
+		return nil
+	}
+	return s[from:to]
+}
+
+// recsplit applies recSplit algorithm to the given bucket
+func (bb *bucketBuilder) recsplit(level int, bucket, hashes []uint64, offsets []uint64, unary []uint64) []uint64 {
+	if bb.trace {
+		fmt.Printf("recsplit(%d, %d, %x)\n", level, len(bucket), bucket)
+	}
+	gr := &bb.out.gr
+	// Pick initial salt for this level of recursive split
+	salt := bb.startSeed[level]
+	m := uint16(len(bucket))
+	if m <= bb.leafSize {
+		// No need to build aggregation levels - just find find bijection
+		var mask uint32
+		for {
+			mask = 0
+			var fail bool
+			for i := uint16(0); !fail && i < m; i++ {
+				bit := uint32(1) << remap16(keyHash(bucket, hashes, i, salt), m)
+				if mask&bit != 0 {
+					fail = true
+				} else {
+					mask |= bit
+				}
+			}
+			if !fail {
+				break
+			}
+			salt++
+		}
+		for i := uint16(0); i < m; i++ {
+			j := remap16(keyHash(bucket, hashes, i, salt), m)
+			bb.offsetBuffer[j] = offsets[i]
+			bb.buffer[j] = bucket[i]
+		}
+		for k, offset := range bb.offsetBuffer[:m] {
+			bb.writeRecord(offset, bb.buffer[k])
+		}
+		salt -= bb.startSeed[level]
+		log2golomb := bb.golombParam(m)
+		if bb.trace {
+			fmt.Printf("encode bij %d with log2golomn %d at p = %d\n", salt, log2golomb, gr.bitCount)
+		}
+		gr.appendFixed(salt, log2golomb)
+		unary = append(unary, salt>>log2golomb)
+	} else {
+		fanout, unit := splitParams(m, bb.leafSize, bb.primaryAggrBound, bb.secondaryAggrBound)
+		count := bb.count
+		for {
+			for i := uint16(0); i < fanout-1; i++ {
+				count[i] = 0
+			}
+			var fail bool
+			for i := uint16(0); i < m; i++ {
+				count[remap16(keyHash(bucket, hashes, i, salt), m)/unit]++
+			}
+			for i := uint16(0); i < fanout-1; i++ {
+				fail = fail || (count[i] != unit)
+			}
+			if !fail {
+				break
+			}
+			salt++
+		}
+		for i, c := uint16(0), uint16(0); i < fanout; i++ {
+			count[i] = c
+			c += unit
+		}
+		for i := uint16(0); i < m; i++ {
+			j := remap16(keyHash(bucket, hashes, i, salt), m) / unit
+			bb.buffer[count[j]] = bucket[i]
+			bb.offsetBuffer[count[j]] = offsets[i]
+			if hashes != nil {
+				bb.hashBuffer[count[j]] = hashes[i]
+			}
+			count[j]++
+		}
+		copy(bucket, bb.buffer)
+		copy(offsets, bb.offsetBuffer)
+		copy(hashes, bb.hashBuffer)
+		salt -= bb.startSeed[level]
+		log2golomb := bb.golombParam(m)
+		if bb.trace {
+			fmt.Printf("encode fanout %d: %d with log2golomn %d at p = %d\n", fanout, salt, log2golomb, gr.bitCount)
+		}
+		gr.appendFixed(salt, log2golomb)
+		unary = append(unary, salt>>log2golomb)
+		var i uint16
+		for i = 0; i < m-unit; i += unit {
+			unary = bb.recsplit(level+1, bucket[i:i+unit], subslice(hashes, i, i+unit), offsets[i:i+unit], unary)
+		}
+		if m-i > 1 {
+			unary = bb.recsplit(level+1, bucket[i:], subslice(hashes, i, m), offsets[i:], unary)
+		} else if m-i == 1 {
+			bb.writeRecord(offsets[i], bucket[i])
+		}
+	}
+	return unary
+}
+
+// commitBucket appends result of processed bucket to the index, must be called in the order of bucket index
+func (rs *RecSplit) commitBucket(b *bucket) error {
+	// Extend rs.bucketSizeAcc to accomodate current bucket index + 1
+	for len(rs.bucketSizeAcc) <= int(b.idx)+1 {
+		rs.bucketSizeAcc = append(rs.bucketSizeAcc, rs.bucketSizeAcc[len(rs.bucketSizeAcc)-1])
+	}
+	rs.bucketSizeAcc[int(b.idx)+1] += uint64(len(b.keys))
+	if b.err != nil {
+		if errors.Is(b.err, ErrCollision) {
+			rs.collision = true
+		}
+		return b.err
+	}
+	if _, err := rs.indexW.Write(b.index); err != nil {
+		return err
+	}
+	if rs.existenceW != nil {
+		if _, err := rs.existenceW.Write(b.filter); err != nil {
+			return err
+		}
+	}
+	if len(b.keys) > 1 {
+		rs.gr.appendBits(b.gr)
+		if rs.grSpill != nil && len(rs.gr.data) >= grSpillWords {
+			if err := rs.grSpill.spill(&rs.gr); err != nil {
+				return err
+			}
+		}
+		if rs.trace {
+			fmt.Printf("recsplitBucket(%d, %d, bitsize = %d)\n", b.idx, len(b.keys), b.gr.bitCount)
+		}
+	}
+	// Extend rs.bucketPosAcc to accomodate current bucket index + 1
+	for len(rs.bucketPosAcc) <= int(b.idx)+1 {
+		rs.bucketPosAcc = append(rs.bucketPosAcc, rs.bucketPosAcc[len(rs.bucketPosAcc)-1])
+	}
+	rs.bucketPosAcc[int(b.idx)+1] = rs.grSpill.bits(rs.gr)
+	rs.keysProcessed += uint64(len(b.keys))
+	rs.reportProgress(b.idx, false)
+	return nil
+}
+
+func (rs *RecSplit) recsplitCurrentBucket() error {
+	if err := rs.ctx.Err(); err != nil {
+		return err
+	}
+	defer func() {
+		// clear for the next buckey
+		rs.currentBucket = rs.currentBucket[:0]
+		rs.currentBucketOffs = rs.currentBucketOffs[:0]
+		rs.currentBucketHash = rs.currentBucketHash[:0]
+	}()
+	if rs.workers > 1 {
+		return rs.scheduleCurrentBucket()
+	}
+	b := &rs.singleBucket
+	b.idx, b.keys, b.offsets, b.hashes = rs.currentBucketIdx, rs.currentBucket, rs.currentBucketOffs, rs.currentBucketHash
+	b.err = rs.builder.build(b)
+	return rs.commitBucket(b)
+}
+
+// scheduleCurrentBucket copies current bucket and sends it to workers. At most 2*workers buckets are in flight,
+// the oldest one is committed when the limit is reached
+func (rs *RecSplit) scheduleCurrentBucket() error {
+	var b *bucket
+	if n := len(rs.freeBuckets); n > 0 {
+		b, rs.freeBuckets = rs.freeBuckets[n-1], rs.freeBuckets[:n-1]
+	} else {
+		b = &bucket{}
+	}
+	b.idx, b.err, b.done = rs.currentBucketIdx, nil, make(chan struct{})
+	b.keys = append(b.keys[:0], rs.currentBucket...)
+	b.offsets = append(b.offsets[:0], rs.currentBucketOffs...)
+	if rs.hash128 {
+		b.hashes = append(b.hashes[:0], rs.currentBucketHash...)
+	}
+	rs.work <- b
+	rs.pending = append(rs.pending, b)
+	if len(rs.pending) < 2*rs.workers {
+		return nil
+	}
+	return rs.commitPending(len(rs.pending) - 2*rs.workers + 1)
+}
+
+// commitPending waits for the n oldest buckets in flight and commits them
+func (rs *RecSplit) commitPending(n int) error {
+	for ; n > 0; n-- {
+		b := rs.pending[0]
+		<-b.done
+		if err := rs.commitBucket(b); err != nil {
+			return err
+		}
+		rs.pending[0] = nil
+		rs.pending = rs.pending[1:]
+		rs.freeBuckets = append(rs.freeBuckets, b)
+	}
+	return nil
+}
+
+// startWorkers returns function which stops workers, and must be called after all buckets are committed
+func (rs *RecSplit) startWorkers() (stop func()) {
+	rs.work = make(chan *bucket, 2*rs.workers)
+	builders := make([]*bucketBuilder, rs.workers)
+	var wg sync.WaitGroup
+	wg.Add(rs.workers)
+	for i := range builders {
+		builders[i] = rs.newBucketBuilder(append([]uint32(nil), rs.golombRice...))
+		go func(bb *bucketBuilder) {
+			defer wg.Done()
+			for b := range rs.work {
+				b.err = bb.build(b)
+				close(b.done)
+			}
+		}(builders[i])
+	}
+	return func() {
+		close(rs.work)
+		wg.Wait()
+		rs.work, rs.pending, rs.freeBuckets = nil, nil, nil
+		// Tables are the same for all workers, up to the largest bucket seen
+		for _, bb := range builders {
+			if len(bb.golombRice) > len(rs.golombRice) {
+				rs.golombRice = bb.golombRice
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+)
+
+const checkpointVersion = 1
+
+// Checkpoint flushes keys added so far to the files of collectors in tmpDir and writes the state of RecSplit into
+// checkpointFile. If process is interrupted before Build, ResumeRecSplit continues from the checkpoint:
+// keys added after the checkpoint have to be added again. Close removes the files of collectors - checkpoint
+// becomes unusable after it
+func (rs *RecSplit) Checkpoint(checkpointFile string) error {
+	if rs.built {
+		return fmt.Errorf("checkpoint: perfect hash function had been built")
+	}
+	bucketFiles, err := rs.bucketCollector.Checkpoint()
+	if err != nil {
+		return fmt.Errorf("checkpoint of bucket collector: %w", err)
+	}
+	var offsetFiles []string
+	if rs.enums {
+		if offsetFiles, err = rs.offsetCollector.Checkpoint(); err != nil {
+			return fmt.Errorf("checkpoint of offset collector: %w", err)
+		}
+	}
+	tmpFile := checkpointFile + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("create checkpoint file %s: %w", checkpointFile, err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	var numBuf [binary.MaxVarintLen64]byte
+	writeUint := func(v uint64) {
+		binary.BigEndian.PutUint64(numBuf[:], v)
+		w.Write(numBuf[:8]) //nolint:errcheck
+	}
+	writeFiles := func(files []string) {
+		writeUint(uint64(len(files)))
+		for _, name := range files {
+			n := binary.PutUvarint(numBuf[:], uint64(len(name)))
+			w.Write(numBuf[:n]) //nolint:errcheck
+			w.WriteString(name) //nolint:errcheck
+		}
+	}
+	w.WriteByte(checkpointVersion) //nolint:errcheck
+	w.WriteByte(rs.features())     //nolint:errcheck
+	writeUint(uint64(rs.salt))
+	writeUint(rs.keyExpectedCount)
+	writeUint(rs.keysAdded)
+	writeUint(rs.maxOffset)
+	writeUint(rs.prevOffset)
+	writeUint(rs.minDelta)
+	writeFiles(bucketFiles)
+	writeFiles(offsetFiles)
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("write checkpoint file %s: %w", checkpointFile, err)
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, checkpointFile)
+}
+
+// ResumeRecSplit creates RecSplit from checkpoint written by Checkpoint. args must be the same as for the interrupted
+// RecSplit (Salt is taken from checkpoint). Keys have to be added starting from KeysAdded()
+func ResumeRecSplit(args RecSplitArgs, checkpointFile string) (*RecSplit, error) {
+	f, err := os.Open(checkpointFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var numBuf [8]byte
+	readUint := func() uint64 {
+		if err == nil {
+			_, err = io.ReadFull(r, numBuf[:])
+		}
+		return binary.BigEndian.Uint64(numBuf[:])
+	}
+	readFiles := func() []string {
+		files := make([]string, readUint())
+		for i := range files {
+			if err != nil {
+				return nil
+			}
+			var l uint64
+			if l, err = binary.ReadUvarint(r); err != nil {
+				return nil
+			}
+			name := make([]byte, l)
+			if _, err = io.ReadFull(r, name); err != nil {
+				return nil
+			}
+			files[i] = string(name)
+		}
+		return files
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint file %s: %w", checkpointFile, err)
+	}
+	if version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint file %s: unsupported version %d", checkpointFile, version)
+	}
+	features, err := r.ReadByte()
+	salt := uint32(readUint())
+	keyExpectedCount := readUint()
+	keysAdded, maxOffset, prevOffset, minDelta := readUint(), readUint(), readUint(), readUint()
+	bucketFiles := readFiles()
+	offsetFiles := readFiles()
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint file %s: %w", checkpointFile, err)
+	}
+	if keyExpectedCount != uint64(args.KeyCount) {
+		return nil, fmt.Errorf("checkpoint file %s: expected keys %d, args.KeyCount %d", checkpointFile, keyExpectedCount, args.KeyCount)
+	}
+	if enums := features&featureEnums != 0; args.Enums != enums {
+		return nil, fmt.Errorf("checkpoint file %s: enums %t, args.Enums %t", checkpointFile, enums, args.Enums)
+	}
+	if hash128 := features&featureHash128 != 0; args.Hash128 != hash128 {
+		return nil, fmt.Errorf("checkpoint file %s: hash128 %t, args.Hash128 %t", checkpointFile, hash128, args.Hash128)
+	}
+	if existence := features&featureExistence != 0; args.ExistenceFilter != existence {
+		return nil, fmt.Errorf("checkpoint file %s: existence filter %t, args.ExistenceFilter %t", checkpointFile, existence, args.ExistenceFilter)
+	}
+	// Check all files before opening collectors: closing of collector removes its files
+	for _, name := range append(bucketFiles, offsetFiles...) {
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("checkpoint file %s: %w", checkpointFile, err)
+		}
+	}
+
+	args.Salt = salt
+	rs, err := NewRecSplit(args)
+	if err != nil {
+		return nil, err
+	}
+	rs.bucketCollector.Close()
+	if rs.bucketCollector, err = etl.NewCollectorFromCheckpoint(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit), bucketFiles); err != nil {
+		rs.bucketCollector = nil
+		rs.Close()
+		return nil, err
+	}
+	rs.bucketCollector.SetMemoryBudget(rs.etlBudget)
+	if rs.enums {
+		rs.offsetCollector.Close()
+		if rs.offsetCollector, err = etl.NewCollectorFromCheckpoint(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit), offsetFiles); err != nil {
+			rs.offsetCollector = nil
+			rs.Close()
+			return nil, err
+		}
+		rs.offsetCollector.SetMemoryBudget(rs.etlBudget)
+	}
+	rs.keysAdded, rs.maxOffset, rs.prevOffset, rs.minDelta = keysAdded, maxOffset, prevOffset, minDelta
+	return rs, nil
+}
+
+// KeysAdded returns number of keys added so far
+func (rs *RecSplit) KeysAdded() uint64 {
+	return rs.keysAdded
+}
@@ -236,14 +236,18 @@ func ReadEliasFano(r []byte) (*EliasFano, int) {
 	ef.count = binary.BigEndian.Uint64(r[:8])
 	ef.u = binary.BigEndian.Uint64(r[8:16])
 	ef.minDelta = binary.BigEndian.Uint64(r[16:24])
-	p := (*[maxDataSize / 8]uint64)(unsafe.Pointer(&r[24]))
-	ef.data = p[:]
+	ef.data = words(r[24:])
 	ef.deriveFields()
 	return ef, 24 + 8*len(ef.data)
 }
 
 const maxDataSize = 0xFFFFFFFFFFFF
 
+// words - r as []uint64 without copy, bounded by len(r): r can be heap-allocated, not only mmap-ed
+func words(r []byte) []uint64 {
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&r[0])), len(r)/8)
+}
+
 // DoubleEliasFano can be used to encode two monotone sequences
 // it is called "double" because the lower bits array contains two sequences interleaved
 type DoubleEliasFano struct {
@@ -559,8 +563,7 @@ func (ef *DoubleEliasFano) Read(r []byte) int {
 	ef.uPosition = binary.BigEndian.Uint64(r[16:24])
 	ef.cumKeysMinDelta = binary.BigEndian.Uint64(r[24:32])
 	ef.posMinDelta = binary.BigEndian.Uint64(r[32:40])
-	p := (*[maxDataSize / 8]uint64)(unsafe.Pointer(&r[40]))
-	ef.data = p[:]
+	ef.data = words(r[40:])
 	ef.deriveFields()
 	return 40 + 8*len(ef.data)
 }
@@ -71,6 +71,29 @@ func NewEliasFano(count uint64, maxOffset uint64) *EliasFano {
 	return ef
 }
 
+// DataWords returns number of 64-bit words in the encoding of count offsets up to maxOffset
+func DataWords(count uint64, maxOffset uint64) int {
+	ef := &EliasFano{count: count - 1, maxOffset: maxOffset, u: maxOffset + 1}
+	wordsLowerBits, wordsUpperBits, jumpWords := ef.sizes()
+	return wordsLowerBits + wordsUpperBits + jumpWords
+}
+
+// NewEliasFanoWithBuffer is NewEliasFano which keeps the encoding in buf (for example, in memory mapped file) instead of
+// allocating it. buf must be zeroed and hold at least DataWords(count, maxOffset) words
+func NewEliasFanoWithBuffer(count uint64, maxOffset uint64, buf []uint64) *EliasFano {
+	if count == 0 {
+		panic(fmt.Sprintf("too small count: %d", count))
+	}
+	ef := &EliasFano{
+		count:     count - 1,
+		maxOffset: maxOffset,
+		data:      buf,
+	}
+	ef.u = maxOffset + 1
+	ef.wordsUpperBits = ef.deriveFields()
+	return ef
+}
+
 func (ef *EliasFano) AddOffset(offset uint64) {
 	//fmt.Printf("0x%x,\n", offset)
 	if ef.l != 0 {
@@ -90,16 +113,22 @@ func (ef EliasFano) jumpSizeWords() int {
 	return int(size)
 }
 
-func (ef *EliasFano) deriveFields() int {
+// sizes derives l and returns number of words of parts of encoding
+func (ef *EliasFano) sizes() (wordsLowerBits, wordsUpperBits, jumpWords int) {
 	if ef.u/(ef.count+1) == 0 {
 		ef.l = 0
 	} else {
 		ef.l = 63 ^ uint64(bits.LeadingZeros64(ef.u/(ef.count+1))) // pos of first non-zero bit
 	}
+	wordsLowerBits = int(((ef.count+1)*ef.l+63)/64 + 1)
+	wordsUpperBits = int((ef.count + 1 + (ef.u >> ef.l) + 63) / 64)
+	jumpWords = ef.jumpSizeWords()
+	return wordsLowerBits, wordsUpperBits, jumpWords
+}
+
+func (ef *EliasFano) deriveFields() int {
+	wordsLowerBits, wordsUpperBits, jumpWords := ef.sizes()
 	ef.lowerBitsMask = (uint64(1) << ef.l) - 1
-	wordsLowerBits := int(((ef.count+1)*ef.l+63)/64 + 1)
-	wordsUpperBits := int((ef.count + 1 + (ef.u >> ef.l) + 63) / 64)
-	jumpWords := ef.jumpSizeWords()
 	totalWords := wordsLowerBits + wordsUpperBits + jumpWords
 	//fmt.Printf("EF: %d, %d,%d,%d\n", totalWords, wordsLowerBits, wordsUpperBits, jumpWords)
 	if ef.data == nil {
@@ -265,6 +294,85 @@ func (efi *EliasFanoIter) Next() uint64 {
 	return val
 }
 
+// Seek moves iterator to the first element equal or greater than v: it is returned by next call of Next, HasNext
+// is false if there is no such element. Element is found by binary search using jump tables, without scan from the first element
+func (efi *EliasFanoIter) Seek(v uint64) {
+	ef := efi.ef
+	i := uint64(sort.Search(int(ef.count+1), func(i int) bool {
+		val, _, _, _, _ := ef.get(uint64(i))
+		return val >= v
+	}))
+	efi.idx = i
+	if i > ef.count {
+		return
+	}
+	_, _, sel, currWord, _ := ef.get(i)
+	efi.lowerIdx = i * ef.l
+	efi.upperIdx = currWord
+	efi.upperMask = uint64(1) << sel
+	efi.upper = (currWord*64 + uint64(sel) - i) << ef.l // Number of zeros in upper bits before the element
+}
+
+// ReverseIterator iterates over the sequence in descending order, starting from the last element
+func (ef *EliasFano) ReverseIterator() *EliasFanoReverseIter {
+	efi := &EliasFanoReverseIter{ef: ef}
+	efi.reset(ef.count + 1)
+	return efi
+}
+
+// EliasFanoReverseIter - iterator from the last element to the first one, upper bits are scanned backwards
+type EliasFanoReverseIter struct {
+	ef       *EliasFano
+	idx      uint64 // Number of elements not returned yet, Next returns element idx-1
+	upperIdx uint64 // Index of the word of upper bits with the next element
+	upper    uint64 // Bits of the word upperIdx which are not visited yet
+}
+
+// reset positions iterator before element i, so that Next returns element i-1
+func (efi *EliasFanoReverseIter) reset(i uint64) {
+	efi.idx = i
+	if i == 0 {
+		return
+	}
+	_, _, sel, currWord, _ := efi.ef.get(i - 1)
+	efi.upperIdx = currWord
+	efi.upper = efi.ef.upperBits[currWord] & ((uint64(2) << sel) - 1) // Bits up to sel inclusive
+}
+
+func (efi *EliasFanoReverseIter) HasNext() bool {
+	return efi.idx > 0
+}
+
+func (efi *EliasFanoReverseIter) Next() uint64 {
+	for efi.upper == 0 {
+		efi.upperIdx--
+		efi.upper = efi.ef.upperBits[efi.upperIdx]
+	}
+	sel := 63 - bits.LeadingZeros64(efi.upper)
+	efi.upper &^= uint64(1) << sel
+	efi.idx--
+	i := efi.idx
+	lowerIdx := i * efi.ef.l
+	idx64 := lowerIdx >> 6
+	shift := lowerIdx & 63
+	lower := efi.ef.lowerBits[idx64] >> shift
+	if shift > 0 {
+		lower |= efi.ef.lowerBits[idx64+1] << (64 - shift)
+	}
+	return (efi.upperIdx*64+uint64(sel)-i)<<efi.ef.l | (lower & efi.ef.lowerBitsMask)
+}
+
+// Seek moves iterator to the last element equal or less than v: it is returned by next call of Next, HasNext
+// is false if there is no such element
+func (efi *EliasFanoReverseIter) Seek(v uint64) {
+	ef := efi.ef
+	i := uint64(sort.Search(int(ef.count+1), func(i int) bool {
+		val, _, _, _, _ := ef.get(uint64(i))
+		return val > v
+	}))
+	efi.reset(i)
+}
+
 // Write outputs the state of golomb rice encoding into a writer, which can be recovered later by Read
 func (ef *EliasFano) Write(w io.Writer) error {
 	var numBuf [8]byte
@@ -299,14 +407,18 @@ func (ef *EliasFano) AppendBytes(buf []byte) []byte {
 
 const maxDataSize = 0xFFFFFFFFFFFF
 
+// words - r as []uint64 without copy, bounded by len(r): r can be heap-allocated, not only mmap-ed
+func words(r []byte) []uint64 {
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&r[0])), len(r)/8)
+}
+
 // Read inputs the state of golomb rice encoding from a reader s
 func ReadEliasFano(r []byte) (*EliasFano, int) {
 	ef := &EliasFano{}
 	ef.count = binary.BigEndian.Uint64(r[:8])
 	ef.u = binary.BigEndian.Uint64(r[8:16])
 	ef.maxOffset = ef.u - 1
-	p := (*[maxDataSize / 8]uint64)(unsafe.Pointer(&r[16]))
-	ef.data = p[:]
+	ef.data = words(r[16:])
 	ef.deriveFields()
 	return ef, 16 + 8*len(ef.data)
 }
@@ -626,8 +738,7 @@ func (ef *DoubleEliasFano) Read(r []byte) int {
 	ef.uPosition = binary.BigEndian.Uint64(r[16:24])
 	ef.cumKeysMinDelta = binary.BigEndian.Uint64(r[24:32])
 	ef.posMinDelta = binary.BigEndian.Uint64(r[32:40])
-	p := (*[maxDataSize / 8]uint64)(unsafe.Pointer(&r[40]))
-	ef.data = p[:]
+	ef.data = words(r[40:])
 	ef.deriveFields()
 	return 40 + 8*len(ef.data)
 }
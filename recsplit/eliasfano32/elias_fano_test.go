@@ -17,6 +17,8 @@
 package eliasfano32
 
 import (
+	"bytes"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +76,105 @@ func TestIterator(t *testing.T) {
 		i++
 	}
 }
+
+func TestIteratorSeek(t *testing.T) {
+	offsets := make([]uint64, 10000)
+	for i := range offsets {
+		offsets[i] = uint64(i*7 + i%5)
+	}
+	maxOffset := offsets[len(offsets)-1]
+	ef := NewEliasFano(uint64(len(offsets)), maxOffset)
+	for _, offset := range offsets {
+		ef.AddOffset(offset)
+	}
+	ef.Build()
+	efi := ef.Iterator()
+	for _, i := range []int{5000, 0, 4097, 9999, 256} {
+		efi.Seek(offsets[i])
+		for j := i; j < i+300 && j < len(offsets); j++ {
+			assert.True(t, efi.HasNext(), "seek")
+			assert.Equal(t, offsets[j], efi.Next(), "seek")
+		}
+		if i > 0 {
+			efi.Seek(offsets[i] - 1) // between elements - to the next one
+			assert.Equal(t, offsets[i], efi.Next(), "seek between")
+		}
+	}
+	efi.Seek(maxOffset + 1)
+	assert.False(t, efi.HasNext(), "seek after last")
+}
+
+func TestReverseIterator(t *testing.T) {
+	for _, step := range []int{0, 1, 7, 1000} {
+		offsets := make([]uint64, 5000)
+		for i := range offsets {
+			offsets[i] = uint64(i*step + i/3)
+		}
+		maxOffset := offsets[len(offsets)-1]
+		ef := NewEliasFano(uint64(len(offsets)), maxOffset)
+		for _, offset := range offsets {
+			ef.AddOffset(offset)
+		}
+		ef.Build()
+		efi := ef.ReverseIterator()
+		i := len(offsets) - 1
+		for efi.HasNext() {
+			assert.Equal(t, offsets[i], efi.Next(), "reverse iter")
+			i--
+		}
+		assert.Equal(t, -1, i, "reverse iter count")
+
+		for _, i := range []int{2500, 0, 4097, 4999, 256} {
+			efi.Seek(offsets[i])
+			j := i
+			for j+1 < len(offsets) && offsets[j+1] == offsets[i] {
+				j++ // Last of equal elements
+			}
+			for ; j > i-300 && j >= 0; j-- {
+				assert.True(t, efi.HasNext(), "reverse seek")
+				assert.Equal(t, offsets[j], efi.Next(), "reverse seek")
+			}
+		}
+		if offsets[0] > 0 {
+			efi.Seek(offsets[0] - 1)
+			assert.False(t, efi.HasNext(), "reverse seek before first")
+		}
+		efi.Seek(maxOffset + 1)
+		assert.Equal(t, maxOffset, efi.Next(), "reverse seek after last")
+	}
+}
+
+func TestEliasFanoWriter(t *testing.T) {
+	for _, step := range []uint64{0, 1, 3, 1000} {
+		offsets := make([]uint64, 9000)
+		for i := range offsets {
+			offsets[i] = uint64(i)*step + uint64(i/3)
+		}
+		maxOffset := offsets[len(offsets)-1]
+		ef := NewEliasFano(uint64(len(offsets)), maxOffset)
+		for _, offset := range offsets {
+			ef.AddOffset(offset)
+		}
+		ef.Build()
+		var expected bytes.Buffer
+		assert.NoError(t, ef.Write(&expected))
+
+		var buf bytes.Buffer
+		efw, err := NewEliasFanoWriter(&buf, uint64(len(offsets)), maxOffset, t.TempDir())
+		assert.NoError(t, err)
+		for _, offset := range offsets {
+			assert.NoError(t, efw.AddOffset(offset))
+		}
+		assert.NoError(t, efw.Build())
+		efw.Close()
+		assert.Equal(t, expected.Bytes(), buf.Bytes(), "step %d", step)
+	}
+
+	efw, err := NewEliasFanoWriter(io.Discard, 2, 10, t.TempDir())
+	assert.NoError(t, err)
+	defer efw.Close()
+	assert.NoError(t, efw.AddOffset(5))
+	assert.Error(t, efw.AddOffset(4), "decreasing")
+	assert.Error(t, efw.AddOffset(11), "greater than maxOffset")
+	assert.Error(t, efw.Build(), "not all values")
+}
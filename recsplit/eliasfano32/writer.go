@@ -0,0 +1,221 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package eliasfano32
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"unsafe"
+)
+
+// wordsWriter - buffered writer of 64-bit words in the same byte order as EliasFano.Write
+type wordsWriter struct {
+	w     io.Writer
+	buf   [512]uint64
+	n     int
+	count int // Number of words written so far
+}
+
+func (ww *wordsWriter) add(word uint64) error {
+	ww.buf[ww.n] = word
+	ww.n++
+	ww.count++
+	if ww.n == len(ww.buf) {
+		return ww.flush()
+	}
+	return nil
+}
+
+func (ww *wordsWriter) flush() error {
+	if ww.n == 0 {
+		return nil
+	}
+	b := (*[len(ww.buf) * 8]byte)(unsafe.Pointer(&ww.buf[0]))
+	_, err := ww.w.Write(b[:ww.n*8])
+	ww.n = 0
+	return err
+}
+
+// EliasFanoWriter writes Elias-Fano encoding of sequence, in the format of EliasFano.Write, incrementally: values are
+// added one at a time, lower bits are written to the writer as soon as they are known. Only jump table is kept in RAM,
+// upper bits are buffered in temp file - writing of large sequences needs bounded RAM
+type EliasFanoWriter struct {
+	ef             EliasFano // Parameters of encoding, data is not allocated
+	w              io.Writer
+	lower          wordsWriter
+	upper          wordsWriter
+	upperFile      *os.File
+	upperBuf       *bufio.Writer
+	jump           []uint64
+	wordsLowerBits int
+	wordsUpperBits int
+	lowerWord      uint64
+	lowerUsed      uint64 // Number of bits used in lowerWord
+	upperWord      uint64
+	upperIdx       uint64 // Index of upperWord in upper bits
+	lastSuperQ     uint64
+	prev           uint64
+	i              uint64 // Number of values added
+}
+
+// NewEliasFanoWriter creates writer of count values not greater than maxOffset, header is written to w immediately
+func NewEliasFanoWriter(w io.Writer, count uint64, maxOffset uint64, tmpDir string) (*EliasFanoWriter, error) {
+	if count == 0 {
+		return nil, fmt.Errorf("too small count: %d", count)
+	}
+	efw := &EliasFanoWriter{w: w, ef: EliasFano{count: count - 1, maxOffset: maxOffset, u: maxOffset + 1}}
+	var jumpWords int
+	efw.wordsLowerBits, efw.wordsUpperBits, jumpWords = efw.ef.sizes()
+	efw.ef.lowerBitsMask = (uint64(1) << efw.ef.l) - 1
+	efw.jump = make([]uint64, jumpWords)
+	var err error
+	if efw.upperFile, err = ioutil.TempFile(tmpDir, "erigon-ef-upper-"); err != nil {
+		return nil, err
+	}
+	efw.upperBuf = bufio.NewWriter(efw.upperFile)
+	efw.upper.w = efw.upperBuf
+	efw.lower.w = w
+
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], efw.ef.count)
+	if _, err = w.Write(numBuf[:]); err != nil {
+		efw.Close()
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(numBuf[:], efw.ef.u)
+	if _, err = w.Write(numBuf[:]); err != nil {
+		efw.Close()
+		return nil, err
+	}
+	return efw, nil
+}
+
+// AddOffset adds next value of the sequence, values must be non-decreasing
+func (efw *EliasFanoWriter) AddOffset(offset uint64) error {
+	if efw.i > efw.ef.count {
+		return fmt.Errorf("too many values, expected %d", efw.ef.count+1)
+	}
+	if offset > efw.ef.maxOffset {
+		return fmt.Errorf("value %d is greater than maxOffset %d", offset, efw.ef.maxOffset)
+	}
+	if efw.i > 0 && offset < efw.prev {
+		return fmt.Errorf("values must be non-decreasing: %d after %d", offset, efw.prev)
+	}
+	efw.prev = offset
+	if l := efw.ef.l; l != 0 {
+		v := offset & efw.ef.lowerBitsMask
+		efw.lowerWord |= v << efw.lowerUsed
+		if efw.lowerUsed+l >= 64 {
+			if err := efw.lower.add(efw.lowerWord); err != nil {
+				return err
+			}
+			efw.lowerWord = 0
+			if efw.lowerUsed > 0 {
+				efw.lowerWord = v >> (64 - efw.lowerUsed)
+			}
+			efw.lowerUsed = efw.lowerUsed + l - 64
+		} else {
+			efw.lowerUsed += l
+		}
+	}
+	pos := (offset >> efw.ef.l) + efw.i // Position of the bit in upper bits
+	for pos/64 > efw.upperIdx {
+		if err := efw.upper.add(efw.upperWord); err != nil {
+			return err
+		}
+		efw.upperWord = 0
+		efw.upperIdx++
+	}
+	efw.upperWord |= uint64(1) << (pos % 64)
+	// Jump table, the same as in EliasFano.Build
+	c := efw.i
+	if (c & superQMask) == 0 {
+		efw.lastSuperQ = pos
+		efw.jump[(c/superQ)*superQSize] = pos
+	}
+	if (c & qMask) == 0 {
+		offset := pos - efw.lastSuperQ
+		jumpSuperQ := (c / superQ) * superQSize
+		jumpInsideSuperQ := (c % superQ) / q
+		idx64 := jumpSuperQ + 1 + (jumpInsideSuperQ >> 1)
+		shift := 32 * (jumpInsideSuperQ % 2)
+		mask := uint64(0xffffffff) << shift
+		efw.jump[idx64] = (efw.jump[idx64] &^ mask) | (offset << shift)
+	}
+	efw.i++
+	return nil
+}
+
+// Build writes the rest of encoding (padding of lower bits, upper bits and jump table), all count values must be added
+func (efw *EliasFanoWriter) Build() error {
+	if efw.i != efw.ef.count+1 {
+		return fmt.Errorf("expected %d values, added %d", efw.ef.count+1, efw.i)
+	}
+	if efw.lowerUsed > 0 {
+		if err := efw.lower.add(efw.lowerWord); err != nil {
+			return err
+		}
+	}
+	for efw.lower.count < efw.wordsLowerBits {
+		if err := efw.lower.add(0); err != nil {
+			return err
+		}
+	}
+	if err := efw.lower.flush(); err != nil {
+		return err
+	}
+	if err := efw.upper.add(efw.upperWord); err != nil {
+		return err
+	}
+	for efw.upper.count < efw.wordsUpperBits {
+		if err := efw.upper.add(0); err != nil {
+			return err
+		}
+	}
+	if err := efw.upper.flush(); err != nil {
+		return err
+	}
+	if err := efw.upperBuf.Flush(); err != nil {
+		return err
+	}
+	if _, err := efw.upperFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(efw.w, efw.upperFile); err != nil {
+		return err
+	}
+	if len(efw.jump) > 0 {
+		b := (*[maxDataSize]byte)(unsafe.Pointer(&efw.jump[0]))
+		if _, err := efw.w.Write(b[:len(efw.jump)*8]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes temp file
+func (efw *EliasFanoWriter) Close() {
+	if efw.upperFile != nil {
+		_ = efw.upperFile.Close()
+		_ = os.Remove(efw.upperFile.Name())
+		efw.upperFile = nil
+	}
+}
@@ -0,0 +1,158 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"unsafe"
+
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/mmap"
+)
+
+// grSpillWords - with RecSplitArgs.FileBackedBuffers, Golomb-Rice code is moved to temp file when it reaches this size
+var grSpillWords = 64 * 1024
+
+// fileBuffer - zeroed array of 64-bit words in memory mapped temp file, used instead of RAM
+// for large arrays of index build with RecSplitArgs.FileBackedBuffers
+type fileBuffer struct {
+	f           *os.File
+	mmapHandle1 []byte
+	mmapHandle2 *[mmap.MaxMapSize]byte
+	data        []uint64
+}
+
+func newFileBuffer(tmpDir string, words int) (*fileBuffer, error) {
+	if tmpDir != "" {
+		if err := os.MkdirAll(tmpDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := ioutil.TempFile(tmpDir, "erigon-recsplit-buf-")
+	if err != nil {
+		return nil, err
+	}
+	b := &fileBuffer{f: f}
+	size := 8 * words
+	if size == 0 {
+		size = 8 // empty mapping is not allowed
+	}
+	if err = f.Truncate(int64(size)); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if b.mmapHandle1, b.mmapHandle2, err = mmap.MmapRw(f, size); err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.data = (*[mmap.MaxMapSize / 8]uint64)(unsafe.Pointer(&b.mmapHandle1[0]))[:words]
+	return b, nil
+}
+
+// Close unmaps and removes the file, data must not be used after it
+func (b *fileBuffer) Close() {
+	if b == nil {
+		return
+	}
+	_ = mmap.Munmap(b.mmapHandle1, b.mmapHandle2)
+	_ = b.f.Close()
+	_ = os.Remove(b.f.Name())
+	b.mmapHandle1, b.mmapHandle2, b.data = nil, nil, nil
+}
+
+// grSpill - temp file with the beginning of Golomb-Rice code, in the same format as GolombRice.Write writes the code
+type grSpill struct {
+	f     *os.File
+	w     *bufio.Writer
+	words uint64
+}
+
+func newGrSpill(tmpDir string) (*grSpill, error) {
+	if tmpDir != "" {
+		if err := os.MkdirAll(tmpDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := ioutil.TempFile(tmpDir, "erigon-recsplit-gr-")
+	if err != nil {
+		return nil, err
+	}
+	return &grSpill{f: f, w: bufio.NewWriterSize(f, etl.BufIOSize)}, nil
+}
+
+// spill moves all full words of gr to the file, last (partially filled) word is kept in gr
+func (s *grSpill) spill(gr *GolombRice) error {
+	full := len(gr.data) - 1
+	if full <= 0 {
+		return nil
+	}
+	if _, err := s.w.Write(wordsBytes(gr.data[:full])); err != nil {
+		return err
+	}
+	gr.data[0] = gr.data[full]
+	gr.data = gr.data[:1]
+	gr.bitCount -= 64 * full
+	s.words += uint64(full)
+	return nil
+}
+
+// bits returns number of bits in the whole code: in the file and in gr
+func (s *grSpill) bits(gr GolombRice) uint64 {
+	if s == nil {
+		return uint64(gr.Bits())
+	}
+	return 64*s.words + uint64(gr.Bits())
+}
+
+// write outputs the whole code, as GolombRice.Write
+func (s *grSpill) write(gr GolombRice, w io.Writer) error {
+	var numBuf [8]byte
+	binary.BigEndian.PutUint64(numBuf[:], s.words+uint64(len(gr.data)))
+	if _, err := w.Write(numBuf[:]); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, s.f); err != nil {
+		return err
+	}
+	_, err := w.Write(wordsBytes(gr.data))
+	return err
+}
+
+func (s *grSpill) Close() {
+	if s == nil {
+		return
+	}
+	_ = s.f.Close()
+	_ = os.Remove(s.f.Name())
+}
+
+func wordsBytes(words []uint64) []byte {
+	if len(words) == 0 {
+		return nil
+	}
+	return (*[maxDataSize]byte)(unsafe.Pointer(&words[0]))[:len(words)*8]
+}
@@ -82,6 +82,17 @@ func (g *GolombRice) appendFixed(v uint64, log2golomb int) {
 	g.bitCount += log2golomb
 }
 
+// appendBits adds the whole encoding of src to the end of the current encoding
+func (g *GolombRice) appendBits(src GolombRice) {
+	fullWords := src.bitCount / 64
+	for _, w := range src.data[:fullWords] {
+		g.appendFixed(w, 64)
+	}
+	if rest := src.bitCount & 63; rest > 0 {
+		g.appendFixed(src.data[fullWords], rest)
+	}
+}
+
 // Bits returns currrent number of bits in the compact encoding of the hash function representation
 func (g GolombRice) Bits() int {
 	return g.bitCount
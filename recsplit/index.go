@@ -23,11 +23,13 @@ import (
 	"math"
 	"math/bits"
 	"os"
+	"sort"
 	"unsafe"
 
 	"github.com/ledgerwatch/erigon-lib/mmap"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano16"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
+	"github.com/spaolacci/murmur3"
 )
 
 // Index implements index lookup from the file created by the RecSplit
@@ -37,12 +39,17 @@ type Index struct {
 	mmapHandle1        []byte                 // mmap handle for unix (this is used to close mmap)
 	mmapHandle2        *[mmap.MaxMapSize]byte // mmap handle for windows (this is used to close mmap)
 	data               []byte                 // slice of correct size for the index to work with
+	tail               []byte                 // Part of the file after records
+	pread              *preadRecords          // Reader of records for index opened by OpenIndexPread, nil for mmap
 	keyCount           uint64
 	bytesPerRec        int
 	recMask            uint64
 	grData             []uint64
 	ef                 eliasfano16.DoubleEliasFano
+	version            uint8 // Version of index file format
 	enums              bool
+	hash128            bool   // 128-bit fingerprints of keys: bucketHash is 2nd half of fingerprint
+	existence          []byte // Existence filter: byte of fingerprint of key for every index record, nil if index has no filter
 	offsetEf           *eliasfano32.EliasFano
 	baseDataID         uint64
 	bucketCount        uint64 // Number of buckets
@@ -82,19 +89,38 @@ func OpenIndex(indexFile string) (*Index, error) {
 		return nil, err
 	}
 	idx.data = idx.mmapHandle1[:idx.size]
-	// Read number of keys and bytes per record
-	idx.baseDataID = binary.BigEndian.Uint64(idx.data[:8])
-	idx.keyCount = binary.BigEndian.Uint64(idx.data[8:16])
-	idx.bytesPerRec = int(idx.data[16])
+	idx.readHeader(idx.data)
+	idx.tail = idx.data[idx.recordsEnd():]
+	if err = idx.readTail(); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readHeader reads number of keys and bytes per record
+func (idx *Index) readHeader(header []byte) {
+	idx.baseDataID = binary.BigEndian.Uint64(header[:8])
+	idx.keyCount = binary.BigEndian.Uint64(header[8:16])
+	idx.bytesPerRec = int(header[16])
 	idx.recMask = (uint64(1) << (8 * idx.bytesPerRec)) - 1
-	offset := 16 + 1 + int(idx.keyCount)*idx.bytesPerRec
+}
 
+// recordsEnd returns position of the end of records in the file, the rest of the file is tail
+func (idx *Index) recordsEnd() int {
+	return 16 + 1 + int(idx.keyCount)*idx.bytesPerRec
+}
+
+// readTail reads parameters of the hash function and the other parts of index, which follow records, from idx.tail
+func (idx *Index) readTail() error {
+	data := idx.tail
+	offset := 0
 	// Bucket count, bucketSize, leafSize
-	idx.bucketCount = binary.BigEndian.Uint64(idx.data[offset:])
+	idx.bucketCount = binary.BigEndian.Uint64(data[offset:])
 	offset += 8
-	idx.bucketSize = int(binary.BigEndian.Uint16(idx.data[offset:]))
+	idx.bucketSize = int(binary.BigEndian.Uint16(data[offset:]))
 	offset += 2
-	idx.leafSize = binary.BigEndian.Uint16(idx.data[offset:])
+	idx.leafSize = binary.BigEndian.Uint16(data[offset:])
 	offset += 2
 	idx.primaryAggrBound = idx.leafSize * uint16(math.Max(2, math.Ceil(0.35*float64(idx.leafSize)+1./2.)))
 	if idx.leafSize < 7 {
@@ -103,25 +129,43 @@ func OpenIndex(indexFile string) (*Index, error) {
 		idx.secondaryAggrBound = idx.primaryAggrBound * uint16(math.Ceil(0.21*float64(idx.leafSize)+9./10.))
 	}
 	// Salt
-	idx.salt = binary.BigEndian.Uint32(idx.data[offset:])
+	idx.salt = binary.BigEndian.Uint32(data[offset:])
 	offset += 4
 	// Start seed
-	startSeedLen := int(idx.data[offset])
+	startSeedLen := int(data[offset])
 	offset++
 	idx.startSeed = make([]uint64, startSeedLen)
 	for i := 0; i < startSeedLen; i++ {
-		idx.startSeed[i] = binary.BigEndian.Uint64(idx.data[offset:])
+		idx.startSeed[i] = binary.BigEndian.Uint64(data[offset:])
 		offset += 8
 	}
-	idx.enums = idx.data[offset] != 0
+	features := data[offset]
 	offset++
+	idx.version = IndexVersion0
+	if features&featureVersioned != 0 {
+		idx.version = data[offset]
+		offset++
+		features &^= featureVersioned
+	}
+	if idx.version > IndexVersion {
+		return fmt.Errorf("index file %s: unsupported version %d, supported up to %d", idx.indexFile, idx.version, IndexVersion)
+	}
+	if unknown := features &^ knownFeatures; unknown != 0 {
+		return fmt.Errorf("index file %s: unsupported features %08b", idx.indexFile, unknown)
+	}
+	idx.enums = features&featureEnums != 0
+	idx.hash128 = features&featureHash128 != 0
 	if idx.enums {
 		var size int
-		idx.offsetEf, size = eliasfano32.ReadEliasFano(idx.data[offset:])
+		idx.offsetEf, size = eliasfano32.ReadEliasFano(data[offset:])
 		offset += size
 	}
+	if features&featureExistence != 0 {
+		idx.existence = data[offset : offset+int(idx.keyCount)]
+		offset += int(idx.keyCount)
+	}
 	// Size of golomb rice params
-	golombParamSize := binary.BigEndian.Uint16(idx.data[offset:])
+	golombParamSize := binary.BigEndian.Uint16(data[offset:])
 	offset += 4
 	idx.golombRice = make([]uint32, golombParamSize)
 	for i := uint16(0); i < golombParamSize; i++ {
@@ -133,13 +177,12 @@ func OpenIndex(indexFile string) (*Index, error) {
 			computeGolombRice(i, idx.golombRice, idx.leafSize, idx.primaryAggrBound, idx.secondaryAggrBound)
 		}
 	}
-	l := binary.BigEndian.Uint64(idx.data[offset:])
+	l := binary.BigEndian.Uint64(data[offset:])
 	offset += 8
-	p := (*[maxDataSize / 8]uint64)(unsafe.Pointer(&idx.data[offset]))
-	idx.grData = p[:l]
+	idx.grData = unsafe.Slice((*uint64)(unsafe.Pointer(&data[offset])), l) // data can be heap-allocated, see OpenIndexPread
 	offset += 8 * int(l)
-	idx.ef.Read(idx.data[offset:])
-	return idx, nil
+	idx.ef.Read(data[offset:])
+	return nil
 }
 
 func (idx *Index) Size() int64 {
@@ -148,6 +191,13 @@ func (idx *Index) Size() int64 {
 
 func (idx *Index) BaseDataID() uint64 { return idx.baseDataID }
 
+// Version returns version of format of the index file
+func (idx *Index) Version() uint8 { return idx.version }
+
+// RecordWidth returns number of bytes in records of the index. Build chooses the smallest width for the max offset,
+// up to 8 bytes
+func (idx *Index) RecordWidth() int { return idx.bytesPerRec }
+
 func (idx *Index) Close() error {
 	if err := mmap.Munmap(idx.mmapHandle1, idx.mmapHandle2); err != nil {
 		return err
@@ -173,6 +223,13 @@ func (idx *Index) golombParam(m uint16) int {
 	return int(idx.golombRice[m] >> 27)
 }
 
+func (idx *Index) keyHash(bucketHash, fingerprint, salt uint64) uint64 {
+	if idx.hash128 {
+		return remix128(fingerprint, bucketHash, salt)
+	}
+	return remix(fingerprint + salt)
+}
+
 func (idx *Index) Empty() bool {
 	return idx.keyCount == 0
 }
@@ -189,6 +246,43 @@ func (idx *Index) Lookup(bucketHash, fingerprint uint64) uint64 {
 	if idx.keyCount == 1 {
 		return 0
 	}
+	return idx.record(idx.lookupRec(bucketHash, fingerprint))
+}
+
+// TryLookup is Lookup which uses existence filter (see RecSplitArgs.ExistenceFilter): ok is false if key is definitely
+// absent in the index. If ok is true, key is present with probability 255/256. Without filter ok is always true
+func (idx *Index) TryLookup(bucketHash, fingerprint uint64) (offset uint64, ok bool) {
+	if idx.keyCount == 0 {
+		return 0, false
+	}
+	rec := 0
+	if idx.keyCount > 1 {
+		rec = idx.lookupRec(bucketHash, fingerprint)
+	}
+	if idx.existence != nil && idx.existence[rec] != filterByte(fingerprint) {
+		return 0, false
+	}
+	if idx.keyCount == 1 {
+		return 0, true
+	}
+	return idx.record(rec), true
+}
+
+// HasExistenceFilter returns true if index was built with RecSplitArgs.ExistenceFilter
+func (idx *Index) HasExistenceFilter() bool {
+	return idx.existence != nil
+}
+
+// record returns value of index record rec
+func (idx *Index) record(rec int) uint64 {
+	if idx.pread != nil {
+		return idx.pread.record(rec)
+	}
+	return binary.BigEndian.Uint64(idx.data[1+8+idx.bytesPerRec*(rec+1):]) & idx.recMask
+}
+
+// lookupRec returns number of index record of the key, index must have at least 2 keys
+func (idx *Index) lookupRec(bucketHash, fingerprint uint64) int {
 	var gr GolombRiceReader
 	gr.data = idx.grData
 
@@ -199,7 +293,7 @@ func (idx *Index) Lookup(bucketHash, fingerprint uint64) uint64 {
 	var level int
 	for m > idx.secondaryAggrBound { // fanout = 2
 		d := gr.ReadNext(idx.golombParam(m))
-		hmod := remap16(remix(fingerprint+idx.startSeed[level]+d), m)
+		hmod := remap16(idx.keyHash(bucketHash, fingerprint, idx.startSeed[level]+d), m)
 		split := (((m+1)/2 + idx.secondaryAggrBound - 1) / idx.secondaryAggrBound) * idx.secondaryAggrBound
 		if hmod < split {
 			m = split
@@ -212,7 +306,7 @@ func (idx *Index) Lookup(bucketHash, fingerprint uint64) uint64 {
 	}
 	if m > idx.primaryAggrBound {
 		d := gr.ReadNext(idx.golombParam(m))
-		hmod := remap16(remix(fingerprint+idx.startSeed[level]+d), m)
+		hmod := remap16(idx.keyHash(bucketHash, fingerprint, idx.startSeed[level]+d), m)
 		part := hmod / idx.primaryAggrBound
 		if idx.primaryAggrBound < m-part*idx.primaryAggrBound {
 			m = idx.primaryAggrBound
@@ -227,7 +321,7 @@ func (idx *Index) Lookup(bucketHash, fingerprint uint64) uint64 {
 	}
 	if m > idx.leafSize {
 		d := gr.ReadNext(idx.golombParam(m))
-		hmod := remap16(remix(fingerprint+idx.startSeed[level]+d), m)
+		hmod := remap16(idx.keyHash(bucketHash, fingerprint, idx.startSeed[level]+d), m)
 		part := hmod / idx.leafSize
 		if idx.leafSize < m-part*idx.leafSize {
 			m = idx.leafSize
@@ -241,8 +335,7 @@ func (idx *Index) Lookup(bucketHash, fingerprint uint64) uint64 {
 		level++
 	}
 	b := gr.ReadNext(idx.golombParam(m))
-	rec := int(cumKeys) + int(remap16(remix(fingerprint+idx.startSeed[level]+b), m))
-	return binary.BigEndian.Uint64(idx.data[1+8+idx.bytesPerRec*(rec+1):]) & idx.recMask
+	return int(cumKeys) + int(remap16(idx.keyHash(bucketHash, fingerprint, idx.startSeed[level]+b), m))
 }
 
 // OrdinalLookup returns the offset of i-th element in the index
@@ -252,13 +345,53 @@ func (idx *Index) OrdinalLookup(i uint64) uint64 {
 	return idx.offsetEf.Get(i)
 }
 
+type lookupProbe struct {
+	bucketHash  uint64
+	fingerprint uint64
+	i           int // Position in the batch
+}
+
+// LookupMany is batched Lookup of keys: results are appended to out in the order of keys. Probes are done in the order
+// of buckets, which amortizes cache misses and mmap page faults for batches of thousands of keys. Thread-safe
+func (idx *Index) LookupMany(keys [][]byte, out []uint64) []uint64 {
+	hasher := murmur3.New128WithSeed(idx.salt)
+	probes := make([]lookupProbe, len(keys))
+	for i, key := range keys {
+		hasher.Reset()
+		hasher.Write(key) //nolint:errcheck
+		bucketHash, fingerprint := hasher.Sum128()
+		probes[i] = lookupProbe{bucketHash: bucketHash, fingerprint: fingerprint, i: i}
+	}
+	// remap is monotone - order of bucketHash is the order of buckets
+	sort.Slice(probes, func(i, j int) bool { return probes[i].bucketHash < probes[j].bucketHash })
+	start := len(out)
+	out = append(out, make([]uint64, len(keys))...)
+	for _, p := range probes {
+		out[start+p.i] = idx.Lookup(p.bucketHash, p.fingerprint)
+	}
+	return out
+}
+
+// OrdinalLookupMany is batched OrdinalLookup: results are appended to out in the order of ordinals.
+// Elias-Fano is accessed in the order of ordinals
+func (idx *Index) OrdinalLookupMany(ordinals []uint64, out []uint64) []uint64 {
+	order := make([]int, len(ordinals))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return ordinals[order[i]] < ordinals[order[j]] })
+	start := len(out)
+	out = append(out, make([]uint64, len(ordinals))...)
+	for _, i := range order {
+		out[start+i] = idx.offsetEf.Get(ordinals[i])
+	}
+	return out
+}
+
 func (idx *Index) ExtractOffsets() map[uint64]uint64 {
 	m := map[uint64]uint64{}
-	pos := 1 + 8 + idx.bytesPerRec
-	for rec := uint64(0); rec < idx.keyCount; rec++ {
-		offset := binary.BigEndian.Uint64(idx.data[pos:]) & idx.recMask
-		m[offset] = 0
-		pos += idx.bytesPerRec
+	for rec := 0; rec < int(idx.keyCount); rec++ {
+		m[idx.record(rec)] = 0
 	}
 	return m
 }
@@ -288,17 +421,14 @@ func (idx *Index) RewriteWithOffsets(w *bufio.Writer, m map[uint64]uint64) error
 	if err := w.WriteByte(byte(bytesPerRec)); err != nil {
 		return fmt.Errorf("write bytes per record: %w", err)
 	}
-	pos := 1 + 8 + idx.bytesPerRec
-	for rec := uint64(0); rec < idx.keyCount; rec++ {
-		offset := binary.BigEndian.Uint64(idx.data[pos:]) & idx.recMask
-		pos += idx.bytesPerRec
-		binary.BigEndian.PutUint64(numBuf[:], m[offset])
+	for rec := 0; rec < int(idx.keyCount); rec++ {
+		binary.BigEndian.PutUint64(numBuf[:], m[idx.record(rec)])
 		if _, err := w.Write(numBuf[8-bytesPerRec:]); err != nil {
 			return err
 		}
 	}
 	// Write the rest as it is (TODO - wrong for indices with enums)
-	if _, err := w.Write(idx.data[16+1+int(idx.keyCount)*idx.bytesPerRec:]); err != nil {
+	if _, err := w.Write(idx.tail); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,124 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	preadPageSize = 4096
+	// DefaultPreadCachePages - size of cache of records of OpenIndexPread in pages of 4KiB, when 0 is given
+	DefaultPreadCachePages = 256
+)
+
+// OpenIndexPread opens index without mmap: for indices kept on network filesystems (NFS, S3-backed mounts), where
+// mmap performs badly. Records (the largest part of index) are read by positional reads through direct-mapped cache of
+// cachePages pages of 4KiB, the rest of the file (hash function, Elias-Fano of offsets, existence filter) is read into
+// memory - it takes a few bits per key. File is kept open until Close. Lookups panic on read errors
+func OpenIndexPread(indexFile string, cachePages int) (*Index, error) {
+	idx := &Index{
+		indexFile: indexFile,
+	}
+	var err error
+	idx.f, err = os.Open(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	var stat os.FileInfo
+	if stat, err = idx.f.Stat(); err != nil {
+		idx.f.Close()
+		return nil, err
+	}
+	idx.size = stat.Size()
+	var header [17]byte
+	if _, err = idx.f.ReadAt(header[:], 0); err != nil {
+		idx.f.Close()
+		return nil, fmt.Errorf("read header of index file %s: %w", indexFile, err)
+	}
+	idx.readHeader(header[:])
+	recordsEnd := int64(idx.recordsEnd())
+	if recordsEnd > idx.size {
+		idx.f.Close()
+		return nil, fmt.Errorf("index file %s is too short: %d, records end at %d", indexFile, idx.size, recordsEnd)
+	}
+	idx.tail = make([]byte, idx.size-recordsEnd)
+	if _, err = idx.f.ReadAt(idx.tail, recordsEnd); err != nil {
+		idx.f.Close()
+		return nil, fmt.Errorf("read index file %s: %w", indexFile, err)
+	}
+	if err = idx.readTail(); err != nil {
+		idx.f.Close()
+		return nil, err
+	}
+	if cachePages <= 0 {
+		cachePages = DefaultPreadCachePages
+	}
+	idx.pread = &preadRecords{f: idx.f, bytesPerRec: idx.bytesPerRec, pages: make([]preadPage, cachePages)}
+	return idx, nil
+}
+
+type preadPage struct {
+	num  int64 // Number of page in the file plus 1, 0 - empty
+	len  int
+	data [preadPageSize]byte
+}
+
+// preadRecords - reader of index records using positional reads and direct-mapped cache of pages, safe for concurrent use
+type preadRecords struct {
+	f           *os.File
+	bytesPerRec int
+	mu          sync.Mutex
+	pages       []preadPage
+}
+
+func (r *preadRecords) record(rec int) uint64 {
+	var numBuf [8]byte
+	if err := r.readAt(numBuf[8-r.bytesPerRec:], int64(17+rec*r.bytesPerRec)); err != nil {
+		panic(fmt.Errorf("read record %d of index file %s: %w", rec, r.f.Name(), err))
+	}
+	return binary.BigEndian.Uint64(numBuf[:])
+}
+
+func (r *preadRecords) readAt(buf []byte, off int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(buf) > 0 {
+		num := off / preadPageSize
+		p := &r.pages[num%int64(len(r.pages))]
+		if p.num != num+1 {
+			n, err := r.f.ReadAt(p.data[:], num*preadPageSize)
+			if err != nil && err != io.EOF {
+				p.num = 0
+				return err
+			}
+			p.num, p.len = num+1, n
+		}
+		start := int(off - num*preadPageSize)
+		if start >= p.len {
+			return io.ErrUnexpectedEOF
+		}
+		n := copy(buf, p.data[start:p.len])
+		buf = buf[n:]
+		off += int64(n)
+	}
+	return nil
+}
@@ -63,6 +63,23 @@ func (r *IndexReader) Lookup(key []byte) uint64 {
 	return 0
 }
 
+// TryLookup wraps index TryLookup
+func (r *IndexReader) TryLookup(key []byte) (uint64, bool) {
+	bucketHash, fingerprint := r.sum(key)
+	if r.index != nil {
+		return r.index.TryLookup(bucketHash, fingerprint)
+	}
+	return 0, false
+}
+
+// LookupMany wraps index LookupMany
+func (r *IndexReader) LookupMany(keys [][]byte, out []uint64) []uint64 {
+	if r.index != nil {
+		return r.index.LookupMany(keys, out)
+	}
+	return append(out, make([]uint64, len(keys))...)
+}
+
 func (r *IndexReader) Lookup2(key1, key2 []byte) uint64 {
 	bucketHash, fingerprint := r.sum2(key1, key2)
 	if r.index != nil {
@@ -18,11 +18,16 @@ package recsplit
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/log/v3"
 	"github.com/stretchr/testify/require"
 )
 
@@ -78,3 +83,289 @@ func TestReWriteIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupMany(t *testing.T) {
+	tmpDir := t.TempDir()
+	indexFile := filepath.Join(tmpDir, "index")
+	rs, err := NewRecSplit(RecSplitArgs{
+		KeyCount:   1000,
+		BucketSize: 10,
+		Salt:       0,
+		TmpDir:     tmpDir,
+		IndexFile:  indexFile,
+		LeafSize:   8,
+		Enums:      true,
+	})
+	require.NoError(t, err)
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key %d", i))
+		require.NoError(t, rs.AddKey(keys[i], uint64(i*17)))
+	}
+	require.NoError(t, rs.Build())
+	idx := MustOpen(indexFile)
+	defer idx.Close()
+	reader := NewIndexReader(idx)
+
+	out := []uint64{42}
+	out = reader.LookupMany(keys, out)
+	require.Equal(t, 1001, len(out))
+	require.Equal(t, uint64(42), out[0])
+	enums := out[1:]
+	for i, key := range keys {
+		require.Equal(t, reader.Lookup(key), enums[i])
+	}
+	offsets := idx.OrdinalLookupMany(enums, nil)
+	for i := range keys {
+		require.Equal(t, uint64(i*17), offsets[i])
+	}
+}
+
+func TestExistenceFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, keyCount := range []int{1, 1000} {
+		indexFile := filepath.Join(tmpDir, fmt.Sprintf("index%d", keyCount))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:        keyCount,
+			BucketSize:      10,
+			Salt:            0,
+			TmpDir:          tmpDir,
+			IndexFile:       indexFile,
+			LeafSize:        8,
+			ExistenceFilter: true,
+		})
+		require.NoError(t, err)
+		for i := 0; i < keyCount; i++ {
+			require.NoError(t, rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)))
+		}
+		require.NoError(t, rs.Build())
+		rs.Close()
+		idx := MustOpen(indexFile)
+		require.True(t, idx.HasExistenceFilter())
+		reader := NewIndexReader(idx)
+		for i := 0; i < keyCount; i++ {
+			offset, ok := reader.TryLookup([]byte(fmt.Sprintf("key %d", i)))
+			require.True(t, ok)
+			if keyCount > 1 {
+				require.Equal(t, uint64(i*17), offset)
+			}
+		}
+		var falsePositives int
+		for i := 0; i < 10000; i++ {
+			if _, ok := reader.TryLookup([]byte(fmt.Sprintf("absent %d", i))); ok {
+				falsePositives++
+			}
+		}
+		require.Less(t, falsePositives, 200) // expected 10000/256
+		idx.Close()
+	}
+}
+
+func TestIndexVersions(t *testing.T) {
+	tmpDir := t.TempDir()
+	build := func(name string, hash128 bool) (file string, data []byte, flagsPos int) {
+		file = filepath.Join(tmpDir, name)
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   100,
+			BucketSize: 10,
+			Salt:       0,
+			TmpDir:     tmpDir,
+			IndexFile:  file,
+			LeafSize:   8,
+			Enums:      true,
+			Hash128:    hash128,
+		})
+		require.NoError(t, err)
+		defer rs.Close()
+		for i := 0; i < 100; i++ {
+			require.NoError(t, rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)))
+		}
+		require.NoError(t, rs.Build())
+		idx := MustOpen(file)
+		// Position of flags: after records, bucket count, bucket size, leaf size, salt and start seeds
+		flagsPos = 16 + 1 + int(idx.keyCount)*idx.bytesPerRec + 8 + 2 + 2 + 4 + 1 + 8*len(idx.startSeed)
+		require.NoError(t, idx.Close())
+		data, err = os.ReadFile(file)
+		require.NoError(t, err)
+		return file, data, flagsPos
+	}
+	writeIndex := func(name string, data []byte) string {
+		file := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(file, data, 0644))
+		return file
+	}
+	checkLookups := func(file string, version uint8) {
+		idx, err := OpenIndex(file)
+		require.NoError(t, err)
+		require.Equal(t, version, idx.Version())
+		reader := NewIndexReader(idx)
+		for i := 0; i < 100; i++ {
+			enum := reader.Lookup([]byte(fmt.Sprintf("key %d", i)))
+			require.Equal(t, uint64(i*17), idx.OrdinalLookup(enum))
+		}
+		require.NoError(t, idx.Close())
+	}
+
+	// Features known to version 0 readers - file is written in version 0 layout
+	file, data, flagsPos := build("index_v0", false)
+	require.Equal(t, featureEnums, data[flagsPos])
+	checkLookups(file, IndexVersion0)
+
+	// Hash128 is unknown to version 0 readers - flags are followed by version
+	file, data, flagsPos = build("index_v1", true)
+	require.Equal(t, featureEnums|featureHash128|featureVersioned, data[flagsPos])
+	require.Equal(t, IndexVersion1, data[flagsPos+1])
+	checkLookups(file, IndexVersion1)
+
+	future := append([]byte{}, data...)
+	future[flagsPos+1] = IndexVersion + 1
+	_, err := OpenIndex(writeIndex("index_future", future))
+	require.Error(t, err)
+	unknown := append([]byte{}, data...)
+	unknown[flagsPos] |= 1 << 6
+	_, err = OpenIndex(writeIndex("index_unknown", unknown))
+	require.Error(t, err)
+}
+
+func TestVerifyIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataFile := filepath.Join(tmpDir, "data")
+	c, err := compress.NewCompressor(context.Background(), t.Name(), dataFile, tmpDir, 100, 1, log.LvlDebug)
+	require.NoError(t, err)
+	defer c.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, c.AddWord([]byte(fmt.Sprintf("key %d", i))))
+		require.NoError(t, c.AddWord([]byte(fmt.Sprintf("value %d", i))))
+	}
+	require.NoError(t, c.Compress())
+	d, err := compress.NewDecompressor(dataFile)
+	require.NoError(t, err)
+	defer d.Close()
+
+	buildIndex := func(name string, enums bool, corrupt int) *Index {
+		indexFile := filepath.Join(tmpDir, name)
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   d.Count() / 2,
+			BucketSize: 100,
+			Salt:       1,
+			TmpDir:     tmpDir,
+			IndexFile:  indexFile,
+			LeafSize:   8,
+			Enums:      enums,
+		})
+		require.NoError(t, err)
+		defer rs.Close()
+		g := d.MakeGetter()
+		var key []byte
+		var offset uint64
+		for i := 0; g.HasNext(); i++ {
+			key, _ = g.Next(key[:0])
+			if i == corrupt {
+				key = append(key, '!')
+			}
+			require.NoError(t, rs.AddKey(key, offset))
+			offset = g.Skip()
+		}
+		require.NoError(t, rs.Build())
+		return MustOpen(indexFile)
+	}
+	for _, enums := range []bool{false, true} {
+		idx := buildIndex(fmt.Sprintf("index_%t", enums), enums, -1)
+		require.NoError(t, VerifyIndex(idx, d))
+		require.NoError(t, idx.Close())
+		idx = buildIndex(fmt.Sprintf("index_corrupt_%t", enums), enums, 500)
+		require.Error(t, VerifyIndex(idx, d))
+		require.NoError(t, idx.Close())
+	}
+}
+
+func TestOpenIndexPread(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, enums := range []bool{false, true} {
+		indexFile := filepath.Join(tmpDir, fmt.Sprintf("index_%t", enums))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:        10000,
+			BucketSize:      100,
+			Salt:            1,
+			TmpDir:          tmpDir,
+			IndexFile:       indexFile,
+			LeafSize:        8,
+			Enums:           enums,
+			ExistenceFilter: true,
+		})
+		require.NoError(t, err)
+		for i := 0; i < 10000; i++ {
+			require.NoError(t, rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*1000003)))
+		}
+		require.NoError(t, rs.Build())
+		rs.Close()
+
+		idx := MustOpen(indexFile)
+		defer idx.Close()
+		for _, cachePages := range []int{1, 0} {
+			pidx, err := OpenIndexPread(indexFile, cachePages)
+			require.NoError(t, err)
+			require.Equal(t, idx.KeyCount(), pidx.KeyCount())
+			require.Equal(t, idx.RecordWidth(), pidx.RecordWidth())
+			offsets, oks := make([]uint64, 10000), make([]bool, 10000)
+			done := make(chan struct{})
+			for w := 0; w < 4; w++ {
+				go func(w int) {
+					defer func() { done <- struct{}{} }()
+					preader := NewIndexReader(pidx)
+					for i := w; i < 10000; i += 4 {
+						offsets[i], oks[i] = preader.TryLookup([]byte(fmt.Sprintf("key %d", i)))
+					}
+				}(w)
+			}
+			for w := 0; w < 4; w++ {
+				<-done
+			}
+			reader := NewIndexReader(idx)
+			for i := 0; i < 10000; i++ {
+				require.True(t, oks[i])
+				require.Equal(t, reader.Lookup([]byte(fmt.Sprintf("key %d", i))), offsets[i])
+			}
+			require.Equal(t, idx.ExtractOffsets(), pidx.ExtractOffsets())
+			if enums {
+				for i := uint64(0); i < 10000; i++ {
+					require.Equal(t, i*1000003, pidx.OrdinalLookup(i))
+				}
+			}
+			require.NoError(t, pidx.Close())
+		}
+	}
+}
+
+// Indices built with default options are written byte for byte as before versioning of index format
+func TestIndexVersion0Layout(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, tc := range []struct {
+		enums bool
+		hash  string // sha256 of index file built before versioning of index format
+	}{
+		{false, "b0216a6ff1fc7e74b8dfcd3ac574cebc4ead6d2d95010e6f43a1d8c8a1078dea"},
+		{true, "0d31357c2592e11d4c8084e60e06df2e412dc250242390829d9ef09271f5f725"},
+	} {
+		file := filepath.Join(tmpDir, fmt.Sprintf("index_%t", tc.enums))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   100,
+			BucketSize: 10,
+			Salt:       1,
+			TmpDir:     tmpDir,
+			IndexFile:  file,
+			LeafSize:   8,
+			Enums:      tc.enums,
+		})
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)))
+		}
+		require.NoError(t, rs.Build())
+		rs.Close()
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		hash := sha256.Sum256(data)
+		require.Equal(t, tc.hash, hex.EncodeToString(hash[:]), "enums=%t", tc.enums)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"fmt"
+	"math"
+)
+
+// SaltStrategy - how salt of the hash function allocating the initial buckets is chosen
+type SaltStrategy int
+
+const (
+	// SaltRandom - salt is generated randomly by NewRecSplit, so that different nodes are likely to use different
+	// hash functions and collision attacks are unlikely to slow down many nodes at the same time
+	SaltRandom SaltStrategy = iota
+	// SaltFixed - Options.Salt is used, index of the same keys is reproducible
+	SaltFixed
+)
+
+func (s SaltStrategy) String() string {
+	switch s {
+	case SaltRandom:
+		return "random"
+	case SaltFixed:
+		return "fixed"
+	default:
+		return fmt.Sprintf("SaltStrategy(%d)", int(s))
+	}
+}
+
+// Options - parameters of the perfect hash function, which determine the trade-off between time of Build,
+// size of the index and speed of lookups. Use one of presets, or Validate custom options
+type Options struct {
+	BucketSize   int    // Larger buckets result in smaller index, at the cost of slower lookups
+	LeafSize     uint16 // Larger leaves result in smaller index, at the cost of (exponentially) slower Build
+	SaltStrategy SaltStrategy
+	Salt         uint32 // Only for SaltFixed, must not be 0
+}
+
+var (
+	// FastBuild - small buckets and leaves: fast Build, fast lookups, larger index
+	FastBuild = Options{BucketSize: 100, LeafSize: 5, SaltStrategy: SaltRandom}
+	// SmallIndex - large buckets: compact index for snapshot files, slower Build and lookups
+	SmallIndex = Options{BucketSize: 2000, LeafSize: 8, SaltStrategy: SaltRandom}
+)
+
+var presets = map[string]Options{
+	"fast-build":  FastBuild,
+	"small-index": SmallIndex,
+}
+
+// Preset returns options by name of preset: "fast-build" or "small-index"
+func Preset(name string) (Options, error) {
+	o, ok := presets[name]
+	if !ok {
+		return Options{}, fmt.Errorf("unknown recsplit preset: %q", name)
+	}
+	return o, nil
+}
+
+// MaxBucketSize - sizes of buckets (and their parts) are uint16 in the builder
+const MaxBucketSize = math.MaxUint16
+
+// Validate checks that options can be used to build an index
+func (o Options) Validate() error {
+	if o.BucketSize <= 0 || o.BucketSize > MaxBucketSize {
+		return fmt.Errorf("bucket size must be in range [1, %d]: %d", MaxBucketSize, o.BucketSize)
+	}
+	if o.LeafSize == 0 || o.LeafSize > MaxLeafSize {
+		return fmt.Errorf("leaf size must be in range [1, %d]: %d", MaxLeafSize, o.LeafSize)
+	}
+	switch o.SaltStrategy {
+	case SaltRandom:
+		if o.Salt != 0 {
+			return fmt.Errorf("salt %d is given with salt strategy %s", o.Salt, o.SaltStrategy)
+		}
+	case SaltFixed:
+		if o.Salt == 0 {
+			return fmt.Errorf("salt must not be 0 with salt strategy %s", o.SaltStrategy)
+		}
+	default:
+		return fmt.Errorf("unknown salt strategy: %s", o.SaltStrategy)
+	}
+	return nil
+}
+
+// Apply validates options and sets BucketSize, LeafSize and Salt of args
+func (o Options) Apply(args *RecSplitArgs) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	args.BucketSize = o.BucketSize
+	args.LeafSize = o.LeafSize
+	args.Salt = o.Salt // 0 means random salt for NewRecSplit
+	return nil
+}
@@ -18,9 +18,11 @@ package recsplit
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/bits"
@@ -42,6 +44,23 @@ const RecSplitLogPrefix = "recsplit"
 
 const MaxLeafSize = 24
 
+// Flags of index file
+const (
+	featureEnums     byte = 1 << 0 // Two level index: perfect hash table points to enumeration, enumeration points to offsets
+	featureHash128   byte = 1 << 1 // 128-bit fingerprints of keys, see RecSplitArgs.Hash128
+	featureExistence byte = 1 << 2 // Existence filter, see RecSplitArgs.ExistenceFilter
+	featureVersioned byte = 1 << 7 // Flags are followed by version of index format, not set in files of version 0
+
+	knownFeatures = featureEnums | featureHash128 | featureExistence
+)
+
+// Versions of index file format. OpenIndex reads files of all versions up to IndexVersion
+const (
+	IndexVersion0 uint8 = 0             // No version in the file, byte after start seeds has flags (originally - only enums)
+	IndexVersion1 uint8 = 1             // Flags have featureVersioned bit and are followed by version; flags unknown to reader are rejected
+	IndexVersion        = IndexVersion1 // Latest version, Build writes it only for indices with features unknown to version 0 readers
+)
+
 /** David Stafford's (http://zimbry.blogspot.com/2011/09/better-bit-mixing-improving-on.html)
  * 13th variant of the 64-bit finalizer function in Austin Appleby's
  * MurmurHash3 (https://github.com/aappleby/smhasher).
@@ -56,6 +75,11 @@ func remix(z uint64) uint64 {
 	return z ^ (z >> 31)
 }
 
+// remix128 is remix of 128-bit fingerprint: keys which differ only in bucketHash get different values
+func remix128(fingerprint, bucketHash, salt uint64) uint64 {
+	return remix(remix(fingerprint+salt) ^ bucketHash)
+}
+
 // RecSplit is the implementation of Recursive Split algorithm for constructing perfect hash mapping, described in
 // https://arxiv.org/pdf/1910.06416.pdf Emmanuel Esposito, Thomas Mueller Graf, and Sebastiano Vigna.
 // Recsplit: Minimal perfect hashing via recursive splitting. In 2020 Proceedings of the Symposium on Algorithm Engineering and Experiments (ALENEX),
@@ -68,6 +92,7 @@ type RecSplit struct {
 	bucketCount       uint64          // Number of buckets
 	hasher            murmur3.Hash128 // Salted hash function to use for splitting into initial buckets and mapping to 64-bit fingerprints
 	etlBufLimit       datasize.ByteSize
+	etlBudget         *etl.MemoryBudget
 	bucketCollector   *etl.Collector // Collector that sorts by buckets
 	enums             bool           // Whether to build two level index with perfect hash table pointing to enumeration and enumeration pointing to offsets
 	offsetCollector   *etl.Collector // Collector that sorts by offsets
@@ -75,8 +100,13 @@ type RecSplit struct {
 	currentBucketIdx  uint64         // Current bucket being accumulated
 	currentBucket     []uint64       // 64-bit fingerprints of keys in the current bucket accumulated before the recsplit is performed for that bucket
 	currentBucketOffs []uint64       // Index offsets for the current bucket
-	maxOffset         uint64         // Maximum value of index offset to later decide how many bytes to use for the encoding
-	gr                GolombRice     // Helper object to encode the tree of hash function salts using Golomb-Rice code.
+	currentBucketHash []uint64       // Bucket hashes of keys in the current bucket - second half of 128-bit fingerprints
+	hash128           bool           // Whether keys are identified by 128-bit fingerprints, see RecSplitArgs.Hash128
+	existence         bool           // Whether to build existence filter, see RecSplitArgs.ExistenceFilter
+	existenceF        *os.File       // Temp file with existence filter, in the order of index records
+	existenceW        *bufio.Writer
+	maxOffset         uint64     // Maximum value of index offset to later decide how many bytes to use for the encoding
+	gr                GolombRice // Helper object to encode the tree of hash function salts using Golomb-Rice code.
 	// Helper object to encode the sequence of cumulative number of keys in the buckets
 	// and the sequence of of cumulative bit offsets of buckets in the Golomb-Rice code.
 	ef                 eliasfano16.DoubleEliasFano
@@ -88,9 +118,6 @@ type RecSplit struct {
 	secondaryAggrBound uint16                 // The lower bound for secondary key aggregation (computed from leadSize)
 	startSeed          []uint64
 	golombRice         []uint32
-	buffer             []uint64
-	offsetBuffer       []uint64
-	count              []uint16
 	salt               uint32 // Murmur3 hash used for converting keys to 64-bit values and assigning to buckets
 	collision          bool
 	tmpDir             string
@@ -99,10 +126,25 @@ type RecSplit struct {
 	indexW             *bufio.Writer
 	bytesPerRec        int
 	numBuf             [8]byte
-	bucketKeyBuf       [16]byte
+	bucketKeyBuf       [24]byte
 	trace              bool
 	prevOffset         uint64 // Previously added offset (for calculating minDelta for Elias Fano encoding of "enum -> offset" index)
 	minDelta           uint64 // minDelta for Elias Fano encoding of "enum -> offset" index
+	workers            int    // Number of goroutines processing buckets in Build
+	builder            *bucketBuilder
+	singleBucket       bucket // Reused by single-threaded Build
+	work               chan *bucket
+	pending            []*bucket // Buckets sent to workers, not committed yet - in the order of bucket index
+	freeBuckets        []*bucket
+	fileBacked         bool        // See RecSplitArgs.FileBackedBuffers
+	bucketSizeAccBuf   *fileBuffer // Backing of bucketSizeAcc for fileBacked
+	bucketPosAccBuf    *fileBuffer // Backing of bucketPosAcc for fileBacked
+	grSpill            *grSpill    // Beginning of Golomb-Rice code for fileBacked
+	ctx                context.Context
+	progress           func(BuildProgress)
+	keysProcessed      uint64 // Keys in buckets committed by Build
+	lastProgress       uint64 // keysProcessed when progress was reported last time
+	offsetsLoaded      uint64
 }
 
 type RecSplitArgs struct {
@@ -116,6 +158,15 @@ type RecSplitArgs struct {
 	Enums       bool     // Whether two level index needs to be built, where perfect hash map points to an enumeration, and enumeration points to offsets
 	BaseDataID  uint64
 	EtlBufLimit datasize.ByteSize
+	EtlBudget   *etl.MemoryBudget // RAM limit shared by collectors of this RecSplit with collectors of other RecSplits built concurrently
+	// Keep arrays of index build (accumulators of buckets, offsets of enums) in memory mapped temp files and move Golomb-Rice code
+	// to temp file, instead of RAM: for indices of files much larger than RAM. Index is the same as without this option
+	FileBackedBuffers bool
+	// Store 1 byte of fingerprint of every key in the index: Index.TryLookup of non-member key returns false with probability 255/256,
+	// without access to data file. Costs 1 byte per key
+	ExistenceFilter bool
+	Hash128         bool // 128-bit fingerprints of keys instead of 64-bit: ErrCollision becomes practically impossible, at the cost of slightly slower build and lookup
+	Workers         int  // Number of goroutines recursively splitting buckets in Build, 0 or 1 - single-threaded. Index is the same for any number of workers
 }
 
 // NewRecSplit creates a new RecSplit instance with given number of keys and given bucket size
@@ -123,6 +174,9 @@ type RecSplitArgs struct {
 // salt parameters is used to randomise the hash function construction, to ensure that different Erigon instances (nodes)
 // are likely to use different hash function, to collision attacks are unlikely to slow down any meaningful number of nodes at the same time
 func NewRecSplit(args RecSplitArgs) (*RecSplit, error) {
+	if args.BucketSize <= 0 || args.BucketSize > MaxBucketSize {
+		return nil, fmt.Errorf("bucket size must be in range [1, %d]: %d", MaxBucketSize, args.BucketSize)
+	}
 	bucketCount := (args.KeyCount + args.BucketSize - 1) / args.BucketSize
 	rs := &RecSplit{bucketSize: args.BucketSize, keyExpectedCount: uint64(args.KeyCount), bucketCount: uint64(bucketCount)}
 	if len(args.StartSeed) == 0 {
@@ -146,17 +200,39 @@ func NewRecSplit(args RecSplitArgs) (*RecSplit, error) {
 	if rs.etlBufLimit == 0 {
 		rs.etlBufLimit = etl.BufferOptimalSize
 	}
-	rs.bucketCollector = etl.NewCollector(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit))
+	rs.etlBudget = args.EtlBudget
+	rs.bucketCollector = rs.newCollector()
 	rs.enums = args.Enums
 	if args.Enums {
-		rs.offsetCollector = etl.NewCollector(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit))
+		rs.offsetCollector = rs.newCollector()
 	}
 	rs.currentBucket = make([]uint64, 0, args.BucketSize)
 	rs.currentBucketOffs = make([]uint64, 0, args.BucketSize)
+	rs.hash128 = args.Hash128
+	rs.existence = args.ExistenceFilter
+	if rs.hash128 {
+		rs.currentBucketHash = make([]uint64, 0, args.BucketSize)
+	}
 	rs.maxOffset = 0
-	rs.bucketSizeAcc = make([]uint64, 1, bucketCount+1)
-	rs.bucketPosAcc = make([]uint64, 1, bucketCount+1)
+	rs.fileBacked = args.FileBackedBuffers
+	if rs.fileBacked {
+		var err error
+		if rs.bucketSizeAccBuf, err = newFileBuffer(rs.tmpDir, bucketCount+1); err != nil {
+			rs.Close()
+			return nil, err
+		}
+		if rs.bucketPosAccBuf, err = newFileBuffer(rs.tmpDir, bucketCount+1); err != nil {
+			rs.Close()
+			return nil, err
+		}
+		rs.bucketSizeAcc = rs.bucketSizeAccBuf.data[:1]
+		rs.bucketPosAcc = rs.bucketPosAccBuf.data[:1]
+	} else {
+		rs.bucketSizeAcc = make([]uint64, 1, bucketCount+1)
+		rs.bucketPosAcc = make([]uint64, 1, bucketCount+1)
+	}
 	if args.LeafSize > MaxLeafSize {
+		rs.Close()
 		return nil, fmt.Errorf("exceeded max leaf size %d: %d", MaxLeafSize, args.LeafSize)
 	}
 	rs.leafSize = args.LeafSize
@@ -167,10 +243,16 @@ func NewRecSplit(args RecSplitArgs) (*RecSplit, error) {
 		rs.secondaryAggrBound = rs.primaryAggrBound * uint16(math.Ceil(0.21*float64(rs.leafSize)+9./10.))
 	}
 	rs.startSeed = args.StartSeed
-	rs.count = make([]uint16, rs.secondaryAggrBound)
+	rs.workers = args.Workers
 	return rs, nil
 }
 
+func (rs *RecSplit) newCollector() *etl.Collector {
+	c := etl.NewCollector(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit))
+	c.SetMemoryBudget(rs.etlBudget)
+	return c
+}
+
 func (rs *RecSplit) Close() {
 	if rs.indexF != nil {
 		rs.indexF.Close()
@@ -181,6 +263,8 @@ func (rs *RecSplit) Close() {
 	if rs.offsetCollector != nil {
 		rs.offsetCollector.Close()
 	}
+	rs.bucketSizeAccBuf.Close()
+	rs.bucketPosAccBuf.Close()
 }
 
 func (rs *RecSplit) LogLvl(lvl log.Lvl) {
@@ -196,6 +280,31 @@ func (rs *RecSplit) SetTrace(trace bool) {
 	rs.trace = trace
 }
 
+// buildProgressStep - number of keys between calls of progress callback
+const buildProgressStep = 64 * 1024
+
+// BuildProgress - state of Build, reported to the callback set by SetProgress
+type BuildProgress struct {
+	KeysProcessed uint64 // Keys in buckets processed so far
+	Keys          uint64
+	Bucket        uint64 // Last processed bucket
+	Buckets       uint64
+}
+
+// SetProgress sets callback which is called by Build every buildProgressStep keys and when all buckets are processed.
+// Callback is called from the goroutine of Build
+func (rs *RecSplit) SetProgress(f func(BuildProgress)) {
+	rs.progress = f
+}
+
+func (rs *RecSplit) reportProgress(bucket uint64, force bool) {
+	if rs.progress == nil || (!force && rs.keysProcessed-rs.lastProgress < buildProgressStep) {
+		return
+	}
+	rs.lastProgress = rs.keysProcessed
+	rs.progress(BuildProgress{KeysProcessed: rs.keysProcessed, Keys: rs.keysAdded, Bucket: bucket, Buckets: rs.bucketCount})
+}
+
 // remap converts the number x which is assumed to be uniformly distributed over the range [0..2^64) to the number that is uniformly
 // distributed over the range [0..n)
 func remap(x uint64, n uint64) uint64 {
@@ -222,13 +331,14 @@ func (rs *RecSplit) ResetNextSalt() {
 	if rs.bucketCollector != nil {
 		rs.bucketCollector.Close()
 	}
-	rs.bucketCollector = etl.NewCollector(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit))
+	rs.bucketCollector = rs.newCollector()
 	if rs.offsetCollector != nil {
 		rs.offsetCollector.Close()
-		rs.offsetCollector = etl.NewCollector(RecSplitLogPrefix, rs.tmpDir, etl.NewSortableBuffer(rs.etlBufLimit))
+		rs.offsetCollector = rs.newCollector()
 	}
 	rs.currentBucket = rs.currentBucket[:0]
 	rs.currentBucketOffs = rs.currentBucketOffs[:0]
+	rs.currentBucketHash = rs.currentBucketHash[:0]
 	rs.maxOffset = 0
 	rs.bucketSizeAcc = rs.bucketSizeAcc[:1] // First entry is always zero
 	rs.bucketPosAcc = rs.bucketPosAcc[:1]   // First entry is always zero
@@ -283,26 +393,6 @@ func computeGolombRice(m uint16, table []uint32, leafSize, primaryAggrBound, sec
 	table[m] |= nodes << 16
 }
 
-// golombParam returns the optimal Golomb parameter to use for encoding
-// salt for the part of the hash function separating m elements. It is based on
-// calculations with assumptions that we draw hash functions at random
-func (rs *RecSplit) golombParam(m uint16) int {
-	s := uint16(len(rs.golombRice))
-	for m >= s {
-		rs.golombRice = append(rs.golombRice, 0)
-		// For the case where bucket is larger than planned
-		if s == 0 {
-			rs.golombRice[0] = (bijMemo[0] << 27) | bijMemo[0]
-		} else if s <= rs.leafSize {
-			rs.golombRice[s] = (bijMemo[s] << 27) | (uint32(1) << 16) | bijMemo[s]
-		} else {
-			computeGolombRice(s, rs.golombRice, rs.leafSize, rs.primaryAggrBound, rs.secondaryAggrBound)
-		}
-		s++
-	}
-	return int(rs.golombRice[m] >> 27)
-}
-
 // Add key to the RecSplit. There can be many more keys than what fits in RAM, and RecSplit
 // spills data onto disk to accomodate that. The key gets copied by the collector, therefore
 // the slice underlying key is not getting accessed by RecSplit after this invocation.
@@ -315,6 +405,11 @@ func (rs *RecSplit) AddKey(key []byte, offset uint64) error {
 	hi, lo := rs.hasher.Sum128()
 	binary.BigEndian.PutUint64(rs.bucketKeyBuf[:], remap(hi, rs.bucketCount))
 	binary.BigEndian.PutUint64(rs.bucketKeyBuf[8:], lo)
+	bucketKey := rs.bucketKeyBuf[:16]
+	if rs.hash128 {
+		binary.BigEndian.PutUint64(rs.bucketKeyBuf[16:], hi)
+		bucketKey = rs.bucketKeyBuf[:24]
+	}
 	binary.BigEndian.PutUint64(rs.numBuf[:], offset)
 	if offset > rs.maxOffset {
 		rs.maxOffset = offset
@@ -331,11 +426,11 @@ func (rs *RecSplit) AddKey(key []byte, offset uint64) error {
 			return err
 		}
 		binary.BigEndian.PutUint64(rs.numBuf[:], rs.keysAdded)
-		if err := rs.bucketCollector.Collect(rs.bucketKeyBuf[:], rs.numBuf[:]); err != nil {
+		if err := rs.bucketCollector.Collect(bucketKey, rs.numBuf[:]); err != nil {
 			return err
 		}
 	} else {
-		if err := rs.bucketCollector.Collect(rs.bucketKeyBuf[:], rs.numBuf[:]); err != nil {
+		if err := rs.bucketCollector.Collect(bucketKey, rs.numBuf[:]); err != nil {
 			return err
 		}
 	}
@@ -344,160 +439,6 @@ func (rs *RecSplit) AddKey(key []byte, offset uint64) error {
 	return nil
 }
 
-func (rs *RecSplit) recsplitCurrentBucket() error {
-	// Extend rs.bucketSizeAcc to accomodate current bucket index + 1
-	for len(rs.bucketSizeAcc) <= int(rs.currentBucketIdx)+1 {
-		rs.bucketSizeAcc = append(rs.bucketSizeAcc, rs.bucketSizeAcc[len(rs.bucketSizeAcc)-1])
-	}
-	rs.bucketSizeAcc[int(rs.currentBucketIdx)+1] += uint64(len(rs.currentBucket))
-	// Sets of size 0 and 1 are not further processed, just write them to index
-	if len(rs.currentBucket) > 1 {
-		for i, key := range rs.currentBucket[1:] {
-			if key == rs.currentBucket[i] {
-				rs.collision = true
-				return fmt.Errorf("%w: %x", ErrCollision, key)
-			}
-		}
-		bitPos := rs.gr.bitCount
-		if rs.buffer == nil {
-			rs.buffer = make([]uint64, len(rs.currentBucket))
-			rs.offsetBuffer = make([]uint64, len(rs.currentBucketOffs))
-		} else {
-			for len(rs.buffer) < len(rs.currentBucket) {
-				rs.buffer = append(rs.buffer, 0)
-				rs.offsetBuffer = append(rs.offsetBuffer, 0)
-			}
-		}
-		unary, err := rs.recsplit(0 /* level */, rs.currentBucket, rs.currentBucketOffs, nil /* unary */)
-		if err != nil {
-			return err
-		}
-		rs.gr.appendUnaryAll(unary)
-		if rs.trace {
-			fmt.Printf("recsplitBucket(%d, %d, bitsize = %d)\n", rs.currentBucketIdx, len(rs.currentBucket), rs.gr.bitCount-bitPos)
-		}
-	} else {
-		for _, offset := range rs.currentBucketOffs {
-			binary.BigEndian.PutUint64(rs.numBuf[:], offset)
-			if _, err := rs.indexW.Write(rs.numBuf[8-rs.bytesPerRec:]); err != nil {
-				return err
-			}
-		}
-	}
-	// Extend rs.bucketPosAcc to accomodate current bucket index + 1
-	for len(rs.bucketPosAcc) <= int(rs.currentBucketIdx)+1 {
-		rs.bucketPosAcc = append(rs.bucketPosAcc, rs.bucketPosAcc[len(rs.bucketPosAcc)-1])
-	}
-	rs.bucketPosAcc[int(rs.currentBucketIdx)+1] = uint64(rs.gr.Bits())
-	// clear for the next buckey
-	rs.currentBucket = rs.currentBucket[:0]
-	rs.currentBucketOffs = rs.currentBucketOffs[:0]
-	return nil
-}
-
-// recsplit applies recSplit algorithm to the given bucket
-func (rs *RecSplit) recsplit(level int, bucket []uint64, offsets []uint64, unary []uint64) ([]uint64, error) {
-	if rs.trace {
-		fmt.Printf("recsplit(%d, %d, %x)\n", level, len(bucket), bucket)
-	}
-	// Pick initial salt for this level of recursive split
-	salt := rs.startSeed[level]
-	m := uint16(len(bucket))
-	if m <= rs.leafSize {
-		// No need to build aggregation levels - just find find bijection
-		var mask uint32
-		for {
-			mask = 0
-			var fail bool
-			for i := uint16(0); !fail && i < m; i++ {
-				bit := uint32(1) << remap16(remix(bucket[i]+salt), m)
-				if mask&bit != 0 {
-					fail = true
-				} else {
-					mask |= bit
-				}
-			}
-			if !fail {
-				break
-			}
-			salt++
-		}
-		for i := uint16(0); i < m; i++ {
-			j := remap16(remix(bucket[i]+salt), m)
-			rs.offsetBuffer[j] = offsets[i]
-		}
-		for _, offset := range rs.offsetBuffer[:m] {
-			binary.BigEndian.PutUint64(rs.numBuf[:], offset)
-			if _, err := rs.indexW.Write(rs.numBuf[8-rs.bytesPerRec:]); err != nil {
-				return nil, err
-			}
-		}
-		salt -= rs.startSeed[level]
-		log2golomb := rs.golombParam(m)
-		if rs.trace {
-			fmt.Printf("encode bij %d with log2golomn %d at p = %d\n", salt, log2golomb, rs.gr.bitCount)
-		}
-		rs.gr.appendFixed(salt, log2golomb)
-		unary = append(unary, salt>>log2golomb)
-	} else {
-		fanout, unit := splitParams(m, rs.leafSize, rs.primaryAggrBound, rs.secondaryAggrBound)
-		count := rs.count
-		for {
-			for i := uint16(0); i < fanout-1; i++ {
-				count[i] = 0
-			}
-			var fail bool
-			for i := uint16(0); i < m; i++ {
-				count[remap16(remix(bucket[i]+salt), m)/unit]++
-			}
-			for i := uint16(0); i < fanout-1; i++ {
-				fail = fail || (count[i] != unit)
-			}
-			if !fail {
-				break
-			}
-			salt++
-		}
-		for i, c := uint16(0), uint16(0); i < fanout; i++ {
-			count[i] = c
-			c += unit
-		}
-		for i := uint16(0); i < m; i++ {
-			j := remap16(remix(bucket[i]+salt), m) / unit
-			rs.buffer[count[j]] = bucket[i]
-			rs.offsetBuffer[count[j]] = offsets[i]
-			count[j]++
-		}
-		copy(bucket, rs.buffer)
-		copy(offsets, rs.offsetBuffer)
-		salt -= rs.startSeed[level]
-		log2golomb := rs.golombParam(m)
-		if rs.trace {
-			fmt.Printf("encode fanout %d: %d with log2golomn %d at p = %d\n", fanout, salt, log2golomb, rs.gr.bitCount)
-		}
-		rs.gr.appendFixed(salt, log2golomb)
-		unary = append(unary, salt>>log2golomb)
-		var err error
-		var i uint16
-		for i = 0; i < m-unit; i += unit {
-			if unary, err = rs.recsplit(level+1, bucket[i:i+unit], offsets[i:i+unit], unary); err != nil {
-				return nil, err
-			}
-		}
-		if m-i > 1 {
-			if unary, err = rs.recsplit(level+1, bucket[i:], offsets[i:], unary); err != nil {
-				return nil, err
-			}
-		} else if m-i == 1 {
-			binary.BigEndian.PutUint64(rs.numBuf[:], offsets[i])
-			if _, err := rs.indexW.Write(rs.numBuf[8-rs.bytesPerRec:]); err != nil {
-				return nil, err
-			}
-		}
-	}
-	return unary, nil
-}
-
 // loadFuncBucket is required to satisfy the type etl.LoadFunc type, to use with collector.Load
 func (rs *RecSplit) loadFuncBucket(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
 	// k is the BigEndian encoding of the bucket number, and the v is the key that is assigned into that bucket
@@ -512,18 +453,59 @@ func (rs *RecSplit) loadFuncBucket(k, v []byte, _ etl.CurrentTableReader, _ etl.
 	}
 	rs.currentBucket = append(rs.currentBucket, binary.BigEndian.Uint64(k[8:]))
 	rs.currentBucketOffs = append(rs.currentBucketOffs, binary.BigEndian.Uint64(v))
+	if rs.hash128 {
+		rs.currentBucketHash = append(rs.currentBucketHash, binary.BigEndian.Uint64(k[16:]))
+	}
+	return nil
+}
+
+func (rs *RecSplit) loadBuckets() error {
+	if rs.workers > 1 {
+		stop := rs.startWorkers()
+		defer stop()
+	} else {
+		rs.builder = rs.newBucketBuilder(rs.golombRice)
+		defer func() { rs.golombRice = rs.builder.golombRice }()
+	}
+	rs.currentBucketIdx = math.MaxUint64 // To make sure 0 bucket is detected
+	if err := rs.bucketCollector.Load(nil, "", rs.loadFuncBucket, etl.TransformArgs{}); err != nil {
+		return err
+	}
+	if len(rs.currentBucket) > 0 {
+		if err := rs.recsplitCurrentBucket(); err != nil {
+			return err
+		}
+	}
+	if err := rs.commitPending(len(rs.pending)); err != nil {
+		return err
+	}
+	if rs.keysProcessed > 0 {
+		rs.reportProgress(rs.currentBucketIdx, true)
+	}
 	return nil
 }
 
 func (rs *RecSplit) loadFuncOffset(k, _ []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
 	offset := binary.BigEndian.Uint64(k)
 	rs.offsetEf.AddOffset(offset)
+	rs.offsetsLoaded++
+	if rs.offsetsLoaded%buildProgressStep == 0 {
+		return rs.ctx.Err()
+	}
 	return nil
 }
 
 // Build has to be called after all the keys have been added, and it initiates the process
 // of building the perfect hash function and writing index into a file
 func (rs *RecSplit) Build() error {
+	return rs.BuildContext(context.Background())
+}
+
+// BuildContext is Build which is aborted with ctx.Err() when ctx is done
+func (rs *RecSplit) BuildContext(ctx context.Context) error {
+	rs.ctx = ctx
+	defer func() { rs.ctx = nil }()
+	rs.keysProcessed, rs.lastProgress, rs.offsetsLoaded = 0, 0, 0
 	tmpIdxFilePath := rs.indexFile + ".tmp"
 
 	if rs.built {
@@ -551,21 +533,32 @@ func (rs *RecSplit) Build() error {
 	if _, err = rs.indexW.Write(rs.numBuf[:]); err != nil {
 		return fmt.Errorf("write number of keys: %w", err)
 	}
-	// Write number of bytes per index record
+	// Write number of bytes per index record: enough for max offset, up to 8 bytes for data files of any size
 	rs.bytesPerRec = (bits.Len64(rs.maxOffset) + 7) / 8
 	if err = rs.indexW.WriteByte(byte(rs.bytesPerRec)); err != nil {
 		return fmt.Errorf("write bytes per record: %w", err)
 	}
 
-	rs.currentBucketIdx = math.MaxUint64 // To make sure 0 bucket is detected
-	defer rs.bucketCollector.Close()
-	if err := rs.bucketCollector.Load(nil, "", rs.loadFuncBucket, etl.TransformArgs{}); err != nil {
-		return err
+	if rs.fileBacked {
+		if rs.grSpill, err = newGrSpill(rs.tmpDir); err != nil {
+			return err
+		}
+		defer rs.grSpill.Close()
 	}
-	if len(rs.currentBucket) > 0 {
-		if err := rs.recsplitCurrentBucket(); err != nil {
+	if rs.existence {
+		if rs.existenceF, err = ioutil.TempFile(rs.tmpDir, "erigon-recsplit-existence-"); err != nil {
 			return err
 		}
+		rs.existenceW = bufio.NewWriterSize(rs.existenceF, etl.BufIOSize)
+		defer func() {
+			_ = rs.existenceF.Close()
+			_ = os.Remove(rs.existenceF.Name())
+			rs.existenceF, rs.existenceW = nil, nil
+		}()
+	}
+	defer rs.bucketCollector.Close()
+	if err := rs.loadBuckets(); err != nil {
+		return err
 	}
 
 	if ASSERT {
@@ -578,7 +571,19 @@ func (rs *RecSplit) Build() error {
 	}
 
 	if rs.enums {
-		rs.offsetEf = eliasfano32.NewEliasFano(rs.keysAdded, rs.maxOffset)
+		if rs.fileBacked {
+			buf, err := newFileBuffer(rs.tmpDir, eliasfano32.DataWords(rs.keysAdded, rs.maxOffset))
+			if err != nil {
+				return err
+			}
+			defer func() {
+				buf.Close()
+				rs.offsetEf = nil
+			}()
+			rs.offsetEf = eliasfano32.NewEliasFanoWithBuffer(rs.keysAdded, rs.maxOffset, buf.data)
+		} else {
+			rs.offsetEf = eliasfano32.NewEliasFano(rs.keysAdded, rs.maxOffset)
+		}
 		defer rs.offsetCollector.Close()
 		if err := rs.offsetCollector.Load(nil, "", rs.loadFuncOffset, etl.TransformArgs{}); err != nil {
 			return err
@@ -617,13 +622,16 @@ func (rs *RecSplit) Build() error {
 			return fmt.Errorf("writing start seed: %w", err)
 		}
 	}
-	if rs.enums {
-		if err := rs.indexW.WriteByte(1); err != nil {
-			return fmt.Errorf("writing enums = true: %w", err)
+	if version := rs.version(); version == IndexVersion0 {
+		if err := rs.indexW.WriteByte(rs.features()); err != nil {
+			return fmt.Errorf("writing features: %w", err)
 		}
 	} else {
-		if err := rs.indexW.WriteByte(0); err != nil {
-			return fmt.Errorf("writing enums = true: %w", err)
+		if err := rs.indexW.WriteByte(rs.features() | featureVersioned); err != nil {
+			return fmt.Errorf("writing features: %w", err)
+		}
+		if err := rs.indexW.WriteByte(version); err != nil {
+			return fmt.Errorf("writing version: %w", err)
 		}
 	}
 	if rs.enums {
@@ -632,13 +640,29 @@ func (rs *RecSplit) Build() error {
 			return fmt.Errorf("writing elias fano for offsets: %w", err)
 		}
 	}
+	if rs.existence {
+		// Write out existence filter
+		if err := rs.existenceW.Flush(); err != nil {
+			return fmt.Errorf("writing existence filter: %w", err)
+		}
+		if _, err := rs.existenceF.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("writing existence filter: %w", err)
+		}
+		if _, err := io.Copy(rs.indexW, rs.existenceF); err != nil {
+			return fmt.Errorf("writing existence filter: %w", err)
+		}
+	}
 	// Write out the size of golomb rice params
 	binary.BigEndian.PutUint16(rs.numBuf[:], uint16(len(rs.golombRice)))
 	if _, err := rs.indexW.Write(rs.numBuf[:4]); err != nil {
 		return fmt.Errorf("writing golomb rice param size: %w", err)
 	}
 	// Write out golomb rice
-	if err := rs.gr.Write(rs.indexW); err != nil {
+	if rs.grSpill != nil {
+		if err := rs.grSpill.write(rs.gr, rs.indexW); err != nil {
+			return fmt.Errorf("writing golomb rice: %w", err)
+		}
+	} else if err := rs.gr.Write(rs.indexW); err != nil {
 		return fmt.Errorf("writing golomb rice: %w", err)
 	}
 	// Write out elias fano
@@ -655,9 +679,37 @@ func (rs *RecSplit) Build() error {
 	return nil
 }
 
+// features - flags of index file, in the byte which was used for enums only
+func (rs *RecSplit) features() byte {
+	var features byte
+	if rs.enums {
+		features |= featureEnums
+	}
+	if rs.hash128 {
+		features |= featureHash128
+	}
+	if rs.existence {
+		features |= featureExistence
+	}
+	return features
+}
+
+// version - oldest format version which can hold the features of index, so that
+// indices without new features stay readable by readers of version 0
+func (rs *RecSplit) version() uint8 {
+	if rs.hash128 || rs.existence {
+		return IndexVersion1
+	}
+	return IndexVersion0
+}
+
 // Stats returns the size of golomb rice encoding and ellias fano encoding
 func (rs RecSplit) Stats() (int, int) {
-	return len(rs.gr.Data()), len(rs.ef.Data())
+	grSize := len(rs.gr.Data())
+	if rs.grSpill != nil {
+		grSize += int(rs.grSpill.words)
+	}
+	return grSize, len(rs.ef.Data())
 }
 
 // Collision returns true if there was a collision detected during mapping of keys
@@ -17,8 +17,13 @@
 package recsplit
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -180,3 +185,413 @@ func TestTwoLayerIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestRecSplitWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	build := func(workers int) []byte {
+		indexFile := filepath.Join(tmpDir, fmt.Sprintf("index%d", workers))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   10000,
+			BucketSize: 100,
+			Salt:       1,
+			TmpDir:     tmpDir,
+			IndexFile:  indexFile,
+			LeafSize:   8,
+			Enums:      true,
+			Workers:    workers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		for i := 0; i < 10000; i++ {
+			if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.Build(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(indexFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	single := build(1)
+	for _, workers := range []int{2, 4} {
+		if parallel := build(workers); !bytes.Equal(single, parallel) {
+			t.Errorf("index built by %d workers differs from single-threaded", workers)
+		}
+	}
+	idx := MustOpen(filepath.Join(tmpDir, "index4"))
+	defer idx.Close()
+	reader := NewIndexReader(idx)
+	for i := 0; i < 10000; i++ {
+		offset := idx.OrdinalLookup(reader.Lookup([]byte(fmt.Sprintf("key %d", i))))
+		if offset != uint64(i*17) {
+			t.Errorf("expected offset: %d, looked up: %d", i*17, offset)
+		}
+	}
+}
+
+func TestRecSplitWorkersDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+	rs, err := NewRecSplit(RecSplitArgs{
+		KeyCount:   2,
+		BucketSize: 10,
+		Salt:       0,
+		TmpDir:     tmpDir,
+		IndexFile:  filepath.Join(tmpDir, "index"),
+		LeafSize:   8,
+		Workers:    4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if err := rs.AddKey([]byte("first_key"), 0); err != nil {
+		t.Error(err)
+	}
+	if err := rs.AddKey([]byte("first_key"), 0); err != nil {
+		t.Error(err)
+	}
+	if err := rs.Build(); err == nil {
+		t.Errorf("test is expected to fail, duplicate key")
+	}
+	if !rs.Collision() {
+		t.Errorf("collision is expected")
+	}
+}
+
+func TestRecSplitCheckpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	args := RecSplitArgs{
+		KeyCount:   1000,
+		BucketSize: 100,
+		Salt:       1,
+		TmpDir:     tmpDir,
+		LeafSize:   8,
+		Enums:      true,
+	}
+	build := func(rs *RecSplit, from int) []byte {
+		defer rs.Close()
+		for i := from; i < args.KeyCount; i++ {
+			if err := rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.Build(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(rs.indexFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	args.IndexFile = filepath.Join(tmpDir, "index")
+	rs, err := NewRecSplit(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := build(rs, 0)
+
+	args.IndexFile = filepath.Join(tmpDir, "index_resumed")
+	checkpointFile := filepath.Join(tmpDir, "checkpoint")
+	interrupted, err := NewRecSplit(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 600; i++ {
+		if err = interrupted.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 499 {
+			if err = interrupted.Checkpoint(checkpointFile); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// interrupted is not closed - as after crash, keys after checkpoint are lost
+	args.Salt = 0
+	resumed, err := ResumeRecSplit(args, checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.KeysAdded() != 500 {
+		t.Fatalf("expected keys added: 500, got: %d", resumed.KeysAdded())
+	}
+	if !bytes.Equal(expected, build(resumed, int(resumed.KeysAdded()))) {
+		t.Errorf("resumed index differs")
+	}
+
+	args.Enums = false
+	if _, err = ResumeRecSplit(args, checkpointFile); err == nil {
+		t.Errorf("test is expected to fail, checkpoint has enums")
+	}
+}
+
+func TestRecSplitHash128(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, workers := range []int{1, 4} {
+		indexFile := filepath.Join(tmpDir, fmt.Sprintf("index%d", workers))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   1000,
+			BucketSize: 100,
+			Salt:       1,
+			TmpDir:     tmpDir,
+			IndexFile:  indexFile,
+			LeafSize:   8,
+			Hash128:    true,
+			Workers:    workers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1000; i++ {
+			if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.Build(); err != nil {
+			t.Fatal(err)
+		}
+		rs.Close()
+		idx := MustOpen(indexFile)
+		reader := NewIndexReader(idx)
+		for i := 0; i < 1000; i++ {
+			offset := reader.Lookup([]byte(fmt.Sprintf("key %d", i)))
+			if offset != uint64(i*17) {
+				t.Errorf("expected offset: %d, looked up: %d", i*17, offset)
+			}
+		}
+		idx.Close()
+	}
+
+	// Keys with the same 64-bit fingerprint are separated by the second half of 128-bit fingerprint
+	rs, err := NewRecSplit(RecSplitArgs{KeyCount: 1, BucketSize: 10, TmpDir: tmpDir, LeafSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	rs.bytesPerRec = 1
+	bb := rs.newBucketBuilder(nil)
+	b := &bucket{keys: []uint64{7, 7, 7}, hashes: []uint64{1, 2, 3}, offsets: []uint64{10, 20, 30}}
+	if err := bb.build(b); err != nil {
+		t.Fatal(err)
+	}
+	b = &bucket{keys: []uint64{7, 7, 7}, offsets: []uint64{10, 20, 30}}
+	if err := bb.build(b); !errors.Is(err, ErrCollision) {
+		t.Errorf("expected collision of 64-bit fingerprints, got %v", err)
+	}
+}
+
+func TestRecSplitFileBackedBuffers(t *testing.T) {
+	defer func(words int) { grSpillWords = words }(grSpillWords)
+	grSpillWords = 16
+	tmpDir := t.TempDir()
+	build := func(fileBacked bool, workers int) []byte {
+		indexFile := filepath.Join(tmpDir, fmt.Sprintf("index_%t_%d", fileBacked, workers))
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:          10000,
+			BucketSize:        100,
+			Salt:              1,
+			TmpDir:            tmpDir,
+			IndexFile:         indexFile,
+			LeafSize:          8,
+			Enums:             true,
+			FileBackedBuffers: fileBacked,
+			Workers:           workers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+		for i := 0; i < 10000; i++ {
+			if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.Build(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(indexFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	expected := build(false, 1)
+	if !bytes.Equal(expected, build(true, 1)) {
+		t.Errorf("index built with file backed buffers differs")
+	}
+	if !bytes.Equal(expected, build(true, 4)) {
+		t.Errorf("index built with file backed buffers by 4 workers differs")
+	}
+	files, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "erigon-recsplit-") {
+			t.Errorf("temp file is not removed: %s", f.Name())
+		}
+	}
+}
+
+func TestRecSplitBuildProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	newRecSplit := func(indexFile string) *RecSplit {
+		rs, err := NewRecSplit(RecSplitArgs{
+			KeyCount:   200000,
+			BucketSize: 100,
+			Salt:       1,
+			TmpDir:     tmpDir,
+			IndexFile:  indexFile,
+			LeafSize:   8,
+			Enums:      true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200000; i++ {
+			if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rs
+	}
+	rs := newRecSplit(filepath.Join(tmpDir, "index"))
+	defer rs.Close()
+	var reports []BuildProgress
+	rs.SetProgress(func(p BuildProgress) { reports = append(reports, p) })
+	if err := rs.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) < 3 {
+		t.Fatalf("expected at least 3 progress reports, got %d", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last.KeysProcessed != 200000 || last.Keys != 200000 || last.Bucket != last.Buckets-1 {
+		t.Errorf("unexpected last progress report %+v", last)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].KeysProcessed <= reports[i-1].KeysProcessed || reports[i].Bucket <= reports[i-1].Bucket {
+			t.Errorf("progress is not monotone: %+v after %+v", reports[i], reports[i-1])
+		}
+	}
+
+	cancelled := newRecSplit(filepath.Join(tmpDir, "index_cancelled"))
+	defer cancelled.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled.SetProgress(func(p BuildProgress) { cancel() })
+	if err := cancelled.BuildContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, name := range []string{"fast-build", "small-index"} {
+		o, err := Preset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = o.Validate(); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+	if _, err := Preset("tiny"); err == nil {
+		t.Errorf("expected error for unknown preset")
+	}
+	for _, o := range []Options{
+		{BucketSize: 0, LeafSize: 8},
+		{BucketSize: MaxBucketSize + 1, LeafSize: 8},
+		{BucketSize: 100, LeafSize: 0},
+		{BucketSize: 100, LeafSize: MaxLeafSize + 1},
+		{BucketSize: 100, LeafSize: 8, SaltStrategy: SaltFixed},
+		{BucketSize: 100, LeafSize: 8, SaltStrategy: SaltRandom, Salt: 1},
+		{BucketSize: 100, LeafSize: 8, SaltStrategy: SaltStrategy(5)},
+	} {
+		if err := o.Validate(); err == nil {
+			t.Errorf("expected error for %+v", o)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	o := FastBuild
+	o.SaltStrategy, o.Salt = SaltFixed, 7
+	args := RecSplitArgs{KeyCount: 1000, TmpDir: tmpDir, IndexFile: filepath.Join(tmpDir, "index")}
+	if err := o.Apply(&args); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := NewRecSplit(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	for i := 0; i < 1000; i++ {
+		if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), uint64(i*17)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = rs.Build(); err != nil {
+		t.Fatal(err)
+	}
+	idx := MustOpen(args.IndexFile)
+	defer idx.Close()
+	if idx.salt != 7 || idx.leafSize != 5 || idx.bucketSize != 100 {
+		t.Errorf("unexpected parameters of index: salt %d, leaf size %d, bucket size %d", idx.salt, idx.leafSize, idx.bucketSize)
+	}
+}
+
+func TestRecSplitLargeOffsets(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, tc := range []struct {
+		base, step uint64
+		width      int
+	}{
+		{base: 5 << 30, step: 1 << 20, width: 5}, // Data file above 4GiB
+		{base: 1 << 62, step: 1 << 40, width: 8},
+	} {
+		for _, enums := range []bool{false, true} {
+			indexFile := filepath.Join(tmpDir, fmt.Sprintf("index_%d_%t", tc.width, enums))
+			rs, err := NewRecSplit(RecSplitArgs{
+				KeyCount:   10000,
+				BucketSize: 100,
+				Salt:       1,
+				TmpDir:     tmpDir,
+				IndexFile:  indexFile,
+				LeafSize:   8,
+				Enums:      enums,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := uint64(0); i < 10000; i++ {
+				if err = rs.AddKey([]byte(fmt.Sprintf("key %d", i)), tc.base+i*tc.step); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = rs.Build(); err != nil {
+				t.Fatal(err)
+			}
+			rs.Close()
+			idx := MustOpen(indexFile)
+			if idx.RecordWidth() != tc.width {
+				t.Errorf("expected record width %d, got %d", tc.width, idx.RecordWidth())
+			}
+			reader := NewIndexReader(idx)
+			for i := uint64(0); i < 10000; i++ {
+				offset := reader.Lookup([]byte(fmt.Sprintf("key %d", i)))
+				if enums {
+					offset = idx.OrdinalLookup(offset)
+				}
+				if offset != tc.base+i*tc.step {
+					t.Errorf("expected offset: %d, looked up: %d", tc.base+i*tc.step, offset)
+				}
+			}
+			idx.Close()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package recsplit
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/compress"
+)
+
+// VerifyIndex checks index against the data file it was built for. Words of the data file are expected to be pairs of
+// key and value, and every key to be indexed with the offset of its word, as indices of aggregator are built.
+// For every key, lookup must return its offset, and for indices with enums, lookup must return ordinal number of
+// the key and ordinal lookup must return the offset back. Returns error describing the first mismatch
+func VerifyIndex(idx *Index, d *compress.Decompressor) error {
+	if d.Count()%2 != 0 {
+		return fmt.Errorf("verify %s: odd number of words in %s: %d", idx.indexFile, d.FilePath(), d.Count())
+	}
+	if keyCount := uint64(d.Count() / 2); keyCount != idx.KeyCount() {
+		return fmt.Errorf("verify %s: %d keys in index, %d in %s", idx.indexFile, idx.KeyCount(), keyCount, d.FilePath())
+	}
+	reader := NewIndexReader(idx)
+	g := d.MakeGetter()
+	var key []byte
+	var offset, ordinal uint64
+	for g.HasNext() {
+		key, _ = g.Next(key[:0])
+		found := reader.Lookup(key)
+		if idx.enums {
+			if found != ordinal {
+				return fmt.Errorf("verify %s: key [%x] at offset %d: expected ordinal %d, looked up %d", idx.indexFile, key, offset, ordinal, found)
+			}
+			if found = idx.OrdinalLookup(ordinal); found != offset {
+				return fmt.Errorf("verify %s: ordinal %d: expected offset %d, looked up %d", idx.indexFile, ordinal, offset, found)
+			}
+		} else if found != offset {
+			return fmt.Errorf("verify %s: key [%x]: expected offset %d, looked up %d", idx.indexFile, key, offset, found)
+		}
+		ordinal++
+		// Skip value
+		offset = g.Skip()
+	}
+	return nil
+}
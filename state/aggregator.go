@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
@@ -96,6 +97,10 @@ func NewAggregator(
 	if a.tracesTo, err = NewInvertedIndex(dir, aggregationStep, "tracesto", kv.TracesToKeys, kv.TracesToIdx); err != nil {
 		return nil, err
 	}
+	// Files of all domains and inverted indices are built concurrently, their collectors share one budget
+	etlBudget := etl.NewMemoryBudget(2 * etl.BufferOptimalSize)
+	a.accounts.etlBudget, a.storage.etlBudget, a.code.etlBudget = etlBudget, etlBudget, etlBudget
+	a.logAddrs.etlBudget, a.logTopics.etlBudget, a.tracesFrom.etlBudget, a.tracesTo.etlBudget = etlBudget, etlBudget, etlBudget, etlBudget
 	closeAgg = false
 	return a, nil
 }
@@ -0,0 +1,407 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// Virtual tables of ComposedTx: latest values of domains (key -> value)
+const (
+	AccountsDomain = "AccountsDomain"
+	StorageDomain  = "StorageDomain"
+	CodeDomain     = "CodeDomain"
+)
+
+// ComposedTx - read-only transaction which layers frozen files of domains under db transaction.
+// Domain's data is visible as regular (virtual) table: Get/Cursor read db first and fall through to files.
+// Requests to all other tables are served by underlying tx.
+//
+// Files set is fixed at moment of DomainContext creation - later merges/pruning don't affect ComposedTx.
+// Not thread-safe (same as kv.Tx).
+type ComposedTx struct {
+	kv.Tx
+	domains map[string]*DomainContext
+}
+
+var _ kv.Tx = (*ComposedTx)(nil)
+var _ kv.Cursor = (*domainCursor)(nil)
+
+func NewComposedTx(tx kv.Tx, domains map[string]*DomainContext) *ComposedTx {
+	return &ComposedTx{Tx: tx, domains: domains}
+}
+
+// ComposedTx - exposes accounts/storage/code domains as AccountsDomain/StorageDomain/CodeDomain tables of tx
+func (ac *AggregatorContext) ComposedTx(tx kv.Tx) *ComposedTx {
+	return NewComposedTx(tx, map[string]*DomainContext{
+		AccountsDomain: ac.accounts,
+		StorageDomain:  ac.storage,
+		CodeDomain:     ac.code,
+	})
+}
+
+// latest - returns value of latest step of key from db or, if db doesn't have it, from newest file.
+// deleted keys have empty value
+func (dc *DomainContext) latest(key []byte, roTx kv.Tx) ([]byte, bool, error) {
+	keysCursor, err := roTx.CursorDupSort(dc.d.keysTable)
+	if err != nil {
+		return nil, false, err
+	}
+	defer keysCursor.Close()
+	_, invStep, err := keysCursor.SeekExact(key) // first duplicate is latest step, because steps are inverted
+	if err != nil {
+		return nil, false, err
+	}
+	if invStep == nil {
+		v, found := dc.readFromFiles(key)
+		return v, found, nil
+	}
+	keySuffix := make([]byte, len(key)+8)
+	copy(keySuffix, key)
+	copy(keySuffix[len(key):], invStep)
+	v, err := roTx.GetOne(dc.d.valsTable, keySuffix)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+func (dc *DomainContext) readFromFiles(filekey []byte) ([]byte, bool) {
+	var val []byte
+	var found bool
+	dc.files[Values].Descend(func(i btree.Item) bool {
+		item := i.(*filesItem)
+		if item.index.Empty() {
+			return true
+		}
+		offset := item.indexReader.Lookup(filekey)
+		g := item.getter
+		g.Reset(offset)
+		if g.HasNext() {
+			if keyMatch, _ := g.Match(filekey); keyMatch {
+				val, _ = g.Next(nil)
+				found = true
+				return false
+			}
+		}
+		return true
+	})
+	return val, found
+}
+
+func (tx *ComposedTx) GetOne(table string, key []byte) ([]byte, error) {
+	dc, ok := tx.domains[table]
+	if !ok {
+		return tx.Tx.GetOne(table, key)
+	}
+	v, _, err := dc.latest(key, tx.Tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return v, nil
+}
+
+func (tx *ComposedTx) GetMany(table string, keys [][]byte) ([][]byte, error) {
+	if _, ok := tx.domains[table]; !ok {
+		return kv.GetMany(tx.Tx, table, keys)
+	}
+	vals := make([][]byte, len(keys))
+	for i, k := range keys {
+		v, err := tx.GetOne(table, k)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func (tx *ComposedTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	if _, ok := tx.domains[table]; !ok {
+		return kv.Range(tx.Tx, table, fromPrefix, toPrefix)
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, err
+	}
+	return iter.CursorKV(c, fromPrefix, toPrefix)
+}
+
+func (tx *ComposedTx) Has(table string, key []byte) (bool, error) {
+	dc, ok := tx.domains[table]
+	if !ok {
+		return tx.Tx.Has(table, key)
+	}
+	v, _, err := dc.latest(key, tx.Tx)
+	if err != nil {
+		return false, err
+	}
+	return len(v) > 0, nil
+}
+
+func (tx *ComposedTx) Cursor(table string) (kv.Cursor, error) {
+	dc, ok := tx.domains[table]
+	if !ok {
+		return tx.Tx.Cursor(table)
+	}
+	keys, err := tx.Tx.CursorDupSort(dc.d.keysTable)
+	if err != nil {
+		return nil, err
+	}
+	return &domainCursor{dc: dc, tx: tx.Tx, keys: keys}, nil
+}
+
+func (tx *ComposedTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	if _, ok := tx.domains[table]; ok {
+		return nil, fmt.Errorf("%w: CursorDupSort of domain table: %s", kv.ErrNotSupported, table)
+	}
+	return tx.Tx.CursorDupSort(table)
+}
+
+func (tx *ComposedTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	if _, ok := tx.domains[table]; !ok {
+		return tx.Tx.ForEach(table, fromPrefix, walker)
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *ComposedTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	if _, ok := tx.domains[table]; !ok {
+		return tx.Tx.ForPrefix(table, prefix, walker)
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *ComposedTx) ForAmount(table string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if _, ok := tx.domains[table]; !ok {
+		return tx.Tx.ForAmount(table, fromPrefix, amount, walker)
+	}
+	if amount == 0 {
+		return nil
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+// domainCursor - forward-only cursor over latest values of domain: merges db and files (newer source wins).
+// Files have no ordered index, so Seek does linear scan of files - use GetOne for point lookups.
+type domainCursor struct {
+	dc   *DomainContext
+	tx   kv.Tx
+	keys kv.CursorDupSort
+	h    CursorHeap
+	k, v []byte
+}
+
+func (c *domainCursor) dbVal(k, invStep []byte) ([]byte, error) {
+	keySuffix := make([]byte, len(k)+8)
+	copy(keySuffix, k)
+	copy(keySuffix[len(k):], invStep)
+	v, err := c.tx.GetOne(c.dc.d.valsTable, keySuffix)
+	if err != nil {
+		return nil, err
+	}
+	return common.Copy(v), nil
+}
+
+func (c *domainCursor) init(from []byte) error {
+	c.h = c.h[:0]
+	heap.Init(&c.h)
+	k, invStep, err := c.keys.Seek(from)
+	if err != nil {
+		return err
+	}
+	if k != nil {
+		v, err := c.dbVal(k, invStep)
+		if err != nil {
+			return err
+		}
+		// db has priority over any file - same as in GetOne
+		heap.Push(&c.h, &CursorItem{t: DB_CURSOR, key: common.Copy(k), val: v, c: c.keys, endTxNum: math.MaxUint64})
+	}
+	c.dc.files[Values].Ascend(func(i btree.Item) bool {
+		item := i.(*filesItem)
+		g := item.decompressor.MakeGetter()
+		for g.HasNext() {
+			key, _ := g.Next(nil)
+			if bytes.Compare(key, from) >= 0 {
+				val, _ := g.Next(nil)
+				heap.Push(&c.h, &CursorItem{t: FILE_CURSOR, key: key, val: val, dg: g, endTxNum: item.endTxNum})
+				return true
+			}
+			g.Skip()
+		}
+		return true
+	})
+	return nil
+}
+
+// advance - moves top of heap to next key of its source
+func (c *domainCursor) advance() error {
+	ci := c.h[0]
+	switch ci.t {
+	case FILE_CURSOR:
+		if ci.dg.HasNext() {
+			ci.key, _ = ci.dg.Next(ci.key[:0])
+			ci.val, _ = ci.dg.Next(ci.val[:0])
+			heap.Fix(&c.h, 0)
+			return nil
+		}
+	case DB_CURSOR:
+		k, invStep, err := ci.c.NextNoDup()
+		if err != nil {
+			return err
+		}
+		if k != nil {
+			ci.key = common.Copy(k)
+			if ci.val, err = c.dbVal(k, invStep); err != nil {
+				return err
+			}
+			heap.Fix(&c.h, 0)
+			return nil
+		}
+	}
+	heap.Pop(&c.h)
+	return nil
+}
+
+// next - takes smallest key from heap (newest value wins) and skips deleted keys
+func (c *domainCursor) next() ([]byte, []byte, error) {
+	for c.h.Len() > 0 {
+		k, v := common.Copy(c.h[0].key), common.Copy(c.h[0].val)
+		for c.h.Len() > 0 && bytes.Equal(c.h[0].key, k) {
+			if err := c.advance(); err != nil {
+				return []byte{}, nil, err
+			}
+		}
+		if len(v) > 0 {
+			c.k, c.v = k, v
+			return k, v, nil
+		}
+	}
+	c.k, c.v = nil, nil
+	return nil, nil, nil
+}
+
+func (c *domainCursor) First() ([]byte, []byte, error) {
+	if err := c.init(nil); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.next()
+}
+
+func (c *domainCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if err := c.init(seek); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.next()
+}
+
+func (c *domainCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.Seek(key)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !bytes.Equal(k, key) {
+		return nil, nil, nil
+	}
+	return k, v, nil
+}
+
+func (c *domainCursor) Next() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	return c.next()
+}
+
+func (c *domainCursor) Current() ([]byte, []byte, error) { return c.k, c.v, nil }
+
+func (c *domainCursor) Prev() ([]byte, []byte, error) {
+	return []byte{}, nil, fmt.Errorf("%w: Prev of domain cursor", kv.ErrNotSupported)
+}
+
+func (c *domainCursor) Last() ([]byte, []byte, error) {
+	return []byte{}, nil, fmt.Errorf("%w: Last of domain cursor", kv.ErrNotSupported)
+}
+
+func (c *domainCursor) Count() (uint64, error) {
+	return 0, fmt.Errorf("%w: Count of domain cursor", kv.ErrNotSupported)
+}
+
+func (c *domainCursor) Close() {
+	if c.keys != nil {
+		c.keys.Close()
+		c.keys = nil
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/google/btree"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
@@ -127,6 +128,7 @@ type Domain struct {
 	prefixLen        int                         // Number of bytes in the keys that can be used for prefix iteration
 	compressVals     bool
 	stats            DomainStats
+	etlBudget        *etl.MemoryBudget // RAM limit of collectors of index builds, shared with other domains and inverted indices
 }
 
 func NewDomain(
@@ -567,31 +569,17 @@ func (c Collation) Close() {
 // and returns compressors, elias fano, and bitmaps
 // [txFrom; txTo)
 func (d *Domain) collate(step uint64, txFrom, txTo uint64, roTx kv.Tx) (Collation, error) {
-	var valuesComp, historyComp *compress.Compressor
-	var err error
-	closeComp := true
-	defer func() {
-		if closeComp {
-			if valuesComp != nil {
-				valuesComp.Close()
-			}
-			if historyComp != nil {
-				historyComp.Close()
-			}
-		}
-	}()
-	valuesPath := filepath.Join(d.dir, fmt.Sprintf("%s-values.%d-%d.dat", d.filenameBase, step, step+1))
-	if valuesComp, err = compress.NewCompressor(context.Background(), "collate values", valuesPath, d.dir, compress.MinPatternScore, 1, log.LvlDebug); err != nil {
-		return Collation{}, fmt.Errorf("create %s values compressor: %w", d.filenameBase, err)
+	sink, err := d.NewCollationSink(step)
+	if err != nil {
+		return Collation{}, err
 	}
+	defer sink.Close()
 	keysCursor, err := roTx.CursorDupSort(d.keysTable)
 	if err != nil {
 		return Collation{}, fmt.Errorf("create %s keys cursor: %w", d.filenameBase, err)
 	}
 	defer keysCursor.Close()
-	var prefix []byte // Track prefix to insert it before entries
 	var k, v []byte
-	valuesCount := 0
 	for k, _, err = keysCursor.First(); err == nil && k != nil; k, _, err = keysCursor.NextNoDup() {
 		if v, err = keysCursor.LastDup(); err != nil {
 			return Collation{}, fmt.Errorf("find last %s key for aggregation step k=[%x]: %w", d.filenameBase, k, err)
@@ -605,52 +593,27 @@ func (d *Domain) collate(step uint64, txFrom, txTo uint64, roTx kv.Tx) (Collatio
 			if err != nil {
 				return Collation{}, fmt.Errorf("find last %s value for aggregation step k=[%x]: %w", d.filenameBase, k, err)
 			}
-			if d.prefixLen > 0 && (prefix == nil || !bytes.HasPrefix(k, prefix)) {
-				prefix = append(prefix[:0], k[:d.prefixLen]...)
-				if err = valuesComp.AddUncompressedWord(prefix); err != nil {
-					return Collation{}, fmt.Errorf("add %s values prefix [%x]: %w", d.filenameBase, prefix, err)
-				}
-				if err = valuesComp.AddUncompressedWord(nil); err != nil {
-					return Collation{}, fmt.Errorf("add %s values prefix val [%x]: %w", d.filenameBase, prefix, err)
-				}
-				valuesCount++
-			}
-			if err = valuesComp.AddUncompressedWord(k); err != nil {
-				return Collation{}, fmt.Errorf("add %s values key [%x]: %w", d.filenameBase, k, err)
-			}
-			valuesCount++ // Only counting keys, not values
-			if err = valuesComp.AddUncompressedWord(v); err != nil {
-				return Collation{}, fmt.Errorf("add %s values val [%x]=>[%x]: %w", d.filenameBase, k, v, err)
+			if err = sink.AddValue(k, v); err != nil {
+				return Collation{}, err
 			}
 		}
 	}
 	if err != nil {
 		return Collation{}, fmt.Errorf("iterate over %s keys cursor: %w", d.filenameBase, err)
 	}
-	historyPath := filepath.Join(d.dir, fmt.Sprintf("%s-history.%d-%d.dat", d.filenameBase, step, step+1))
-	if historyComp, err = compress.NewCompressor(context.Background(), "collate history", historyPath, d.dir, compress.MinPatternScore, 1, log.LvlDebug); err != nil {
-		return Collation{}, fmt.Errorf("create %s history compressor: %w", d.filenameBase, err)
-	}
 	historyKeysCursor, err := roTx.CursorDupSort(d.historyKeysTable)
 	if err != nil {
 		return Collation{}, fmt.Errorf("create %s history cursor: %w", d.filenameBase, err)
 	}
 	defer historyKeysCursor.Close()
-	indexBitmaps := map[string]*roaring64.Bitmap{}
-	historyCount := 0
 	var txKey [8]byte
 	binary.BigEndian.PutUint64(txKey[:], txFrom)
 	var val []byte
-	var historyKey []byte
 	for k, v, err = historyKeysCursor.Seek(txKey[:]); err == nil && k != nil; k, v, err = historyKeysCursor.Next() {
 		txNum := binary.BigEndian.Uint64(k)
 		if txNum >= txTo {
 			break
 		}
-		historyKey = append(append(historyKey[:0], k...), v[:len(v)-8]...)
-		if err = historyComp.AddUncompressedWord(historyKey); err != nil {
-			return Collation{}, fmt.Errorf("add %s history key [%x]: %w", d.filenameBase, k, err)
-		}
 		valNum := binary.BigEndian.Uint64(v[len(v)-8:])
 		if valNum == 0 {
 			val = nil
@@ -659,31 +622,14 @@ func (d *Domain) collate(step uint64, txFrom, txTo uint64, roTx kv.Tx) (Collatio
 				return Collation{}, fmt.Errorf("get %s history val [%x]=>%d: %w", d.filenameBase, k, valNum, err)
 			}
 		}
-		if err = historyComp.AddUncompressedWord(val); err != nil {
-			return Collation{}, fmt.Errorf("add %s history val [%x]=>[%x]: %w", d.filenameBase, k, val, err)
-		}
-		historyCount++
-		var bitmap *roaring64.Bitmap
-		var ok bool
-		if bitmap, ok = indexBitmaps[string(v[:len(v)-8])]; !ok {
-			bitmap = roaring64.New()
-			indexBitmaps[string(v[:len(v)-8])] = bitmap
+		if err = sink.AddHistory(txNum, v[:len(v)-8], val); err != nil {
+			return Collation{}, err
 		}
-		bitmap.Add(txNum)
 	}
 	if err != nil {
 		return Collation{}, fmt.Errorf("iterate over %s history cursor: %w", d.filenameBase, err)
 	}
-	closeComp = false
-	return Collation{
-		valuesPath:   valuesPath,
-		valuesComp:   valuesComp,
-		valuesCount:  valuesCount,
-		historyPath:  historyPath,
-		historyComp:  historyComp,
-		historyCount: historyCount,
-		indexBitmaps: indexBitmaps,
-	}, nil
+	return sink.collation(), nil
 }
 
 type StaticFiles struct {
@@ -766,7 +712,7 @@ func (d *Domain) buildFiles(step uint64, collation Collation) (StaticFiles, erro
 	if valuesDecomp, err = compress.NewDecompressor(collation.valuesPath); err != nil {
 		return StaticFiles{}, fmt.Errorf("open %s values decompressor: %w", d.filenameBase, err)
 	}
-	if valuesIdx, err = buildIndex(valuesDecomp, valuesIdxPath, d.dir, collation.valuesCount, false /* values */); err != nil {
+	if valuesIdx, err = buildIndex(valuesDecomp, valuesIdxPath, d.dir, collation.valuesCount, false /* values */, d.etlBudget); err != nil {
 		return StaticFiles{}, fmt.Errorf("build %s values idx: %w", d.filenameBase, err)
 	}
 	historyIdxPath := filepath.Join(d.dir, fmt.Sprintf("%s-history.%d-%d.idx", d.filenameBase, step, step+1))
@@ -778,7 +724,7 @@ func (d *Domain) buildFiles(step uint64, collation Collation) (StaticFiles, erro
 	if historyDecomp, err = compress.NewDecompressor(collation.historyPath); err != nil {
 		return StaticFiles{}, fmt.Errorf("open %s history decompressor: %w", d.filenameBase, err)
 	}
-	if historyIdx, err = buildIndex(historyDecomp, historyIdxPath, d.dir, collation.historyCount, true /* values */); err != nil {
+	if historyIdx, err = buildIndex(historyDecomp, historyIdxPath, d.dir, collation.historyCount, true /* values */, d.etlBudget); err != nil {
 		return StaticFiles{}, fmt.Errorf("build %s history idx: %w", d.filenameBase, err)
 	}
 	// Build history ef
@@ -818,7 +764,7 @@ func (d *Domain) buildFiles(step uint64, collation Collation) (StaticFiles, erro
 		return StaticFiles{}, fmt.Errorf("open %s ef history decompressor: %w", d.filenameBase, err)
 	}
 	efHistoryIdxPath := filepath.Join(d.dir, fmt.Sprintf("%s-efhistory.%d-%d.idx", d.filenameBase, step, step+1))
-	if efHistoryIdx, err = buildIndex(efHistoryDecomp, efHistoryIdxPath, d.dir, len(keys), false /* values */); err != nil {
+	if efHistoryIdx, err = buildIndex(efHistoryDecomp, efHistoryIdxPath, d.dir, len(keys), false /* values */, d.etlBudget); err != nil {
 		return StaticFiles{}, fmt.Errorf("build %s ef history idx: %w", d.filenameBase, err)
 	}
 	closeComp = false
@@ -832,20 +778,14 @@ func (d *Domain) buildFiles(step uint64, collation Collation) (StaticFiles, erro
 	}, nil
 }
 
-func buildIndex(d *compress.Decompressor, idxPath, dir string, count int, values bool) (*recsplit.Index, error) {
+func buildIndex(d *compress.Decompressor, idxPath, dir string, count int, values bool, etlBudget *etl.MemoryBudget) (*recsplit.Index, error) {
 	var rs *recsplit.RecSplit
 	var err error
-	if rs, err = recsplit.NewRecSplit(recsplit.RecSplitArgs{
-		KeyCount:   count,
-		Enums:      false,
-		BucketSize: 2000,
-		LeafSize:   8,
-		TmpDir:     dir,
-		StartSeed: []uint64{0x106393c187cae21a, 0x6453cec3f7376937, 0x643e521ddbd2be98, 0x3740c6412f6572cb, 0x717d47562f1ce470, 0x4cd6eb4c63befb7c, 0x9bfd8c5e18c8da73,
-			0x082f20e10092a9a3, 0x2ada2ce68d21defc, 0xe33cb4f3e7c6466b, 0x3980be458c509c59, 0xc466fd9584828e8c, 0x45f0aabe1a61ede6, 0xf6e7b8b33ad9b98d,
-			0x4ef95e25f4b4983d, 0x81175195173b92d3, 0x4e50927d8dd15978, 0x1ea2099d1fafae7f, 0x425c8a06fbaaa815, 0xcd4216006c74052a},
-		IndexFile: idxPath,
-	}); err != nil {
+	args := recsplit.RecSplitArgs{KeyCount: count, TmpDir: dir, IndexFile: idxPath, EtlBudget: etlBudget}
+	if err = recsplit.SmallIndex.Apply(&args); err != nil {
+		return nil, fmt.Errorf("create recsplit: %w", err)
+	}
+	if rs, err = recsplit.NewRecSplit(args); err != nil {
 		return nil, fmt.Errorf("create recsplit: %w", err)
 	}
 	defer rs.Close()
@@ -23,7 +23,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
@@ -585,3 +588,210 @@ func TestDelete(t *testing.T) {
 		require.Nil(t, val, label)
 	}
 }
+
+func TestComposedTx(t *testing.T) {
+	_, db, d := testDbAndDomain(t, 0 /* prefixLen */)
+	defer db.Close()
+	defer d.Close()
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	d.SetTx(tx)
+
+	d.SetTxNum(2)
+	require.NoError(t, d.Put([]byte("key1"), []byte("value1.1")))
+	require.NoError(t, d.Put([]byte("key2"), []byte("value2.1")))
+	require.NoError(t, d.Put([]byte("key4"), []byte("value4.1")))
+
+	// move step 0 to files
+	c, err := d.collate(0, 0, 16, tx)
+	require.NoError(t, err)
+	sf, err := d.buildFiles(0, c)
+	require.NoError(t, err)
+	d.integrateFiles(sf, 0, 16)
+	require.NoError(t, d.prune(0, 0, 16))
+
+	d.SetTxNum(17)
+	require.NoError(t, d.Put([]byte("key1"), []byte("value1.2")))
+	require.NoError(t, d.Put([]byte("key3"), []byte("value3.2")))
+	require.NoError(t, d.Delete([]byte("key2")))
+	require.NoError(t, tx.Put(d.settingsTable, []byte("plain"), []byte("v")))
+
+	d.SetTxNum(0) // reading doesn't depend on current txNum of domain
+	cTx := NewComposedTx(tx, map[string]*DomainContext{"Domain": d.MakeContext()})
+
+	v, err := cTx.GetOne("Domain", []byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, "value1.2", string(v))
+	v, err = cTx.GetOne("Domain", []byte("key4"))
+	require.NoError(t, err)
+	require.Equal(t, "value4.1", string(v))
+	has, err := cTx.Has("Domain", []byte("key2"))
+	require.NoError(t, err)
+	require.False(t, has)
+	v, err = cTx.GetOne(d.settingsTable, []byte("plain"))
+	require.NoError(t, err)
+	require.Equal(t, "v", string(v))
+
+	var kvs []string
+	require.NoError(t, cTx.ForEach("Domain", nil, func(k, v []byte) error {
+		kvs = append(kvs, string(k)+"="+string(v))
+		return nil
+	}))
+	require.Equal(t, []string{"key1=value1.2", "key3=value3.2", "key4=value4.1"}, kvs)
+
+	cur, err := cTx.Cursor("Domain")
+	require.NoError(t, err)
+	defer cur.Close()
+	k, v, err := cur.Seek([]byte("key2"))
+	require.NoError(t, err)
+	require.Equal(t, "key3", string(k))
+	require.Equal(t, "value3.2", string(v))
+	k, _, err = cur.Next()
+	require.NoError(t, err)
+	require.Equal(t, "key4", string(k))
+	k, _, err = cur.Next()
+	require.NoError(t, err)
+	require.Nil(t, k)
+
+	_, err = cTx.CursorDupSort("Domain")
+	require.ErrorIs(t, err, kv.ErrNotSupported)
+}
+
+func TestIterateBeforeTxNum(t *testing.T) {
+	_, db, d, txs := filledDomain(t)
+	defer db.Close()
+	defer d.Close()
+	collateAndMerge(t, db, d, txs)
+
+	roTx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer roTx.Rollback()
+	for _, txNum := range []uint64{0, 1, 7, 100, 500, 975, 990, txs} {
+		label := fmt.Sprintf("txNum=%d", txNum)
+		it, err := d.IterateBeforeTxNum(nil, txNum+1, roTx)
+		require.NoError(t, err, label)
+		keys, vals, err := iter.ToArrayKV(it)
+		require.NoError(t, err, label)
+		var expectKeys, expectVals [][]byte
+		for keyNum := uint64(1); keyNum <= uint64(31) && keyNum <= txNum; keyNum++ {
+			k, v := make([]byte, 8), make([]byte, 8)
+			binary.BigEndian.PutUint64(k, keyNum)
+			binary.BigEndian.PutUint64(v, txNum/keyNum)
+			expectKeys, expectVals = append(expectKeys, k), append(expectVals, v)
+		}
+		require.Equal(t, expectKeys, keys, label)
+		require.Equal(t, expectVals, vals, label)
+	}
+
+	// prefix
+	var prefix [7]byte
+	it, err := d.IterateBeforeTxNum(prefix[:], txs+1, roTx)
+	require.NoError(t, err)
+	keys, _, err := iter.ToArrayKV(it)
+	require.NoError(t, err)
+	require.Len(t, keys, 31)
+}
+
+func TestIterateBeforeTxNumDeleted(t *testing.T) {
+	_, db, d := testDbAndDomain(t, 0 /* prefixLen */)
+	defer db.Close()
+	defer d.Close()
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	d.SetTx(tx)
+	// key2 exists only in history: deleted in last step
+	d.SetTxNum(1)
+	require.NoError(t, d.Put([]byte("key1"), []byte("value1")))
+	require.NoError(t, d.Put([]byte("key2"), []byte("value2")))
+	for txNum := uint64(2); txNum < 100; txNum++ {
+		d.SetTxNum(txNum)
+		require.NoError(t, d.Put([]byte("key1"), []byte(fmt.Sprintf("value1.%d", txNum))))
+	}
+	d.SetTxNum(100)
+	require.NoError(t, d.Delete([]byte("key2")))
+	require.NoError(t, tx.Commit())
+	tx = nil
+	collateAndMerge(t, db, d, 100)
+
+	roTx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer roTx.Rollback()
+	for _, tc := range []struct {
+		txNum      uint64
+		keys, vals []string
+	}{
+		{txNum: 1},
+		{txNum: 2, keys: []string{"key1", "key2"}, vals: []string{"value1", "value2"}},
+		{txNum: 50, keys: []string{"key1", "key2"}, vals: []string{"value1.49", "value2"}},
+		{txNum: 101, keys: []string{"key1"}, vals: []string{"value1.99"}},
+	} {
+		it, err := d.IterateBeforeTxNum(nil, tc.txNum, roTx)
+		require.NoError(t, err)
+		var keys, vals []string
+		for it.HasNext() {
+			k, v, err := it.Next()
+			require.NoError(t, err)
+			keys, vals = append(keys, string(k)), append(vals, string(v))
+		}
+		require.Equal(t, tc.keys, keys, tc.txNum)
+		require.Equal(t, tc.vals, vals, tc.txNum)
+	}
+}
+
+func TestCollationSink(t *testing.T) {
+	path, db, d := testDbAndDomain(t, 0 /* prefixLen */)
+	defer db.Close()
+	defer d.Close()
+	// The same changes as in TestCollationBuild, collected in etl instead of kv tables
+	values := etl.NewCollector(t.Name(), path, etl.NewOldestEntryBuffer(etl.BufferOptimalSize))
+	defer values.Close()
+	require.NoError(t, values.Collect([]byte("key2"), []byte("value2.1")))
+	require.NoError(t, values.Collect([]byte("key1"), []byte("value1.2")))
+	history := etl.NewCollector(t.Name(), path, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer history.Close()
+	historyKey := func(txNum uint64, key string) []byte {
+		k := make([]byte, 8, 8+len(key))
+		binary.BigEndian.PutUint64(k, txNum)
+		return append(k, key...)
+	}
+	require.NoError(t, history.Collect(historyKey(6, "key1"), []byte("value1.1")))
+	require.NoError(t, history.Collect(historyKey(3, "key2"), nil))
+	require.NoError(t, history.Collect(historyKey(2, "key1"), nil))
+
+	sink, err := d.NewCollationSink(0)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, values.Load(nil, "", sink.LoadValue, etl.TransformArgs{}))
+	require.NoError(t, history.Load(nil, "", sink.LoadHistory, etl.TransformArgs{}))
+	require.NoError(t, sink.Finish())
+
+	for key, value := range map[string]string{"key1": "value1.2", "key2": "value2.1"} {
+		v, found := d.readFromFiles(Values, []byte(key))
+		require.True(t, found)
+		require.Equal(t, value, string(v))
+	}
+	var words []string
+	d.files[History].Ascend(func(i btree.Item) bool {
+		g := i.(*filesItem).decompressor.MakeGetter()
+		for g.HasNext() {
+			w, _ := g.Next(nil)
+			words = append(words, string(w))
+		}
+		return true
+	})
+	require.Equal(t, []string{"\x00\x00\x00\x00\x00\x00\x00\x02key1", "", "\x00\x00\x00\x00\x00\x00\x00\x03key2", "", "\x00\x00\x00\x00\x00\x00\x00\x06key1", "value1.1"}, words)
+	v, found := d.readFromFiles(EfHistory, []byte("key1"))
+	require.True(t, found)
+	ef, _ := eliasfano32.ReadEliasFano(v)
+	var txNums []uint64
+	for it := ef.Iterator(); it.HasNext(); {
+		txNums = append(txNums, it.Next())
+	}
+	require.Equal(t, []uint64{2, 6}, txNums)
+}
@@ -0,0 +1,168 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package state
+import (
+	"bytes"
+	"container/heap"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/iter"
+)
+
+// AsOfIter - stream (iter.KV) of key-value pairs of domain as they were before txNum, see Domain.IterateBeforeTxNum
+type AsOfIter struct {
+	d              *Domain
+	roTx           kv.Tx
+	txNum          uint64
+	prefix         []byte
+	h              CursorHeap
+	cursors        []kv.CursorDupSort
+	nextK, nextV   []byte
+	err            error
+	hasErr, closed bool
+}
+
+var _ iter.KV = (*AsOfIter)(nil)
+
+// IterateBeforeTxNum - keys with given prefix (any length) and their values before txNum: same as GetBeforeTxNum
+// of each key, for state dumps and snapshot generation at any block. Keys without value at txNum are skipped.
+// Keys of latest state (db and values files) are merged with keys changed in history (index table and
+// efhistory files) - because key existing at txNum may be deleted later.
+// Stream is valid until roTx ends or files of domain are merged, it is closed when finished - or by Close
+func (d *Domain) IterateBeforeTxNum(prefix []byte, txNum uint64, roTx kv.Tx) (*AsOfIter, error) {
+	it := &AsOfIter{d: d, roTx: roTx, txNum: txNum, prefix: prefix}
+	heap.Init(&it.h)
+	for _, table := range []string{d.keysTable, d.indexTable} {
+		c, err := roTx.CursorDupSort(table)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.cursors = append(it.cursors, c)
+		k, _, err := c.Seek(prefix)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		if k != nil && bytes.HasPrefix(k, prefix) {
+			heap.Push(&it.h, &CursorItem{t: DB_CURSOR, key: common.Copy(k), c: c})
+		}
+	}
+	for _, fType := range []FileType{Values, EfHistory} {
+		d.files[fType].Ascend(func(i btree.Item) bool {
+			item := i.(*filesItem)
+			// Dedicated getter: getter of item is used by point lookups
+			g := item.decompressor.MakeGetter()
+			for g.HasNext() {
+				key, _ := g.NextUncompressed()
+				g.Skip() // value, Skip works for compressed and uncompressed words
+				if bytes.Compare(key, prefix) < 0 {
+					continue
+				}
+				if bytes.HasPrefix(key, prefix) {
+					heap.Push(&it.h, &CursorItem{t: FILE_CURSOR, key: key, dg: g, endTxNum: item.endTxNum})
+				}
+				break
+			}
+			return true
+		})
+	}
+	it.advance()
+	return it, nil
+}
+
+// next - moves item to next key, false if there are no more keys with prefix
+func (it *AsOfIter) next(ci *CursorItem) (bool, error) {
+	switch ci.t {
+	case FILE_CURSOR:
+		if !ci.dg.HasNext() {
+			return false, nil
+		}
+		ci.key, _ = ci.dg.NextUncompressed()
+		ci.dg.Skip()
+	case DB_CURSOR:
+		k, _, err := ci.c.NextNoDup()
+		if err != nil || k == nil {
+			return false, err
+		}
+		ci.key = common.Copy(k)
+	}
+	return bytes.HasPrefix(ci.key, it.prefix), nil
+}
+
+func (it *AsOfIter) advance() {
+	for it.h.Len() > 0 {
+		key := common.Copy(it.h[0].key)
+		for it.h.Len() > 0 && bytes.Equal(it.h[0].key, key) {
+			ok, err := it.next(it.h[0])
+			if err != nil {
+				it.fail(err)
+				return
+			}
+			if ok {
+				heap.Fix(&it.h, 0)
+			} else {
+				heap.Pop(&it.h)
+			}
+		}
+		v, err := it.d.GetBeforeTxNum(key, it.txNum, it.roTx)
+		if err != nil {
+			it.fail(err)
+			return
+		}
+		if len(v) > 0 {
+			it.nextK, it.nextV = key, v
+			return
+		}
+	}
+	it.Close()
+}
+
+func (it *AsOfIter) fail(err error) {
+	it.err, it.hasErr = err, true
+	it.Close()
+}
+
+func (it *AsOfIter) HasNext() bool { return it.hasErr || it.nextK != nil }
+
+func (it *AsOfIter) Next() ([]byte, []byte, error) {
+	if it.hasErr {
+		it.hasErr = false
+		return nil, nil, it.err
+	}
+	k, v := it.nextK, it.nextV
+	if k == nil {
+		return nil, nil, nil
+	}
+	it.nextK, it.nextV = nil, nil
+	it.advance()
+	return k, v, nil
+}
+
+func (it *AsOfIter) Close() {
+	it.nextK, it.nextV = nil, nil
+	if it.closed {
+		return
+	}
+	it.closed = true
+	it.h = nil
+	for _, c := range it.cursors {
+		c.Close()
+	}
+}
@@ -18,7 +18,6 @@ package state
 
 import (
 	"bytes"
-	"context"
 	"encoding/binary"
 	"fmt"
 	"io/fs"
@@ -30,6 +29,7 @@ import (
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/google/btree"
 	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
 	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
@@ -46,6 +46,7 @@ type InvertedIndex struct {
 	tx              kv.RwTx
 	txNum           uint64
 	files           *btree.BTree
+	etlBudget       *etl.MemoryBudget // RAM limit of collectors of index builds, shared with domains and other inverted indices
 }
 
 func NewInvertedIndex(
@@ -370,67 +371,22 @@ func (sf InvertedFiles) Close() {
 }
 
 func (ii *InvertedIndex) buildFiles(step uint64, bitmaps map[string]*roaring64.Bitmap) (InvertedFiles, error) {
-	var decomp *compress.Decompressor
-	var index *recsplit.Index
-	var comp *compress.Compressor
-	var err error
-	closeComp := true
-	defer func() {
-		if closeComp {
-			if comp != nil {
-				comp.Close()
-			}
-			if decomp != nil {
-				decomp.Close()
-			}
-			if index != nil {
-				index.Close()
-			}
-		}
-	}()
-	txNumFrom := step * ii.aggregationStep
-	txNumTo := (step + 1) * ii.aggregationStep
-	datPath := filepath.Join(ii.dir, fmt.Sprintf("%s.%d-%d.dat", ii.filenameBase, txNumFrom/ii.aggregationStep, txNumTo/ii.aggregationStep))
-	comp, err = compress.NewCompressor(context.Background(), "ef", datPath, ii.dir, compress.MinPatternScore, 1, log.LvlDebug)
+	sink, err := ii.NewFilesSink(step)
 	if err != nil {
-		return InvertedFiles{}, fmt.Errorf("create %s compressor: %w", ii.filenameBase, err)
+		return InvertedFiles{}, err
 	}
-	var buf []byte
+	defer sink.Close()
 	keys := make([]string, 0, len(bitmaps))
 	for key := range bitmaps {
 		keys = append(keys, key)
 	}
 	slices.Sort(keys)
 	for _, key := range keys {
-		if err = comp.AddUncompressedWord([]byte(key)); err != nil {
-			return InvertedFiles{}, fmt.Errorf("add %s key [%x]: %w", ii.filenameBase, key, err)
+		if err = sink.addBitmap([]byte(key), bitmaps[key]); err != nil {
+			return InvertedFiles{}, err
 		}
-		bitmap := bitmaps[key]
-		ef := eliasfano32.NewEliasFano(bitmap.GetCardinality(), bitmap.Maximum())
-		it := bitmap.Iterator()
-		for it.HasNext() {
-			ef.AddOffset(it.Next())
-		}
-		ef.Build()
-		buf = ef.AppendBytes(buf[:0])
-		if err = comp.AddUncompressedWord(buf); err != nil {
-			return InvertedFiles{}, fmt.Errorf("add %s val: %w", ii.filenameBase, err)
-		}
-	}
-	if err = comp.Compress(); err != nil {
-		return InvertedFiles{}, fmt.Errorf("compress %s: %w", ii.filenameBase, err)
-	}
-	comp.Close()
-	comp = nil
-	if decomp, err = compress.NewDecompressor(datPath); err != nil {
-		return InvertedFiles{}, fmt.Errorf("open %s decompressor: %w", ii.filenameBase, err)
-	}
-	idxPath := filepath.Join(ii.dir, fmt.Sprintf("%s.%d-%d.idx", ii.filenameBase, txNumFrom/ii.aggregationStep, txNumTo/ii.aggregationStep))
-	if index, err = buildIndex(decomp, idxPath, ii.dir, len(keys), false /* values */); err != nil {
-		return InvertedFiles{}, fmt.Errorf("build %s idx: %w", ii.filenameBase, err)
 	}
-	closeComp = false
-	return InvertedFiles{decomp: decomp, index: index}, nil
+	return sink.build()
 }
 
 func (ii *InvertedIndex) integrateFiles(sf InvertedFiles, txNumFrom, txNumTo uint64) {
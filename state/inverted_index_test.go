@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/etl"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/ledgerwatch/erigon-lib/recsplit"
@@ -356,3 +357,37 @@ func TestInvIndexScanFiles(t *testing.T) {
 	mergeInverted(t, db, ii, txs)
 	checkRanges(t, db, ii, txs)
 }
+
+func TestInvIndexFilesSink(t *testing.T) {
+	path, db, ii := testDbAndInvertedIndex(t)
+	defer db.Close()
+	defer ii.Close()
+	// The same keys as in TestInvIndexCollationBuild, collected in etl instead of kv tables
+	collector := etl.NewCollector(t.Name(), path, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close()
+	for _, e := range []struct {
+		key   string
+		txNum uint64
+	}{{"key1", 6}, {"key3", 6}, {"key2", 3}, {"key1", 2}} {
+		var v [8]byte
+		binary.BigEndian.PutUint64(v[:], e.txNum)
+		require.NoError(t, collector.Collect([]byte(e.key), v[:]))
+	}
+	sink, err := ii.NewFilesSink(0)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, collector.Load(nil, "", sink.Load, etl.TransformArgs{}))
+	require.Error(t, sink.Add([]byte("key0"), 1))
+	require.NoError(t, sink.Finish())
+
+	roTx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer roTx.Rollback()
+	it := ii.IterateRange([]byte("key1"), 0, 16, roTx)
+	var txNums []uint64
+	for it.HasNext() {
+		txNums = append(txNums, it.Next())
+	}
+	it.Close()
+	require.Equal(t, []uint64{2, 6}, txNums)
+}
@@ -0,0 +1,271 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/erigon-lib/compress"
+	"github.com/ledgerwatch/erigon-lib/etl"
+	"github.com/ledgerwatch/erigon-lib/recsplit"
+	"github.com/ledgerwatch/erigon-lib/recsplit/eliasfano32"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// CollationSink builds files of domain for one aggregation step from sorted streams of values and history,
+// for example from Load of etl.Collector, instead of collation of kv tables
+type CollationSink struct {
+	d            *Domain
+	step         uint64
+	valuesPath   string
+	valuesComp   *compress.Compressor
+	valuesCount  int
+	historyPath  string
+	historyComp  *compress.Compressor
+	historyCount int
+	indexBitmaps map[string]*roaring64.Bitmap
+	prefix       []byte // Track prefix to insert it before entries
+	lastKey      []byte
+	historyKey   []byte
+}
+
+func (d *Domain) NewCollationSink(step uint64) (*CollationSink, error) {
+	s := &CollationSink{d: d, step: step, indexBitmaps: map[string]*roaring64.Bitmap{}}
+	var err error
+	s.valuesPath = filepath.Join(d.dir, fmt.Sprintf("%s-values.%d-%d.dat", d.filenameBase, step, step+1))
+	if s.valuesComp, err = compress.NewCompressor(context.Background(), "collate values", s.valuesPath, d.dir, compress.MinPatternScore, 1, log.LvlDebug); err != nil {
+		return nil, fmt.Errorf("create %s values compressor: %w", d.filenameBase, err)
+	}
+	s.historyPath = filepath.Join(d.dir, fmt.Sprintf("%s-history.%d-%d.dat", d.filenameBase, step, step+1))
+	if s.historyComp, err = compress.NewCompressor(context.Background(), "collate history", s.historyPath, d.dir, compress.MinPatternScore, 1, log.LvlDebug); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("create %s history compressor: %w", d.filenameBase, err)
+	}
+	return s, nil
+}
+
+// AddValue adds the last value of key in the step, keys must be added in ascending order
+func (s *CollationSink) AddValue(k, v []byte) error {
+	if s.valuesCount > 0 && bytes.Compare(k, s.lastKey) <= 0 {
+		return fmt.Errorf("add %s values key [%x]: keys must be ascending, previous [%x]", s.d.filenameBase, k, s.lastKey)
+	}
+	s.lastKey = append(s.lastKey[:0], k...)
+	if s.d.prefixLen > 0 && (s.prefix == nil || !bytes.HasPrefix(k, s.prefix)) {
+		s.prefix = append(s.prefix[:0], k[:s.d.prefixLen]...)
+		if err := s.valuesComp.AddUncompressedWord(s.prefix); err != nil {
+			return fmt.Errorf("add %s values prefix [%x]: %w", s.d.filenameBase, s.prefix, err)
+		}
+		if err := s.valuesComp.AddUncompressedWord(nil); err != nil {
+			return fmt.Errorf("add %s values prefix val [%x]: %w", s.d.filenameBase, s.prefix, err)
+		}
+		s.valuesCount++
+	}
+	if err := s.valuesComp.AddUncompressedWord(k); err != nil {
+		return fmt.Errorf("add %s values key [%x]: %w", s.d.filenameBase, k, err)
+	}
+	s.valuesCount++ // Only counting keys, not values
+	if err := s.valuesComp.AddUncompressedWord(v); err != nil {
+		return fmt.Errorf("add %s values val [%x]=>[%x]: %w", s.d.filenameBase, k, v, err)
+	}
+	return nil
+}
+
+// AddHistory adds value of key before txNum, entries must be added in the order of txNums and keys
+func (s *CollationSink) AddHistory(txNum uint64, k, v []byte) error {
+	var txKey [8]byte
+	binary.BigEndian.PutUint64(txKey[:], txNum)
+	s.historyKey = append(append(s.historyKey[:0], txKey[:]...), k...)
+	if err := s.historyComp.AddUncompressedWord(s.historyKey); err != nil {
+		return fmt.Errorf("add %s history key [%x]: %w", s.d.filenameBase, txKey, err)
+	}
+	if err := s.historyComp.AddUncompressedWord(v); err != nil {
+		return fmt.Errorf("add %s history val [%x]=>[%x]: %w", s.d.filenameBase, txKey, v, err)
+	}
+	s.historyCount++
+	bitmap, ok := s.indexBitmaps[string(k)]
+	if !ok {
+		bitmap = roaring64.New()
+		s.indexBitmaps[string(k)] = bitmap
+	}
+	bitmap.Add(txNum)
+	return nil
+}
+
+// LoadValue is etl.LoadFunc which adds entries of collector (key => the last value) by AddValue
+func (s *CollationSink) LoadValue(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+	return s.AddValue(k, v)
+}
+
+// LoadHistory is etl.LoadFunc which adds entries of collector (8 bytes of txNum + key => value before txNum) by AddHistory
+func (s *CollationSink) LoadHistory(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+	if len(k) < 8 {
+		return fmt.Errorf("add %s history key [%x]: expected txNum and key", s.d.filenameBase, k)
+	}
+	return s.AddHistory(binary.BigEndian.Uint64(k), k[8:], v)
+}
+
+// collation passes compressors to Collation, which closes them
+func (s *CollationSink) collation() Collation {
+	c := Collation{
+		valuesPath:   s.valuesPath,
+		valuesComp:   s.valuesComp,
+		valuesCount:  s.valuesCount,
+		historyPath:  s.historyPath,
+		historyComp:  s.historyComp,
+		historyCount: s.historyCount,
+		indexBitmaps: s.indexBitmaps,
+	}
+	s.valuesComp, s.historyComp = nil, nil
+	return c
+}
+
+// Finish builds files and indices of the step and adds them to the domain
+func (s *CollationSink) Finish() error {
+	sf, err := s.d.buildFiles(s.step, s.collation())
+	if err != nil {
+		return err
+	}
+	s.d.integrateFiles(sf, s.step*s.d.aggregationStep, (s.step+1)*s.d.aggregationStep)
+	return nil
+}
+
+func (s *CollationSink) Close() {
+	if s.valuesComp != nil {
+		s.valuesComp.Close()
+	}
+	if s.historyComp != nil {
+		s.historyComp.Close()
+	}
+}
+
+// InvertedFilesSink builds files of inverted index for one aggregation step from stream of keys and their txNums sorted
+// by keys, for example from Load of etl.Collector, instead of collation of kv tables. Elias-Fano codes are written
+// as soon as all txNums of key are added
+type InvertedFilesSink struct {
+	ii      *InvertedIndex
+	step    uint64
+	datPath string
+	comp    *compress.Compressor
+	key     []byte
+	bitmap  *roaring64.Bitmap // TxNums of key
+	count   int               // Number of keys
+	buf     []byte
+}
+
+func (ii *InvertedIndex) NewFilesSink(step uint64) (*InvertedFilesSink, error) {
+	s := &InvertedFilesSink{ii: ii, step: step, bitmap: roaring64.New()}
+	txNumFrom := step * ii.aggregationStep
+	txNumTo := (step + 1) * ii.aggregationStep
+	s.datPath = filepath.Join(ii.dir, fmt.Sprintf("%s.%d-%d.dat", ii.filenameBase, txNumFrom/ii.aggregationStep, txNumTo/ii.aggregationStep))
+	var err error
+	if s.comp, err = compress.NewCompressor(context.Background(), "ef", s.datPath, ii.dir, compress.MinPatternScore, 1, log.LvlDebug); err != nil {
+		return nil, fmt.Errorf("create %s compressor: %w", ii.filenameBase, err)
+	}
+	return s, nil
+}
+
+// Add adds txNum of key, keys must be added in ascending order (txNums of key - in any order)
+func (s *InvertedFilesSink) Add(k []byte, txNum uint64) error {
+	if !s.bitmap.IsEmpty() && !bytes.Equal(k, s.key) {
+		if bytes.Compare(k, s.key) < 0 {
+			return fmt.Errorf("add %s key [%x]: keys must be ascending, previous [%x]", s.ii.filenameBase, k, s.key)
+		}
+		if err := s.addBitmap(s.key, s.bitmap); err != nil {
+			return err
+		}
+		s.bitmap.Clear()
+	}
+	s.key = append(s.key[:0], k...)
+	s.bitmap.Add(txNum)
+	return nil
+}
+
+// Load is etl.LoadFunc which adds entries of collector (key => 8 bytes of txNum) by Add
+func (s *InvertedFilesSink) Load(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+	if len(v) != 8 {
+		return fmt.Errorf("add %s key [%x]: expected txNum, got [%x]", s.ii.filenameBase, k, v)
+	}
+	return s.Add(k, binary.BigEndian.Uint64(v))
+}
+
+func (s *InvertedFilesSink) addBitmap(key []byte, bitmap *roaring64.Bitmap) error {
+	if err := s.comp.AddUncompressedWord(key); err != nil {
+		return fmt.Errorf("add %s key [%x]: %w", s.ii.filenameBase, key, err)
+	}
+	ef := eliasfano32.NewEliasFano(bitmap.GetCardinality(), bitmap.Maximum())
+	it := bitmap.Iterator()
+	for it.HasNext() {
+		ef.AddOffset(it.Next())
+	}
+	ef.Build()
+	s.buf = ef.AppendBytes(s.buf[:0])
+	if err := s.comp.AddUncompressedWord(s.buf); err != nil {
+		return fmt.Errorf("add %s val: %w", s.ii.filenameBase, err)
+	}
+	s.count++
+	return nil
+}
+
+// build compresses the file and builds its index
+func (s *InvertedFilesSink) build() (InvertedFiles, error) {
+	if !s.bitmap.IsEmpty() {
+		if err := s.addBitmap(s.key, s.bitmap); err != nil {
+			return InvertedFiles{}, err
+		}
+		s.bitmap.Clear()
+	}
+	var decomp *compress.Decompressor
+	var index *recsplit.Index
+	var err error
+	if err = s.comp.Compress(); err != nil {
+		return InvertedFiles{}, fmt.Errorf("compress %s: %w", s.ii.filenameBase, err)
+	}
+	s.comp.Close()
+	s.comp = nil
+	if decomp, err = compress.NewDecompressor(s.datPath); err != nil {
+		return InvertedFiles{}, fmt.Errorf("open %s decompressor: %w", s.ii.filenameBase, err)
+	}
+	txNumFrom := s.step * s.ii.aggregationStep
+	txNumTo := (s.step + 1) * s.ii.aggregationStep
+	idxPath := filepath.Join(s.ii.dir, fmt.Sprintf("%s.%d-%d.idx", s.ii.filenameBase, txNumFrom/s.ii.aggregationStep, txNumTo/s.ii.aggregationStep))
+	if index, err = buildIndex(decomp, idxPath, s.ii.dir, s.count, false /* values */, s.ii.etlBudget); err != nil {
+		decomp.Close()
+		return InvertedFiles{}, fmt.Errorf("build %s idx: %w", s.ii.filenameBase, err)
+	}
+	return InvertedFiles{decomp: decomp, index: index}, nil
+}
+
+// Finish builds file and index of the step and adds them to the inverted index
+func (s *InvertedFilesSink) Finish() error {
+	sf, err := s.build()
+	if err != nil {
+		return err
+	}
+	s.ii.integrateFiles(sf, s.step*s.ii.aggregationStep, (s.step+1)*s.ii.aggregationStep)
+	return nil
+}
+
+func (s *InvertedFilesSink) Close() {
+	if s.comp != nil {
+		s.comp.Close()
+	}
+}
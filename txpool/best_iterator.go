@@ -0,0 +1,156 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"bytes"
+	"container/heap"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/types"
+)
+
+// BestIterator - transactions of pending sub-pool for block building: ordered by effective tip at given base fee
+// (the best first), transactions of each sender in nonce order. Set of transactions is taken on creation (transactions
+// themselves are not copied), rlp is read on demand. Transactions with fee cap lower than base fee (and transactions
+// of the same sender with higher nonces) are not returned. Not thread-safe
+type BestIterator struct {
+	pool    *TxPool
+	tx      kv.Tx
+	baseFee uint64
+	heads   senderHeads
+}
+
+// senderTxs - not yet returned transactions of sender, in nonce order
+type senderTxs struct {
+	sender       [20]byte
+	txs          []*types.TxSlot
+	effectiveTip uint256.Int // of txs[0]
+}
+
+// senderHeads - heap of senders by effective tip of their next transaction
+type senderHeads []*senderTxs
+
+func (h senderHeads) Len() int { return len(h) }
+func (h senderHeads) Less(i, j int) bool {
+	if c := h[i].effectiveTip.Cmp(&h[j].effectiveTip); c != 0 {
+		return c > 0
+	}
+	return bytes.Compare(h[i].sender[:], h[j].sender[:]) < 0 // deterministic order of equal tips
+}
+func (h senderHeads) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *senderHeads) Push(x interface{}) { *h = append(*h, x.(*senderTxs)) }
+func (h *senderHeads) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil // for gc
+	*h = old[:n-1]
+	return item
+}
+
+// effectiveTip - min(tip, feeCap-baseFee), false if feeCap is lower than baseFee
+func effectiveTip(txn *types.TxSlot, baseFee uint64) (tip uint256.Int, ok bool) {
+	if txn.FeeCap < baseFee {
+		return tip, false
+	}
+	tip.SetUint64(txn.FeeCap - baseFee)
+	if txn.Tip.Lt(&tip) {
+		tip.Set(&txn.Tip)
+	}
+	return tip, true
+}
+
+// BestIterator - see BestIterator type. tx is used to read rlp of transactions already written to db
+func (p *TxPool) BestIterator(baseFee uint64, tx kv.Tx) *BestIterator {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	bySender := map[uint64]*senderTxs{}
+	for _, mt := range p.pending.best.ms {
+		s, ok := bySender[mt.Tx.SenderID]
+		if !ok {
+			s = &senderTxs{}
+			copy(s.sender[:], p.senders.senderID2Addr[mt.Tx.SenderID])
+			bySender[mt.Tx.SenderID] = s
+		}
+		s.txs = append(s.txs, mt.Tx)
+	}
+	it := &BestIterator{pool: p, tx: tx, baseFee: baseFee, heads: make(senderHeads, 0, len(bySender))}
+	for _, s := range bySender {
+		sort.Slice(s.txs, func(i, j int) bool { return s.txs[i].Nonce < s.txs[j].Nonce })
+		if it.setHead(s) {
+			it.heads = append(it.heads, s)
+		}
+	}
+	heap.Init(&it.heads)
+	return it
+}
+
+// setHead computes effective tip of the next transaction of sender, false if sender has nothing to return
+func (it *BestIterator) setHead(s *senderTxs) bool {
+	if len(s.txs) == 0 {
+		return false
+	}
+	var ok bool
+	if s.effectiveTip, ok = effectiveTip(s.txs[0], it.baseFee); !ok {
+		s.txs = nil
+		return false
+	}
+	return true
+}
+
+// Peek returns the best transaction and its sender, nil if there are no more transactions
+func (it *BestIterator) Peek() (txn *types.TxSlot, sender [20]byte) {
+	if len(it.heads) == 0 {
+		return nil, sender
+	}
+	return it.heads[0].txs[0], it.heads[0].sender
+}
+
+// Rlp of the transaction returned by Peek, nil if it was discarded from the pool since creation of iterator
+func (it *BestIterator) Rlp() ([]byte, error) {
+	txn, _ := it.Peek()
+	if txn == nil {
+		return nil, nil
+	}
+	return it.pool.GetRlp(it.tx, txn.IDHash[:])
+}
+
+// Pop - transaction returned by Peek is consumed, next transaction of the same sender competes with others
+func (it *BestIterator) Pop() {
+	if len(it.heads) == 0 {
+		return
+	}
+	s := it.heads[0]
+	s.txs = s.txs[1:]
+	if it.setHead(s) {
+		heap.Fix(&it.heads, 0)
+	} else {
+		heap.Pop(&it.heads)
+	}
+}
+
+// Skip - transaction returned by Peek is not consumed (for example, doesn't fit into block),
+// remaining transactions of its sender are skipped too - they can't be included without it
+func (it *BestIterator) Skip() {
+	if len(it.heads) == 0 {
+		return
+	}
+	heap.Pop(&it.heads)
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"bytes"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcache"
+	"github.com/ledgerwatch/erigon-lib/types"
+)
+
+var (
+	deniedBySenderCounter    = metrics.GetOrCreateCounter(`pool_denied_txs{by="sender"}`)
+	deniedByRecipientCounter = metrics.GetOrCreateCounter(`pool_denied_txs{by="recipient"}`)
+	deniedByCodeHashCounter  = metrics.GetOrCreateCounter(`pool_denied_txs{by="code_hash"}`)
+)
+
+// denylist - cfg.DeniedAddresses and cfg.DeniedCodeHashes. Transactions of denied senders, to denied recipients and
+// to contracts with denied code are rejected by validateTx (local transactions too)
+type denylist struct {
+	addrs      map[string]struct{}
+	codeHashes [][]byte // prefixes of code hashes
+}
+
+func newDenylist(cfg Config) *denylist {
+	d := &denylist{addrs: make(map[string]struct{}, len(cfg.DeniedAddresses))}
+	for _, addr := range cfg.DeniedAddresses {
+		d.addrs[addr] = struct{}{}
+	}
+	for _, codeHash := range cfg.DeniedCodeHashes {
+		d.codeHashes = append(d.codeHashes, []byte(codeHash))
+	}
+	return d
+}
+
+// check returns Denied if transaction is denied, Success otherwise. Code hash of recipient is read from stateCache,
+// errors of reading are ignored - same as in sendersBatch.info
+func (d *denylist) check(txn *types.TxSlot, sender []byte, stateCache kvcache.CacheView) DiscardReason {
+	if len(d.addrs) > 0 {
+		if _, ok := d.addrs[string(sender)]; ok {
+			deniedBySenderCounter.Inc()
+			return Denied
+		}
+		if _, ok := d.addrs[string(txn.To[:])]; ok && !txn.Creation {
+			deniedByRecipientCounter.Inc()
+			return Denied
+		}
+	}
+	if len(d.codeHashes) == 0 || txn.Creation {
+		return Success
+	}
+	encoded, err := stateCache.Get(txn.To[:])
+	if err != nil {
+		return Success
+	}
+	codeHash, ok, err := types.DecodeAccountCodeHash(encoded)
+	if err != nil || !ok {
+		return Success
+	}
+	for _, prefix := range d.codeHashes {
+		if bytes.HasPrefix(codeHash[:], prefix) {
+			deniedByCodeHashCounter.Inc()
+			return Denied
+		}
+	}
+	return Success
+}
@@ -0,0 +1,177 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"sync"
+)
+
+type EventType uint8
+
+const (
+	EventPending  EventType = 0 // Transaction entered pending sub-pool
+	EventBaseFee  EventType = 1 // Transaction entered baseFee sub-pool
+	EventQueued   EventType = 2 // Transaction entered queued sub-pool
+	EventReplaced EventType = 3 // Transaction was replaced by transaction with the same nonce - Event.ReplacedBy
+	EventMined    EventType = 4 // Transaction was included into block
+	EventDropped  EventType = 5 // Transaction was discarded by pool - Event.Reason
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPending:
+		return "pending"
+	case EventBaseFee:
+		return "baseFee"
+	case EventQueued:
+		return "queued"
+	case EventReplaced:
+		return "replaced"
+	case EventMined:
+		return "mined"
+	case EventDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Type       EventType
+	Hash       [32]byte
+	Sender     [20]byte
+	Nonce      uint64
+	ReplacedBy [32]byte      // hash of replacement, EventReplaced only
+	Reason     DiscardReason // EventDropped only
+}
+
+// Events - pub/sub of pool events. Events of one pool operation (new block, batch of added transactions, ...) are
+// published together, after sub-pool changes of the operation: transaction which entered pending sub-pool via queued
+// sub-pool gets only EventPending. Slow subscriber loses events (same as NewSlotsStreams)
+type Events struct {
+	lock sync.RWMutex
+	id   uint
+	subs map[uint]chan []Event
+}
+
+// Subscribe - published slices are shared by all subscribers and must not be modified. unsubscribe closes ch
+func (e *Events) Subscribe(buffer int) (ch <-chan []Event, unsubscribe func()) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.subs == nil {
+		e.subs = map[uint]chan []Event{}
+	}
+	e.id++
+	id := e.id
+	sub := make(chan []Event, buffer)
+	e.subs[id] = sub
+	return sub, func() { e.unsubscribe(id) }
+}
+
+func (e *Events) unsubscribe(id uint) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	sub, ok := e.subs[id]
+	if !ok { // double-unsubscribe support
+		return
+	}
+	close(sub)
+	delete(e.subs, id)
+}
+
+func (e *Events) Len() int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return len(e.subs)
+}
+
+// Publish never blocks
+func (e *Events) Publish(events []Event) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, sub := range e.subs {
+		select {
+		case sub <- events:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents - subscription to events of transactions: entering sub-pools, replacement, inclusion into block,
+// discarding. Also available via gRPC - see GrpcServer.OnEvents
+func (p *TxPool) SubscribeEvents(buffer int) (ch <-chan []Event, unsubscribe func()) {
+	return p.events.Subscribe(buffer)
+}
+
+// movedLocked is called when transaction is added to sub-pool, event is created on publishing. Also it tracks
+// when transaction entered queued sub-pool, for evictExpiredLocked
+func (p *TxPool) movedLocked(mt *metaTx) {
+	if mt.currentSubPool != QueuedSubPool {
+		mt.queuedBlock = 0
+	} else if mt.queuedBlock == 0 {
+		mt.queuedBlock = p.lastSeenBlock.Load()
+	}
+	if p.events.Len() > 0 {
+		p.movedTxs = append(p.movedTxs, mt)
+	}
+}
+
+func (p *TxPool) addEventLocked(t EventType, mt *metaTx, replacedBy *metaTx, reason DiscardReason) {
+	if p.events.Len() == 0 {
+		return
+	}
+	ev := Event{Type: t, Hash: mt.Tx.IDHash, Nonce: mt.Tx.Nonce, Reason: reason}
+	copy(ev.Sender[:], p.senders.senderID2Addr[mt.Tx.SenderID])
+	if replacedBy != nil {
+		ev.ReplacedBy = replacedBy.Tx.IDHash
+	}
+	p.eventsBuf = append(p.eventsBuf, ev)
+}
+
+func (p *TxPool) discardEventLocked(mt *metaTx, reason DiscardReason) {
+	switch reason {
+	case ReplacedByHigherTip: // EventReplaced is created by addLocked
+	case Mined:
+		p.addEventLocked(EventMined, mt, nil, reason)
+	default:
+		p.addEventLocked(EventDropped, mt, nil, reason)
+	}
+}
+
+// publishEventsLocked publishes events of finished pool operation
+func (p *TxPool) publishEventsLocked() {
+	for i, mt := range p.movedTxs {
+		p.movedTxs[i] = nil // for gc
+		if mt.currentSubPool == mt.notifiedSubPool || p.byHash[string(mt.Tx.IDHash[:])] != mt {
+			continue
+		}
+		mt.notifiedSubPool = mt.currentSubPool
+		switch mt.currentSubPool {
+		case PendingSubPool:
+			p.addEventLocked(EventPending, mt, nil, NotSet)
+		case BaseFeeSubPool:
+			p.addEventLocked(EventBaseFee, mt, nil, NotSet)
+		case QueuedSubPool:
+			p.addEventLocked(EventQueued, mt, nil, NotSet)
+		}
+	}
+	p.movedTxs = p.movedTxs[:0]
+	if len(p.eventsBuf) > 0 {
+		p.events.Publish(p.eventsBuf)
+		p.eventsBuf = nil
+	}
+}
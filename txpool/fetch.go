@@ -19,6 +19,7 @@ package txpool
 import (
 	"context"
 	"fmt"
+	"runtime"
 	"sync"
 	"time"
 
@@ -51,10 +52,11 @@ type Fetch struct {
 
 	stateChangesParseCtx     *types2.TxParseContext
 	stateChangesParseCtxLock sync.Mutex
-	pooledTxsParseCtx        *types2.TxParseContext
-	pooledTxsParseCtxLock    sync.Mutex
+	pooledTxsParseWorkers    *parseWorkers
 }
 
+const senderCacheSize = 64 * 1024 // senders of transactions received from peers, by transaction hash
+
 type StateChangesClient interface {
 	StateChanges(ctx context.Context, in *remote.StateChangeRequest, opts ...grpc.CallOption) (remote.KV_StateChangesClient, error)
 }
@@ -63,18 +65,20 @@ type StateChangesClient interface {
 // SentryClient here is an interface, it is suitable for mocking in tests (mock will need
 // to implement all the functions of the SentryClient interface).
 func NewFetch(ctx context.Context, sentryClients []direct.SentryClient, pool Pool, stateChangesClient StateChangesClient, coreDB kv.RoDB, db kv.RwDB, chainID uint256.Int) *Fetch {
+	senderCache := types2.NewSenderCache(senderCacheSize)
 	f := &Fetch{
-		ctx:                  ctx,
-		sentryClients:        sentryClients,
-		pool:                 pool,
-		coreDB:               coreDB,
-		db:                   db,
-		stateChangesClient:   stateChangesClient,
-		stateChangesParseCtx: types2.NewTxParseContext(chainID), //TODO: change ctx if rules changed
-		pooledTxsParseCtx:    types2.NewTxParseContext(chainID),
+		ctx:                   ctx,
+		sentryClients:         sentryClients,
+		pool:                  pool,
+		coreDB:                coreDB,
+		db:                    db,
+		stateChangesClient:    stateChangesClient,
+		stateChangesParseCtx:  types2.NewTxParseContext(chainID), //TODO: change ctx if rules changed
+		pooledTxsParseWorkers: newParseWorkers(chainID, pool.ChainConfig(), runtime.GOMAXPROCS(0), senderCache, pool.ValidateSerializedTxn),
 	}
-	f.pooledTxsParseCtx.ValidateRLP(f.pool.ValidateSerializedTxn)
 	f.stateChangesParseCtx.ValidateRLP(f.pool.ValidateSerializedTxn)
+	f.stateChangesParseCtx.WithChainConfig(f.pool.ChainConfig())
+	f.stateChangesParseCtx.WithSenderCache(senderCache) // mined transactions were received from peers
 
 	return f
 }
@@ -83,12 +87,6 @@ func (f *Fetch) SetWaitGroup(wg *sync.WaitGroup) {
 	f.wg = wg
 }
 
-func (f *Fetch) threadSafeParsePooledTxn(cb func(*types2.TxParseContext) error) error {
-	f.pooledTxsParseCtxLock.Lock()
-	defer f.pooledTxsParseCtxLock.Unlock()
-	return cb(f.pooledTxsParseCtx)
-}
-
 func (f *Fetch) threadSafeParseStateChangeTxn(cb func(*types2.TxParseContext) error) error {
 	f.stateChangesParseCtxLock.Lock()
 	defer f.stateChangesParseCtxLock.Unlock()
@@ -294,47 +292,22 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 		}
 	case sentry.MessageId_POOLED_TRANSACTIONS_66, sentry.MessageId_TRANSACTIONS_66:
 		txs := types2.TxSlots{}
-		if err := f.threadSafeParsePooledTxn(func(parseContext *types2.TxParseContext) error {
-			return nil
-		}); err != nil {
-			return err
-		}
-
+		known := func(hash []byte) (bool, error) { return f.pool.IdHashKnown(tx, hash) }
 		switch req.Id {
 		case sentry.MessageId_TRANSACTIONS_66:
-			if err := f.threadSafeParsePooledTxn(func(parseContext *types2.TxParseContext) error {
-				if _, err := types2.ParseTransactions(req.Data, 0, parseContext, &txs, func(hash []byte) error {
-					known, err := f.pool.IdHashKnown(tx, hash)
-					if err != nil {
-						return err
-					}
-					if known {
-						return types2.ErrRejected
-					}
-					return nil
-				}); err != nil {
-					return err
-				}
-				return nil
-			}); err != nil {
+			if err := f.pooledTxsParseWorkers.parse(req.Data, 0, &txs, known); err != nil {
 				return err
 			}
 		case sentry.MessageId_POOLED_TRANSACTIONS_66:
-			if err := f.threadSafeParsePooledTxn(func(parseContext *types2.TxParseContext) error {
-				if _, _, err := types2.ParsePooledTransactions66(req.Data, 0, parseContext, &txs, func(hash []byte) error {
-					known, err := f.pool.IdHashKnown(tx, hash)
-					if err != nil {
-						return err
-					}
-					if known {
-						return types2.ErrRejected
-					}
-					return nil
-				}); err != nil {
-					return err
-				}
-				return nil
-			}); err != nil {
+			// Skip request id
+			p, _, err := rlp.List(req.Data, 0)
+			if err != nil {
+				return err
+			}
+			if p, _, err = rlp.U64(req.Data, p); err != nil {
+				return err
+			}
+			if err := f.pooledTxsParseWorkers.parse(req.Data, p, &txs, known); err != nil {
 				return err
 			}
 		default:
@@ -437,32 +410,23 @@ func (f *Fetch) handleStateChanges(ctx context.Context, client StateChangesClien
 			return nil
 		}
 
+		// txs of all blocks of the batch are collected: reorg unwinds several blocks at once
 		var unwindTxs, minedTxs types2.TxSlots
 		for _, change := range req.ChangeBatch {
-			if change.Direction == remote.Direction_FORWARD {
-				minedTxs.Resize(uint(len(change.Txs)))
-				for i := range change.Txs {
-					minedTxs.Txs[i] = &types2.TxSlot{}
-					if err = f.threadSafeParseStateChangeTxn(func(parseContext *types2.TxParseContext) error {
-						_, err := parseContext.ParseTransaction(change.Txs[i], 0, minedTxs.Txs[i], minedTxs.Senders.At(i), false /* hasEnvelope */, nil)
-						return err
-					}); err != nil {
-						log.Warn("stream.Recv", "err", err)
-						continue
-					}
+			for i := range change.Txs {
+				txn, sender := &types2.TxSlot{}, [20]byte{}
+				if err = f.threadSafeParseStateChangeTxn(func(parseContext *types2.TxParseContext) error {
+					_, err := parseContext.ParseTransaction(change.Txs[i], 0, txn, sender[:], false /* hasEnvelope */, nil)
+					return err
+				}); err != nil {
+					log.Warn("stream.Recv", "err", err)
+					continue
 				}
-			}
-			if change.Direction == remote.Direction_UNWIND {
-				unwindTxs.Resize(uint(len(change.Txs)))
-				for i := range change.Txs {
-					unwindTxs.Txs[i] = &types2.TxSlot{}
-					if err = f.threadSafeParseStateChangeTxn(func(parseContext *types2.TxParseContext) error {
-						_, err = parseContext.ParseTransaction(change.Txs[i], 0, unwindTxs.Txs[i], unwindTxs.Senders.At(i), false /* hasEnvelope */, nil)
-						return err
-					}); err != nil {
-						log.Warn("stream.Recv", "err", err)
-						continue
-					}
+				switch change.Direction {
+				case remote.Direction_FORWARD:
+					minedTxs.Append(txn, sender[:], false)
+				case remote.Direction_UNWIND:
+					unwindTxs.Append(txn, sender[:], false)
 				}
 			}
 		}
@@ -19,6 +19,7 @@ package txpool
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -185,3 +186,88 @@ func TestOnNewBlock(t *testing.T) {
 	assert.Equal(t, 1, len(pool.OnNewBlockCalls()))
 	assert.Equal(t, 3, len(pool.OnNewBlockCalls()[0].MinedTxs.Txs))
 }
+
+func TestOnNewBlockUnwind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	coreDB, db := memdb.NewTestDB(t), memdb.NewTestDB(t)
+
+	i := 0
+	stream := &remote.KV_StateChangesClientMock{
+		RecvFunc: func() (*remote.StateChangeBatch, error) {
+			if i > 0 {
+				return nil, io.EOF
+			}
+			i++
+			return &remote.StateChangeBatch{
+				DatabaseViewID: 1,
+				ChangeBatch: []*remote.StateChange{
+					{Direction: remote.Direction_UNWIND, Txs: [][]byte{decodeHex(types3.TxParseMainnetTests[0].PayloadStr)}, BlockHeight: 2, BlockHash: gointerfaces.ConvertHashToH256([32]byte{2})},
+					{Direction: remote.Direction_UNWIND, Txs: [][]byte{decodeHex(types3.TxParseMainnetTests[1].PayloadStr), {0x01}}, BlockHeight: 1, BlockHash: gointerfaces.ConvertHashToH256([32]byte{1})},
+					{Txs: [][]byte{decodeHex(types3.TxParseMainnetTests[2].PayloadStr)}, BlockHeight: 1, BlockHash: gointerfaces.ConvertHashToH256([32]byte{3})},
+				},
+			}, nil
+		},
+	}
+	stateChanges := &remote.KVClientMock{
+		StateChangesFunc: func(ctx context.Context, in *remote.StateChangeRequest, opts ...grpc.CallOption) (remote.KV_StateChangesClient, error) {
+			return stream, nil
+		},
+	}
+	pool := &PoolMock{}
+	fetch := NewFetch(ctx, nil, pool, stateChanges, coreDB, db, *u256.N1)
+	err := fetch.handleStateChanges(ctx, stateChanges)
+	assert.ErrorIs(t, io.EOF, err)
+	require.Equal(t, 1, len(pool.OnNewBlockCalls()))
+	// txs of both unwound blocks, without unparsable one
+	unwindTxs := pool.OnNewBlockCalls()[0].UnwindTxs
+	require.Equal(t, 2, len(unwindTxs.Txs))
+	assert.Equal(t, decodeHex(types3.TxParseMainnetTests[0].IdHashStr), unwindTxs.Txs[0].IDHash[:])
+	assert.Equal(t, decodeHex(types3.TxParseMainnetTests[1].IdHashStr), unwindTxs.Txs[1].IDHash[:])
+	assert.Equal(t, decodeHex(types3.TxParseMainnetTests[1].SenderStr), unwindTxs.Senders.At(1))
+	assert.Equal(t, 1, len(pool.OnNewBlockCalls()[0].MinedTxs.Txs))
+}
+
+func TestParseWorkers(t *testing.T) {
+	require := require.New(t)
+	parseCtx := types3.NewTxParseContext(*u256.N1)
+	var rlps [][]byte
+	for _, tt := range types3.TxParseMainnetTests {
+		txn := &types3.TxSlot{}
+		_, err := parseCtx.ParseTransaction(decodeHex(tt.PayloadStr), 0, txn, make([]byte, 20), false /* hasEnvelope */, nil)
+		require.NoError(err)
+		rlps = append(rlps, txn.Rlp)
+	}
+	payload := types3.EncodeTransactions(rlps, nil)
+	expect := types3.TxSlots{}
+	_, err := types3.ParseTransactions(payload, 0, parseCtx, &expect, nil)
+	require.NoError(err)
+	require.Equal(len(rlps), len(expect.Txs))
+
+	senderCache := types3.NewSenderCache(1024)
+	workers := newParseWorkers(*u256.N1, nil, 4, senderCache, nil)
+	knownHash := expect.Txs[1].IDHash
+	known := func(hash []byte) (bool, error) { return string(hash) == string(knownHash[:]), nil }
+	for i := 0; i < 2; i++ { // second time senders are taken from cache
+		txs := types3.TxSlots{}
+		require.NoError(workers.parse(payload, 0, &txs, known))
+		require.Equal(len(expect.Txs)-1, len(txs.Txs))
+		for j, k := 0, 0; j < len(expect.Txs); j++ {
+			if j == 1 {
+				continue
+			}
+			require.Equal(expect.Txs[j].IDHash, txs.Txs[k].IDHash)
+			require.Equal(expect.Senders.At(j), txs.Senders.At(k))
+			require.Equal(expect.Txs[j].Nonce, txs.Txs[k].Nonce)
+			k++
+		}
+		require.Equal(len(expect.Txs)-1, senderCache.Len()) // sender of known transaction is not recovered
+	}
+	require.Equal(4, len(workers.ctxs)) // parse contexts are returned
+
+	knownErr := errors.New("known")
+	txs := types3.TxSlots{}
+	require.ErrorIs(workers.parse(payload, 0, &txs, func([]byte) (bool, error) { return false, knownErr }), knownErr)
+	require.Equal(0, len(txs.Txs))
+	require.Equal(4, len(workers.ctxs))
+}
@@ -0,0 +1,157 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/types"
+)
+
+// Journal of local transactions - kv.PoolLocalJournal table.
+// Local transaction is journaled when it's written to db first time, and stays in journal:
+//   - while it's not included into block - even if pool discarded it (for example, because of sub-pool overflow).
+//     Such transactions are re-injected after restart of the node and after reorg
+//   - cfg.JournalDepth blocks after its nonce became too low (transaction was included into block) - to re-inject
+//     it if the block was unwound
+// Transaction is removed from journal when it's replaced by another transaction with same nonce, when it expired in
+// queued sub-pool, and when it's re-injected (after restart or reorg), but failed validation - for example, because of
+// insufficient funds.
+
+// journalDiscarded updates journal entry of local transaction discarded since last flush
+func (p *TxPool) journalDiscarded(tx kv.RwTx, mt *metaTx) error {
+	idHash := mt.Tx.IDHash[:]
+	switch mt.discardReason {
+	case ReplacedByHigherTip, Expired:
+		return tx.Delete(kv.PoolLocalJournal, idHash, nil)
+	case Mined, NonceTooLow:
+		v, err := tx.GetOne(kv.PoolLocalJournal, idHash)
+		if err != nil {
+			return err
+		}
+		if len(v) < 8 || binary.BigEndian.Uint64(v) != 0 {
+			return nil
+		}
+		v = common.Copy(v)
+		binary.BigEndian.PutUint64(v, p.lastSeenBlock.Load())
+		return tx.Put(kv.PoolLocalJournal, idHash, v)
+	}
+	return nil
+}
+
+// pruneJournal removes transactions included into blocks deeper than cfg.JournalDepth, and transactions rejected
+// since last flush
+func (p *TxPool) pruneJournal(tx kv.RwTx) error {
+	for _, idHash := range p.rejectedJournal {
+		if err := tx.Delete(kv.PoolLocalJournal, idHash, nil); err != nil {
+			return err
+		}
+	}
+	lastSeenBlock := p.lastSeenBlock.Load()
+	var pruned [][]byte
+	if err := tx.ForEach(kv.PoolLocalJournal, nil, func(k, v []byte) error {
+		if includedBlock := binary.BigEndian.Uint64(v); includedBlock != 0 && includedBlock+p.cfg.JournalDepth <= lastSeenBlock {
+			pruned = append(pruned, common.Copy(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range pruned {
+		if err := tx.Delete(kv.PoolLocalJournal, k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// journalTxs returns journaled transactions for which skip returns false, transactions are marked as local
+func (p *TxPool) journalTxs(tx kv.Tx, skip func(idHash []byte, includedBlock uint64) (bool, error)) (types.TxSlots, error) {
+	txs := types.TxSlots{}
+	parseCtx := types.NewTxParseContext(p.chainID)
+	parseCtx.WithSender(false)
+	parseCtx.TrustBlobs(true)
+	parseCtx.WithChainConfig(p.cfg.ChainConfig)
+	if err := tx.ForEach(kv.PoolLocalJournal, nil, func(k, v []byte) error {
+		skipTx, err := skip(k, binary.BigEndian.Uint64(v))
+		if err != nil {
+			return err
+		}
+		if skipTx {
+			return nil
+		}
+		addr, txRlp := v[8:8+20], common.Copy(v[8+20:])
+		txn := &types.TxSlot{}
+		if _, err := parseCtx.ParseTransaction(txRlp, 0, txn, nil, false /* hasEnvelope */, nil); err != nil {
+			return fmt.Errorf("err: %w, rlp: %x", err, txRlp)
+		}
+		txs.Append(txn, addr, true)
+		return nil
+	}); err != nil {
+		return types.TxSlots{}, err
+	}
+	return txs, nil
+}
+
+// withJournalTxs prepends (to keep local flag of duplicates) journaled transactions which are not in the pool to
+// unwindTxs, if stateChanges contain unwind: transactions of abandoned blocks are re-injected even if they are
+// not in unwindTxs
+func (p *TxPool) withJournalTxs(tx kv.Tx, stateChanges *remote.StateChangeBatch, unwindTxs types.TxSlots) (types.TxSlots, error) {
+	unwind := false
+	for _, change := range stateChanges.ChangeBatch {
+		if change.Direction == remote.Direction_UNWIND {
+			unwind = true
+			break
+		}
+	}
+	if !unwind {
+		return unwindTxs, nil
+	}
+	txs, err := p.journalTxs(tx, func(idHash []byte, _ uint64) (bool, error) {
+		_, ok := p.byHash[string(idHash)]
+		return ok, nil
+	})
+	if err != nil {
+		return unwindTxs, err
+	}
+	for i, txn := range unwindTxs.Txs {
+		txs.Append(txn, unwindTxs.Senders.At(i), unwindTxs.IsLocal[i])
+	}
+	return txs, nil
+}
+
+// rejectJournaled handles local transaction which failed validation when it was re-injected: included transaction
+// (NonceTooLow) stays in journal for cfg.JournalDepth blocks, other transactions are removed from journal on next flush
+func (p *TxPool) rejectJournaled(txn *types.TxSlot, reason DiscardReason) {
+	if reason == NonceTooLow {
+		p.discardIncludedLocal(txn)
+		return
+	}
+	p.rejectedJournal = append(p.rejectedJournal, common.Copy(txn.IDHash[:]))
+}
+
+// discardIncludedLocal schedules update of journal entry of local transaction which was included into block while
+// the node was down, it's found when pool is loaded from db
+func (p *TxPool) discardIncludedLocal(txn *types.TxSlot) {
+	mt := newMetaTx(txn, true /* isLocal */, p.lastSeenBlock.Load())
+	mt.discardReason = NonceTooLow
+	p.deletedTxs = append(p.deletedTxs, mt)
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Composition of the pool - updated at the end of each pool operation which changes it
+var (
+	pendingTxsGauge = metrics.GetOrCreateCounter(`pool_txs{sub_pool="pending"}`)
+	baseFeeTxsGauge = metrics.GetOrCreateCounter(`pool_txs{sub_pool="base_fee"}`)
+	queuedTxsGauge  = metrics.GetOrCreateCounter(`pool_txs{sub_pool="queued"}`)
+	txsSizeGauge    = metrics.GetOrCreateCounter(`pool_txs_bytes`)
+	blobsGauge      = metrics.GetOrCreateCounter(`pool_blobs`)
+)
+
+// Churn and propagation
+var (
+	addedTxsCounter     = metrics.GetOrCreateCounter(`pool_added_txs_total`)
+	validateTxsTimer    = metrics.NewSummary(`pool_validate_txs`)
+	broadcastTxsCounter = metrics.GetOrCreateCounter(`pool_propagated_txs_total{kind="broadcast"}`)
+	announcedTxsCounter = metrics.GetOrCreateCounter(`pool_propagated_txs_total{kind="announce"}`)
+	newPeersCounter     = metrics.GetOrCreateCounter(`pool_propagated_to_new_peers_total`)
+)
+
+// discardedTxsCounter - transactions removed from the pool: mined, replaced, evicted, ...
+func discardedTxsCounter(reason DiscardReason) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`pool_discarded_txs_total{reason="%s"}`, reason))
+}
+
+// rejectedTxsCounter - transactions not added to the pool: failed validation or replacement
+func rejectedTxsCounter(reason DiscardReason) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`pool_rejected_txs_total{reason="%s"}`, reason))
+}
+
+func (p *TxPool) updateMetricsLocked() {
+	pendingTxsGauge.Set(uint64(p.pending.Len()))
+	baseFeeTxsGauge.Set(uint64(p.baseFee.Len()))
+	queuedTxsGauge.Set(uint64(p.queued.Len()))
+	txsSizeGauge.Set(p.txsSize)
+	blobsGauge.Set(uint64(p.blobCount))
+}
@@ -5,6 +5,7 @@ package txpool
 
 import (
 	"context"
+	"github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	types2 "github.com/ledgerwatch/erigon-lib/types"
@@ -30,6 +31,9 @@ var _ Pool = &PoolMock{}
 // 			AddRemoteTxsFunc: func(ctx context.Context, newTxs types2.TxSlots)  {
 // 				panic("mock out the AddRemoteTxs method")
 // 			},
+// 			ChainConfigFunc: func() *chain.Config {
+// 				panic("mock out the ChainConfig method")
+// 			},
 // 			GetRlpFunc: func(tx kv.Tx, hash []byte) ([]byte, error) {
 // 				panic("mock out the GetRlp method")
 // 			},
@@ -61,6 +65,9 @@ type PoolMock struct {
 	// AddRemoteTxsFunc mocks the AddRemoteTxs method.
 	AddRemoteTxsFunc func(ctx context.Context, newTxs types2.TxSlots)
 
+	// ChainConfigFunc mocks the ChainConfig method.
+	ChainConfigFunc func() *chain.Config
+
 	// GetRlpFunc mocks the GetRlp method.
 	GetRlpFunc func(tx kv.Tx, hash []byte) ([]byte, error)
 
@@ -99,6 +106,9 @@ type PoolMock struct {
 			// NewTxs is the newTxs argument value.
 			NewTxs types2.TxSlots
 		}
+		// ChainConfig holds details about calls to the ChainConfig method.
+		ChainConfig []struct {
+		}
 		// GetRlp holds details about calls to the GetRlp method.
 		GetRlp []struct {
 			// Tx is the tx argument value.
@@ -138,6 +148,7 @@ type PoolMock struct {
 	lockAddLocalTxs           sync.RWMutex
 	lockAddNewGoodPeer        sync.RWMutex
 	lockAddRemoteTxs          sync.RWMutex
+	lockChainConfig           sync.RWMutex
 	lockGetRlp                sync.RWMutex
 	lockIdHashKnown           sync.RWMutex
 	lockOnNewBlock            sync.RWMutex
@@ -254,6 +265,35 @@ func (mock *PoolMock) AddRemoteTxsCalls() []struct {
 	return calls
 }
 
+// ChainConfig calls ChainConfigFunc.
+func (mock *PoolMock) ChainConfig() *chain.Config {
+	callInfo := struct {
+	}{}
+	mock.lockChainConfig.Lock()
+	mock.calls.ChainConfig = append(mock.calls.ChainConfig, callInfo)
+	mock.lockChainConfig.Unlock()
+	if mock.ChainConfigFunc == nil {
+		var (
+			configOut *chain.Config
+		)
+		return configOut
+	}
+	return mock.ChainConfigFunc()
+}
+
+// ChainConfigCalls gets all the calls that were made to ChainConfig.
+// Check the length with:
+//     len(mockedPool.ChainConfigCalls())
+func (mock *PoolMock) ChainConfigCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockChainConfig.RLock()
+	calls = mock.calls.ChainConfig
+	mock.lockChainConfig.RUnlock()
+	return calls
+}
+
 // GetRlp calls GetRlpFunc.
 func (mock *PoolMock) GetRlp(tx kv.Tx, hash []byte) ([]byte, error) {
 	callInfo := struct {
@@ -0,0 +1,134 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common/dbg"
+	"github.com/ledgerwatch/erigon-lib/rlp"
+	"github.com/ledgerwatch/erigon-lib/types"
+	"go.uber.org/atomic"
+)
+
+// parseWorkers - parallel parsing (keccak and sender recovery) of transactions received from peers. Each worker
+// has own parse context, parse contexts are shared by all messages being handled. Senders are cached by transaction
+// hash: transactions which are received from many peers, and then mined, are recovered once
+type parseWorkers struct {
+	ctxs chan *types.TxParseContext // idle parse contexts
+}
+
+func newParseWorkers(chainID uint256.Int, chainConfig *chain.Config, workers int, senderCache *types.SenderCache, validateRlp func([]byte) error) *parseWorkers {
+	w := &parseWorkers{ctxs: make(chan *types.TxParseContext, workers)}
+	for i := 0; i < workers; i++ {
+		ctx := types.NewTxParseContext(chainID)
+		ctx.WithChainConfig(chainConfig)
+		ctx.ValidateRLP(validateRlp)
+		ctx.WithSenderCache(senderCache)
+		w.ctxs <- ctx
+	}
+	return w
+}
+
+// parse - transactions of rlp list at pos of payload (transactions with envelopes, as in TRANSACTIONS_66 message)
+// are appended to txSlots, except of the transactions for which known returns true. Transactions are parsed in
+// parallel, known is called (under lock) as soon as hash is computed - known transactions are rejected before
+// sender recovery
+func (w *parseWorkers) parse(payload []byte, pos int, txSlots *types.TxSlots, known func(hash []byte) (bool, error)) error {
+	dataPos, dataLen, err := rlp.List(payload, pos)
+	if err != nil {
+		return err
+	}
+	var positions []int
+	for p := dataPos; p < dataPos+dataLen; {
+		positions = append(positions, p)
+		elemPos, elemLen, _, err := rlp.Prefix(payload, p)
+		if err != nil {
+			return fmt.Errorf("%w: size Prefix: %s", types.ErrParseTxn, err)
+		}
+		p = elemPos + elemLen
+	}
+	txs := make([]*types.TxSlot, len(positions))
+	senders := make([]byte, 20*len(positions))
+	errs := make([]error, len(positions))
+	isKnown := make([]bool, len(positions))
+	var knownLock sync.Mutex
+	var knownErr error
+	validateHash := func(i int) func([]byte) error {
+		return func(hash []byte) error {
+			knownLock.Lock()
+			defer knownLock.Unlock()
+			if knownErr != nil {
+				return knownErr
+			}
+			if isKnown[i], knownErr = known(hash); knownErr != nil {
+				return knownErr
+			}
+			if isKnown[i] {
+				return types.ErrRejected
+			}
+			return nil
+		}
+	}
+	var next atomic.Int64
+	parseTx := func(ctx *types.TxParseContext, i int) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				errs[i] = fmt.Errorf("%+v, trace: %s", rec, dbg.Stack())
+			}
+		}()
+		_, errs[i] = ctx.ParseTransaction(payload, positions[i], txs[i], senders[20*i:20*i+20], true /* hasEnvelope */, validateHash(i))
+	}
+	work := func(ctx *types.TxParseContext) {
+		for i := int(next.Inc() - 1); i < len(positions); i = int(next.Inc() - 1) {
+			txs[i] = &types.TxSlot{}
+			parseTx(ctx, i)
+		}
+	}
+	workers := cap(w.ctxs)
+	if workers > len(positions) {
+		workers = len(positions)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		ctx := <-w.ctxs
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { w.ctxs <- ctx }()
+			work(ctx)
+		}()
+	}
+	wg.Wait()
+	if knownErr != nil {
+		return knownErr
+	}
+
+	for i, txn := range txs {
+		if isKnown[i] {
+			continue
+		}
+		if errs[i] != nil {
+			return errs[i]
+		}
+		txSlots.Append(txn, senders[20*i:20*i+20], false)
+	}
+	return nil
+}
@@ -74,10 +74,42 @@ type Config struct {
 	BaseFeeSubPoolLimit int
 	QueuedSubPoolLimit  int
 
-	MinFeeCap     uint64
-	AccountSlots  uint64   // Number of executable transaction slots guaranteed per account
-	PriceBump     uint64   // Price bump percentage to replace an already existing transaction
-	TracedSenders []string // List of senders for which tx pool should print out debugging info
+	MinFeeCap       uint64
+	AccountSlots    uint64   // Number of executable transaction slots guaranteed per account
+	PriceBump       uint64   // Price bump percentage (of tip, and of fee cap if FeeCapPriceBump isn't set) to replace an already existing transaction
+	FeeCapPriceBump uint64   // Price bump percentage of fee cap to replace an already existing transaction, 0 - PriceBump is used
+	TracedSenders   []string // List of senders for which tx pool should print out debugging info
+	JournalDepth    uint64   // Number of blocks included local transactions are kept in the journal, to re-inject them on reorg
+	QueuedLifetime  uint64   // Number of blocks non-local transaction can stay in queued sub-pool, 0 - no limit
+
+	// Blob transactions (EIP-4844)
+	MinBlobFeeCap      uint64 // Minimal accepted max fee per blob gas of non-local transactions
+	MaxBlobsPerBlock   uint64 // Transactions with more blobs are rejected, Best doesn't return more blobs
+	BlobSlots          uint64 // Number of blob transaction slots per account
+	TotalBlobPoolLimit uint64 // Maximum number of blobs of all blob transactions in the pool
+	BlobPriceBump      uint64 // Price bump percentage of tip, fee cap and blob fee cap to replace blob transaction, 0 - PriceBump and FeeCapPriceBump are used
+
+	// Per-sender limits of non-local transactions, 0 - no limit. Overflow with the highest nonces is discarded
+	MaxPendingPerSender uint64 // Executable transactions (without nonce gaps) - in pending and baseFee sub-pools
+	MaxQueuedPerSender  uint64 // Transactions after nonce gap
+
+	// Denylist, applies to local transactions too. Rejected transactions are counted by pool_denied_txs metric
+	DeniedAddresses  []string // Senders and recipients (20 bytes, as TracedSenders) whose transactions are rejected
+	DeniedCodeHashes []string // Prefixes of code hashes (up to 32 bytes) of recipient contracts whose transactions are rejected
+
+	ChainConfig *chain.Config // Forks activating transaction types (see types.TxTypeActive), nil - all types are accepted
+}
+
+// replacementPriceBumps - price bump percentages of tip, fee cap and blob fee cap required to replace transaction
+func (cfg *Config) replacementPriceBumps(blob bool) (tip, feeCap, blobFeeCap uint64) {
+	tip, feeCap = cfg.PriceBump, cfg.FeeCapPriceBump
+	if feeCap == 0 {
+		feeCap = cfg.PriceBump
+	}
+	if blob && cfg.BlobPriceBump != 0 {
+		return cfg.BlobPriceBump, cfg.BlobPriceBump, cfg.BlobPriceBump
+	}
+	return tip, feeCap, feeCap
 }
 
 var DefaultConfig = Config{
@@ -90,9 +122,16 @@ var DefaultConfig = Config{
 	BaseFeeSubPoolLimit: 10_000,
 	QueuedSubPoolLimit:  10_000,
 
-	MinFeeCap:    1,
-	AccountSlots: 16, //TODO: to choose right value (16 to be compatible with Geth)
-	PriceBump:    10, // Price bump percentage to replace an already existing transaction
+	MinFeeCap:      1,
+	AccountSlots:   16, //TODO: to choose right value (16 to be compatible with Geth)
+	PriceBump:      10, // Price bump percentage to replace an already existing transaction
+	JournalDepth:   128,
+	QueuedLifetime: 900, // ~3 hours of 12s blocks, as lifetime of queued transactions in Geth
+
+	MinBlobFeeCap:      fixedgas.MinBlobGasPrice,
+	MaxBlobsPerBlock:   fixedgas.MaxBlobsPerBlock,
+	BlobSlots:          16,
+	TotalBlobPoolLimit: 480, // 480 blobs of 128KB - 60MB of sidecars
 }
 
 // Pool is interface for the transaction pool
@@ -100,6 +139,7 @@ var DefaultConfig = Config{
 // there are multiple implementations
 type Pool interface {
 	ValidateSerializedTxn(serializedTxn []byte) error
+	ChainConfig() *chain.Config
 
 	// Handle 3 main events - new remote txs from p2p, new local txs from RPC, new blocks from execution layer
 	AddRemoteTxs(ctx context.Context, newTxs types.TxSlots)
@@ -161,6 +201,14 @@ const (
 	InsufficientFunds   DiscardReason = 19
 	NotReplaced         DiscardReason = 20 // There was an existing transaction with the same sender and nonce, not enough price bump to replace
 	DuplicateHash       DiscardReason = 21 // There was an existing transaction with the same hash
+	NoBlobs             DiscardReason = 22 // Blob transaction without sidecar: blobs, commitments and proofs
+	TooManyBlobs        DiscardReason = 23 // Blob transaction has more blobs than allowed in a block
+	BlobPoolOverflow    DiscardReason = 24 // Pool already holds cfg.TotalBlobPoolLimit blobs
+	SenderPendingLimit  DiscardReason = 25 // Sender has more than cfg.MaxPendingPerSender executable transactions
+	SenderQueuedLimit   DiscardReason = 26 // Sender has more than cfg.MaxQueuedPerSender transactions after nonce gap
+	Denied              DiscardReason = 27 // Sender, recipient or code of recipient is in denylist: cfg.DeniedAddresses, cfg.DeniedCodeHashes
+	Expired             DiscardReason = 28 // Transaction stayed in queued sub-pool for more than cfg.QueuedLifetime blocks
+	TxTypeNotActive     DiscardReason = 29 // Fork activating transaction type hasn't happened yet, see cfg.ChainConfig
 )
 
 func (r DiscardReason) String() string {
@@ -209,6 +257,22 @@ func (r DiscardReason) String() string {
 		return "could not replace existing tx"
 	case DuplicateHash:
 		return "existing tx with same hash"
+	case NoBlobs:
+		return "blob transaction without blobs"
+	case TooManyBlobs:
+		return "too many blobs"
+	case BlobPoolOverflow:
+		return "blobs limit of the pool is reached"
+	case SenderPendingLimit:
+		return "sender's limit of executable transactions is reached"
+	case SenderQueuedLimit:
+		return "sender's limit of queued transactions is reached"
+	case Denied:
+		return "denied"
+	case Expired:
+		return "expired in queued sub-pool"
+	case TxTypeNotActive:
+		return "transaction type not supported"
 	default:
 		panic(fmt.Sprintf("discard reason: %d", r))
 	}
@@ -222,10 +286,14 @@ type metaTx struct {
 	cumulativeBalanceDistance uint64 // how far their cumulativeRequiredBalance are from the state's balance for the sender
 	minFeeCap                 uint64
 	minTip                    uint64
+	minBlobFeeCap             uint64 // min max fee per blob gas of the transaction and the sender's transactions with lower nonces
 	bestIndex                 int
 	worstIndex                int
 	currentSubPool            SubPoolType
-	timestamp                 uint64 // when it was added to pool
+	timestamp                 uint64        // when it was added to pool
+	queuedBlock               uint64        // when it was added to queued sub-pool, 0 if it's in another sub-pool
+	discardReason             DiscardReason // set when transaction is discarded, to update the journal of local transactions
+	notifiedSubPool           SubPoolType   // sub-pool of last published event of the transaction
 }
 
 func newMetaTx(slot *types.TxSlot, isLocal bool, timestmap uint64) *metaTx {
@@ -290,7 +358,9 @@ type TxPool struct {
 
 	started        atomic.Bool
 	lastSeenBlock  atomic.Uint64
+	lastSeenTime   atomic.Uint64 // time of the last seen block, forks after The Merge are scheduled by block time
 	pendingBaseFee atomic.Uint64
+	pendingBlobFee atomic.Uint64 // blob gas price of the pending block (EIP-4844)
 	blockGasLimit  atomic.Uint64
 
 	// batch processing of remote transactions
@@ -308,8 +378,15 @@ type TxPool struct {
 	isLocalLRU        *simplelru.LRU    // tx_hash => is_local : to restore isLocal flag of unwinded transactions
 	newPendingTxs     chan types.Hashes // notifications about new txs in Pending sub-pool
 	deletedTxs        []*metaTx         // list of discarded txs since last db commit
+	rejectedJournal   [][]byte          // hashes of journaled local txs which failed re-validation since last db commit
 	all               *BySenderAndNonce // senderID => (sorted map of tx nonce => *metaTx)
 	promoted          types.Hashes      // pre-allocated temporary buffer to write promoted to pending pool txn hashes
+	blobCount         int               // number of blobs of all blob transactions in the pool
+	txsSize           uint64            // total size of rlp of all transactions in the pool
+	events            *Events           // subscriptions to events of transactions
+	eventsBuf         []Event           // events of current pool operation, published on its end
+	movedTxs          []*metaTx         // txs added to sub-pools during current pool operation, if there are subscribers
+	denylist          *denylist         // cfg.DeniedAddresses, cfg.DeniedCodeHashes
 	_chainDB          kv.RoDB           // remote db - use it wisely
 	_stateCache       kvcache.Cache
 	cfg               Config
@@ -339,7 +416,7 @@ func New(newTxs chan types.Hashes, coreDB kv.RoDB, cfg Config, cache kvcache.Cac
 	for _, sender := range cfg.TracedSenders {
 		tracedSenders[sender] = struct{}{}
 	}
-	return &TxPool{
+	p := &TxPool{
 		lock:                    &sync.RWMutex{},
 		byHash:                  map[string]*metaTx{},
 		isLocalLRU:              localsHistory,
@@ -358,7 +435,11 @@ func New(newTxs chan types.Hashes, coreDB kv.RoDB, cfg Config, cache kvcache.Cac
 		unprocessedRemoteTxs:    &types.TxSlots{},
 		unprocessedRemoteByHash: map[string]int{},
 		promoted:                make(types.Hashes, 0, 32*1024),
-	}, nil
+		events:                  &Events{},
+		denylist:                newDenylist(cfg),
+	}
+	p.pending.moved, p.baseFee.moved, p.queued.moved = p.movedLocked, p.movedLocked, p.movedLocked
+	return p, nil
 }
 
 func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChangeBatch, unwindTxs, minedTxs types.TxSlots, tx kv.Tx) error {
@@ -375,8 +456,11 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	defer p.publishEventsLocked()
+	defer p.updateMetricsLocked()
 
 	p.lastSeenBlock.Store(stateChanges.ChangeBatch[len(stateChanges.ChangeBatch)-1].BlockHeight)
+	p.lastSeenTime.Store(stateChanges.ChangeBatch[len(stateChanges.ChangeBatch)-1].BlockTime)
 	if !p.started.Load() {
 		if err := p.fromDB(ctx, tx, coreTx); err != nil {
 			return fmt.Errorf("loading txs from DB: %w", err)
@@ -399,24 +483,33 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 	baseFee := stateChanges.PendingBlockBaseFee
 
 	pendingBaseFee, baseFeeChanged := p.setBaseFee(baseFee)
+	pendingBlobFee := p.pendingBlobFee.Load()
 	// Update pendingBase for all pool queues and slices
 	if baseFeeChanged {
-		p.pending.best.pendingBaseFee = pendingBaseFee
-		p.pending.worst.pendingBaseFee = pendingBaseFee
-		p.baseFee.best.pendingBastFee = pendingBaseFee
-		p.baseFee.worst.pendingBaseFee = pendingBaseFee
-		p.queued.best.pendingBastFee = pendingBaseFee
-		p.queued.worst.pendingBaseFee = pendingBaseFee
+		p.setQueuesFees(pendingBaseFee, pendingBlobFee)
 	}
 
 	p.blockGasLimit.Store(stateChanges.BlockGasLimit)
+	if unwindTxs, err = p.withJournalTxs(tx, stateChanges, unwindTxs); err != nil {
+		return err
+	}
+	unwindTxs = withoutMinedTxs(unwindTxs, minedTxs)
 	if err := p.senders.onNewBlock(stateChanges, unwindTxs, minedTxs); err != nil {
 		return err
 	}
-	_, unwindTxs, err = p.validateTxs(&unwindTxs, cacheView)
+	reasons, goodUnwindTxs, err := p.validateTxs(&unwindTxs, cacheView)
 	if err != nil {
 		return err
 	}
+	for i, reason := range reasons {
+		if reason != NotSet && unwindTxs.IsLocal[i] {
+			p.rejectJournaled(unwindTxs.Txs[i], reason)
+		}
+	}
+	unwindTxs = goodUnwindTxs
+	for _, txn := range unwindTxs.Txs { // re-injected txs are not mined anymore
+		p.discardReasonsLRU.Remove(string(txn.IDHash[:]))
+	}
 
 	if ASSERT {
 		for _, txn := range unwindTxs.Txs {
@@ -440,14 +533,15 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 	p.pending.resetAddedHashes()
 	p.baseFee.resetAddedHashes()
 	if err := addTxsOnNewBlock(p.lastSeenBlock.Load(), cacheView, stateChanges, p.senders, unwindTxs,
-		pendingBaseFee, stateChanges.BlockGasLimit,
+		pendingBaseFee, stateChanges.BlockGasLimit, p.cfg.MaxPendingPerSender, p.cfg.MaxQueuedPerSender,
 		p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err != nil {
 		return err
 	}
 	p.pending.EnforceWorstInvariants()
 	p.baseFee.EnforceInvariants()
 	p.queued.EnforceInvariants()
-	promote(p.pending, p.baseFee, p.queued, pendingBaseFee, p.discardLocked)
+	promote(p.pending, p.baseFee, p.queued, pendingBaseFee, pendingBlobFee, p.discardLocked)
+	p.evictExpiredLocked()
 	p.pending.EnforceBestInvariants()
 	p.promoted = p.pending.appendAddedHashes(p.promoted[:0])
 	p.promoted = p.baseFee.appendAddedHashes(p.promoted)
@@ -467,6 +561,44 @@ func (p *TxPool) OnNewBlock(ctx context.Context, stateChanges *remote.StateChang
 	return nil
 }
 
+// SetPendingBlobFee sets blob gas price of the pending block (EIP-4844). Blob transactions with lower max fee per
+// blob gas (and transactions of the same sender with higher nonces) are not included into pending sub-pool
+func (p *TxPool) SetPendingBlobFee(blobFee uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	defer p.publishEventsLocked()
+	defer p.updateMetricsLocked()
+	p.pendingBlobFee.Store(blobFee)
+	pendingBaseFee := p.pendingBaseFee.Load()
+	p.setQueuesFees(pendingBaseFee, blobFee)
+
+	p.pending.resetAddedHashes()
+	p.baseFee.resetAddedHashes()
+	p.pending.EnforceWorstInvariants()
+	p.baseFee.EnforceInvariants()
+	p.queued.EnforceInvariants()
+	promote(p.pending, p.baseFee, p.queued, pendingBaseFee, blobFee, p.discardLocked)
+	p.pending.EnforceBestInvariants()
+	p.promoted = p.pending.appendAddedHashes(p.promoted[:0])
+	p.promoted = p.baseFee.appendAddedHashes(p.promoted)
+	if p.promoted.Len() > 0 {
+		select {
+		case p.newPendingTxs <- common.Copy(p.promoted):
+		default:
+		}
+	}
+}
+
+// setQueuesFees updates fees of the pending block in all pool queues and slices, invariants must be enforced after it
+func (p *TxPool) setQueuesFees(pendingBaseFee, pendingBlobFee uint64) {
+	p.pending.best.pendingBaseFee, p.pending.best.pendingBlobFee = pendingBaseFee, pendingBlobFee
+	p.pending.worst.pendingBaseFee, p.pending.worst.pendingBlobFee = pendingBaseFee, pendingBlobFee
+	p.baseFee.best.pendingBastFee, p.baseFee.best.pendingBlobFee = pendingBaseFee, pendingBlobFee
+	p.baseFee.worst.pendingBaseFee, p.baseFee.worst.pendingBlobFee = pendingBaseFee, pendingBlobFee
+	p.queued.best.pendingBastFee, p.queued.best.pendingBlobFee = pendingBaseFee, pendingBlobFee
+	p.queued.worst.pendingBaseFee, p.queued.worst.pendingBlobFee = pendingBaseFee, pendingBlobFee
+}
+
 func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 	if !p.started.Load() {
 		return fmt.Errorf("txpool not started yet")
@@ -487,6 +619,8 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 	//t := time.Now()
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	defer p.publishEventsLocked()
+	defer p.updateMetricsLocked()
 
 	l := len(p.unprocessedRemoteTxs.Txs)
 	if l == 0 {
@@ -506,7 +640,7 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 	p.pending.resetAddedHashes()
 	p.baseFee.resetAddedHashes()
 	if _, err := addTxs(p.lastSeenBlock.Load(), cacheView, p.senders, newTxs,
-		p.pendingBaseFee.Load(), p.blockGasLimit.Load(), p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err != nil {
+		p.pendingBaseFee.Load(), p.pendingBlobFee.Load(), p.blockGasLimit.Load(), p.cfg.MaxPendingPerSender, p.cfg.MaxQueuedPerSender, p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err != nil {
 		return err
 	}
 	p.promoted = p.pending.appendAddedHashes(p.promoted[:0])
@@ -597,11 +731,18 @@ func (p *TxPool) IsLocal(idHash []byte) bool {
 	defer p.lock.RUnlock()
 	return p.isLocalLRU.Contains(string(idHash))
 }
+func (p *TxPool) isBlob(idHash []byte) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	mt, ok := p.byHash[string(idHash)]
+	return ok && mt.Tx.BlobHashes.Len() > 0
+}
 func (p *TxPool) AddNewGoodPeer(peerID types.PeerID) { p.recentlyConnectedPeers.AddPeer(peerID) }
 func (p *TxPool) Started() bool                      { return p.started.Load() }
 
 // Best - returns top `n` elements of pending queue
 // id doesn't perform full copy of txs, hovewer underlying elements are immutable
+// Blob transactions are returned in network form (with blobs), no more than cfg.MaxBlobsPerBlock blobs in total
 func (p *TxPool) Best(n uint16, txs *types.TxsRlp, tx kv.Tx) error {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
@@ -610,12 +751,18 @@ func (p *TxPool) Best(n uint16, txs *types.TxsRlp, tx kv.Tx) error {
 
 	best := p.pending.best
 	j := 0
+	var blobs uint64
 	for i := 0; j < int(n) && i < len(best.ms); i++ {
 		mt := best.ms[i]
 		if mt.Tx.Gas >= p.blockGasLimit.Load() {
 			// Skip transactions with very large gas limit
 			continue
 		}
+		txBlobs := uint64(mt.Tx.BlobHashes.Len())
+		if blobs+txBlobs > p.cfg.MaxBlobsPerBlock {
+			// Skip blob transactions which don't fit into the block
+			continue
+		}
 		rlpTx, sender, isLocal, err := p.getRlpLocked(tx, mt.Tx.IDHash[:])
 		if err != nil {
 			return err
@@ -627,6 +774,7 @@ func (p *TxPool) Best(n uint16, txs *types.TxsRlp, tx kv.Tx) error {
 		txs.Txs[j] = rlpTx
 		copy(txs.Senders.At(j), sender)
 		txs.IsLocal[j] = isLocal
+		blobs += txBlobs
 		j++
 	}
 	txs.Resize(uint(j))
@@ -652,6 +800,13 @@ func (p *TxPool) AddRemoteTxs(_ context.Context, newTxs types.TxSlots) {
 }
 
 func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.CacheView) DiscardReason {
+	// Transactions are validated for the pending block, which is later than the last seen block
+	if !types.TxTypeActive(p.cfg.ChainConfig, txn.Type, p.lastSeenBlock.Load()+1, p.lastSeenTime.Load()+1) {
+		if txn.Traced {
+			log.Info(fmt.Sprintf("TX TRACING: validateTx type not active idHash=%x type=%d", txn.IDHash, txn.Type))
+		}
+		return TxTypeNotActive
+	}
 	// Drop non-local transactions under our own minimal accepted gas price or tip
 	if !isLocal && txn.FeeCap < p.cfg.MinFeeCap {
 		if txn.Traced {
@@ -659,6 +814,40 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 		}
 		return UnderPriced
 	}
+	if blobs := uint64(txn.BlobHashes.Len()); blobs > 0 {
+		// Blobs are needed to propagate the transaction and to include it into a block. Blob transactions from
+		// unwound blocks come without blobs and are dropped
+		if !txn.BlobSidecar {
+			if txn.Traced {
+				log.Info(fmt.Sprintf("TX TRACING: validateTx blob tx without sidecar idHash=%x", txn.IDHash))
+			}
+			return NoBlobs
+		}
+		if blobs > p.cfg.MaxBlobsPerBlock {
+			if txn.Traced {
+				log.Info(fmt.Sprintf("TX TRACING: validateTx too many blobs idHash=%x blobs=%d, cfg.MaxBlobsPerBlock=%d", txn.IDHash, blobs, p.cfg.MaxBlobsPerBlock))
+			}
+			return TooManyBlobs
+		}
+		if !isLocal && txn.BlobFeeCap < p.cfg.MinBlobFeeCap {
+			if txn.Traced {
+				log.Info(fmt.Sprintf("TX TRACING: validateTx blob underpriced idHash=%x blobFeeCap=%d, cfg.MinBlobFeeCap=%d", txn.IDHash, txn.BlobFeeCap, p.cfg.MinBlobFeeCap))
+			}
+			return UnderPriced
+		}
+		if !isLocal && p.blobTxsCount(txn.SenderID) > p.cfg.BlobSlots {
+			if txn.Traced {
+				log.Info(fmt.Sprintf("TX TRACING: validateTx marked as spamming idHash=%x blob slots limit=%d", txn.IDHash, p.cfg.BlobSlots))
+			}
+			return Spammer
+		}
+	}
+	if reason := p.denylist.check(txn, p.senders.senderID2Addr[txn.SenderID], stateCache); reason != Success {
+		if txn.Traced {
+			log.Info(fmt.Sprintf("TX TRACING: validateTx denied idHash=%x to=%x", txn.IDHash, txn.To))
+		}
+		return reason
+	}
 	gas, reason := CalcIntrinsicGas(uint64(txn.DataLen), uint64(txn.DataNonZeroLen), nil, txn.Creation, true, true)
 	if txn.Traced {
 		log.Info(fmt.Sprintf("TX TRACING: validateTx intrinsic gas idHash=%x gas=%d", txn.IDHash, gas))
@@ -669,6 +858,7 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 		}
 		return reason
 	}
+	gas += types.TxTypeIntrinsicGas(txn)
 	if gas > txn.Gas {
 		if txn.Traced {
 			log.Info(fmt.Sprintf("TX TRACING: validateTx intrinsic gas > txn.gas idHash=%x gas=%d, txn.gas=%d", txn.IDHash, gas, txn.Gas))
@@ -694,6 +884,7 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 	total := uint256.NewInt(txn.Gas)
 	total.Mul(total, uint256.NewInt(txn.FeeCap))
 	total.Add(total, &txn.Value)
+	addBlobGasCost(total, txn)
 	if senderBalance.Cmp(total) < 0 {
 		if txn.Traced {
 			log.Info(fmt.Sprintf("TX TRACING: validateTx insufficient funds idHash=%x balance in state=%d, txn.gas*txn.tip=%d", txn.IDHash, senderBalance, total))
@@ -703,6 +894,26 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 	return Success
 }
 
+// blobTxsCount - number of sender's blob transactions in the pool
+func (p *TxPool) blobTxsCount(senderID uint64) (count uint64) {
+	p.all.ascend(senderID, func(mt *metaTx) bool {
+		if mt.Tx.BlobHashes.Len() > 0 {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// addBlobGasCost adds maximal cost of blob gas of blob transaction to total
+func addBlobGasCost(total *uint256.Int, txn *types.TxSlot) {
+	if blobs := txn.BlobHashes.Len(); blobs > 0 {
+		cost := uint256.NewInt(uint64(blobs) * fixedgas.BlobGasPerBlob)
+		cost.Mul(cost, uint256.NewInt(txn.BlobFeeCap))
+		total.Add(total, cost)
+	}
+}
+
 func (p *TxPool) ValidateSerializedTxn(serializedTxn []byte) error {
 	const (
 		// txSlotSize is used to calculate how many data slots a single transaction
@@ -716,15 +927,28 @@ func (p *TxPool) ValidateSerializedTxn(serializedTxn []byte) error {
 		// more expensive to propagate; larger transactions also take more resources
 		// to validate whether they fit into the pool or not.
 		txMaxSize = 4 * txSlotSize // 128KB
+
+		// blobSidecarSize is the maximal size of sidecar of each blob of blob transaction in network form,
+		// including rlp prefixes of blob, commitment and proof
+		blobSidecarSize = types.BlobSize + types.KzgCommitmentSize + types.KzgProofSize + 16
 	)
-	if len(serializedTxn) > txMaxSize {
+	maxSize := txMaxSize
+	if len(serializedTxn) > 0 && int(serializedTxn[0]) == types.BlobTxType {
+		maxSize += int(p.cfg.MaxBlobsPerBlock) * blobSidecarSize
+	}
+	if len(serializedTxn) > maxSize {
 		return fmt.Errorf(RLPTooLong.String())
 	}
 	return nil
 }
+
+// ChainConfig - config which parse contexts of pool's transactions use, nil - not known
+func (p *TxPool) ChainConfig() *chain.Config { return p.cfg.ChainConfig }
+
 func (p *TxPool) validateTxs(txs *types.TxSlots, stateCache kvcache.CacheView) (reasons []DiscardReason, goodTxs types.TxSlots, err error) {
 	// reasons is pre-sized for direct indexing, with the default zero
 	// value DiscardReason of NotSet
+	defer validateTxsTimer.UpdateDuration(time.Now())
 	reasons = make([]DiscardReason, len(txs.Txs))
 
 	if err := txs.Valid(); err != nil {
@@ -742,6 +966,7 @@ func (p *TxPool) validateTxs(txs *types.TxSlots, stateCache kvcache.CacheView) (
 		if reason == Spammer {
 			p.punishSpammer(txn.SenderID)
 		}
+		rejectedTxsCounter(reason).Inc()
 		reasons[i] = reason
 	}
 
@@ -804,6 +1029,8 @@ func (p *TxPool) AddLocalTxs(ctx context.Context, newTransactions types.TxSlots,
 
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	defer p.publishEventsLocked()
+	defer p.updateMetricsLocked()
 
 	if !p.Started() {
 		if err := p.fromDB(ctx, tx, coreTx); err != nil {
@@ -826,7 +1053,7 @@ func (p *TxPool) AddLocalTxs(ctx context.Context, newTransactions types.TxSlots,
 	p.pending.resetAddedHashes()
 	p.baseFee.resetAddedHashes()
 	if addReasons, err := addTxs(p.lastSeenBlock.Load(), cacheView, p.senders, newTxs,
-		p.pendingBaseFee.Load(), p.blockGasLimit.Load(), p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err == nil {
+		p.pendingBaseFee.Load(), p.pendingBlobFee.Load(), p.blockGasLimit.Load(), p.cfg.MaxPendingPerSender, p.cfg.MaxQueuedPerSender, p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err == nil {
 		for i, reason := range addReasons {
 			if reason != NotSet {
 				reasons[i] = reason
@@ -870,7 +1097,7 @@ func (p *TxPool) cache() kvcache.Cache {
 }
 
 func addTxs(blockNum uint64, cacheView kvcache.CacheView, senders *sendersBatch,
-	newTxs types.TxSlots, pendingBaseFee, blockGasLimit uint64,
+	newTxs types.TxSlots, pendingBaseFee, pendingBlobFee, blockGasLimit, maxPendingPerSender, maxQueuedPerSender uint64,
 	pending *PendingPool, baseFee, queued *SubPool,
 	byNonce *BySenderAndNonce, byHash map[string]*metaTx, add func(*metaTx) DiscardReason, discard func(*metaTx, DiscardReason)) ([]DiscardReason, error) {
 	protocolBaseFee := calcProtocolBaseFee(pendingBaseFee)
@@ -929,16 +1156,37 @@ func addTxs(blockNum uint64, cacheView kvcache.CacheView, senders *sendersBatch,
 			return discardReasons, err
 		}
 		onSenderStateChange(senderID, nonce, balance, byNonce,
-			protocolBaseFee, blockGasLimit, pending, baseFee, queued, discard)
+			protocolBaseFee, blockGasLimit, maxPendingPerSender, maxQueuedPerSender, pending, baseFee, queued, discard)
 	}
 
-	promote(pending, baseFee, queued, pendingBaseFee, discard)
+	promote(pending, baseFee, queued, pendingBaseFee, pendingBlobFee, discard)
 	pending.EnforceBestInvariants()
 
 	return discardReasons, nil
 }
+
+// withoutMinedTxs - transactions of abandoned blocks which are included into new blocks of the same reorg are not
+// re-injected
+func withoutMinedTxs(unwindTxs, minedTxs types.TxSlots) types.TxSlots {
+	if len(unwindTxs.Txs) == 0 || len(minedTxs.Txs) == 0 {
+		return unwindTxs
+	}
+	mined := make(map[string]struct{}, len(minedTxs.Txs))
+	for _, txn := range minedTxs.Txs {
+		mined[string(txn.IDHash[:])] = struct{}{}
+	}
+	txs := types.TxSlots{}
+	for i, txn := range unwindTxs.Txs {
+		if _, ok := mined[string(txn.IDHash[:])]; ok {
+			continue
+		}
+		txs.Append(txn, unwindTxs.Senders.At(i), unwindTxs.IsLocal[i])
+	}
+	return txs
+}
+
 func addTxsOnNewBlock(blockNum uint64, cacheView kvcache.CacheView, stateChanges *remote.StateChangeBatch,
-	senders *sendersBatch, newTxs types.TxSlots, pendingBaseFee uint64, blockGasLimit uint64,
+	senders *sendersBatch, newTxs types.TxSlots, pendingBaseFee uint64, blockGasLimit, maxPendingPerSender, maxQueuedPerSender uint64,
 	pending *PendingPool, baseFee, queued *SubPool,
 	byNonce *BySenderAndNonce, byHash map[string]*metaTx, add func(*metaTx) DiscardReason, discard func(*metaTx, DiscardReason)) error {
 	protocolBaseFee := calcProtocolBaseFee(pendingBaseFee)
@@ -994,7 +1242,7 @@ func addTxsOnNewBlock(blockNum uint64, cacheView kvcache.CacheView, stateChanges
 			return err
 		}
 		onSenderStateChange(senderID, nonce, balance, byNonce,
-			protocolBaseFee, blockGasLimit, pending, baseFee, queued, discard)
+			protocolBaseFee, blockGasLimit, maxPendingPerSender, maxQueuedPerSender, pending, baseFee, queued, discard)
 	}
 
 	return nil
@@ -1012,12 +1260,17 @@ func (p *TxPool) setBaseFee(baseFee uint64) (uint64, bool) {
 func (p *TxPool) addLocked(mt *metaTx) DiscardReason {
 	// Insert to pending pool, if pool doesn't have txn with same Nonce and bigger Tip
 	found := p.all.get(mt.Tx.SenderID, mt.Tx.Nonce)
+	blobs := mt.Tx.BlobHashes.Len()
 	if found != nil {
+		tipBump, feeCapBump, blobFeeCapBump := p.cfg.replacementPriceBumps(found.Tx.BlobHashes.Len() > 0)
 		tipThreshold := uint256.NewInt(0)
-		tipThreshold = tipThreshold.Mul(&found.Tx.Tip, uint256.NewInt(100+p.cfg.PriceBump))
+		tipThreshold = tipThreshold.Mul(&found.Tx.Tip, uint256.NewInt(100+tipBump))
 		tipThreshold.Div(tipThreshold, u256.N100)
-		feecapThreshold := found.Tx.FeeCap * (100 + p.cfg.PriceBump) / 100
-		if mt.Tx.Tip.Cmp(tipThreshold) < 0 || mt.Tx.FeeCap < feecapThreshold {
+		feecapThreshold := found.Tx.FeeCap * (100 + feeCapBump) / 100
+		blobFeeCapThreshold := found.Tx.BlobFeeCap * (100 + blobFeeCapBump) / 100
+		// Blob transaction can be replaced only by blob transaction, and non-blob only by non-blob one
+		sameKind := (blobs > 0) == (found.Tx.BlobHashes.Len() > 0)
+		if mt.Tx.Tip.Cmp(tipThreshold) < 0 || mt.Tx.FeeCap < feecapThreshold || mt.Tx.BlobFeeCap < blobFeeCapThreshold || !sameKind {
 			// Both tip and feecap need to be larger than previously to replace the transaction
 			// In case if the transation is stuck, "poke" it to rebroadcast
 			// TODO refactor to return the list of promoted hashes instead of using added inside the pool
@@ -1033,8 +1286,13 @@ func (p *TxPool) addLocked(mt *metaTx) DiscardReason {
 					}
 				}
 			}
+			rejectedTxsCounter(NotReplaced).Inc()
 			return NotReplaced
 		}
+		if blobs > 0 && uint64(p.blobCount+blobs-found.Tx.BlobHashes.Len()) > p.cfg.TotalBlobPoolLimit {
+			rejectedTxsCounter(BlobPoolOverflow).Inc()
+			return BlobPoolOverflow
+		}
 
 		switch found.currentSubPool {
 		case PendingSubPool:
@@ -1047,10 +1305,17 @@ func (p *TxPool) addLocked(mt *metaTx) DiscardReason {
 			//already removed
 		}
 
+		p.addEventLocked(EventReplaced, found, mt, ReplacedByHigherTip)
 		p.discardLocked(found, ReplacedByHigherTip)
+	} else if blobs > 0 && uint64(p.blobCount+blobs) > p.cfg.TotalBlobPoolLimit {
+		rejectedTxsCounter(BlobPoolOverflow).Inc()
+		return BlobPoolOverflow
 	}
 
 	p.byHash[string(mt.Tx.IDHash[:])] = mt
+	p.blobCount += blobs
+	p.txsSize += uint64(mt.Tx.Size)
+	addedTxsCounter.Inc()
 
 	if replaced := p.all.replaceOrInsert(mt); replaced != nil {
 		if ASSERT {
@@ -1066,10 +1331,39 @@ func (p *TxPool) addLocked(mt *metaTx) DiscardReason {
 	return NotSet
 }
 
+// evictExpiredLocked discards non-local transactions stayed in queued sub-pool (with nonce gap, or not affordable)
+// for more than cfg.QueuedLifetime blocks
+func (p *TxPool) evictExpiredLocked() {
+	if p.cfg.QueuedLifetime == 0 {
+		return
+	}
+	lastSeenBlock := p.lastSeenBlock.Load()
+	var expired []*metaTx
+	for _, mt := range p.queued.best.ms {
+		if mt.subPool&IsLocal == 0 && mt.queuedBlock+p.cfg.QueuedLifetime < lastSeenBlock {
+			expired = append(expired, mt)
+		}
+	}
+	for _, mt := range expired {
+		if mt.Tx.Traced {
+			log.Info(fmt.Sprintf("TX TRACING: evictExpired idHash=%x queuedBlock=%d", mt.Tx.IDHash, mt.queuedBlock))
+		}
+		p.queued.Remove(mt)
+		p.discardLocked(mt, Expired)
+	}
+}
+
 // dropping transaction from all sub-structures and from db
 // Important: don't call it while iterating by all
 func (p *TxPool) discardLocked(mt *metaTx, reason DiscardReason) {
+	if found, ok := p.byHash[string(mt.Tx.IDHash[:])]; ok && found == mt {
+		p.blobCount -= mt.Tx.BlobHashes.Len()
+		p.txsSize -= uint64(mt.Tx.Size)
+		discardedTxsCounter(reason).Inc()
+		p.discardEventLocked(mt, reason)
+	}
 	delete(p.byHash, string(mt.Tx.IDHash[:]))
+	mt.discardReason = reason
 	p.deletedTxs = append(p.deletedTxs, mt)
 	p.all.delete(mt)
 	p.discardReasonsLRU.Add(string(mt.Tx.IDHash[:]), reason)
@@ -1085,6 +1379,53 @@ func (p *TxPool) NonceFromAddress(addr [20]byte) (nonce uint64, inPool bool) {
 	return p.all.nonce(senderID)
 }
 
+// SenderTx - transaction of sender, returned by ContentFrom
+type SenderTx struct {
+	SubPool    SubPoolType
+	IDHash     [32]byte
+	Nonce      uint64
+	Tip        uint256.Int
+	FeeCap     uint64
+	Gas        uint64
+	Value      uint256.Int
+	BlobFeeCap uint64
+	Rlp        []byte
+}
+
+// ContentFrom - transactions of sender in all sub-pools, ordered by nonce
+func (p *TxPool) ContentFrom(tx kv.Tx, addr [20]byte) ([]SenderTx, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	senderID, found := p.senders.getID(addr[:])
+	if !found {
+		return nil, nil
+	}
+	var res []SenderTx
+	var err error
+	p.all.ascend(senderID, func(mt *metaTx) bool {
+		var rlpTxn []byte
+		if rlpTxn, _, _, err = p.getRlpLocked(tx, mt.Tx.IDHash[:]); err != nil {
+			return false
+		}
+		res = append(res, SenderTx{
+			SubPool:    mt.currentSubPool,
+			IDHash:     mt.Tx.IDHash,
+			Nonce:      mt.Tx.Nonce,
+			Tip:        mt.Tx.Tip,
+			FeeCap:     mt.Tx.FeeCap,
+			Gas:        mt.Tx.Gas,
+			Value:      mt.Tx.Value,
+			BlobFeeCap: mt.Tx.BlobFeeCap,
+			Rlp:        common.Copy(rlpTxn),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 // removeMined - apply new highest block (or batch of blocks)
 //
 // 1. New best block arrives, which potentially changes the balance and the nonce of some senders.
@@ -1143,12 +1484,27 @@ func removeMined(byNonce *BySenderAndNonce, minedTxs []*types.TxSlot, pending *P
 // nonces, and also affect other transactions from the same sender with higher nonce, it loops through all transactions
 // for a given senderID
 func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint256.Int, byNonce *BySenderAndNonce,
-	protocolBaseFee, blockGasLimit uint64, pending *PendingPool, baseFee, queued *SubPool, discard func(*metaTx, DiscardReason)) {
+	protocolBaseFee, blockGasLimit, maxPendingPerSender, maxQueuedPerSender uint64, pending *PendingPool, baseFee, queued *SubPool, discard func(*metaTx, DiscardReason)) {
 	noGapsNonce := senderNonce
 	cumulativeRequiredBalance := uint256.NewInt(0)
 	minFeeCap := uint64(math.MaxUint64)
 	minTip := uint64(math.MaxUint64)
-	var toDel []*metaTx // can't delete items while iterate them
+	minBlobFeeCap := uint64(math.MaxUint64)
+	var pendingCount, queuedCount uint64 // non-local transactions
+	var toDel []*metaTx                  // can't delete items while iterate them
+	var toDelReasons []DiscardReason
+	removeFromSubPool := func(mt *metaTx) {
+		switch mt.currentSubPool {
+		case PendingSubPool:
+			pending.Remove(mt)
+		case BaseFeeSubPool:
+			baseFee.Remove(mt)
+		case QueuedSubPool:
+			queued.Remove(mt)
+		default:
+			//already removed
+		}
+	}
 	byNonce.ascend(senderID, func(mt *metaTx) bool {
 		if mt.Tx.Traced {
 			log.Info(fmt.Sprintf("TX TRACING: onSenderStateChange loop iteration idHash=%x senderID=%d, senderNonce=%d, txn.nonce=%d, currentSubPool=%s", mt.Tx.IDHash, senderID, senderNonce, mt.Tx.Nonce, mt.currentSubPool))
@@ -1158,17 +1514,8 @@ func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint
 				log.Info(fmt.Sprintf("TX TRACING: removing due to low nonce for idHash=%x senderID=%d, senderNonce=%d, txn.nonce=%d, currentSubPool=%s", mt.Tx.IDHash, senderID, senderNonce, mt.Tx.Nonce, mt.currentSubPool))
 			}
 			// del from sub-pool
-			switch mt.currentSubPool {
-			case PendingSubPool:
-				pending.Remove(mt)
-			case BaseFeeSubPool:
-				baseFee.Remove(mt)
-			case QueuedSubPool:
-				queued.Remove(mt)
-			default:
-				//already removed
-			}
-			toDel = append(toDel, mt)
+			removeFromSubPool(mt)
+			toDel, toDelReasons = append(toDel, mt), append(toDelReasons, NonceTooLow)
 			return true
 		}
 		minFeeCap = cmp.Min(minFeeCap, mt.Tx.FeeCap)
@@ -1177,6 +1524,10 @@ func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint
 			minTip = cmp.Min(minTip, mt.Tx.Tip.Uint64())
 		}
 		mt.minTip = minTip
+		if mt.Tx.BlobHashes.Len() > 0 {
+			minBlobFeeCap = cmp.Min(minBlobFeeCap, mt.Tx.BlobFeeCap)
+		}
+		mt.minBlobFeeCap = minBlobFeeCap
 
 		mt.nonceDistance = 0
 		if mt.Tx.Nonce > senderNonce { // no uint underflow
@@ -1187,6 +1538,7 @@ func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint
 		needBalance := uint256.NewInt(mt.Tx.Gas)
 		needBalance.Mul(needBalance, uint256.NewInt(mt.Tx.FeeCap))
 		needBalance.Add(needBalance, &mt.Tx.Value)
+		addBlobGasCost(needBalance, mt.Tx)
 		// 1. Minimum fee requirement. Set to 1 if feeCap of the transaction is no less than in-protocol
 		// parameter of minimal base fee. Set to 0 if feeCap is less than minimum base fee, which means
 		// this transaction will never be included into this particular chain.
@@ -1206,6 +1558,21 @@ func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint
 			mt.subPool |= NoNonceGaps
 			noGapsNonce++
 		}
+		if mt.subPool&IsLocal == 0 {
+			var overflow DiscardReason
+			if mt.subPool&NoNonceGaps != 0 {
+				if pendingCount++; maxPendingPerSender > 0 && pendingCount > maxPendingPerSender {
+					overflow = SenderPendingLimit
+				}
+			} else if queuedCount++; maxQueuedPerSender > 0 && queuedCount > maxQueuedPerSender {
+				overflow = SenderQueuedLimit
+			}
+			if overflow != NotSet {
+				removeFromSubPool(mt)
+				toDel, toDelReasons = append(toDel, mt), append(toDelReasons, overflow)
+				return true
+			}
+		}
 
 		// 3. Sufficient balance for gas. Set to 1 if the balance of sender's account in the
 		// state is B, nonce of the sender in the state is M, nonce of the transaction is N, and the
@@ -1246,16 +1613,16 @@ func onSenderStateChange(senderID uint64, senderNonce uint64, senderBalance uint
 		}
 		return true
 	})
-	for _, mt := range toDel {
-		discard(mt, NonceTooLow)
+	for i, mt := range toDel {
+		discard(mt, toDelReasons[i])
 	}
 }
 
 // promote reasserts invariants of the subpool and returns the list of transactions that ended up
 // being promoted to the pending or basefee pool, for re-broadcasting
-func promote(pending *PendingPool, baseFee, queued *SubPool, pendingBaseFee uint64, discard func(*metaTx, DiscardReason)) {
+func promote(pending *PendingPool, baseFee, queued *SubPool, pendingBaseFee, pendingBlobFee uint64, discard func(*metaTx, DiscardReason)) {
 	// Demote worst transactions that do not qualify for pending sub pool anymore, to other sub pools, or discard
-	for worst := pending.Worst(); pending.Len() > 0 && (worst.subPool < BaseFeePoolBits || worst.minFeeCap < pendingBaseFee); worst = pending.Worst() {
+	for worst := pending.Worst(); pending.Len() > 0 && (worst.subPool < BaseFeePoolBits || !worst.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee)); worst = pending.Worst() {
 		if worst.subPool >= BaseFeePoolBits {
 			baseFee.Add(pending.PopWorst())
 		} else if worst.subPool >= QueuedPoolBits {
@@ -1266,7 +1633,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, pendingBaseFee uint
 	}
 
 	// Promote best transactions from base fee pool to pending pool while they qualify
-	for best := baseFee.Best(); baseFee.Len() > 0 && best.subPool >= BaseFeePoolBits && best.minFeeCap >= pendingBaseFee; best = baseFee.Best() {
+	for best := baseFee.Best(); baseFee.Len() > 0 && best.subPool >= BaseFeePoolBits && best.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee); best = baseFee.Best() {
 		pending.Add(baseFee.PopBest())
 	}
 
@@ -1281,7 +1648,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, pendingBaseFee uint
 
 	// Promote best transactions from the queued pool to either pending or base fee pool, while they qualify
 	for best := queued.Best(); queued.Len() > 0 && best.subPool >= BaseFeePoolBits; best = queued.Best() {
-		if best.minFeeCap >= pendingBaseFee {
+		if best.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee) {
 			pending.Add(queued.PopBest())
 		} else {
 			baseFee.Add(queued.PopBest())
@@ -1379,6 +1746,7 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 
 				var localTxHashes types.Hashes
 				var localTxRlps [][]byte
+				var localTxBlob []bool
 				var remoteTxHashes types.Hashes
 				var remoteTxRlps [][]byte
 				slotsRlp := make([][]byte, 0, h.Len())
@@ -1396,12 +1764,19 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 
 						// Empty rlp can happen if a transaction we want to broadcase has just been mined, for example
 						slotsRlp = append(slotsRlp, slotRlp)
+						// Blob transactions are too large to be broadcast, they are only announced (EIP-4844)
+						isBlob := p.isBlob(hash)
 						if p.IsLocal(hash) {
 							localTxHashes = append(localTxHashes, hash...)
-							localTxRlps = append(localTxRlps, slotRlp)
+							localTxBlob = append(localTxBlob, isBlob)
+							if !isBlob {
+								localTxRlps = append(localTxRlps, slotRlp)
+							}
 						} else {
 							remoteTxHashes = append(localTxHashes, hash...)
-							remoteTxRlps = append(remoteTxRlps, slotRlp)
+							if !isBlob {
+								remoteTxRlps = append(remoteTxRlps, slotRlp)
+							}
 						}
 					}
 					return nil
@@ -1416,12 +1791,19 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 				// first broadcast all local txs to all peers, then non-local to random sqrt(peersAmount) peers
 				txSentTo := send.BroadcastPooledTxs(localTxRlps)
 				hashSentTo := send.AnnouncePooledTxs(localTxHashes)
-				for i := 0; i < localTxHashes.Len(); i++ {
+				for i, j := 0, 0; i < localTxHashes.Len(); i++ {
 					hash := localTxHashes.At(i)
-					log.Info("local tx propagated", "tx_hash", fmt.Sprintf("%x", hash), "announced to peers", hashSentTo[i], "broadcast to peers", txSentTo[i], "baseFee", p.pendingBaseFee.Load())
+					var broadcastTo int
+					if !localTxBlob[i] {
+						broadcastTo = txSentTo[j]
+						j++
+					}
+					log.Info("local tx propagated", "tx_hash", fmt.Sprintf("%x", hash), "announced to peers", hashSentTo[i], "broadcast to peers", broadcastTo, "baseFee", p.pendingBaseFee.Load())
 				}
 				send.BroadcastPooledTxs(remoteTxRlps)
 				send.AnnouncePooledTxs(remoteTxHashes)
+				broadcastTxsCounter.Add(len(localTxRlps) + len(remoteTxRlps))
+				announcedTxsCounter.Add(localTxHashes.Len() + remoteTxHashes.Len())
 			}()
 		case <-syncToNewPeersEvery.C: // new peer
 			newPeers := p.recentlyConnectedPeers.GetAndClean()
@@ -1433,6 +1815,7 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 			hashes = p.AppendAllHashes(hashes[:0])
 			go send.PropagatePooledTxsToPeersList(newPeers, hashes)
 			propagateToNewPeerTimer.UpdateDuration(t)
+			newPeersCounter.Add(len(newPeers))
 		}
 	}
 }
@@ -1478,6 +1861,11 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (err error) {
 				return err
 			}
 		}
+		if mt.subPool&IsLocal != 0 {
+			if err := p.journalDiscarded(tx, mt); err != nil {
+				return err
+			}
+		}
 		p.deletedTxs[i] = nil // for gc
 	}
 
@@ -1494,6 +1882,7 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (err error) {
 	}
 
 	v := make([]byte, 0, 1024)
+	journalV := make([]byte, 0, 1024)
 	for txHash, metaTx := range p.byHash {
 		if metaTx.Tx.Rlp == nil {
 			continue
@@ -1516,13 +1905,28 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (err error) {
 				return err
 			}
 		}
+		if metaTx.subPool&IsLocal != 0 {
+			journalV = common.EnsureEnoughSize(journalV, 8+len(v))
+			binary.BigEndian.PutUint64(journalV, 0) // not included into block
+			copy(journalV[8:], v)
+			if err := tx.Put(kv.PoolLocalJournal, []byte(txHash), journalV); err != nil {
+				return err
+			}
+		}
 		metaTx.Tx.Rlp = nil
 	}
+	if err := p.pruneJournal(tx); err != nil {
+		return err
+	}
 
 	binary.BigEndian.PutUint64(encID, p.pendingBaseFee.Load())
 	if err := tx.Put(kv.PoolInfo, PoolPendingBaseFeeKey, encID); err != nil {
 		return err
 	}
+	binary.BigEndian.PutUint64(encID, p.pendingBlobFee.Load())
+	if err := tx.Put(kv.PoolInfo, PoolPendingBlobFeeKey, encID); err != nil {
+		return err
+	}
 	if err := PutLastSeenBlock(tx, p.lastSeenBlock.Load(), encID); err != nil {
 		return err
 	}
@@ -1531,6 +1935,7 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (err error) {
 	// DB will stay consistent but some in-memory structures may be already cleaned, and retry will not work
 	// failed write transaction must not create side-effects
 	p.deletedTxs = p.deletedTxs[:0]
+	p.rejectedJournal = p.rejectedJournal[:0]
 	return nil
 }
 
@@ -1558,6 +1963,8 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.Tx, coreTx kv.Tx) error {
 	txs := types.TxSlots{}
 	parseCtx := types.NewTxParseContext(p.chainID)
 	parseCtx.WithSender(false)
+	parseCtx.TrustBlobs(true)
+	parseCtx.WithChainConfig(p.cfg.ChainConfig)
 
 	i := 0
 	if err := tx.ForEach(kv.PoolTransaction, nil, func(k, v []byte) error {
@@ -1576,6 +1983,9 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.Tx, coreTx kv.Tx) error {
 		isLocalTx := p.isLocalLRU.Contains(string(k))
 
 		if reason := p.validateTx(txn, isLocalTx, cacheView); reason != NotSet && reason != Success {
+			if isLocalTx {
+				p.rejectJournaled(txn, reason)
+			}
 			return nil
 		}
 		txs.Resize(uint(i + 1))
@@ -1588,7 +1998,26 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.Tx, coreTx kv.Tx) error {
 		return err
 	}
 
-	var pendingBaseFee uint64
+	// local transactions discarded by the pool, but not included into block yet
+	journalTxs, err := p.journalTxs(tx, func(idHash []byte, includedBlock uint64) (bool, error) {
+		if includedBlock != 0 {
+			return true, nil
+		}
+		return tx.Has(kv.PoolTransaction, idHash)
+	})
+	if err != nil {
+		return err
+	}
+	for j, txn := range journalTxs.Txs {
+		txn.SenderID, txn.Traced = p.senders.getOrCreateID(journalTxs.Senders.At(j))
+		if reason := p.validateTx(txn, true /* isLocal */, cacheView); reason != NotSet && reason != Success {
+			p.rejectJournaled(txn, reason)
+			continue
+		}
+		txs.Append(txn, journalTxs.Senders.At(j), true)
+	}
+
+	var pendingBaseFee, pendingBlobFee uint64
 	{
 		v, err := tx.GetOne(kv.PoolInfo, PoolPendingBaseFeeKey)
 		if err != nil {
@@ -1597,16 +2026,23 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.Tx, coreTx kv.Tx) error {
 		if len(v) > 0 {
 			pendingBaseFee = binary.BigEndian.Uint64(v)
 		}
+		if v, err = tx.GetOne(kv.PoolInfo, PoolPendingBlobFeeKey); err != nil {
+			return err
+		}
+		if len(v) > 0 {
+			pendingBlobFee = binary.BigEndian.Uint64(v)
+		}
 	}
 	err = p.senders.registerNewSenders(&txs)
 	if err != nil {
 		return err
 	}
 	if _, err := addTxs(p.lastSeenBlock.Load(), cacheView, p.senders, txs,
-		pendingBaseFee, math.MaxUint64 /* blockGasLimit */, p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err != nil {
+		pendingBaseFee, pendingBlobFee, math.MaxUint64 /* blockGasLimit */, p.cfg.MaxPendingPerSender, p.cfg.MaxQueuedPerSender, p.pending, p.baseFee, p.queued, p.all, p.byHash, p.addLocked, p.discardLocked); err != nil {
 		return err
 	}
 	p.pendingBaseFee.Store(pendingBaseFee)
+	p.pendingBlobFee.Store(pendingBlobFee)
 
 	return nil
 }
@@ -1780,6 +2216,7 @@ func CalcIntrinsicGas(dataLen, dataNonZeroLen uint64, accessList types.AccessLis
 var PoolChainConfigKey = []byte("chain_config")
 var PoolLastSeenBlockKey = []byte("last_seen_block")
 var PoolPendingBaseFeeKey = []byte("pending_base_fee")
+var PoolPendingBlobFeeKey = []byte("pending_blob_fee")
 
 // recentlyConnectedPeers does buffer IDs of recently connected good peers
 // then sync of pooled Transaction can happen to all of then at once
@@ -1876,14 +2313,13 @@ func (sc *sendersBatch) onNewBlock(stateChanges *remote.StateChangeBatch, unwind
 			addrB := gointerfaces.ConvertH160toAddress(change.Address)
 			sc.getOrCreateID(addrB[:])
 		}
-
-		for i, txn := range unwindTxs.Txs {
-			txn.SenderID, txn.Traced = sc.getOrCreateID(unwindTxs.Senders.At(i))
-		}
-
-		for i, txn := range minedTxs.Txs {
-			txn.SenderID, txn.Traced = sc.getOrCreateID(minedTxs.Senders.At(i))
-		}
+	}
+	// txs are of the whole batch - registered once, not per block of the batch
+	for i, txn := range unwindTxs.Txs {
+		txn.SenderID, txn.Traced = sc.getOrCreateID(unwindTxs.Senders.At(i))
+	}
+	for i, txn := range minedTxs.Txs {
+		txn.SenderID, txn.Traced = sc.getOrCreateID(minedTxs.Senders.At(i))
 	}
 	return nil
 }
@@ -1997,6 +2433,7 @@ type PendingPool struct {
 	worst  *WorstQueue
 	adding bool
 	added  types.Hashes
+	moved  func(*metaTx) // called when transaction is added, nil if not set
 }
 
 func NewPendingSubPool(t SubPoolType, limit int) *PendingPool {
@@ -2018,6 +2455,7 @@ func (p *PendingPool) appendAddedHashes(h types.Hashes) types.Hashes {
 type bestSlice struct {
 	ms             []*metaTx
 	pendingBaseFee uint64
+	pendingBlobFee uint64
 }
 
 func (s *bestSlice) Len() int { return len(s.ms) }
@@ -2025,7 +2463,9 @@ func (s *bestSlice) Swap(i, j int) {
 	s.ms[i], s.ms[j] = s.ms[j], s.ms[i]
 	s.ms[i].bestIndex, s.ms[j].bestIndex = i, j
 }
-func (s *bestSlice) Less(i, j int) bool { return s.ms[i].better(s.ms[j], s.pendingBaseFee) }
+func (s *bestSlice) Less(i, j int) bool {
+	return s.ms[i].better(s.ms[j], s.pendingBaseFee, s.pendingBlobFee)
+}
 func (s *bestSlice) UnsafeRemove(i *metaTx) {
 	s.Swap(i.bestIndex, len(s.ms)-1)
 	s.ms[len(s.ms)-1].bestIndex = -1
@@ -2081,6 +2521,9 @@ func (p *PendingPool) Add(i *metaTx) {
 	i.currentSubPool = p.t
 	heap.Push(p.worst, i)
 	p.best.UnsafeAdd(i)
+	if p.moved != nil {
+		p.moved(i)
+	}
 }
 func (p *PendingPool) DebugPrint(prefix string) {
 	for i, it := range p.best.ms {
@@ -2098,6 +2541,7 @@ type SubPool struct {
 	worst  *WorstQueue
 	adding bool
 	added  types.Hashes
+	moved  func(*metaTx) // called when transaction is added, nil if not set
 }
 
 func NewSubPool(t SubPoolType, limit int) *SubPool {
@@ -2151,6 +2595,9 @@ func (p *SubPool) Add(i *metaTx) {
 	i.currentSubPool = p.t
 	heap.Push(p.best, i)
 	heap.Push(p.worst, i)
+	if p.moved != nil {
+		p.moved(i)
+	}
 }
 
 func (p *SubPool) Remove(i *metaTx) {
@@ -2176,15 +2623,22 @@ func (p *SubPool) DebugPrint(prefix string) {
 type BestQueue struct {
 	ms             []*metaTx
 	pendingBastFee uint64
+	pendingBlobFee uint64
+}
+
+// enoughFeeCapBlock - the transaction and the sender's transactions with lower nonces can pay
+// base fee and blob fee of the pending block
+func (mt *metaTx) enoughFeeCapBlock(pendingBaseFee, pendingBlobFee uint64) bool {
+	return mt.minFeeCap >= pendingBaseFee && mt.minBlobFeeCap >= pendingBlobFee
 }
 
-func (mt *metaTx) better(than *metaTx, pendingBaseFee uint64) bool {
+func (mt *metaTx) better(than *metaTx, pendingBaseFee, pendingBlobFee uint64) bool {
 	subPool := mt.subPool
 	thanSubPool := than.subPool
-	if mt.minFeeCap >= pendingBaseFee {
+	if mt.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee) {
 		subPool |= EnoughFeeCapBlock
 	}
-	if than.minFeeCap >= pendingBaseFee {
+	if than.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee) {
 		thanSubPool |= EnoughFeeCapBlock
 	}
 	if subPool != thanSubPool {
@@ -2218,13 +2672,13 @@ func (mt *metaTx) better(than *metaTx, pendingBaseFee uint64) bool {
 	return mt.timestamp < than.timestamp
 }
 
-func (mt *metaTx) worse(than *metaTx, pendingBaseFee uint64) bool {
+func (mt *metaTx) worse(than *metaTx, pendingBaseFee, pendingBlobFee uint64) bool {
 	subPool := mt.subPool
 	thanSubPool := than.subPool
-	if mt.minFeeCap >= pendingBaseFee {
+	if mt.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee) {
 		subPool |= EnoughFeeCapBlock
 	}
-	if than.minFeeCap >= pendingBaseFee {
+	if than.enoughFeeCapBlock(pendingBaseFee, pendingBlobFee) {
 		thanSubPool |= EnoughFeeCapBlock
 	}
 	if subPool != thanSubPool {
@@ -2253,8 +2707,10 @@ func (mt *metaTx) worse(than *metaTx, pendingBaseFee uint64) bool {
 	return mt.timestamp > than.timestamp
 }
 
-func (p BestQueue) Len() int           { return len(p.ms) }
-func (p BestQueue) Less(i, j int) bool { return p.ms[i].better(p.ms[j], p.pendingBastFee) }
+func (p BestQueue) Len() int { return len(p.ms) }
+func (p BestQueue) Less(i, j int) bool {
+	return p.ms[i].better(p.ms[j], p.pendingBastFee, p.pendingBlobFee)
+}
 func (p BestQueue) Swap(i, j int) {
 	p.ms[i], p.ms[j] = p.ms[j], p.ms[i]
 	p.ms[i].bestIndex = i
@@ -2281,10 +2737,13 @@ func (p *BestQueue) Pop() interface{} {
 type WorstQueue struct {
 	ms             []*metaTx
 	pendingBaseFee uint64
+	pendingBlobFee uint64
 }
 
-func (p WorstQueue) Len() int           { return len(p.ms) }
-func (p WorstQueue) Less(i, j int) bool { return p.ms[i].worse(p.ms[j], p.pendingBaseFee) }
+func (p WorstQueue) Len() int { return len(p.ms) }
+func (p WorstQueue) Less(i, j int) bool {
+	return p.ms[i].worse(p.ms[j], p.pendingBaseFee, p.pendingBlobFee)
+}
 func (p WorstQueue) Swap(i, j int) {
 	p.ms[i], p.ms[j] = p.ms[j], p.ms[i]
 	p.ms[i].worstIndex = i
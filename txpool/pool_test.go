@@ -20,11 +20,14 @@ import (
 	"bytes"
 	"container/heap"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"testing"
 
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/cmp"
 	"github.com/ledgerwatch/erigon-lib/common/u256"
@@ -634,3 +637,1149 @@ func TestTxPoke(t *testing.T) {
 	default:
 	}
 }
+
+func TestBlobTxs(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.MaxBlobsPerBlock = 2
+	cfg.TotalBlobPoolLimit = 3
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	pendingBaseFee := uint64(200000)
+	// start blocks from 0, set empty hash - then kvcache will also work on this
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: pendingBaseFee,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addr1, addr2 [20]byte
+	addr1[0], addr2[0] = 1, 2
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, addr := range [][20]byte{addr1, addr2} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	blobTx := func(id byte, nonce uint64, blobs int, blobFeeCap uint64) *types.TxSlot {
+		txSlot := &types.TxSlot{
+			Tip:         *uint256.NewInt(300000),
+			FeeCap:      300000,
+			Gas:         100000,
+			Nonce:       nonce,
+			Type:        byte(types.BlobTxType),
+			BlobFeeCap:  blobFeeCap,
+			BlobHashes:  make(types.Hashes, 32*blobs),
+			BlobSidecar: true,
+			Rlp:         []byte{id},
+		}
+		txSlot.IDHash[0] = id
+		return txSlot
+	}
+	addTx := func(txSlot *types.TxSlot, addr [20]byte) DiscardReason {
+		var txSlots types.TxSlots
+		txSlots.Append(txSlot, addr[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+
+	noSidecar := blobTx(1, 2, 1, 100)
+	noSidecar.BlobSidecar = false
+	assert.Equal(NoBlobs, addTx(noSidecar, addr1))
+	assert.Equal(TooManyBlobs, addTx(blobTx(2, 2, 3, 100), addr1))
+	assert.Equal(Success, addTx(blobTx(3, 2, 2, 100), addr1))
+	pending, baseFee, _ := pool.CountContent()
+	assert.Equal(1, pending)
+	assert.Equal(0, baseFee)
+
+	// blob tx can't be replaced by non-blob tx, blob fee has to be bumped too
+	nonBlob := blobTx(4, 2, 0, 0)
+	nonBlob.Tip, nonBlob.FeeCap = *uint256.NewInt(500000), 500000
+	assert.Equal(NotReplaced, addTx(nonBlob, addr1))
+	lowBlobFee := blobTx(5, 2, 2, 100)
+	lowBlobFee.Tip, lowBlobFee.FeeCap = *uint256.NewInt(500000), 500000
+	assert.Equal(NotReplaced, addTx(lowBlobFee, addr1))
+
+	// pool holds no more than TotalBlobPoolLimit blobs
+	assert.Equal(BlobPoolOverflow, addTx(blobTx(6, 2, 2, 100), addr2))
+	assert.Equal(Success, addTx(blobTx(7, 2, 1, 100), addr2))
+
+	// blob fee of the pending block higher than blob fee cap moves the txs out of pending sub-pool
+	pool.SetPendingBlobFee(150)
+	pending, baseFee, _ = pool.CountContent()
+	assert.Equal(0, pending)
+	assert.Equal(2, baseFee)
+	pool.SetPendingBlobFee(50)
+	pending, baseFee, _ = pool.CountContent()
+	assert.Equal(2, pending)
+	assert.Equal(0, baseFee)
+
+	// Best doesn't return more blobs than fit into a block
+	txs := &types.TxsRlp{}
+	require.NoError(pool.Best(10, txs, tx))
+	assert.Equal(1, len(txs.Txs))
+}
+
+func TestLocalsJournal(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.JournalDepth = 2
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+
+	parseCtx := types.NewTxParseContext(*u256.N1)
+	txSlot, addr := &types.TxSlot{}, [20]byte{}
+	_, err = parseCtx.ParseTransaction(decodeHex(types.TxParseMainnetTests[0].PayloadStr), 0, txSlot, addr[:], false /* hasEnvelope */, nil)
+	require.NoError(err)
+	idHash := string(txSlot.IDHash[:])
+
+	newBlock := func(pool *TxPool, height, senderNonce uint64, direction remote.Direction, minedTxs types.TxSlots) {
+		v := make([]byte, types.EncodeSenderLengthForStorage(senderNonce, *uint256.NewInt(1 * common.Ether)))
+		types.EncodeSender(senderNonce, *uint256.NewInt(1 * common.Ether), v)
+		change := &remote.StateChangeBatch{
+			DatabaseViewID:      txID,
+			PendingBlockBaseFee: 200000,
+			BlockGasLimit:       1000000,
+			ChangeBatch: []*remote.StateChange{
+				{BlockHeight: height, BlockHash: gointerfaces.ConvertHashToH256([32]byte{byte(height)}), Direction: direction,
+					Changes: []*remote.AccountChange{{
+						Action:  remote.Action_UPSERT,
+						Address: gointerfaces.ConvertAddressToH160(addr),
+						Data:    v,
+					}}},
+			},
+		}
+		require.NoError(pool.OnNewBlock(ctx, change, types.TxSlots{}, minedTxs, tx))
+		require.NoError(pool.flushLocked(tx))
+	}
+	journaled := func() (includedBlock uint64, ok bool) {
+		v, err := tx.GetOne(kv.PoolLocalJournal, []byte(idHash))
+		require.NoError(err)
+		if len(v) == 0 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint64(v), true
+	}
+	var mined types.TxSlots
+	mined.Append(txSlot, addr[:], false)
+
+	newBlock(pool, 0, 0, remote.Direction_FORWARD, types.TxSlots{})
+	var txSlots types.TxSlots
+	txSlots.Append(txSlot, addr[:], true)
+	reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+	require.NoError(err)
+	assert.Equal(Success, reasons[0])
+	require.NoError(pool.flushLocked(tx))
+	includedBlock, ok := journaled()
+	assert.True(ok)
+	assert.Equal(uint64(0), includedBlock)
+
+	// pool discarded tx (not written to PoolTransaction), but after restart it's re-injected from journal
+	require.NoError(tx.Delete(kv.PoolTransaction, []byte(idHash), nil))
+	pool, err = New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	require.NoError(err)
+	newBlock(pool, 0, 0, remote.Direction_FORWARD, types.TxSlots{})
+	mt, ok := pool.byHash[idHash]
+	require.True(ok)
+	assert.True(mt.subPool&IsLocal != 0)
+	pending, _, _ := pool.CountContent()
+	assert.Equal(1, pending)
+
+	// included tx stays in journal, and is re-injected on unwind
+	newBlock(pool, 1, 1, remote.Direction_FORWARD, mined)
+	_, ok = pool.byHash[idHash]
+	assert.False(ok)
+	includedBlock, ok = journaled()
+	assert.True(ok)
+	assert.Equal(uint64(1), includedBlock)
+
+	newBlock(pool, 0, 0, remote.Direction_UNWIND, types.TxSlots{})
+	mt, ok = pool.byHash[idHash]
+	require.True(ok)
+	assert.True(mt.subPool&IsLocal != 0)
+	includedBlock, ok = journaled()
+	assert.True(ok)
+	assert.Equal(uint64(0), includedBlock)
+
+	// removed from journal JournalDepth blocks after inclusion
+	newBlock(pool, 1, 1, remote.Direction_FORWARD, mined)
+	newBlock(pool, 2, 1, remote.Direction_FORWARD, types.TxSlots{})
+	_, ok = journaled()
+	assert.True(ok)
+	newBlock(pool, 3, 1, remote.Direction_FORWARD, types.TxSlots{})
+	_, ok = journaled()
+	assert.False(ok)
+}
+
+func TestLocalsJournalRejected(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+
+	parseCtx := types.NewTxParseContext(*u256.N1)
+	txSlot, addr := &types.TxSlot{}, [20]byte{}
+	_, err = parseCtx.ParseTransaction(decodeHex(types.TxParseMainnetTests[0].PayloadStr), 0, txSlot, addr[:], false /* hasEnvelope */, nil)
+	require.NoError(err)
+	idHash := string(txSlot.IDHash[:])
+
+	newBlock := func(pool *TxPool, height uint64, balance uint256.Int) {
+		v := make([]byte, types.EncodeSenderLengthForStorage(0, balance))
+		types.EncodeSender(0, balance, v)
+		change := &remote.StateChangeBatch{
+			DatabaseViewID:      txID,
+			PendingBlockBaseFee: 200000,
+			BlockGasLimit:       1000000,
+			ChangeBatch: []*remote.StateChange{
+				{BlockHeight: height, BlockHash: gointerfaces.ConvertHashToH256([32]byte{byte(height)}), Direction: remote.Direction_FORWARD,
+					Changes: []*remote.AccountChange{{
+						Action:  remote.Action_UPSERT,
+						Address: gointerfaces.ConvertAddressToH160(addr),
+						Data:    v,
+					}}},
+			},
+		}
+		require.NoError(pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx))
+		require.NoError(pool.flushLocked(tx))
+	}
+	journaled := func() bool {
+		v, err := tx.GetOne(kv.PoolLocalJournal, []byte(idHash))
+		require.NoError(err)
+		return len(v) > 0
+	}
+
+	newBlock(pool, 0, *uint256.NewInt(1 * common.Ether))
+	var txSlots types.TxSlots
+	txSlots.Append(txSlot, addr[:], true)
+	reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+	require.NoError(err)
+	assert.Equal(Success, reasons[0])
+	require.NoError(pool.flushLocked(tx))
+	assert.True(journaled())
+
+	// pool discarded tx, and sender spent its funds: after restart tx fails validation and is removed from journal
+	require.NoError(tx.Delete(kv.PoolTransaction, []byte(idHash), nil))
+	newBlock(pool, 1, uint256.Int{})
+	pool, err = New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	require.NoError(err)
+	newBlock(pool, 1, uint256.Int{})
+	_, ok := pool.byHash[idHash]
+	assert.False(ok)
+	assert.False(journaled())
+}
+
+func TestEvents(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	var addr [20]byte
+	addr[0] = 1
+	newBlock := func(height, senderNonce uint64, minedTxs types.TxSlots) {
+		v := make([]byte, types.EncodeSenderLengthForStorage(senderNonce, *uint256.NewInt(1 * common.Ether)))
+		types.EncodeSender(senderNonce, *uint256.NewInt(1 * common.Ether), v)
+		change := &remote.StateChangeBatch{
+			DatabaseViewID:      txID,
+			PendingBlockBaseFee: 200000,
+			BlockGasLimit:       1000000,
+			ChangeBatch: []*remote.StateChange{
+				{BlockHeight: height, BlockHash: gointerfaces.ConvertHashToH256([32]byte{byte(height)}),
+					Changes: []*remote.AccountChange{{
+						Action:  remote.Action_UPSERT,
+						Address: gointerfaces.ConvertAddressToH160(addr),
+						Data:    v,
+					}}},
+			},
+		}
+		require.NoError(pool.OnNewBlock(ctx, change, types.TxSlots{}, minedTxs, tx))
+	}
+	newBlock(0, 2, types.TxSlots{})
+
+	events, unsubscribe := pool.SubscribeEvents(16)
+	defer unsubscribe()
+	next := func() []Event {
+		select {
+		case evs := <-events:
+			return evs
+		default:
+			t.Fatalf("expected events")
+			return nil
+		}
+	}
+	txSlot := func(id byte, nonce, tip uint64) *types.TxSlot {
+		txSlot := &types.TxSlot{Tip: *uint256.NewInt(tip), FeeCap: tip, Gas: 100000, Nonce: nonce}
+		txSlot.IDHash[0] = id
+		return txSlot
+	}
+	addTxs := func(txs ...*types.TxSlot) {
+		var txSlots types.TxSlots
+		for _, txn := range txs {
+			txSlots.Append(txn, addr[:], true)
+		}
+		_, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+	}
+
+	// tx entered pending sub-pool via queued - only pending event
+	addTxs(txSlot(1, 2, 300000), txSlot(2, 4, 300000))
+	evs := next()
+	require.Equal(2, len(evs))
+	assert.Equal(Event{Type: EventPending, Hash: [32]byte{1}, Sender: addr, Nonce: 2}, evs[0])
+	assert.Equal(Event{Type: EventQueued, Hash: [32]byte{2}, Sender: addr, Nonce: 4}, evs[1])
+
+	addTxs(txSlot(3, 2, 400000))
+	evs = next()
+	require.Equal(2, len(evs))
+	assert.Equal(Event{Type: EventReplaced, Hash: [32]byte{1}, Sender: addr, Nonce: 2, ReplacedBy: [32]byte{3}, Reason: ReplacedByHigherTip}, evs[0])
+	assert.Equal(Event{Type: EventPending, Hash: [32]byte{3}, Sender: addr, Nonce: 2}, evs[1])
+
+	// not replaced - no events
+	addTxs(txSlot(4, 2, 400000))
+	assert.Equal(0, len(events))
+
+	var mined types.TxSlots
+	mined.Append(txSlot(3, 2, 400000), addr[:], false)
+	newBlock(1, 3, mined)
+	evs = next()
+	require.Equal(1, len(evs))
+	assert.Equal(Event{Type: EventMined, Hash: [32]byte{3}, Sender: addr, Nonce: 2, Reason: Mined}, evs[0])
+
+	// sender's nonce jumped over queued tx
+	newBlock(2, 5, types.TxSlots{})
+	evs = next()
+	require.Equal(1, len(evs))
+	assert.Equal(Event{Type: EventDropped, Hash: [32]byte{2}, Sender: addr, Nonce: 4, Reason: NonceTooLow}, evs[0])
+}
+
+func TestContentFrom(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addr, otherAddr [20]byte
+	addr[0], otherAddr[0] = 1, 2
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+		Action:  remote.Action_UPSERT,
+		Address: gointerfaces.ConvertAddressToH160(addr),
+		Data:    v,
+	})
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	var txSlots types.TxSlots
+	for _, nonce := range []uint64{4, 2} {
+		txSlot := &types.TxSlot{
+			Tip:    *uint256.NewInt(300000),
+			FeeCap: 300000 + nonce,
+			Gas:    100000,
+			Value:  *uint256.NewInt(nonce),
+			Nonce:  nonce,
+			Rlp:    []byte{byte(nonce)},
+		}
+		txSlot.IDHash[0] = byte(nonce)
+		txSlots.Append(txSlot, addr[:], true)
+	}
+	reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+	require.NoError(err)
+	for _, reason := range reasons {
+		assert.Equal(Success, reason, reason.String())
+	}
+	require.NoError(pool.flushLocked(tx)) // rlp is read from db
+
+	txs, err := pool.ContentFrom(tx, addr)
+	require.NoError(err)
+	require.Equal(2, len(txs))
+	assert.Equal(SenderTx{SubPool: PendingSubPool, IDHash: [32]byte{2}, Nonce: 2, Tip: *uint256.NewInt(300000), FeeCap: 300002,
+		Gas: 100000, Value: *uint256.NewInt(2), Rlp: []byte{2}}, txs[0])
+	assert.Equal(QueuedSubPool, txs[1].SubPool)
+	assert.Equal(uint64(4), txs[1].Nonce)
+	assert.Equal([]byte{4}, txs[1].Rlp)
+
+	txs, err = pool.ContentFrom(tx, otherAddr)
+	require.NoError(err)
+	assert.Equal(0, len(txs))
+}
+
+func TestReplacementPriceBump(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.PriceBump = 10
+	cfg.FeeCapPriceBump = 50
+	cfg.BlobPriceBump = 100
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addr1, addr2 [20]byte
+	addr1[0], addr2[0] = 1, 2
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, addr := range [][20]byte{addr1, addr2} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	newTx := func(id byte, tip, feeCap, blobFeeCap uint64) *types.TxSlot {
+		txSlot := &types.TxSlot{
+			Tip:    *uint256.NewInt(tip),
+			FeeCap: feeCap,
+			Gas:    100000,
+			Nonce:  2,
+			Rlp:    []byte{id},
+		}
+		if blobFeeCap > 0 {
+			txSlot.Type, txSlot.BlobFeeCap, txSlot.BlobSidecar = byte(types.BlobTxType), blobFeeCap, true
+			txSlot.BlobHashes = make(types.Hashes, 32)
+		}
+		txSlot.IDHash[0] = id
+		return txSlot
+	}
+	addTx := func(txSlot *types.TxSlot, addr [20]byte) DiscardReason {
+		var txSlots types.TxSlots
+		txSlots.Append(txSlot, addr[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+
+	assert.Equal(Success, addTx(newTx(1, 300000, 300000, 0), addr1))
+	assert.Equal(NotReplaced, addTx(newTx(2, 330000, 449999, 0), addr1))
+	assert.Equal(Success, addTx(newTx(3, 330000, 450000, 0), addr1))
+
+	assert.Equal(Success, addTx(newTx(4, 300000, 300000, 100), addr2))
+	assert.Equal(NotReplaced, addTx(newTx(5, 599999, 600000, 200), addr2))
+	assert.Equal(NotReplaced, addTx(newTx(6, 600000, 600000, 199), addr2))
+	assert.Equal(Success, addTx(newTx(7, 600000, 600000, 200), addr2))
+}
+
+func TestSenderLimits(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.MaxPendingPerSender = 2
+	cfg.MaxQueuedPerSender = 1
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addr1, addr2 [20]byte
+	addr1[0], addr2[0] = 1, 2
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, addr := range [][20]byte{addr1, addr2} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	newTxs := func(addr [20]byte, isLocal bool, nonces ...uint64) types.TxSlots {
+		var txSlots types.TxSlots
+		for _, nonce := range nonces {
+			txSlot := &types.TxSlot{
+				Tip:    *uint256.NewInt(300000),
+				FeeCap: 300000,
+				Gas:    100000,
+				Nonce:  nonce,
+				Rlp:    []byte{addr[0], byte(nonce)},
+			}
+			txSlot.IDHash[0], txSlot.IDHash[1] = addr[0], byte(nonce)
+			txSlots.Append(txSlot, addr[:], isLocal)
+		}
+		return txSlots
+	}
+	// highest nonces of overflow are discarded, independently of order of arrival
+	pool.AddRemoteTxs(ctx, newTxs(addr1, false, 7, 2, 6, 4, 3))
+	require.NoError(pool.processRemoteTxs(ctx))
+	pending, baseFee, queued := pool.CountContent()
+	assert.Equal(2, pending)
+	assert.Equal(0, baseFee)
+	assert.Equal(1, queued)
+	for nonce, reason := range map[byte]DiscardReason{4: SenderPendingLimit, 7: SenderQueuedLimit} {
+		discarded, ok := pool.discardReasonsLRU.Get(string([]byte{1, nonce}) + string(make([]byte, 30)))
+		assert.True(ok)
+		assert.Equal(reason, discarded)
+	}
+	for _, nonce := range []uint64{2, 3, 6} {
+		assert.NotNil(pool.all.get(pool.senders.senderIDs[string(addr1[:])], nonce))
+	}
+
+	// local transactions are not limited
+	reasons, err := pool.AddLocalTxs(ctx, newTxs(addr2, true, 2, 3, 4, 6, 7), tx)
+	require.NoError(err)
+	for _, reason := range reasons {
+		assert.Equal(Success, reason, reason.String())
+	}
+	assert.Equal(5, pool.all.count(pool.senders.senderIDs[string(addr2[:])]))
+}
+
+func TestBestIterator(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addrA, addrB, addrC [20]byte
+	addrA[0], addrB[0], addrC[0] = 1, 2, 3
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, addr := range [][20]byte{addrA, addrB, addrC} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	var txSlots types.TxSlots
+	for _, tt := range []struct {
+		id          byte
+		addr        [20]byte
+		nonce       uint64
+		tip, feeCap uint64
+	}{
+		{id: 1, addr: addrA, nonce: 2, tip: 100000, feeCap: 1000000}, // effective tip 100000
+		{id: 2, addr: addrA, nonce: 3, tip: 900000, feeCap: 1000000}, // 800000
+		{id: 3, addr: addrB, nonce: 2, tip: 500000, feeCap: 600000},  // 400000
+		{id: 4, addr: addrC, nonce: 2, tip: 300000, feeCap: 1000000}, // 300000
+		{id: 5, addr: addrC, nonce: 3, tip: 300000, feeCap: 1000000}, // 300000
+	} {
+		txSlot := &types.TxSlot{Tip: *uint256.NewInt(tt.tip), FeeCap: tt.feeCap, Gas: 100000, Nonce: tt.nonce, Rlp: []byte{tt.id}}
+		txSlot.IDHash[0] = tt.id
+		txSlots.Append(txSlot, tt.addr[:], true)
+	}
+	reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+	require.NoError(err)
+	for _, reason := range reasons {
+		assert.Equal(Success, reason, reason.String())
+	}
+
+	it := pool.BestIterator(200000, tx)
+	next := func(id byte, addr [20]byte) {
+		txn, sender := it.Peek()
+		require.NotNil(txn)
+		assert.Equal(id, txn.IDHash[0])
+		assert.Equal(addr, sender)
+		rlpTxn, err := it.Rlp()
+		require.NoError(err)
+		assert.Equal([]byte{id}, rlpTxn)
+	}
+	next(3, addrB)
+	it.Pop()
+	next(4, addrC)
+	it.Skip() // next transaction of addrC is skipped too
+	next(1, addrA)
+	it.Pop()
+	next(2, addrA)
+	it.Pop()
+	txn, _ := it.Peek()
+	assert.Nil(txn)
+
+	// fee cap of addrB transaction is lower than base fee
+	it = pool.BestIterator(700000, tx)
+	var ids []byte
+	for txn, _ := it.Peek(); txn != nil; txn, _ = it.Peek() {
+		ids = append(ids, txn.IDHash[0])
+		it.Pop()
+	}
+	assert.Equal([]byte{4, 5, 1, 2}, ids)
+}
+
+func TestDenylist(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	var addr, deniedSender, deniedRecipient, contract, deniedContract [20]byte
+	addr[0], deniedSender[0], deniedRecipient[0], contract[0], deniedContract[0] = 1, 2, 3, 4, 5
+	codeHash, deniedCodeHash := [32]byte{0xaa, 0x01}, [32]byte{0xde, 0xad, 0x01}
+	cfg := DefaultConfig
+	cfg.DeniedAddresses = []string{string(deniedSender[:]), string(deniedRecipient[:])}
+	cfg.DeniedCodeHashes = []string{string([]byte{0xde, 0xad})}
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, sender := range [][20]byte{addr, deniedSender} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(sender),
+			Data:    v,
+		})
+	}
+	for contractAddr, hash := range map[[20]byte][32]byte{contract: codeHash, deniedContract: deniedCodeHash} {
+		// account with nonce 1 and code hash
+		enc := append([]byte{1 | 8, 1, 1, 32}, hash[:]...)
+		nonce, _, err := types.DecodeSender(enc)
+		require.NoError(err)
+		require.Equal(uint64(1), nonce)
+		decodedHash, ok, err := types.DecodeAccountCodeHash(enc)
+		require.NoError(err)
+		require.True(ok)
+		require.Equal(hash, decodedHash)
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(contractAddr),
+			Data:    enc,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	var id byte
+	addTx := func(sender, to [20]byte, creation bool) DiscardReason {
+		id++
+		txSlot := &types.TxSlot{
+			Tip:      *uint256.NewInt(300000),
+			FeeCap:   300000,
+			Gas:      100000,
+			Nonce:    uint64(id) + 1,
+			To:       to,
+			Creation: creation,
+			Rlp:      []byte{id},
+		}
+		txSlot.IDHash[0] = id
+		var txSlots types.TxSlots
+		txSlots.Append(txSlot, sender[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+	deniedBefore := deniedBySenderCounter.Get() + deniedByRecipientCounter.Get() + deniedByCodeHashCounter.Get()
+	assert.Equal(Denied, addTx(deniedSender, contract, false))
+	assert.Equal(Denied, addTx(addr, deniedRecipient, false))
+	assert.Equal(Denied, addTx(addr, deniedContract, false))
+	assert.Equal(uint64(3), deniedBySenderCounter.Get()+deniedByRecipientCounter.Get()+deniedByCodeHashCounter.Get()-deniedBefore)
+	assert.Equal(0, pool.all.count(pool.senders.senderIDs[string(addr[:])]))
+
+	assert.Equal(Success, addTx(addr, contract, false))
+	// zero To of contract creation isn't checked
+	var zero [20]byte
+	cfg.DeniedAddresses = append(cfg.DeniedAddresses, string(zero[:]))
+	pool.denylist = newDenylist(cfg)
+	assert.Equal(Denied, addTx(addr, zero, false))
+	assert.Equal(Success, addTx(addr, zero, true))
+}
+
+func TestMetrics(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 0, BlockHash: h1},
+		},
+	}
+	var addr [20]byte
+	addr[0] = 1
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+		Action:  remote.Action_UPSERT,
+		Address: gointerfaces.ConvertAddressToH160(addr),
+		Data:    v,
+	})
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+
+	addTx := func(id byte, nonce, feeCap uint64) DiscardReason {
+		txSlot := &types.TxSlot{
+			Tip:    *uint256.NewInt(feeCap),
+			FeeCap: feeCap,
+			Gas:    100000,
+			Nonce:  nonce,
+			Rlp:    []byte{id},
+			Size:   100,
+		}
+		txSlot.IDHash[0] = id
+		var txSlots types.TxSlots
+		txSlots.Append(txSlot, addr[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+	added := addedTxsCounter.Get()
+	replaced, notReplaced, nonceTooLow := discardedTxsCounter(ReplacedByHigherTip).Get(), rejectedTxsCounter(NotReplaced).Get(), rejectedTxsCounter(NonceTooLow).Get()
+
+	assert.Equal(Success, addTx(1, 2, 300000))
+	assert.Equal(Success, addTx(2, 3, 100000))
+	assert.Equal(Success, addTx(3, 5, 300000))
+	assert.Equal(uint64(1), pendingTxsGauge.Get())
+	assert.Equal(uint64(1), baseFeeTxsGauge.Get())
+	assert.Equal(uint64(1), queuedTxsGauge.Get())
+	assert.Equal(uint64(300), txsSizeGauge.Get())
+
+	assert.Equal(NotReplaced, addTx(4, 2, 300000))
+	assert.Equal(Success, addTx(5, 2, 400000))
+	assert.Equal(NonceTooLow, addTx(6, 1, 300000))
+	assert.Equal(uint64(4), addedTxsCounter.Get()-added)
+	assert.Equal(uint64(1), discardedTxsCounter(ReplacedByHigherTip).Get()-replaced)
+	assert.Equal(uint64(1), rejectedTxsCounter(NotReplaced).Get()-notReplaced)
+	assert.Equal(uint64(1), rejectedTxsCounter(NonceTooLow).Get()-nonceTooLow)
+	assert.Equal(uint64(300), txsSizeGauge.Get())
+}
+
+func TestQueuedLifetime(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.QueuedLifetime = 2
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	h1 := gointerfaces.ConvertHashToH256([32]byte{})
+	change := &remote.StateChangeBatch{
+		DatabaseViewID:      txID,
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{
+			{BlockHeight: 1, BlockHash: h1},
+		},
+	}
+	var addr1, addr2 [20]byte
+	addr1[0], addr2[0] = 1, 2
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	for _, addr := range [][20]byte{addr1, addr2} {
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	err = pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+	assert.NoError(err)
+	newBlock := func(blockNum uint64) {
+		change.ChangeBatch[0].BlockHeight = blockNum
+		change.ChangeBatch[0].Changes = nil
+		require.NoError(pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx))
+	}
+
+	newTxs := func(addr [20]byte, isLocal bool, nonces ...uint64) types.TxSlots {
+		var txSlots types.TxSlots
+		for _, nonce := range nonces {
+			txSlot := &types.TxSlot{
+				Tip:    *uint256.NewInt(300000),
+				FeeCap: 300000,
+				Gas:    100000,
+				Nonce:  nonce,
+				Rlp:    []byte{addr[0], byte(nonce)},
+			}
+			txSlot.IDHash[0], txSlot.IDHash[1] = addr[0], byte(nonce)
+			txSlots.Append(txSlot, addr[:], isLocal)
+		}
+		return txSlots
+	}
+	queuedTx := func(addr [20]byte, nonce uint64) *metaTx {
+		mt := pool.all.get(pool.senders.senderIDs[string(addr[:])], nonce)
+		if mt != nil {
+			assert.Equal(QueuedSubPool, mt.currentSubPool)
+		}
+		return mt
+	}
+	// nonce gaps: transactions stay in queued sub-pool
+	pool.AddRemoteTxs(ctx, newTxs(addr1, false, 4))
+	require.NoError(pool.processRemoteTxs(ctx))
+	reasons, err := pool.AddLocalTxs(ctx, newTxs(addr2, true, 4), tx)
+	require.NoError(err)
+	assert.Equal(Success, reasons[0], reasons[0].String())
+
+	newBlock(3)
+	assert.NotNil(queuedTx(addr1, 4))
+	pool.AddRemoteTxs(ctx, newTxs(addr1, false, 5))
+	require.NoError(pool.processRemoteTxs(ctx))
+
+	newBlock(4)
+	assert.Nil(queuedTx(addr1, 4))
+	discarded, ok := pool.discardReasonsLRU.Get(string([]byte{1, 4}) + string(make([]byte, 30)))
+	assert.True(ok)
+	assert.Equal(Expired, discarded)
+	assert.NotNil(queuedTx(addr1, 5))
+	assert.NotNil(queuedTx(addr2, 4)) // local transactions don't expire
+
+	// transaction which left queued sub-pool doesn't expire
+	txs := newTxs(addr1, true, 2, 3, 4)
+	txs.Txs[2].IDHash[2] = 1 // not the expired one
+	reasons, err = pool.AddLocalTxs(ctx, txs, tx)
+	require.NoError(err)
+	for _, reason := range reasons {
+		assert.Equal(Success, reason, reason.String())
+	}
+	assert.Equal(PendingSubPool, pool.all.get(pool.senders.senderIDs[string(addr1[:])], 5).currentSubPool)
+	newBlock(10)
+	assert.NotNil(pool.all.get(pool.senders.senderIDs[string(addr1[:])], 5))
+}
+
+func TestTxTypeActivation(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	cfg.ChainConfig = &chain.Config{BerlinBlock: big.NewInt(0), LondonBlock: big.NewInt(0), PragueTime: big.NewInt(1000)}
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	var addr [20]byte
+	addr[0] = 1
+	v := make([]byte, types.EncodeSenderLengthForStorage(2, *uint256.NewInt(1 * common.Ether)))
+	types.EncodeSender(2, *uint256.NewInt(1 * common.Ether), v)
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	newBlock := func(height, blockTime uint64) {
+		h1 := gointerfaces.ConvertHashToH256([32]byte{byte(height)})
+		change := &remote.StateChangeBatch{
+			DatabaseViewID:      txID,
+			PendingBlockBaseFee: 200000,
+			BlockGasLimit:       1000000,
+			ChangeBatch: []*remote.StateChange{
+				{BlockHeight: height, BlockHash: h1, BlockTime: blockTime},
+			},
+		}
+		change.ChangeBatch[0].Changes = append(change.ChangeBatch[0].Changes, &remote.AccountChange{
+			Action:  remote.Action_UPSERT,
+			Address: gointerfaces.ConvertAddressToH160(addr),
+			Data:    v,
+		})
+		err := pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx)
+		assert.NoError(err)
+	}
+	addTx := func(id byte, auths int) DiscardReason {
+		txSlot := &types.TxSlot{
+			Type:      byte(types.SetCodeTxType),
+			Tip:       *uint256.NewInt(300000),
+			FeeCap:    300000,
+			Gas:       100000,
+			Nonce:     2,
+			AuthCount: auths,
+			Rlp:       []byte{id},
+		}
+		txSlot.IDHash[0] = id
+		var txSlots types.TxSlots
+		txSlots.Append(txSlot, addr[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, txSlots, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+
+	newBlock(0, 998)
+	assert.Equal(TxTypeNotActive, addTx(1, 1)) // wall clock time doesn't matter
+	newBlock(1, 999)                           // pending block activates set-code transactions
+	assert.Equal(IntrinsicGas, addTx(2, 4))    // 21000 + 4 * 25000 > 100000
+	assert.Equal(Success, addTx(3, 1))
+}
+
+func TestUnwindTxs(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	ch := make(chan types.Hashes, 100)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+
+	cfg := DefaultConfig
+	sendersCache := kvcache.New(kvcache.DefaultCoherentConfig)
+	pool, err := New(ch, coreDB, cfg, sendersCache, *u256.N1)
+	assert.NoError(err)
+	require.True(pool != nil)
+	ctx := context.Background()
+	var txID uint64
+	_ = coreDB.View(ctx, func(tx kv.Tx) error {
+		txID = tx.ViewID()
+		return nil
+	})
+	var addr1, addr2 [20]byte
+	addr1[0], addr2[0] = 1, 2
+	tx, err := db.BeginRw(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+
+	accountChange := func(addr [20]byte, nonce uint64) *remote.AccountChange {
+		v := make([]byte, types.EncodeSenderLengthForStorage(nonce, *uint256.NewInt(1 * common.Ether)))
+		types.EncodeSender(nonce, *uint256.NewInt(1 * common.Ether), v)
+		return &remote.AccountChange{Action: remote.Action_UPSERT, Address: gointerfaces.ConvertAddressToH160(addr), Data: v}
+	}
+	onNewBlock := func(changes []*remote.StateChange, unwindTxs, minedTxs types.TxSlots) {
+		change := &remote.StateChangeBatch{
+			DatabaseViewID:      txID,
+			PendingBlockBaseFee: 200000,
+			BlockGasLimit:       1000000,
+			ChangeBatch:         changes,
+		}
+		err := pool.OnNewBlock(ctx, change, unwindTxs, minedTxs, tx)
+		assert.NoError(err)
+	}
+	newTxn := func(id byte) *types.TxSlot {
+		txSlot := &types.TxSlot{
+			Tip:    *uint256.NewInt(300000),
+			FeeCap: 300000,
+			Gas:    100000,
+			Nonce:  2,
+			Rlp:    []byte{id},
+		}
+		txSlot.IDHash[0] = id
+		return txSlot
+	}
+	txn1, txn2 := newTxn(1), newTxn(2)
+	slots := func(txns ...*types.TxSlot) (txs types.TxSlots) {
+		for _, txn := range txns {
+			if txn == txn1 {
+				txs.Append(txn, addr1[:], false)
+			} else {
+				txs.Append(txn, addr2[:], false)
+			}
+		}
+		return txs
+	}
+
+	onNewBlock([]*remote.StateChange{{BlockHeight: 0, BlockHash: gointerfaces.ConvertHashToH256([32]byte{}),
+		Changes: []*remote.AccountChange{accountChange(addr1, 2), accountChange(addr2, 2)}}}, types.TxSlots{}, types.TxSlots{})
+	pool.AddRemoteTxs(ctx, slots(txn1, txn2))
+	require.NoError(pool.processRemoteTxs(ctx))
+	require.Equal(2, len(pool.byHash))
+
+	// both txs are included into block 1
+	onNewBlock([]*remote.StateChange{{BlockHeight: 1, BlockHash: gointerfaces.ConvertHashToH256([32]byte{1}),
+		Changes: []*remote.AccountChange{accountChange(addr1, 3), accountChange(addr2, 3)}}}, types.TxSlots{}, slots(txn1, txn2))
+	require.Equal(0, len(pool.byHash))
+	reason, ok := pool.discardReasonsLRU.Get(string(txn1.IDHash[:]))
+	require.True(ok)
+	require.Equal(Mined, reason)
+
+	// reorg: block 1 is replaced by block which includes only txn2
+	nonceTooLowBefore := rejectedTxsCounter(NonceTooLow).Get()
+	onNewBlock([]*remote.StateChange{
+		{Direction: remote.Direction_UNWIND, BlockHeight: 1, BlockHash: gointerfaces.ConvertHashToH256([32]byte{1}),
+			Changes: []*remote.AccountChange{accountChange(addr1, 2), accountChange(addr2, 2)}},
+		{BlockHeight: 1, BlockHash: gointerfaces.ConvertHashToH256([32]byte{2}),
+			Changes: []*remote.AccountChange{accountChange(addr2, 3)}},
+	}, slots(txn1, txn2), slots(txn2))
+	require.Equal(1, len(pool.byHash))
+	mt, ok := pool.byHash[string(txn1.IDHash[:])]
+	require.True(ok)
+	assert.Equal(PendingSubPool, mt.currentSubPool)
+	assert.False(mt.subPool&IsLocal > 0)
+	_, ok = pool.discardReasonsLRU.Get(string(txn1.IDHash[:]))
+	assert.False(ok)
+	assert.Equal(nonceTooLowBefore, rejectedTxsCounter(NonceTooLow).Get())
+}
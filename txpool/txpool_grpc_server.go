@@ -28,6 +28,7 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
@@ -45,10 +46,13 @@ import (
 )
 
 // TxPoolAPIVersion
-var TxPoolAPIVersion = &types2.VersionReply{Major: 1, Minor: 0, Patch: 0}
+// 1.1.0 - Added OnEvents streaming method
+// 1.2.0 - Added ContentFrom method
+var TxPoolAPIVersion = &types2.VersionReply{Major: 1, Minor: 2, Patch: 0}
 
 type txPool interface {
 	ValidateSerializedTxn(serializedTxn []byte) error
+	ChainConfig() *chain.Config
 
 	Best(n uint16, txs *types.TxsRlp, tx kv.Tx) error
 	GetRlp(tx kv.Tx, hash []byte) ([]byte, error)
@@ -57,6 +61,8 @@ type txPool interface {
 	CountContent() (int, int, int)
 	IdHashKnown(tx kv.Tx, hash []byte) (bool, error)
 	NonceFromAddress(addr [20]byte) (nonce uint64, inPool bool)
+	SubscribeEvents(buffer int) (ch <-chan []Event, unsubscribe func())
+	ContentFrom(tx kv.Tx, addr [20]byte) ([]SenderTx, error)
 }
 
 var _ txpool_proto.TxpoolServer = (*GrpcServer)(nil)   // compile-time interface check
@@ -89,6 +95,12 @@ func (*GrpcDisabled) Pending(ctx context.Context, empty *emptypb.Empty) (*txpool
 func (*GrpcDisabled) OnAdd(request *txpool_proto.OnAddRequest, server txpool_proto.Txpool_OnAddServer) error {
 	return ErrPoolDisabled
 }
+func (*GrpcDisabled) OnEvents(request *txpool_proto.OnEventsRequest, server txpool_proto.Txpool_OnEventsServer) error {
+	return ErrPoolDisabled
+}
+func (*GrpcDisabled) ContentFrom(ctx context.Context, request *txpool_proto.ContentFromRequest) (*txpool_proto.ContentFromReply, error) {
+	return nil, ErrPoolDisabled
+}
 func (*GrpcDisabled) Status(ctx context.Context, request *txpool_proto.StatusRequest) (*txpool_proto.StatusReply, error) {
 	return nil, ErrPoolDisabled
 }
@@ -183,6 +195,7 @@ func (s *GrpcServer) Add(ctx context.Context, in *txpool_proto.AddRequest) (*txp
 	var slots types.TxSlots
 	parseCtx := types.NewTxParseContext(s.chainID)
 	parseCtx.ValidateRLP(s.txPool.ValidateSerializedTxn)
+	parseCtx.WithChainConfig(s.txPool.ChainConfig())
 
 	reply := &txpool_proto.AddReply{Imported: make([]txpool_proto.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}
 
@@ -259,6 +272,59 @@ func (s *GrpcServer) OnAdd(req *txpool_proto.OnAddRequest, stream txpool_proto.T
 	}
 }
 
+func convertEventType(t EventType) txpool_proto.OnEventsReply_EventType {
+	switch t {
+	case EventPending:
+		return txpool_proto.OnEventsReply_PENDING
+	case EventBaseFee:
+		return txpool_proto.OnEventsReply_BASE_FEE
+	case EventQueued:
+		return txpool_proto.OnEventsReply_QUEUED
+	case EventReplaced:
+		return txpool_proto.OnEventsReply_REPLACED
+	case EventMined:
+		return txpool_proto.OnEventsReply_MINED
+	case EventDropped:
+		return txpool_proto.OnEventsReply_DROPPED
+	default:
+		panic("unknown")
+	}
+}
+
+func (s *GrpcServer) OnEvents(req *txpool_proto.OnEventsRequest, stream txpool_proto.Txpool_OnEventsServer) error {
+	log.Info("New txpool events subscriber joined")
+	ch, unsubscribe := s.txPool.SubscribeEvents(1024)
+	defer unsubscribe()
+	for {
+		select {
+		case events := <-ch:
+			reply := &txpool_proto.OnEventsReply{Events: make([]*txpool_proto.OnEventsReply_Event, len(events))}
+			for i := range events {
+				ev := &txpool_proto.OnEventsReply_Event{
+					Type:   convertEventType(events[i].Type),
+					Hash:   gointerfaces.ConvertHashToH256(events[i].Hash),
+					Sender: gointerfaces.ConvertAddressToH160(events[i].Sender),
+					Nonce:  events[i].Nonce,
+				}
+				switch events[i].Type {
+				case EventReplaced:
+					ev.ReplacedBy = gointerfaces.ConvertHashToH256(events[i].ReplacedBy)
+				case EventDropped:
+					ev.Reason, ev.ReasonText = uint32(events[i].Reason), events[i].Reason.String()
+				}
+				reply.Events[i] = ev
+			}
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
+
 func (s *GrpcServer) Transactions(ctx context.Context, in *txpool_proto.TransactionsRequest) (*txpool_proto.TransactionsReply, error) {
 	tx, err := s.db.BeginRo(ctx)
 	if err != nil {
@@ -292,6 +358,33 @@ func (s *GrpcServer) Status(_ context.Context, _ *txpool_proto.StatusRequest) (*
 	}, nil
 }
 
+func (s *GrpcServer) ContentFrom(ctx context.Context, in *txpool_proto.ContentFromRequest) (*txpool_proto.ContentFromReply, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	txs, err := s.txPool.ContentFrom(tx, gointerfaces.ConvertH160toAddress(in.Sender))
+	if err != nil {
+		return nil, err
+	}
+	reply := &txpool_proto.ContentFromReply{Txs: make([]*txpool_proto.ContentFromReply_Tx, len(txs))}
+	for i := range txs {
+		reply.Txs[i] = &txpool_proto.ContentFromReply_Tx{
+			TxnType:    convertSubPoolType(txs[i].SubPool),
+			Hash:       gointerfaces.ConvertHashToH256(txs[i].IDHash),
+			Nonce:      txs[i].Nonce,
+			Tip:        gointerfaces.ConvertUint256IntToH256(&txs[i].Tip),
+			FeeCap:     txs[i].FeeCap,
+			Gas:        txs[i].Gas,
+			Value:      gointerfaces.ConvertUint256IntToH256(&txs[i].Value),
+			BlobFeeCap: txs[i].BlobFeeCap,
+			RlpTx:      txs[i].Rlp,
+		}
+	}
+	return reply, nil
+}
+
 // returns nonce for address
 func (s *GrpcServer) Nonce(ctx context.Context, in *txpool_proto.NonceRequest) (*txpool_proto.NonceReply, error) {
 	addr := gointerfaces.ConvertH160toAddress(in.Address)
@@ -113,6 +113,9 @@ func AllComponents(ctx context.Context, cfg txpool.Config, cache kvcache.Cache,
 	}
 
 	chainID, _ := uint256.FromBig(chainConfig.ChainID)
+	if cfg.ChainConfig == nil {
+		cfg.ChainConfig = chainConfig
+	}
 	txPool, err := txpool.New(newTxs, chainDB, cfg, cache, *chainID)
 	if err != nil {
 		return nil, nil, nil, nil, nil, err
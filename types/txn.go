@@ -18,6 +18,7 @@ package types
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -26,7 +27,9 @@ import (
 	"math/bits"
 	"sort"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
 	"github.com/ledgerwatch/erigon-lib/common/length"
 	"github.com/ledgerwatch/erigon-lib/common/u256"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
@@ -37,6 +40,7 @@ import (
 
 type TxParsseConfig struct {
 	ChainID uint256.Int
+	Blobs   bool // Type 3 is blob transaction (EIP-4844), not Starknet transaction, see WithChainConfig
 }
 
 // TxParseContext is object that is required to parse transactions and turn transaction payload into TxSlot objects
@@ -53,10 +57,43 @@ type TxParseContext struct {
 	withSender       bool
 	IsProtected      bool
 	validateRlp      func([]byte) error
+	senderCache      *SenderCache
+	trustBlobs       bool
 
 	cfg TxParsseConfig
 }
 
+// SenderCache - senders recovered from signatures, by transaction hash: hash covers the signature, so cached sender
+// stays valid. Can be shared by parse contexts of different goroutines
+type SenderCache struct {
+	senders *lru.Cache // string(idHash) -> [20]byte
+}
+
+func NewSenderCache(size int) *SenderCache {
+	senders, err := lru.New(size)
+	if err != nil {
+		panic(err)
+	}
+	return &SenderCache{senders: senders}
+}
+
+func (c *SenderCache) get(idHash, sender []byte) bool {
+	v, ok := c.senders.Get(string(idHash))
+	if ok {
+		addr := v.([20]byte)
+		copy(sender, addr[:])
+	}
+	return ok
+}
+
+func (c *SenderCache) add(idHash, sender []byte) {
+	var addr [20]byte
+	copy(addr[:], sender)
+	c.senders.Add(string(idHash), addr)
+}
+
+func (c *SenderCache) Len() int { return c.senders.Len() }
+
 func NewTxParseContext(chainID uint256.Int) *TxParseContext {
 	if chainID.IsZero() {
 		panic("wrong chainID")
@@ -87,10 +124,17 @@ type TxSlot struct {
 	SenderID       uint64      // SenderID - require external mapping to it's address
 	Traced         bool        // Whether transaction needs to be traced throughout transcation pool code and generate debug printing
 	Creation       bool        // Set to true if "To" field of the transation is not set
+	To             [20]byte    // Recipient of the transaction, zero if Creation
 	DataLen        int         // Length of transaction's data (for calculation of intrinsic gas)
 	DataNonZeroLen int
-	AlAddrCount    int // Number of addresses in the access list
-	AlStorCount    int // Number of storage keys in the access list
+	AlAddrCount    int    // Number of addresses in the access list
+	AlStorCount    int    // Number of storage keys in the access list
+	AuthCount      int    // Number of authorizations of set-code transaction (EIP-7702)
+	Type           byte   // Transaction type (EIP-2718), LegacyTxType for legacy transactions
+	BlobFeeCap     uint64 // Maximum fee per blob gas of blob transaction (EIP-4844)
+	BlobHashes     Hashes // Versioned hashes of the blobs of blob transaction
+	BlobSidecar    bool   // Set if blob transaction came in network form - Rlp contains blobs, commitments and proofs
+	Size           uint32 // Length of Rlp, kept when Rlp is released
 	//bestIdx     int         // Index of the transaction in the best priority queue (of whatever pool it currently belongs to)
 	//worstIdx    int         // Index of the transaction in the worst priority queue (of whatever pook it currently belongs to)
 	//local       bool        // Whether transaction has been injected locally (and hence needs priority when mining or proposing a block)
@@ -103,6 +147,17 @@ const (
 	AccessListTxType int = 1
 	DynamicFeeTxType int = 2
 	StarknetTxType   int = 3
+	BlobTxType       int = 3 // Shares type with StarknetTxType, chain config chooses one of them
+	SetCodeTxType    int = 4
+)
+
+// Sizes of elements of blob transaction sidecar (EIP-4844)
+const (
+	BlobSize          = 4096 * 32
+	KzgCommitmentSize = 48
+	KzgProofSize      = 48
+
+	blobCommitmentVersionKZG byte = 0x01
 )
 
 var ErrParseTxn = fmt.Errorf("%w transaction", rlp.ErrParse)
@@ -110,9 +165,22 @@ var ErrParseTxn = fmt.Errorf("%w transaction", rlp.ErrParse)
 var ErrRejected = errors.New("rejected")
 var ErrAlreadyKnown = errors.New("already known")
 var ErrRlpTooBig = errors.New("txn rlp too big")
+var ErrNoBlobVerifier = errors.New("no verifier of blobs")
+var ErrBlobVerifierRegistered = errors.New("blob verifier is already registered")
 
 func (ctx *TxParseContext) ValidateRLP(f func(txnRlp []byte) error) { ctx.validateRlp = f }
 func (ctx *TxParseContext) WithSender(v bool)                       { ctx.withSender = v }
+func (ctx *TxParseContext) WithSenderCache(c *SenderCache)          { ctx.senderCache = c }
+
+// TrustBlobs - blobs of blob transactions in network form are not verified, for transactions which were verified
+// before they were stored
+func (ctx *TxParseContext) TrustBlobs(v bool) { ctx.trustBlobs = v }
+
+// WithChainConfig - type 3 is blob transaction on chains which schedule Cancun, Starknet transaction otherwise.
+// Without chain config type 3 is Starknet transaction
+func (ctx *TxParseContext) WithChainConfig(c *chain.Config) {
+	ctx.cfg.Blobs = c != nil && c.CancunTime != nil
+}
 
 // ParseTransaction extracts all the information from the transactions's payload (RLP) necessary to build TxSlot
 // it also performs syntactic validation of the transactions
@@ -145,9 +213,17 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	p = dataPos
 
 	var txType int
+	var spec *TxTypeSpec // nil for legacy transaction
+	var wrapperPos int   // Position of the sidecar wrapper, for blob transaction in network form
 	// If it is non-legacy transaction, the transaction type follows, and then the the list
 	if !legacy {
 		txType = int(payload[p])
+		if spec = txTypes[txType]; spec == nil {
+			spec = unknownTxType
+			if txType >= DynamicFeeTxType {
+				spec = unknownDynamicFeeTxType
+			}
+		}
 		if _, err = ctx.Keccak1.Write(payload[p : p+1]); err != nil {
 			return 0, fmt.Errorf("%w: computing IdHash (hashing type Prefix): %s", ErrParseTxn, err)
 		}
@@ -158,21 +234,40 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		if p >= len(payload) {
 			return 0, fmt.Errorf("%w: unexpected end of payload after txType", ErrParseTxn)
 		}
+		typePos := p - 1
 		dataPos, dataLen, err = rlp.List(payload, p)
 		if err != nil {
 			return 0, fmt.Errorf("%w: envelope Prefix: %s", ErrParseTxn, err)
 		}
+		envelopeEnd := dataPos + dataLen
+		// Blob transaction in network form is wrapped together with its sidecar:
+		// rlp([tx_payload_body, blobs, commitments, proofs]), the body is the first element of the list
+		if txType == BlobTxType && ctx.cfg.Blobs {
+			if _, _, isList, err := rlp.Prefix(payload, dataPos); err == nil && isList {
+				wrapperPos = dataPos
+				p = dataPos
+				if dataPos, dataLen, err = rlp.List(payload, p); err != nil {
+					return 0, fmt.Errorf("%w: blob tx body Prefix: %s", ErrParseTxn, err)
+				}
+			}
+		}
 		// Hash the envelope, not the full payload
 		if _, err = ctx.Keccak1.Write(payload[p : dataPos+dataLen]); err != nil {
 			return 0, fmt.Errorf("%w: computing IdHash (hashing the envelope): %s", ErrParseTxn, err)
 		}
 		// For legacy transaction, the entire payload in expected to be in "rlp" field
 		// whereas for non-legacy, only the content of the envelope (start with position p)
-		slot.Rlp = payload[p-1 : dataPos+dataLen]
+		slot.Rlp = payload[typePos:envelopeEnd]
 		p = dataPos
 	} else {
 		slot.Rlp = payload[pos : dataPos+dataLen]
 	}
+	slot.Type = byte(txType)
+	slot.Size = uint32(len(slot.Rlp))
+	slot.BlobFeeCap = 0
+	slot.BlobHashes = slot.BlobHashes[:0]
+	slot.BlobSidecar = wrapperPos > 0
+	slot.AuthCount = 0
 
 	if ctx.validateRlp != nil {
 		if err := ctx.validateRlp(slot.Rlp); err != nil {
@@ -203,7 +298,7 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	}
 	// Next follows feeCap, but only for dynamic fee transactions, for legacy transaction, it is
 	// equal to tip
-	if txType < DynamicFeeTxType {
+	if spec == nil || !spec.DynamicFee {
 		slot.FeeCap = slot.Tip.Uint64()
 	} else {
 		// Although consensus rules specify that feeCap can be up to 256 bit long, we narrow it to 64 bit
@@ -227,6 +322,7 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	}
 	// Only note if To field is empty or not
 	slot.Creation = dataLen == 0
+	copy(slot.To[:], payload[dataPos:dataPos+dataLen])
 	p = dataPos + dataLen
 	// Next follows value
 	p, err = rlp.U256(payload, p, &slot.Value)
@@ -251,13 +347,17 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	p = dataPos + dataLen
 
 	// Next goes starknet tx salt, but we are only interesting in its length
-	if txType == StarknetTxType {
+	starknet := txType == StarknetTxType && !ctx.cfg.Blobs
+	if starknet {
 		dataPos, dataLen, err = rlp.String(payload, p)
 		if err != nil {
-			return 0, fmt.Errorf("%w: data len: %s", ErrParseTxn, err)
+			return 0, fmt.Errorf("%w: salt len: %s", ErrParseTxn, err)
 		}
 		p = dataPos + dataLen
 	}
+	if spec != nil && spec.NoCreation && slot.Creation && !starknet {
+		return 0, fmt.Errorf("%w: %s transaction can't create contract", ErrParseTxn, spec.Name)
+	}
 
 	// Next follows access list for non-legacy transactions, we are only interesting in number of addresses and storage keys
 	if !legacy {
@@ -302,6 +402,12 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		}
 		p = dataPos + dataLen
 	}
+	// Next follow type-specific fields
+	if spec != nil && spec.ParseFields != nil && !starknet {
+		if p, err = spec.ParseFields(payload, p, slot); err != nil {
+			return 0, err
+		}
+	}
 	// This is where the data for Sighash ends
 	// Next follows V of the signature
 	var vByte byte
@@ -366,7 +472,6 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	if err != nil {
 		return 0, fmt.Errorf("%w: S: %s", ErrParseTxn, err)
 	}
-
 	// For legacy transactions, hash the full payload
 	if legacy {
 		if _, err = ctx.Keccak1.Write(payload[pos:p]); err != nil {
@@ -380,10 +485,25 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 			return p, err
 		}
 	}
+	// Sidecar is not covered by hash, it is parsed and verified after known transactions are rejected
+	if wrapperPos > 0 {
+		verify := blobVerifier
+		if ctx.trustBlobs {
+			verify = nil
+		} else if verify == nil {
+			return 0, fmt.Errorf("%w: blob transaction in network form", ErrNoBlobVerifier)
+		}
+		if p, err = parseBlobSidecar(payload, p, slot.BlobHashes, verify); err != nil {
+			return 0, err
+		}
+	}
 
 	if !ctx.withSender {
 		return p, nil
 	}
+	if ctx.senderCache != nil && ctx.senderCache.get(slot.IDHash[:], sender) {
+		return p, nil
+	}
 
 	// Computing sigHash (hash used to recover sender from the signature)
 	// Write len Prefix to the Sighash
@@ -454,6 +574,94 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	_, _ = ctx.Keccak2.(io.Reader).Read(ctx.buf[:32])
 	//take last 20 bytes as address
 	copy(sender, ctx.buf[12:32])
+	if ctx.senderCache != nil {
+		ctx.senderCache.add(slot.IDHash[:], sender)
+	}
+	return p, nil
+}
+
+// BlobVerifier - verifies by KZG proofs that blobs of blob transaction (EIP-4844) match commitments, as
+// verify_blob_kzg_proof_batch. Element i of each slice belongs to blob i
+type BlobVerifier func(blobs, commitments, proofs [][]byte) error
+
+var blobVerifier BlobVerifier
+
+// RegisterBlobVerifier must be called from init by binary which links KZG library. Without verifier parser rejects
+// blob transactions in network form, except of contexts which TrustBlobs. Only first verifier is registered
+func RegisterBlobVerifier(v BlobVerifier) error {
+	if blobVerifier != nil {
+		return ErrBlobVerifierRegistered
+	}
+	blobVerifier = v
+	return nil
+}
+
+// parseBlobSidecar parses blobs, commitments and proofs which follow the body of blob transaction in network form,
+// checks that commitments match versioned hashes of the transaction and verifies blobs by verify (nil - trusted)
+func parseBlobSidecar(payload []byte, pos int, blobHashes Hashes, verify BlobVerifier) (p int, err error) {
+	p = pos
+	var blobs, commitments, proofs [][]byte
+	parseList := func(name string, elemLen int, f func(elem []byte) error) error {
+		dataPos, dataLen, err := rlp.List(payload, p)
+		if err != nil {
+			return fmt.Errorf("%w: %s len: %s", ErrParseTxn, name, err)
+		}
+		count, elemPos := 0, dataPos
+		for elemPos < dataPos+dataLen {
+			if elemPos, err = rlp.StringOfLen(payload, elemPos, elemLen); err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrParseTxn, name, err)
+			}
+			if f != nil {
+				if err = f(payload[elemPos : elemPos+elemLen]); err != nil {
+					return err
+				}
+			}
+			elemPos += elemLen
+			count++
+		}
+		if elemPos != dataPos+dataLen {
+			return fmt.Errorf("%w: extraneous space in the %s", ErrParseTxn, name)
+		}
+		if count != blobHashes.Len() {
+			return fmt.Errorf("%w: %d %s for %d blob hashes", ErrParseTxn, count, name, blobHashes.Len())
+		}
+		p = dataPos + dataLen
+		return nil
+	}
+	if err = parseList("blobs", BlobSize, func(blob []byte) error {
+		blobs = append(blobs, blob)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var versionedHash [32]byte
+	i := 0
+	if err = parseList("commitments", KzgCommitmentSize, func(commitment []byte) error {
+		if i >= blobHashes.Len() {
+			return fmt.Errorf("%w: more commitments than blob hashes", ErrParseTxn)
+		}
+		versionedHash = sha256.Sum256(commitment)
+		versionedHash[0] = blobCommitmentVersionKZG
+		if !bytes.Equal(versionedHash[:], blobHashes.At(i)) {
+			return fmt.Errorf("%w: commitment %d doesn't match blob hash %x", ErrParseTxn, i, blobHashes.At(i))
+		}
+		commitments = append(commitments, commitment)
+		i++
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if err = parseList("proofs", KzgProofSize, func(proof []byte) error {
+		proofs = append(proofs, proof)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if verify != nil {
+		if err = verify(blobs, commitments, proofs); err != nil {
+			return 0, fmt.Errorf("%w: blobs don't match commitments: %s", ErrParseTxn, err)
+		}
+	}
 	return p, nil
 }
 
@@ -657,6 +865,32 @@ func DecodeSender(enc []byte) (nonce uint64, balance uint256.Int, err error) {
 	return
 }
 
+// DecodeAccountCodeHash returns code hash of account encoded for storage, false if account has no code
+func DecodeAccountCodeHash(enc []byte) (codeHash [32]byte, ok bool, err error) {
+	if len(enc) == 0 {
+		return codeHash, false, nil
+	}
+	var fieldSet = enc[0]
+	var pos = 1
+	for _, field := range []byte{1, 2, 4} { // nonce, balance, incarnation
+		if fieldSet&field == 0 {
+			continue
+		}
+		if len(enc) <= pos || len(enc) < pos+int(enc[pos])+1 {
+			return codeHash, false, fmt.Errorf("malformed CBOR for Account: field %d", field)
+		}
+		pos += int(enc[pos]) + 1
+	}
+	if fieldSet&8 == 0 {
+		return codeHash, false, nil
+	}
+	if len(enc) <= pos || enc[pos] != 32 || len(enc) < pos+33 {
+		return codeHash, false, fmt.Errorf("malformed CBOR for Account.CodeHash: %x", enc[pos:])
+	}
+	copy(codeHash[:], enc[pos+1:pos+33])
+	return codeHash, true, nil
+}
+
 func bytesToUint64(buf []byte) (x uint64) {
 	for i, b := range buf {
 		x = x<<8 + uint64(b)
@@ -18,11 +18,20 @@ package types
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
 	"strconv"
 	"testing"
 
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/fixedgas"
+	"github.com/ledgerwatch/erigon-lib/rlp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
 )
 
 func TestParseTransactionRLP(t *testing.T) {
@@ -101,3 +110,172 @@ func toHashes(h ...byte) (out Hashes) {
 	}
 	return out
 }
+
+func rlpString(b []byte) []byte {
+	buf := make([]byte, rlp.StringLen(len(b))+8)
+	return buf[:rlp.EncodeString(b, buf)]
+}
+
+func rlpU64(i uint64) []byte {
+	var buf [9]byte
+	return common.Copy(buf[:rlp.EncodeU64(i, buf[:])])
+}
+
+func rlpList(items ...[]byte) []byte {
+	var content []byte
+	for _, item := range items {
+		content = append(content, item...)
+	}
+	var prefix [10]byte
+	return append(common.Copy(prefix[:rlp.EncodeListPrefix(len(content), prefix[:])]), content...)
+}
+
+func TestParseBlobTransaction(t *testing.T) {
+	require := require.New(t)
+	commitments := [][]byte{bytes.Repeat([]byte{1}, KzgCommitmentSize), bytes.Repeat([]byte{2}, KzgCommitmentSize)}
+	var hashes, blobs, commitmentsRlp, proofs [][]byte
+	for _, c := range commitments {
+		h := sha256.Sum256(c)
+		h[0] = blobCommitmentVersionKZG
+		hashes = append(hashes, rlpString(h[:]))
+		blobs = append(blobs, rlpString(make([]byte, BlobSize)))
+		commitmentsRlp = append(commitmentsRlp, rlpString(c))
+		proofs = append(proofs, rlpString(make([]byte, KzgProofSize)))
+	}
+	body := func(hashes ...[]byte) []byte {
+		return rlpList(rlpU64(1), rlpU64(7), rlpU64(1), rlpU64(100), rlpU64(21000), rlpString(bytes.Repeat([]byte{0xaa}, 20)),
+			rlpU64(0), rlpString(nil), rlpList(), rlpU64(10), rlpList(hashes...), rlpU64(0), rlpU64(1), rlpU64(1))
+	}
+	cancun := &chain.Config{CancunTime: big.NewInt(0)}
+	ctx := NewTxParseContext(*uint256.NewInt(1))
+	ctx.WithSender(false)
+	ctx.WithChainConfig(cancun)
+
+	canonical := append([]byte{byte(BlobTxType)}, body(hashes...)...)
+	idHash := sha3.NewLegacyKeccak256()
+	idHash.Write(canonical)
+	expectIDHash := idHash.Sum(nil)
+
+	tx := &TxSlot{}
+	p, err := ctx.ParseTransaction(canonical, 0, tx, nil, false /* hasEnvelope */, nil)
+	require.NoError(err)
+	require.Equal(len(canonical), p)
+	require.Equal(uint64(7), tx.Nonce)
+	require.Equal(uint64(10), tx.BlobFeeCap)
+	require.Equal(2, tx.BlobHashes.Len())
+	require.False(tx.BlobSidecar)
+	require.Equal(expectIDHash, tx.IDHash[:])
+
+	wrapped := append([]byte{byte(BlobTxType)}, rlpList(body(hashes...), rlpList(blobs...), rlpList(commitmentsRlp...), rlpList(proofs...))...)
+	// network form is rejected without verifier of blobs
+	_, err = ctx.ParseTransaction(wrapped, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrNoBlobVerifier)
+	defer func(v BlobVerifier) { blobVerifier = v }(blobVerifier)
+	require.NoError(RegisterBlobVerifier(func(blobs, commitments, proofs [][]byte) error {
+		if !bytes.Equal(commitments[0], bytes.Repeat([]byte{1}, KzgCommitmentSize)) {
+			return fmt.Errorf("invalid proof")
+		}
+		require.Equal(2, len(blobs))
+		require.Equal(2, len(proofs))
+		return nil
+	}))
+	require.ErrorIs(RegisterBlobVerifier(func(blobs, commitments, proofs [][]byte) error { return nil }), ErrBlobVerifierRegistered)
+	tx = &TxSlot{}
+	p, err = ctx.ParseTransaction(wrapped, 0, tx, nil, false /* hasEnvelope */, nil)
+	require.NoError(err)
+	require.Equal(len(wrapped), p)
+	require.True(tx.BlobSidecar)
+	require.Equal(2, tx.BlobHashes.Len())
+	require.Equal(expectIDHash, tx.IDHash[:])
+	require.Equal(wrapped, tx.Rlp)
+
+	// blobs must match commitments
+	blobVerifier = func(blobs, commitments, proofs [][]byte) error { return fmt.Errorf("invalid proof") }
+	_, err = ctx.ParseTransaction(wrapped, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+	trusted := NewTxParseContext(*uint256.NewInt(1))
+	trusted.WithSender(false)
+	trusted.TrustBlobs(true)
+	trusted.WithChainConfig(cancun)
+	_, err = trusted.ParseTransaction(wrapped, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.NoError(err)
+
+	// commitments must match versioned hashes
+	mismatch := append([]byte{byte(BlobTxType)}, rlpList(body(hashes...), rlpList(blobs...), rlpList(commitmentsRlp[1], commitmentsRlp[0]), rlpList(proofs...))...)
+	_, err = ctx.ParseTransaction(mismatch, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+	// sidecar must have blob for each hash
+	missing := append([]byte{byte(BlobTxType)}, rlpList(body(hashes...), rlpList(blobs[0]), rlpList(commitmentsRlp...), rlpList(proofs...))...)
+	_, err = ctx.ParseTransaction(missing, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+	// at least one blob
+	noBlobs := append([]byte{byte(BlobTxType)}, body()...)
+	_, err = ctx.ParseTransaction(noBlobs, 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+}
+
+func TestParseSetCodeTransaction(t *testing.T) {
+	require := require.New(t)
+	auth := rlpList(rlpU64(1), rlpString(bytes.Repeat([]byte{0xbb}, 20)), rlpU64(3), rlpU64(1), rlpU64(1), rlpU64(1))
+	body := func(to []byte, auths ...[]byte) []byte {
+		return rlpList(rlpU64(1), rlpU64(7), rlpU64(1), rlpU64(100), rlpU64(100000), rlpString(to),
+			rlpU64(0), rlpString(nil), rlpList(), rlpList(auths...), rlpU64(0), rlpU64(1), rlpU64(1))
+	}
+	ctx := NewTxParseContext(*uint256.NewInt(1))
+	ctx.WithSender(false)
+
+	to := bytes.Repeat([]byte{0xaa}, 20)
+	payload := append([]byte{byte(SetCodeTxType)}, body(to, auth, auth)...)
+	tx := &TxSlot{}
+	p, err := ctx.ParseTransaction(payload, 0, tx, nil, false /* hasEnvelope */, nil)
+	require.NoError(err)
+	require.Equal(len(payload), p)
+	require.Equal(byte(SetCodeTxType), tx.Type)
+	require.Equal(uint64(7), tx.Nonce)
+	require.Equal(uint64(100), tx.FeeCap)
+	require.Equal(2, tx.AuthCount)
+	require.Equal(to, tx.To[:])
+
+	// at least one authorization
+	_, err = ctx.ParseTransaction(append([]byte{byte(SetCodeTxType)}, body(to)...), 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+	// can't create contract
+	_, err = ctx.ParseTransaction(append([]byte{byte(SetCodeTxType)}, body(nil, auth)...), 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+	// unknown type is parsed as dynamic fee transaction without type-specific fields
+	unknown := append([]byte{0x7f}, rlpList(rlpU64(1), rlpU64(7), rlpU64(1), rlpU64(100), rlpU64(100000), rlpString(nil),
+		rlpU64(0), rlpString(nil), rlpList(), rlpU64(0), rlpU64(1), rlpU64(1))...)
+	tx = &TxSlot{}
+	p, err = ctx.ParseTransaction(unknown, 0, tx, nil, false /* hasEnvelope */, nil)
+	require.NoError(err)
+	require.Equal(len(unknown), p)
+	require.Equal(byte(0x7f), tx.Type)
+	require.Equal(uint64(100), tx.FeeCap)
+	require.True(tx.Creation)
+	// type-specific fields of unknown type can't be parsed
+	_, err = ctx.ParseTransaction(append([]byte{0x7f}, body(to, auth)...), 0, &TxSlot{}, nil, false /* hasEnvelope */, nil)
+	require.ErrorIs(err, ErrParseTxn)
+}
+
+func TestTxTypeActive(t *testing.T) {
+	require := require.New(t)
+	cfg := &chain.Config{BerlinBlock: big.NewInt(0), LondonBlock: big.NewInt(10)}
+	require.True(TxTypeActive(cfg, byte(LegacyTxType), 0, 0))
+	require.True(TxTypeActive(cfg, byte(AccessListTxType), 0, 0))
+	require.False(TxTypeActive(cfg, byte(DynamicFeeTxType), 9, 0))
+	require.True(TxTypeActive(cfg, byte(DynamicFeeTxType), 10, 0))
+	require.True(TxTypeActive(cfg, byte(BlobTxType), 0, 0))          // Starknet transaction without Cancun
+	require.Nil(txTypes[BlobTxType].ForkTime(cfg))                   // blob transactions are never valid without Cancun
+	require.False(TxTypeActive(cfg, byte(SetCodeTxType), 100, 1000)) // fork is not scheduled
+	cfg.CancunTime, cfg.PragueTime = big.NewInt(500), big.NewInt(1000)
+	require.False(TxTypeActive(cfg, byte(BlobTxType), 100, 499))
+	require.True(TxTypeActive(cfg, byte(BlobTxType), 100, 500))
+	require.False(TxTypeActive(cfg, byte(SetCodeTxType), 100, 999))
+	require.True(TxTypeActive(cfg, byte(SetCodeTxType), 100, 1000))
+	require.True(TxTypeActive(nil, byte(SetCodeTxType), 0, 0))
+	require.True(TxTypeActive(nil, 0x7f, 0, 0)) // all types are valid without chain config
+	require.False(TxTypeActive(cfg, 0x7f, 100, 1000))
+	require.Equal(uint64(2*fixedgas.PerEmptyAccountCostEIP7702), TxTypeIntrinsicGas(&TxSlot{Type: byte(SetCodeTxType), AuthCount: 2}))
+	require.Equal(uint64(0), TxTypeIntrinsicGas(&TxSlot{Type: byte(DynamicFeeTxType)}))
+	require.Panics(func() { RegisterTxType(byte(SetCodeTxType), &TxTypeSpec{Name: "duplicate"}) })
+}
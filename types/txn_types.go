@@ -0,0 +1,208 @@
+/*
+   Copyright 2022 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common/fixedgas"
+	"github.com/ledgerwatch/erigon-lib/rlp"
+)
+
+// TxTypeSpec - transaction type (EIP-2718) known to the parser. Typed transactions share the layout
+// rlp([chain_id, nonce, fee fields, gas, to, value, data, access_list, type-specific fields, y_parity, r, s]),
+// spec describes the differences. New transaction type is added by RegisterTxType, parser doesn't change
+type TxTypeSpec struct {
+	Name       string
+	DynamicFee bool // max_priority_fee_per_gas and max_fee_per_gas (EIP-1559) instead of gas_price
+	NoCreation bool // "to" is required
+	// ParseFields parses type-specific fields which follow the access list, nil if there are no such fields
+	ParseFields func(payload []byte, pos int, slot *TxSlot) (p int, err error)
+	// Fork returns switch block of chain config from which transactions of the type are valid, nil if the fork
+	// is not scheduled. Fork == nil && ForkTime == nil - transactions of the type are valid on all chains
+	Fork func(c *chain.Config) *big.Int
+	// ForkTime - as Fork, for forks scheduled by block time (after The Merge)
+	ForkTime func(c *chain.Config) *big.Int
+	// IntrinsicGas returns gas of type-specific fields, which is added to intrinsic gas of transaction, nil - none
+	IntrinsicGas func(slot *TxSlot) uint64
+}
+
+var txTypes [256]*TxTypeSpec
+
+// Transactions of unregistered types are parsed with the common layout, without type-specific fields
+var (
+	unknownTxType           = &TxTypeSpec{Name: "unknown"}
+	unknownDynamicFeeTxType = &TxTypeSpec{Name: "unknown", DynamicFee: true}
+)
+
+// RegisterTxType must be called from init, registry is not thread-safe
+func RegisterTxType(txType byte, spec *TxTypeSpec) {
+	if txType == byte(LegacyTxType) || txType >= 0x80 {
+		panic(fmt.Sprintf("transaction type %d is not EIP-2718 type", txType))
+	}
+	if txTypes[txType] != nil {
+		panic(fmt.Sprintf("transaction type %d is already registered: %s", txType, txTypes[txType].Name))
+	}
+	txTypes[txType] = spec
+}
+
+// TxTypeActive - whether transactions of the type are valid in block blockNum with time blockTime of chain c.
+// Legacy transactions are always valid, c == nil - transactions of all types are valid (including unregistered),
+// otherwise transactions of unregistered types are not valid
+func TxTypeActive(c *chain.Config, txType byte, blockNum, blockTime uint64) bool {
+	if txType == byte(LegacyTxType) || c == nil {
+		return true
+	}
+	if txType == byte(StarknetTxType) && c.CancunTime == nil {
+		return true // not blob transaction, see TxParseContext.WithChainConfig
+	}
+	spec := txTypes[txType]
+	if spec == nil {
+		return false
+	}
+	if spec.Fork != nil {
+		if fork := spec.Fork(c); fork == nil || fork.Uint64() > blockNum {
+			return false
+		}
+	}
+	if spec.ForkTime != nil {
+		if fork := spec.ForkTime(c); fork == nil || fork.Uint64() > blockTime {
+			return false
+		}
+	}
+	return true
+}
+
+// TxTypeIntrinsicGas - gas of type-specific fields of transaction, to add to intrinsic gas
+func TxTypeIntrinsicGas(slot *TxSlot) uint64 {
+	if spec := txTypes[slot.Type]; spec != nil && spec.IntrinsicGas != nil {
+		return spec.IntrinsicGas(slot)
+	}
+	return 0
+}
+
+func init() {
+	RegisterTxType(byte(AccessListTxType), &TxTypeSpec{
+		Name: "access list",
+		Fork: func(c *chain.Config) *big.Int { return c.BerlinBlock },
+	})
+	RegisterTxType(byte(DynamicFeeTxType), &TxTypeSpec{
+		Name:       "dynamic fee",
+		DynamicFee: true,
+		Fork:       func(c *chain.Config) *big.Int { return c.LondonBlock },
+	})
+	RegisterTxType(byte(BlobTxType), &TxTypeSpec{
+		Name:        "blob",
+		DynamicFee:  true,
+		NoCreation:  true,
+		ParseFields: parseBlobFields,
+		ForkTime:    func(c *chain.Config) *big.Int { return c.CancunTime },
+	})
+	RegisterTxType(byte(SetCodeTxType), &TxTypeSpec{
+		Name:         "set code",
+		DynamicFee:   true,
+		NoCreation:   true,
+		ParseFields:  parseAuthorizations,
+		ForkTime:     func(c *chain.Config) *big.Int { return c.PragueTime },
+		IntrinsicGas: func(slot *TxSlot) uint64 { return uint64(slot.AuthCount) * fixedgas.PerEmptyAccountCostEIP7702 },
+	})
+}
+
+// parseBlobFields parses max fee per blob gas and versioned hashes of the blobs of blob transaction (EIP-4844)
+func parseBlobFields(payload []byte, pos int, slot *TxSlot) (p int, err error) {
+	// Although consensus rules specify that max fee per blob gas can be up to 256 bit long, we narrow it to 64 bit
+	p, slot.BlobFeeCap, err = rlp.U64(payload, pos)
+	if err != nil {
+		return 0, fmt.Errorf("%w: blob feeCap: %s", ErrParseTxn, err)
+	}
+	dataPos, dataLen, err := rlp.List(payload, p)
+	if err != nil {
+		return 0, fmt.Errorf("%w: blob hashes len: %s", ErrParseTxn, err)
+	}
+	hashPos := dataPos
+	for hashPos < dataPos+dataLen {
+		if hashPos, err = rlp.StringOfLen(payload, hashPos, 32); err != nil {
+			return 0, fmt.Errorf("%w: blob hash len: %s", ErrParseTxn, err)
+		}
+		if payload[hashPos] != blobCommitmentVersionKZG {
+			return 0, fmt.Errorf("%w: unsupported blob hash version: %d", ErrParseTxn, payload[hashPos])
+		}
+		slot.BlobHashes = append(slot.BlobHashes, payload[hashPos:hashPos+32]...)
+		hashPos += 32
+	}
+	if hashPos != dataPos+dataLen {
+		return 0, fmt.Errorf("%w: extraneous space in the blob hashes after all hashes", ErrParseTxn)
+	}
+	if slot.BlobHashes.Len() == 0 {
+		return 0, fmt.Errorf("%w: blob transaction without blobs", ErrParseTxn)
+	}
+	return dataPos + dataLen, nil
+}
+
+// parseAuthorizations parses authorization list of set-code transaction (EIP-7702):
+// rlp([[chain_id, address, nonce, y_parity, r, s], ...]). Authorities are recovered by execution, pool needs the count
+func parseAuthorizations(payload []byte, pos int, slot *TxSlot) (p int, err error) {
+	dataPos, dataLen, err := rlp.List(payload, pos)
+	if err != nil {
+		return 0, fmt.Errorf("%w: authorization list len: %s", ErrParseTxn, err)
+	}
+	var v uint256.Int
+	var yParity uint64
+	tuplePos := dataPos
+	for tuplePos < dataPos+dataLen {
+		var tupleLen int
+		if tuplePos, tupleLen, err = rlp.List(payload, tuplePos); err != nil {
+			return 0, fmt.Errorf("%w: authorization len: %s", ErrParseTxn, err)
+		}
+		if p, err = rlp.U256(payload, tuplePos, &v); err != nil {
+			return 0, fmt.Errorf("%w: authorization chainId: %s", ErrParseTxn, err)
+		}
+		if p, err = rlp.StringOfLen(payload, p, 20); err != nil {
+			return 0, fmt.Errorf("%w: authorization address len: %s", ErrParseTxn, err)
+		}
+		if p, _, err = rlp.U64(payload, p+20); err != nil {
+			return 0, fmt.Errorf("%w: authorization nonce: %s", ErrParseTxn, err)
+		}
+		if p, yParity, err = rlp.U64(payload, p); err != nil {
+			return 0, fmt.Errorf("%w: authorization y_parity: %s", ErrParseTxn, err)
+		}
+		if yParity > 1 {
+			return 0, fmt.Errorf("%w: authorization y_parity is too large: %d", ErrParseTxn, yParity)
+		}
+		if p, err = rlp.U256(payload, p, &v); err != nil {
+			return 0, fmt.Errorf("%w: authorization R: %s", ErrParseTxn, err)
+		}
+		if p, err = rlp.U256(payload, p, &v); err != nil {
+			return 0, fmt.Errorf("%w: authorization S: %s", ErrParseTxn, err)
+		}
+		if p != tuplePos+tupleLen {
+			return 0, fmt.Errorf("%w: extraneous space in the authorization", ErrParseTxn)
+		}
+		slot.AuthCount++
+		tuplePos = p
+	}
+	if tuplePos != dataPos+dataLen {
+		return 0, fmt.Errorf("%w: extraneous space in the authorization list", ErrParseTxn)
+	}
+	if slot.AuthCount == 0 {
+		return 0, fmt.Errorf("%w: set code transaction without authorizations", ErrParseTxn)
+	}
+	return dataPos + dataLen, nil
+}